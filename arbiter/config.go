@@ -18,11 +18,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/config"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
-	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"go.uber.org/zap"
 )
@@ -30,6 +32,8 @@ import (
 const (
 	defaultKafkaAddrs   = "127.0.0.1:9092"
 	defaultKafkaVersion = "0.8.2.0"
+	defaultWorkerCount  = 16
+	defaultBatchSize    = 64
 )
 
 var (
@@ -46,10 +50,13 @@ type Config struct {
 
 	Up   UpConfig   `toml:"up" json:"up"`
 	Down DownConfig `toml:"down" json:"down"`
+	// the replication tasks besides the default one configured by Up and Down
+	Tasks []TaskConfig `toml:"task" json:"task"`
 
-	Metrics      Metrics `toml:"metrics" json:"metrics"`
-	configFile   string
-	printVersion bool
+	Metrics              Metrics `toml:"metrics" json:"metrics"`
+	configFile           string
+	printVersion         bool
+	printEffectiveConfig bool
 }
 
 // Metrics is configuration of metrics
@@ -69,16 +76,28 @@ type UpConfig struct {
 	SaramaBufferSize  int    `toml:"sarama-buffer-size" json:"sarama-buffer-size"`
 }
 
+// TaskConfig is configuration of a replication task, which loads the binlogs of its own topic to its own downstream
+type TaskConfig struct {
+	Name string     `toml:"name" json:"name"`
+	Up   UpConfig   `toml:"up" json:"up"`
+	Down DownConfig `toml:"down" json:"down"`
+}
+
 // DownConfig is configuration of downstream
 type DownConfig struct {
 	Host     string `toml:"host" json:"host"`
 	Port     int    `toml:"port" json:"port"`
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
+	// read the password from the environment variable, the file or the command instead of Password,
+	// it's read again when reconnecting, so the rotated password is picked up
+	PasswordFrom *secret.Source `toml:"password-from" json:"password-from"`
 
 	WorkerCount int  `toml:"worker-count" json:"worker-count"`
 	BatchSize   int  `toml:"batch-size" json:"batch-size"`
 	SafeMode    bool `toml:"safe-mode" json:"safe-mode"`
+	// in milliseconds, 0 means don't log the slow batches
+	SlowBatchThreshold int `toml:"slow-batch-threshold" json:"slow-batch-threshold"`
 }
 
 // NewConfig return an instance of configuration
@@ -95,6 +114,7 @@ func NewConfig() *Config {
 	fs.StringVar(&cfg.LogLevel, "L", "info", "log level: debug, info, warn, error, fatal")
 	fs.StringVar(&cfg.configFile, "config", "", "path to the configuration file")
 	fs.BoolVar(&cfg.printVersion, "V", false, "print version information and exit")
+	fs.BoolVar(&cfg.printEffectiveConfig, "print-effective-config", false, "print the effective config in TOML after parsing the config file and flags and exit")
 	fs.StringVar(&cfg.Metrics.Addr, "metrics.addr", "", "prometheus pushgateway address, leaves it empty will disable prometheus push")
 	fs.IntVar(&cfg.Metrics.Interval, "metrics.interval", 15, "prometheus client push interval in second, set \"0\" to disable prometheus push")
 	fs.StringVar(&cfg.LogFile, "log-file", "", "log file path")
@@ -103,8 +123,8 @@ func NewConfig() *Config {
 	fs.Int64Var(&cfg.Up.InitialCommitTS, "up.initial-commit-ts", 0, "if arbiter doesn't have checkpoint, use initial commitTS to initial checkpoint")
 	fs.StringVar(&cfg.Up.Topic, "up.topic", "", "topic name of kafka")
 
-	fs.IntVar(&cfg.Down.WorkerCount, "down.worker-count", 16, "concurrency write to downstream")
-	fs.IntVar(&cfg.Down.BatchSize, "down.batch-size", 64, "batch size write to downstream")
+	fs.IntVar(&cfg.Down.WorkerCount, "down.worker-count", defaultWorkerCount, "concurrency write to downstream")
+	fs.IntVar(&cfg.Down.BatchSize, "down.batch-size", defaultBatchSize, "batch size write to downstream")
 	fs.BoolVar(&cfg.Down.SafeMode, "safe-mode", false, "enable safe mode to make reentrant")
 
 	return cfg
@@ -160,7 +180,16 @@ func (cfg *Config) Parse(args []string) error {
 		return errors.Trace(err)
 	}
 
-	return cfg.validate()
+	if err := cfg.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.printEffectiveConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			return errors.Trace(err)
+		}
+		os.Exit(0)
+	}
+	return nil
 }
 
 // validate checks whether the configuration is valid
@@ -168,33 +197,118 @@ func (cfg *Config) validate() error {
 	if len(cfg.Up.Topic) == 0 {
 		return errUpTopicNotSpecified
 	}
+	if err := secret.CheckPassword(cfg.Down.Password, cfg.Down.PasswordFrom); err != nil {
+		return errors.Annotate(err, "invalid down")
+	}
+
+	tasks := cfg.taskConfigs()
+	for i := range cfg.Tasks {
+		task := &cfg.Tasks[i]
+		if task.Name == DefaultTaskName {
+			return errors.Errorf("task name %s is reserved for the task configured by [up] and [down]", DefaultTaskName)
+		}
+		if err := task.validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for i := range tasks {
+		for j := 0; j < i; j++ {
+			if err := tasks[i].conflict(&tasks[j]); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
 
 	return nil
 }
 
+// taskConfigs returns the configurations of all tasks, the default one comes first
+func (cfg *Config) taskConfigs() []TaskConfig {
+	tasks := make([]TaskConfig, 0, len(cfg.Tasks)+1)
+	tasks = append(tasks, TaskConfig{Name: DefaultTaskName, Up: cfg.Up, Down: cfg.Down})
+	return append(tasks, cfg.Tasks...)
+}
+
 func (cfg *Config) adjustConfig() error {
-	// cfg.Up
-	if len(cfg.Up.KafkaAddrs) == 0 {
-		cfg.Up.KafkaAddrs = defaultKafkaAddrs
+	cfg.Up.adjust()
+	cfg.Down.adjust()
+	for i := range cfg.Tasks {
+		cfg.Tasks[i].adjust()
+	}
+
+	return nil
+}
+
+// taskConfig returns the configuration of Server running the task, the metrics are pushed by the default task only
+func (cfg *Config) taskConfig(task *TaskConfig) *Config {
+	return &Config{
+		ListenAddr: cfg.ListenAddr,
+		Up:         task.Up,
+		Down:       task.Down,
+	}
+}
+
+func (up *UpConfig) adjust() {
+	if len(up.KafkaAddrs) == 0 {
+		up.KafkaAddrs = defaultKafkaAddrs
+	}
+	if len(up.KafkaVersion) == 0 {
+		up.KafkaVersion = defaultKafkaVersion
+	}
+}
+
+func (down *DownConfig) adjust() {
+	if len(down.Host) == 0 {
+		down.Host = "localhost"
 	}
-	if len(cfg.Up.KafkaVersion) == 0 {
-		cfg.Up.KafkaVersion = defaultKafkaVersion
+	if down.Port == 0 {
+		down.Port = 3306
 	}
+	if len(down.User) == 0 {
+		down.User = "root"
+	}
+	if down.WorkerCount <= 0 {
+		down.WorkerCount = defaultWorkerCount
+	}
+	if down.BatchSize <= 0 {
+		down.BatchSize = defaultBatchSize
+	}
+}
+
+func (task *TaskConfig) adjust() {
+	task.Up.adjust()
+	task.Down.adjust()
+}
 
-	// cfg.Down
-	if len(cfg.Down.Host) == 0 {
-		cfg.Down.Host = "localhost"
+func (task *TaskConfig) validate() error {
+	if len(task.Name) == 0 {
+		return errors.New("task name not config, please config the name of every task")
 	}
-	if cfg.Down.Port == 0 {
-		cfg.Down.Port = 3306
+	if strings.Contains(task.Name, "/") {
+		return errors.Errorf("task name %s contains '/'", task.Name)
 	}
-	if len(cfg.Down.User) == 0 {
-		cfg.Down.User = "root"
+	if len(task.Up.Topic) == 0 {
+		return errors.Errorf("task %s: up.topic not config, please config the topic name", task.Name)
 	}
+	if err := secret.CheckPassword(task.Down.Password, task.Down.PasswordFrom); err != nil {
+		return errors.Annotatef(err, "task %s: invalid down", task.Name)
+	}
+	return nil
+}
 
+// conflict returns an error if the tasks have the same name, or would share the checkpoint, which is saved in
+// downstream by the topic
+func (task *TaskConfig) conflict(other *TaskConfig) error {
+	if task.Name == other.Name {
+		return errors.Errorf("duplicate task name %s", task.Name)
+	}
+	if task.Up.Topic == other.Up.Topic && task.Down.Host == other.Down.Host && task.Down.Port == other.Down.Port {
+		return errors.Errorf("task %s and %s both load topic %s to %s:%d, they would share the checkpoint",
+			task.Name, other.Name, task.Up.Topic, task.Down.Host, task.Down.Port)
+	}
 	return nil
 }
 
 func (cfg *Config) configFromFile(path string) error {
-	return util.StrictDecodeFile(path, "arbiter", cfg)
+	return config.Load(path, "arbiter", cfg)
 }
@@ -0,0 +1,223 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// Status is the status of arbiter.
+type Status struct {
+	Task string `json:"task"`
+	// all txns with commit ts <= AppliedTS have been loaded to downstream
+	AppliedTS  int64          `json:"applied-ts"`
+	LagSeconds float64        `json:"lag-seconds"`
+	Paused     bool           `json:"paused"`
+	SafeMode   bool           `json:"safe-mode"`
+	QueueSizes map[string]int `json:"queue-sizes"`
+	ErrorCount int64          `json:"error-count"`
+}
+
+// Status returns the status of arbiter.
+func (s *Server) Status() *Status {
+	appliedTS := atomic.LoadInt64(&s.finishTS)
+	status := &Status{
+		Task:       s.task,
+		AppliedTS:  appliedTS,
+		Paused:     s.pauser.IsPaused(),
+		SafeMode:   s.load.GetSafeMode(),
+		QueueSizes: make(map[string]int),
+		ErrorCount: atomic.LoadInt64(&s.errorCount),
+	}
+	if appliedTS > 0 {
+		lag := time.Since(oracle.GetTimeFromTS(uint64(appliedTS)))
+		status.LagSeconds = lag.Seconds()
+	}
+	if s.kafkaReader != nil {
+		status.QueueSizes["kafka_reader"] = len(s.kafkaReader.Messages())
+	}
+
+	return status
+}
+
+// Pause stops loading binlogs to downstream until Resume is called.
+func (s *Server) Pause() {
+	s.pauser.Pause()
+	s.getLogger().Info("arbiter paused")
+}
+
+// Resume resumes loading binlogs to downstream.
+func (s *Server) Resume() {
+	s.pauser.Resume()
+	s.getLogger().Info("arbiter resumed")
+}
+
+// RegisterHTTPHandlers registers the admin APIs of arbiter to mux, including
+// `GET /status`, `GET /table-status`, `PUT /pause`, `PUT /resume` and `GET/PUT /log-level`.
+func (s *Server) RegisterHTTPHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/table-status", s.handleTableStatus)
+	mux.HandleFunc("/pause", s.handlePause)
+	mux.HandleFunc("/resume", s.handleResume)
+	mux.HandleFunc("/log-level", util.LogLevelHandler)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", r.Method))
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("get arbiter's status success", s.Status()))
+}
+
+// TableStatus returns the status of the tables loaded to downstream.
+func (s *Server) TableStatus() []loader.TableStatus {
+	return s.load.TableStatus()
+}
+
+func (s *Server) handleTableStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", r.Method))
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("get table status success", s.TableStatus()))
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", r.Method))
+		return
+	}
+	s.Pause()
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("pause arbiter success", nil))
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", r.Method))
+		return
+	}
+	s.Resume()
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("resume arbiter success", nil))
+}
+
+// RegisterHTTPHandlers registers the admin APIs of the default task to mux as Server.RegisterHTTPHandlers, and the
+// admin APIs of the tasks, including `GET /tasks`, `POST /tasks` with TaskConfig in JSON, `GET /tasks/{name}`,
+// `DELETE /tasks/{name}`, `GET /tasks/{name}/table-status`, `PUT /tasks/{name}/pause` and `PUT /tasks/{name}/resume`.
+func (m *TaskManager) RegisterHTTPHandlers(mux *http.ServeMux) {
+	m.mu.Lock()
+	m.tasks[DefaultTaskName].srv.RegisterHTTPHandlers(mux)
+	m.mu.Unlock()
+
+	mux.HandleFunc("/tasks", m.handleTasks)
+	mux.HandleFunc("/tasks/", m.handleTask)
+}
+
+func (m *TaskManager) handleTasks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		util.WriteJSON(w, http.StatusOK, util.SuccessResponse("get tasks success", m.Tasks()))
+	case http.MethodPost:
+		var cfg TaskConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			util.WriteJSON(w, http.StatusBadRequest, util.ErrResponsef("invalid task config: %v", err))
+			return
+		}
+		if err := m.CreateTask(cfg); err != nil {
+			code := http.StatusBadRequest
+			if errors.IsAlreadyExists(err) {
+				code = http.StatusConflict
+			}
+			util.WriteJSON(w, code, util.ErrResponsef("create task failed: %v", err))
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, util.SuccessResponse("create task success", nil))
+	default:
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", r.Method))
+	}
+}
+
+func (m *TaskManager) handleTask(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/")
+	name := parts[0]
+	var action string
+	if len(parts) > 1 {
+		action = strings.Join(parts[1:], "/")
+	}
+
+	var (
+		data   interface{}
+		err    error
+		method = http.MethodGet
+	)
+	switch action {
+	case "":
+		if r.Method == http.MethodDelete {
+			method = http.MethodDelete
+			err = m.RemoveTask(name)
+		} else {
+			data, err = m.TaskStatus(name)
+		}
+	case "table-status":
+		data, err = m.TaskTableStatus(name)
+	case "pause":
+		method = http.MethodPut
+		if r.Method == method {
+			err = m.PauseTask(name)
+		}
+	case "resume":
+		method = http.MethodPut
+		if r.Method == method {
+			err = m.ResumeTask(name)
+		}
+	default:
+		util.WriteJSON(w, http.StatusNotFound, util.NotFoundResponsef("path %s", r.URL.Path))
+		return
+	}
+	if r.Method != method {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", r.Method))
+		return
+	}
+
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.IsNotFound(err) {
+			code = http.StatusNotFound
+		}
+		util.WriteJSON(w, code, util.ErrResponsef("%s task %s failed: %v", actionName(r.Method, action), name, err))
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse(actionName(r.Method, action)+" task success", data))
+}
+
+func actionName(method string, action string) string {
+	switch {
+	case method == http.MethodDelete:
+		return "remove"
+	case len(action) == 0:
+		return "get"
+	case action == "table-status":
+		return "get table status of"
+	}
+	return action
+}
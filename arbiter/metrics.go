@@ -18,18 +18,19 @@ import (
 	"os"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 var (
-	checkpointTSOGauge = prometheus.NewGauge(
+	checkpointTSOGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: "binlog",
 			Subsystem: "arbiter",
 			Name:      "checkpoint_tso",
 			Help:      "save checkpoint tso of arbiter.",
-		})
+		}, []string{"task"})
 
 	queryHistogramVec = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -38,7 +39,7 @@ var (
 			Name:      "query_duration_time",
 			Help:      "Bucketed histogram of processing time (s) of a query to sync data to downstream.",
 			Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 18),
-		}, []string{"type"})
+		}, []string{"task", "type"})
 
 	eventCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -46,7 +47,15 @@ var (
 			Subsystem: "arbiter",
 			Name:      "event",
 			Help:      "the count of sql event(dml, ddl).",
-		}, []string{"type"})
+		}, []string{"task", "type"})
+
+	conflictCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "conflict_count",
+			Help:      "the count of deadlock and lock wait timeout errors in downstream.",
+		}, []string{"task", "type"})
 
 	queueSizeGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -54,16 +63,16 @@ var (
 			Subsystem: "arbiter",
 			Name:      "queue_size",
 			Help:      "the size of queue",
-		}, []string{"name"})
+		}, []string{"task", "name"})
 
-	txnLatencySecondsHistogram = prometheus.NewHistogram(
+	txnLatencySecondsHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
 			Subsystem: "arbiter",
 			Name:      "txn_latency_seconds",
 			Help:      "Bucketed histogram of seconds of a txn between loaded to downstream and committed at upstream.",
 			Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 20),
-		})
+		}, []string{"task"})
 )
 
 // Registry is the metrics registry of server
@@ -76,10 +85,28 @@ func init() {
 	Registry.MustRegister(checkpointTSOGauge)
 	Registry.MustRegister(queryHistogramVec)
 	Registry.MustRegister(eventCounter)
+	Registry.MustRegister(conflictCounter)
 	Registry.MustRegister(queueSizeGauge)
 	Registry.MustRegister(txnLatencySecondsHistogram)
 }
 
+// taskMetrics returns the metrics of the loader of the task
+func taskMetrics(task string) *loader.MetricsGroup {
+	labels := prometheus.Labels{"task": task}
+	return &loader.MetricsGroup{
+		EventCounterVec:    eventCounter.MustCurryWith(labels),
+		QueryHistogramVec:  queryHistogramVec.MustCurryWith(labels).(*prometheus.HistogramVec),
+		ConflictCounterVec: conflictCounter.MustCurryWith(labels),
+	}
+}
+
+// deleteTaskMetrics deletes the gauges of the removed task, which would be stale otherwise
+func deleteTaskMetrics(task string) {
+	checkpointTSOGauge.DeleteLabelValues(task)
+	queueSizeGauge.DeleteLabelValues(task, "kafka_reader")
+	queueSizeGauge.DeleteLabelValues(task, "loader_input")
+}
+
 var getHostname = os.Hostname
 
 func instanceName(port int) string {
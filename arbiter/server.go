@@ -20,11 +20,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -40,10 +42,13 @@ var (
 	newLoader = loader.NewLoader
 )
 
-// Server is the server to load data to mysql
+// Server is the server to load data to mysql, it runs a replication task
 type Server struct {
 	cfg  *Config
 	port int
+	// the name of the task, it labels the metrics and the logs
+	task   string
+	logger *zap.Logger
 
 	load loader.Loader
 
@@ -56,14 +61,25 @@ type Server struct {
 
 	metrics *util.MetricClient
 
+	// pause feeding binlogs to loader
+	pauser util.Pauser
+	// count of errors encountered, like failing to save checkpoint
+	errorCount int64
+
 	closed bool
 	mu     sync.Mutex
 }
 
-// NewServer creates a Server
+// NewServer creates a Server running the default task
 func NewServer(cfg *Config) (srv *Server, err error) {
+	return newServer(cfg, DefaultTaskName)
+}
+
+func newServer(cfg *Config, task string) (srv *Server, err error) {
 	srv = new(Server)
 	srv.cfg = cfg
+	srv.task = task
+	srv.logger = log.L().With(zap.String("task", task))
 
 	_, port, err := net.SplitHostPort(cfg.ListenAddr)
 	if err != nil {
@@ -78,7 +94,11 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 	up := cfg.Up
 	down := cfg.Down
 
-	srv.downDB, err = createDB(down.User, down.Password, down.Host, down.Port)
+	password, err := secret.Password(down.Password, down.PasswordFrom)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	srv.downDB, err = createDB(down.User, password, down.Host, down.Port)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -105,40 +125,44 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 		MessageBufferSize: up.MessageBufferSize,
 	}
 
-	log.Info("use kafka binlog reader", zap.Reflect("cfg", readerCfg))
+	srv.logger.Info("use kafka binlog reader", zap.Reflect("cfg", readerCfg))
 
 	srv.kafkaReader, err = newReader(readerCfg)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	log.Info("new kafka reader success")
+	srv.logger.Info("new kafka reader success")
 
 	// set loader
 	srv.load, err = newLoader(srv.downDB,
 		loader.WorkerCount(cfg.Down.WorkerCount),
 		loader.BatchSize(cfg.Down.BatchSize),
-		loader.Metrics(&loader.MetricsGroup{
-			EventCounterVec:   eventCounter,
-			QueryHistogramVec: queryHistogramVec,
-		}))
+		loader.SlowBatchThreshold(time.Duration(cfg.Down.SlowBatchThreshold)*time.Millisecond),
+		loader.SafeMode(down.SafeMode),
+		loader.Metrics(taskMetrics(task)),
+		loader.Logger(srv.logger),
+		loader.Reconnect(func(string) (*sql.DB, error) {
+			// read the password again, it may have been rotated
+			password, err := secret.Password(down.Password, down.PasswordFrom)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			return createDB(down.User, password, down.Host, down.Port)
+		}, net.JoinHostPort(down.Host, strconv.Itoa(down.Port))))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	if down.SafeMode {
+	// set safe mode in first 5 min if abnormal quit last time
+	if !down.SafeMode && status == StatusRunning {
+		srv.logger.Info("set safe mode to be true")
 		srv.load.SetSafeMode(true)
-	} else {
-		// set safe mode in first 5 min if abnormal quit last time
-		if status == StatusRunning {
-			log.Info("set safe mode to be true")
-			srv.load.SetSafeMode(true)
-			go func() {
-				time.Sleep(initSafeModeDuration)
-				srv.load.SetSafeMode(false)
-				log.Info("set safe mode to be false")
-			}()
-		}
+		go func() {
+			time.Sleep(initSafeModeDuration)
+			srv.load.SetSafeMode(false)
+			srv.logger.Info("set safe mode to be false")
+		}()
 	}
 
 	// set metrics
@@ -162,6 +186,8 @@ func (s *Server) Close() error {
 		return nil
 	}
 
+	// resume to make the binlogs in flight drained
+	s.pauser.Resume()
 	s.kafkaReader.Close()
 
 	s.closed = true
@@ -194,7 +220,7 @@ func (s *Server) Run() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		syncErr = syncBinlogs(syncCtx, s.kafkaReader.Messages(), s.load)
+		syncErr = syncBinlogs(syncCtx, s.task, s.kafkaReader.Messages(), s.load, &s.pauser)
 		if syncErr != nil {
 			s.Close()
 		}
@@ -202,6 +228,7 @@ func (s *Server) Run() error {
 
 	err := s.load.Run()
 	if err != nil {
+		atomic.AddInt64(&s.errorCount, 1)
 		syncCancel()
 		s.Close()
 	}
@@ -225,18 +252,20 @@ func (s *Server) Run() error {
 }
 
 func (s *Server) updateFinishTS(msg *reader.Message) {
-	s.finishTS = msg.Binlog.CommitTs
+	atomic.StoreInt64(&s.finishTS, msg.Binlog.CommitTs)
 
-	ms := time.Now().UnixNano()/1000000 - oracle.ExtractPhysical(uint64(s.finishTS))
-	txnLatencySecondsHistogram.Observe(float64(ms) / 1000.0)
+	ms := time.Now().UnixNano()/1000000 - oracle.ExtractPhysical(uint64(msg.Binlog.CommitTs))
+	txnLatencySecondsHistogram.WithLabelValues(s.task).Observe(float64(ms) / 1000.0)
 }
 
 func (s *Server) saveFinishTS(status int) error {
-	err := s.checkpoint.Save(s.finishTS, status)
+	finishTS := atomic.LoadInt64(&s.finishTS)
+	err := s.checkpoint.Save(finishTS, status)
 	if err != nil {
+		atomic.AddInt64(&s.errorCount, 1)
 		return err
 	}
-	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(s.finishTS))))
+	checkpointTSOGauge.WithLabelValues(s.task).Set(float64(oracle.ExtractPhysical(uint64(finishTS))))
 	return nil
 }
 
@@ -249,15 +278,15 @@ L:
 		select {
 		case txn, ok := <-s.load.Successes():
 			if !ok {
-				log.Info("load successes channel closed")
+				s.getLogger().Info("load successes channel closed")
 				break L
 			}
 			msg := txn.Metadata.(*reader.Message)
-			log.Debug("get success binlog", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
+			s.getLogger().Debug("get success binlog", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
 			s.updateFinishTS(msg)
 		case <-saveTick.C:
 			if err := s.saveFinishTS(StatusRunning); err != nil {
-				log.Error("save finish ts failed", zap.Error(err))
+				s.getLogger().Error("save finish ts failed", zap.Error(err))
 			}
 		case <-ctx.Done():
 			break L
@@ -265,7 +294,7 @@ L:
 	}
 
 	if err := s.saveFinishTS(StatusRunning); err != nil {
-		log.Error("save finish ts failed", zap.Error(err))
+		s.getLogger().Error("save finish ts failed", zap.Error(err))
 	}
 }
 
@@ -275,34 +304,47 @@ func (s *Server) loadStatus() (int, error) {
 		if !errors.IsNotFound(err) {
 			return 0, errors.Trace(err)
 		}
-		log.Info("no checkpoint found")
+		s.getLogger().Info("no checkpoint found")
 		err = nil
 	} else {
-		log.Info("load checkpoint", zap.Int64("ts", ts), zap.Int("status", status))
+		s.getLogger().Info("load checkpoint", zap.Int64("ts", ts), zap.Int("status", status))
 		s.finishTS = ts
 	}
 	return status, errors.Trace(err)
 }
 
-func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.Loader) (err error) {
+func (s *Server) getLogger() *zap.Logger {
+	if s.logger == nil {
+		return log.L()
+	}
+	return s.logger
+}
+
+func syncBinlogs(ctx context.Context, task string, source <-chan *reader.Message, ld loader.Loader, pauser *util.Pauser) (err error) {
+	logger := log.L().With(zap.String("task", task))
 	dest := ld.Input()
 	defer ld.Close()
 	var receivedTs int64
 	for msg := range source {
-		log.Debug("recv msg from kafka reader", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
+		logger.Debug("recv msg from kafka reader", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
 
 		if msg.Binlog.CommitTs <= receivedTs {
-			log.Info("skip repeated binlog", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
+			logger.Info("skip repeated binlog", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
 			continue
 		}
 		receivedTs = msg.Binlog.CommitTs
 
 		txn, err := loader.SlaveBinlogToTxn(msg.Binlog)
 		if err != nil {
-			log.Error("transfer binlog failed, program will stop handling data from loader", zap.Error(err))
+			logger.Error("transfer binlog failed, program will stop handling data from loader", zap.Error(err))
 			return err
 		}
 		txn.Metadata = msg
+
+		if err := pauser.Wait(ctx); err != nil {
+			return nil
+		}
+
 		// avoid block when no process is handling ld.input
 		select {
 		case dest <- txn:
@@ -310,8 +352,8 @@ func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.L
 			return nil
 		}
 
-		queueSizeGauge.WithLabelValues("kafka_reader").Set(float64(len(source)))
-		queueSizeGauge.WithLabelValues("loader_input").Set(float64(len(dest)))
+		queueSizeGauge.WithLabelValues(task, "kafka_reader").Set(float64(len(source)))
+		queueSizeGauge.WithLabelValues(task, "loader_input").Set(float64(len(dest)))
 	}
 	return nil
 }
@@ -16,7 +16,10 @@ package arbiter
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"time"
 
@@ -24,6 +27,7 @@ import (
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
 	pb "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
 )
@@ -40,6 +44,10 @@ func (l *dummyLoader) SetSafeMode(safe bool) {
 	l.safe = safe
 }
 
+func (l *dummyLoader) GetSafeMode() bool {
+	return l.safe
+}
+
 func (l *dummyLoader) Successes() <-chan *loader.Txn {
 	return l.successes
 }
@@ -415,7 +423,7 @@ func (s *syncBinlogsSuite) TestShouldSendBinlogToLoader(c *C) {
 	}()
 	ld := dummyLoader{input: dest}
 
-	err := syncBinlogs(context.Background(), source, &ld)
+	err := syncBinlogs(context.Background(), "test", source, &ld, new(util.Pauser))
 	c.Assert(err, IsNil)
 
 	c.Assert(len(dest), Equals, len(expectMsgs))
@@ -454,7 +462,7 @@ func (s *syncBinlogsSuite) TestShouldQuitWhenSomeErrorOccurs(c *C) {
 	}()
 	errCh := make(chan error)
 	go func() {
-		errCh <- syncBinlogs(ctx, readerMsgs, dummyLoaderImpl)
+		errCh <- syncBinlogs(ctx, "test", readerMsgs, dummyLoaderImpl, new(util.Pauser))
 	}()
 
 	cancel()
@@ -465,3 +473,66 @@ func (s *syncBinlogsSuite) TestShouldQuitWhenSomeErrorOccurs(c *C) {
 		c.Fatal("server doesn't quit in 1s when some error occurs in loader")
 	}
 }
+
+type adminAPISuite struct{}
+
+var _ = Suite(&adminAPISuite{})
+
+func (s *adminAPISuite) TestStatus(c *C) {
+	server := Server{
+		load:     &dummyLoader{safe: true},
+		finishTS: 1024,
+	}
+	mux := http.NewServeMux()
+	server.RegisterHTTPHandlers(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/pause", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(server.pauser.IsPaused(), IsTrue)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var resp struct {
+		Data Status `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+	c.Assert(resp.Data.AppliedTS, Equals, int64(1024))
+	c.Assert(resp.Data.Paused, IsTrue)
+	c.Assert(resp.Data.SafeMode, IsTrue)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/resume", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(server.pauser.IsPaused(), IsFalse)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/pause", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *syncBinlogsSuite) TestShouldWaitWhenPaused(c *C) {
+	source := make(chan *reader.Message, 1)
+	source <- s.createMsg("test42", "users", "alter table users add column gender smallint", 1)
+	close(source)
+	dest := make(chan *loader.Txn, 1)
+	ld := dummyLoader{input: dest}
+
+	pauser := new(util.Pauser)
+	pauser.Pause()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncBinlogs(context.Background(), "test", source, &ld, pauser)
+	}()
+
+	select {
+	case <-dest:
+		c.Fatal("should not send binlog to loader when paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pauser.Resume()
+	c.Assert(<-errCh, IsNil)
+	c.Assert(dest, HasLen, 1)
+}
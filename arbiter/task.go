@@ -0,0 +1,310 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"go.uber.org/zap"
+)
+
+// DefaultTaskName is the name of the task configured by [up] and [down], it can't be removed.
+const DefaultTaskName = "default"
+
+// the states of the tasks
+const (
+	// TaskPending means the task is created but TaskManager is not running yet
+	TaskPending = "pending"
+	TaskRunning = "running"
+	TaskPaused  = "paused"
+	// TaskStopped means the task quit, with the error in TaskStatus.Error if it failed
+	TaskStopped = "stopped"
+)
+
+// taskServer is the pipeline of a task, i.e., Server
+type taskServer interface {
+	Run() error
+	Close() error
+	Pause()
+	Resume()
+	Status() *Status
+	TableStatus() []loader.TableStatus
+	RegisterHTTPHandlers(mux *http.ServeMux)
+}
+
+// newTaskServer creates the pipeline of a task, make it possible to mock
+var newTaskServer = func(cfg *Config, task string) (taskServer, error) {
+	srv, err := newServer(cfg, task)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return srv, nil
+}
+
+// TaskStatus is the status of a replication task.
+type TaskStatus struct {
+	Status
+	State string `json:"state"`
+	// the error the task quit with
+	Error string `json:"error,omitempty"`
+}
+
+type task struct {
+	cfg     TaskConfig
+	srv     taskServer
+	started bool
+	done    chan struct{}
+	// the error the task quit with, it's set before done is closed
+	err error
+}
+
+func (t *task) status(started bool) *TaskStatus {
+	status := &TaskStatus{Status: *t.srv.Status(), State: TaskRunning}
+	status.Task = t.cfg.Name
+	if !started {
+		status.State = TaskPending
+		return status
+	}
+	select {
+	case <-t.done:
+		status.State = TaskStopped
+		if t.err != nil {
+			status.Error = t.err.Error()
+		}
+	default:
+		if status.Paused {
+			status.State = TaskPaused
+		}
+	}
+	return status
+}
+
+// TaskManager runs several replication tasks in one process. Every task is a Server loading the binlogs of its own
+// topic to its own downstream, with its own checkpoint, loader workers, metric labels and logs, so a slow or failed
+// task doesn't block the others. The tasks are configured by [[task]], or created, paused and removed by the admin
+// APIs when running.
+type TaskManager struct {
+	cfg *Config
+
+	mu      sync.Mutex
+	tasks   map[string]*task
+	running bool
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewTaskManager creates a TaskManager with the default task and the tasks in cfg.Tasks.
+func NewTaskManager(cfg *Config) (*TaskManager, error) {
+	m := &TaskManager{
+		cfg:   cfg,
+		tasks: make(map[string]*task),
+	}
+	for _, taskCfg := range cfg.taskConfigs() {
+		srvCfg := cfg
+		if taskCfg.Name != DefaultTaskName {
+			srvCfg = cfg.taskConfig(&taskCfg)
+		}
+		srv, err := newTaskServer(srvCfg, taskCfg.Name)
+		if err != nil {
+			m.Close()
+			return nil, errors.Annotatef(err, "create task %s", taskCfg.Name)
+		}
+		m.tasks[taskCfg.Name] = &task{cfg: taskCfg, srv: srv, done: make(chan struct{})}
+	}
+	return m, nil
+}
+
+// Run runs all tasks until the default task quits, then closes the others and returns the error the default task
+// quit with. The tasks created when running are run immediately.
+func (m *TaskManager) Run() error {
+	m.mu.Lock()
+	m.running = true
+	for _, t := range m.tasks {
+		m.start(t)
+	}
+	defaultTask := m.tasks[DefaultTaskName]
+	m.mu.Unlock()
+
+	<-defaultTask.done
+	m.Close()
+	m.wg.Wait()
+	return errors.Trace(defaultTask.err)
+}
+
+// start runs the task in background, m.mu must be held
+func (m *TaskManager) start(t *task) {
+	t.started = true
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		t.err = t.srv.Run()
+		if t.err != nil {
+			log.Error("task quit", zap.String("task", t.cfg.Name), zap.Error(t.err))
+		} else {
+			log.Info("task quit", zap.String("task", t.cfg.Name))
+		}
+		close(t.done)
+	}()
+}
+
+// Close closes all tasks, Run returns after they quit.
+func (m *TaskManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	for _, t := range m.tasks {
+		t.srv.Close()
+	}
+}
+
+// CreateTask creates the task and runs it if the TaskManager is running.
+// The tasks created are not saved in the config file, they're lost after restarting.
+func (m *TaskManager) CreateTask(cfg TaskConfig) error {
+	cfg.adjust()
+	if cfg.Name == DefaultTaskName {
+		return errors.Errorf("task name %s is reserved for the task configured by [up] and [down]", DefaultTaskName)
+	}
+	if err := cfg.validate(); err != nil {
+		return errors.Trace(err)
+	}
+
+	// creating the task connects to downstream and kafka, the lock is held to make the names and checkpoints unique
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return errors.New("arbiter is closed")
+	}
+	if _, ok := m.tasks[cfg.Name]; ok {
+		return errors.AlreadyExistsf("task %s", cfg.Name)
+	}
+	for _, t := range m.tasks {
+		if err := cfg.conflict(&t.cfg); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	srv, err := newTaskServer(m.cfg.taskConfig(&cfg), cfg.Name)
+	if err != nil {
+		return errors.Annotatef(err, "create task %s", cfg.Name)
+	}
+	t := &task{cfg: cfg, srv: srv, done: make(chan struct{})}
+	m.tasks[cfg.Name] = t
+	if m.running {
+		m.start(t)
+	}
+	log.Info("task created", zap.String("task", cfg.Name), zap.String("topic", cfg.Up.Topic),
+		zap.String("downstream host", cfg.Down.Host), zap.Int("downstream port", cfg.Down.Port))
+	return nil
+}
+
+// RemoveTask closes the task and waits for its checkpoint saved, the default task can't be removed.
+func (m *TaskManager) RemoveTask(name string) error {
+	if name == DefaultTaskName {
+		return errors.Errorf("the default task can't be removed")
+	}
+
+	m.mu.Lock()
+	t, ok := m.tasks[name]
+	if !ok {
+		m.mu.Unlock()
+		return errors.NotFoundf("task %s", name)
+	}
+	delete(m.tasks, name)
+	started := t.started
+	m.mu.Unlock()
+
+	if err := t.srv.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	if started {
+		<-t.done
+	}
+	deleteTaskMetrics(name)
+	log.Info("task removed", zap.String("task", name))
+	return nil
+}
+
+// PauseTask stops loading binlogs of the task to downstream until ResumeTask is called.
+func (m *TaskManager) PauseTask(name string) error {
+	t, err := m.getTask(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.srv.Pause()
+	return nil
+}
+
+// ResumeTask resumes loading binlogs of the task to downstream.
+func (m *TaskManager) ResumeTask(name string) error {
+	t, err := m.getTask(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.srv.Resume()
+	return nil
+}
+
+// TaskStatus returns the status of the task.
+func (m *TaskManager) TaskStatus(name string) (*TaskStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[name]
+	if !ok {
+		return nil, errors.NotFoundf("task %s", name)
+	}
+	return t.status(t.started), nil
+}
+
+// TaskTableStatus returns the status of the tables loaded by the task.
+func (m *TaskManager) TaskTableStatus(name string) ([]loader.TableStatus, error) {
+	t, err := m.getTask(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return t.srv.TableStatus(), nil
+}
+
+// Tasks returns the status of all tasks ordered by name.
+func (m *TaskManager) Tasks() []*TaskStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := make([]*TaskStatus, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		tasks = append(tasks, t.status(t.started))
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Task < tasks[j].Task
+	})
+	return tasks
+}
+
+func (m *TaskManager) getTask(name string) (*task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[name]
+	if !ok {
+		return nil, errors.NotFoundf("task %s", name)
+	}
+	return t, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+)
+
+type dummyTaskServer struct {
+	name   string
+	pauser util.Pauser
+	// Run returns the error sent to quit
+	quit      chan error
+	closeOnce sync.Once
+}
+
+func newDummyTaskServer(name string) *dummyTaskServer {
+	return &dummyTaskServer{name: name, quit: make(chan error, 1)}
+}
+
+func (s *dummyTaskServer) Run() error {
+	return <-s.quit
+}
+
+func (s *dummyTaskServer) Close() error {
+	s.closeOnce.Do(func() {
+		s.quit <- nil
+	})
+	return nil
+}
+
+func (s *dummyTaskServer) Pause()  { s.pauser.Pause() }
+func (s *dummyTaskServer) Resume() { s.pauser.Resume() }
+
+func (s *dummyTaskServer) Status() *Status {
+	return &Status{Task: s.name, Paused: s.pauser.IsPaused()}
+}
+
+func (s *dummyTaskServer) TableStatus() []loader.TableStatus {
+	return []loader.TableStatus{{Table: s.name}}
+}
+
+func (s *dummyTaskServer) RegisterHTTPHandlers(mux *http.ServeMux) {}
+
+type taskManagerSuite struct {
+	origNewTaskServer func(*Config, string) (taskServer, error)
+	servers           map[string]*dummyTaskServer
+	cfgs              map[string]*Config
+	mu                sync.Mutex
+}
+
+var _ = Suite(&taskManagerSuite{})
+
+func (s *taskManagerSuite) SetUpTest(c *C) {
+	s.servers = make(map[string]*dummyTaskServer)
+	s.cfgs = make(map[string]*Config)
+	s.origNewTaskServer = newTaskServer
+	newTaskServer = func(cfg *Config, name string) (taskServer, error) {
+		if cfg.Down.Host == "unreachable" {
+			return nil, errors.New("connect failed")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		srv := newDummyTaskServer(name)
+		s.servers[name] = srv
+		s.cfgs[name] = cfg
+		return srv, nil
+	}
+}
+
+func (s *taskManagerSuite) TearDownTest(c *C) {
+	newTaskServer = s.origNewTaskServer
+}
+
+func (s *taskManagerSuite) newConfig() *Config {
+	cfg := &Config{
+		ListenAddr: "127.0.0.1:8251",
+		Up:         UpConfig{Topic: "t0"},
+		Metrics:    Metrics{Addr: "127.0.0.1:9091", Interval: 15},
+		Tasks: []TaskConfig{
+			{Name: "t1", Up: UpConfig{Topic: "t1"}, Down: DownConfig{Host: "db1"}},
+		},
+	}
+	if err := cfg.adjustConfig(); err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func (s *taskManagerSuite) TestConfigs(c *C) {
+	cfg := s.newConfig()
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.Tasks[0].Down.Port, Equals, 3306)
+	c.Assert(cfg.Tasks[0].Down.WorkerCount, Equals, defaultWorkerCount)
+	c.Assert(cfg.Tasks[0].Up.KafkaAddrs, Equals, defaultKafkaAddrs)
+
+	cfg.Tasks = append(cfg.Tasks, TaskConfig{Name: "t1", Up: UpConfig{Topic: "t2"}})
+	c.Assert(cfg.validate(), ErrorMatches, "duplicate task name t1")
+
+	cfg.Tasks[1] = TaskConfig{Name: "t2", Up: UpConfig{Topic: "t1"}, Down: DownConfig{Host: "db1", Port: 3306}}
+	c.Assert(cfg.validate(), ErrorMatches, "task t2 and t1 both load topic t1 to db1:3306.*")
+
+	cfg.Tasks[1] = TaskConfig{Name: DefaultTaskName, Up: UpConfig{Topic: "t2"}}
+	c.Assert(cfg.validate(), ErrorMatches, "task name default is reserved.*")
+
+	cfg.Tasks[1] = TaskConfig{Name: "t2"}
+	c.Assert(cfg.validate(), ErrorMatches, "task t2: up.topic not config.*")
+}
+
+func (s *taskManagerSuite) TestRunTasks(c *C) {
+	m, err := NewTaskManager(s.newConfig())
+	c.Assert(err, IsNil)
+	c.Assert(s.servers, HasLen, 2)
+	// the metrics are pushed by the default task only
+	c.Assert(s.cfgs[DefaultTaskName].Metrics.Addr, Equals, "127.0.0.1:9091")
+	c.Assert(s.cfgs["t1"].Metrics.Addr, Equals, "")
+	c.Assert(s.cfgs["t1"].Down.Host, Equals, "db1")
+
+	status, err := m.TaskStatus("t1")
+	c.Assert(err, IsNil)
+	c.Assert(status.State, Equals, TaskPending)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.Run()
+	}()
+
+	for status.State != TaskRunning {
+		status, err = m.TaskStatus(DefaultTaskName)
+		c.Assert(err, IsNil)
+	}
+
+	// the task created when running is run immediately
+	c.Assert(m.CreateTask(TaskConfig{Name: "t2", Up: UpConfig{Topic: "t2"}}), IsNil)
+	c.Assert(s.cfgs["t2"].Down.WorkerCount, Equals, defaultWorkerCount)
+	c.Assert(m.CreateTask(TaskConfig{Name: "t2", Up: UpConfig{Topic: "t3"}}), ErrorMatches, "task t2 already exists")
+	c.Assert(m.CreateTask(TaskConfig{Name: "t3", Up: UpConfig{Topic: "t0"}}), ErrorMatches, ".*share the checkpoint")
+	c.Assert(m.CreateTask(TaskConfig{Name: "t3", Up: UpConfig{Topic: "t3"}, Down: DownConfig{Host: "unreachable"}}),
+		ErrorMatches, "create task t3: connect failed")
+
+	c.Assert(m.PauseTask("t2"), IsNil)
+	status, err = m.TaskStatus("t2")
+	c.Assert(err, IsNil)
+	c.Assert(status.State, Equals, TaskPaused)
+	c.Assert(m.ResumeTask("t2"), IsNil)
+	status, err = m.TaskStatus("t2")
+	c.Assert(err, IsNil)
+	c.Assert(status.State, Equals, TaskRunning)
+
+	// the failed task is kept with its error until removed
+	s.servers["t1"].quit <- errors.New("downstream gone")
+	for status.State != TaskStopped {
+		status, err = m.TaskStatus("t1")
+		c.Assert(err, IsNil)
+	}
+	c.Assert(status.Error, Equals, "downstream gone")
+	c.Assert(m.Tasks(), HasLen, 3)
+	c.Assert(m.RemoveTask("t1"), IsNil)
+	c.Assert(m.RemoveTask("t1"), ErrorMatches, "task t1 not found")
+	c.Assert(m.RemoveTask(DefaultTaskName), ErrorMatches, ".*can't be removed")
+
+	tasks := m.Tasks()
+	c.Assert(tasks, HasLen, 2)
+	c.Assert(tasks[0].Task, Equals, DefaultTaskName)
+	c.Assert(tasks[1].Task, Equals, "t2")
+
+	// the others are closed when the default task quits
+	s.servers[DefaultTaskName].quit <- errors.New("kafka gone")
+	c.Assert(<-errCh, ErrorMatches, "kafka gone")
+	status, err = m.TaskStatus("t2")
+	c.Assert(err, IsNil)
+	c.Assert(status.State, Equals, TaskStopped)
+	c.Assert(m.CreateTask(TaskConfig{Name: "t4", Up: UpConfig{Topic: "t4"}}), ErrorMatches, "arbiter is closed")
+}
+
+func (s *taskManagerSuite) TestAdminAPI(c *C) {
+	m, err := NewTaskManager(s.newConfig())
+	c.Assert(err, IsNil)
+	mux := http.NewServeMux()
+	m.RegisterHTTPHandlers(mux)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := serve("POST", "/tasks", `{"name": "t2", "up": {"topic": "t2"}, "down": {"host": "db2", "port": 4000}}`)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(s.cfgs["t2"].Down.Port, Equals, 4000)
+	c.Assert(serve("POST", "/tasks", `{"name": "t2", "up": {"topic": "t3"}}`).Code, Equals, http.StatusConflict)
+	c.Assert(serve("POST", "/tasks", `{"name": "t3"}`).Code, Equals, http.StatusBadRequest)
+	c.Assert(serve("POST", "/tasks", `{`).Code, Equals, http.StatusBadRequest)
+
+	c.Assert(serve("PUT", "/tasks/t2/pause", "").Code, Equals, http.StatusOK)
+	c.Assert(serve("GET", "/tasks/t2/pause", "").Code, Equals, http.StatusMethodNotAllowed)
+	c.Assert(serve("PUT", "/tasks/t4/pause", "").Code, Equals, http.StatusNotFound)
+
+	w = serve("GET", "/tasks", "")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var tasks struct {
+		Data []TaskStatus `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &tasks), IsNil)
+	c.Assert(tasks.Data, HasLen, 3)
+	c.Assert(tasks.Data[2].Task, Equals, "t2")
+	c.Assert(tasks.Data[2].Paused, IsTrue)
+
+	c.Assert(serve("PUT", "/tasks/t2/resume", "").Code, Equals, http.StatusOK)
+	w = serve("GET", "/tasks/t2", "")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var task struct {
+		Data TaskStatus `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &task), IsNil)
+	c.Assert(task.Data.Paused, IsFalse)
+	c.Assert(task.Data.State, Equals, TaskPending)
+
+	w = serve("GET", "/tasks/t2/table-status", "")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `(?s).*"table":"t2".*`)
+	c.Assert(serve("GET", "/tasks/t2/unknown", "").Code, Equals, http.StatusNotFound)
+
+	c.Assert(serve("DELETE", "/tasks/t2", "").Code, Equals, http.StatusOK)
+	c.Assert(serve("GET", "/tasks/t2", "").Code, Equals, http.StatusNotFound)
+	c.Assert(serve("DELETE", "/tasks/default", "").Code, Equals, http.StatusBadRequest)
+}
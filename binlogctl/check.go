@@ -0,0 +1,483 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// CheckResult is the result of a pre-flight check
+type CheckResult string
+
+// the results of the pre-flight checks, a replication task shouldn't start if any check fails
+const (
+	CheckPass CheckResult = "pass"
+	CheckWarn CheckResult = "warn"
+	CheckFail CheckResult = "fail"
+)
+
+// CheckItem is the report of a pre-flight check
+type CheckItem struct {
+	Name   string
+	Result CheckResult
+	Detail string
+}
+
+var (
+	systemSchemas = []string{"INFORMATION_SCHEMA", "PERFORMANCE_SCHEMA", "METRICS_SCHEMA", "mysql", "sys"}
+
+	// the privileges drainer needs to apply the DMLs and DDLs in downstream
+	requiredPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "ALTER", "INDEX"}
+
+	// the data types supported by mysql 5.7
+	mysqlDataTypes = map[string]struct{}{
+		"tinyint": {}, "smallint": {}, "mediumint": {}, "int": {}, "bigint": {}, "decimal": {}, "float": {}, "double": {},
+		"bit": {}, "date": {}, "datetime": {}, "timestamp": {}, "time": {}, "year": {}, "char": {}, "varchar": {},
+		"binary": {}, "varbinary": {}, "tinyblob": {}, "blob": {}, "mediumblob": {}, "longblob": {}, "tinytext": {},
+		"text": {}, "mediumtext": {}, "longtext": {}, "enum": {}, "set": {}, "json": {},
+		"geometry": {}, "point": {}, "linestring": {}, "polygon": {},
+	}
+
+	versionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)`)
+	grantRegexp   = regexp.MustCompile(`(?i)^GRANT\s+(.+?)\s+ON\s+`)
+)
+
+// CheckCompatibility connects the upstream TiDB and the downstream mysql or TiDB, checks whether the replication
+// task can run, and prints a pass/fail report, it returns an error if any check fails.
+func CheckCompatibility(cfg *Config) error {
+	up, err := pkgsql.OpenDB("mysql", cfg.UpstreamDB.Host, cfg.UpstreamDB.Port, cfg.UpstreamDB.User, cfg.UpstreamDB.Password)
+	if err != nil {
+		return errors.Annotate(err, "connect upstream")
+	}
+	defer up.Close()
+
+	down, err := pkgsql.OpenDB("mysql", cfg.DownstreamDB.Host, cfg.DownstreamDB.Port, cfg.DownstreamDB.User, cfg.DownstreamDB.Password)
+	if err != nil {
+		return errors.Annotate(err, "connect downstream")
+	}
+	defer down.Close()
+
+	var schemas []string
+	if len(cfg.CheckSchemas) > 0 {
+		schemas = strings.Split(cfg.CheckSchemas, ",")
+	}
+	items := newChecker(up, down, schemas).run()
+
+	var failed []string
+	for _, item := range items {
+		fields := []zap.Field{zap.String("check", item.Name), zap.String("result", string(item.Result)), zap.String("detail", item.Detail)}
+		switch item.Result {
+		case CheckPass:
+			log.Info("pre-flight check", fields...)
+		case CheckWarn:
+			log.Warn("pre-flight check", fields...)
+		default:
+			log.Error("pre-flight check", fields...)
+			failed = append(failed, item.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("%d of %d checks failed: %s", len(failed), len(items), strings.Join(failed, ", "))
+	}
+	log.Info("all pre-flight checks passed", zap.Int("checks", len(items)))
+	return nil
+}
+
+type checker struct {
+	up   *sql.DB
+	down *sql.DB
+	// the schemas replicated, empty means all but the system schemas
+	schemas []string
+
+	downIsTiDB  bool
+	downVersion [2]int
+}
+
+func newChecker(up *sql.DB, down *sql.DB, schemas []string) *checker {
+	return &checker{up: up, down: down, schemas: schemas}
+}
+
+func (c *checker) run() []CheckItem {
+	checks := []func() CheckItem{
+		c.checkVersion,
+		c.checkSQLMode,
+		c.checkCharsets,
+		c.checkTableSchemas,
+		c.checkKeys,
+		c.checkColumnTypes,
+		c.checkPrivileges,
+	}
+
+	items := make([]CheckItem, 0, len(checks))
+	for _, check := range checks {
+		items = append(items, check())
+	}
+	return items
+}
+
+func (c *checker) checkVersion() CheckItem {
+	item := CheckItem{Name: "version"}
+
+	var upVersion, downVersion string
+	if err := c.up.QueryRow("SELECT VERSION()").Scan(&upVersion); err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream version"))
+	}
+	if err := c.down.QueryRow("SELECT VERSION()").Scan(&downVersion); err != nil {
+		return failItem(item, errors.Annotate(err, "query downstream version"))
+	}
+	item.Detail = fmt.Sprintf("upstream: %s, downstream: %s", upVersion, downVersion)
+
+	if !strings.Contains(upVersion, "TiDB") {
+		item.Result = CheckFail
+		item.Detail += ", the upstream is not TiDB"
+		return item
+	}
+
+	c.downIsTiDB = strings.Contains(downVersion, "TiDB")
+	if matches := versionRegexp.FindStringSubmatch(downVersion); matches != nil {
+		c.downVersion[0], _ = strconv.Atoi(matches[1])
+		c.downVersion[1], _ = strconv.Atoi(matches[2])
+	}
+
+	switch {
+	case c.downIsTiDB || c.downVersionAtLeast(5, 7):
+		item.Result = CheckPass
+	case c.downVersionAtLeast(5, 6):
+		item.Result = CheckWarn
+		item.Detail += ", mysql 5.7 or later is recommended"
+	default:
+		item.Result = CheckFail
+		item.Detail += ", mysql 5.6 or later is required"
+	}
+	return item
+}
+
+func (c *checker) downVersionAtLeast(major int, minor int) bool {
+	return c.downVersion[0] > major || (c.downVersion[0] == major && c.downVersion[1] >= minor)
+}
+
+func (c *checker) checkSQLMode() CheckItem {
+	item := CheckItem{Name: "sql_mode"}
+
+	var upMode, downMode string
+	if err := c.up.QueryRow("SELECT @@GLOBAL.sql_mode").Scan(&upMode); err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream sql_mode"))
+	}
+	if err := c.down.QueryRow("SELECT @@GLOBAL.sql_mode").Scan(&downMode); err != nil {
+		return failItem(item, errors.Annotate(err, "query downstream sql_mode"))
+	}
+
+	if upMode == downMode {
+		item.Result = CheckPass
+		item.Detail = upMode
+		return item
+	}
+	item.Result = CheckWarn
+	item.Detail = fmt.Sprintf("upstream: %s, downstream: %s, set `sql-mode` of drainer to the upstream one", upMode, downMode)
+	return item
+}
+
+func (c *checker) checkCharsets() CheckItem {
+	item := CheckItem{Name: "charsets"}
+
+	cond, args := c.schemaCondition()
+	used, err := queryStrings(c.up, "SELECT DISTINCT COLLATION_NAME FROM information_schema.COLUMNS WHERE COLLATION_NAME IS NOT NULL AND "+cond, args...)
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream collations"))
+	}
+	supported, err := queryStrings(c.down, "SELECT COLLATION_NAME FROM information_schema.COLLATIONS")
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query downstream collations"))
+	}
+
+	missing := difference(used, supported)
+	if len(missing) > 0 {
+		item.Result = CheckFail
+		item.Detail = "collations not supported by downstream: " + strings.Join(missing, ", ")
+		return item
+	}
+	item.Result = CheckPass
+	item.Detail = "collations used: " + strings.Join(used, ", ")
+	return item
+}
+
+type column struct {
+	name     string
+	dataType string
+	tp       string
+}
+
+// columns returns the columns of the tables in the schemas checked, keyed by `schema`.`table`
+func (c *checker) columns(db *sql.DB) (map[string][]column, error) {
+	cond, args := c.schemaCondition()
+	rows, err := db.Query("SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.COLUMN_TYPE FROM information_schema.COLUMNS c "+
+		"JOIN information_schema.TABLES t ON c.TABLE_SCHEMA = t.TABLE_SCHEMA AND c.TABLE_NAME = t.TABLE_NAME "+
+		"WHERE t.TABLE_TYPE = 'BASE TABLE' AND c."+cond+" ORDER BY c.TABLE_SCHEMA, c.TABLE_NAME, c.ORDINAL_POSITION", args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string][]column)
+	for rows.Next() {
+		var schema, table string
+		var col column
+		if err := rows.Scan(&schema, &table, &col.name, &col.dataType, &col.tp); err != nil {
+			return nil, errors.Trace(err)
+		}
+		name := pkgsql.QuoteSchema(schema, table)
+		tables[name] = append(tables[name], col)
+	}
+	return tables, errors.Trace(rows.Err())
+}
+
+func (c *checker) checkTableSchemas() CheckItem {
+	item := CheckItem{Name: "table schemas"}
+
+	upTables, err := c.columns(c.up)
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream columns"))
+	}
+	downTables, err := c.columns(c.down)
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query downstream columns"))
+	}
+
+	var missingTables, missingColumns, typeChanged []string
+	for _, name := range sortedKeys(upTables) {
+		downColumns, ok := downTables[name]
+		if !ok {
+			missingTables = append(missingTables, name)
+			continue
+		}
+
+		types := make(map[string]string, len(downColumns))
+		for _, col := range downColumns {
+			types[strings.ToLower(col.name)] = col.tp
+		}
+		for _, col := range upTables[name] {
+			tp, ok := types[strings.ToLower(col.name)]
+			if !ok {
+				missingColumns = append(missingColumns, name+"."+pkgsql.QuoteName(col.name))
+			} else if !strings.EqualFold(tp, col.tp) {
+				typeChanged = append(typeChanged, fmt.Sprintf("%s.%s(%s vs %s)", name, pkgsql.QuoteName(col.name), col.tp, tp))
+			}
+		}
+	}
+
+	var details []string
+	item.Result = CheckPass
+	if len(missingColumns) > 0 {
+		item.Result = CheckFail
+		details = append(details, "columns missing in downstream: "+strings.Join(missingColumns, ", "))
+	}
+	if len(missingTables) > 0 {
+		if item.Result == CheckPass {
+			item.Result = CheckWarn
+		}
+		details = append(details, "tables missing in downstream, they must be created by the replicated DDLs or `auto-create-table`: "+
+			strings.Join(missingTables, ", "))
+	}
+	if len(typeChanged) > 0 {
+		if item.Result == CheckPass {
+			item.Result = CheckWarn
+		}
+		details = append(details, "column types different in downstream: "+strings.Join(typeChanged, ", "))
+	}
+	if len(details) == 0 {
+		details = append(details, fmt.Sprintf("%d tables checked", len(upTables)))
+	}
+	item.Detail = strings.Join(details, "; ")
+	return item
+}
+
+func (c *checker) checkKeys() CheckItem {
+	item := CheckItem{Name: "primary/unique keys"}
+
+	cond, args := c.schemaCondition()
+	tables, err := queryStrings(c.up, "SELECT CONCAT('`', TABLE_SCHEMA, '`.`', TABLE_NAME, '`') FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND "+cond, args...)
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream tables"))
+	}
+	keyed, err := queryStrings(c.up, "SELECT DISTINCT CONCAT('`', TABLE_SCHEMA, '`.`', TABLE_NAME, '`') FROM information_schema.TABLE_CONSTRAINTS "+
+		"WHERE CONSTRAINT_TYPE IN ('PRIMARY KEY', 'UNIQUE') AND "+cond, args...)
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream keys"))
+	}
+
+	if missing := difference(tables, keyed); len(missing) > 0 {
+		item.Result = CheckWarn
+		item.Detail = "tables without primary key or unique key, their updates and deletes are slow and may affect duplicated rows: " +
+			strings.Join(missing, ", ")
+		return item
+	}
+	item.Result = CheckPass
+	item.Detail = fmt.Sprintf("%d tables checked", len(tables))
+	return item
+}
+
+func (c *checker) checkColumnTypes() CheckItem {
+	item := CheckItem{Name: "column types"}
+	if c.downIsTiDB {
+		item.Result = CheckPass
+		item.Detail = "downstream is TiDB"
+		return item
+	}
+
+	upTables, err := c.columns(c.up)
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query upstream columns"))
+	}
+
+	var unsupported []string
+	for _, name := range sortedKeys(upTables) {
+		for _, col := range upTables[name] {
+			tp := strings.ToLower(col.dataType)
+			_, ok := mysqlDataTypes[tp]
+			if !ok || (tp == "json" && !c.downVersionAtLeast(5, 7)) {
+				unsupported = append(unsupported, fmt.Sprintf("%s.%s(%s)", name, pkgsql.QuoteName(col.name), col.tp))
+			}
+		}
+	}
+
+	if len(unsupported) > 0 {
+		item.Result = CheckFail
+		item.Detail = "column types not supported by downstream: " + strings.Join(unsupported, ", ")
+		return item
+	}
+	item.Result = CheckPass
+	return item
+}
+
+func (c *checker) checkPrivileges() CheckItem {
+	item := CheckItem{Name: "privileges"}
+
+	grants, err := queryStrings(c.down, "SHOW GRANTS")
+	if err != nil {
+		return failItem(item, errors.Annotate(err, "query downstream grants"))
+	}
+
+	granted := make(map[string]struct{})
+	for _, grant := range grants {
+		matches := grantRegexp.FindStringSubmatch(grant)
+		if matches == nil {
+			continue
+		}
+		for _, privilege := range strings.Split(matches[1], ",") {
+			granted[strings.ToUpper(strings.TrimSpace(privilege))] = struct{}{}
+		}
+	}
+
+	if _, ok := granted["ALL PRIVILEGES"]; !ok {
+		var missing []string
+		for _, privilege := range requiredPrivileges {
+			if _, ok := granted[privilege]; !ok {
+				missing = append(missing, privilege)
+			}
+		}
+		if len(missing) > 0 {
+			item.Result = CheckFail
+			item.Detail = "privileges missing in downstream: " + strings.Join(missing, ", ")
+			return item
+		}
+	}
+	item.Result = CheckPass
+	return item
+}
+
+// schemaCondition returns the condition of TABLE_SCHEMA of the schemas checked
+func (c *checker) schemaCondition() (string, []interface{}) {
+	schemas, op := c.schemas, "IN"
+	if len(schemas) == 0 {
+		schemas, op = systemSchemas, "NOT IN"
+	}
+
+	args := make([]interface{}, 0, len(schemas))
+	for _, schema := range schemas {
+		args = append(args, schema)
+	}
+	return fmt.Sprintf("TABLE_SCHEMA %s (%s)", op, strings.TrimSuffix(strings.Repeat("?,", len(schemas)), ",")), args
+}
+
+func failItem(item CheckItem, err error) CheckItem {
+	item.Result = CheckFail
+	item.Detail = err.Error()
+	return item
+}
+
+// queryStrings returns the first column of the rows
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var values []string
+	dest := make([]interface{}, len(cols))
+	for rows.Next() {
+		var value sql.NullString
+		dest[0] = &value
+		for i := 1; i < len(cols); i++ {
+			dest[i] = new(sql.RawBytes)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		values = append(values, value.String)
+	}
+	return values, errors.Trace(rows.Err())
+}
+
+// difference returns the sorted values of a not in b, case insensitively
+func difference(a []string, b []string) []string {
+	set := make(map[string]struct{}, len(b))
+	for _, v := range b {
+		set[strings.ToLower(v)] = struct{}{}
+	}
+
+	var diff []string
+	for _, v := range a {
+		if _, ok := set[strings.ToLower(v)]; !ok {
+			diff = append(diff, v)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func sortedKeys(tables map[string][]column) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
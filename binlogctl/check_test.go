@@ -0,0 +1,109 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type checkSuite struct{}
+
+var _ = Suite(&checkSuite{})
+
+func (s *checkSuite) newChecker(c *C, schemas []string) (*checker, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	up, upMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	down, downMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	return newChecker(up, down, schemas), upMock, downMock
+}
+
+func (s *checkSuite) TestCheckVersion(c *C) {
+	tests := []struct {
+		up     string
+		down   string
+		result CheckResult
+	}{
+		{"5.7.25-TiDB-v3.0.5", "5.7.25-TiDB-v3.0.5", CheckPass},
+		{"5.7.25-TiDB-v3.0.5", "8.0.18", CheckPass},
+		{"5.7.25-TiDB-v3.0.5", "5.6.40-log", CheckWarn},
+		{"5.7.25-TiDB-v3.0.5", "5.5.62", CheckFail},
+		{"5.7.28", "5.7.28", CheckFail},
+	}
+
+	for _, test := range tests {
+		checker, upMock, downMock := s.newChecker(c, nil)
+		upMock.ExpectQuery("SELECT VERSION").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(test.up))
+		downMock.ExpectQuery("SELECT VERSION").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(test.down))
+
+		item := checker.checkVersion()
+		c.Assert(item.Result, Equals, test.result, Commentf("%s -> %s: %s", test.up, test.down, item.Detail))
+	}
+}
+
+func (s *checkSuite) TestCheckTableSchemas(c *C) {
+	checker, upMock, downMock := s.newChecker(c, []string{"test"})
+	columns := []string{"TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}
+	query := regexp.QuoteMeta("WHERE t.TABLE_TYPE = 'BASE TABLE' AND c.TABLE_SCHEMA IN (?)")
+
+	upMock.ExpectQuery(query).WithArgs("test").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow("test", "t1", "id", "int", "int(11)").AddRow("test", "t1", "v", "varchar", "varchar(10)").
+		AddRow("test", "t2", "id", "int", "int(11)").
+		AddRow("test", "t3", "id", "int", "int(11)"))
+	downMock.ExpectQuery(query).WithArgs("test").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow("test", "t1", "id", "bigint", "bigint(20)").
+		AddRow("test", "t2", "ID", "int", "INT(11)"))
+
+	item := checker.checkTableSchemas()
+	c.Assert(item.Result, Equals, CheckFail)
+	c.Assert(item.Detail, Equals, "columns missing in downstream: `test`.`t1`.`v`; "+
+		"tables missing in downstream, they must be created by the replicated DDLs or `auto-create-table`: `test`.`t3`; "+
+		"column types different in downstream: `test`.`t1`.`id`(int(11) vs bigint(20))")
+}
+
+func (s *checkSuite) TestCheckPrivileges(c *C) {
+	tests := []struct {
+		grants []string
+		result CheckResult
+	}{
+		{[]string{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%' WITH GRANT OPTION"}, CheckPass},
+		{[]string{"GRANT USAGE ON *.* TO 'u'@'%'", "GRANT SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, ALTER, INDEX ON `test`.* TO 'u'@'%'"}, CheckPass},
+		{[]string{"GRANT SELECT, INSERT, UPDATE, DELETE ON `test`.* TO 'u'@'%'"}, CheckFail},
+	}
+
+	for _, test := range tests {
+		checker, _, downMock := s.newChecker(c, nil)
+		rows := sqlmock.NewRows([]string{"Grants"})
+		for _, grant := range test.grants {
+			rows.AddRow(grant)
+		}
+		downMock.ExpectQuery("SHOW GRANTS").WillReturnRows(rows)
+
+		item := checker.checkPrivileges()
+		c.Assert(item.Result, Equals, test.result, Commentf("%v: %s", test.grants, item.Detail))
+	}
+}
+
+func (s *checkSuite) TestSchemaCondition(c *C) {
+	cond, args := (&checker{}).schemaCondition()
+	c.Assert(cond, Equals, "TABLE_SCHEMA NOT IN (?,?,?,?,?)")
+	c.Assert(args, HasLen, len(systemSchemas))
+
+	cond, args = (&checker{schemas: []string{"a", "b"}}).schemaCondition()
+	c.Assert(cond, Equals, "TABLE_SCHEMA IN (?,?)")
+	c.Assert(args, DeepEquals, []interface{}{"a", "b"})
+}
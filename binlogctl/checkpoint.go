@@ -0,0 +1,122 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"path"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+var newCheckPointFunc = checkpoint.NewCheckPoint
+
+// ShowDrainerCheckpoint prints the checkpoint of drainer saved in the configured storage.
+func ShowDrainerCheckpoint(cfg *Config) error {
+	cp, err := openCheckPoint(cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer cp.Close()
+
+	ts := cp.TS()
+	log.Info("show checkpoint", zap.String("type", cfg.CheckpointType), zap.Int64("commitTS", ts), zap.Time("time", util.TSOToRoughTime(ts)))
+	return nil
+}
+
+// OverrideDrainerCheckpoint replaces the checkpoint of drainer with cfg.CheckpointTS,
+// the drainer should be stopped, otherwise it may overwrite the checkpoint again.
+func OverrideDrainerCheckpoint(cfg *Config) error {
+	if cfg.CheckpointTS <= 0 {
+		return errors.Errorf("invalid checkpoint-ts %d", cfg.CheckpointTS)
+	}
+
+	cp, err := openCheckPoint(cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer cp.Close()
+
+	oldTS := cp.TS()
+	if err := cp.Save(cfg.CheckpointTS, 0); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("override checkpoint", zap.String("type", cfg.CheckpointType), zap.Int64("old commitTS", oldTS), zap.Int64("new commitTS", cfg.CheckpointTS))
+	return nil
+}
+
+func openCheckPoint(cfg *Config) (checkpoint.CheckPoint, error) {
+	cpCfg := &checkpoint.Config{
+		CheckpointType: cfg.CheckpointType,
+		CheckPointFile: path.Join(cfg.DataDir, "savepoint"),
+	}
+
+	switch cfg.CheckpointType {
+	case "file":
+	case "mysql", "tidb":
+		cpCfg.Db = &checkpoint.DBConfig{
+			Host:     cfg.CheckpointDB.Host,
+			User:     cfg.CheckpointDB.User,
+			Password: cfg.CheckpointDB.Password,
+			Port:     cfg.CheckpointDB.Port,
+		}
+		cpCfg.Schema = cfg.CheckpointSchema
+	case "etcd", "pd":
+		endpoints, err := flags.ParseHostPortAddr(cfg.EtcdURLs)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cpCfg.EtcdURLs = endpoints
+		cpCfg.TLS = cfg.tls
+		cpCfg.NodeID = cfg.NodeID
+	default:
+		return nil, errors.Errorf("unknown checkpoint type %s", cfg.CheckpointType)
+	}
+
+	if cfg.CheckpointType != "file" {
+		clusterID, err := getClusterID(cfg)
+		if err != nil {
+			return nil, errors.Annotate(err, "get cluster id failed")
+		}
+		cpCfg.ClusterID = clusterID
+	}
+
+	return newCheckPointFunc(cpCfg)
+}
+
+func getClusterID(cfg *Config) (uint64, error) {
+	ectdEndpoints, err := flags.ParseHostPortAddr(cfg.EtcdURLs)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	pdCli, err := newPDClientFunc(ectdEndpoints, pd.SecurityOption{
+		CAPath:   cfg.SSLCA,
+		CertPath: cfg.SSLCert,
+		KeyPath:  cfg.SSLKey,
+	})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer pdCli.Close()
+
+	return pdCli.GetClusterID(context.Background()), nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	. "github.com/pingcap/check"
+	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+)
+
+type checkpointSuite struct{}
+
+var _ = Suite(&checkpointSuite{})
+
+func (s *checkpointSuite) TestOverrideFileCheckpoint(c *C) {
+	cfg := &Config{
+		DataDir:        c.MkDir(),
+		CheckpointType: "file",
+	}
+
+	err := OverrideDrainerCheckpoint(cfg)
+	c.Assert(err, ErrorMatches, "invalid checkpoint-ts 0")
+
+	cfg.CheckpointTS = 1024
+	err = OverrideDrainerCheckpoint(cfg)
+	c.Assert(err, IsNil)
+
+	err = ShowDrainerCheckpoint(cfg)
+	c.Assert(err, IsNil)
+
+	cp, err := openCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(1024))
+	c.Assert(cp.Close(), IsNil)
+}
+
+func (s *checkpointSuite) TestOpenCheckpointWithClusterID(c *C) {
+	newPDClientFunc = newFakePDClient
+	var gotCfg *checkpoint.Config
+	newCheckPointFunc = func(cfg *checkpoint.Config) (checkpoint.CheckPoint, error) {
+		gotCfg = cfg
+		return nil, nil
+	}
+	defer func() {
+		newPDClientFunc = pd.NewClient
+		newCheckPointFunc = checkpoint.NewCheckPoint
+	}()
+
+	cfg := &Config{
+		EtcdURLs:       "127.0.0.1:2379",
+		CheckpointType: "etcd",
+	}
+	_, err := openCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(gotCfg.ClusterID, Equals, uint64(7))
+	c.Assert(gotCfg.EtcdURLs, DeepEquals, []string{"127.0.0.1:2379"})
+
+	cfg.CheckpointType = "unknown"
+	_, err = openCheckPoint(cfg)
+	c.Assert(err, ErrorMatches, "unknown checkpoint type unknown")
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
@@ -58,6 +59,18 @@ const (
 
 	// OfflineDrainer is comamnd used for offlien drainer.
 	OfflineDrainer = "offline-drainer"
+
+	// ShowCheckpoint is command used for show drainer's checkpoint.
+	ShowCheckpoint = "show-checkpoint"
+
+	// OverrideCheckpoint is command used for override drainer's checkpoint.
+	OverrideCheckpoint = "override-checkpoint"
+
+	// DrainerHealth is command used for check drainer's health by the replication lag.
+	DrainerHealth = "drainer-health"
+
+	// Check is command used for check the compatibility of upstream and downstream before replicating.
+	Check = "check"
 )
 
 // Config holds the configuration of drainer
@@ -74,17 +87,27 @@ type Config struct {
 	SSLKey           string `toml:"ssl-key" json:"ssl-key"`
 	State            string `toml:"state" json:"state"`
 	ShowOfflineNodes bool   `toml:"state" json:"show-offline-nodes"`
-	tls              *tls.Config
-	printVersion     bool
+
+	CheckpointType   string               `toml:"checkpoint-type" json:"checkpoint-type"`
+	CheckpointTS     int64                `toml:"checkpoint-ts" json:"checkpoint-ts"`
+	CheckpointSchema string               `toml:"checkpoint-schema" json:"checkpoint-schema"`
+	CheckpointDB     *checkpoint.DBConfig `toml:"checkpoint-db" json:"checkpoint-db"`
+
+	UpstreamDB   *checkpoint.DBConfig `toml:"upstream" json:"upstream"`
+	DownstreamDB *checkpoint.DBConfig `toml:"downstream" json:"downstream"`
+	CheckSchemas string               `toml:"check-schemas" json:"check-schemas"`
+
+	tls          *tls.Config
+	printVersion bool
 }
 
 // NewConfig returns an instance of configuration
 func NewConfig() *Config {
-	cfg := &Config{}
+	cfg := &Config{CheckpointDB: new(checkpoint.DBConfig), UpstreamDB: new(checkpoint.DBConfig), DownstreamDB: new(checkpoint.DBConfig)}
 	cfg.FlagSet = flag.NewFlagSet("binlogctl", flag.ContinueOnError)
 
-	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\"")
-	cfg.FlagSet.StringVar(&cfg.NodeID, "node-id", "", "id of node, use to update some node with operation update-pump, update-drainer, pause-pump, pause-drainer, offline-pump and offline-drainer")
+	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\", \"show-checkpoint\", \"override-checkpoint\", \"drainer-health\", \"check\"")
+	cfg.FlagSet.StringVar(&cfg.NodeID, "node-id", "", "id of node, use to update some node with operation update-pump, update-drainer, pause-pump, pause-drainer, offline-pump, offline-drainer and drainer-health, and the drainer whose etcd type checkpoint is used by show-checkpoint and override-checkpoint")
 	cfg.FlagSet.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "meta directory path")
 	cfg.FlagSet.StringVar(&cfg.EtcdURLs, "pd-urls", defaultEtcdURLs, "a comma separated list of PD endpoints")
 	cfg.FlagSet.StringVar(&cfg.SSLCA, "ssl-ca", "", "Path of file that contains list of trusted SSL CAs for connection with cluster components.")
@@ -93,6 +116,22 @@ func NewConfig() *Config {
 	cfg.FlagSet.StringVar(&cfg.TimeZone, "time-zone", "", "set time zone if you want save time info in savepoint file, for example `Asia/Shanghai` for CST time, `Local` for local time")
 	cfg.FlagSet.StringVar(&cfg.State, "state", "", "set node's state, can set to online, pausing, paused, closing or offline.")
 	cfg.FlagSet.BoolVar(&cfg.ShowOfflineNodes, "show-offline-nodes", false, "include offline nodes when querying pumps/drainers")
+	cfg.FlagSet.StringVar(&cfg.CheckpointType, "checkpoint-type", "file", "drainer's checkpoint type used by show-checkpoint and override-checkpoint, can be file, mysql, tidb or etcd. the file type checkpoint is read from data-dir")
+	cfg.FlagSet.Int64Var(&cfg.CheckpointTS, "checkpoint-ts", 0, "new commit ts of checkpoint used by override-checkpoint")
+	cfg.FlagSet.StringVar(&cfg.CheckpointSchema, "checkpoint-schema", "tidb_binlog", "schema of the mysql or tidb type checkpoint")
+	cfg.FlagSet.StringVar(&cfg.CheckpointDB.Host, "checkpoint-host", "127.0.0.1", "host of the mysql or tidb type checkpoint")
+	cfg.FlagSet.IntVar(&cfg.CheckpointDB.Port, "checkpoint-port", 3306, "port of the mysql or tidb type checkpoint")
+	cfg.FlagSet.StringVar(&cfg.CheckpointDB.User, "checkpoint-user", "root", "user of the mysql or tidb type checkpoint")
+	cfg.FlagSet.StringVar(&cfg.CheckpointDB.Password, "checkpoint-password", "", "password of the mysql or tidb type checkpoint")
+	cfg.FlagSet.StringVar(&cfg.UpstreamDB.Host, "upstream-host", "127.0.0.1", "host of the upstream TiDB used by check")
+	cfg.FlagSet.IntVar(&cfg.UpstreamDB.Port, "upstream-port", 4000, "port of the upstream TiDB used by check")
+	cfg.FlagSet.StringVar(&cfg.UpstreamDB.User, "upstream-user", "root", "user of the upstream TiDB used by check")
+	cfg.FlagSet.StringVar(&cfg.UpstreamDB.Password, "upstream-password", "", "password of the upstream TiDB used by check")
+	cfg.FlagSet.StringVar(&cfg.DownstreamDB.Host, "downstream-host", "127.0.0.1", "host of the downstream mysql or tidb used by check")
+	cfg.FlagSet.IntVar(&cfg.DownstreamDB.Port, "downstream-port", 3306, "port of the downstream mysql or tidb used by check")
+	cfg.FlagSet.StringVar(&cfg.DownstreamDB.User, "downstream-user", "root", "user of the downstream mysql or tidb used by check")
+	cfg.FlagSet.StringVar(&cfg.DownstreamDB.Password, "downstream-password", "", "password of the downstream mysql or tidb used by check")
+	cfg.FlagSet.StringVar(&cfg.CheckSchemas, "check-schemas", "", "a comma separated list of the schemas replicated used by check, all but the system schemas if empty")
 	cfg.FlagSet.BoolVar(&cfg.printVersion, "V", false, "prints version and exit")
 
 	return cfg
@@ -61,6 +61,12 @@ func (c dummyCli) GetTS(ctx context.Context) (int64, int64, error) {
 	return c.physical, c.logical, c.err
 }
 
+func (c dummyCli) GetClusterID(ctx context.Context) uint64 {
+	return 7
+}
+
+func (c dummyCli) Close() {}
+
 func newFakePDClient([]string, pd.SecurityOption) (pd.Client, error) {
 	return &dummyCli{
 		physical: 123,
@@ -15,6 +15,7 @@ package binlogctl
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -121,3 +122,45 @@ func ApplyAction(urls, kind, nodeID string, action string) error {
 
 	return errors.Trace(err)
 }
+
+// drainerHealth is the health responded by drainer's /health API
+type drainerHealth struct {
+	Data struct {
+		Status     string  `json:"status"`
+		LagSeconds float64 `json:"lag-seconds"`
+		AppliedTS  int64   `json:"applied-ts"`
+	} `json:"data"`
+}
+
+// CheckDrainerHealth queries the health of drainer judged by the replication lag, it returns an error if
+// the lag exceeds the critical threshold of the lag SLO, so binlogctl exits with a non-zero code.
+func CheckDrainerHealth(urls, nodeID string) error {
+	registry, err := createRegistryFuc(urls)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	n, err := registry.Node(context.Background(), node.NodePrefix[node.DrainerNode], nodeID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	url := fmt.Sprintf("http://%s/health", n.Addr)
+	resp, err := http.Get(url)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	var health drainerHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return errors.Annotatef(err, "decode the response of %s", url)
+	}
+	log.Info("drainer health", zap.String("NodeID", n.NodeID), zap.String("status", health.Data.Status),
+		zap.Float64("lag seconds", health.Data.LagSeconds), zap.Int64("applied ts", health.Data.AppliedTS))
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("drainer %s is unhealthy, status: %s, lag: %.1fs", n.NodeID, health.Data.Status, health.Data.LagSeconds)
+	}
+	return nil
+}
@@ -71,6 +71,33 @@ func (s *testNodesSuite) TestApplyAction(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *testNodesSuite) TestCheckDrainerHealth(c *C) {
+	code := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, Equals, "/health")
+		w.WriteHeader(code)
+		w.Write([]byte(`{"code": 200, "data": {"status": "critical", "lag-seconds": 120, "applied-ts": 1}}`))
+	}))
+	defer server.Close()
+
+	prefix := path.Join(node.DefaultRootPath, node.NodePrefix[node.DrainerNode])
+	ns := &node.Status{NodeID: "drainer", Addr: strings.TrimPrefix(server.URL, "http://"), State: node.Online, IsAlive: true}
+	err := fakeRegistry.UpdateNode(context.Background(), prefix, ns)
+	c.Assert(err, IsNil)
+	// the other tests query all the nodes as pumps
+	defer func() {
+		cli := etcd.NewClient(testEtcdCluster.RandClient(), node.DefaultRootPath)
+		c.Assert(cli.Delete(context.Background(), prefix, true), IsNil)
+	}()
+
+	err = CheckDrainerHealth("127.0.0.1:2379", "drainer")
+	c.Assert(err, IsNil)
+
+	code = http.StatusServiceUnavailable
+	err = CheckDrainerHealth("127.0.0.1:2379", "drainer")
+	c.Assert(err, ErrorMatches, "drainer drainer is unhealthy, status: critical, lag: 120.0s")
+}
+
 func (s *testNodesSuite) TestQueryNodesByKind(c *C) {
 	registerPumpForTest(c, "test", "127.0.0.1:8255")
 
@@ -52,18 +52,20 @@ func main() {
 
 	go startHTTPServer(cfg.ListenAddr)
 
-	srv, err := arbiter.NewServer(cfg)
+	manager, err := arbiter.NewTaskManager(cfg)
 	if err != nil {
 		log.Error("new server failed", zap.Error(err))
 		return
 	}
 
+	manager.RegisterHTTPHandlers(http.DefaultServeMux)
+
 	util.SetupSignalHandler(func(_ os.Signal) {
-		srv.Close()
+		manager.Close()
 	})
 
 	log.Info("start run server...")
-	err = srv.Run()
+	err = manager.Run()
 	if err != nil {
 		log.Error("run server failed", zap.Error(err))
 	}
@@ -60,6 +60,14 @@ func main() {
 		err = ctl.ApplyAction(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, close)
 	case ctl.OfflineDrainer:
 		err = ctl.ApplyAction(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, close)
+	case ctl.ShowCheckpoint:
+		err = ctl.ShowDrainerCheckpoint(cfg)
+	case ctl.OverrideCheckpoint:
+		err = ctl.OverrideDrainerCheckpoint(cfg)
+	case ctl.DrainerHealth:
+		err = ctl.CheckDrainerHealth(cfg.EtcdURLs, cfg.NodeID)
+	case ctl.Check:
+		err = ctl.CheckCompatibility(cfg)
 	default:
 		err = errors.NotSupportedf("cmd %s", cfg.Command)
 	}
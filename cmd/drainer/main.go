@@ -14,6 +14,8 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"math/rand"
 	_ "net/http/pprof"
 	"os"
@@ -59,10 +61,24 @@ func main() {
 		syscall.SIGQUIT)
 
 	go func() {
-		sig := <-sc
-		log.Info("got signal to exit.", zap.Stringer("signal", sig))
-		bs.Close()
-		os.Exit(0)
+		for sig := range sc {
+			if sig == syscall.SIGHUP {
+				log.Info("got signal to reload config.", zap.Stringer("signal", sig))
+				// don't block the exit signals while waiting for the config to be applied
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), drainer.ReloadTimeout)
+					defer cancel()
+					if err := bs.Reload(ctx); err != nil {
+						log.Error("reload config failed", zap.Error(err))
+					}
+				}()
+				continue
+			}
+
+			log.Info("got signal to exit.", zap.Stringer("signal", sig))
+			bs.Close()
+			os.Exit(0)
+		}
 	}()
 
 	if err := bs.Start(); err != nil {
@@ -70,5 +86,15 @@ func main() {
 		os.Exit(2)
 	}
 
+	if cfg.EndTS > 0 {
+		finalTS, reached := bs.FinalTS()
+		if !reached {
+			log.Error("drainer quit before reaching the end ts", zap.Int64("end ts", cfg.EndTS), zap.Int64("checkpoint ts", finalTS))
+			os.Exit(1)
+		}
+		log.Info("drainer reached the end ts", zap.Int64("end ts", cfg.EndTS), zap.Int64("final ts", finalTS))
+		fmt.Printf("final ts: %d\n", finalTS)
+	}
+
 	log.Info("drainer exit")
 }
@@ -0,0 +1,182 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// loader-bench benchmarks the loader against a MySQL/TiDB or the blackhole driver discarding the statements, e.g.,
+//
+//	loader-bench -profile hot-update -host 127.0.0.1 -port 4000 -worker-count 32
+//	loader-bench -profile mixed -blackhole -blackhole-latency 1ms -safe-mode -digest-batch-size 16 -cpuprofile cpu.out
+//
+// The flags of the workload set explicitly override the ones of the profile.
+package main
+
+import (
+	"context"
+	gosql "database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loader/bench"
+	"go.uber.org/zap"
+)
+
+var (
+	profile = flag.String("profile", "mixed", "the workload profile: mixed, insert, update, hot-update or wide")
+
+	schema      = flag.String("schema", "", "the schema the tables are created in, it's dropped first")
+	tables      = flag.Int("tables", 0, "the number of tables")
+	columns     = flag.Int("columns", 0, "the columns besides the primary key")
+	valueSize   = flag.Int("value-size", 0, "the length of the string values")
+	initialRows = flag.Int("initial-rows", 0, "the rows inserted into each table before the benchmark")
+	txns        = flag.Int("txns", 0, "the txns applied in the benchmark")
+	txnSize     = flag.Int("txn-size", 0, "the DMLs of each txn")
+	insert      = flag.Int("insert-weight", 0, "the weight of inserts")
+	update      = flag.Int("update-weight", 0, "the weight of updates")
+	del         = flag.Int("delete-weight", 0, "the weight of deletes")
+	hotKeySkew  = flag.Float64("hot-key-skew", 0, "the zipf exponent of the keys updated and deleted, must be greater than 1, 0 means uniform")
+	seed        = flag.Int64("seed", 0, "the seed of the workload")
+
+	host      = flag.String("host", "127.0.0.1", "the host of the target database")
+	port      = flag.Int("port", 3306, "the port of the target database")
+	user      = flag.String("user", "root", "the user of the target database")
+	password  = flag.String("password", "", "the password of the target database")
+	blackhole = flag.Bool("blackhole", false, "discard the txns by the blackhole driver instead of applying them to the target database")
+	latency   = flag.Duration("blackhole-latency", 0, "the latency of each statement of the blackhole driver")
+
+	workerCount     = flag.Int("worker-count", 16, "the worker count of the loader")
+	batchSize       = flag.Int("batch-size", 20, "the batch size of the loader")
+	safeMode        = flag.Bool("safe-mode", false, "apply the txns in safe mode")
+	groupCommitSize = flag.Int("group-commit-size", 0, "the max DMLs committed in one downstream txn, 0 means disabled")
+	digestBatchSize = flag.Int("digest-batch-size", 0, "the max DMLs of the same statement digest sent together, 0 means disabled")
+
+	cpuProfile = flag.String("cpuprofile", "", "write the cpu profile of the benchmark to the file")
+	memProfile = flag.String("memprofile", "", "write the heap profile after the benchmark to the file")
+)
+
+func main() {
+	flag.Parse()
+
+	cfg, err := workloadConfig()
+	if err != nil {
+		log.Fatal("invalid workload", zap.Error(err))
+	}
+	w, err := bench.NewWorkload(cfg)
+	if err != nil {
+		log.Fatal("invalid workload", zap.Error(err))
+	}
+
+	var db *gosql.DB
+	if *blackhole {
+		db, err = gosql.Open(bench.BlackholeDriver, fmt.Sprintf("latency=%s", *latency))
+		if err != nil {
+			log.Fatal("open blackhole database failed", zap.Error(err))
+		}
+	} else {
+		db, err = loader.CreateDB(*user, *password, *host, *port)
+		if err != nil {
+			log.Fatal("open target database failed", zap.Error(err))
+		}
+	}
+	defer db.Close()
+
+	if len(*cpuProfile) > 0 {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			log.Fatal("create cpu profile failed", zap.Error(err))
+		}
+		defer f.Close()
+		if err = pprof.StartCPUProfile(f); err != nil {
+			log.Fatal("start cpu profile failed", zap.Error(err))
+		}
+	}
+
+	opts := []loader.Option{loader.WorkerCount(*workerCount), loader.BatchSize(*batchSize), loader.SafeMode(*safeMode)}
+	if *groupCommitSize > 0 {
+		opts = append(opts, loader.GroupCommit(*groupCommitSize, time.Millisecond))
+	}
+	if *digestBatchSize > 0 {
+		opts = append(opts, loader.DigestBatch(*digestBatchSize))
+	}
+	report, err := bench.Run(context.Background(), db, w, opts...)
+	if len(*cpuProfile) > 0 {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		log.Fatal("benchmark failed", zap.String("error", errors.ErrorStack(err)))
+	}
+
+	if len(*memProfile) > 0 {
+		if err = writeMemProfile(*memProfile); err != nil {
+			log.Fatal("write heap profile failed", zap.Error(err))
+		}
+	}
+
+	fmt.Printf("profile: %s, config: %+v\n", *profile, cfg)
+	fmt.Print(report)
+	if *blackhole {
+		fmt.Printf("statements executed: %d\n", bench.BlackholeStatements(db))
+	}
+}
+
+// workloadConfig returns the config of the profile overridden by the flags set
+func workloadConfig() (bench.Config, error) {
+	cfg, err := bench.ProfileConfig(*profile)
+	if err != nil {
+		return cfg, errors.Trace(err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "schema":
+			cfg.Schema = *schema
+		case "tables":
+			cfg.Tables = *tables
+		case "columns":
+			cfg.Columns = *columns
+		case "value-size":
+			cfg.ValueSize = *valueSize
+		case "initial-rows":
+			cfg.InitialRows = *initialRows
+		case "txns":
+			cfg.Txns = *txns
+		case "txn-size":
+			cfg.TxnSize = *txnSize
+		case "insert-weight":
+			cfg.InsertWeight = *insert
+		case "update-weight":
+			cfg.UpdateWeight = *update
+		case "delete-weight":
+			cfg.DeleteWeight = *del
+		case "hot-key-skew":
+			cfg.HotKeySkew = *hotKeySkew
+		case "seed":
+			cfg.Seed = *seed
+		}
+	})
+	return cfg, nil
+}
+
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	runtime.GC()
+	return errors.Trace(pprof.WriteHeapProfile(f))
+}
@@ -14,7 +14,9 @@
 package main
 
 import (
+	"context"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -23,6 +25,7 @@ import (
 
 	_ "net/http/pprof"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
@@ -56,17 +59,48 @@ func main() {
 		log.Fatal("create reparo failed", zap.Error(err))
 	}
 
+	if cfg.StatusAddr != "" {
+		r.RegisterHTTPHandlers(http.DefaultServeMux)
+		go func() {
+			if err := http.ListenAndServe(cfg.StatusAddr, nil); err != nil {
+				log.Fatal("listen and serve http failed", zap.String("addr", cfg.StatusAddr), zap.Error(err))
+			}
+		}()
+	}
+
+	// the restoring stops at the binlog being synced, then the ones synced are applied by Close and the state
+	// is saved, so it can be continued
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		sig := <-sc
-		log.Info("got signal to exit.", zap.Stringer("signale", sig))
-		r.Close()
-		os.Exit(0)
+		log.Info("got signal to exit.", zap.Stringer("signal", sig))
+		cancel()
 	}()
 
-	if err := r.Process(); err != nil {
-		log.Error("reparo processing failed", zap.Error(err))
+	processErr := r.Start(ctx)
+	if processErr != nil {
+		if errors.Cause(processErr) == context.Canceled {
+			log.Info("reparo processing cancelled")
+		} else {
+			log.Error("reparo processing failed", zap.Error(processErr))
+		}
+	}
+	closeErr := r.Close()
+	if processErr != nil || closeErr != nil {
+		failure := processErr
+		if failure == nil {
+			failure = closeErr
+		}
+		if err := r.SaveState(failure); err != nil {
+			log.Error("save state failed", zap.Error(err))
+		}
+	}
+	if closeErr != nil {
+		log.Fatal("close reparo failed", zap.Error(closeErr))
 	}
-	if err := r.Close(); err != nil {
-		log.Fatal("close reparo failed", zap.Error(err))
+	if processErr == nil {
+		if err := r.Verify(); err != nil {
+			log.Fatal("verify restored tables failed", zap.Error(err))
+		}
 	}
 }
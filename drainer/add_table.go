@@ -0,0 +1,206 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// the states of the tables added to the running task
+const (
+	AddedTableCopying = "copying"
+	AddedTableSynced  = "synced"
+	AddedTableFailed  = "failed"
+)
+
+// SnapshotSourceConfig is the upstream TiDB the tables added to the running task are copied from, see Syncer.AddTable
+type SnapshotSourceConfig struct {
+	Host     string `toml:"host" json:"host"`
+	Port     int    `toml:"port" json:"port"`
+	User     string `toml:"user" json:"user"`
+	Password string `toml:"password" json:"password"`
+	// read the password from the environment variable, the file or the command instead of `password`
+	PasswordFrom *secret.Source `toml:"password-from" json:"password-from"`
+}
+
+// AddedTable is the state of a table added to the running task
+type AddedTable struct {
+	Schema string `json:"db-name"`
+	Table  string `json:"tbl-name"`
+	// the ts of the snapshot the table is copied from, 0 if it's not got yet
+	SnapshotTS int64  `json:"snapshot-ts"`
+	State      string `json:"state"`
+	Error      string `json:"error,omitempty"`
+}
+
+// addTableRequest is handled by run between the binlogs, so the binlogs of the table after it are synced
+type addTableRequest struct {
+	table filter.TableName
+	done  chan error
+}
+
+// AddTable adds the table to the replicate-do-table rules of the running task. Its binlogs are synced from now on,
+// but they're buffered while the table is copied from the snapshot of upstream in the background, then the ones
+// after the snapshot are applied, see loader.Loader.CopySnapshot. The table failed to copy is copied again from the
+// same snapshot by adding it again. It's only available when the downstream is mysql or tidb and snapshot-from is set.
+// The table added is kept when the config is reloaded, but it's not saved across restarts, so add it to the config
+// file after it's synced.
+func (s *Syncer) AddTable(database string, table string) error {
+	if s.Config().SnapshotFrom == nil {
+		return errors.New("can't add the table as snapshot-from isn't set")
+	}
+	if _, ok := s.dsyncer.(*dsync.MysqlSyncer); !ok {
+		return errors.Errorf("can't add the table when the downstream is %s", s.Config().DestDBType)
+	}
+
+	req := &addTableRequest{table: filter.TableName{Schema: database, Table: table}, done: make(chan error, 1)}
+	select {
+	case s.addTableCh <- req:
+		return errors.Trace(<-req.done)
+	case <-s.closed:
+		return errors.New("syncer is closed")
+	}
+}
+
+// AddedTables returns the states of the tables added to the running task
+func (s *Syncer) AddedTables() []AddedTable {
+	s.addedMu.Lock()
+	defer s.addedMu.Unlock()
+	tables := make([]AddedTable, 0, len(s.added))
+	for _, t := range s.added {
+		tables = append(tables, *t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Schema != tables[j].Schema {
+			return tables[i].Schema < tables[j].Schema
+		}
+		return tables[i].Table < tables[j].Table
+	})
+	return tables
+}
+
+// addTable handles the request of AddTable in run, it starts copying the table in the background until ctx is done
+func (s *Syncer) addTable(ctx context.Context, name filter.TableName) error {
+	mysqlSyncer := s.dsyncer.(*dsync.MysqlSyncer)
+	key := pkgsql.QuoteSchema(name.Schema, name.Table)
+
+	s.addedMu.Lock()
+	added, ok := s.added[key]
+	if ok && added.State != AddedTableFailed {
+		s.addedMu.Unlock()
+		return errors.Errorf("the table %s is %s", key, added.State)
+	}
+	if ok {
+		added.State, added.Error = AddedTableCopying, ""
+	}
+	s.addedMu.Unlock()
+
+	if !ok {
+		if !s.filter.SkipSchemaAndTable(name.Schema, name.Table) {
+			return errors.Errorf("the table %s is already synced", key)
+		}
+		cfg := s.Config()
+		cfg.DoTables = append(append([]filter.TableName(nil), cfg.DoTables...), name)
+		f := newFilter(&cfg)
+		if f.SkipSchemaAndTable(name.Schema, name.Table) {
+			return errors.Errorf("the table %s is ignored by ignore-schemas or ignore-table", key)
+		}
+
+		// the binlogs of the table are buffered from now on until it's copied
+		mysqlSyncer.PauseTable(name.Schema, name.Table)
+		if id, ok := s.schema.TableIDByName(name.Schema, name.Table); ok {
+			mysqlSyncer.RecordTable(name.Schema, name.Table, id)
+		}
+		s.filter = f
+		s.cfgMu.Lock()
+		s.cfg = &cfg
+		s.cfgMu.Unlock()
+
+		added = &AddedTable{Schema: name.Schema, Table: name.Table, State: AddedTableCopying}
+		s.addedMu.Lock()
+		s.added[key] = added
+		s.addedMu.Unlock()
+		log.Info("table added to the task", zap.String("table", key))
+	}
+
+	go s.copyAddedTable(ctx, mysqlSyncer, s.cfg.SnapshotFrom, added)
+	return nil
+}
+
+// copyAddedTable copies the table added from the snapshot of upstream, and records the result in added
+func (s *Syncer) copyAddedTable(ctx context.Context, mysqlSyncer *dsync.MysqlSyncer, source *SnapshotSourceConfig, added *AddedTable) {
+	s.addedMu.Lock()
+	name := filter.TableName{Schema: added.Schema, Table: added.Table}
+	ts := added.SnapshotTS
+	s.addedMu.Unlock()
+
+	ts, err := copySnapshot(ctx, mysqlSyncer, source, ts, name)
+
+	s.addedMu.Lock()
+	defer s.addedMu.Unlock()
+	if ts > 0 {
+		added.SnapshotTS = ts
+	}
+	if err != nil {
+		log.Error("copy the table added failed", zap.String("table", pkgsql.QuoteSchema(name.Schema, name.Table)),
+			zap.Int64("snapshot ts", ts), zap.Error(err))
+		added.State, added.Error = AddedTableFailed, err.Error()
+		return
+	}
+	log.Info("the table added is copied", zap.String("table", pkgsql.QuoteSchema(name.Schema, name.Table)), zap.Int64("snapshot ts", ts))
+	added.State = AddedTableSynced
+}
+
+func copySnapshot(ctx context.Context, mysqlSyncer *dsync.MysqlSyncer, source *SnapshotSourceConfig, ts int64, name filter.TableName) (int64, error) {
+	password, err := secret.Password(source.Password, source.PasswordFrom)
+	if err != nil {
+		return ts, errors.Trace(err)
+	}
+	db, err := loader.CreateDB(source.User, password, source.Host, source.Port)
+	if err != nil {
+		return ts, errors.Trace(err)
+	}
+	defer db.Close()
+	return mysqlSyncer.CopySnapshot(ctx, db, ts, name)
+}
+
+// withAddedTables returns the replicate-do-table rules with the tables added, which are kept when the config
+// is reloaded, unless all the tables are replicated
+func (s *Syncer) withAddedTables(cfg *SyncerConfig) []filter.TableName {
+	if len(cfg.DoTables) == 0 && len(cfg.DoDBs) == 0 {
+		return cfg.DoTables
+	}
+	tables := append([]filter.TableName(nil), cfg.DoTables...)
+	for _, added := range s.AddedTables() {
+		name := filter.TableName{Schema: added.Schema, Table: added.Table}
+		found := false
+		for _, t := range tables {
+			found = found || t == name
+		}
+		if !found {
+			tables = append(tables, name)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type addTableSuite struct{}
+
+var _ = check.Suite(&addTableSuite{})
+
+func (s *addTableSuite) TestAddTableWithoutSource(c *check.C) {
+	syncer := &Syncer{cfg: &SyncerConfig{DestDBType: "mysql"}}
+	err := syncer.AddTable("test", "t")
+	c.Assert(err, check.ErrorMatches, ".*snapshot-from isn't set.*")
+}
+
+func (s *addTableSuite) TestWithAddedTables(c *check.C) {
+	syncer := &Syncer{added: map[string]*AddedTable{
+		"`test`.`b`": {Schema: "test", Table: "b", State: AddedTableSynced},
+		"`test`.`a`": {Schema: "test", Table: "a", State: AddedTableCopying},
+	}}
+	c.Assert(syncer.AddedTables(), check.DeepEquals, []AddedTable{
+		{Schema: "test", Table: "a", State: AddedTableCopying},
+		{Schema: "test", Table: "b", State: AddedTableSynced},
+	})
+
+	// the tables added are kept, and not duplicated
+	cfg := &SyncerConfig{DoTables: []filter.TableName{{Schema: "test", Table: "a"}, {Schema: "test", Table: "c"}}}
+	c.Assert(syncer.withAddedTables(cfg), check.DeepEquals, []filter.TableName{
+		{Schema: "test", Table: "a"}, {Schema: "test", Table: "c"}, {Schema: "test", Table: "b"},
+	})
+
+	// all the tables are replicated
+	c.Assert(syncer.withAddedTables(&SyncerConfig{}), check.HasLen, 0)
+}
+
+func (s *addTableSuite) TestTableIDByName(c *check.C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, check.IsNil)
+	schema.tableIDToName[1] = TableName{Schema: "test", Table: "t"}
+
+	id, ok := schema.TableIDByName("test", "t")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(id, check.Equals, int64(1))
+	_, ok = schema.TableIDByName("test", "t2")
+	c.Assert(ok, check.IsFalse)
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+// the modes of handling the AUTO_RANDOM and SEQUENCE of TiDB which mysql doesn't support,
+// see SyncerConfig.AutoRandomSequence
+const (
+	// AutoRandomSequenceReject fails drainer before replicating the tables using them
+	AutoRandomSequenceReject = "reject"
+	// AutoRandomSequenceStrip strips the AUTO_RANDOM attributes and the NEXTVAL defaults from the DDLs, the
+	// columns are plain BIGINT holding the values of upstream, and skips the DDLs of the sequences
+	AutoRandomSequenceStrip = "strip"
+)
+
+var (
+	// the TiDB specific comments like /*T![auto_rand] AUTO_RANDOM(5) */ are ignored by mysql, only the bare ones matter
+	tidbCommentRegexp    = regexp.MustCompile(`/\*T!\[\w+\][^*]*\*/`)
+	autoRandomRegexp     = regexp.MustCompile("(?i)\\s*\\bAUTO_RANDOM\\b(\\s*\\(\\s*\\d+\\s*\\))?")
+	autoRandomBaseRegexp = regexp.MustCompile("(?i)\\s*,?\\s*\\bAUTO_RANDOM_BASE\\b\\s*=?\\s*\\d+")
+	nextValDefaultRegexp = regexp.MustCompile("(?i)\\s*\\bDEFAULT\\s+(NEXTVAL\\s*\\([^)]*\\)|NEXT\\s+VALUE\\s+FOR\\s+[\\w`.]+)")
+	sequenceDDLRegexp    = regexp.MustCompile(`(?i)^\s*(CREATE|ALTER|DROP)\s+(OR\s+REPLACE\s+)?SEQUENCE\b`)
+	emptyAlterRegexp     = regexp.MustCompile("(?i)^\\s*ALTER\\s+TABLE\\s+[\\w`.]+\\s*;?\\s*$")
+)
+
+func isValidAutoRandomSequenceMode(mode string) bool {
+	switch mode {
+	case "", AutoRandomSequenceReject, AutoRandomSequenceStrip:
+		return true
+	}
+	return false
+}
+
+// sequenceDDLVerb returns CREATE, ALTER or DROP if the DDL is of a sequence, the parser doesn't know them yet
+func sequenceDDLVerb(sql string) (string, bool) {
+	matches := sequenceDDLRegexp.FindStringSubmatch(sql)
+	if matches == nil {
+		return "", false
+	}
+	return strings.ToUpper(matches[1]), true
+}
+
+// autoRandomSequenceFeature returns the feature of TiDB mysql doesn't support used by the DDL, empty if none
+func autoRandomSequenceFeature(sql string) string {
+	if _, ok := sequenceDDLVerb(sql); ok {
+		return "SEQUENCE"
+	}
+
+	sql = tidbCommentRegexp.ReplaceAllString(sql, "")
+	switch {
+	case autoRandomRegexp.MatchString(sql):
+		return "AUTO_RANDOM"
+	case autoRandomBaseRegexp.MatchString(sql):
+		return "AUTO_RANDOM_BASE"
+	case nextValDefaultRegexp.MatchString(sql):
+		return "NEXTVAL default"
+	}
+	return ""
+}
+
+// rewriteAutoRandomSequenceDDL returns the DDL executed in mysql by the mode, empty if the DDL is skipped
+func rewriteAutoRandomSequenceDDL(mode string, sql string) (string, error) {
+	feature := autoRandomSequenceFeature(sql)
+	if len(feature) == 0 {
+		return sql, nil
+	}
+
+	if mode != AutoRandomSequenceStrip {
+		return "", errors.Errorf("%s is not supported by mysql: %s, set `auto-random-sequence` to strip or skip the table", feature, sql)
+	}
+
+	if feature == "SEQUENCE" {
+		return "", nil
+	}
+	sql = autoRandomRegexp.ReplaceAllString(sql, "")
+	sql = autoRandomBaseRegexp.ReplaceAllString(sql, "")
+	sql = nextValDefaultRegexp.ReplaceAllString(sql, "")
+	if emptyAlterRegexp.MatchString(sql) {
+		// e.g., ALTER TABLE t AUTO_RANDOM_BASE = 100
+		return "", nil
+	}
+	return sql, nil
+}
+
+// checkAutoRandomSequence returns an error if any table replicated by the filter uses the features of TiDB mysql
+// doesn't support, by the DDLs creating and altering the tables, so drainer fails before replicating them
+func checkAutoRandomSequence(jobs []*model.Job, f *filter.Filter) error {
+	schemas := make(map[int64]string)
+	tables := make(map[int64]*model.Job)
+	features := make(map[int64]string)
+
+	for _, job := range jobs {
+		if skipJob(job) || job.BinlogInfo == nil {
+			continue
+		}
+
+		switch job.Type {
+		case model.ActionCreateSchema:
+			if job.BinlogInfo.DBInfo != nil {
+				schemas[job.SchemaID] = job.BinlogInfo.DBInfo.Name.O
+			}
+		case model.ActionDropSchema:
+			delete(schemas, job.SchemaID)
+		case model.ActionDropTable, model.ActionDropView:
+			delete(features, job.TableID)
+		default:
+			if verb, ok := sequenceDDLVerb(job.Query); ok && verb == "DROP" {
+				delete(features, job.TableID)
+				continue
+			}
+			info := job.BinlogInfo.TableInfo
+			if info == nil {
+				continue
+			}
+			if feature, ok := features[job.TableID]; ok && job.Type == model.ActionTruncateTable {
+				// the table gets a new id
+				delete(features, job.TableID)
+				features[info.ID] = feature
+			}
+			tables[info.ID] = job
+			if feature := autoRandomSequenceFeature(job.Query); len(feature) > 0 {
+				features[info.ID] = feature
+			}
+		}
+	}
+
+	ids := make([]int64, 0, len(features))
+	for id := range features {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		job := tables[id]
+		schema, ok := schemas[job.SchemaID]
+		if !ok || f.SkipSchemaAndTable(schema, job.BinlogInfo.TableInfo.Name.O) {
+			continue
+		}
+		return errors.Errorf("table %s.%s uses %s which is not supported by mysql, set `auto-random-sequence` to strip or skip the table",
+			schema, job.BinlogInfo.TableInfo.Name.O, features[id])
+	}
+	return nil
+}
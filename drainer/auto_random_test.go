@@ -0,0 +1,105 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type autoRandomSuite struct{}
+
+var _ = Suite(&autoRandomSuite{})
+
+func (s *autoRandomSuite) TestRewriteDDL(c *C) {
+	tests := []struct {
+		ddl      string
+		stripped string
+		isErr    bool
+	}{
+		{"create table t (id bigint primary key)", "create table t (id bigint primary key)", false},
+		{"create table t (id bigint primary key /*T![auto_rand] AUTO_RANDOM(5) */)", "create table t (id bigint primary key /*T![auto_rand] AUTO_RANDOM(5) */)", false},
+		{"create table t (id bigint primary key auto_random(5), v int)", "create table t (id bigint primary key, v int)", true},
+		{"create table t (id bigint auto_random primary key) auto_random_base = 100", "create table t (id bigint primary key)", true},
+		{"alter table t auto_random_base = 100", "", true},
+		{"create table t (id bigint default nextval(s) primary key)", "create table t (id bigint primary key)", true},
+		{"create table t (id bigint default next value for test.s)", "create table t (id bigint)", true},
+		{"create sequence s start with 1", "", true},
+		{"DROP SEQUENCE s", "", true},
+	}
+
+	for _, test := range tests {
+		sql, err := rewriteAutoRandomSequenceDDL(AutoRandomSequenceReject, test.ddl)
+		c.Assert(err != nil, Equals, test.isErr, Commentf("%s", test.ddl))
+		if !test.isErr {
+			c.Assert(sql, Equals, test.ddl)
+		}
+
+		sql, err = rewriteAutoRandomSequenceDDL(AutoRandomSequenceStrip, test.ddl)
+		c.Assert(err, IsNil)
+		c.Assert(sql, Equals, test.stripped, Commentf("%s", test.ddl))
+	}
+}
+
+func (s *autoRandomSuite) TestCheckAutoRandomSequence(c *C) {
+	job := func(id int64, tp model.ActionType, tableID int64, query string, table string) *model.Job {
+		j := &model.Job{ID: id, State: model.JobStateDone, Type: tp, SchemaID: 1, TableID: tableID, Query: query,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: id, DBInfo: &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}}}
+		if len(table) > 0 {
+			j.BinlogInfo.TableInfo = &model.TableInfo{ID: tableID, Name: model.NewCIStr(table)}
+		}
+		return j
+	}
+
+	jobs := []*model.Job{
+		job(1, model.ActionCreateSchema, 0, "create database test", ""),
+		job(2, model.ActionCreateTable, 2, "create table t1 (id bigint primary key auto_random)", "t1"),
+		job(3, model.ActionCreateTable, 3, "create table t2 (id bigint primary key)", "t2"),
+	}
+	err := checkAutoRandomSequence(jobs, filter.NewFilter(nil, nil, nil, nil))
+	c.Assert(err, ErrorMatches, ".*table test.t1 uses AUTO_RANDOM.*")
+
+	// skipped by the filter
+	err = checkAutoRandomSequence(jobs, filter.NewFilter(nil, []filter.TableName{{Schema: "test", Table: "t1"}}, nil, nil))
+	c.Assert(err, IsNil)
+
+	// dropped
+	jobs = append(jobs, job(4, model.ActionDropTable, 2, "drop table t1", ""))
+	err = checkAutoRandomSequence(jobs, filter.NewFilter(nil, nil, nil, nil))
+	c.Assert(err, IsNil)
+
+	// the sequence, created by a job type unknown to the parser
+	jobs = append(jobs, job(5, model.ActionType(34), 5, "create sequence s", "s"))
+	err = checkAutoRandomSequence(jobs, filter.NewFilter(nil, nil, nil, nil))
+	c.Assert(err, ErrorMatches, ".*table test.s uses SEQUENCE.*")
+}
+
+func (s *autoRandomSuite) TestHandleSequenceDDL(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+	c.Assert(schema.CreateSchema(&model.DBInfo{ID: 1, Name: model.NewCIStr("test")}), IsNil)
+
+	job := &model.Job{ID: 1, State: model.JobStateDone, Type: model.ActionType(34), SchemaID: 1, TableID: 2, Query: "create sequence s",
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, TableInfo: &model.TableInfo{ID: 2, Name: model.NewCIStr("s")}}}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "s")
+	_, ok := schema.TableByID(2)
+	c.Assert(ok, IsTrue)
+
+	job = &model.Job{ID: 2, State: model.JobStateDone, Type: model.ActionType(36), SchemaID: 1, TableID: 2, Query: "drop sequence s",
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2}}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "s")
+	_, ok = schema.TableByID(2)
+	c.Assert(ok, IsFalse)
+}
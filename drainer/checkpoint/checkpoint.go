@@ -40,6 +40,14 @@ type CheckPoint interface {
 	Close() error
 }
 
+// GTIDRecorder is implemented by the checkpoints saving the GTID set executed in the downstream MySQL
+// together with the checkpoint ts, so another replication chained off the downstream can be coordinated with it.
+type GTIDRecorder interface {
+	// RecordGTID records the GTID set executed in downstream after the txns up to ts are committed,
+	// it's saved by the next Save.
+	RecordGTID(ts int64, gtidSet string)
+}
+
 // NewCheckPoint returns a CheckPoint instance by giving name
 func NewCheckPoint(cfg *Config) (CheckPoint, error) {
 	var (
@@ -51,6 +59,8 @@ func NewCheckPoint(cfg *Config) (CheckPoint, error) {
 		cp, err = newMysql(cfg)
 	case "file":
 		cp, err = NewFile(cfg)
+	case "etcd", "pd":
+		cp, err = newEtcd(cfg)
 	default:
 		err = errors.Errorf("unsupported checkpoint type %s", cfg.CheckpointType)
 	}
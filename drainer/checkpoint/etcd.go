@@ -0,0 +1,171 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"golang.org/x/net/context"
+)
+
+const (
+	etcdCheckPointRootPath = "/tidb-binlog/v1"
+	defaultEtcdTimeout     = 5 * time.Second
+)
+
+// EtcdCheckPoint is a CheckPoint stored in the etcd embedded in PD.
+type EtcdCheckPoint struct {
+	sync.RWMutex
+	closed          bool
+	clusterID       uint64
+	nodeID          string
+	initialCommitTS int64
+
+	client  *etcd.Client
+	timeout time.Duration
+
+	CommitTS int64            `toml:"commitTS" json:"commitTS"`
+	TsMap    map[string]int64 `toml:"ts-map" json:"ts-map"`
+}
+
+var newEtcdClient = etcd.NewClientFromCfg
+
+func newEtcd(cfg *Config) (CheckPoint, error) {
+	// the drainers of a cluster share the etcd of PD, each one must have its own key
+	if len(cfg.NodeID) == 0 {
+		return nil, errors.New("the node id of drainer must be set for the etcd type checkpoint")
+	}
+
+	timeout := cfg.EtcdTimeout
+	if timeout == 0 {
+		timeout = defaultEtcdTimeout
+	}
+
+	client, err := newEtcdClient(cfg.EtcdURLs, timeout, etcdCheckPointRootPath, cfg.TLS)
+	if err != nil {
+		return nil, errors.Annotate(err, "create etcd client failed")
+	}
+
+	sp := &EtcdCheckPoint{
+		clusterID:       cfg.ClusterID,
+		nodeID:          cfg.NodeID,
+		initialCommitTS: cfg.InitialCommitTS,
+		client:          client,
+		timeout:         timeout,
+		TsMap:           make(map[string]int64),
+	}
+
+	err = sp.Load()
+	return sp, errors.Trace(err)
+}
+
+func (sp *EtcdCheckPoint) key() string {
+	return fmt.Sprintf("checkpoint/%d/%s", sp.clusterID, sp.nodeID)
+}
+
+// Load implements CheckPoint.Load interface
+func (sp *EtcdCheckPoint) Load() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	defer func() {
+		if sp.CommitTS == 0 {
+			sp.CommitTS = sp.initialCommitTS
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sp.timeout)
+	defer cancel()
+
+	data, err := sp.client.Get(ctx, sp.key())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			sp.CommitTS = sp.initialCommitTS
+			return nil
+		}
+		return errors.Annotatef(err, "get key %s failed", sp.key())
+	}
+
+	if err := json.Unmarshal(data, sp); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// Save implements CheckPoint.Save interface
+func (sp *EtcdCheckPoint) Save(ts, slaveTS int64) error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	sp.CommitTS = ts
+
+	if slaveTS > 0 {
+		sp.TsMap["master-ts"] = ts
+		sp.TsMap["slave-ts"] = slaveTS
+	}
+
+	b, err := json.Marshal(sp)
+	if err != nil {
+		return errors.Annotate(err, "json marshal failed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sp.timeout)
+	defer cancel()
+
+	// a single put in etcd is atomic, so a crash never leaves a partial checkpoint.
+	err = sp.client.UpdateOrCreate(ctx, sp.key(), string(b), 0)
+	if err != nil {
+		return errors.Annotatef(err, "update key %s failed", sp.key())
+	}
+
+	return nil
+}
+
+// TS implements CheckPoint.TS interface
+func (sp *EtcdCheckPoint) TS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return sp.CommitTS
+}
+
+// Close implements CheckPoint.Close interface
+func (sp *EtcdCheckPoint) Close() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	err := sp.client.Close()
+	if err == nil {
+		sp.closed = true
+	}
+	return errors.Trace(err)
+}
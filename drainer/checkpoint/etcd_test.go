@@ -0,0 +1,84 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"crypto/tls"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+)
+
+type etcdSuite struct{}
+
+var _ = Suite(&etcdSuite{})
+
+func mockEtcdClient() func() {
+	origNewEtcdClient := newEtcdClient
+	newEtcdClient = func([]string, time.Duration, string, *tls.Config) (*etcd.Client, error) {
+		return etcd.NewClient(testEtcdCluster.RandClient(), etcdCheckPointRootPath), nil
+	}
+	return func() {
+		newEtcdClient = origNewEtcdClient
+	}
+}
+
+func (s *etcdSuite) TestEtcdCheckPoint(c *C) {
+	defer mockEtcdClient()()
+
+	cfg := &Config{CheckpointType: "etcd", ClusterID: 1024, NodeID: "drainer-1", InitialCommitTS: 123}
+	cp, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(123))
+
+	err = cp.Save(456, 789)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(456))
+
+	// load the saved checkpoint by another instance
+	cp2, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp2.TS(), Equals, int64(456))
+	c.Assert(cp2.(*EtcdCheckPoint).TsMap["slave-ts"], Equals, int64(789))
+
+	// checkpoints of different clusters are isolated
+	cfg.ClusterID = 2048
+	cp3, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp3.TS(), Equals, int64(123))
+}
+
+func (s *etcdSuite) TestDrainersOfCluster(c *C) {
+	defer mockEtcdClient()()
+
+	_, err := NewCheckPoint(&Config{CheckpointType: "etcd", ClusterID: 4096})
+	c.Assert(err, ErrorMatches, ".*node id of drainer must be set.*")
+
+	cp1, err := NewCheckPoint(&Config{CheckpointType: "etcd", ClusterID: 4096, NodeID: "drainer-1"})
+	c.Assert(err, IsNil)
+	cp2, err := NewCheckPoint(&Config{CheckpointType: "etcd", ClusterID: 4096, NodeID: "drainer-2"})
+	c.Assert(err, IsNil)
+
+	c.Assert(cp1.Save(100, 0), IsNil)
+	c.Assert(cp2.Save(200, 0), IsNil)
+
+	// the drainers of the same cluster don't overwrite the checkpoints of each other
+	reloaded1, err := NewCheckPoint(&Config{CheckpointType: "etcd", ClusterID: 4096, NodeID: "drainer-1"})
+	c.Assert(err, IsNil)
+	c.Assert(reloaded1.TS(), Equals, int64(100))
+	reloaded2, err := NewCheckPoint(&Config{CheckpointType: "etcd", ClusterID: 4096, NodeID: "drainer-2"})
+	c.Assert(err, IsNil)
+	c.Assert(reloaded2.TS(), Equals, int64(200))
+}
@@ -21,7 +21,10 @@ import (
 	"github.com/pingcap/errors"
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
 	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
 )
 
 // MysqlCheckPoint is a local savepoint struct for mysql
@@ -32,25 +35,37 @@ type MysqlCheckPoint struct {
 	initialCommitTS int64
 
 	db     *sql.DB
+	dbCfg  *DBConfig
 	schema string
 	table  string
 
 	CommitTS int64            `toml:"commitTS" json:"commitTS"`
 	TsMap    map[string]int64 `toml:"ts-map" json:"ts-map"`
+	// nil if the GTID set of downstream isn't captured
+	GTID *GTIDPosition `toml:"gtid" json:"gtid,omitempty"`
 }
 
+// GTIDPosition is the GTID set executed in the downstream MySQL after the txns up to CommitTS are committed
+type GTIDPosition struct {
+	CommitTS int64  `toml:"commit-ts" json:"commit-ts"`
+	Set      string `toml:"set" json:"set"`
+}
+
+var _ GTIDRecorder = &MysqlCheckPoint{}
+
 var sqlOpenDB = pkgsql.OpenDB
 
 func newMysql(cfg *Config) (CheckPoint, error) {
 	setDefaultConfig(cfg)
 
-	db, err := sqlOpenDB("mysql", cfg.Db.Host, cfg.Db.Port, cfg.Db.User, cfg.Db.Password)
+	db, err := openDB(cfg.Db)
 	if err != nil {
 		return nil, errors.Annotate(err, "open db failed")
 	}
 
 	sp := &MysqlCheckPoint{
 		db:              db,
+		dbCfg:           cfg.Db,
 		clusterID:       cfg.ClusterID,
 		initialCommitTS: cfg.InitialCommitTS,
 		schema:          cfg.Schema,
@@ -72,6 +87,14 @@ func newMysql(cfg *Config) (CheckPoint, error) {
 	return sp, errors.Trace(err)
 }
 
+func openDB(cfg *DBConfig) (*sql.DB, error) {
+	password, err := secret.Password(cfg.Password, cfg.PasswordFrom)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return sqlOpenDB("mysql", cfg.Host, cfg.Port, cfg.User, password)
+}
+
 // Load implements CheckPoint.Load interface
 func (sp *MysqlCheckPoint) Load() error {
 	sp.Lock()
@@ -128,6 +151,14 @@ func (sp *MysqlCheckPoint) Save(ts, slaveTS int64) error {
 
 	sql := genReplaceSQL(sp, string(b))
 	_, err = sp.db.Exec(sql)
+	if err != nil && secret.IsAccessDenied(err) && sp.dbCfg != nil && sp.dbCfg.PasswordFrom != nil {
+		// the new connections are denied after the password is rotated, reopen db by the new one
+		log.Warn("access to checkpoint db is denied, reopen it", zap.Error(err))
+		if err = sp.reopenDB(); err != nil {
+			return errors.Annotate(err, "reopen db failed")
+		}
+		_, err = sp.db.Exec(sql)
+	}
 	if err != nil {
 		return errors.Annotatef(err, "query sql failed: %s", sql)
 	}
@@ -135,6 +166,26 @@ func (sp *MysqlCheckPoint) Save(ts, slaveTS int64) error {
 	return nil
 }
 
+// RecordGTID implements GTIDRecorder interface
+func (sp *MysqlCheckPoint) RecordGTID(ts int64, gtidSet string) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	sp.GTID = &GTIDPosition{CommitTS: ts, Set: gtidSet}
+}
+
+func (sp *MysqlCheckPoint) reopenDB() error {
+	db, err := openDB(sp.dbCfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := sp.db.Close(); err != nil {
+		log.Warn("close checkpoint db failed", zap.Error(err))
+	}
+	sp.db = db
+	return nil
+}
+
 // TS implements CheckPoint.TS interface
 func (sp *MysqlCheckPoint) TS() int64 {
 	sp.RLock()
@@ -15,14 +15,23 @@ package checkpoint
 
 import (
 	"database/sql"
+	"encoding/json"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	"go.etcd.io/etcd/integration"
 )
 
+var testEtcdCluster *integration.ClusterV3
+
 func TestClient(t *testing.T) {
+	testEtcdCluster = integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer testEtcdCluster.Terminate(t)
+
 	TestingT(t)
 }
 
@@ -69,6 +78,54 @@ func (s *saveSuite) TestShouldUpdateTsMap(c *C) {
 	c.Assert(cp.TsMap["slave-ts"], Equals, int64(3333))
 }
 
+func (s *saveSuite) TestShouldSaveGTID(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	mock.ExpectExec("replace into db.tbl.*gtid.*3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl", TsMap: make(map[string]int64)}
+	cp.RecordGTID(1000, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	err = cp.Save(1111, 0)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the GTID position is loaded with the checkpoint
+	loaded := MysqlCheckPoint{}
+	b, err := json.Marshal(&cp)
+	c.Assert(err, IsNil)
+	c.Assert(json.Unmarshal(b, &loaded), IsNil)
+	c.Assert(loaded.GTID, DeepEquals, &GTIDPosition{CommitTS: 1000, Set: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"})
+}
+
+func (s *saveSuite) TestShouldReopenAfterPasswordRotated(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	mock.ExpectExec("replace into db.tbl.*").WillReturnError(&mysql.MySQLError{Number: 1045, Message: "Access denied"})
+	mock.ExpectClose()
+
+	newDB, newMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	newMock.ExpectExec("replace into db.tbl.*").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	origOpen := sqlOpenDB
+	defer func() { sqlOpenDB = origOpen }()
+	sqlOpenDB = func(proto, host string, port int, username, password string) (*sql.DB, error) {
+		c.Assert(password, Equals, "rotated")
+		return newDB, nil
+	}
+
+	cp := MysqlCheckPoint{
+		db:     db,
+		dbCfg:  &DBConfig{PasswordFrom: &secret.Source{Command: []string{"echo", "rotated"}}},
+		schema: "db",
+		table:  "tbl",
+	}
+	err = cp.Save(1111, 0)
+	c.Assert(err, IsNil)
+	c.Assert(cp.db, Equals, newDB)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(newMock.ExpectationsWereMet(), IsNil)
+}
+
 type loadSuite struct{}
 
 var _ = Suite(&loadSuite{})
@@ -14,10 +14,13 @@
 package checkpoint
 
 import (
+	"crypto/tls"
 	"fmt"
+	"time"
 
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
 )
 
 // DBConfig is the DB configuration.
@@ -26,6 +29,9 @@ type DBConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
 	Port     int    `toml:"port" json:"port"`
+
+	// read the password from the environment variable, the file or the command instead of Password
+	PasswordFrom *secret.Source `toml:"password-from" json:"password-from"`
 }
 
 // Config is the savepoint configuration
@@ -36,7 +42,15 @@ type Config struct {
 	Schema string
 	Table  string
 
-	ClusterID       uint64
+	// EtcdURLs, EtcdTimeout and TLS are used by the etcd type checkpoint,
+	// which is stored in the etcd embedded in PD.
+	EtcdURLs    []string
+	EtcdTimeout time.Duration
+	TLS         *tls.Config
+
+	ClusterID uint64
+	// NodeID is the ID of drainer, the etcd type checkpoints of the drainers in a cluster are keyed by it
+	NodeID          string
 	InitialCommitTS int64
 	CheckPointFile  string `toml:"dir" json:"dir"`
 }
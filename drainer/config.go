@@ -31,8 +31,11 @@ import (
 	"go.uber.org/zap"
 
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/config"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
@@ -61,11 +64,13 @@ var (
 type SyncerConfig struct {
 	StrSQLMode        *string            `toml:"sql-mode" json:"sql-mode"`
 	SQLMode           mysql.SQLMode      `toml:"-" json:"-"`
+	TimeZone          *time.Location     `toml:"-" json:"-"`
 	IgnoreTxnCommitTS []int64            `toml:"ignore-txn-commit-ts" json:"ignore-txn-commit-ts"`
 	IgnoreSchemas     string             `toml:"ignore-schemas" json:"ignore-schemas"`
 	IgnoreTables      []filter.TableName `toml:"ignore-table" json:"ignore-table"`
 	TxnBatch          int                `toml:"txn-batch" json:"txn-batch"`
 	WorkerCount       int                `toml:"worker-count" json:"worker-count"`
+	TxnRateLimit      int                `toml:"txn-rate-limit" json:"txn-rate-limit"`
 	To                *dsync.DBConfig    `toml:"to" json:"to"`
 	DoTables          []filter.TableName `toml:"replicate-do-table" json:"replicate-do-table"`
 	DoDBs             []string           `toml:"replicate-do-db" json:"replicate-do-db"`
@@ -75,37 +80,66 @@ type SyncerConfig struct {
 	EnableDispatch    bool               `toml:"enable-dispatch" json:"enable-dispatch"`
 	SafeMode          bool               `toml:"safe-mode" json:"safe-mode"`
 	EnableCausality   bool               `toml:"enable-detect" json:"enable-detect"`
+	// mark the txns applied to downstream and skip the txns marked by the other direction, see loopbacksync
+	LoopbackControl bool  `toml:"loopback-control" json:"loopback-control"`
+	ChannelID       int64 `toml:"channel-id" json:"channel-id"`
+	// sync the DDLs when loopback-control is enabled, only one direction of a bidirectional sync should
+	SyncDDL bool `toml:"sync-ddl" json:"sync-ddl"`
+	// how the partition DDLs are handled: "sync", "skip" or "translate", see PartitionDDLSync
+	PartitionDDL string `toml:"partition-ddl" json:"partition-ddl"`
+	// how the AUTO_RANDOM and SEQUENCE of TiDB are handled for mysql: "reject" or "strip", see AutoRandomSequenceReject
+	AutoRandomSequence string `toml:"auto-random-sequence" json:"auto-random-sequence"`
+	// how the other DDL syntax of TiDB is handled for mysql: "sync", "strip" or "skip", see TiDBDDLSyntaxSync
+	TiDBDDLSyntax string `toml:"tidb-ddl-syntax" json:"tidb-ddl-syntax"`
+	// how the DROP TABLE and TRUNCATE TABLE DDLs are handled: "replicate", "skip" or "recycle", see DestructiveDDLRecycle
+	DestructiveDDL string `toml:"destructive-ddl" json:"destructive-ddl"`
+	// the schema the tables dropped or truncated are moved to in downstream when destructive-ddl is recycle
+	RecycleSchema string `toml:"recycle-schema" json:"recycle-schema"`
+	// in minutes, the tables recycled are dropped after it unless they're kept by the API, 0 means never dropped
+	RecycleGracePeriod int `toml:"recycle-grace-period" json:"recycle-grace-period"`
+	// archive the binlogs synced to local files besides the downstream, see dsync.Archiver
+	Archive dsync.ArchiveConfig `toml:"archive" json:"archive"`
+	// the upstream TiDB the tables added to the running task are copied from, see Syncer.AddTable
+	SnapshotFrom *SnapshotSourceConfig `toml:"snapshot-from" json:"snapshot-from"`
 }
 
 // Config holds the configuration of drainer
 type Config struct {
-	*flag.FlagSet   `json:"-"`
-	LogLevel        string          `toml:"log-level" json:"log-level"`
-	NodeID          string          `toml:"node-id" json:"node-id"`
-	ListenAddr      string          `toml:"addr" json:"addr"`
-	AdvertiseAddr   string          `toml:"advertise-addr" json:"advertise-addr"`
-	DataDir         string          `toml:"data-dir" json:"data-dir"`
-	DetectInterval  int             `toml:"detect-interval" json:"detect-interval"`
-	EtcdURLs        string          `toml:"pd-urls" json:"pd-urls"`
-	LogFile         string          `toml:"log-file" json:"log-file"`
-	InitialCommitTS int64           `toml:"initial-commit-ts" json:"initial-commit-ts"`
-	SyncerCfg       *SyncerConfig   `toml:"syncer" json:"sycner"`
-	Security        security.Config `toml:"security" json:"security"`
-	SyncedCheckTime int             `toml:"synced-check-time" json:"synced-check-time"`
-	Compressor      string          `toml:"compressor" json:"compressor"`
-	EtcdTimeout     time.Duration
-	MetricsAddr     string
-	MetricsInterval int
-	configFile      string
-	printVersion    bool
-	tls             *tls.Config
+	*flag.FlagSet        `json:"-"`
+	LogLevel             string          `toml:"log-level" json:"log-level"`
+	NodeID               string          `toml:"node-id" json:"node-id"`
+	ListenAddr           string          `toml:"addr" json:"addr"`
+	AdvertiseAddr        string          `toml:"advertise-addr" json:"advertise-addr"`
+	DataDir              string          `toml:"data-dir" json:"data-dir"`
+	DetectInterval       int             `toml:"detect-interval" json:"detect-interval"`
+	EtcdURLs             string          `toml:"pd-urls" json:"pd-urls"`
+	LogFile              string          `toml:"log-file" json:"log-file"`
+	InitialCommitTS      int64           `toml:"initial-commit-ts" json:"initial-commit-ts"`
+	EndTS                int64           `toml:"end-ts" json:"end-ts"`
+	SyncerCfg            *SyncerConfig   `toml:"syncer" json:"sycner"`
+	Security             security.Config `toml:"security" json:"security"`
+	SyncedCheckTime      int             `toml:"synced-check-time" json:"synced-check-time"`
+	Compressor           string          `toml:"compressor" json:"compressor"`
+	Mask                 *mask.Config    `toml:"mask" json:"mask"`
+	LagSLO               LagSLOConfig    `toml:"lag-slo" json:"lag-slo"`
+	Probe                ProbeConfig     `toml:"probe" json:"probe"`
+	DiagnosticsAddr      string          `toml:"diagnostics-addr" json:"diagnostics-addr"`
+	EtcdTimeout          time.Duration
+	MetricsAddr          string
+	MetricsInterval      int
+	configFile           string
+	printVersion         bool
+	printEffectiveConfig bool
+	// args are kept to parse the config again when reloading
+	args []string
+	tls  *tls.Config
 }
 
 // NewConfig return an instance of configuration
 func NewConfig() *Config {
 	cfg := &Config{
 		EtcdTimeout: defaultEtcdTimeout,
-		SyncerCfg:   &SyncerConfig{},
+		SyncerCfg:   &SyncerConfig{SyncDDL: true},
 	}
 	cfg.FlagSet = flag.NewFlagSet("drainer", flag.ContinueOnError)
 	fs := cfg.FlagSet
@@ -122,15 +156,18 @@ func NewConfig() *Config {
 	fs.StringVar(&cfg.LogLevel, "L", "info", "log level: debug, info, warn, error, fatal")
 	fs.StringVar(&cfg.configFile, "config", "", "path to the configuration file")
 	fs.BoolVar(&cfg.printVersion, "V", false, "print version information and exit")
+	fs.BoolVar(&cfg.printEffectiveConfig, "print-effective-config", false, "print the effective config in TOML after parsing the config file and flags and exit")
 	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "prometheus pushgateway address, leaves it empty will disable prometheus push")
 	fs.IntVar(&cfg.MetricsInterval, "metrics-interval", 15, "prometheus client push interval in second, set \"0\" to disable prometheus push")
 	fs.StringVar(&cfg.LogFile, "log-file", "", "log file path")
+	fs.StringVar(&cfg.DiagnosticsAddr, "diagnostics-addr", "", "addr (i.e. 'host:port') to serve pprof and the dumps of the internal state on, leaves it empty will disable it; better bound to localhost")
 	fs.Int64Var(&cfg.InitialCommitTS, "initial-commit-ts", -1, "if drainer donesn't have checkpoint, use initial commitTS to initial checkpoint, will get a latest timestamp from pd if setting to be -1")
+	fs.Int64Var(&cfg.EndTS, "end-ts", 0, "apply the binlogs with commit ts <= end-ts, then save the checkpoint at end-ts and exit, 0 means no end")
 	fs.StringVar(&cfg.Compressor, "compressor", "", "use the specified compressor to compress payload between pump and drainer, only 'gzip' is supported now (default \"\", ie. compression disabled.)")
 	fs.IntVar(&cfg.SyncerCfg.TxnBatch, "txn-batch", 20, "number of binlog events in a transaction batch")
 	fs.StringVar(&cfg.SyncerCfg.IgnoreSchemas, "ignore-schemas", "INFORMATION_SCHEMA,PERFORMANCE_SCHEMA,mysql", "disable sync those schemas")
 	fs.IntVar(&cfg.SyncerCfg.WorkerCount, "c", 16, "parallel worker count")
-	fs.StringVar(&cfg.SyncerCfg.DestDBType, "dest-db-type", "mysql", "target db type: mysql or tidb or file or kafka; see syncer section in conf/drainer.toml")
+	fs.StringVar(&cfg.SyncerCfg.DestDBType, "dest-db-type", "mysql", "target db type: mysql or tidb or file or kafka or webhook; see syncer section in conf/drainer.toml")
 	fs.StringVar(&cfg.SyncerCfg.RelayLogDir, "relay-log-dir", "", "path to relay log of syncer")
 	fs.Int64Var(&cfg.SyncerCfg.RelayLogSize, "relay-log-size", 10*1024*1024, "max file size of each relay log")
 	fs.BoolVar(&cfg.SyncerCfg.EnableDispatch, "enable-dispatch", true, "enable dispatching sqls that in one same binlog; if set true, work-count and txn-batch would be useless")
@@ -154,6 +191,8 @@ func (cfg *Config) String() string {
 
 // Parse parses all config from command-line flags, environment vars or the configuration file
 func (cfg *Config) Parse(args []string) error {
+	cfg.args = args
+
 	// parse first to get config file
 	perr := cfg.FlagSet.Parse(args)
 	switch perr {
@@ -194,6 +233,13 @@ func (cfg *Config) Parse(args []string) error {
 		}
 	}
 
+	if cfg.SyncerCfg.To != nil {
+		cfg.SyncerCfg.TimeZone, err = util.ParseTimeZone(cfg.SyncerCfg.To.TimeZone)
+		if err != nil {
+			return errors.Annotate(err, "invalid config: `time-zone` must be a valid time zone")
+		}
+	}
+
 	cfg.tls, err = cfg.Security.ToTLSConfig()
 	if err != nil {
 		return errors.Errorf("tls config %+v error %v", cfg.Security, err)
@@ -204,11 +250,20 @@ func (cfg *Config) Parse(args []string) error {
 	}
 
 	initializeSaramaGlobalConfig()
-	return cfg.validate()
+	if err := cfg.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.printEffectiveConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			return errors.Trace(err)
+		}
+		os.Exit(0)
+	}
+	return nil
 }
 
 func (c *SyncerConfig) adjustWorkCount() {
-	if c.DestDBType == "file" || c.DestDBType == "kafka" {
+	if c.DestDBType == "file" || c.DestDBType == "kafka" || c.DestDBType == "webhook" {
 		c.EnableDispatch = false
 		c.WorkerCount = 1
 	} else if !c.EnableDispatch {
@@ -227,7 +282,7 @@ func (c *SyncerConfig) adjustDoDBAndTable() {
 }
 
 func (cfg *Config) configFromFile(path string) error {
-	return util.StrictDecodeFile(path, "drainer", cfg)
+	return config.Load(path, "drainer", cfg)
 }
 
 func (cfg *Config) validateFilter() error {
@@ -281,6 +336,20 @@ func (cfg *Config) validate() error {
 		return errors.Errorf("parse EtcdURLs error: %s, %v", cfg.EtcdURLs, err)
 	}
 
+	if cfg.EndTS < 0 {
+		return errors.Errorf("invalid end-ts: %d", cfg.EndTS)
+	}
+
+	if err := cfg.Probe.validate(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if cfg.DiagnosticsAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.DiagnosticsAddr); err != nil {
+			return errors.Annotatef(err, "invalid diagnostics-addr %s", cfg.DiagnosticsAddr)
+		}
+	}
+
 	if cfg.Compressor != "" {
 		found := false
 		for _, c := range supportedCompressors {
@@ -295,6 +364,164 @@ func (cfg *Config) validate() error {
 		}
 	}
 
+	if cfg.SyncerCfg.To != nil {
+		for _, addr := range cfg.SyncerCfg.To.FailoverAddrs {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return errors.Annotatef(err, "invalid failover-addrs %v", addr)
+			}
+		}
+
+		if err := secret.CheckPassword(cfg.SyncerCfg.To.Password, cfg.SyncerCfg.To.PasswordFrom); err != nil {
+			return errors.Annotate(err, "invalid syncer.to")
+		}
+		if err := secret.CheckPassword(cfg.SyncerCfg.To.Checkpoint.Password, cfg.SyncerCfg.To.Checkpoint.PasswordFrom); err != nil {
+			return errors.Annotate(err, "invalid syncer.to.checkpoint")
+		}
+
+		if cfg.SyncerCfg.To.OptimizeForTiDB && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`optimize-for-tidb` is only supported when db-type is tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.FencingLease > 0 && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`fencing-lease` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.ProbeCommit && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`probe-commit` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.DigestBatchSize > 0 && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`digest-batch-size` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.SplitWorkerCount > 0 && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`split-worker-count` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.PriorityTxnSize > 0 && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`priority-txn-size` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if len(cfg.SyncerCfg.To.AffectedRowsCheck) > 0 && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`affected-rows-check` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.CaptureGTID {
+			if cfg.SyncerCfg.DestDBType != "mysql" {
+				return errors.Errorf("`capture-gtid` is only supported when db-type is mysql, got %s", cfg.SyncerCfg.DestDBType)
+			}
+			// the GTID set is saved in the checkpoint table
+			switch tp := cfg.SyncerCfg.To.Checkpoint.Type; tp {
+			case "", "mysql", "tidb":
+			default:
+				return errors.Errorf("`capture-gtid` is only supported by the mysql or tidb checkpoint, got %s", tp)
+			}
+		}
+
+		if len(cfg.SyncerCfg.To.IsolationLevel) > 0 && cfg.SyncerCfg.DestDBType != "mysql" {
+			return errors.Errorf("`isolation-level` is only supported when db-type is mysql, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if len(cfg.SyncerCfg.To.OnSchemaMismatch) > 0 && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`on-schema-mismatch` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if len(cfg.SyncerCfg.To.GroupCommitSavepoint) > 0 && cfg.SyncerCfg.DestDBType != "mysql" {
+			return errors.Errorf("`group-commit-savepoint` is only supported when db-type is mysql, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if cfg.SyncerCfg.To.BulkImport && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+			return errors.Errorf("`bulk-import` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+		}
+
+		if err := cfg.SyncerCfg.To.ApplyConfig.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+
+		if cfg.SyncerCfg.To.Encryption != nil {
+			if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+				return errors.Errorf("`encryption` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+			}
+			if err := cfg.SyncerCfg.To.Encryption.Validate(); err != nil {
+				return errors.Annotate(err, "invalid encryption")
+			}
+		}
+
+		if cfg.SyncerCfg.To.Scrub != nil {
+			if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+				return errors.Errorf("`scrub` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+			}
+			if err := cfg.SyncerCfg.To.Scrub.Validate(); err != nil {
+				return errors.Annotate(err, "invalid scrub")
+			}
+		}
+
+		if cfg.SyncerCfg.SnapshotFrom != nil {
+			if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+				return errors.Errorf("`snapshot-from` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+			}
+			if cfg.SyncerCfg.To.Sharding != nil {
+				return errors.New("`snapshot-from` can't be used with `sharding`")
+			}
+			if len(cfg.SyncerCfg.SnapshotFrom.Host) == 0 || cfg.SyncerCfg.SnapshotFrom.Port <= 0 {
+				return errors.New("the host and port of `snapshot-from` must be set")
+			}
+		}
+
+		if cfg.SyncerCfg.DestDBType == "webhook" {
+			if cfg.SyncerCfg.To.Webhook == nil {
+				return errors.New("`[syncer.to.webhook]` must be set when db-type is webhook")
+			}
+			if err := cfg.SyncerCfg.To.Webhook.Validate(); err != nil {
+				return errors.Annotate(err, "invalid webhook")
+			}
+		}
+
+		if cfg.SyncerCfg.To.Sharding != nil {
+			if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+				return errors.Errorf("`sharding` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+			}
+			if len(cfg.SyncerCfg.RelayLogDir) > 0 {
+				return errors.New("`sharding` can't be used with `relay-log-dir`")
+			}
+			if cfg.SyncerCfg.DestructiveDDL == DestructiveDDLRecycle {
+				return errors.Errorf("`sharding` can't be used with destructive-ddl %s", DestructiveDDLRecycle)
+			}
+			if err := cfg.SyncerCfg.To.Sharding.Validate(); err != nil {
+				return errors.Annotate(err, "invalid sharding")
+			}
+		}
+	}
+
+	if !isValidPartitionDDLMode(cfg.SyncerCfg.PartitionDDL) {
+		return errors.Errorf("invalid partition-ddl: %s, must be one of %s, %s and %s",
+			cfg.SyncerCfg.PartitionDDL, PartitionDDLSync, PartitionDDLSkip, PartitionDDLTranslate)
+	}
+	if !isValidAutoRandomSequenceMode(cfg.SyncerCfg.AutoRandomSequence) {
+		return errors.Errorf("invalid auto-random-sequence: %s, must be %s or %s",
+			cfg.SyncerCfg.AutoRandomSequence, AutoRandomSequenceReject, AutoRandomSequenceStrip)
+	}
+	if !isValidTiDBDDLSyntaxMode(cfg.SyncerCfg.TiDBDDLSyntax) {
+		return errors.Errorf("invalid tidb-ddl-syntax: %s, must be one of %s, %s and %s",
+			cfg.SyncerCfg.TiDBDDLSyntax, TiDBDDLSyntaxSync, TiDBDDLSyntaxStrip, TiDBDDLSyntaxSkip)
+	}
+	if !isValidDestructiveDDLMode(cfg.SyncerCfg.DestructiveDDL) {
+		return errors.Errorf("invalid destructive-ddl: %s, must be one of %s, %s and %s",
+			cfg.SyncerCfg.DestructiveDDL, DestructiveDDLReplicate, DestructiveDDLSkip, DestructiveDDLRecycle)
+	}
+	if cfg.SyncerCfg.DestructiveDDL == DestructiveDDLRecycle && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("`destructive-ddl = recycle` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+	}
+	if cfg.SyncerCfg.TxnRateLimit < 0 {
+		return errors.Errorf("invalid txn-rate-limit: %d, can't be negative", cfg.SyncerCfg.TxnRateLimit)
+	}
+	if cfg.SyncerCfg.RecycleGracePeriod < 0 {
+		return errors.Errorf("invalid recycle-grace-period: %d, can't be negative", cfg.SyncerCfg.RecycleGracePeriod)
+	}
+	if cfg.SyncerCfg.PartitionDDL == PartitionDDLTranslate && cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("`partition-ddl = translate` is only supported when db-type is mysql or tidb, got %s", cfg.SyncerCfg.DestDBType)
+	}
+
 	return cfg.validateFilter()
 }
 
@@ -306,6 +533,11 @@ func (cfg *Config) adjustConfig() error {
 	cfg.AdvertiseAddr = "http://" + cfg.AdvertiseAddr // add 'http:' scheme to facilitate parsing
 	util.AdjustString(&cfg.DataDir, defaultDataDir)
 	util.AdjustInt(&cfg.DetectInterval, defaultDetectInterval)
+	util.AdjustString(&cfg.SyncerCfg.PartitionDDL, PartitionDDLSync)
+	util.AdjustString(&cfg.SyncerCfg.AutoRandomSequence, AutoRandomSequenceReject)
+	util.AdjustString(&cfg.SyncerCfg.TiDBDDLSyntax, TiDBDDLSyntaxSync)
+	util.AdjustString(&cfg.SyncerCfg.DestructiveDDL, DestructiveDDLReplicate)
+	util.AdjustString(&cfg.SyncerCfg.RecycleSchema, defaultRecycleSchema)
 
 	// add default syncer.to configuration if need
 	if cfg.SyncerCfg.To == nil {
@@ -378,7 +610,7 @@ func (cfg *Config) adjustConfig() error {
 			}
 			cfg.SyncerCfg.To.User = user
 		}
-		if len(cfg.SyncerCfg.To.Password) == 0 {
+		if len(cfg.SyncerCfg.To.Password) == 0 && cfg.SyncerCfg.To.PasswordFrom == nil {
 			cfg.SyncerCfg.To.Password = os.Getenv("MYSQL_PSWD")
 		}
 	}
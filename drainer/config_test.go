@@ -15,6 +15,7 @@ package drainer
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"path"
 	"testing"
@@ -24,7 +25,9 @@ import (
 	. "github.com/pingcap/check"
 	"github.com/pingcap/parser/mysql"
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/encrypt"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	pkgzk "github.com/pingcap/tidb-binlog/pkg/zk"
 	"github.com/samuel/go-zookeeper/zk"
@@ -131,6 +134,23 @@ func (t *testDrainerSuite) TestValidate(c *C) {
 	cfg.Compressor = "gzip"
 	err = cfg.validate()
 	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.PartitionDDL = "drop"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid partition-ddl.*")
+
+	cfg.SyncerCfg.PartitionDDL = PartitionDDLTranslate
+	cfg.SyncerCfg.DestDBType = "kafka"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*only supported when db-type is mysql or tidb.*")
+
+	cfg.SyncerCfg.DestDBType = "mysql"
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.AutoRandomSequence = "keep"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid auto-random-sequence.*")
 }
 
 func (t *testDrainerSuite) TestAdjustConfig(c *C) {
@@ -160,6 +180,202 @@ func (t *testDrainerSuite) TestAdjustConfig(c *C) {
 	c.Assert(cfg.AdvertiseAddr, Equals, "http://192.168.15.12:8257")
 }
 
+func (t *testDrainerSuite) TestConfigTimeZone(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_tz.toml")
+	writeTimeZone := func(tz string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"mysql\"\n[syncer.to]\ntime-zone = \"%s\"\n", tz)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeTimeZone("+05:30")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.TimeZone, Equals, "+05:30")
+	_, offset := time.Now().In(cfg.SyncerCfg.TimeZone).Zone()
+	c.Assert(offset, Equals, 5*3600+30*60)
+
+	writeTimeZone("+5:30")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*`time-zone` must be a valid time zone.*")
+}
+
+func (t *testDrainerSuite) TestConfigMask(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_mask.toml")
+	content := "[mask]\nhash-over = 32\n[[mask.rule]]\ndb-name = \"test\"\ntbl-name = \"user\"\ncolumn = \"email\"\n"
+	err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+	c.Assert(err, IsNil)
+
+	cfg := NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Mask, DeepEquals, &mask.Config{
+		Rules:    []mask.Rule{{Schema: "test", Table: "user", Column: "email"}},
+		HashOver: 32,
+	})
+}
+
+func (t *testDrainerSuite) TestConfigEncryption(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_encryption.toml")
+	writeConfig := func(dbType string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"%s\"\n[syncer.to.encryption]\nkey-env = \"KEY\"\n"+
+			"[[syncer.to.encryption.column]]\ndb-name = \"test\"\ntbl-name = \"user\"\ncolumn = \"email\"\n", dbType)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("mysql")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.Encryption, DeepEquals, &encrypt.Config{
+		Rules:  []encrypt.Rule{{Schema: "test", Table: "user", Column: "email"}},
+		KeyEnv: "KEY",
+	})
+
+	writeConfig("file")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*`encryption` is only supported when db-type is mysql or tidb.*")
+}
+
+func (t *testDrainerSuite) TestConfigWebhook(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_webhook.toml")
+	writeConfig := func(url string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"webhook\"\n[syncer.to.webhook]\nurl = \"%s\"\n"+
+			"[[syncer.to.webhook.rule]]\ndb-name = \"test\"\nops = [\"insert\"]\n", url)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("http://127.0.0.1:8080/hook")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.Webhook.Rules, HasLen, 1)
+	c.Assert(cfg.SyncerCfg.WorkerCount, Equals, 1)
+
+	writeConfig("127.0.0.1:8080")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*invalid webhook.*")
+}
+
+func (t *testDrainerSuite) TestConfigOptimizeForTiDB(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_tidb.toml")
+	writeConfig := func(dbType string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"%s\"\n[syncer.to]\noptimize-for-tidb = true\n", dbType)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("tidb")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.OptimizeForTiDB, IsTrue)
+
+	writeConfig("mysql")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*`optimize-for-tidb` is only supported when db-type is tidb.*")
+}
+
+func (t *testDrainerSuite) TestConfigGroupCommitSavepoint(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_savepoint.toml")
+	writeConfig := func(dbType string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"%s\"\n[syncer.to]\ngroup-commit-size = 100\ngroup-commit-savepoint = \"quarantine\"\n", dbType)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("mysql")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.GroupCommitSavepoint, Equals, "quarantine")
+
+	writeConfig("tidb")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*`group-commit-savepoint` is only supported when db-type is mysql.*")
+}
+
+func (t *testDrainerSuite) TestConfigAffectedRowsCheck(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_rows_check.toml")
+	writeConfig := func(dbType string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"%s\"\n[syncer.to]\naffected-rows-check = \"safe-mode\"\n", dbType)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("tidb")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.AffectedRowsCheck, Equals, "safe-mode")
+
+	writeConfig("file")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*`affected-rows-check` is only supported when db-type is mysql or tidb.*")
+}
+
+func (t *testDrainerSuite) TestConfigEndTS(c *C) {
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-end-ts", "418000000000000000"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.EndTS, Equals, int64(418000000000000000))
+
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-end-ts", "-1"})
+	c.Assert(err, ErrorMatches, ".*invalid end-ts.*")
+}
+
+func (t *testDrainerSuite) TestConfigFencingLease(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_fencing.toml")
+	writeConfig := func(dbType string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"%s\"\n[syncer.to]\nfencing-lease = 30\nfencing-name = \"dc1\"\n", dbType)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("mysql")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.FencingLease, Equals, 30)
+	c.Assert(cfg.SyncerCfg.To.FencingName, Equals, "dc1")
+
+	writeConfig("kafka")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*`fencing-lease` is only supported when db-type is mysql or tidb.*")
+}
+
+func (t *testDrainerSuite) TestConfigPasswordFrom(c *C) {
+	configFilename := path.Join(c.MkDir(), "drainer_config_password.toml")
+	writeConfig := func(password string) {
+		content := fmt.Sprintf("[syncer]\ndb-type = \"mysql\"\n[syncer.to]\npassword = \"%s\"\n[syncer.to.password-from]\nenv = \"DRAINER_PSWD\"\n", password)
+		err := ioutil.WriteFile(configFilename, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	writeConfig("")
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.PasswordFrom.Env, Equals, "DRAINER_PSWD")
+	c.Assert(cfg.SyncerCfg.To.Password, Equals, "")
+
+	writeConfig("plaintext")
+	cfg = NewConfig()
+	err = cfg.Parse([]string{"-config", configFilename})
+	c.Assert(err, ErrorMatches, ".*password and password-from can't be both set.*")
+}
+
 func (t *testDrainerSuite) TestConfigParsingFileWithInvalidOptions(c *C) {
 	yc := struct {
 		DataDir                string `toml:"data-dir" json:"data-dir"`
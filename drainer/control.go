@@ -0,0 +1,180 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/siddontang/go/ioutil2"
+	"go.uber.org/zap"
+)
+
+// syncerControlFile is the file name in data-dir to save the syncer control
+const syncerControlFile = "syncer_control"
+
+// SyncerControlState is the state of the admin operations on the syncer.
+type SyncerControlState struct {
+	Paused bool `toml:"paused" json:"paused"`
+	// skip the next SkipCount binlogs
+	SkipCount int64 `toml:"skip-count" json:"skip-count"`
+	// skip the binlogs whose commit ts <= SkipUntilTS
+	SkipUntilTS int64 `toml:"skip-until-ts" json:"skip-until-ts"`
+	// the commit ts of the binlogs skipped by SkipCount but not covered by the checkpoint yet,
+	// they're skipped again when replayed from the checkpoint after restarting
+	SkippedTS []int64 `toml:"skipped-ts" json:"skipped-ts"`
+}
+
+// SyncerControl holds the admin operations on the syncer, like pausing and skipping binlogs,
+// the state is saved in a file so that the operations survive restarts.
+type SyncerControl struct {
+	mu     sync.Mutex
+	name   string
+	pauser util.Pauser
+	state  SyncerControlState
+}
+
+// NewSyncerControl loads the syncer control saved in the file.
+func NewSyncerControl(name string) (*SyncerControl, error) {
+	ctl := &SyncerControl{name: name}
+
+	_, err := toml.DecodeFile(name, &ctl.state)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Annotatef(err, "load syncer control from %s failed", name)
+	}
+
+	if ctl.state.Paused {
+		log.Info("syncer is paused by the saved control, resume it if needed", zap.String("file", name))
+		ctl.pauser.Pause()
+	}
+
+	return ctl, nil
+}
+
+// Pause pauses syncing binlogs to downstream.
+func (c *SyncerControl) Pause() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Paused = true
+	c.pauser.Pause()
+	return errors.Trace(c.save())
+}
+
+// Resume resumes syncing binlogs to downstream.
+func (c *SyncerControl) Resume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Paused = false
+	c.pauser.Resume()
+	return errors.Trace(c.save())
+}
+
+// Skip skips the next `count` binlogs, and the binlogs whose commit ts <= `untilTS`.
+func (c *SyncerControl) Skip(count int64, untilTS int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.SkipCount = count
+	c.state.SkipUntilTS = untilTS
+	c.state.SkippedTS = nil
+	return errors.Trace(c.save())
+}
+
+// State returns the current state.
+func (c *SyncerControl) State() SyncerControlState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.state
+	state.SkippedTS = append([]int64(nil), c.state.SkippedTS...)
+	return state
+}
+
+// wait blocks while the syncer is paused.
+func (c *SyncerControl) wait(ctx context.Context) error {
+	return c.pauser.Wait(ctx)
+}
+
+// resumed returns a channel closed when the syncer is resumed, it's already closed if not paused.
+func (c *SyncerControl) resumed() <-chan struct{} {
+	return c.pauser.Resumed()
+}
+
+// shouldSkip returns true if the binlog with commitTS should be skipped. The commit ts of the binlogs skipped by
+// the count are saved together with the count decremented, so they, rather than the binlogs before them,
+// are skipped again when replayed after restarting.
+func (c *SyncerControl) shouldSkip(commitTS int64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if commitTS <= c.state.SkipUntilTS {
+		return true, nil
+	}
+
+	for _, ts := range c.state.SkippedTS {
+		if ts == commitTS {
+			return true, nil
+		}
+	}
+
+	if c.state.SkipCount > 0 {
+		c.state.SkipCount--
+		c.state.SkippedTS = append(c.state.SkippedTS, commitTS)
+		return true, errors.Trace(c.save())
+	}
+
+	return false, nil
+}
+
+// checkpointed forgets the binlogs skipped whose commit ts <= the checkpoint ts, as they're never replayed.
+func (c *SyncerControl) checkpointed(ts int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kept := c.state.SkippedTS[:0]
+	for _, skipped := range c.state.SkippedTS {
+		if skipped > ts {
+			kept = append(kept, skipped)
+		}
+	}
+	if len(kept) == len(c.state.SkippedTS) {
+		return nil
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	c.state.SkippedTS = kept
+	return errors.Trace(c.save())
+}
+
+func (c *SyncerControl) save() error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(c.state); err != nil {
+		return errors.Annotate(err, "encode syncer control failed")
+	}
+
+	if err := ioutil2.WriteFileAtomic(c.name, buf.Bytes(), 0644); err != nil {
+		return errors.Annotatef(err, "write file %s failed", c.name)
+	}
+
+	return nil
+}
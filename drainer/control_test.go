@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type syncerControlSuite struct{}
+
+var _ = check.Suite(&syncerControlSuite{})
+
+func (s *syncerControlSuite) TestPauseAndResume(c *check.C) {
+	name := path.Join(c.MkDir(), syncerControlFile)
+	ctl, err := NewSyncerControl(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.wait(context.Background()), check.IsNil)
+	<-ctl.resumed()
+
+	err = ctl.Pause()
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.State().Paused, check.IsTrue)
+
+	// the state survives restarts
+	ctl, err = NewSyncerControl(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.State().Paused, check.IsTrue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(ctl.wait(ctx), check.NotNil)
+	resumed := ctl.resumed()
+	select {
+	case <-resumed:
+		c.Fatal("resumed while paused")
+	default:
+	}
+
+	err = ctl.Resume()
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.wait(context.Background()), check.IsNil)
+	<-resumed
+
+	ctl, err = NewSyncerControl(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.State().Paused, check.IsFalse)
+}
+
+func (s *syncerControlSuite) TestSkip(c *check.C) {
+	name := path.Join(c.MkDir(), syncerControlFile)
+	ctl, err := NewSyncerControl(name)
+	c.Assert(err, check.IsNil)
+
+	skip, err := ctl.shouldSkip(1)
+	c.Assert(err, check.IsNil)
+	c.Assert(skip, check.IsFalse)
+
+	err = ctl.Skip(2, 10)
+	c.Assert(err, check.IsNil)
+
+	// skipped by until ts, the count is not consumed
+	skip, err = ctl.shouldSkip(10)
+	c.Assert(err, check.IsNil)
+	c.Assert(skip, check.IsTrue)
+	c.Assert(ctl.State().SkipCount, check.Equals, int64(2))
+
+	skip, err = ctl.shouldSkip(11)
+	c.Assert(err, check.IsNil)
+	c.Assert(skip, check.IsTrue)
+
+	// the remaining count and the binlog skipped survive restarts
+	ctl, err = NewSyncerControl(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.State(), check.DeepEquals, SyncerControlState{SkipCount: 1, SkipUntilTS: 10, SkippedTS: []int64{11}})
+
+	// the binlog skipped is skipped again when replayed, without consuming the count
+	skip, err = ctl.shouldSkip(11)
+	c.Assert(err, check.IsNil)
+	c.Assert(skip, check.IsTrue)
+	c.Assert(ctl.State().SkipCount, check.Equals, int64(1))
+
+	// forgotten after the checkpoint passes it
+	c.Assert(ctl.checkpointed(11), check.IsNil)
+	ctl, err = NewSyncerControl(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(ctl.State(), check.DeepEquals, SyncerControlState{SkipCount: 1, SkipUntilTS: 10})
+
+	skip, err = ctl.shouldSkip(12)
+	c.Assert(err, check.IsNil)
+	c.Assert(skip, check.IsTrue)
+
+	skip, err = ctl.shouldSkip(13)
+	c.Assert(err, check.IsNil)
+	c.Assert(skip, check.IsFalse)
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/parser/model"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+)
+
+// the modes of handling the DROP TABLE and TRUNCATE TABLE DDLs, see SyncerConfig.DestructiveDDL
+const (
+	// DestructiveDDLReplicate executes the DDLs in downstream as they are
+	DestructiveDDLReplicate = "replicate"
+	// DestructiveDDLSkip skips the DDLs, the tables and their rows are kept in downstream
+	DestructiveDDLSkip = "skip"
+	// DestructiveDDLRecycle moves the tables dropped or truncated to the recycle schema in downstream instead, a new
+	// empty table of the same definition is created for the truncated ones, only for mysql/tidb
+	DestructiveDDLRecycle = "recycle"
+
+	defaultRecycleSchema = "tidb_binlog_recycle"
+	// the max length of the table names of mysql
+	maxTableNameLen = 64
+)
+
+func isValidDestructiveDDLMode(mode string) bool {
+	switch mode {
+	case "", DestructiveDDLReplicate, DestructiveDDLSkip, DestructiveDDLRecycle:
+		return true
+	}
+	return false
+}
+
+func isDestructiveDDL(tp model.ActionType) bool {
+	return tp == model.ActionDropTable || tp == model.ActionTruncateTable
+}
+
+// recycledTableName returns the name of the table in the recycle schema, suffixed by the commit ts of the DDL
+// so the tables of the same name dropped at different times are all kept
+func recycledTableName(table string, commitTS int64) string {
+	suffix := fmt.Sprintf("_%d", commitTS)
+	if len(table)+len(suffix) > maxTableNameLen {
+		table = table[:maxTableNameLen-len(suffix)]
+	}
+	return table + suffix
+}
+
+// recycleDDL returns the statements moving the table dropped or truncated by the DDL to the recycle schema
+func recycleDDL(recycleSchema string, tp model.ActionType, schema string, table string, commitTS int64) string {
+	recycled := pkgsql.QuoteSchema(recycleSchema, recycledTableName(table, commitTS))
+	stmts := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", pkgsql.QuoteName(recycleSchema)),
+		fmt.Sprintf("RENAME TABLE %s TO %s", pkgsql.QuoteSchema(schema, table), recycled),
+	}
+	if tp == model.ActionTruncateTable {
+		stmts = append(stmts, fmt.Sprintf("CREATE TABLE %s LIKE %s", pkgsql.QuoteSchema(schema, table), recycled))
+	}
+	return strings.Join(stmts, "; ")
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+)
+
+type destructiveDDLSuite struct{}
+
+var _ = Suite(&destructiveDDLSuite{})
+
+func (s *destructiveDDLSuite) TestRecycledTableName(c *C) {
+	c.Assert(recycledTableName("t", 415), Equals, "t_415")
+	name := recycledTableName(strings.Repeat("a", 64), 415)
+	c.Assert(name, HasLen, 64)
+	c.Assert(strings.HasSuffix(name, "a_415"), IsTrue)
+}
+
+func (s *destructiveDDLSuite) TestRewriteDDL(c *C) {
+	drop := &model.Job{Type: model.ActionDropTable, Query: "drop table t"}
+	truncate := &model.Job{Type: model.ActionTruncateTable, Query: "truncate table t"}
+	create := &model.Job{Type: model.ActionCreateTable, Query: "create table t (id int)"}
+
+	syncer := &Syncer{cfg: &SyncerConfig{DestDBType: "mysql", DestructiveDDL: DestructiveDDLReplicate}}
+	for _, job := range []*model.Job{drop, truncate, create} {
+		sql, err := syncer.rewriteDDL(job, "test", "t", nil, 10)
+		c.Assert(err, IsNil)
+		c.Assert(sql, Equals, job.Query)
+	}
+
+	syncer.cfg.DestructiveDDL = DestructiveDDLSkip
+	sql, err := syncer.rewriteDDL(drop, "test", "t", nil, 10)
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "")
+	sql, err = syncer.rewriteDDL(create, "test", "t", nil, 10)
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, create.Query)
+
+	syncer.cfg.DestructiveDDL = DestructiveDDLRecycle
+	syncer.cfg.RecycleSchema = "recycle"
+	sql, err = syncer.rewriteDDL(drop, "test", "t", nil, 10)
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "CREATE DATABASE IF NOT EXISTS `recycle`; RENAME TABLE `test`.`t` TO `recycle`.`t_10`")
+	sql, err = syncer.rewriteDDL(truncate, "test", "t", nil, 10)
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "CREATE DATABASE IF NOT EXISTS `recycle`; RENAME TABLE `test`.`t` TO `recycle`.`t_10`; "+
+		"CREATE TABLE `test`.`t` LIKE `recycle`.`t_10`")
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+// DiagnosticState is the internal state of drainer returned by `GET /debug/state` of the diagnostics addr
+type DiagnosticState struct {
+	// the number of the items in each queue, by the same names as the queue size metrics
+	Queues       map[string]int `json:"queues"`
+	CheckpointTS int64          `json:"checkpoint-ts"`
+	AppliedTS    int64          `json:"applied-ts"`
+	// the commit ts of the oldest txn buffered by the loader but not applied yet, 0 if there's none
+	OldestBufferedTS int64 `json:"oldest-buffered-ts"`
+	// how long none of the binlogs pending is applied, see /healthz
+	StalledSeconds float64              `json:"stalled-seconds"`
+	Tables         []loader.TableStatus `json:"tables"`
+	Goroutines     int                  `json:"goroutines"`
+}
+
+func (s *Server) diagnosticState() DiagnosticState {
+	state := DiagnosticState{
+		Queues:         map[string]int{"syncer_input": len(s.syncer.input)},
+		StalledSeconds: s.syncer.progress.stalled().Seconds(),
+		Goroutines:     runtime.NumGoroutine(),
+	}
+	if s.syncer.cp != nil {
+		state.CheckpointTS = s.syncer.cp.TS()
+	}
+	if s.syncer.watermark != nil {
+		state.AppliedTS = s.syncer.watermark.TS()
+	}
+	if mysqlSyncer, ok := s.syncer.dsyncer.(*dsync.MysqlSyncer); ok {
+		state.Queues["loader_input"], state.Queues["loader_successes"] = mysqlSyncer.QueueSizes()
+		state.OldestBufferedTS = mysqlSyncer.Watermark().MinUnappliedTS
+		state.Tables = mysqlSyncer.TableStatus()
+	}
+	return state
+}
+
+// startDiagnostics serves pprof, the dumps of the profiles and the internal state on the diagnostics-addr,
+// the profiles are dumped into the `diagnostics` directory of data-dir.
+func (s *Server) startDiagnostics() error {
+	if s.cfg.DiagnosticsAddr == "" {
+		return nil
+	}
+	mux := util.NewDiagnosticsMux(filepath.Join(s.cfg.DataDir, "diagnostics"), func() interface{} {
+		return s.diagnosticState()
+	})
+	s.diagnostics = &http.Server{Addr: s.cfg.DiagnosticsAddr, Handler: mux}
+	lis, err := net.Listen("tcp", s.cfg.DiagnosticsAddr)
+	if err != nil {
+		return errors.Annotatef(err, "fail to listen on diagnostics-addr %s", s.cfg.DiagnosticsAddr)
+	}
+	go func() {
+		if err := s.diagnostics.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Error("diagnostics server stopped", zap.Error(err))
+		}
+	}()
+	log.Info("start to serve diagnostics", zap.String("addr", s.cfg.DiagnosticsAddr))
+	return nil
+}
@@ -94,6 +94,31 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 18),
 		}, []string{"type"})
 
+	conflictCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "conflict_count",
+			Help:      "the count of deadlock, lock wait timeout and write conflict errors in downstream.",
+		}, []string{"type"})
+
+	txnLatencyHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "txn_latency_seconds",
+			Help:      "Bucketed histogram of seconds of a txn between committed at upstream and committed at downstream.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 22),
+		})
+
+	driftCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "drift_count",
+			Help:      "the count of updates and deletes not affecting exactly one row in downstream.",
+		}, []string{"type"})
+
 	binlogReachDurationHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -119,6 +144,14 @@ var (
 			Name:      "queue_size",
 			Help:      "the size of queue",
 		}, []string{"name"})
+
+	replicationLagGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "replication_lag_seconds",
+			Help:      "the time elapsed since the commit ts of the last binlog applied to downstream",
+		})
 )
 
 var registry = prometheus.NewRegistry()
@@ -136,7 +169,11 @@ func init() {
 	registry.MustRegister(binlogReachDurationHistogram)
 	registry.MustRegister(readBinlogSizeHistogram)
 	registry.MustRegister(queryHistogramVec)
+	registry.MustRegister(conflictCounter)
+	registry.MustRegister(driftCounter)
+	registry.MustRegister(txnLatencyHistogram)
 	registry.MustRegister(queueSizeGauge)
+	registry.MustRegister(replicationLagGauge)
 
 	// for pb using it
 	bf.InitMetircs(registry)
@@ -0,0 +1,200 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// the modes of handling the partition DDLs, see SyncerConfig.PartitionDDL
+const (
+	// PartitionDDLSync executes the partition DDLs in downstream as they are
+	PartitionDDLSync = "sync"
+	// PartitionDDLSkip skips the partition management DDLs, e.g., ADD/DROP/TRUNCATE/EXCHANGE PARTITION,
+	// for the downstream tables which aren't partitioned
+	PartitionDDLSkip = "skip"
+	// PartitionDDLTranslate translates the partition DDLs for the downstream not supporting partitioning,
+	// the partitions are removed from CREATE TABLE, the rows of the dropped or truncated partitions are
+	// deleted by a DELETE statement, and the DDLs not changing the rows are skipped
+	PartitionDDLTranslate = "translate"
+)
+
+func isValidPartitionDDLMode(mode string) bool {
+	switch mode {
+	case "", PartitionDDLSync, PartitionDDLSkip, PartitionDDLTranslate:
+		return true
+	}
+	return false
+}
+
+var partitionSpecTypes = map[ast.AlterTableType]struct{}{
+	ast.AlterTableAddPartitions:              {},
+	ast.AlterTableCoalescePartitions:         {},
+	ast.AlterTableDropPartition:              {},
+	ast.AlterTableTruncatePartition:          {},
+	ast.AlterTablePartition:                  {},
+	ast.AlterTableRemovePartitioning:         {},
+	ast.AlterTableRebuildPartition:           {},
+	ast.AlterTableReorganizePartition:        {},
+	ast.AlterTableCheckPartitions:            {},
+	ast.AlterTableExchangePartition:          {},
+	ast.AlterTableOptimizePartition:          {},
+	ast.AlterTableRepairPartition:            {},
+	ast.AlterTableImportPartitionTablespace:  {},
+	ast.AlterTableDiscardPartitionTablespace: {},
+}
+
+// partitionSpec returns the spec of the ALTER TABLE statement managing the partitions, nil if it's not
+func partitionSpec(stmt *ast.AlterTableStmt) *ast.AlterTableSpec {
+	if len(stmt.Specs) != 1 {
+		return nil
+	}
+	if _, ok := partitionSpecTypes[stmt.Specs[0].Tp]; !ok {
+		return nil
+	}
+	return stmt.Specs[0]
+}
+
+// translatePartitionDDL returns the statement executed in downstream for the DDL of the table by the mode,
+// empty if the DDL is skipped. old is the table info before the DDL, the rows of the dropped partitions are
+// found by its partition definitions.
+func translatePartitionDDL(mode string, sqlMode mysql.SQLMode, sql string, schema string, table string, old *model.TableInfo) (string, error) {
+	if mode == PartitionDDLSync || len(mode) == 0 {
+		return sql, nil
+	}
+
+	p := parser.New()
+	p.SetSQLMode(sqlMode)
+	stmt, err := p.ParseOneStmt(sql, "", "")
+	if err != nil {
+		// e.g., the DDLs of the features newer than the parser, they're not partition DDLs
+		log.Warn("parse ddl failed, execute it as it is", zap.String("sql", sql), zap.Error(err))
+		return sql, nil
+	}
+
+	switch stmt := stmt.(type) {
+	case *ast.CreateTableStmt:
+		if stmt.Partition == nil || mode != PartitionDDLTranslate {
+			return sql, nil
+		}
+		stmt.Partition = nil
+		builder := new(strings.Builder)
+		if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, builder)); err != nil {
+			return "", errors.Annotatef(err, "restore ddl %s", sql)
+		}
+		return builder.String(), nil
+
+	case *ast.AlterTableStmt:
+		spec := partitionSpec(stmt)
+		if spec == nil {
+			return sql, nil
+		}
+		if mode == PartitionDDLSkip {
+			return "", nil
+		}
+
+		switch spec.Tp {
+		case ast.AlterTableDropPartition, ast.AlterTableTruncatePartition:
+			return deletePartitionsSQL(schema, table, old, spec.PartitionNames)
+		case ast.AlterTableExchangePartition:
+			return "", errors.Errorf("can't translate %s, the rows exchanged are unknown to drainer, set `partition-ddl` to sync or skip", sql)
+		default:
+			// the rows are kept by the other partition DDLs
+			return "", nil
+		}
+	}
+
+	return sql, nil
+}
+
+// deletePartitionsSQL returns the DELETE statement deleting the rows of the partitions
+func deletePartitionsSQL(schema string, table string, old *model.TableInfo, names []model.CIStr) (string, error) {
+	if old == nil || old.Partition == nil {
+		return "", errors.NotFoundf("partitions of table %s.%s", schema, table)
+	}
+
+	conds := make([]string, 0, len(names))
+	for _, name := range names {
+		cond, err := partitionCondition(old.Partition, name)
+		if err != nil {
+			return "", errors.Annotatef(err, "table %s.%s", schema, table)
+		}
+		conds = append(conds, "("+cond+")")
+	}
+
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", pkgsql.QuoteSchema(schema, table), strings.Join(conds, " OR ")), nil
+}
+
+// partitionCondition returns the condition of the rows in the partition, by the partitioning of TiDB:
+// the NULL values are put in the first partition, and the partition of HASH is ABS(MOD(expr, num)).
+func partitionCondition(pi *model.PartitionInfo, name model.CIStr) (string, error) {
+	idx := -1
+	for i, def := range pi.Definitions {
+		if def.Name.L == name.L {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return "", errors.NotFoundf("partition %s", name)
+	}
+
+	expr := pi.Expr
+	if len(expr) == 0 {
+		if len(pi.Columns) != 1 {
+			return "", errors.Errorf("partitioning by %d columns is not supported", len(pi.Columns))
+		}
+		expr = pkgsql.QuoteName(pi.Columns[0].O)
+	}
+	expr = "(" + expr + ")"
+
+	var conds []string
+	switch pi.Type {
+	case model.PartitionTypeRange:
+		if idx > 0 {
+			conds = append(conds, fmt.Sprintf("%s >= %s", expr, pi.Definitions[idx-1].LessThan[0]))
+		}
+		if upper := pi.Definitions[idx].LessThan[0]; !strings.EqualFold(upper, "MAXVALUE") {
+			conds = append(conds, fmt.Sprintf("%s < %s", expr, upper))
+		}
+	case model.PartitionTypeHash:
+		num := pi.Num
+		if num == 0 {
+			num = uint64(len(pi.Definitions))
+		}
+		conds = append(conds, fmt.Sprintf("ABS(MOD(%s, %d)) = %d", expr, num, idx))
+	default:
+		return "", errors.Errorf("partitioning by %s is not supported", pi.Type)
+	}
+
+	cond := "TRUE"
+	if len(conds) > 0 {
+		cond = strings.Join(conds, " AND ")
+	}
+	if idx == 0 {
+		cond = fmt.Sprintf("%s OR %s IS NULL", cond, expr)
+	}
+	return cond, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+)
+
+type partitionSuite struct{}
+
+var _ = Suite(&partitionSuite{})
+
+func (s *partitionSuite) TestTranslatePartitionDDL(c *C) {
+	old := &model.TableInfo{Partition: &model.PartitionInfo{
+		Type: model.PartitionTypeRange,
+		Expr: "`id`",
+		Definitions: []model.PartitionDefinition{
+			{Name: model.NewCIStr("p0"), LessThan: []string{"10"}},
+			{Name: model.NewCIStr("p1"), LessThan: []string{"20"}},
+			{Name: model.NewCIStr("p2"), LessThan: []string{"MAXVALUE"}},
+		},
+	}}
+
+	tests := []struct {
+		mode   string
+		ddl    string
+		expect string
+		isErr  bool
+	}{
+		{PartitionDDLSync, "alter table t drop partition p0", "alter table t drop partition p0", false},
+		{PartitionDDLSkip, "alter table t drop partition p0", "", false},
+		{PartitionDDLSkip, "alter table t add partition (partition p3 values less than (30))", "", false},
+		{PartitionDDLSkip, "alter table t add column c int", "alter table t add column c int", false},
+		{PartitionDDLSkip, "create table t (id int) partition by hash(id) partitions 4", "create table t (id int) partition by hash(id) partitions 4", false},
+		{PartitionDDLTranslate, "create table t (id int) partition by hash(id) partitions 4", "CREATE TABLE `t` (`id` INT)", false},
+		{PartitionDDLTranslate, "alter table t add partition (partition p3 values less than (30))", "", false},
+		{PartitionDDLTranslate, "alter table t drop partition p0", "DELETE FROM `test`.`t` WHERE ((`id`) < 10 OR (`id`) IS NULL)", false},
+		{PartitionDDLTranslate, "alter table t truncate partition p1, p2", "DELETE FROM `test`.`t` WHERE ((`id`) >= 10 AND (`id`) < 20) OR ((`id`) >= 20)", false},
+		{PartitionDDLTranslate, "alter table t drop partition p9", "", true},
+		{PartitionDDLTranslate, "alter table t exchange partition p0 with table t2", "", true},
+	}
+
+	for _, test := range tests {
+		sql, err := translatePartitionDDL(test.mode, mysql.ModeNone, test.ddl, "test", "t", old)
+		c.Assert(err != nil, Equals, test.isErr, Commentf("%s: %v", test.ddl, err))
+		c.Assert(sql, Equals, test.expect, Commentf("%s", test.ddl))
+	}
+}
+
+func (s *partitionSuite) TestHashPartitionCondition(c *C) {
+	pi := &model.PartitionInfo{
+		Type: model.PartitionTypeHash,
+		Expr: "year(`d`)",
+		Definitions: []model.PartitionDefinition{
+			{Name: model.NewCIStr("p0")},
+			{Name: model.NewCIStr("p1")},
+		},
+	}
+
+	cond, err := partitionCondition(pi, model.NewCIStr("P1"))
+	c.Assert(err, IsNil)
+	c.Assert(cond, Equals, "ABS(MOD((year(`d`)), 2)) = 1")
+
+	cond, err = partitionCondition(pi, model.NewCIStr("p0"))
+	c.Assert(err, IsNil)
+	c.Assert(cond, Equals, "ABS(MOD((year(`d`)), 2)) = 0 OR (year(`d`)) IS NULL")
+}
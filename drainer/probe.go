@@ -0,0 +1,139 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+)
+
+// the timeout of checking the connection to downstream by /readyz
+var downstreamPingTimeout = 3 * time.Second
+
+// ProbeConfig is the thresholds of the Kubernetes probes of drainer, /readyz and /healthz
+type ProbeConfig struct {
+	// in seconds, /readyz responds 503 when the replication lag exceeds it, 0 means the critical-seconds of lag-slo
+	ReadyLagSeconds int `toml:"ready-lag-seconds" json:"ready-lag-seconds"`
+	// in seconds, /healthz responds 503 when none of the binlogs added to downstream is applied for it,
+	// 0 means disabled
+	StuckSeconds int `toml:"stuck-seconds" json:"stuck-seconds"`
+}
+
+func (c *ProbeConfig) validate() error {
+	if c.ReadyLagSeconds < 0 {
+		return errors.Errorf("invalid probe.ready-lag-seconds %d", c.ReadyLagSeconds)
+	}
+	if c.StuckSeconds < 0 {
+		return errors.Errorf("invalid probe.stuck-seconds %d", c.StuckSeconds)
+	}
+	return nil
+}
+
+// readyLag returns the max replication lag of being ready, 0 means unlimited
+func (c *ProbeConfig) readyLag(slo *LagSLOConfig) time.Duration {
+	if c.ReadyLagSeconds > 0 {
+		return time.Duration(c.ReadyLagSeconds) * time.Second
+	}
+	return time.Duration(slo.CriticalSeconds) * time.Second
+}
+
+// ProbeInfo is the result of /readyz and /healthz, Reason tells why it fails
+type ProbeInfo struct {
+	OK         bool    `json:"ok"`
+	Reason     string  `json:"reason,omitempty"`
+	LagSeconds float64 `json:"lag-seconds"`
+	AppliedTS  int64   `json:"applied-ts"`
+}
+
+// applyProgress tracks whether the binlogs added to downstream are being applied, the apply loop is stuck if
+// there are binlogs not applied and none is applied for a while
+type applyProgress struct {
+	// the commit ts of the last binlog added and the last one applied
+	added   int64
+	applied int64
+	// in unix nanoseconds, the last time a binlog is applied, or added when all the ones before it are applied
+	since int64
+	// make it possible to mock the time
+	now func() time.Time
+}
+
+func newApplyProgress() *applyProgress {
+	return &applyProgress{since: time.Now().UnixNano(), now: time.Now}
+}
+
+// add records the binlog added to downstream, nil progress is a no-op
+func (p *applyProgress) add(ts int64) {
+	if p == nil {
+		return
+	}
+	if atomic.LoadInt64(&p.added) <= atomic.LoadInt64(&p.applied) {
+		atomic.StoreInt64(&p.since, p.now().UnixNano())
+	}
+	atomic.StoreInt64(&p.added, ts)
+}
+
+// apply records the binlog applied to downstream, nil progress is a no-op
+func (p *applyProgress) apply(ts int64) {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt64(&p.since, p.now().UnixNano())
+	atomic.StoreInt64(&p.applied, ts)
+}
+
+// stalled returns how long none of the binlogs pending is applied, 0 if there's none pending
+func (p *applyProgress) stalled() time.Duration {
+	if p == nil || atomic.LoadInt64(&p.added) <= atomic.LoadInt64(&p.applied) {
+		return 0
+	}
+	return p.now().Sub(time.Unix(0, atomic.LoadInt64(&p.since)))
+}
+
+// pingDownstream checks the connection to downstream, only mysql and tidb are checked
+func (s *Syncer) pingDownstream(ctx context.Context) error {
+	mysqlSyncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, downstreamPingTimeout)
+	defer cancel()
+	return errors.Trace(mysqlSyncer.DB().PingContext(ctx))
+}
+
+// readiness returns whether drainer is connected to downstream and the replication lag is within the threshold
+func (s *Server) readiness(ctx context.Context) ProbeInfo {
+	lag := s.syncer.watermark.lag()
+	info := ProbeInfo{OK: true, LagSeconds: lag.Seconds(), AppliedTS: s.syncer.watermark.TS()}
+	if err := s.syncer.pingDownstream(ctx); err != nil {
+		info.OK, info.Reason = false, fmt.Sprintf("downstream is not connected: %v", err)
+	} else if max := s.cfg.Probe.readyLag(&s.cfg.LagSLO); max > 0 && lag > max {
+		info.OK, info.Reason = false, fmt.Sprintf("replication lag %s exceeds %s", lag.Truncate(time.Second), max)
+	}
+	return info
+}
+
+// liveness returns whether the apply loop of drainer is making progress
+func (s *Server) liveness() ProbeInfo {
+	info := ProbeInfo{OK: true, LagSeconds: s.syncer.watermark.lag().Seconds(), AppliedTS: s.syncer.watermark.TS()}
+	deadline := time.Duration(s.cfg.Probe.StuckSeconds) * time.Second
+	if stalled := s.syncer.progress.stalled(); deadline > 0 && stalled > deadline {
+		info.OK, info.Reason = false, fmt.Sprintf("no binlog is applied for %s", stalled.Truncate(time.Second))
+	}
+	return info
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/drainer/relay"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+var createRelayDB = loader.CreateDBWithTimeZone
+
+// feedByRelayLogIfNeed applies the binlogs left in relay log by the last run to
+// downstream, these binlogs have been persisted but may not be applied because
+// of a downstream outage or a crash. The checkpoint is advanced to the last
+// replayed binlog and the relay log is cleaned after all of them are applied.
+func feedByRelayLogIfNeed(cfg *SyncerConfig, cp checkpoint.CheckPoint) error {
+	if len(cfg.RelayLogDir) == 0 {
+		return nil
+	}
+
+	if cfg.DestDBType != "mysql" && cfg.DestDBType != "tidb" {
+		return nil
+	}
+
+	timeZone, err := cfg.To.SessionTimeZone()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	password, err := cfg.To.GetPassword()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	db, err := createRelayDB(cfg.To.User, password, cfg.To.Host, cfg.To.Port, cfg.StrSQLMode, timeZone)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	// the binlogs may have been applied partially, so it must be reentrant.
+	ld, err := loader.NewLoader(db, loader.WorkerCount(cfg.WorkerCount), loader.BatchSize(cfg.TxnBatch), loader.SafeMode(true))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var lastTS int64
+	successDone := make(chan struct{})
+	go func() {
+		defer close(successDone)
+		for txn := range ld.Successes() {
+			if ts := txn.Metadata.(int64); ts > lastTS {
+				lastTS = ts
+			}
+		}
+	}()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ld.Run()
+	}()
+
+	var replayed int
+	checkpointTS := cp.TS()
+	readErr := relay.ReadBinlogs(cfg.RelayLogDir, func(binlog *obinlog.Binlog) error {
+		if binlog.CommitTs <= checkpointTS {
+			return nil
+		}
+
+		txn, err := loader.SlaveBinlogToTxn(binlog)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		txn.Metadata = binlog.CommitTs
+
+		select {
+		case ld.Input() <- txn:
+			replayed++
+			return nil
+		case err := <-runErr:
+			runErr <- err
+			return errors.Annotate(err, "loader quit")
+		}
+	})
+
+	ld.Close()
+	err = <-runErr
+	<-successDone
+
+	if readErr != nil {
+		return errors.Annotate(readErr, "feed by relay log failed")
+	}
+	if err != nil {
+		return errors.Annotate(err, "feed by relay log failed")
+	}
+
+	if lastTS > checkpointTS {
+		if err := cp.Save(lastTS, 0); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	log.Info("feed by relay log success", zap.Int("binlogs", replayed), zap.Int64("checkpoint", cp.TS()))
+
+	return errors.Trace(relay.CleanRelayLog(cfg.RelayLogDir))
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"io"
+	"os"
+	"path"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+// ReadBinlogs reads all the binlogs in the relay log directory in order and
+// calls fn for each of them. It returns nil if there's no relay log in dir.
+func ReadBinlogs(dir string, fn func(binlog *obinlog.Binlog) error) error {
+	names, err := readRelayLogNames(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for i, name := range names {
+		isLastFile := i == len(names)-1
+		if err := readFile(path.Join(dir, name), isLastFile, fn); err != nil {
+			return errors.Annotatef(err, "read relay log %s failed", name)
+		}
+	}
+
+	return nil
+}
+
+// CleanRelayLog removes all the relay log files in dir.
+func CleanRelayLog(dir string) error {
+	names, err := readRelayLogNames(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, name := range names {
+		fileName := path.Join(dir, name)
+		if err := os.Remove(fileName); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("remove relay log file", zap.String("file name", fileName))
+	}
+
+	return nil
+}
+
+func readRelayLogNames(dir string) ([]string, error) {
+	if !binlogfile.Exist(dir) {
+		return nil, nil
+	}
+
+	names, err := binlogfile.ReadBinlogNames(dir)
+	if err != nil {
+		if errors.Cause(err) == binlogfile.ErrFileNotFound {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+
+	return names, nil
+}
+
+func readFile(fileName string, isLastFile bool, fn func(binlog *obinlog.Binlog) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	decoder := binlogfile.NewDecoder(f, 0)
+	for {
+		payload, _, err := decoder.Decode()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			// the last file may contain a partial written binlog if drainer crashed.
+			if err == io.ErrUnexpectedEOF && isLastFile {
+				log.Warn("meet partial binlog at the end of relay log", zap.String("file name", fileName))
+				return nil
+			}
+			return errors.Trace(err)
+		}
+
+		binlog := new(obinlog.Binlog)
+		if err := binlog.Unmarshal(payload); err != nil {
+			return errors.Trace(err)
+		}
+
+		if err := fn(binlog); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+type testReaderSuite struct {
+	translator.BinlogGenerator
+}
+
+var _ = Suite(&testReaderSuite{})
+
+func (r *testReaderSuite) TestReadBinlogs(c *C) {
+	dir := c.MkDir()
+
+	// no relay log
+	err := ReadBinlogs(dir, func(*obinlog.Binlog) error {
+		c.Fatal("should not be called")
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	relayer, err := NewRelayer(dir, 10, nil)
+	c.Assert(err, IsNil)
+
+	r.SetDDL()
+	for i := 0; i < 3; i++ {
+		_, err = relayer.WriteBinlog(r.Schema, r.Table, r.TiBinlog, nil)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(relayer.Close(), IsNil)
+
+	var binlogs []*obinlog.Binlog
+	err = ReadBinlogs(dir, func(binlog *obinlog.Binlog) error {
+		binlogs = append(binlogs, binlog)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(binlogs, HasLen, 3)
+	c.Assert(binlogs[0].CommitTs, Equals, r.TiBinlog.CommitTs)
+	c.Assert(binlogs[0].DdlData.GetSchemaName(), Equals, r.Schema)
+
+	err = CleanRelayLog(dir)
+	c.Assert(err, IsNil)
+	c.Assert(binlogfile.Exist(dir), IsTrue)
+	names, _ := binlogfile.ReadBinlogNames(dir)
+	c.Assert(names, HasLen, 0)
+}
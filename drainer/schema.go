@@ -46,6 +46,9 @@ type Schema struct {
 	jobs                []*model.Job
 	version2SchemaTable map[int64]TableName
 	currentVersion      int64
+
+	// the previous infos of the tables by table id in the order of schema version
+	tableVersions map[int64][]tableVersion
 }
 
 // TableName stores the table and schema name
@@ -59,6 +62,7 @@ func NewSchema(jobs []*model.Job, hasImplicitCol bool) (*Schema, error) {
 		truncateTableID:     make(map[int64]struct{}),
 		tblsDroppingCol:     make(map[int64]bool),
 		jobs:                jobs,
+		tableVersions:       make(map[int64][]tableVersion),
 	}
 
 	s.tableIDToName = make(map[int64]TableName)
@@ -99,6 +103,16 @@ func (s *Schema) SchemaAndTableName(id int64) (string, string, bool) {
 	return tn.Schema, tn.Table, true
 }
 
+// TableIDByName returns the id of the table by its name
+func (s *Schema) TableIDByName(schema string, table string) (int64, bool) {
+	for id, name := range s.tableIDToName {
+		if name.Schema == schema && name.Table == table {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
 // SchemaByID returns the DBInfo by schema id
 func (s *Schema) SchemaByID(id int64) (val *model.DBInfo, ok bool) {
 	val, ok = s.schemas[id]
@@ -132,6 +146,7 @@ func (s *Schema) DropSchema(id int64) (string, error) {
 	}
 
 	for _, table := range schema.Tables {
+		s.removePartitions(table)
 		delete(s.tables, table.ID)
 		delete(s.tableIDToName, table.ID)
 	}
@@ -166,6 +181,7 @@ func (s *Schema) DropTable(id int64) (string, error) {
 		return "", errors.Trace(err)
 	}
 
+	s.removePartitions(table)
 	delete(s.tables, id)
 	delete(s.tableIDToName, id)
 
@@ -187,6 +203,7 @@ func (s *Schema) CreateTable(schema *model.DBInfo, table *model.TableInfo) error
 	schema.Tables = append(schema.Tables, table)
 	s.tables[table.ID] = table
 	s.tableIDToName[table.ID] = TableName{Schema: schema.Name.O, Table: table.Name.O}
+	s.addPartitions(table)
 
 	log.Debug("create table success", zap.String("name", schema.Name.O+"."+table.Name.O), zap.Int64("id", table.ID))
 	return nil
@@ -194,7 +211,7 @@ func (s *Schema) CreateTable(schema *model.DBInfo, table *model.TableInfo) error
 
 // ReplaceTable replace the table by new tableInfo
 func (s *Schema) ReplaceTable(table *model.TableInfo) error {
-	_, ok := s.tables[table.ID]
+	old, ok := s.tables[table.ID]
 	if !ok {
 		return errors.NotFoundf("table %s(%d)", table.Name, table.ID)
 	}
@@ -203,11 +220,42 @@ func (s *Schema) ReplaceTable(table *model.TableInfo) error {
 		addImplicitColumn(table)
 	}
 
+	s.removePartitions(old)
 	s.tables[table.ID] = table
+	s.addPartitions(table)
 
 	return nil
 }
 
+// addPartitions maps the partition ids of the table to it, the mutations of a partitioned table may carry
+// the partition id instead of the table id
+func (s *Schema) addPartitions(table *model.TableInfo) {
+	name := s.tableIDToName[table.ID]
+	for _, id := range partitionIDs(table) {
+		s.tables[id] = table
+		s.tableIDToName[id] = name
+	}
+}
+
+func (s *Schema) removePartitions(table *model.TableInfo) {
+	for _, id := range partitionIDs(table) {
+		delete(s.tables, id)
+		delete(s.tableIDToName, id)
+	}
+}
+
+func partitionIDs(table *model.TableInfo) []int64 {
+	if table.Partition == nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(table.Partition.Definitions))
+	for _, def := range table.Partition.Definitions {
+		ids = append(ids, def.ID)
+	}
+	return ids
+}
+
 func (s *Schema) removeTable(tableID int64) error {
 	schema, ok := s.SchemaByTableID(tableID)
 	if !ok {
@@ -251,10 +299,12 @@ func (s *Schema) handlePreviousDDLJobIfNeed(version int64) error {
 			log.Info("Got DeleteOnly Job", zap.Stringer("job", job))
 			continue
 		}
+		snapshot := s.snapshotTables(job)
 		_, _, _, err := s.handleDDL(job)
 		if err != nil {
 			return errors.Annotatef(err, "handle ddl job %v failed, the schema info: %s", s.jobs[i], s)
 		}
+		s.recordTableVersions(snapshot, job.BinlogInfo.SchemaVersion)
 	}
 
 	s.jobs = s.jobs[i:]
@@ -280,7 +330,18 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 		return "", "", "", errors.Errorf("[ddl job sql miss]%+v", job)
 	}
 
-	switch job.Type {
+	tp := job.Type
+	if verb, ok := sequenceDDLVerb(sql); ok {
+		// the sequences are tables in TiDB, and their DDLs are handled like the tables'
+		switch verb {
+		case "CREATE":
+			tp = model.ActionCreateTable
+		case "DROP":
+			tp = model.ActionDropTable
+		}
+	}
+
+	switch tp {
 	case model.ActionCreateSchema:
 		// get the DBInfo from job rawArgs
 		schema := job.BinlogInfo.DBInfo
@@ -422,6 +483,18 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
 		}
 
+		if job.Type == model.ActionTruncateTablePartition {
+			// the truncated partitions get new ids like the truncated table, skip the DMLs of the old ones
+			if old, ok := s.TableByID(tbInfo.ID); ok {
+				for _, id := range partitionIDs(old) {
+					s.truncateTableID[id] = struct{}{}
+				}
+				for _, id := range partitionIDs(tbInfo) {
+					delete(s.truncateTableID, id)
+				}
+			}
+		}
+
 		err := s.ReplaceTable(tbInfo)
 		if err != nil {
 			return "", "", "", errors.Trace(err)
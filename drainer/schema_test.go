@@ -405,3 +405,46 @@ func testDoDDLAndCheck(c *C, schema *Schema, job *model.Job, isErr bool, sql str
 	c.Assert(schemaName, Equals, expectedSchema)
 	c.Assert(tableName, Equals, expectedTable)
 }
+
+func (t *schemaSuite) TestPartitionIDs(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	partitioned := func(ids ...int64) *model.TableInfo {
+		info := &model.TableInfo{ID: 10, Name: model.NewCIStr("t"), PKIsHandle: true, Partition: &model.PartitionInfo{Type: model.PartitionTypeRange}}
+		for _, id := range ids {
+			info.Partition.Definitions = append(info.Partition.Definitions, model.PartitionDefinition{ID: id, Name: model.NewCIStr(fmt.Sprintf("p%d", id))})
+		}
+		return info
+	}
+
+	db := &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}
+	c.Assert(schema.CreateSchema(db), IsNil)
+	c.Assert(schema.CreateTable(db, partitioned(11, 12)), IsNil)
+
+	for _, id := range []int64{10, 11, 12} {
+		schemaName, tableName, ok := schema.SchemaAndTableName(id)
+		c.Assert(ok, IsTrue)
+		c.Assert(schemaName+"."+tableName, Equals, "test.t")
+		_, ok = schema.TableByID(id)
+		c.Assert(ok, IsTrue)
+	}
+
+	// truncate partition p12
+	job := &model.Job{ID: 2, State: model.JobStateDone, SchemaID: 1, TableID: 10, Type: model.ActionTruncateTablePartition, Query: "alter table t truncate partition p12",
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, TableInfo: partitioned(11, 13)}}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+	_, ok := schema.TableByID(12)
+	c.Assert(ok, IsFalse)
+	_, ok = schema.TableByID(13)
+	c.Assert(ok, IsTrue)
+	c.Assert(schema.IsTruncateTableID(12), IsTrue)
+	c.Assert(schema.IsTruncateTableID(11), IsFalse)
+
+	_, err = schema.DropTable(10)
+	c.Assert(err, IsNil)
+	for _, id := range []int64{10, 11, 13} {
+		_, _, ok = schema.SchemaAndTableName(id)
+		c.Assert(ok, IsFalse)
+	}
+}
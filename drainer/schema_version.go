@@ -0,0 +1,129 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+)
+
+const (
+	// the max number of the previous infos kept for a table
+	maxTableVersions = 8
+	// the previous infos replaced more than this many schema versions ago are dropped, as the DMLs lag behind
+	// the DDLs by a few schema versions at most, e.g., the DMLs committed in the middle of an online DDL
+	tableVersionWindow = 1024
+)
+
+// tableVersion is the info and name of the table or partition `id` before it's altered, renamed, truncated or
+// dropped by the DDL of schema version `until`
+type tableVersion struct {
+	id    int64
+	until int64
+	info  *model.TableInfo
+	name  TableName
+}
+
+// snapshotTables returns the current infos of the tables and partitions the job may change
+func (s *Schema) snapshotTables(job *model.Job) []tableVersion {
+	var ids []int64
+	if job.Type == model.ActionDropSchema {
+		if schema, ok := s.schemas[job.SchemaID]; ok {
+			for _, table := range schema.Tables {
+				ids = append(ids, table.ID)
+			}
+		}
+	} else if job.TableID > 0 {
+		ids = append(ids, job.TableID)
+	}
+
+	var snapshot []tableVersion
+	for _, id := range ids {
+		info, ok := s.tables[id]
+		if !ok {
+			continue
+		}
+		for _, id := range append(partitionIDs(info), id) {
+			snapshot = append(snapshot, tableVersion{id: id, info: info, name: s.tableIDToName[id]})
+		}
+	}
+	return snapshot
+}
+
+// recordTableVersions records the previous infos of the tables changed by the DDL of the schema version,
+// the snapshot is taken by snapshotTables before the DDL is handled
+func (s *Schema) recordTableVersions(snapshot []tableVersion, version int64) {
+	for _, table := range snapshot {
+		if info, ok := s.tables[table.id]; ok && info == table.info && s.tableIDToName[table.id] == table.name {
+			continue
+		}
+		table.until = version
+		versions := append(s.tableVersions[table.id], table)
+		if len(versions) > maxTableVersions {
+			versions = versions[len(versions)-maxTableVersions:]
+		}
+		s.tableVersions[table.id] = versions
+	}
+
+	for id, versions := range s.tableVersions {
+		i := 0
+		for i < len(versions) && versions[i].until < version-tableVersionWindow {
+			i++
+		}
+		if i == len(versions) {
+			delete(s.tableVersions, id)
+		} else if i > 0 {
+			s.tableVersions[id] = versions[i:]
+		}
+	}
+}
+
+// tableAt returns the info and name of the table or partition at the schema version. If the previous infos before
+// the version have been dropped, the oldest one kept is returned.
+func (s *Schema) tableAt(id int64, version int64) (*model.TableInfo, TableName, bool) {
+	for _, table := range s.tableVersions[id] {
+		if version < table.until {
+			return table.info, table.name, true
+		}
+	}
+	info, ok := s.tables[id]
+	if !ok {
+		return nil, TableName{}, false
+	}
+	return info, s.tableIDToName[id], true
+}
+
+// AtVersion returns the TableInfoGetter resolving the tables by their infos at the schema version, i.e., the version
+// the DMLs are encoded with, which is older than the latest one if the DMLs are committed after a DDL of the tables,
+// so the rows are decoded with the columns they're written with.
+func (s *Schema) AtVersion(version int64) translator.TableInfoGetter {
+	return &versionedSchema{Schema: s, version: version}
+}
+
+type versionedSchema struct {
+	*Schema
+	version int64
+}
+
+// TableByID implements TableInfoGetter interface
+func (s *versionedSchema) TableByID(id int64) (*model.TableInfo, bool) {
+	info, _, ok := s.tableAt(id, s.version)
+	return info, ok
+}
+
+// SchemaAndTableName implements TableInfoGetter interface
+func (s *versionedSchema) SchemaAndTableName(id int64) (string, string, bool) {
+	_, name, ok := s.tableAt(id, s.version)
+	return name.Schema, name.Table, ok
+}
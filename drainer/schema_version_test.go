@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type schemaVersionSuite struct{}
+
+var _ = Suite(&schemaVersionSuite{})
+
+func newVersionTestTable(id int64, name string, columns ...string) *model.TableInfo {
+	table := &model.TableInfo{ID: id, Name: model.NewCIStr(name), State: model.StatePublic}
+	for i, column := range columns {
+		table.Columns = append(table.Columns, &model.ColumnInfo{
+			ID:        int64(i + 1),
+			Name:      model.NewCIStr(column),
+			Offset:    i,
+			FieldType: *types.NewFieldType(mysql.TypeLonglong),
+			State:     model.StatePublic,
+		})
+	}
+	return table
+}
+
+func newVersionTestJob(tp model.ActionType, tableID int64, version int64, table *model.TableInfo) *model.Job {
+	return &model.Job{
+		ID:         version,
+		State:      model.JobStateSynced,
+		SchemaID:   1,
+		TableID:    tableID,
+		Type:       tp,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: version, TableInfo: table, FinishedTS: 123},
+		Query:      "ddl",
+	}
+}
+
+func (s *schemaVersionSuite) TestTableAtVersion(c *C) {
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	jobs := []*model.Job{
+		{
+			ID:         1,
+			State:      model.JobStateSynced,
+			SchemaID:   1,
+			Type:       model.ActionCreateSchema,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: dbInfo, FinishedTS: 123},
+			Query:      "create database test",
+		},
+		newVersionTestJob(model.ActionCreateTable, 2, 2, newVersionTestTable(2, "t", "a")),
+		newVersionTestJob(model.ActionAddColumn, 2, 3, newVersionTestTable(2, "t", "a", "b")),
+		newVersionTestJob(model.ActionRenameTable, 2, 4, newVersionTestTable(2, "t1", "a", "b")),
+		newVersionTestJob(model.ActionTruncateTable, 2, 5, newVersionTestTable(3, "t1", "a", "b")),
+		newVersionTestJob(model.ActionDropTable, 3, 6, nil),
+	}
+	schema, err := NewSchema(jobs, false)
+	c.Assert(err, IsNil)
+	c.Assert(schema.handlePreviousDDLJobIfNeed(6), IsNil)
+
+	_, ok := schema.TableByID(2)
+	c.Assert(ok, IsFalse)
+
+	checkTable := func(id int64, version int64, name string, columns int) {
+		getter := schema.AtVersion(version)
+		info, ok := getter.TableByID(id)
+		c.Assert(ok, IsTrue)
+		c.Assert(info.Columns, HasLen, columns)
+		schemaName, tableName, ok := getter.SchemaAndTableName(id)
+		c.Assert(ok, IsTrue)
+		c.Assert(schemaName, Equals, "test")
+		c.Assert(tableName, Equals, name)
+	}
+	// the DMLs are decoded with the table infos of their schema versions
+	checkTable(2, 2, "t", 1)
+	checkTable(2, 3, "t", 2)
+	checkTable(2, 4, "t1", 2)
+	checkTable(3, 5, "t1", 2)
+
+	_, ok = schema.AtVersion(5).TableByID(2)
+	c.Assert(ok, IsFalse)
+	_, ok = schema.AtVersion(6).TableByID(3)
+	c.Assert(ok, IsFalse)
+	c.Assert(schema.AtVersion(6).IsDroppingColumn(3), IsFalse)
+}
+
+func (s *schemaVersionSuite) TestDropTableVersions(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	table := tableVersion{id: 2, info: newVersionTestTable(2, "t", "a"), name: TableName{Schema: "test", Table: "t"}}
+	for version := int64(1); version <= maxTableVersions+2; version++ {
+		schema.recordTableVersions([]tableVersion{table}, version)
+	}
+	versions := schema.tableVersions[2]
+	c.Assert(versions, HasLen, maxTableVersions)
+	c.Assert(versions[0].until, Equals, int64(3))
+
+	// the versions out of the window are dropped
+	schema.recordTableVersions(nil, 5+tableVersionWindow)
+	c.Assert(schema.tableVersions[2], HasLen, maxTableVersions-2)
+	c.Assert(schema.tableVersions[2][0].until, Equals, int64(5))
+	schema.recordTableVersions(nil, 3*tableVersionWindow)
+	c.Assert(schema.tableVersions, HasLen, 0)
+}
@@ -19,6 +19,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,6 +31,8 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb/kv"
@@ -45,6 +49,9 @@ import (
 	"google.golang.org/grpc"
 )
 
+// ReloadTimeout is the max time to wait for the reloaded config to be applied
+const ReloadTimeout = 30 * time.Second
+
 var (
 	nodePrefix        = "drainers"
 	heartbeatInterval = 1 * time.Second
@@ -70,6 +77,8 @@ type Server struct {
 	syncer    *Syncer
 	cp        checkpoint.CheckPoint
 	isClosed  int32
+	// serves on diagnostics-addr, nil if it's disabled
+	diagnostics *http.Server
 
 	statusMu sync.RWMutex
 	status   *node.Status
@@ -86,6 +95,8 @@ func init() {
 
 // NewServer return a instance of binlog-server
 func NewServer(cfg *Config) (*Server, error) {
+	mask.SetGlobal(mask.New(cfg.Mask))
+
 	if cfg.NodeID == "" {
 		var err error
 		cfg.NodeID, err = genDrainerID(cfg.ListenAddr)
@@ -122,6 +133,7 @@ func NewServer(cfg *Config) (*Server, error) {
 	}
 
 	cfg.SyncerCfg.To.ClusterID = clusterID
+	cfg.SyncerCfg.To.NodeID = cfg.NodeID
 	pdCli.Close()
 
 	cpCfg, err := GenCheckPointCfg(cfg, clusterID)
@@ -134,6 +146,10 @@ func NewServer(cfg *Config) (*Server, error) {
 		return nil, errors.Trace(err)
 	}
 
+	if err := feedByRelayLogIfNeed(cfg.SyncerCfg, cp); err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(cp.TS()))))
 
 	syncer, err := createSyncer(cfg.EtcdURLs, cp, cfg.SyncerCfg)
@@ -141,6 +157,12 @@ func NewServer(cfg *Config) (*Server, error) {
 		return nil, errors.Trace(err)
 	}
 
+	syncer.control, err = NewSyncerControl(path.Join(cfg.DataDir, syncerControlFile))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	syncer.endTS = cfg.EndTS
+
 	c, err := NewCollector(cfg, clusterID, syncer, cp)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -273,6 +295,10 @@ func (s *Server) Start() error {
 		})
 	}
 
+	s.tg.GoNoPanic("watermark", func() {
+		s.syncer.watermark.monitor(s.ctx, &s.cfg.LagSLO)
+	})
+
 	s.tg.GoNoPanic("syncer", func() {
 		defer func() { go s.Close() }()
 		if err := s.syncer.Start(); err != nil {
@@ -280,6 +306,10 @@ func (s *Server) Start() error {
 		}
 	})
 
+	if err := s.startDiagnostics(); err != nil {
+		return errors.Trace(err)
+	}
+
 	// start a TCP listener
 	tcpURL, err := url.Parse(s.tcpAddr)
 	if err != nil {
@@ -324,6 +354,12 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// FinalTS returns the checkpoint ts after the server is closed, and whether the syncer has reached the ts set by
+// `end-ts` and quit.
+func (s *Server) FinalTS() (int64, bool) {
+	return s.cp.TS(), s.syncer.endReached
+}
+
 // ApplyAction change the pump's state, now can be pause or close.
 func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
 	rd := render.New(render.Options{
@@ -388,6 +424,282 @@ func (s *Server) GetLatestTS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Reload parses the config again and applies the reloadable items of the syncer config,
+// it waits until the config is applied or ctx is done.
+func (s *Server) Reload(ctx context.Context) error {
+	cfg := NewConfig()
+	if err := cfg.Parse(s.cfg.args); err != nil {
+		return errors.Annotate(err, "parse config failed")
+	}
+
+	if err := s.syncer.Reload(ctx, cfg.SyncerCfg); err != nil {
+		return errors.Trace(err)
+	}
+	mask.SetGlobal(mask.New(cfg.Mask))
+	return nil
+}
+
+// effectiveConfig returns the config in use, the passwords are hidden.
+func (s *Server) effectiveConfig() Config {
+	cfg := *s.cfg
+	syncerCfg := s.syncer.Config()
+	if syncerCfg.To != nil {
+		to := *syncerCfg.To
+		to.Password = hiddenPassword(to.Password)
+		to.Checkpoint.Password = hiddenPassword(to.Checkpoint.Password)
+		syncerCfg.To = &to
+	}
+	cfg.SyncerCfg = &syncerCfg
+
+	return cfg
+}
+
+func hiddenPassword(password string) string {
+	if len(password) == 0 {
+		return password
+	}
+	return "******"
+}
+
+// GetConfig returns the effective config.
+func (s *Server) GetConfig(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get drainer's config success!", s.effectiveConfig()))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// ReloadConfig reloads the config, see Reload.
+func (s *Server) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	var err error
+	ctx, cancel := context.WithTimeout(r.Context(), ReloadTimeout)
+	defer cancel()
+	if rerr := s.Reload(ctx); rerr != nil {
+		log.Error("reload config failed", zap.Error(rerr))
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("reload config failed: %v", rerr))
+	} else {
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("reload config success!", nil))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetSyncerControl returns the state of the syncer control.
+func (s *Server) GetSyncerControl(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get syncer control success!", s.syncer.control.State()))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetTableStatus returns the replication status of each table,
+// only the tables without primary key or unique key if `no-key=true` is in the query,
+// and only the tables with txns skipped by group-commit-savepoint = "quarantine" if `quarantined=true` is.
+func (s *Server) GetTableStatus(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	status := s.syncer.TableStatus()
+	noKey := r.URL.Query().Get("no-key") == "true"
+	quarantined := r.URL.Query().Get("quarantined") == "true"
+	if noKey || quarantined {
+		filtered := make([]loader.TableStatus, 0, len(status))
+		for _, table := range status {
+			if (!noKey || table.NoKey) && (!quarantined || table.QuarantinedCount > 0) {
+				filtered = append(filtered, table)
+			}
+		}
+		status = filtered
+	}
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get table status success!", status))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetAddedTables returns the states of the tables added to the running task by ControlTable
+func (s *Server) GetAddedTables(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get added tables success!", s.syncer.AddedTables()))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetWatermark returns the progress of the txns applied in downstream by the loader, e.g., to decide how far the GC
+// safepoint of upstream can advance, all the txns with commit ts < min-unapplied-ts (or <= applied-ts if it's 0)
+// are applied. It's only available when the downstream is mysql or tidb.
+func (s *Server) GetWatermark(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	var err error
+	if watermark, ok := s.syncer.LoaderWatermark(); ok {
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("get watermark success!", watermark))
+	} else {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("the watermark is only available when the downstream is mysql or tidb"))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetHealth returns the health status judged by the replication lag and the lag SLO,
+// it responds 503 if the status is critical so it can be used as a health check directly.
+func (s *Server) GetHealth(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	info := s.syncer.watermark.healthInfo(&s.cfg.LagSLO)
+	code := http.StatusOK
+	if info.Status == HealthCritical {
+		code = http.StatusServiceUnavailable
+	}
+	err := rd.JSON(w, code, util.SuccessResponse("get health success!", info))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetReadiness responds 200 when drainer is connected to downstream and the replication lag is within
+// probe.ready-lag-seconds, or 503 otherwise, for the readiness probe of Kubernetes
+func (s *Server) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	s.renderProbe(w, s.readiness(r.Context()))
+}
+
+// GetLiveness responds 503 when none of the binlogs added to downstream is applied for probe.stuck-seconds,
+// or 200 otherwise, for the liveness probe of Kubernetes
+func (s *Server) GetLiveness(w http.ResponseWriter, r *http.Request) {
+	s.renderProbe(w, s.liveness())
+}
+
+func (s *Server) renderProbe(w http.ResponseWriter, info ProbeInfo) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	code := http.StatusOK
+	if !info.OK {
+		code = http.StatusServiceUnavailable
+	}
+	if err := rd.JSON(w, code, info); err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetRecycledTables returns the tables in the recycle bin of downstream and when they're dropped
+func (s *Server) GetRecycledTables(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	tables, err := s.syncer.RecycledTables(r.Context())
+	if err != nil {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("get recycled tables failed: %v", err))
+	} else {
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("get recycled tables success!", tables))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// KeepRecycledTable cancels dropping a table in the recycle bin, it's kept until it's removed by hand
+func (s *Server) KeepRecycledTable(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	table := mux.Vars(r)["table"]
+	log.Info("receive keep recycled table request", zap.String("table", table))
+
+	err := s.syncer.KeepRecycledTable(r.Context(), table)
+	if err != nil {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("keep recycled table failed: %v", err))
+	} else {
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("keep recycled table success!", nil))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// ControlTable pauses or resumes syncing a table, the DMLs of the paused table are buffered
+// while the other tables continue, and they're applied in order when it's resumed.
+// The action add adds the table to the running task, see Syncer.AddTable.
+func (s *Server) ControlTable(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	vars := mux.Vars(r)
+	database, table, action := vars["db"], vars["table"], vars["action"]
+	log.Info("receive table control request", zap.String("db", database), zap.String("table", table), zap.String("action", action))
+
+	err := s.syncer.ControlTable(database, table, action)
+	if err != nil {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("%s table failed: %v", action, err))
+	} else {
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse(action+" table success!", nil))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// ControlSyncer applies the admin operation on the syncer, the action can be:
+// pause, resume, or skip with the parameter `count` (skip the next count binlogs)
+// and/or `until-ts` (skip the binlogs whose commit ts <= until-ts).
+func (s *Server) ControlSyncer(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	action := mux.Vars(r)["action"]
+	log.Info("receive syncer control request", zap.String("action", action), zap.String("query", r.URL.RawQuery))
+
+	var err error
+	switch action {
+	case "pause":
+		err = s.syncer.control.Pause()
+	case "resume":
+		err = s.syncer.control.Resume()
+	case "skip":
+		var count, untilTS int64
+		if v := r.FormValue("count"); v != "" {
+			if count, err = strconv.ParseInt(v, 10, 64); err != nil {
+				break
+			}
+		}
+		if v := r.FormValue("until-ts"); v != "" {
+			if untilTS, err = strconv.ParseInt(v, 10, 64); err != nil {
+				break
+			}
+		}
+		err = s.syncer.control.Skip(count, untilTS)
+	default:
+		err = errors.Errorf("invalid action %s", action)
+	}
+
+	if err != nil {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("%s syncer failed: %v", action, err))
+	} else {
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse(action+" syncer success!", s.syncer.control.State()))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
 // commitStatus commit the node's last status to pd when close the server.
 func (s *Server) commitStatus() {
 	// update this node
@@ -428,6 +740,19 @@ func (s *Server) initAPIRouter() *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/status", s.collector.Status).Methods("GET")
 	router.HandleFunc("/commit_ts", s.GetLatestTS).Methods("GET")
+	router.HandleFunc("/config", s.GetConfig).Methods("GET")
+	router.HandleFunc("/config/reload", s.ReloadConfig).Methods("PUT")
+	router.HandleFunc("/syncer/control", s.GetSyncerControl).Methods("GET")
+	router.HandleFunc("/syncer/tables", s.GetTableStatus).Methods("GET")
+	router.HandleFunc("/syncer/tables/added", s.GetAddedTables).Methods("GET")
+	router.HandleFunc("/health", s.GetHealth).Methods("GET")
+	router.HandleFunc("/readyz", s.GetReadiness).Methods("GET")
+	router.HandleFunc("/healthz", s.GetLiveness).Methods("GET")
+	router.HandleFunc("/syncer/watermark", s.GetWatermark).Methods("GET")
+	router.HandleFunc("/syncer/{action}", s.ControlSyncer).Methods("PUT")
+	router.HandleFunc("/syncer/tables/{db}/{table}/{action}", s.ControlTable).Methods("PUT")
+	router.HandleFunc("/syncer/recycle", s.GetRecycledTables).Methods("GET")
+	router.HandleFunc("/syncer/recycle/{table}/keep", s.KeepRecycledTable).Methods("PUT")
 	router.HandleFunc("/state/{nodeID}/{action}", s.ApplyAction).Methods("PUT")
 	prometheus.DefaultGatherer = registry
 	router.Handle("/metrics", promhttp.Handler())
@@ -458,6 +783,12 @@ func (s *Server) Close() {
 		log.Error("close checkpoint failed", zap.Error(err))
 	}
 
+	if s.diagnostics != nil {
+		if err := s.diagnostics.Close(); err != nil {
+			log.Error("close diagnostics server failed", zap.Error(err))
+		}
+	}
+
 	// stop gRPC server
 	s.gs.Stop()
 	log.Info("drainer exit")
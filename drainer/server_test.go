@@ -27,10 +27,12 @@ import (
 	"github.com/gorilla/mux"
 	. "github.com/pingcap/check"
 	pd "github.com/pingcap/pd/client"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
@@ -68,6 +70,68 @@ func (t *testServerSuite) TestGetLatestTS(c *C) {
 	c.Assert(int64(ts), Equals, int64(1984))
 }
 
+func (t *testServerSuite) TestGetConfig(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.To = &dsync.DBConfig{Host: "127.0.0.1", Password: "secret"}
+	server := Server{
+		cfg: cfg,
+		syncer: &Syncer{
+			cfg: cfg.SyncerCfg,
+		},
+	}
+	router := server.initAPIRouter()
+
+	req := httptest.NewRequest("GET", "/config", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Assert(string(body), Matches, `(?s).*"host": "127.0.0.1".*`)
+	c.Assert(string(body), Not(Matches), `(?s).*secret.*`)
+	// the config in use is not changed
+	c.Assert(cfg.SyncerCfg.To.Password, Equals, "secret")
+}
+
+func (t *testServerSuite) TestControlSyncer(c *C) {
+	ctl, err := NewSyncerControl(path.Join(c.MkDir(), syncerControlFile))
+	c.Assert(err, IsNil)
+	server := Server{
+		syncer: &Syncer{
+			control: ctl,
+		},
+	}
+	router := server.initAPIRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/syncer/pause", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(ctl.State().Paused, IsTrue)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/syncer/skip?count=3&until-ts=100", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(ctl.State(), DeepEquals, SyncerControlState{Paused: true, SkipCount: 3, SkipUntilTS: 100})
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/syncer/skip?count=abc", nil))
+	var decoded util.Response
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &decoded), IsNil)
+	c.Assert(decoded.Code, Not(Equals), 200)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/syncer/resume", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(ctl.State().Paused, IsFalse)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/syncer/control", nil))
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &decoded), IsNil)
+	c.Assert(decoded.Code, Equals, 200)
+}
+
 func (t *testServerSuite) TestNotify(c *C) {
 	server := Server{
 		collector: &Collector{
@@ -352,3 +416,86 @@ func (s *newServerSuite) TestInvalidDestDBType(c *C) {
 	c.Assert(err, ErrorMatches, ".*unknown DestDBType.*")
 	c.Assert(cfg.SyncerCfg.To.ClusterID, Equals, uint64(8012))
 }
+
+func (t *testServerSuite) TestGetHealth(c *C) {
+	now := time.Now().Truncate(time.Millisecond)
+	wm := newWatermark(int64(oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Minute)), 0)))
+	wm.now = func() time.Time { return now }
+	cfg := NewConfig()
+	cfg.LagSLO = LagSLOConfig{WarningSeconds: 10, CriticalSeconds: 30}
+	server := Server{
+		cfg:    cfg,
+		syncer: &Syncer{watermark: wm},
+	}
+	router := server.initAPIRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Body.String(), Matches, `(?s).*"status": "critical".*`)
+
+	// the lag is within the SLO after the watermark advances
+	wm.advance(int64(oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Second)), 0)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `(?s).*"status": "ok".*`)
+}
+
+func (t *testServerSuite) TestProbes(c *C) {
+	now := time.Now().Truncate(time.Millisecond)
+	wm := newWatermark(int64(oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Minute)), 0)))
+	wm.now = func() time.Time { return now }
+	progress := newApplyProgress()
+	progress.now = func() time.Time { return now }
+	cfg := NewConfig()
+	cfg.LagSLO = LagSLOConfig{CriticalSeconds: 30}
+	cfg.Probe = ProbeConfig{StuckSeconds: 10}
+	server := Server{
+		cfg:    cfg,
+		syncer: &Syncer{watermark: wm, progress: progress},
+	}
+	router := server.initAPIRouter()
+	probe := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	// not ready by the critical-seconds of lag-slo
+	code, body := probe("/readyz")
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(body, Matches, `(?s).*"reason": "replication lag 1m0s exceeds 30s".*`)
+	cfg.Probe.ReadyLagSeconds = 120
+	code, _ = probe("/readyz")
+	c.Assert(code, Equals, http.StatusOK)
+
+	// alive while the binlog added is being applied
+	progress.add(1)
+	now = now.Add(5 * time.Second)
+	code, _ = probe("/healthz")
+	c.Assert(code, Equals, http.StatusOK)
+	now = now.Add(6 * time.Second)
+	code, body = probe("/healthz")
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(body, Matches, `(?s).*"reason": "no binlog is applied for 11s".*`)
+
+	// alive again once it's applied, and when idle
+	progress.apply(1)
+	now = now.Add(time.Minute)
+	code, _ = probe("/healthz")
+	c.Assert(code, Equals, http.StatusOK)
+}
+
+func (t *testServerSuite) TestDiagnosticState(c *C) {
+	progress := newApplyProgress()
+	syncer := &Syncer{input: make(chan *binlogItem, 4), watermark: newWatermark(42), progress: progress}
+	syncer.input <- &binlogItem{}
+	server := Server{cfg: NewConfig(), syncer: syncer}
+
+	state := server.diagnosticState()
+	c.Assert(state.Queues, DeepEquals, map[string]int{"syncer_input": 1})
+	c.Assert(state.AppliedTS, Equals, int64(42))
+	c.Assert(state.StalledSeconds, Equals, float64(0))
+	c.Assert(state.Goroutines, Greater, 0)
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	tb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+)
+
+// the interval of checking the archive files to purge
+var archivePurgeInterval = 10 * time.Minute
+
+// ArchiveConfig is the config of archiving the items synced to local files, disabled if Dir is empty
+type ArchiveConfig struct {
+	Dir string `toml:"dir" json:"dir"`
+	// the max size of each file, rotated to a new file when it's reached
+	FileSize int64 `toml:"file-size" json:"file-size"`
+	// the files whose last write is older than the retention are removed, 0 means keeping all
+	RetentionHours int `toml:"retention-hours" json:"retention-hours"`
+}
+
+// Archiver writes the items synced to the rotated local files in the format of the file syncer while they're
+// synced to downstream, so the events can be replayed by reparo or inspected without going back to pump.
+type Archiver struct {
+	dir       string
+	retention time.Duration
+	binlogger binlogfile.Binlogger
+	lastPurge time.Time
+	// the table infos to translate the items with if theirs are not set
+	tableInfoGetter translator.TableInfoGetter
+}
+
+// NewArchiver opens the archive files in cfg.Dir, it returns nil if the archive is disabled
+func NewArchiver(cfg *ArchiveConfig, tableInfoGetter translator.TableInfoGetter) (*Archiver, error) {
+	if cfg == nil || len(cfg.Dir) == 0 {
+		return nil, nil
+	}
+	fileSize := cfg.FileSize
+	if fileSize <= 0 {
+		fileSize = binlogfile.SegmentSizeBytes
+	}
+	binlogger, err := binlogfile.OpenBinlogger(cfg.Dir, fileSize)
+	if err != nil {
+		return nil, errors.Annotatef(err, "open archive dir %s", cfg.Dir)
+	}
+
+	a := &Archiver{
+		dir:             cfg.Dir,
+		retention:       time.Duration(cfg.RetentionHours) * time.Hour,
+		binlogger:       binlogger,
+		tableInfoGetter: tableInfoGetter,
+	}
+	a.purge()
+	return a, nil
+}
+
+// Archive appends the item to the archive files
+func (a *Archiver) Archive(item *Item) error {
+	infoGetter := item.TableInfoGetter
+	if infoGetter == nil {
+		infoGetter = a.tableInfoGetter
+	}
+	pbBinlog, err := translator.TiBinlogToPbBinlog(infoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	data, err := pbBinlog.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err = a.binlogger.WriteTail(&tb.Entity{Payload: data}); err != nil {
+		return errors.Annotate(err, "archive binlog")
+	}
+
+	if time.Since(a.lastPurge) > archivePurgeInterval {
+		a.purge()
+	}
+	return nil
+}
+
+// purge removes the archive files out of the retention, the latest file is always kept
+func (a *Archiver) purge() {
+	a.lastPurge = time.Now()
+	if a.retention <= 0 {
+		return
+	}
+	names, err := binlogfile.ReadBinlogNames(a.dir)
+	if err != nil {
+		log.Error("read archive files failed", zap.String("dir", a.dir), zap.Error(err))
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	for _, name := range names[:len(names)-1] {
+		fileName := path.Join(a.dir, name)
+		fi, err := os.Stat(fileName)
+		if err != nil {
+			log.Error("stat archive file failed", zap.String("file name", fileName), zap.Error(err))
+			continue
+		}
+		if time.Since(fi.ModTime()) <= a.retention {
+			// the files are written in order, so are the ones after it
+			break
+		}
+		if err := os.Remove(fileName); err != nil {
+			log.Error("remove archive file failed", zap.String("file name", fileName), zap.Error(err))
+			continue
+		}
+		log.Info("purge archive file", zap.String("file name", fileName))
+	}
+}
+
+// Close closes the archive files
+func (a *Archiver) Close() error {
+	return errors.Trace(a.binlogger.Close())
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	tb "github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = check.Suite(&archiveSuite{})
+
+type archiveSuite struct{}
+
+func (s *archiveSuite) TestDisabled(c *check.C) {
+	a, err := NewArchiver(&ArchiveConfig{}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(a, check.IsNil)
+}
+
+func (s *archiveSuite) TestArchive(c *check.C) {
+	dir := c.MkDir()
+	gen := &translator.BinlogGenerator{}
+	a, err := NewArchiver(&ArchiveConfig{Dir: dir}, gen)
+	c.Assert(err, check.IsNil)
+
+	gen.SetDDL()
+	err = a.Archive(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	gen.SetInsert(c)
+	err = a.Archive(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV})
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Close(), check.IsNil)
+
+	// the archive files are read as the ones of the file syncer
+	binlogger, err := binlogfile.OpenBinlogger(dir, binlogfile.SegmentSizeBytes)
+	c.Assert(err, check.IsNil)
+	defer binlogger.Close()
+	entities, err := binlogger.ReadFrom(tb.Pos{}, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(entities, check.HasLen, 2)
+
+	var binlog pb.Binlog
+	c.Assert(binlog.Unmarshal(entities[0].Payload), check.IsNil)
+	c.Assert(binlog.Tp, check.Equals, pb.BinlogType_DDL)
+	c.Assert(binlog.Unmarshal(entities[1].Payload), check.IsNil)
+	c.Assert(binlog.Tp, check.Equals, pb.BinlogType_DML)
+	c.Assert(binlog.DmlData.Events, check.HasLen, 1)
+}
+
+func (s *archiveSuite) TestPurge(c *check.C) {
+	dir := c.MkDir()
+	gen := &translator.BinlogGenerator{}
+	// rotated for each binlog
+	a, err := NewArchiver(&ArchiveConfig{Dir: dir, FileSize: 1, RetentionHours: 1}, gen)
+	c.Assert(err, check.IsNil)
+	defer a.Close()
+
+	gen.SetDDL()
+	for i := 0; i < 3; i++ {
+		err = a.Archive(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+		c.Assert(err, check.IsNil)
+	}
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.HasLen, 4)
+
+	// the first two are out of the retention
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range names[:2] {
+		c.Assert(os.Chtimes(path.Join(dir, name), old, old), check.IsNil)
+	}
+	a.purge()
+	purged, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(purged, check.DeepEquals, names[2:])
+}
@@ -14,15 +14,23 @@
 package sync
 
 import (
+	"context"
 	"database/sql"
+	"net"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer/relay"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/encrypt"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	"github.com/pingcap/tidb-binlog/pkg/scrub"
+	tb "github.com/pingcap/tipb/go-binlog"
 )
 
 var _ Syncer = &MysqlSyncer{}
@@ -32,29 +40,149 @@ type MysqlSyncer struct {
 	db      *sql.DB
 	loader  loader.Loader
 	relayer relay.Relayer
+	// nil if the missing tables are not created
+	tables *upstreamTables
 
 	*baseSyncer
 }
 
+// upstreamTables remembers the upstream table id of the tables synced by name,
+// so the missing tables can be created in downstream by the upstream table info.
+type upstreamTables struct {
+	infoGetter translator.TableInfoGetter
+	// [schema, table] -> table id
+	ids sync.Map
+}
+
+func (t *upstreamTables) record(pv *tb.PrewriteValue) {
+	for _, mut := range pv.GetMutations() {
+		schema, table, ok := t.infoGetter.SchemaAndTableName(mut.GetTableId())
+		if ok {
+			t.ids.Store([2]string{schema, table}, mut.GetTableId())
+		}
+	}
+}
+
+// createTableSQL implements loader.TableCreator
+func (t *upstreamTables) createTableSQL(schema string, table string) (string, error) {
+	id, ok := t.ids.Load([2]string{schema, table})
+	if !ok {
+		return "", errors.NotFoundf("upstream table id of %s.%s", schema, table)
+	}
+	info, ok := t.infoGetter.TableByID(id.(int64))
+	if !ok {
+		return "", errors.NotFoundf("upstream table info of %s.%s", schema, table)
+	}
+	return translator.GenCreateTable(info), nil
+}
+
 // should only be used for unit test to create mock db
-var createDB = loader.CreateDBWithSQLMode
+var createDB = loader.CreateDBWithSessionVars
 
 // NewMysqlSyncer returns a instance of MysqlSyncer
-func NewMysqlSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, worker int, batchSize int, queryHistogramVec *prometheus.HistogramVec, sqlMode *string, destDBType string, relayer relay.Relayer) (*MysqlSyncer, error) {
-	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, sqlMode)
+func NewMysqlSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, worker int, batchSize int, metrics *loader.MetricsGroup, sqlMode *string, destDBType string, relayer relay.Relayer, info *loopbacksync.LoopBackSync) (*MysqlSyncer, error) {
+	timeZone, err := cfg.SessionTimeZone()
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	var opts []loader.Option
-	opts = append(opts, loader.WorkerCount(worker), loader.BatchSize(batchSize), loader.SaveAppliedTS(destDBType == "tidb"))
-	if queryHistogramVec != nil {
-		opts = append(opts, loader.Metrics(&loader.MetricsGroup{
-			QueryHistogramVec: queryHistogramVec,
-			EventCounterVec:   nil,
-		}))
+	if cfg.Scrub != nil {
+		scrubber, err := scrub.New(cfg.Scrub)
+		if err != nil {
+			return nil, errors.Annotate(err, "create scrub transform failed")
+		}
+		opts = append(opts, loader.Transforms(scrubber.Transform))
+	}
+	var transformer *encrypt.Transformer
+	if cfg.Encryption != nil {
+		transformer, err = encrypt.New(cfg.Encryption)
+		if err != nil {
+			return nil, errors.Annotate(err, "create encryption transform failed")
+		}
+		opts = append(opts, loader.Transforms(transformer.Transform))
+	}
+
+	var sessionVars map[string]string
+	if cfg.OptimizeForTiDB {
+		sessionVars = loader.TiDBSessionVars
+	}
+
+	password, err := cfg.GetPassword()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	db, err := createDB(cfg.User, password, cfg.Host, cfg.Port, sqlMode, timeZone, sessionVars)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if transformer != nil {
+		if err = transformer.CheckColumns(db); err != nil {
+			db.Close()
+			return nil, errors.Annotate(err, "check the columns to encrypt failed")
+		}
+	}
+
+	opts = append(opts, loader.WorkerCount(worker), loader.BatchSize(batchSize), loader.SaveAppliedTS(destDBType == "tidb"), loader.OptimizeForTiDB(cfg.OptimizeForTiDB))
+	opts = append(opts, cfg.ApplyConfig.Options()...)
+	var tables *upstreamTables
+	if cfg.AutoCreateTable {
+		tables = &upstreamTables{infoGetter: tableInfoGetter}
+		opts = append(opts, loader.AutoCreateTable(tables.createTableSQL))
+	}
+	if metrics != nil {
+		opts = append(opts, loader.Metrics(metrics))
+	}
+	if info != nil {
+		opts = append(opts, loader.LoopbackSync(info))
+	}
+	if cfg.StatsInterval > 0 {
+		schema := cfg.Checkpoint.Schema
+		if len(schema) == 0 {
+			schema = "tidb_binlog"
+		}
+		opts = append(opts, loader.ExportStats(schema, time.Duration(cfg.StatsInterval)*time.Second))
+	}
+	if cfg.FencingLease > 0 {
+		schema := cfg.Checkpoint.Schema
+		if len(schema) == 0 {
+			schema = "tidb_binlog"
+		}
+		name := cfg.FencingName
+		if len(name) == 0 {
+			name = strconv.FormatUint(cfg.ClusterID, 10)
+		}
+		opts = append(opts, loader.Fencing(schema, name, cfg.NodeID, time.Duration(cfg.FencingLease)*time.Second))
+	}
+	if cfg.ProbeCommit {
+		schema := cfg.Checkpoint.Schema
+		if len(schema) == 0 {
+			schema = "tidb_binlog"
+		}
+		name := cfg.NodeID
+		if len(name) == 0 {
+			name = strconv.FormatUint(cfg.ClusterID, 10)
+		}
+		opts = append(opts, loader.ProbeCommit(schema, name))
+	}
+	if cfg.CaptureGTID {
+		opts = append(opts, loader.CaptureGTID(true))
 	}
 
+	addrs := append([]string{net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))}, cfg.FailoverAddrs...)
+	opts = append(opts, loader.Reconnect(func(addr string) (*sql.DB, error) {
+		host, port, err := parseHostPort(addr)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// read the password again, it may have been rotated
+		password, err := cfg.GetPassword()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return createDB(cfg.User, password, host, port, sqlMode, timeZone, sessionVars)
+	}, addrs...))
+
 	loader, err := loader.NewLoader(db, opts...)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -64,6 +192,7 @@ func NewMysqlSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, w
 		db:         db,
 		loader:     loader,
 		relayer:    relayer,
+		tables:     tables,
 		baseSyncer: newBaseSyncer(tableInfoGetter),
 	}
 
@@ -77,6 +206,60 @@ func (m *MysqlSyncer) SetSafeMode(mode bool) {
 	m.loader.SetSafeMode(mode)
 }
 
+// SetWorkerCount changes the worker count of the loader
+func (m *MysqlSyncer) SetWorkerCount(n int) {
+	m.loader.SetWorkerCount(n)
+}
+
+// SetBatchSize changes the batch size of the loader
+func (m *MysqlSyncer) SetBatchSize(n int) {
+	m.loader.SetBatchSize(n)
+}
+
+// TableStatus returns the replication status of the tables synced
+func (m *MysqlSyncer) TableStatus() []loader.TableStatus {
+	return m.loader.TableStatus()
+}
+
+// Watermark returns the progress of the txns applied in downstream, see loader.Watermark
+func (m *MysqlSyncer) Watermark() loader.Watermark {
+	return m.loader.Watermark()
+}
+
+// QueueSizes returns the numbers of the txns in the input and the successes queues of the loader
+func (m *MysqlSyncer) QueueSizes() (input int, successes int) {
+	return len(m.loader.Input()), len(m.loader.Successes())
+}
+
+// DB returns the downstream db, e.g., to maintain the recycle bin
+func (m *MysqlSyncer) DB() *sql.DB {
+	return m.db
+}
+
+// PauseTable buffers the DMLs of the table while the others are synced, see loader.Loader.PauseTable
+func (m *MysqlSyncer) PauseTable(database string, table string) {
+	m.loader.PauseTable(database, table)
+}
+
+// ResumeTable applies the DMLs buffered of the table and syncs it again
+func (m *MysqlSyncer) ResumeTable(database string, table string) {
+	m.loader.ResumeTable(database, table)
+}
+
+// RecordTable remembers the upstream table id of the table not synced yet, so it can be created in downstream
+// if auto-create-table is enabled, e.g., before it's copied by CopySnapshot
+func (m *MysqlSyncer) RecordTable(database string, table string, id int64) {
+	if m.tables != nil {
+		m.tables.ids.Store([2]string{database, table}, id)
+	}
+}
+
+// CopySnapshot copies the tables from the snapshot of upstream at ts and syncs their binlogs after it,
+// see loader.Loader.CopySnapshot
+func (m *MysqlSyncer) CopySnapshot(ctx context.Context, upstream *sql.DB, ts int64, tables ...filter.TableName) (int64, error) {
+	return m.loader.CopySnapshot(ctx, upstream, ts, tables...)
+}
+
 // Sync implements Syncer interface
 func (m *MysqlSyncer) Sync(item *Item) error {
 	// `relayer` is nil if relay log is disabled.
@@ -88,13 +271,30 @@ func (m *MysqlSyncer) Sync(item *Item) error {
 		item.RelayLogPos = pos
 	}
 
-	txn, err := translator.TiBinlogToTxn(m.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	txn, err := m.translate(item)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	return errors.Trace(m.syncTxn(txn))
+}
 
+// translate translates the item into the txn applied by the loader
+func (m *MysqlSyncer) translate(item *Item) (*loader.Txn, error) {
+	txn, err := translator.TiBinlogToTxn(m.infoGetter(item), item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if m.tables != nil {
+		m.tables.record(item.PrewriteValue)
+	}
+
+	txn.CommitTS = item.Binlog.CommitTs
 	txn.Metadata = item
+	return txn, nil
+}
 
+// syncTxn adds the txn to the loader, the Metadata of txn must be the *Item reported by Successes
+func (m *MysqlSyncer) syncTxn(txn *loader.Txn) error {
 	select {
 	case <-m.errCh:
 		return m.err
@@ -119,6 +319,18 @@ func (m *MysqlSyncer) Close() error {
 	return err
 }
 
+func parseHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, errors.Annotatef(err, "invalid address %s", addr)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, errors.Annotatef(err, "invalid port of address %s", addr)
+	}
+	return host, port, nil
+}
+
 func (m *MysqlSyncer) run() {
 	var wg sync.WaitGroup
 
@@ -130,6 +342,7 @@ func (m *MysqlSyncer) run() {
 		for txn := range m.loader.Successes() {
 			item := txn.Metadata.(*Item)
 			item.AppliedTS = txn.AppliedTS
+			item.GTIDSet = txn.GTIDSet
 			if m.relayer != nil {
 				m.relayer.GCBinlog(item.RelayLogPos)
 			}
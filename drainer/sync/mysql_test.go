@@ -168,3 +168,19 @@ func (s *mysqlSuite) TestMySQLSyncerWithRelayer(c *check.C) {
 	// The previous files should be removed.
 	c.Assert(len(names), check.Equals, 2)
 }
+
+func (s *mysqlSuite) TestUpstreamTables(c *check.C) {
+	gen := translator.BinlogGenerator{}
+	gen.SetInsert(c)
+
+	tables := &upstreamTables{infoGetter: &gen}
+	_, err := tables.createTableSQL("test", "hasid")
+	c.Assert(errors.IsNotFound(err), check.IsTrue)
+
+	tables.record(gen.PV)
+	schema, table, ok := gen.SchemaAndTableName(gen.PV.Mutations[0].GetTableId())
+	c.Assert(ok, check.IsTrue)
+	sql, err := tables.createTableSQL(schema, table)
+	c.Assert(err, check.IsNil)
+	c.Assert(sql, check.Matches, "(?s)CREATE TABLE IF NOT EXISTS `account` .*PRIMARY KEY \\(`ID`\\).*")
+}
@@ -45,7 +45,7 @@ func NewPBSyncer(dir string, tableInfoGetter translator.TableInfoGetter) (*pbSyn
 }
 
 func (p *pbSyncer) Sync(item *Item) error {
-	pbBinlog, err := translator.TiBinlogToPbBinlog(p.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	pbBinlog, err := translator.TiBinlogToPbBinlog(p.infoGetter(item), item.Schema, item.Table, item.Binlog, item.PrewriteValue)
 	if err != nil {
 		return errors.Trace(err)
 	}
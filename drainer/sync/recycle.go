@@ -0,0 +1,154 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+// the interval of checking the recycled tables to drop
+var recyclePurgeInterval = time.Minute
+
+// the suffix of the recycled tables kept, the max length of the table names of mysql
+const (
+	keptTableSuffix = "_kept"
+	maxTableNameLen = 64
+)
+
+// the recycled tables are named <table>_<commit ts of the DDL>
+var recycledTableRegexp = regexp.MustCompile(`_(\d+)$`)
+
+// RecycledTable is a table moved to the recycle schema in downstream by a DROP TABLE or TRUNCATE TABLE
+type RecycledTable struct {
+	Name string `json:"name"`
+	// the commit ts of the DDL recycling it
+	CommitTS int64 `json:"commit-ts"`
+	// the time it's dropped after, nil if it's kept
+	DropTime *time.Time `json:"drop-time"`
+}
+
+// RecycleBin drops the tables in the recycle schema of downstream once the grace period passes since they're
+// recycled, which is found by the commit ts suffix of their names. The tables kept by Keep are renamed with the
+// suffix "_kept", so all the state is in downstream and it survives the restarts of drainer.
+type RecycleBin struct {
+	db     *sql.DB
+	schema string
+	grace  time.Duration
+}
+
+// NewRecycleBin returns a RecycleBin of the recycle schema in the downstream db
+func NewRecycleBin(db *sql.DB, schema string, grace time.Duration) *RecycleBin {
+	return &RecycleBin{db: db, schema: schema, grace: grace}
+}
+
+// Tables returns the tables in the recycle bin
+func (b *RecycleBin) Tables(ctx context.Context) ([]RecycledTable, error) {
+	rows, err := b.db.QueryContext(ctx, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", b.schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var tables []RecycledTable
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Trace(err)
+		}
+		tables = append(tables, b.recycledTable(name))
+	}
+	return tables, errors.Trace(rows.Err())
+}
+
+func (b *RecycleBin) recycledTable(name string) RecycledTable {
+	table := RecycledTable{Name: name}
+	matches := recycledTableRegexp.FindStringSubmatch(name)
+	if matches == nil {
+		// kept, or created by others
+		return table
+	}
+	table.CommitTS, _ = strconv.ParseInt(matches[1], 10, 64)
+	dropTime := oracle.GetTimeFromTS(uint64(table.CommitTS)).Add(b.grace)
+	table.DropTime = &dropTime
+	return table
+}
+
+// Keep cancels dropping the table, it's kept in the recycle schema until it's removed by hand
+func (b *RecycleBin) Keep(ctx context.Context, name string) error {
+	if !recycledTableRegexp.MatchString(name) {
+		return errors.Errorf("%s is not a table waiting to be dropped", name)
+	}
+	kept := name
+	if len(kept)+len(keptTableSuffix) > maxTableNameLen {
+		kept = kept[:maxTableNameLen-len(keptTableSuffix)]
+	}
+	kept += keptTableSuffix
+
+	sql := fmt.Sprintf("RENAME TABLE %s TO %s", pkgsql.QuoteSchema(b.schema, name), pkgsql.QuoteSchema(b.schema, kept))
+	if _, err := b.db.ExecContext(ctx, sql); err != nil {
+		return errors.Annotatef(err, "keep recycled table %s", name)
+	}
+	log.Info("keep recycled table", zap.String("schema", b.schema), zap.String("table", name), zap.String("kept", kept))
+	return nil
+}
+
+// Purge drops the tables whose grace period has passed
+func (b *RecycleBin) Purge(ctx context.Context) error {
+	tables, err := b.Tables(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	now := time.Now()
+	for _, table := range tables {
+		if table.DropTime == nil || table.DropTime.After(now) {
+			continue
+		}
+		sql := fmt.Sprintf("DROP TABLE %s", pkgsql.QuoteSchema(b.schema, table.Name))
+		if _, err := b.db.ExecContext(ctx, sql); err != nil {
+			return errors.Annotatef(err, "drop recycled table %s", table.Name)
+		}
+		log.Info("drop recycled table", zap.String("schema", b.schema), zap.String("table", table.Name),
+			zap.Int64("commit ts", table.CommitTS))
+	}
+	return nil
+}
+
+// Run purges the recycle bin periodically until ctx is done
+func (b *RecycleBin) Run(ctx context.Context) {
+	ticker := time.NewTicker(recyclePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.Purge(ctx); err != nil && ctx.Err() == nil {
+			log.Warn("purge recycle bin failed", zap.String("schema", b.schema), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+var _ = check.Suite(&recycleSuite{})
+
+type recycleSuite struct{}
+
+func (s *recycleSuite) TestPurge(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	old := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-2*time.Hour)), 0)
+	recent := oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)
+	oldName := "t1_" + strconv.FormatUint(old, 10)
+	recentName := "t2_" + strconv.FormatUint(recent, 10)
+
+	bin := NewRecycleBin(db, "recycle", time.Hour)
+	mock.ExpectQuery("SELECT TABLE_NAME FROM information_schema.TABLES").WithArgs("recycle").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow(oldName).AddRow(recentName).AddRow("t3_1_kept"))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE `recycle`.`" + oldName + "`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(bin.Purge(context.Background()), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	mock.ExpectQuery("SELECT TABLE_NAME FROM information_schema.TABLES").WithArgs("recycle").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow(recentName).AddRow("t3_1_kept"))
+	tables, err := bin.Tables(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(tables, check.HasLen, 2)
+	c.Assert(tables[0].CommitTS, check.Equals, int64(recent))
+	c.Assert(tables[0].DropTime.After(time.Now().Add(50*time.Minute)), check.IsTrue)
+	c.Assert(tables[1].DropTime, check.IsNil)
+}
+
+func (s *recycleSuite) TestKeep(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	bin := NewRecycleBin(db, "recycle", time.Hour)
+	c.Assert(bin.Keep(context.Background(), "t1_kept"), check.ErrorMatches, ".*not a table waiting to be dropped.*")
+
+	mock.ExpectExec(regexp.QuoteMeta("RENAME TABLE `recycle`.`t1_415` TO `recycle`.`t1_415_kept`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(bin.Keep(context.Background(), "t1_415"), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,270 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+)
+
+// ShardingConfig splits the rows of the tables into the shards written to several downstreams, only for mysql/tidb
+type ShardingConfig struct {
+	// the addresses (host:port) of the downstreams other than the one of [syncer.to], which is the downstream 0,
+	// they're connected by the user and password of [syncer.to]
+	Downstreams []string           `toml:"downstreams" json:"downstreams"`
+	Rules       []loader.ShardRule `toml:"rule" json:"rule"`
+}
+
+// Validate checks the addresses and the rules are valid
+func (c *ShardingConfig) Validate() error {
+	for _, addr := range c.Downstreams {
+		if _, _, err := parseHostPort(addr); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	_, err := loader.NewShardRouter(len(c.Downstreams)+1, c.Rules...)
+	return errors.Trace(err)
+}
+
+// ShardSyncer syncs the binlogs into several downstreams by the shard rules, each of them is synced by a MysqlSyncer.
+// The txns of an item are split by loader.ShardRouter, and the item is reported by Successes after its txns are
+// applied in all the downstreams, in the order they're synced. The txns of different downstreams aren't atomic.
+type ShardSyncer struct {
+	shards []*MysqlSyncer
+	router *loader.ShardRouter
+
+	// the items not applied in all their downstreams in the order synced, and the ones of each downstream,
+	// protected by mu
+	mu      sync.Mutex
+	pending []*shardItem
+	queues  [][]*shardItem
+
+	*baseSyncer
+}
+
+// shardItem is an item with the number of its txns not applied yet
+type shardItem struct {
+	item      *Item
+	remaining int
+}
+
+// NewShardSyncer returns a ShardSyncer of the downstream of cfg and the ones of cfg.Sharding, the arguments are
+// the ones of NewMysqlSyncer. The relay log isn't supported.
+func NewShardSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, worker int, batchSize int, metrics *loader.MetricsGroup, sqlMode *string, destDBType string, info *loopbacksync.LoopBackSync) (*ShardSyncer, error) {
+	router, err := loader.NewShardRouter(len(cfg.Sharding.Downstreams)+1, cfg.Sharding.Rules...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var shards []*MysqlSyncer
+	closeShards := func() {
+		for _, shard := range shards {
+			shard.Close()
+		}
+	}
+	for i := 0; i <= len(cfg.Sharding.Downstreams); i++ {
+		shardCfg := *cfg
+		if i > 0 {
+			host, port, err := parseHostPort(cfg.Sharding.Downstreams[i-1])
+			if err != nil {
+				closeShards()
+				return nil, errors.Trace(err)
+			}
+			shardCfg.Host, shardCfg.Port, shardCfg.FailoverAddrs = host, port, nil
+		}
+		shard, err := NewMysqlSyncer(&shardCfg, tableInfoGetter, worker, batchSize, metrics, sqlMode, destDBType, nil, info)
+		if err != nil {
+			closeShards()
+			return nil, errors.Annotatef(err, "create the syncer of downstream %d", i)
+		}
+		shards = append(shards, shard)
+	}
+
+	s := newShardSyncer(shards, router, tableInfoGetter)
+	go s.run()
+	return s, nil
+}
+
+func newShardSyncer(shards []*MysqlSyncer, router *loader.ShardRouter, tableInfoGetter translator.TableInfoGetter) *ShardSyncer {
+	return &ShardSyncer{
+		shards:     shards,
+		router:     router,
+		queues:     make([][]*shardItem, len(shards)),
+		baseSyncer: newBaseSyncer(tableInfoGetter),
+	}
+}
+
+// SetSafeMode makes all the downstreams use safe mode or not
+func (s *ShardSyncer) SetSafeMode(mode bool) {
+	for _, shard := range s.shards {
+		shard.SetSafeMode(mode)
+	}
+}
+
+// SetWorkerCount changes the worker count of the loaders of all the downstreams
+func (s *ShardSyncer) SetWorkerCount(n int) {
+	for _, shard := range s.shards {
+		shard.SetWorkerCount(n)
+	}
+}
+
+// SetBatchSize changes the batch size of the loaders of all the downstreams
+func (s *ShardSyncer) SetBatchSize(n int) {
+	for _, shard := range s.shards {
+		shard.SetBatchSize(n)
+	}
+}
+
+// TableStatus returns the replication status of the tables synced of all the downstreams
+func (s *ShardSyncer) TableStatus() []loader.TableStatus {
+	var status []loader.TableStatus
+	for _, shard := range s.shards {
+		status = append(status, shard.TableStatus()...)
+	}
+	return status
+}
+
+// Sync implements Syncer interface
+func (s *ShardSyncer) Sync(item *Item) error {
+	for _, shard := range s.shards[1:] {
+		if shard.tables != nil {
+			shard.tables.record(item.PrewriteValue)
+		}
+	}
+	txn, err := s.shards[0].translate(item)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	split, err := s.router.Split(txn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the item without any txn, e.g., all its DMLs are filtered, is reported after the ones before it
+	// by an empty txn
+	empty := true
+	for _, txns := range split {
+		empty = empty && len(txns) == 0
+	}
+	if empty {
+		t := *txn
+		t.DMLs = nil
+		split[0] = []*loader.Txn{&t}
+	}
+
+	p := &shardItem{item: item}
+	s.mu.Lock()
+	s.pending = append(s.pending, p)
+	for i, txns := range split {
+		for range txns {
+			s.queues[i] = append(s.queues[i], p)
+			p.remaining++
+		}
+	}
+	s.mu.Unlock()
+
+	// the downstreams other than 0 report their own copies of the item, so the AppliedTS and GTIDSet
+	// of the item are the ones of the downstream 0. The copies are made before any txn is sent, as
+	// the item is written once the txn of the downstream 0 is applied.
+	for i := 1; i < len(split); i++ {
+		for _, t := range split[i] {
+			shardItem := *item
+			t.Metadata = &shardItem
+		}
+	}
+	for i, txns := range split {
+		for _, t := range txns {
+			if err := s.shards[i].syncTxn(t); err != nil {
+				return errors.Annotatef(err, "sync downstream %d", i)
+			}
+		}
+	}
+	return nil
+}
+
+// applied records a txn is applied in the downstream, and returns the items applied in all their downstreams
+func (s *ShardSyncer) applied(shard int) []*Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues[shard][0].remaining--
+	s.queues[shard] = s.queues[shard][1:]
+
+	var items []*Item
+	for len(s.pending) > 0 && s.pending[0].remaining == 0 {
+		items = append(items, s.pending[0].item)
+		s.pending = s.pending[1:]
+	}
+	return items
+}
+
+func (s *ShardSyncer) run() {
+	applied := make(chan int)
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard *MysqlSyncer) {
+			defer wg.Done()
+			for range shard.Successes() {
+				applied <- i
+			}
+		}(i, shard)
+	}
+	go func() {
+		wg.Wait()
+		close(applied)
+	}()
+
+	// report the error of any downstream at once, so the others are closed by Close
+	var errOnce sync.Once
+	for _, shard := range s.shards {
+		go func(errCh <-chan error) {
+			if err := <-errCh; err != nil {
+				errOnce.Do(func() { s.setErr(err) })
+			}
+		}(shard.Error())
+	}
+
+	for i := range applied {
+		for _, item := range s.applied(i) {
+			s.success <- item
+		}
+	}
+	close(s.success)
+	log.Info("Successes chan of shard syncer quit")
+
+	var err error
+	for _, shard := range s.shards {
+		if shardErr := <-shard.Error(); shardErr != nil && err == nil {
+			err = shardErr
+		}
+	}
+	errOnce.Do(func() { s.setErr(err) })
+}
+
+// Close implements Syncer interface
+func (s *ShardSyncer) Close() error {
+	var err error
+	for i, shard := range s.shards {
+		if closeErr := shard.Close(); closeErr != nil && err == nil {
+			err = errors.Annotatef(closeErr, "downstream %d", i)
+		}
+	}
+	<-s.Error()
+	return err
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+var _ = check.Suite(&shardSuite{})
+
+type shardSuite struct{}
+
+// fakeShardLoader applies the txns after they're released
+type fakeShardLoader struct {
+	loader.Loader
+	input     chan *loader.Txn
+	successes chan *loader.Txn
+	release   chan struct{}
+	applied   chan *loader.Txn
+}
+
+func newFakeShardLoader(gated bool) *fakeShardLoader {
+	l := &fakeShardLoader{
+		input:     make(chan *loader.Txn, 8),
+		successes: make(chan *loader.Txn, 8),
+		applied:   make(chan *loader.Txn, 8),
+	}
+	if gated {
+		l.release = make(chan struct{})
+	}
+	return l
+}
+
+func (l *fakeShardLoader) Input() chan<- *loader.Txn {
+	return l.input
+}
+
+func (l *fakeShardLoader) Run() error {
+	for txn := range l.input {
+		if l.release != nil {
+			<-l.release
+		}
+		l.applied <- txn
+		l.successes <- txn
+	}
+	close(l.successes)
+	return nil
+}
+
+func (l *fakeShardLoader) Successes() <-chan *loader.Txn {
+	return l.successes
+}
+
+func (l *fakeShardLoader) Close() {
+	close(l.input)
+}
+
+func (s *shardSuite) TestValidate(c *check.C) {
+	cfg := &ShardingConfig{Downstreams: []string{"127.0.0.1"}}
+	c.Assert(cfg.Validate(), check.ErrorMatches, "invalid address 127.0.0.1.*")
+
+	cfg.Downstreams = []string{"127.0.0.1:4000"}
+	cfg.Rules = []loader.ShardRule{{Schema: "db", Table: "t", Columns: []string{"id"}, Method: loader.ShardMod, Shards: 2}}
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*must have \\{shard\\}")
+	cfg.Rules[0].TargetTable = "t_{shard}"
+	c.Assert(cfg.Validate(), check.IsNil)
+}
+
+func (s *shardSuite) TestSyncInOrder(c *check.C) {
+	var infoGetter translator.TableInfoGetter
+	loaders := []*fakeShardLoader{newFakeShardLoader(false), newFakeShardLoader(true)}
+	var shards []*MysqlSyncer
+	for _, ld := range loaders {
+		db, _, err := sqlmock.New()
+		c.Assert(err, check.IsNil)
+		shard := &MysqlSyncer{db: db, loader: ld, baseSyncer: newBaseSyncer(infoGetter)}
+		go shard.run()
+		shards = append(shards, shard)
+	}
+	router, err := loader.NewShardRouter(2, loader.ShardRule{Schema: "test", Table: "test", Columns: []string{"id"},
+		Method: loader.ShardMod, Shards: 4, TargetTable: "test_{shard}"})
+	c.Assert(err, check.IsNil)
+	syncer := newShardSyncer(shards, router, infoGetter)
+	go syncer.run()
+
+	gen := translator.BinlogGenerator{}
+	gen.SetDDL()
+	sharded := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	other := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: "other"}
+	c.Assert(syncer.Sync(sharded), check.IsNil)
+	c.Assert(syncer.Sync(other), check.IsNil)
+
+	// the DDL of the sharded table is executed for each shard, the other one only in the downstream 0
+	var tables []string
+	for i := 0; i < 3; i++ {
+		txn := <-loaders[0].applied
+		tables = append(tables, txn.DDL.Table)
+	}
+	c.Assert(tables, check.DeepEquals, []string{"test_0", "test_2", "other"})
+
+	// the items wait for the downstream 1
+	select {
+	case <-syncer.Successes():
+		c.Fatal("the item is reported before it's applied in all the downstreams")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(loaders[1].release)
+	for _, expected := range []*Item{sharded, other} {
+		select {
+		case item := <-syncer.Successes():
+			c.Assert(item, check.Equals, expected)
+		case <-time.After(time.Second):
+			c.Fatal("the item isn't reported in 1s after it's applied")
+		}
+	}
+	tables = nil
+	for i := 0; i < 2; i++ {
+		txn := <-loaders[1].applied
+		tables = append(tables, txn.DDL.Table)
+		c.Assert(txn.Metadata, check.Not(check.Equals), sharded)
+	}
+	c.Assert(tables, check.DeepEquals, []string{"test_1", "test_3"})
+
+	c.Assert(syncer.Close(), check.IsNil)
+}
@@ -26,8 +26,13 @@ type Item struct {
 	Table         string
 	RelayLogPos   pb.Pos
 
+	// the table infos at the schema version of the DML, the syncer's is used if it's nil, only for DML
+	TableInfoGetter translator.TableInfoGetter
+
 	// the applied TS executed in downstream, only for tidb
 	AppliedTS int64
+	// the GTID set executed in downstream after the item is committed, only for mysql with capture-gtid
+	GTIDSet string
 }
 
 // Syncer sync binlog item to downstream
@@ -56,6 +61,14 @@ func newBaseSyncer(tableInfoGetter translator.TableInfoGetter) *baseSyncer {
 	}
 }
 
+// infoGetter returns the TableInfoGetter to translate the item with
+func (s *baseSyncer) infoGetter(item *Item) translator.TableInfoGetter {
+	if item.TableInfoGetter != nil {
+		return item.TableInfoGetter
+	}
+	return s.tableInfoGetter
+}
+
 // Successes implements Syncer interface
 func (s *baseSyncer) Successes() <-chan *Item {
 	return s.success
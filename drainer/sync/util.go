@@ -16,6 +16,11 @@ package sync
 import (
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/encrypt"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/scrub"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 )
 
 // DBConfig is the DB configuration.
@@ -24,8 +29,42 @@ type DBConfig struct {
 	User          string           `toml:"user" json:"user"`
 	Password      string           `toml:"password" json:"password"`
 	Port          int              `toml:"port" json:"port"`
+	FailoverAddrs []string         `toml:"failover-addrs" json:"failover-addrs"`
 	Checkpoint    CheckpointConfig `toml:"checkpoint" json:"checkpoint"`
 	BinlogFileDir string           `toml:"dir" json:"dir"`
+	// read the password from the environment variable, the file or the command instead of `password`,
+	// it's read again when reconnecting, so the rotated password is picked up, only for mysql/tidb
+	PasswordFrom *secret.Source `toml:"password-from" json:"password-from"`
+	// the time zone TIMESTAMP values are decoded into, it's also the session time zone
+	// of the downstream mysql/tidb, empty means the local time zone and the server default.
+	TimeZone string `toml:"time-zone" json:"time-zone"`
+	// the columns encrypted before written to downstream, or decrypted, only for mysql/tidb
+	Encryption *encrypt.Config `toml:"encryption" json:"encryption"`
+	// the columns anonymized before written to downstream, before they're encrypted, only for mysql/tidb
+	Scrub *scrub.Config `toml:"scrub" json:"scrub"`
+	// create the tables missing in downstream by the upstream table info, only for mysql/tidb
+	AutoCreateTable bool `toml:"auto-create-table" json:"auto-create-table"`
+	// set the session variables and retry the conflicts optimized for TiDB, only for tidb
+	OptimizeForTiDB bool `toml:"optimize-for-tidb" json:"optimize-for-tidb"`
+	// read the GTID set executed in downstream after each batch and save it with the checkpoint, only for mysql
+	CaptureGTID bool `toml:"capture-gtid" json:"capture-gtid"`
+	// in seconds, write the applied row counts and commit ts of each table into `_loader_stats` of the checkpoint
+	// schema in downstream every interval, 0 means disabled, only for mysql/tidb
+	StatsInterval int `toml:"stats-interval" json:"stats-interval"`
+	// in seconds, the lease of the fence in `_loader_fence` of the checkpoint schema in downstream, the drainer
+	// taken over by another one with the same fencing name stops applying, 0 means disabled, only for mysql/tidb
+	FencingLease int `toml:"fencing-lease" json:"fencing-lease"`
+	// the name of the fence, empty means the cluster ID
+	FencingName string `toml:"fencing-name" json:"fencing-name"`
+	// write a marker in `_loader_txn_marker` of the checkpoint schema in each txn, and read it when the commit fails
+	// by a broken connection to tell whether the txn is committed before retrying it, only for mysql/tidb
+	ProbeCommit bool `toml:"probe-commit" json:"probe-commit"`
+	// split the rows of the sharded tables into several downstreams, only for mysql/tidb
+	Sharding *ShardingConfig `toml:"sharding" json:"sharding"`
+	// post the changes matched to the webhook, only for webhook
+	Webhook *WebhookConfig `toml:"webhook" json:"webhook"`
+	// how the DMLs are applied, shared with reparo, only for mysql/tidb
+	loader.ApplyConfig
 
 	ZKAddrs          string `toml:"zookeeper-addrs" json:"zookeeper-addrs"`
 	KafkaAddrs       string `toml:"kafka-addrs" json:"kafka-addrs"`
@@ -34,6 +73,22 @@ type DBConfig struct {
 	TopicName        string `toml:"topic-name" json:"topic-name"`
 	// get it from pd
 	ClusterID uint64 `toml:"-" json:"-"`
+	// the ID of the drainer node, it owns the fence
+	NodeID string `toml:"-" json:"-"`
+}
+
+// GetPassword returns the password of downstream, it's read from PasswordFrom if it's set.
+func (c *DBConfig) GetPassword() (string, error) {
+	return secret.Password(c.Password, c.PasswordFrom)
+}
+
+// SessionTimeZone returns the time zone to set for the sessions of downstream,
+// it's empty if the time zone is not configured.
+func (c *DBConfig) SessionTimeZone() (string, error) {
+	if len(c.TimeZone) == 0 {
+		return "", nil
+	}
+	return util.SessionTimeZone(c.TimeZone)
 }
 
 // CheckpointConfig is the Checkpoint configuration.
@@ -44,6 +99,8 @@ type CheckpointConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
 	Port     int    `toml:"port" json:"port"`
+	// read the password from the environment variable, the file or the command instead of `password`
+	PasswordFrom *secret.Source `toml:"password-from" json:"password-from"`
 }
 
 type baseError struct {
@@ -0,0 +1,311 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWebhookTimeout    = 10
+	defaultWebhookMaxRetries = 3
+	webhookBackoff           = time.Second
+	maxWebhookBackoff        = 30 * time.Second
+
+	// WebhookSignatureHeader is the header of the HMAC-SHA256 of the body keyed by the secret, "sha256=<hex>"
+	WebhookSignatureHeader = "X-Binlog-Signature"
+	// WebhookCommitTSHeader is the header of the commit ts of the txn, the receiver can skip the ones delivered
+	WebhookCommitTSHeader = "X-Binlog-Commit-TS"
+)
+
+var _ Syncer = &webhookSyncer{}
+
+// WebhookRule selects the changes notified, the empty Schema or Table matches any. Ops are "insert", "update" and
+// "delete", empty means all of them. The updates are notified only if any of Columns is changed if it's set, and
+// the changes are notified only if the row, i.e., the row after the insert or update or the row deleted, has the
+// values of Equals, compared as strings.
+type WebhookRule struct {
+	Schema  string            `toml:"db-name" json:"db-name"`
+	Table   string            `toml:"tbl-name" json:"tbl-name"`
+	Ops     []string          `toml:"ops" json:"ops"`
+	Columns []string          `toml:"columns" json:"columns"`
+	Equals  map[string]string `toml:"equals" json:"equals"`
+}
+
+// WebhookConfig is the config of the webhook, the db-type which posts the changes matched by the rules to URL
+// instead of writing them into a downstream.
+type WebhookConfig struct {
+	URL string `toml:"url" json:"url"`
+	// the environment variable of the secret signing the body, empty means the body isn't signed
+	SecretEnv string `toml:"secret-env" json:"secret-env"`
+	// in seconds, the timeout of each post, 0 means the default
+	Timeout int `toml:"timeout" json:"timeout"`
+	// the retries of a failed post before drainer quits, 0 means the default
+	MaxRetries int           `toml:"max-retries" json:"max-retries"`
+	Rules      []WebhookRule `toml:"rule" json:"rule"`
+}
+
+// Validate checks whether the config is valid, the secret is not loaded.
+func (c *WebhookConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.Errorf("invalid url %q, it must be a http or https url", c.URL)
+	}
+	if c.Timeout < 0 || c.MaxRetries < 0 {
+		return errors.New("timeout and max-retries can't be negative")
+	}
+	if len(c.Rules) == 0 {
+		return errors.New("no rule is set")
+	}
+	for _, r := range c.Rules {
+		for _, op := range r.Ops {
+			if op != "insert" && op != "update" && op != "delete" {
+				return errors.Errorf("invalid op %s of the rule of `%s`.`%s`, must be insert, update or delete", op, r.Schema, r.Table)
+			}
+		}
+	}
+	return nil
+}
+
+// WebhookEvent is the body posted for a txn having any change matched
+type WebhookEvent struct {
+	CommitTS int64           `json:"commit-ts"`
+	Changes  []WebhookChange `json:"changes"`
+}
+
+// WebhookChange is a change of a row, the binary values are converted to strings
+type WebhookChange struct {
+	Schema string                 `json:"db-name"`
+	Table  string                 `json:"tbl-name"`
+	Op     string                 `json:"op"`
+	Row    map[string]interface{} `json:"row"`
+	OldRow map[string]interface{} `json:"old-row,omitempty"`
+}
+
+type webhookSyncer struct {
+	cfg     *WebhookConfig
+	secret  []byte
+	client  *http.Client
+	backoff time.Duration
+
+	*baseSyncer
+}
+
+// NewWebhookSyncer returns a Syncer posting the changes matched by the rules of cfg, the txns are posted one by one
+// in order, and the ones without any change matched are skipped. A txn failed to post after the retries stops
+// drainer, so the txns are posted at least once.
+func NewWebhookSyncer(cfg *WebhookConfig, tableInfoGetter translator.TableInfoGetter) (*webhookSyncer, error) {
+	if cfg == nil {
+		return nil, errors.New("[syncer.to.webhook] must be set when db-type is webhook")
+	}
+	var secret []byte
+	if len(cfg.SecretEnv) > 0 {
+		secret = []byte(os.Getenv(cfg.SecretEnv))
+		if len(secret) == 0 {
+			return nil, errors.Errorf("the secret of the webhook isn't set in the environment variable %s", cfg.SecretEnv)
+		}
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return newWebhookSyncer(cfg, secret, &http.Client{Timeout: time.Duration(timeout) * time.Second}, webhookBackoff, tableInfoGetter), nil
+}
+
+func newWebhookSyncer(cfg *WebhookConfig, secret []byte, client *http.Client, backoff time.Duration, tableInfoGetter translator.TableInfoGetter) *webhookSyncer {
+	return &webhookSyncer{
+		cfg:        cfg,
+		secret:     secret,
+		client:     client,
+		backoff:    backoff,
+		baseSyncer: newBaseSyncer(tableInfoGetter),
+	}
+}
+
+// Sync implements Syncer interface
+func (w *webhookSyncer) Sync(item *Item) error {
+	if item.Binlog.DdlJobId == 0 {
+		txn, err := translator.TiBinlogToTxn(w.infoGetter(item), item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if changes := w.match(txn); len(changes) > 0 {
+			event := &WebhookEvent{CommitTS: item.Binlog.CommitTs, Changes: changes}
+			if err := w.post(event); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	w.success <- item
+	return nil
+}
+
+// match returns the changes of txn matched by any rule
+func (w *webhookSyncer) match(txn *loader.Txn) []WebhookChange {
+	var changes []WebhookChange
+	for _, dml := range txn.DMLs {
+		for i := range w.cfg.Rules {
+			if !w.cfg.Rules[i].match(dml) {
+				continue
+			}
+			change := WebhookChange{Schema: dml.Database, Table: dml.Table, Op: dml.Tp.String(), Row: jsonRow(dml.Values)}
+			if dml.Tp == loader.UpdateDMLType {
+				change.OldRow = jsonRow(dml.OldValues)
+			}
+			changes = append(changes, change)
+			break
+		}
+	}
+	return changes
+}
+
+func (r *WebhookRule) match(dml *loader.DML) bool {
+	if (len(r.Schema) > 0 && !strings.EqualFold(r.Schema, dml.Database)) || (len(r.Table) > 0 && !strings.EqualFold(r.Table, dml.Table)) {
+		return false
+	}
+	if len(r.Ops) > 0 && !containsString(r.Ops, dml.Tp.String()) {
+		return false
+	}
+	if len(r.Columns) > 0 && dml.Tp == loader.UpdateDMLType {
+		changed := false
+		for _, col := range r.Columns {
+			changed = changed || fmt.Sprint(jsonValue(dml.Values[col])) != fmt.Sprint(jsonValue(dml.OldValues[col]))
+		}
+		if !changed {
+			return false
+		}
+	}
+	for col, value := range r.Equals {
+		v, ok := dml.Values[col]
+		if !ok || v == nil || fmt.Sprint(jsonValue(v)) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonRow returns the row with the binary values converted to strings
+func jsonRow(values map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		row[name] = jsonValue(v)
+	}
+	return row
+}
+
+func jsonValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// post posts the event, it's retried with backoff on the network errors, the timeouts, the throttling and the
+// server errors
+func (w *webhookSyncer) post(event *WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	maxRetries := w.cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultWebhookMaxRetries
+	}
+	backoff := w.backoff
+	for i := 0; ; i++ {
+		retryable, err := w.postOnce(body, event.CommitTS)
+		if err == nil {
+			return nil
+		}
+		if !retryable || i >= maxRetries {
+			return errors.Annotatef(err, "post the webhook of the txn at commit ts %d", event.CommitTS)
+		}
+		log.Warn("post the webhook failed, retry later", zap.Int64("commit ts", event.CommitTS),
+			zap.Int("retry", i+1), zap.Duration("backoff", backoff), zap.Error(err))
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+	}
+}
+
+// postOnce posts body, it returns whether the error can be retried
+func (w *webhookSyncer) postOnce(body []byte, commitTS int64) (retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, strings.NewReader(string(body)))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookCommitTSHeader, strconv.FormatInt(commitTS, 10))
+	if len(w.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	// read the body so the connection is reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retryable, errors.Errorf("the webhook responds %s", resp.Status)
+}
+
+// signWebhook returns the hex of the HMAC-SHA256 of body keyed by secret
+func signWebhook(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Close implements Syncer interface
+func (w *webhookSyncer) Close() error {
+	w.setErr(nil)
+	close(w.success)
+	return w.err
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+var _ = check.Suite(&webhookSuite{})
+
+type webhookSuite struct{}
+
+func (s *webhookSuite) TestValidate(c *check.C) {
+	cfg := &WebhookConfig{URL: "ftp://example.com", Rules: []WebhookRule{{}}}
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*invalid url.*")
+	cfg.URL = "https://example.com/hook"
+	c.Assert(cfg.Validate(), check.IsNil)
+	cfg.Rules[0].Ops = []string{"replace"}
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*invalid op replace.*")
+	cfg.Rules = nil
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*no rule.*")
+}
+
+func (s *webhookSuite) TestMatch(c *check.C) {
+	rule := &WebhookRule{Schema: "test", Table: "orders", Ops: []string{"update"}, Columns: []string{"status"},
+		Equals: map[string]string{"status": "paid"}}
+	update := loader.NewUpdate("test", "orders", map[string]interface{}{"id": 1, "status": []byte("new")},
+		map[string]interface{}{"id": 1, "status": []byte("paid")})
+	c.Assert(rule.match(update), check.IsTrue)
+
+	// the column isn't changed
+	update.OldValues["status"] = []byte("paid")
+	c.Assert(rule.match(update), check.IsFalse)
+	// the value isn't equal
+	update.OldValues["status"], update.Values["status"] = "new", "cancelled"
+	c.Assert(rule.match(update), check.IsFalse)
+
+	c.Assert(rule.match(loader.NewInsert("test", "orders", map[string]interface{}{"status": "paid"})), check.IsFalse)
+	c.Assert(rule.match(loader.NewDelete("test", "users", map[string]interface{}{"status": "paid"})), check.IsFalse)
+	c.Assert((&WebhookRule{}).match(loader.NewDelete("test", "users", nil)), check.IsTrue)
+}
+
+func (s *webhookSuite) TestSync(c *check.C) {
+	var bodies [][]byte
+	var signatures []string
+	responses := []int{http.StatusServiceUnavailable, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		c.Check(r.Header.Get(WebhookCommitTSHeader), check.Equals, "200")
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(WebhookSignatureHeader))
+		w.WriteHeader(responses[0])
+		responses = responses[1:]
+	}))
+	defer server.Close()
+
+	gen := &translator.BinlogGenerator{}
+	cfg := &WebhookConfig{URL: server.URL, Rules: []WebhookRule{{Schema: "test", Ops: []string{"insert"}}}}
+	syncer := newWebhookSyncer(cfg, []byte("secret"), server.Client(), time.Millisecond, gen)
+
+	// the DDLs and the changes not matched aren't posted
+	gen.SetDDL()
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	<-syncer.Successes()
+	gen.SetDelete(c)
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV}), check.IsNil)
+	<-syncer.Successes()
+	c.Assert(bodies, check.HasLen, 0)
+
+	// posted again after the server error
+	gen.SetInsert(c)
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV}), check.IsNil)
+	<-syncer.Successes()
+	c.Assert(bodies, check.HasLen, 2)
+	c.Assert(signatures[1], check.Equals, "sha256="+signWebhook([]byte("secret"), bodies[1]))
+
+	var event WebhookEvent
+	c.Assert(json.Unmarshal(bodies[1], &event), check.IsNil)
+	c.Assert(event.CommitTS, check.Equals, int64(200))
+	c.Assert(event.Changes, check.HasLen, 1)
+	c.Assert(event.Changes[0].Schema, check.Equals, "test")
+	c.Assert(event.Changes[0].Table, check.Equals, "account")
+	c.Assert(event.Changes[0].Op, check.Equals, "insert")
+	c.Assert(event.Changes[0].OldRow, check.IsNil)
+
+	// the client errors aren't retried
+	responses = []int{http.StatusBadRequest}
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV}), check.ErrorMatches, ".*400 Bad Request.*")
+	c.Assert(bodies, check.HasLen, 3)
+
+	c.Assert(syncer.Close(), check.IsNil)
+}
@@ -14,7 +14,9 @@
 package drainer
 
 import (
+	"context"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -22,12 +24,15 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/drainer/relay"
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
@@ -36,21 +41,65 @@ import (
 // normally, we take record if it takes longer than this value.
 var runWaitThreshold = 10 * time.Second
 
+var errReloadSuperseded = errors.New("the config is superseded by a later reload before it's applied")
+
+// reloadRequest is a reloaded config sent to run, done is closed once it's applied or replaced by a later one,
+// err is set to errReloadSuperseded before if it's replaced.
+type reloadRequest struct {
+	cfg  *SyncerConfig
+	done chan struct{}
+	err  error
+}
+
 // Syncer converts tidb binlog to the specified DB sqls, and sync it to target DB
 type Syncer struct {
 	schema *Schema
 	cp     checkpoint.CheckPoint
 
-	cfg *SyncerConfig
+	// cfgMu protects cfg, which is replaced when the config is reloaded
+	cfgMu sync.Mutex
+	cfg   *SyncerConfig
+	// the reloaded config is sent to run and applied between txns, only the latest one is kept in it
+	reloadCh chan *reloadRequest
+	// reloadMu protects the sends to reloadCh
+	reloadMu sync.Mutex
+	// paces the DML txns synced by txn-rate-limit, which can be reloaded
+	limiter *rate.Limiter
+	// the tables added to the running task are sent to run, see AddTable
+	addTableCh chan *addTableRequest
+	// the tables added by quoted name, protected by addedMu
+	addedMu sync.Mutex
+	added   map[string]*AddedTable
+	// safeModeInitDone is set when the initialization phase of safe mode is over
+	safeModeInitDone bool
 
 	input chan *binlogItem
 
 	filter *filter.Filter
 
+	// control is used to pause the syncer or skip binlogs, nil means disabled
+	control *SyncerControl
+
+	loopbackSync *loopbacksync.LoopBackSync
+
 	// last time we successfully sync binlog item to downstream
 	lastSyncTime time.Time
+	// the event time of the binlogs applied to downstream
+	watermark *watermark
+	// whether the binlogs added to downstream are being applied
+	progress *applyProgress
 
 	dsyncer dsync.Syncer
+	// archiver is nil if the archive is disabled
+	archiver *dsync.Archiver
+	// recycleBin drops the tables recycled after the grace period, nil if they're never dropped by drainer
+	recycleBin *dsync.RecycleBin
+
+	// the binlogs with commit ts > endTS are not applied, and run quits once all the binlogs with
+	// commit ts <= endTS are applied, 0 means no end
+	endTS int64
+	// set when run quits on reaching endTS
+	endReached bool
 
 	shutdown chan struct{}
 	closed   chan struct{}
@@ -63,31 +112,64 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 	syncer.cp = cp
 	syncer.input = make(chan *binlogItem, maxBinlogItemCount)
 	syncer.lastSyncTime = time.Now()
+	syncer.watermark = newWatermark(cp.TS())
+	syncer.progress = newApplyProgress()
 	syncer.shutdown = make(chan struct{})
 	syncer.closed = make(chan struct{})
+	syncer.reloadCh = make(chan *reloadRequest, 1)
+	syncer.limiter = rate.NewLimiter(txnRateLimit(cfg.TxnRateLimit), 1)
+	syncer.addTableCh = make(chan *addTableRequest)
+	syncer.added = make(map[string]*AddedTable)
+	syncer.filter = newFilter(cfg)
+	syncer.loopbackSync = loopbacksync.NewLoopBackSyncInfo(cfg.ChannelID, cfg.LoopbackControl, cfg.SyncDDL)
 
-	var ignoreDBs []string
-	if len(cfg.IgnoreSchemas) > 0 {
-		ignoreDBs = strings.Split(cfg.IgnoreSchemas, ",")
+	var err error
+	if cfg.DestDBType == "mysql" && cfg.AutoRandomSequence != AutoRandomSequenceStrip {
+		if err = checkAutoRandomSequence(jobs, syncer.filter); err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
-	syncer.filter = filter.NewFilter(ignoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
 
-	var err error
 	// create schema
 	syncer.schema, err = NewSchema(jobs, false)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	syncer.dsyncer, err = createDSyncer(cfg, syncer.schema)
+	syncer.dsyncer, err = createDSyncer(cfg, syncer.schema, syncer.loopbackSync)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	syncer.archiver, err = dsync.NewArchiver(&cfg.Archive, syncer.schema)
+	if err != nil {
+		return nil, errors.Annotate(err, "fail to create archiver")
+	}
+
+	if mysqlSyncer, ok := syncer.dsyncer.(*dsync.MysqlSyncer); ok && cfg.DestructiveDDL == DestructiveDDLRecycle && cfg.RecycleGracePeriod > 0 {
+		syncer.recycleBin = dsync.NewRecycleBin(mysqlSyncer.DB(), cfg.RecycleSchema, time.Duration(cfg.RecycleGracePeriod)*time.Minute)
+	}
+
 	return syncer, nil
 }
 
-func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err error) {
+func newFilter(cfg *SyncerConfig) *filter.Filter {
+	var ignoreDBs []string
+	if len(cfg.IgnoreSchemas) > 0 {
+		ignoreDBs = strings.Split(cfg.IgnoreSchemas, ",")
+	}
+	return filter.NewFilter(ignoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+}
+
+// loaderSyncer is the dsyncer applying the binlogs by loaders, i.e., MysqlSyncer and ShardSyncer
+type loaderSyncer interface {
+	SetSafeMode(mode bool)
+	SetWorkerCount(n int)
+	SetBatchSize(n int)
+	TableStatus() []loader.TableStatus
+}
+
+func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBackSync) (dsyncer dsync.Syncer, err error) {
 	switch cfg.DestDBType {
 	case "kafka":
 		dsyncer, err = dsync.NewKafka(cfg.To, schema)
@@ -99,6 +181,11 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create pb dsyncer")
 		}
+	case "webhook":
+		dsyncer, err = dsync.NewWebhookSyncer(cfg.To.Webhook, schema)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create webhook dsyncer")
+		}
 	case "mysql", "tidb":
 		var relayer relay.Relayer
 		// If the dir is empty, it means relayer is disabled.
@@ -107,7 +194,20 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err
 				return nil, errors.Annotate(err, "fail to create relayer")
 			}
 		}
-		dsyncer, err = dsync.NewMysqlSyncer(cfg.To, schema, cfg.WorkerCount, cfg.TxnBatch, queryHistogramVec, cfg.StrSQLMode, cfg.DestDBType, relayer)
+		metrics := &loader.MetricsGroup{
+			QueryHistogramVec:   queryHistogramVec,
+			ConflictCounterVec:  conflictCounter,
+			DriftCounterVec:     driftCounter,
+			TxnLatencyHistogram: txnLatencyHistogram,
+		}
+		if cfg.To.Sharding != nil {
+			dsyncer, err = dsync.NewShardSyncer(cfg.To, schema, cfg.WorkerCount, cfg.TxnBatch, metrics, cfg.StrSQLMode, cfg.DestDBType, info)
+			if err != nil {
+				return nil, errors.Annotate(err, "fail to create shard dsyncer")
+			}
+			break
+		}
+		dsyncer, err = dsync.NewMysqlSyncer(cfg.To, schema, cfg.WorkerCount, cfg.TxnBatch, metrics, cfg.StrSQLMode, cfg.DestDBType, relayer, info)
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create mysql dsyncer")
 		}
@@ -121,6 +221,16 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err
 	return
 }
 
+// syncItem archives the item if the archive is enabled, then adds it to dsyncer
+func (s *Syncer) syncItem(item *dsync.Item) error {
+	if s.archiver != nil {
+		if err := s.archiver.Archive(item); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(s.dsyncer.Sync(item))
+}
+
 // Start starts to sync.
 func (s *Syncer) Start() error {
 	err := s.run()
@@ -153,10 +263,13 @@ func (s *Syncer) addDDLCount() {
 
 func (s *Syncer) enableSafeModeInitializationPhase() {
 	translator.SetSQLMode(s.cfg.SQLMode)
+	if s.cfg.TimeZone != nil {
+		translator.SetTimeZone(s.cfg.TimeZone)
+	}
 
 	// for mysql
 	// set safeMode to true at the first, and will use the config after 5 minutes.
-	mysqlSyncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	mysqlSyncer, ok := s.dsyncer.(loaderSyncer)
 	if !ok {
 		return
 	}
@@ -166,13 +279,152 @@ func (s *Syncer) enableSafeModeInitializationPhase() {
 	go func() {
 		select {
 		case <-time.After(5 * time.Minute):
+			s.cfgMu.Lock()
 			mysqlSyncer.SetSafeMode(s.cfg.SafeMode)
+			s.safeModeInitDone = true
+			s.cfgMu.Unlock()
 		case <-s.shutdown:
 			return
 		}
 	}()
 }
 
+// Reload changes the reloadable items of the config, including the filter rules, ignore-txn-commit-ts,
+// safe-mode, txn-batch, worker-count and txn-rate-limit, the others are ignored.
+// The new config is applied between txns, and Reload waits until it's applied or ctx is done. A config not applied
+// yet is replaced by the new one, and the Reload waiting for it returns errReloadSuperseded.
+func (s *Syncer) Reload(ctx context.Context, cfg *SyncerConfig) error {
+	req := &reloadRequest{cfg: cfg, done: make(chan struct{})}
+
+	s.reloadMu.Lock()
+	select {
+	case replaced := <-s.reloadCh:
+		replaced.err = errReloadSuperseded
+		close(replaced.done)
+	default:
+	}
+	// never blocks, as the only sender holds reloadMu and the channel is drained above
+	s.reloadCh <- req
+	s.reloadMu.Unlock()
+
+	select {
+	case <-req.done:
+		return req.err
+	case <-s.closed:
+		return errors.New("syncer is closed")
+	case <-ctx.Done():
+		return errors.Annotate(ctx.Err(), "wait for the config to be applied")
+	}
+}
+
+// applyReload applies the reloaded config and wakes up the Reload waiting for it.
+func (s *Syncer) applyReload(req *reloadRequest) {
+	s.applyConfig(req.cfg)
+	close(req.done)
+}
+
+// txnRateLimit returns the rate.Limit of txn-rate-limit, 0 means unlimited
+func txnRateLimit(limit int) rate.Limit {
+	if limit <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(limit)
+}
+
+// Config returns a copy of the config in use.
+func (s *Syncer) Config() SyncerConfig {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+
+	return *s.cfg
+}
+
+// TableStatus returns the replication status of each table,
+// it's only available when the downstream is mysql or tidb.
+func (s *Syncer) TableStatus() []loader.TableStatus {
+	mysqlSyncer, ok := s.dsyncer.(loaderSyncer)
+	if !ok {
+		return nil
+	}
+	return mysqlSyncer.TableStatus()
+}
+
+// LoaderWatermark returns the progress of the txns applied in downstream by their commit ts,
+// it's only available when the downstream is mysql or tidb.
+func (s *Syncer) LoaderWatermark() (loader.Watermark, bool) {
+	mysqlSyncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return loader.Watermark{}, false
+	}
+	return mysqlSyncer.Watermark(), true
+}
+
+// ControlTable pauses or resumes syncing the table while the others continue, or adds the table to the task,
+// see AddTable, it's only available when the downstream is mysql or tidb.
+func (s *Syncer) ControlTable(database string, table string, action string) error {
+	mysqlSyncer, ok := s.dsyncer.(*dsync.MysqlSyncer)
+	if !ok {
+		return errors.Errorf("can't %s the table when the downstream is %s", action, s.Config().DestDBType)
+	}
+	switch action {
+	case "pause":
+		mysqlSyncer.PauseTable(database, table)
+	case "resume":
+		mysqlSyncer.ResumeTable(database, table)
+	case "add":
+		return errors.Trace(s.AddTable(database, table))
+	default:
+		return errors.Errorf("invalid action %s", action)
+	}
+	return nil
+}
+
+// RecycledTables returns the tables in the recycle bin, and when they're dropped
+func (s *Syncer) RecycledTables(ctx context.Context) ([]dsync.RecycledTable, error) {
+	if s.recycleBin == nil {
+		return nil, errors.New("the recycle bin is disabled, destructive-ddl must be recycle with recycle-grace-period > 0")
+	}
+	return s.recycleBin.Tables(ctx)
+}
+
+// KeepRecycledTable cancels dropping the table in the recycle bin
+func (s *Syncer) KeepRecycledTable(ctx context.Context, table string) error {
+	if s.recycleBin == nil {
+		return errors.New("the recycle bin is disabled, destructive-ddl must be recycle with recycle-grace-period > 0")
+	}
+	return s.recycleBin.Keep(ctx, table)
+}
+
+func (s *Syncer) applyConfig(newCfg *SyncerConfig) {
+	cfg := s.Config()
+	cfg.IgnoreTxnCommitTS = newCfg.IgnoreTxnCommitTS
+	cfg.IgnoreSchemas = newCfg.IgnoreSchemas
+	cfg.IgnoreTables = newCfg.IgnoreTables
+	cfg.DoDBs = newCfg.DoDBs
+	cfg.DoTables = s.withAddedTables(newCfg)
+	cfg.SafeMode = newCfg.SafeMode
+	cfg.TxnBatch = newCfg.TxnBatch
+	cfg.WorkerCount = newCfg.WorkerCount
+	cfg.TxnRateLimit = newCfg.TxnRateLimit
+
+	s.filter = newFilter(&cfg)
+	s.limiter.SetLimit(txnRateLimit(cfg.TxnRateLimit))
+
+	s.cfgMu.Lock()
+	s.cfg = &cfg
+	if mysqlSyncer, ok := s.dsyncer.(loaderSyncer); ok {
+		mysqlSyncer.SetWorkerCount(cfg.WorkerCount)
+		mysqlSyncer.SetBatchSize(cfg.TxnBatch)
+		// keep safe mode on during the initialization phase
+		if s.safeModeInitDone {
+			mysqlSyncer.SetSafeMode(cfg.SafeMode)
+		}
+	}
+	s.cfgMu.Unlock()
+
+	log.Info("syncer config reloaded", zap.Reflect("config", cfg))
+}
+
 // handleSuccess handle the success binlog item we synced to downstream,
 // currently we only need to save checkpoint ts.
 // Note we do not send the fake binlog to downstream, we get fake binlog from
@@ -202,10 +454,17 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 
 			s.lastSyncTime = time.Now()
 			ts := item.Binlog.CommitTs
+			s.progress.apply(ts)
 			if ts > atomic.LoadInt64(lastTS) {
 				atomic.StoreInt64(lastTS, ts)
 			}
 
+			if len(item.GTIDSet) > 0 {
+				if recorder, ok := s.cp.(checkpoint.GTIDRecorder); ok {
+					recorder.RecordGTID(ts, item.GTIDSet)
+				}
+			}
+
 			// save ASAP for DDL, and if FinishTS > 0, we should save the ts map
 			if item.Binlog.DdlJobId > 0 || item.AppliedTS > 0 {
 				saveNow = true
@@ -224,6 +483,7 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 		}
 
 		ts := atomic.LoadInt64(lastTS)
+		s.watermark.advance(ts)
 		if ts > lastSaveTS {
 			if saveNow || time.Since(lastSaveTime) > 3*time.Second {
 				s.savePoint(ts, appliedTS)
@@ -258,6 +518,27 @@ func (s *Syncer) savePoint(ts, slaveTS int64) {
 	}
 
 	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(ts))))
+
+	if s.control != nil {
+		if err := s.control.checkpointed(ts); err != nil {
+			log.Warn("save syncer control failed", zap.Int64("checkpoint ts", ts), zap.Error(err))
+		}
+	}
+}
+
+// waitResumed blocks while the syncer is paused by control, the reloads are still applied meanwhile,
+// so Reload doesn't block until resumed.
+func (s *Syncer) waitResumed(ctx context.Context) error {
+	for {
+		select {
+		case <-s.control.resumed():
+			return nil
+		case req := <-s.reloadCh:
+			s.applyReload(req)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 func (s *Syncer) run() error {
@@ -287,8 +568,28 @@ func (s *Syncer) run() error {
 
 	var lastAddComitTS int64
 	dsyncError := s.dsyncer.Error()
+
+	// used to stop waiting when the syncer is paused by control
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if s.recycleBin != nil {
+		go s.recycleBin.Run(ctx)
+	}
+
+	if s.endTS > 0 && s.cp.TS() >= s.endTS {
+		log.Info("checkpoint ts has reached the end ts", zap.Int64("checkpoint ts", s.cp.TS()), zap.Int64("end ts", s.endTS))
+		s.endReached = true
+	}
 ForLoop:
-	for {
+	for !s.endReached {
 		// check if we can safely push a fake binlog
 		// We must wait previous items consumed to make sure we are safe to save this fake binlog commitTS
 		if pushFakeBinlog == nil && len(fakeBinlogs) > 0 {
@@ -308,6 +609,12 @@ ForLoop:
 		case pushFakeBinlog <- fakeBinlog:
 			pushFakeBinlog = nil
 			continue
+		case req := <-s.reloadCh:
+			s.applyReload(req)
+			continue
+		case req := <-s.addTableCh:
+			req.done <- s.addTable(ctx, req.table)
+			continue
 		case b = <-s.input:
 			queueSizeGauge.WithLabelValues("syncer_input").Set(float64(len(s.input)))
 			log.Debug("consume binlog item", zap.Stringer("item", b))
@@ -318,11 +625,36 @@ ForLoop:
 		commitTS := binlog.GetCommitTs()
 		jobID := binlog.GetDdlJobId()
 
+		if s.reachEnd(binlog) {
+			log.Info("reach the end ts, stop syncing", zap.Int64("end ts", s.endTS), zap.Int64("commit ts", commitTS))
+			s.endReached = true
+			break ForLoop
+		}
+
 		if isIgnoreTxnCommitTS(s.cfg.IgnoreTxnCommitTS, commitTS) {
 			log.Warn("skip txn", zap.Stringer("binlog", b.binlog))
 			continue
 		}
 
+		var skip bool
+		if s.control != nil && startTS != commitTS {
+			if s.waitResumed(ctx) != nil {
+				// the syncer is closed
+				break ForLoop
+			}
+
+			skip, err = s.control.shouldSkip(commitTS)
+			if err != nil {
+				err = errors.Annotate(err, "check whether to skip binlog failed")
+				break ForLoop
+			}
+			// the DDLs skipped are still applied to the schema below, or the DMLs after them are decoded wrongly
+			if skip && jobID == 0 {
+				log.Warn("skip txn by syncer control", zap.Stringer("binlog", b.binlog))
+				continue
+			}
+		}
+
 		if startTS == commitTS {
 			fakeBinlogs = append(fakeBinlogs, binlog)
 			fakeBinlogPreAddTS = append(fakeBinlogPreAddTS, lastAddComitTS)
@@ -352,18 +684,39 @@ ForLoop:
 				break ForLoop
 			}
 
+			// the DML may be encoded with the table infos older than the latest ones
+			infoGetter := s.schema.AtVersion(preWrite.SchemaVersion)
+
+			if s.loopbackSync.LoopbackControl {
+				var marked bool
+				marked, err = isMarkedTxn(preWrite, infoGetter)
+				if err != nil {
+					err = errors.Annotate(err, "check mark table failed")
+					break ForLoop
+				}
+				if marked {
+					log.Debug("skip txn applied by drainer", zap.Int64("commit ts", commitTS))
+					continue
+				}
+			}
+
 			var ignore bool
-			ignore, err = filterTable(preWrite, s.filter, s.schema)
+			ignore, err = filterTable(preWrite, s.filter, infoGetter)
 			if err != nil {
 				err = errors.Annotate(err, "filterTable failed")
 				break ForLoop
 			}
 
 			if !ignore {
+				if s.limiter.Wait(ctx) != nil {
+					// the syncer is closed
+					break ForLoop
+				}
 				s.addDMLEventMetrics(preWrite.GetMutations())
 				beginTime := time.Now()
 				lastAddComitTS = binlog.GetCommitTs()
-				err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: preWrite})
+				s.progress.add(lastAddComitTS)
+				err = s.syncItem(&dsync.Item{Binlog: binlog, PrewriteValue: preWrite, TableInfoGetter: infoGetter})
 				if err != nil {
 					err = errors.Annotatef(err, "add to dsyncer, commit ts %d", binlog.CommitTs)
 					break ForLoop
@@ -377,6 +730,9 @@ ForLoop:
 			// DDL (with version 10, commit ts 100) -> DDL (with version 9, commit ts 101) would never happen
 			s.schema.addJob(b.job)
 
+			// the rows of the dropped partitions are found by the table info before the DDL
+			oldTable, _ := s.schema.TableByID(b.job.TableID)
+
 			log.Debug("get DDL", zap.Int64("SchemaVersion", b.job.BinlogInfo.SchemaVersion))
 			lastDDLSchemaVersion = b.job.BinlogInfo.SchemaVersion
 
@@ -399,18 +755,35 @@ ForLoop:
 				break ForLoop
 			}
 
-			if s.filter.SkipSchemaAndTable(schema, table) {
+			if skip {
+				log.Warn("skip ddl by syncer control", zap.String("schema", schema), zap.String("table", table),
+					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+			} else if s.loopbackSync.LoopbackControl && (!s.loopbackSync.SyncDDL || strings.EqualFold(schema, loopbacksync.MarkDB)) {
+				log.Info("skip ddl by loopback control", zap.String("schema", schema), zap.String("table", table),
+					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+			} else if s.filter.SkipSchemaAndTable(schema, table) {
 				log.Info("skip ddl", zap.String("schema", schema), zap.String("table", table),
 					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+			} else if sql, err = s.rewriteDDL(b.job, schema, table, oldTable, commitTS); err != nil {
+				err = errors.Annotatef(err, "rewrite ddl, commit ts %d", commitTS)
+				break ForLoop
+			} else if sql == "" && b.job.Query != "" {
+				log.Info("skip ddl not supported by downstream", zap.String("schema", schema), zap.String("table", table),
+					zap.String("sql", b.job.Query), zap.Int64("commit ts", commitTS))
 			} else if sql != "" {
+				if sql != b.job.Query {
+					log.Info("rewrite ddl for downstream", zap.String("ddl", b.job.Query), zap.String("sql", sql))
+					binlog.DdlQuery = []byte(sql)
+				}
 				s.addDDLCount()
 				beginTime := time.Now()
 				lastAddComitTS = binlog.GetCommitTs()
+				s.progress.add(lastAddComitTS)
 
 				log.Info("add ddl item to syncer, you can add this commit ts to `ignore-txn-commit-ts` to skip this ddl if needed",
 					zap.String("sql", sql), zap.Int64("commit ts", binlog.CommitTs))
 
-				err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table})
+				err = s.syncItem(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table})
 				if err != nil {
 					err = errors.Annotatef(err, "add to dsyncer, commit ts %d", binlog.CommitTs)
 					break ForLoop
@@ -425,6 +798,11 @@ ForLoop:
 	if cerr != nil {
 		log.Error("Failed to close syncer", zap.Error(cerr))
 	}
+	if s.archiver != nil {
+		if err := s.archiver.Close(); err != nil {
+			log.Error("Failed to close archiver", zap.Error(err))
+		}
+	}
 
 	select {
 	case <-wait:
@@ -436,12 +814,30 @@ ForLoop:
 	if err != nil {
 		return err
 	}
-	return cerr
+	if cerr != nil {
+		return cerr
+	}
+
+	// all the binlogs with commit ts <= endTS have been applied, though there may be no txn committed at it
+	if s.endReached && s.cp.TS() < s.endTS {
+		s.savePoint(s.endTS, 0)
+	}
+	return nil
+}
+
+// reachEnd returns true if all the binlogs with commit ts <= endTS have been received. The binlogs are received in
+// the order of commit ts, and no txn commits at the ts of a fake binlog, as both are allocated by the TSO.
+func (s *Syncer) reachEnd(binlog *pb.Binlog) bool {
+	if s.endTS <= 0 {
+		return false
+	}
+	commitTS := binlog.GetCommitTs()
+	return commitTS > s.endTS || (commitTS == s.endTS && binlog.GetStartTs() == commitTS)
 }
 
 // filterTable may drop some table mutation in `PrewriteValue`
 // Return true if all table mutations are dropped.
-func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (ignore bool, err error) {
+func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema translator.TableInfoGetter) (ignore bool, err error) {
 	var muts []pb.TableMutation
 	for _, mutation := range pv.GetMutations() {
 		schemaName, tableName, ok := schema.SchemaAndTableName(mutation.GetTableId())
@@ -466,6 +862,20 @@ func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (i
 	return
 }
 
+// isMarkedTxn returns true if the txn writes the mark table of loopbacksync, i.e., it's applied by a drainer
+func isMarkedTxn(pv *pb.PrewriteValue, schema translator.TableInfoGetter) (bool, error) {
+	for _, mutation := range pv.GetMutations() {
+		schemaName, tableName, ok := schema.SchemaAndTableName(mutation.GetTableId())
+		if !ok {
+			return false, errors.Errorf("not found table id: %d", mutation.GetTableId())
+		}
+		if loopbacksync.IsMarkTable(schemaName, tableName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func isIgnoreTxnCommitTS(ignoreTxnCommitTS []int64, ts int64) bool {
 	for _, ignoreTS := range ignoreTxnCommitTS {
 		if ignoreTS == ts {
@@ -503,6 +913,36 @@ func (s *Syncer) GetLatestCommitTS() int64 {
 	return s.cp.TS()
 }
 
+// rewriteDDL returns the DDL executed in downstream for the job, which may not support the partitions, AUTO_RANDOM,
+// SEQUENCE or the other DDL syntax of TiDB, or may keep the tables dropped or truncated, empty if it's skipped,
+// old is the table info before the DDL
+func (s *Syncer) rewriteDDL(job *model.Job, schema string, table string, old *model.TableInfo, commitTS int64) (string, error) {
+	sql := job.Query
+	if isDestructiveDDL(job.Type) {
+		switch s.cfg.DestructiveDDL {
+		case DestructiveDDLSkip:
+			log.Warn("skip destructive ddl", zap.String("schema", schema), zap.String("table", table),
+				zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+			return "", nil
+		case DestructiveDDLRecycle:
+			return recycleDDL(s.cfg.RecycleSchema, job.Type, schema, table, commitTS), nil
+		}
+	}
+
+	if s.cfg.DestDBType == "mysql" {
+		var err error
+		sql, err = rewriteAutoRandomSequenceDDL(s.cfg.AutoRandomSequence, sql)
+		if err != nil || len(sql) == 0 {
+			return "", errors.Trace(err)
+		}
+		if sql = rewriteTiDBSyntaxDDL(s.cfg.TiDBDDLSyntax, sql); len(sql) == 0 {
+			return "", nil
+		}
+	}
+
+	return translatePartitionDDL(s.cfg.PartitionDDL, s.cfg.SQLMode, sql, schema, table, old)
+}
+
 // see https://github.com/pingcap/tidb/issues/9304
 // currently, we only drop the data which table id is truncated.
 // because of online DDL, different TiDB instance may see the different schema,
@@ -14,6 +14,7 @@
 package drainer
 
 import (
+	"context"
 	"time"
 
 	"github.com/pingcap/check"
@@ -22,6 +23,7 @@ import (
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	pb "github.com/pingcap/tipb/go-binlog"
+	"golang.org/x/time/rate"
 )
 
 type syncerSuite struct{}
@@ -58,6 +60,26 @@ func (s *syncerSuite) TestFilterTable(c *check.C) {
 	c.Assert(len(pv.Mutations), check.Equals, 1)
 }
 
+func (s *syncerSuite) TestIsMarkedTxn(c *check.C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, check.IsNil)
+	schema.tableIDToName[1] = TableName{Schema: "test", Table: "test"}
+	schema.tableIDToName[2] = TableName{Schema: "retl", Table: "_drainer_repl_mark"}
+
+	pv := &pb.PrewriteValue{Mutations: []pb.TableMutation{{TableId: 1}}}
+	marked, err := isMarkedTxn(pv, schema)
+	c.Assert(err, check.IsNil)
+	c.Assert(marked, check.IsFalse)
+
+	pv.Mutations = append(pv.Mutations, pb.TableMutation{TableId: 2})
+	marked, err = isMarkedTxn(pv, schema)
+	c.Assert(err, check.IsNil)
+	c.Assert(marked, check.IsTrue)
+
+	_, err = isMarkedTxn(&pb.PrewriteValue{Mutations: []pb.TableMutation{{TableId: 3}}}, schema)
+	c.Assert(err, check.ErrorMatches, "not found table id: 3")
+}
+
 func (s *syncerSuite) TestNewSyncer(c *check.C) {
 	cfg := &SyncerConfig{
 		DestDBType: "_intercept",
@@ -173,6 +195,221 @@ func (s *syncerSuite) TestNewSyncer(c *check.C) {
 	c.Assert(syncer.GetLatestCommitTS(), check.Greater, lastNoneFakeTS)
 }
 
+func (s *syncerSuite) TestReload(c *check.C) {
+	cfg := &SyncerConfig{
+		DestDBType:  "_intercept",
+		WorkerCount: 16,
+	}
+
+	cpFile := c.MkDir() + "/checkpoint"
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: cpFile})
+	c.Assert(err, check.IsNil)
+
+	syncer, err := NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := syncer.Start()
+		c.Assert(err, check.IsNil, check.Commentf(errors.ErrorStack(err)))
+	}()
+
+	err = syncer.Reload(context.Background(), &SyncerConfig{
+		DestDBType:        "kafka",
+		WorkerCount:       4,
+		TxnRateLimit:      100,
+		IgnoreTxnCommitTS: []int64{1},
+		IgnoreSchemas:     "test",
+	})
+	c.Assert(err, check.IsNil)
+
+	newCfg := syncer.Config()
+	c.Assert(newCfg.DestDBType, check.Equals, "_intercept")
+	c.Assert(newCfg.WorkerCount, check.Equals, 4)
+	c.Assert(newCfg.TxnRateLimit, check.Equals, 100)
+	c.Assert(newCfg.IgnoreTxnCommitTS, check.DeepEquals, []int64{1})
+	c.Assert(newCfg.IgnoreSchemas, check.Equals, "test")
+	c.Assert(syncer.limiter.Limit(), check.Equals, rate.Limit(100))
+
+	// reloaded again right after the last one
+	err = syncer.Reload(context.Background(), cfg)
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.Config().WorkerCount, check.Equals, 16)
+	c.Assert(syncer.limiter.Limit(), check.Equals, rate.Inf)
+
+	syncer.Close()
+	<-done
+
+	err = syncer.Reload(context.Background(), cfg)
+	c.Assert(err, check.ErrorMatches, ".*syncer is closed.*")
+}
+
+func (s *syncerSuite) TestReloadLatest(c *check.C) {
+	cpFile := c.MkDir() + "/checkpoint"
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: cpFile})
+	c.Assert(err, check.IsNil)
+
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept"}, nil)
+	c.Assert(err, check.IsNil)
+
+	// not applied as the syncer isn't running, the config pending is replaced by the later one
+	superseded := make(chan error, 1)
+	go func() {
+		superseded <- syncer.Reload(context.Background(), &SyncerConfig{WorkerCount: 1})
+	}()
+	for len(syncer.reloadCh) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = syncer.Reload(ctx, &SyncerConfig{WorkerCount: 2})
+	c.Assert(errors.Cause(err), check.Equals, context.DeadlineExceeded)
+	c.Assert(<-superseded, check.Equals, errReloadSuperseded)
+
+	c.Assert(syncer.reloadCh, check.HasLen, 1)
+	req := <-syncer.reloadCh
+	c.Assert(req.cfg.WorkerCount, check.Equals, 2)
+}
+
+func (s *syncerSuite) TestControl(c *check.C) {
+	cfg := &SyncerConfig{
+		DestDBType: "_intercept",
+	}
+
+	cpFile := c.MkDir() + "/checkpoint"
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: cpFile})
+	c.Assert(err, check.IsNil)
+
+	syncer, err := NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+	syncer.control, err = NewSyncerControl(c.MkDir() + "/" + syncerControlFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.control.Pause(), check.IsNil)
+	c.Assert(syncer.control.Skip(1, 0), check.IsNil)
+	syncer.endTS = 7
+
+	done := make(chan error, 1)
+	go func() {
+		done <- syncer.Start()
+	}()
+	syncer.Add(newCreateSchemaItem(5, 1, "test"))
+
+	// the config is reloaded while paused
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- syncer.Reload(context.Background(), &SyncerConfig{DestDBType: "_intercept", WorkerCount: 4})
+	}()
+	select {
+	case err = <-reloaded:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("reload is blocked by pausing")
+	}
+	c.Assert(syncer.control.Resume(), check.IsNil)
+
+	// the DDL skipped is still applied to the schema, so the table can be created in it
+	syncer.Add(&binlogItem{
+		binlog: &pb.Binlog{
+			Tp:       pb.BinlogType_Commit,
+			StartTs:  6,
+			CommitTs: 7,
+			DdlQuery: []byte("create table test.t(id int)"),
+			DdlJobId: 2,
+		},
+		job: &model.Job{
+			ID:       2,
+			SchemaID: 1,
+			Type:     model.ActionCreateTable,
+			State:    model.JobStateSynced,
+			Query:    "create table test.t(id int)",
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: 2,
+				TableInfo: &model.TableInfo{
+					ID:   2,
+					Name: model.CIStr{O: "t", L: "t"},
+				},
+			},
+		},
+	})
+	syncer.Add(newCreateSchemaItem(9, 3, "test3"))
+	c.Assert(<-done, check.IsNil)
+
+	interceptSyncer := syncer.dsyncer.(*interceptSyncer)
+	c.Assert(interceptSyncer.items, check.HasLen, 1)
+	c.Assert(interceptSyncer.items[0].Binlog.CommitTs, check.Equals, int64(7))
+	// the binlog skipped is forgotten after the checkpoint passes it
+	c.Assert(syncer.control.State().SkippedTS, check.HasLen, 0)
+}
+
+func newCreateSchemaItem(commitTS int64, schemaID int64, name string) *binlogItem {
+	query := "create database " + name
+	return &binlogItem{
+		binlog: &pb.Binlog{
+			Tp:       pb.BinlogType_Commit,
+			StartTs:  commitTS - 1,
+			CommitTs: commitTS,
+			DdlQuery: []byte(query),
+			DdlJobId: schemaID,
+		},
+		job: &model.Job{
+			ID:    schemaID,
+			Type:  model.ActionCreateSchema,
+			State: model.JobStateSynced,
+			Query: query,
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: schemaID,
+				DBInfo: &model.DBInfo{
+					ID:   schemaID,
+					Name: model.CIStr{O: name, L: name},
+				},
+			},
+		},
+	}
+}
+
+func (s *syncerSuite) TestEndTS(c *check.C) {
+	cfg := &SyncerConfig{
+		DestDBType: "_intercept",
+	}
+
+	cpFile := c.MkDir() + "/checkpoint"
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: cpFile})
+	c.Assert(err, check.IsNil)
+
+	syncer, err := NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+	syncer.endTS = 10
+
+	done := make(chan error, 1)
+	go func() {
+		done <- syncer.Start()
+	}()
+	syncer.Add(newCreateSchemaItem(5, 1, "test1"))
+	// the txn after the end ts is not applied
+	syncer.Add(newCreateSchemaItem(12, 2, "test2"))
+
+	// quit on the first binlog after the end ts
+	c.Assert(<-done, check.IsNil)
+	c.Assert(syncer.endReached, check.IsTrue)
+
+	interceptSyncer := syncer.dsyncer.(*interceptSyncer)
+	c.Assert(interceptSyncer.items, check.HasLen, 1)
+	c.Assert(interceptSyncer.items[0].Binlog.CommitTs, check.Equals, int64(5))
+	c.Assert(cp.TS(), check.Equals, int64(10))
+
+	c.Assert(syncer.reachEnd(&pb.Binlog{StartTs: 10, CommitTs: 10}), check.IsTrue)
+	c.Assert(syncer.reachEnd(&pb.Binlog{StartTs: 9, CommitTs: 10}), check.IsFalse)
+
+	// the checkpoint has reached the end ts
+	syncer, err = NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+	syncer.endTS = 10
+	err = syncer.Start()
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.endReached, check.IsTrue)
+}
+
 func (s *syncerSuite) TestIsIgnoreTxnCommitTS(c *check.C) {
 	c.Assert(isIgnoreTxnCommitTS(nil, 1), check.IsFalse)
 	c.Assert(isIgnoreTxnCommitTS([]int64{1, 3}, 1), check.IsTrue)
@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"regexp"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// the modes of handling the DDL syntax of TiDB which mysql doesn't support, see SyncerConfig.TiDBDDLSyntax.
+// The AUTO_RANDOM and SEQUENCE are handled by SyncerConfig.AutoRandomSequence.
+const (
+	// TiDBDDLSyntaxSync executes the DDLs as they are, the ones using the syntax fail in mysql
+	TiDBDDLSyntaxSync = "sync"
+	// TiDBDDLSyntaxStrip removes the syntax from the DDLs, the ALTER TABLE left with nothing are skipped
+	TiDBDDLSyntaxStrip = "strip"
+	// TiDBDDLSyntaxSkip skips the DDLs using the syntax with a warning
+	TiDBDDLSyntaxSkip = "skip"
+)
+
+// tidbSyntax is a DDL syntax of TiDB which mysql doesn't support, replaced by repl when stripped
+type tidbSyntax struct {
+	name   string
+	regexp *regexp.Regexp
+	repl   string
+}
+
+// the placeholder of the TiDB specific comments while the syntax is removed, it can't be in the DDLs
+const tidbCommentPlaceholder = "\x00"
+
+var tidbCommentPlaceholderRegexp = regexp.MustCompile(tidbCommentPlaceholder)
+
+var tidbSyntaxes = []tidbSyntax{
+	// the table options of the row id sharding, region splitting and auto id caching
+	{"SHARD_ROW_ID_BITS", regexp.MustCompile("(?i)\\s*,?\\s*\\bSHARD_ROW_ID_BITS\\b\\s*=?\\s*\\d+"), ""},
+	{"PRE_SPLIT_REGIONS", regexp.MustCompile("(?i)\\s*,?\\s*\\bPRE_SPLIT_REGIONS\\b\\s*=?\\s*\\d+"), ""},
+	{"AUTO_ID_CACHE", regexp.MustCompile("(?i)\\s*,?\\s*\\bAUTO_ID_CACHE\\b\\s*=?\\s*\\d+"), ""},
+	// the clustered index options of the primary keys, of the column or the table
+	{"CLUSTERED", regexp.MustCompile("(?i)(\\bPRIMARY\\s+KEY\\b(?:\\s*`?\\w+`?)??\\s*(?:\\([^)]*\\))?)\\s+(NON)?CLUSTERED\\b"), "$1"},
+	// the expression defaults, the rows replicated have the values, up to one level of nested parentheses
+	{"expression default", regexp.MustCompile("(?i)\\s*\\bDEFAULT\\s*\\((?:[^()]|\\([^()]*\\))*\\)"), ""},
+}
+
+func isValidTiDBDDLSyntaxMode(mode string) bool {
+	switch mode {
+	case "", TiDBDDLSyntaxSync, TiDBDDLSyntaxStrip, TiDBDDLSyntaxSkip:
+		return true
+	}
+	return false
+}
+
+// tidbSyntaxFeatures returns the DDL syntax of TiDB mysql doesn't support used by the DDL
+func tidbSyntaxFeatures(sql string) []string {
+	sql = tidbCommentRegexp.ReplaceAllString(sql, "")
+	var features []string
+	for _, syntax := range tidbSyntaxes {
+		if syntax.regexp.MatchString(sql) {
+			features = append(features, syntax.name)
+		}
+	}
+	return features
+}
+
+// rewriteTiDBSyntaxDDL returns the DDL executed in mysql by the mode, empty if the DDL is skipped
+func rewriteTiDBSyntaxDDL(mode string, sql string) string {
+	if mode != TiDBDDLSyntaxStrip && mode != TiDBDDLSyntaxSkip {
+		return sql
+	}
+	features := tidbSyntaxFeatures(sql)
+	if len(features) == 0 {
+		return sql
+	}
+
+	if mode == TiDBDDLSyntaxSkip {
+		log.Warn("skip the ddl using the syntax not supported by mysql", zap.Strings("syntax", features), zap.String("ddl", sql))
+		return ""
+	}
+
+	// the TiDB specific comments are kept, mysql ignores them
+	var comments []string
+	sql = tidbCommentRegexp.ReplaceAllStringFunc(sql, func(comment string) string {
+		comments = append(comments, comment)
+		return tidbCommentPlaceholder
+	})
+	for _, syntax := range tidbSyntaxes {
+		sql = syntax.regexp.ReplaceAllString(sql, syntax.repl)
+	}
+	i := 0
+	sql = tidbCommentPlaceholderRegexp.ReplaceAllStringFunc(sql, func(string) string {
+		i++
+		return comments[i-1]
+	})
+
+	if emptyAlterRegexp.MatchString(sql) {
+		// e.g., ALTER TABLE t SHARD_ROW_ID_BITS = 4
+		log.Info("skip the ddl only using the syntax not supported by mysql", zap.Strings("syntax", features))
+		return ""
+	}
+	return sql
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type tidbDDLSuite struct{}
+
+var _ = Suite(&tidbDDLSuite{})
+
+func (s *tidbDDLSuite) TestRewriteDDL(c *C) {
+	tests := []struct {
+		ddl      string
+		stripped string
+		isTiDB   bool
+	}{
+		{"create table t (id int primary key, v int default 1)", "create table t (id int primary key, v int default 1)", false},
+		{"create table t (id int primary key /*T![clustered_index] CLUSTERED */)", "create table t (id int primary key /*T![clustered_index] CLUSTERED */)", false},
+		{"create table t (id int, clustered int)", "create table t (id int, clustered int)", false},
+		{"create table t (id int primary key) shard_row_id_bits = 4 pre_split_regions=2", "create table t (id int primary key)", true},
+		{"create table t (id int primary key) ENGINE=InnoDB, SHARD_ROW_ID_BITS=4", "create table t (id int primary key) ENGINE=InnoDB", true},
+		{"create table t (id int primary key) auto_id_cache 100", "create table t (id int primary key)", true},
+		{"create table t (id int primary key clustered, v int)", "create table t (id int primary key, v int)", true},
+		{"create table t (a int, b int, primary key (a, b) NONCLUSTERED)", "create table t (a int, b int, primary key (a, b))", true},
+		{"create table t (id int primary key, v varchar(36) default (uuid()))", "create table t (id int primary key, v varchar(36))", true},
+		{"alter table t add column v int default (1 + 2)", "alter table t add column v int", true},
+		{"alter table t shard_row_id_bits = 4", "", true},
+	}
+
+	for _, test := range tests {
+		c.Assert(rewriteTiDBSyntaxDDL(TiDBDDLSyntaxSync, test.ddl), Equals, test.ddl)
+		c.Assert(rewriteTiDBSyntaxDDL(TiDBDDLSyntaxStrip, test.ddl), Equals, test.stripped, Commentf("%s", test.ddl))
+		skipped := rewriteTiDBSyntaxDDL(TiDBDDLSyntaxSkip, test.ddl)
+		if test.isTiDB {
+			c.Assert(skipped, Equals, "", Commentf("%s", test.ddl))
+		} else {
+			c.Assert(skipped, Equals, test.ddl)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb/types"
+)
+
+// GenCreateTable returns the CREATE TABLE IF NOT EXISTS statement of the table described by info,
+// with the columns, their types, the primary key and the indexes, so the table can be created in
+// downstream without the schema dumped. The default values, comments and table options are omitted.
+func GenCreateTable(info *model.TableInfo) string {
+	var defs []string
+	for _, col := range info.Columns {
+		if col.State != model.StatePublic {
+			continue
+		}
+		defs = append(defs, genColumnDef(col))
+	}
+
+	if info.PKIsHandle {
+		if pk := info.GetPkColInfo(); pk != nil {
+			defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", pkgsql.QuoteName(pk.Name.O)))
+		}
+	}
+
+	for _, idx := range info.Indices {
+		if idx.State != model.StatePublic {
+			continue
+		}
+		cols := make([]string, 0, len(idx.Columns))
+		for _, col := range idx.Columns {
+			if col.Length != types.UnspecifiedLength {
+				cols = append(cols, fmt.Sprintf("%s(%d)", pkgsql.QuoteName(col.Name.O), col.Length))
+			} else {
+				cols = append(cols, pkgsql.QuoteName(col.Name.O))
+			}
+		}
+		switch {
+		case idx.Primary:
+			defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(cols, ",")))
+		case idx.Unique:
+			defs = append(defs, fmt.Sprintf("UNIQUE KEY %s (%s)", pkgsql.QuoteName(idx.Name.O), strings.Join(cols, ",")))
+		default:
+			defs = append(defs, fmt.Sprintf("KEY %s (%s)", pkgsql.QuoteName(idx.Name.O), strings.Join(cols, ",")))
+		}
+	}
+
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  %s\n)", pkgsql.QuoteName(info.Name.O), strings.Join(defs, ",\n  "))
+}
+
+func genColumnDef(col *model.ColumnInfo) string {
+	def := pkgsql.QuoteName(col.Name.O) + " " + col.FieldType.InfoSchemaStr()
+
+	isText := types.IsNonBinaryStr(&col.FieldType) || col.Tp == mysql.TypeEnum || col.Tp == mysql.TypeSet
+	if isText && len(col.Charset) > 0 && col.Charset != "binary" {
+		def += " CHARACTER SET " + col.Charset
+		if len(col.Collate) > 0 {
+			def += " COLLATE " + col.Collate
+		}
+	}
+
+	if col.IsGenerated() {
+		def += fmt.Sprintf(" GENERATED ALWAYS AS (%s)", col.GeneratedExprString)
+		if col.GeneratedStored {
+			def += " STORED"
+		} else {
+			def += " VIRTUAL"
+		}
+	}
+
+	if mysql.HasNotNullFlag(col.Flag) {
+		def += " NOT NULL"
+	}
+	if mysql.HasAutoIncrementFlag(col.Flag) {
+		def += " AUTO_INCREMENT"
+	}
+
+	return def
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type testCreateTableSuite struct{}
+
+var _ = Suite(&testCreateTableSuite{})
+
+func (t *testCreateTableSuite) TestGenCreateTable(c *C) {
+	newColumn := func(name string, tp byte, flag uint) *model.ColumnInfo {
+		col := &model.ColumnInfo{Name: model.NewCIStr(name), State: model.StatePublic, FieldType: *types.NewFieldType(tp)}
+		col.Flag = flag
+		return col
+	}
+
+	id := newColumn("id", mysql.TypeLonglong, mysql.NotNullFlag|mysql.AutoIncrementFlag|mysql.PriKeyFlag|mysql.UnsignedFlag)
+	name := newColumn("name", mysql.TypeVarchar, mysql.NotNullFlag)
+	name.Flen, name.Charset, name.Collate = 32, "utf8mb4", "utf8mb4_bin"
+	data := newColumn("data", mysql.TypeBlob, 0)
+	data.Charset, data.Collate = "binary", "binary"
+	upper := newColumn("upper_name", mysql.TypeVarchar, 0)
+	upper.Flen, upper.Charset, upper.Collate = 32, "utf8mb4", "utf8mb4_bin"
+	upper.GeneratedExprString = "upper(`name`)"
+	sex := newColumn("sex", mysql.TypeEnum, 0)
+	sex.Elems, sex.Charset, sex.Collate = []string{"male", "female"}, "binary", "binary"
+	adding := newColumn("adding", mysql.TypeLong, 0)
+	adding.State = model.StateWriteOnly
+
+	info := &model.TableInfo{
+		Name:       model.NewCIStr("t`1"),
+		Columns:    []*model.ColumnInfo{id, name, data, upper, sex, adding},
+		PKIsHandle: true,
+		Indices: []*model.IndexInfo{
+			{
+				Name:    model.NewCIStr("uk_name"),
+				Columns: []*model.IndexColumn{{Name: model.NewCIStr("name"), Length: 8}},
+				Unique:  true,
+				State:   model.StatePublic,
+			},
+			{
+				Name:    model.NewCIStr("idx_upper"),
+				Columns: []*model.IndexColumn{{Name: model.NewCIStr("upper_name"), Length: types.UnspecifiedLength}, {Name: model.NewCIStr("id"), Length: types.UnspecifiedLength}},
+				State:   model.StatePublic,
+			},
+			{
+				Name:    model.NewCIStr("idx_adding"),
+				Columns: []*model.IndexColumn{{Name: model.NewCIStr("adding"), Length: types.UnspecifiedLength}},
+				State:   model.StateWriteOnly,
+			},
+		},
+	}
+
+	c.Assert(GenCreateTable(info), Equals, "CREATE TABLE IF NOT EXISTS `t``1` (\n"+
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n"+
+		"  `name` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,\n"+
+		"  `data` blob,\n"+
+		"  `upper_name` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin GENERATED ALWAYS AS (upper(`name`)) VIRTUAL,\n"+
+		"  `sex` enum('male','female'),\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  UNIQUE KEY `uk_name` (`name`(8)),\n"+
+		"  KEY `idx_upper` (`upper_name`,`id`)\n"+
+		")")
+}
@@ -17,7 +17,6 @@ import (
 	"fmt"
 	"io"
 	"strconv"
-	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/pingcap/errors"
@@ -126,7 +125,7 @@ func deleteRowToRow(tableInfo *model.TableInfo, raw []byte) (row *obinlog.Row, e
 	columns := tableInfo.Columns
 
 	colsTypeMap := util.ToColumnTypeMap(tableInfo.Columns)
-	columnValues, err := tablecodec.DecodeRow(raw, colsTypeMap, time.Local)
+	columnValues, err := tablecodec.DecodeRow(raw, colsTypeMap, timeZone)
 	if err != nil {
 		return nil, errors.Annotate(err, "DecodeRow failed")
 	}
@@ -150,7 +149,7 @@ func deleteRowToRow(tableInfo *model.TableInfo, raw []byte) (row *obinlog.Row, e
 
 func updateRowToRow(tableInfo *model.TableInfo, raw []byte, isTblDroppingCol bool) (row *obinlog.Row, changedRow *obinlog.Row, err error) {
 	updtDecoder := newUpdateDecoder(tableInfo, isTblDroppingCol)
-	oldDatums, newDatums, err := updtDecoder.decode(raw, time.Local)
+	oldDatums, newDatums, err := updtDecoder.decode(raw, timeZone)
 	if err != nil {
 		return
 	}
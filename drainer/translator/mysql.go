@@ -16,7 +16,6 @@ package translator
 import (
 	"fmt"
 	"io"
-	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
@@ -62,7 +61,7 @@ func genMysqlUpdate(schema string, table *model.TableInfo, row []byte, isTblDrop
 
 	var updateColumns []*model.ColumnInfo
 
-	oldColumnValues, newColumnValues, err := updtDecoder.decode(row, time.Local)
+	oldColumnValues, newColumnValues, err := updtDecoder.decode(row, timeZone)
 	if err != nil {
 		return nil, nil, nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
@@ -86,7 +85,7 @@ func genMysqlDelete(schema string, table *model.TableInfo, row []byte) (names []
 	columns := table.Columns
 	colsTypeMap := util.ToColumnTypeMap(columns)
 
-	columnValues, err := tablecodec.DecodeRow(row, colsTypeMap, time.Local)
+	columnValues, err := tablecodec.DecodeRow(row, colsTypeMap, timeZone)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
@@ -117,3 +117,18 @@ func checkMysqlColumn(c *check.C, col *model.ColumnInfo, myValue interface{}, da
 	myStr := fmt.Sprintf("%v", myValue)
 	c.Assert(myStr, check.Equals, tiStr)
 }
+
+func (t *testMysqlSuite) TestFormatDataExact(c *check.C) {
+	dec := new(types.MyDecimal)
+	c.Assert(dec.FromString([]byte("12345678901234567890.123456789012345678")), check.IsNil)
+	ft := types.NewFieldType(mysql.TypeNewDecimal)
+	data, err := formatData(types.NewDecimalDatum(dec), *ft)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.GetValue(), check.Equals, "12345678901234567890.123456789012345678")
+
+	// the unsigned BIGINT handle is decoded as int64
+	col := &model.ColumnInfo{FieldType: *types.NewFieldType(mysql.TypeLonglong)}
+	col.Flag = mysql.UnsignedFlag
+	data = fixType(types.NewIntDatum(-1), col)
+	c.Assert(data.GetValue(), check.Equals, uint64(18446744073709551615))
+}
@@ -16,7 +16,6 @@ package translator
 import (
 	"fmt"
 	"io"
-	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/pingcap/errors"
@@ -157,7 +156,7 @@ func genUpdate(schema string, table *model.TableInfo, row []byte, isTblDroppingC
 	columns := writableColumns(table)
 	colsMap := util.ToColumnMap(columns)
 
-	oldColumnValues, newColumnValues, err := DecodeOldAndNewRow(row, colsMap, time.Local, isTblDroppingCol)
+	oldColumnValues, newColumnValues, err := DecodeOldAndNewRow(row, colsMap, timeZone, isTblDroppingCol)
 	if err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
@@ -202,7 +201,7 @@ func genDelete(schema string, table *model.TableInfo, row []byte) (event *pb.Eve
 	columns := table.Columns
 	colsTypeMap := util.ToColumnTypeMap(columns)
 
-	columnValues, err := tablecodec.DecodeRow(row, colsTypeMap, time.Local)
+	columnValues, err := tablecodec.DecodeRow(row, colsTypeMap, timeZone)
 	if err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
@@ -239,7 +238,7 @@ func genDelete(schema string, table *model.TableInfo, row []byte) (event *pb.Eve
 
 func encodeRow(row []types.Datum, colName []string, tp []byte, mysqlType []string) ([][]byte, error) {
 	cols := make([][]byte, 0, len(row))
-	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	sc := &stmtctx.StatementContext{TimeZone: timeZone}
 	for i, c := range row {
 		val, err := codec.EncodeValue(sc, nil, []types.Datum{c}...)
 		if err != nil {
@@ -264,7 +263,7 @@ func encodeRow(row []types.Datum, colName []string, tp []byte, mysqlType []strin
 
 func encodeUpdateRow(oldRow []types.Datum, newRow []types.Datum, colName []string, tp []byte, mysqlType []string) ([][]byte, error) {
 	cols := make([][]byte, 0, len(oldRow))
-	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	sc := &stmtctx.StatementContext{TimeZone: timeZone}
 	for i, c := range oldRow {
 		val, err := codec.EncodeValue(sc, nil, []types.Datum{c}...)
 		if err != nil {
@@ -29,13 +29,22 @@ import (
 	"go.uber.org/zap"
 )
 
-var sqlMode mysql.SQLMode
+var (
+	sqlMode mysql.SQLMode
+	// the time zone TIMESTAMP values are decoded into
+	timeZone = time.Local
+)
 
 // SetSQLMode set the sql mode of parser
 func SetSQLMode(mode mysql.SQLMode) {
 	sqlMode = mode
 }
 
+// SetTimeZone set the time zone TIMESTAMP values are decoded into
+func SetTimeZone(loc *time.Location) {
+	timeZone = loc
+}
+
 func getParser() (p *parser.Parser) {
 	p = parser.New()
 	p.SetSQLMode(sqlMode)
@@ -53,7 +62,7 @@ func insertRowToDatums(table *model.TableInfo, row []byte) (pk types.Datum, datu
 		return types.Datum{}, nil, errors.Trace(err)
 	}
 
-	datums, err = tablecodec.DecodeRow(remain, colsTypeMap, time.Local)
+	datums, err = tablecodec.DecodeRow(remain, colsTypeMap, timeZone)
 	if err != nil {
 		return types.Datum{}, nil, errors.Trace(err)
 	}
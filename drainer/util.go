@@ -27,6 +27,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/pkg/flags"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta"
 	"go.uber.org/zap"
@@ -79,6 +80,7 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 
 	checkpointCfg := &checkpoint.Config{
 		ClusterID:       id,
+		NodeID:          cfg.NodeID,
 		InitialCommitTS: cfg.InitialCommitTS,
 		CheckPointFile:  path.Join(cfg.DataDir, "savepoint"),
 	}
@@ -97,7 +99,20 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 			User:     toCheckpoint.User,
 			Password: toCheckpoint.Password,
 			Port:     toCheckpoint.Port,
+
+			PasswordFrom: toCheckpoint.PasswordFrom,
+		}
+	case "file":
+		checkpointCfg.CheckpointType = toCheckpoint.Type
+	case "etcd", "pd":
+		urlv, err := flags.NewURLsValue(cfg.EtcdURLs)
+		if err != nil {
+			return nil, errors.Trace(err)
 		}
+		checkpointCfg.CheckpointType = toCheckpoint.Type
+		checkpointCfg.EtcdURLs = urlv.StringSlice()
+		checkpointCfg.EtcdTimeout = cfg.EtcdTimeout
+		checkpointCfg.TLS = cfg.tls
 	case "":
 		switch cfg.SyncerCfg.DestDBType {
 		case "mysql", "tidb":
@@ -107,10 +122,12 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 				User:     cfg.SyncerCfg.To.User,
 				Password: cfg.SyncerCfg.To.Password,
 				Port:     cfg.SyncerCfg.To.Port,
+
+				PasswordFrom: cfg.SyncerCfg.To.PasswordFrom,
 			}
 		case "pb", "file":
 			checkpointCfg.CheckpointType = "file"
-		case "kafka":
+		case "kafka", "webhook":
 			checkpointCfg.CheckpointType = "file"
 		case "flash":
 			return nil, errors.New("the flash DestDBType is no longer supported")
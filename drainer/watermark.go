@@ -0,0 +1,137 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+// HealthStatus is the health of drainer judged by the replication lag
+type HealthStatus string
+
+// the health status of drainer
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthWarning  HealthStatus = "warning"
+	HealthCritical HealthStatus = "critical"
+)
+
+var watermarkCheckInterval = time.Second
+
+// LagSLOConfig is the SLO thresholds of the replication lag, drainer is unhealthy when the lag exceeds them
+type LagSLOConfig struct {
+	// in seconds, 0 means disabled
+	WarningSeconds int `toml:"warning-seconds" json:"warning-seconds"`
+	// in seconds, 0 means disabled, /health responds 503 when it's exceeded
+	CriticalSeconds int `toml:"critical-seconds" json:"critical-seconds"`
+}
+
+// health returns the health status with the replication lag
+func (c *LagSLOConfig) health(lag time.Duration) HealthStatus {
+	switch {
+	case c.CriticalSeconds > 0 && lag > time.Duration(c.CriticalSeconds)*time.Second:
+		return HealthCritical
+	case c.WarningSeconds > 0 && lag > time.Duration(c.WarningSeconds)*time.Second:
+		return HealthWarning
+	default:
+		return HealthOK
+	}
+}
+
+// watermark tracks the event time of the binlogs applied to downstream, i.e., the commit ts of the last
+// one, the replication lag is the time elapsed since it. The fake binlogs generated by pumps periodically
+// advance it too, so the lag doesn't grow when there's no write in upstream.
+type watermark struct {
+	ts int64
+	// make it possible to mock the time
+	now func() time.Time
+}
+
+func newWatermark(ts int64) *watermark {
+	return &watermark{ts: ts, now: time.Now}
+}
+
+// advance moves the watermark forward to ts, the smaller ts is ignored
+func (w *watermark) advance(ts int64) {
+	for {
+		old := atomic.LoadInt64(&w.ts)
+		if ts <= old || atomic.CompareAndSwapInt64(&w.ts, old, ts) {
+			return
+		}
+	}
+}
+
+// TS returns the commit ts of the last binlog applied
+func (w *watermark) TS() int64 {
+	return atomic.LoadInt64(&w.ts)
+}
+
+// lag returns the replication lag, 0 if the watermark is later than now by clock drift
+func (w *watermark) lag() time.Duration {
+	lag := w.now().Sub(oracle.GetTimeFromTS(uint64(w.TS())))
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// HealthInfo is the health of drainer responded by /health
+type HealthInfo struct {
+	Status     HealthStatus `json:"status"`
+	LagSeconds float64      `json:"lag-seconds"`
+	AppliedTS  int64        `json:"applied-ts"`
+}
+
+func (w *watermark) healthInfo(slo *LagSLOConfig) HealthInfo {
+	lag := w.lag()
+	return HealthInfo{
+		Status:     slo.health(lag),
+		LagSeconds: lag.Seconds(),
+		AppliedTS:  w.TS(),
+	}
+}
+
+// monitor updates the lag gauge periodically and logs the changes of the health status until ctx is done
+func (w *watermark) monitor(ctx context.Context, slo *LagSLOConfig) {
+	ticker := time.NewTicker(watermarkCheckInterval)
+	defer ticker.Stop()
+
+	status := HealthOK
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		info := w.healthInfo(slo)
+		replicationLagGauge.Set(info.LagSeconds)
+		if info.Status == status {
+			continue
+		}
+		if info.Status == HealthOK {
+			log.Info("replication lag recovers", zap.Float64("lag seconds", info.LagSeconds), zap.Int64("applied ts", info.AppliedTS))
+		} else {
+			log.Warn("replication lag exceeds the SLO", zap.String("status", string(info.Status)),
+				zap.Float64("lag seconds", info.LagSeconds), zap.Int64("applied ts", info.AppliedTS))
+		}
+		status = info.Status
+	}
+}
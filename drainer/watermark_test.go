@@ -0,0 +1,52 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type watermarkSuite struct{}
+
+var _ = Suite(&watermarkSuite{})
+
+func (s *watermarkSuite) TestLag(c *C) {
+	now := time.Now().Truncate(time.Millisecond)
+	ts := int64(oracle.ComposeTS(oracle.GetPhysical(now.Add(-20*time.Second)), 0))
+	wm := newWatermark(ts)
+	wm.now = func() time.Time { return now }
+	c.Assert(wm.lag(), Equals, 20*time.Second)
+
+	// never moves backward
+	wm.advance(ts - 1)
+	c.Assert(wm.TS(), Equals, ts)
+
+	// the watermark later than now by clock drift
+	wm.advance(int64(oracle.ComposeTS(oracle.GetPhysical(now.Add(time.Second)), 0)))
+	c.Assert(wm.lag(), Equals, time.Duration(0))
+}
+
+func (s *watermarkSuite) TestHealth(c *C) {
+	slo := &LagSLOConfig{WarningSeconds: 10, CriticalSeconds: 60}
+	c.Assert(slo.health(5*time.Second), Equals, HealthOK)
+	c.Assert(slo.health(11*time.Second), Equals, HealthWarning)
+	c.Assert(slo.health(61*time.Second), Equals, HealthCritical)
+
+	// disabled
+	slo = &LagSLOConfig{}
+	c.Assert(slo.health(time.Hour), Equals, HealthOK)
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogfile
+
+import (
+	"container/heap"
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+)
+
+// writtenItem is a binlog in the order they're written, only the ts are kept
+type writtenItem struct {
+	start  int64
+	commit int64
+	tp     binlog.BinlogType
+}
+
+// commitHeap is a min heap of the C-binlogs by commit ts
+type commitHeap []*binlog.Binlog
+
+func (h commitHeap) Len() int            { return len(h) }
+func (h commitHeap) Less(i, j int) bool  { return h[i].CommitTs < h[j].CommitTs }
+func (h commitHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *commitHeap) Push(x interface{}) { *h = append(*h, x.(*binlog.Binlog)) }
+func (h *commitHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// CommitMatcher pairs the P-binlogs (prewrite) and C-binlogs (commit or rollback) of TiDB in the order they're
+// written, and returns the C-binlogs of the txns committed in commit ts order, fed with the prewrite values as the
+// ones pulled from pump. The rolled-back prewrites and the fake binlogs are dropped.
+//
+// A C-binlog is returned once all the P-binlogs written before a C-binlog with a commit ts >= its are matched,
+// as the P-binlog of a txn is written before its commit ts is fetched, so no txn committed before it can come later.
+type CommitMatcher struct {
+	// the P-binlogs waiting for their C-binlogs, by start ts
+	prewrites map[int64]*binlog.Binlog
+	// the binlogs not passed yet
+	items []writtenItem
+	// the C-binlogs matched not returned yet
+	commits commitHeap
+	// the max commit ts of the C-binlogs passed, the C-binlogs with commit ts <= it can be returned
+	maxCommitTS int64
+
+	orphans int
+}
+
+// NewCommitMatcher returns an empty CommitMatcher
+func NewCommitMatcher() *CommitMatcher {
+	return &CommitMatcher{prewrites: make(map[int64]*binlog.Binlog)}
+}
+
+// Push adds a binlog read, and returns the C-binlogs of the txns committed which can be returned in order
+func (m *CommitMatcher) Push(b *binlog.Binlog) []*binlog.Binlog {
+	switch b.Tp {
+	case binlog.BinlogType_Prewrite:
+		m.prewrites[b.StartTs] = b
+	case binlog.BinlogType_Commit:
+		if p, ok := m.prewrites[b.StartTs]; ok {
+			delete(m.prewrites, b.StartTs)
+			feedPrewrite(b, p)
+			heap.Push(&m.commits, b)
+		} else {
+			// the P-binlog is written before the position read from, or lost
+			m.orphans++
+			log.Warn("the P-binlog of the C-binlog is not found, skip it",
+				zap.Int64("start ts", b.StartTs), zap.Int64("commit ts", b.CommitTs))
+		}
+	case binlog.BinlogType_Rollback:
+		delete(m.prewrites, b.StartTs)
+	}
+	m.items = append(m.items, writtenItem{start: b.StartTs, commit: b.CommitTs, tp: b.Tp})
+
+	m.advance()
+	return m.pop(m.maxCommitTS)
+}
+
+// Flush returns all the C-binlogs matched in commit ts order, e.g., when all the binlogs are read.
+// The P-binlogs still waiting for their C-binlogs are not committed by now, they're left.
+func (m *CommitMatcher) Flush() []*binlog.Binlog {
+	m.items = m.items[:0]
+	return m.pop(-1)
+}
+
+// Pending returns the count of the P-binlogs waiting for their C-binlogs
+func (m *CommitMatcher) Pending() int {
+	return len(m.prewrites)
+}
+
+// Orphans returns the count of the C-binlogs skipped as their P-binlogs are not found
+func (m *CommitMatcher) Orphans() int {
+	return m.orphans
+}
+
+// advance passes the items until a P-binlog not matched, and updates the max commit ts
+func (m *CommitMatcher) advance() {
+	n := 0
+	for ; n < len(m.items); n++ {
+		item := m.items[n]
+		if item.tp == binlog.BinlogType_Prewrite {
+			if _, ok := m.prewrites[item.start]; ok {
+				break
+			}
+			continue
+		}
+		if item.commit > m.maxCommitTS {
+			m.maxCommitTS = item.commit
+		}
+	}
+	m.items = m.items[n:]
+}
+
+// pop returns the C-binlogs with commit ts <= maxCommitTS in order, all of them if maxCommitTS < 0
+func (m *CommitMatcher) pop(maxCommitTS int64) []*binlog.Binlog {
+	var res []*binlog.Binlog
+	for m.commits.Len() > 0 && (maxCommitTS < 0 || m.commits[0].CommitTs <= maxCommitTS) {
+		res = append(res, heap.Pop(&m.commits).(*binlog.Binlog))
+	}
+	return res
+}
+
+// feedPrewrite sets the values of the P-binlog to the C-binlog
+func feedPrewrite(c *binlog.Binlog, p *binlog.Binlog) {
+	c.PrewriteKey = p.PrewriteKey
+	c.PrewriteValue = p.PrewriteValue
+	if len(c.DdlQuery) == 0 {
+		c.DdlQuery = p.DdlQuery
+	}
+	if c.DdlJobId == 0 {
+		c.DdlJobId = p.DdlJobId
+	}
+}
+
+// WalkCommitted reads the binlogs of TiDB from the "from" position like Binlogger.Walk, and sends the C-binlogs of
+// the txns committed in commit ts order by a CommitMatcher, the ones matched are flushed when all are read.
+func WalkCommitted(ctx context.Context, b Binlogger, from binlog.Pos, sendBinlog func(c *binlog.Binlog) error) error {
+	m := NewCommitMatcher()
+	err := b.Walk(ctx, from, func(entity *binlog.Entity) error {
+		tb := new(binlog.Binlog)
+		if err := tb.Unmarshal(entity.Payload); err != nil {
+			return errors.Annotatef(err, "unmarshal binlog at %v", entity.Pos)
+		}
+		for _, c := range m.Push(tb) {
+			if err := sendBinlog(c); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, c := range m.Flush() {
+		if err := sendBinlog(c); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if m.Pending() > 0 {
+		log.Warn("the P-binlogs are not committed at the end", zap.Int("count", m.Pending()))
+	}
+	return nil
+}
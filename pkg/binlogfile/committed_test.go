@@ -0,0 +1,106 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogfile
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = Suite(&testCommitMatcherSuite{})
+
+type testCommitMatcherSuite struct{}
+
+func prewrite(start int64) *binlog.Binlog {
+	return &binlog.Binlog{Tp: binlog.BinlogType_Prewrite, StartTs: start, PrewriteValue: []byte{byte(start)}}
+}
+
+func commit(start int64, commit int64) *binlog.Binlog {
+	return &binlog.Binlog{Tp: binlog.BinlogType_Commit, StartTs: start, CommitTs: commit}
+}
+
+func rollback(start int64) *binlog.Binlog {
+	return &binlog.Binlog{Tp: binlog.BinlogType_Rollback, StartTs: start}
+}
+
+func commitTSs(binlogs []*binlog.Binlog) []int64 {
+	res := make([]int64, 0, len(binlogs))
+	for _, b := range binlogs {
+		res = append(res, b.CommitTs)
+	}
+	return res
+}
+
+func (s *testCommitMatcherSuite) TestMatch(c *C) {
+	m := NewCommitMatcher()
+	c.Assert(m.Push(prewrite(1)), HasLen, 0)
+	c.Assert(m.Push(prewrite(2)), HasLen, 0)
+	c.Assert(m.Push(prewrite(3)), HasLen, 0)
+	// txn 2 is committed first, but it waits for txn 1 written before it
+	c.Assert(m.Push(commit(2, 5)), HasLen, 0)
+	c.Assert(m.Pending(), Equals, 2)
+
+	// txn 3 written before them may still commit before 5
+	c.Assert(m.Push(commit(1, 4)), HasLen, 0)
+	c.Assert(m.Push(prewrite(6)), HasLen, 0)
+	// txn 6 written before the commit of txn 3 may still commit before 7
+	res := m.Push(commit(3, 7))
+	c.Assert(commitTSs(res), DeepEquals, []int64{4, 5})
+	c.Assert(res[0].PrewriteValue, DeepEquals, []byte{1})
+
+	// the rolled-back prewrite is dropped
+	c.Assert(m.Push(prewrite(8)), HasLen, 0)
+	c.Assert(m.Push(commit(8, 10)), HasLen, 0)
+	c.Assert(commitTSs(m.Push(rollback(6))), DeepEquals, []int64{7, 10})
+	c.Assert(m.Pending(), Equals, 0)
+
+	// the commit without prewrite is skipped
+	c.Assert(m.Push(commit(11, 12)), HasLen, 0)
+	c.Assert(m.Orphans(), Equals, 1)
+}
+
+func (s *testCommitMatcherSuite) TestFlush(c *C) {
+	m := NewCommitMatcher()
+	m.Push(prewrite(1))
+	m.Push(prewrite(2))
+	c.Assert(m.Push(commit(2, 3)), HasLen, 0)
+	c.Assert(commitTSs(m.Flush()), DeepEquals, []int64{3})
+	c.Assert(m.Pending(), Equals, 1)
+}
+
+func (s *testCommitMatcherSuite) TestWalkCommitted(c *C) {
+	dir := c.MkDir()
+	bl, err := OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	defer CloseBinlogger(bl)
+
+	for _, b := range []*binlog.Binlog{prewrite(1), prewrite(2), commit(2, 4), rollback(1), prewrite(5), commit(5, 6)} {
+		payload, err := b.Marshal()
+		c.Assert(err, IsNil)
+		_, err = bl.WriteTail(&binlog.Entity{Payload: payload})
+		c.Assert(err, IsNil)
+	}
+
+	var committed []*binlog.Binlog
+	err = WalkCommitted(context.Background(), bl, binlog.Pos{}, func(b *binlog.Binlog) error {
+		committed = append(committed, b)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(commitTSs(committed), DeepEquals, []int64{4, 6})
+	c.Assert(committed[1].StartTs, Equals, int64(5))
+	c.Assert(committed[1].PrewriteValue, DeepEquals, []byte{5})
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogfile
+
+import (
+	"container/heap"
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tipb/go-binlog"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultMergeBufferSize is the default count of the C-binlogs read ahead of each source by MergeCommitted
+const DefaultMergeBufferSize = 1024
+
+// mergeHead is the next C-binlog of a source
+type mergeHead struct {
+	binlog *binlog.Binlog
+	source int
+}
+
+// mergeHeap is a min heap of the heads of the sources by commit ts
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int            { return len(h) }
+func (h mergeHeap) Less(i, j int) bool  { return h[i].binlog.CommitTs < h[j].binlog.CommitTs }
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// MergeCommitted reads the binlogs of TiDB from the sources concurrently, e.g., the binlog files backed up from
+// different pumps, and sends the C-binlogs of the txns committed of all the sources in commit ts order.
+// Each source is read by WalkCommitted from the start, at most bufferSize C-binlogs are read ahead of each source,
+// so the sources read faster are blocked until the others catch up, and the memory used is bounded.
+func MergeCommitted(ctx context.Context, sources []Binlogger, bufferSize int, sendBinlog func(c *binlog.Binlog) error) error {
+	if bufferSize <= 0 {
+		bufferSize = DefaultMergeBufferSize
+	}
+
+	errg, ctx := errgroup.WithContext(ctx)
+	chs := make([]chan *binlog.Binlog, len(sources))
+	for i := range sources {
+		ch := make(chan *binlog.Binlog, bufferSize)
+		chs[i] = ch
+		source := sources[i]
+		errg.Go(func() error {
+			defer close(ch)
+			return WalkCommitted(ctx, source, binlog.Pos{}, func(c *binlog.Binlog) error {
+				select {
+				case ch <- c:
+					return nil
+				case <-ctx.Done():
+					return errors.Trace(ctx.Err())
+				}
+			})
+		})
+	}
+
+	errg.Go(func() error {
+		// the heap holds the next C-binlog of each source not drained, so the min one is the next of all
+		heads := make(mergeHeap, 0, len(chs))
+		next := func(source int) error {
+			select {
+			case c, ok := <-chs[source]:
+				if ok {
+					heap.Push(&heads, mergeHead{binlog: c, source: source})
+					return nil
+				}
+				// the source may be closed as another one fails
+				return errors.Trace(ctx.Err())
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			}
+		}
+
+		for i := range chs {
+			if err := next(i); err != nil {
+				return err
+			}
+		}
+		for heads.Len() > 0 {
+			head := heap.Pop(&heads).(mergeHead)
+			if err := sendBinlog(head.binlog); err != nil {
+				return errors.Trace(err)
+			}
+			if err := next(head.source); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return errors.Trace(errg.Wait())
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogfile
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = Suite(&testMergeSuite{})
+
+type testMergeSuite struct{}
+
+func openTestSource(c *C, binlogs ...*binlog.Binlog) Binlogger {
+	bl, err := OpenBinlogger(c.MkDir(), SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	for _, b := range binlogs {
+		payload, err := b.Marshal()
+		c.Assert(err, IsNil)
+		_, err = bl.WriteTail(&binlog.Entity{Payload: payload})
+		c.Assert(err, IsNil)
+	}
+	return bl
+}
+
+func (s *testMergeSuite) TestMergeCommitted(c *C) {
+	sources := []Binlogger{
+		openTestSource(c, prewrite(1), commit(1, 2), prewrite(5), commit(5, 8), prewrite(9), commit(9, 10)),
+		openTestSource(c, prewrite(3), prewrite(4), commit(4, 6), commit(3, 7)),
+		openTestSource(c),
+	}
+	defer func() {
+		for _, source := range sources {
+			CloseBinlogger(source)
+		}
+	}()
+
+	var merged []*binlog.Binlog
+	err := MergeCommitted(context.Background(), sources, 1, func(b *binlog.Binlog) error {
+		merged = append(merged, b)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(commitTSs(merged), DeepEquals, []int64{2, 6, 7, 8, 10})
+}
+
+func (s *testMergeSuite) TestSendError(c *C) {
+	sources := []Binlogger{
+		openTestSource(c, prewrite(1), commit(1, 2), prewrite(3), commit(3, 4)),
+		openTestSource(c, prewrite(5), commit(5, 6)),
+	}
+	defer func() {
+		for _, source := range sources {
+			CloseBinlogger(source)
+		}
+	}()
+
+	err := MergeCommitted(context.Background(), sources, 1, func(b *binlog.Binlog) error {
+		return errors.New("send failed")
+	})
+	c.Assert(err, ErrorMatches, "send failed")
+}
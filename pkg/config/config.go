@@ -0,0 +1,301 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads the config files of the components. The files are in TOML, or in YAML with the same keys,
+// which are the toml tags of the config structs. The keys unknown to the config struct and the values of the wrong
+// types are reported together with their keys before decoding, and the values not in the file are kept as the
+// defaults set in the struct.
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Load decodes the config file at path into cfg, a pointer to the config struct holding the default values.
+// The file is in YAML if its extension is .yaml or .yml, and in TOML otherwise.
+func Load(path string, component string, cfg interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	isYAML := isYAMLFile(path)
+	var values map[string]interface{}
+	if isYAML {
+		values, err = parseYAML(data)
+	} else {
+		_, err = toml.Decode(string(data), &values)
+	}
+	if err != nil {
+		return errors.Annotatef(err, "component %s's config file %s is invalid", component, path)
+	}
+
+	if err = check(component, path, values, cfg); err != nil {
+		return errors.Trace(err)
+	}
+
+	if isYAML {
+		// the YAML values are decoded by the toml tags as TOML, so both formats behave the same
+		buf := new(bytes.Buffer)
+		if err = toml.NewEncoder(buf).Encode(values); err != nil {
+			return errors.Annotatef(err, "component %s's config file %s is invalid", component, path)
+		}
+		data = buf.Bytes()
+	}
+	if _, err = toml.Decode(string(data), cfg); err != nil {
+		return errors.Annotatef(err, "component %s's config file %s is invalid", component, path)
+	}
+	return nil
+}
+
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// parseYAML parses the YAML document into the values in the types parsed from TOML
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if doc == nil {
+		return make(map[string]interface{}), nil
+	}
+	values, ok := normalizeYAML(doc).(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("the top level must be a mapping, got %s", describe(doc))
+	}
+	return values, nil
+}
+
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			// the empty values are left as the defaults
+			if elem != nil {
+				m[fmt.Sprint(key)] = normalizeYAML(elem)
+			}
+		}
+		return m
+	case []interface{}:
+		tables := make([]map[string]interface{}, 0, len(v))
+		elems := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			elem = normalizeYAML(elem)
+			if table, ok := elem.(map[string]interface{}); ok {
+				tables = append(tables, table)
+			}
+			elems = append(elems, elem)
+		}
+		// the array of tables is encoded as [[table]] in TOML
+		if len(v) > 0 && len(tables) == len(v) {
+			return tables
+		}
+		return elems
+	case int:
+		return int64(v)
+	}
+	return value
+}
+
+// check reports the unknown keys and the values of the wrong types of cfg
+func check(component string, path string, values map[string]interface{}, cfg interface{}) error {
+	c := new(checker)
+	c.checkValue("", values, reflect.TypeOf(cfg))
+
+	var msgs []string
+	if len(c.unknown) > 0 {
+		msgs = append(msgs, fmt.Sprintf("component %s's config file %s contained unknown configuration options: %s",
+			component, path, strings.Join(c.unknown, ", ")))
+	}
+	if len(c.invalid) > 0 {
+		msgs = append(msgs, fmt.Sprintf("component %s's config file %s contained invalid values: %s",
+			component, path, strings.Join(c.invalid, ", ")))
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+type checker struct {
+	unknown []string
+	invalid []string
+}
+
+func (c *checker) mismatch(key string, expected string, value interface{}) {
+	c.invalid = append(c.invalid, fmt.Sprintf("%s: expected %s, got %s", key, expected, describe(value)))
+}
+
+func (c *checker) checkValue(key string, value interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		if _, ok := value.(string); !ok {
+			c.mismatch(key, "string", value)
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			c.mismatch(key, "table", value)
+			return
+		}
+		for _, k := range sortedKeys(table) {
+			field, ok := findField(t, k)
+			if !ok {
+				c.unknown = append(c.unknown, joinKey(key, k))
+				continue
+			}
+			c.checkValue(joinKey(key, k), table[k], field.Type)
+		}
+	case reflect.Map:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			c.mismatch(key, "table", value)
+			return
+		}
+		for _, k := range sortedKeys(table) {
+			c.checkValue(joinKey(key, k), table[k], t.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		elems := reflect.ValueOf(value)
+		if elems.Kind() != reflect.Slice {
+			c.mismatch(key, "array", value)
+			return
+		}
+		for i := 0; i < elems.Len(); i++ {
+			c.checkValue(fmt.Sprintf("%s[%d]", key, i), elems.Index(i).Interface(), t.Elem())
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			c.mismatch(key, "string", value)
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			c.mismatch(key, "boolean", value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, ok := value.(int64); !ok {
+			c.mismatch(key, "integer", value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(float64); !ok {
+			c.mismatch(key, "float", value)
+		}
+	case reflect.Interface:
+	default:
+		// e.g., the funcs and chans which can't be configured
+		c.unknown = append(c.unknown, key)
+	}
+}
+
+func sortedKeys(table map[string]interface{}) []string {
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinKey(prefix string, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// findField returns the field of the struct decoded from the key the same way as the toml decoder: by the
+// toml tag or the field name, case-insensitively, including the fields of the embedded structs without a tag
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := fieldName(field)
+		if skip {
+			continue
+		}
+		if len(name) == 0 {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if f, ok := findField(ft, key); ok {
+					return f, true
+				}
+			}
+			continue
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldName returns the key of the field, it's empty for the embedded struct without a tag, skip is true if
+// the field is never decoded from the config file
+func fieldName(field reflect.StructField) (name string, skip bool) {
+	tag := strings.Split(field.Tag.Get("toml"), ",")[0]
+	if tag == "-" {
+		return "", true
+	}
+	if len(tag) > 0 {
+		return tag, false
+	}
+	if field.Anonymous {
+		return "", false
+	}
+	return field.Name, len(field.PkgPath) > 0
+}
+
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case int64:
+		return fmt.Sprintf("integer %d", v)
+	case float64:
+		return fmt.Sprintf("float %v", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "table"
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Slice {
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestConfig(t *testing.T) {
+	TestingT(t)
+}
+
+type configSuite struct{}
+
+var _ = Suite(&configSuite{})
+
+type tableName struct {
+	Schema string `toml:"db-name"`
+	Table  string `toml:"tbl-name"`
+}
+
+type dbConfig struct {
+	Host     string `toml:"host"`
+	Password string `toml:"password"`
+	Port     int    `toml:"port"`
+}
+
+type testConfig struct {
+	LogLevel    string      `toml:"log-level"`
+	WorkerCount int         `toml:"worker-count"`
+	SafeMode    bool        `toml:"safe-mode"`
+	Ratio       float64     `toml:"ratio"`
+	DoDBs       []string    `toml:"replicate-do-db"`
+	DoTables    []tableName `toml:"replicate-do-table"`
+	DestDB      *dbConfig   `toml:"dest-db"`
+	Ignored     string      `toml:"-"`
+	Timeout     int
+	configFile  string
+}
+
+func writeFile(c *C, name string, content string) string {
+	path := filepath.Join(c.MkDir(), name)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+	return path
+}
+
+func (s *configSuite) TestLoadTOML(c *C) {
+	path := writeFile(c, "test.toml", `
+log-level = "debug"
+ratio = 1.5
+replicate-do-db = ["a", "b"]
+[[replicate-do-table]]
+db-name = "test"
+tbl-name = "t1"
+[dest-db]
+host = "127.0.0.1"
+port = 3306
+`)
+	cfg := &testConfig{WorkerCount: 16, DestDB: &dbConfig{Port: 4000}}
+	c.Assert(Load(path, "test", cfg), IsNil)
+	c.Assert(cfg, DeepEquals, &testConfig{
+		LogLevel:    "debug",
+		WorkerCount: 16,
+		Ratio:       1.5,
+		DoDBs:       []string{"a", "b"},
+		DoTables:    []tableName{{Schema: "test", Table: "t1"}},
+		DestDB:      &dbConfig{Host: "127.0.0.1", Port: 3306},
+	})
+}
+
+func (s *configSuite) TestLoadYAML(c *C) {
+	path := writeFile(c, "test.yaml", `
+log-level: debug
+safe-mode: true
+replicate-do-db: [a, b]
+replicate-do-table:
+  - db-name: test
+    tbl-name: t1
+dest-db:
+  host: 127.0.0.1
+  port:
+`)
+	cfg := &testConfig{WorkerCount: 16, DestDB: &dbConfig{Port: 4000}}
+	c.Assert(Load(path, "test", cfg), IsNil)
+	c.Assert(cfg, DeepEquals, &testConfig{
+		LogLevel:    "debug",
+		WorkerCount: 16,
+		SafeMode:    true,
+		DoDBs:       []string{"a", "b"},
+		DoTables:    []tableName{{Schema: "test", Table: "t1"}},
+		DestDB:      &dbConfig{Host: "127.0.0.1", Port: 4000},
+	})
+}
+
+func (s *configSuite) TestInvalidKeysAndValues(c *C) {
+	path := writeFile(c, "test.toml", `
+worker-count = "16"
+unknown = 1
+timeout = 10
+Ignored = "x"
+[[replicate-do-table]]
+db-name = 1
+[dest-db]
+hostname = "127.0.0.1"
+`)
+	cfg := new(testConfig)
+	err := Load(path, "test", cfg)
+	c.Assert(err, ErrorMatches, ".*component test's config file .* contained unknown configuration options: "+
+		"Ignored, dest-db.hostname, unknown; .*contained invalid values: "+
+		`replicate-do-table\[0\].db-name: expected string, got integer 1, worker-count: expected integer, got string "16"`)
+	c.Assert(cfg.WorkerCount, Equals, 0)
+
+	path = writeFile(c, "test.yml", "safe-mode: yes\nratio: abc\ndest-db: localhost\n")
+	err = Load(path, "test", cfg)
+	c.Assert(err, ErrorMatches, ".*contained invalid values: dest-db: expected table, got string \"localhost\", "+
+		"ratio: expected float, got string \"abc\"")
+
+	path = writeFile(c, "test.yml", "- a\n- b\n")
+	c.Assert(Load(path, "test", cfg), ErrorMatches, ".*the top level must be a mapping, got array.*")
+}
+
+func (s *configSuite) TestPrint(c *C) {
+	cfg := &testConfig{
+		LogLevel: "info",
+		DoTables: []tableName{{Schema: "test", Table: "t1"}},
+		DestDB:   &dbConfig{Host: "127.0.0.1", Password: "secret", Port: 3306},
+		Ignored:  "x",
+		Timeout:  10,
+	}
+	buf := new(bytes.Buffer)
+	c.Assert(Print(buf, cfg), IsNil)
+	c.Assert(buf.String(), Equals, `log-level = "info"
+ratio = 0.0
+safe-mode = false
+worker-count = 0
+
+[dest-db]
+  host = "127.0.0.1"
+  password = "******"
+  port = 3306
+
+[[replicate-do-table]]
+  db-name = "test"
+  tbl-name = "t1"
+`)
+
+	// the printed config is loaded back
+	path := writeFile(c, "test.toml", buf.String())
+	loaded := new(testConfig)
+	c.Assert(Load(path, "test", loaded), IsNil)
+	c.Assert(loaded.DoTables, DeepEquals, cfg.DoTables)
+	c.Assert(loaded.DestDB.Password, Equals, "******")
+}
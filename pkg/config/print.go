@@ -0,0 +1,131 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+)
+
+// redacted replaces the passwords in the effective config
+const redacted = "******"
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Print writes the effective config in TOML, i.e., the values adjusted after parsing. Only the fields with toml tags are
+// written, and the passwords are redacted.
+func Print(w io.Writer, cfg interface{}) error {
+	values, ok := toValue(reflect.ValueOf(cfg)).(map[string]interface{})
+	if !ok {
+		return errors.Errorf("config must be a struct, got %T", cfg)
+	}
+	return errors.Trace(toml.NewEncoder(w).Encode(values))
+}
+
+// toValue converts v to the value encoded in TOML, nil if it's not encoded
+func toValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	if reflect.PtrTo(v.Type()).Implements(textMarshalerType) && v.CanAddr() {
+		return v.Addr().Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		values := make(map[string]interface{})
+		addFields(values, v)
+		return values
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		values := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			if elem := toValue(v.MapIndex(k)); elem != nil {
+				values[k.String()] = elem
+			}
+		}
+		return values
+	case reflect.Slice, reflect.Array:
+		elems := make([]interface{}, 0, v.Len())
+		tables := make([]map[string]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem := toValue(v.Index(i))
+			if elem == nil {
+				continue
+			}
+			if table, ok := elem.(map[string]interface{}); ok {
+				tables = append(tables, table)
+			}
+			elems = append(elems, elem)
+		}
+		if len(elems) == 0 {
+			return nil
+		}
+		// the array of tables is encoded as [[table]]
+		if len(tables) == len(elems) {
+			return tables
+		}
+		return elems
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return nil
+	}
+	return v.Interface()
+}
+
+// addFields adds the fields of the struct with toml tags to values, and the ones of the embedded structs
+func addFields(values map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("toml"), ",")[0]
+		fv := v.Field(i)
+		if tag == "-" || len(field.PkgPath) > 0 {
+			continue
+		}
+		if len(tag) == 0 {
+			if !field.Anonymous {
+				continue
+			}
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				addFields(values, fv)
+			}
+			continue
+		}
+
+		value := toValue(fv)
+		if value == nil {
+			continue
+		}
+		if s, ok := value.(string); ok && len(s) > 0 && strings.Contains(strings.ToLower(tag), "password") {
+			value = redacted
+		}
+		values[tag] = value
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encrypt encrypts the values of the configured columns before they are written to
+// downstream, or decrypts them when restoring, so the replicas don't store the plaintext.
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+// Prefix is the prefix of the encrypted values
+const Prefix = "enc:"
+
+// KeySize is the size of the key in bytes, AES-256 is used
+const KeySize = 32
+
+const (
+	// ModeEncrypt encrypts the columns
+	ModeEncrypt = "encrypt"
+	// ModeDecrypt decrypts the columns
+	ModeDecrypt = "decrypt"
+)
+
+// Rule selects the column to encrypt, an empty Schema or Table matches all.
+type Rule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Column string `toml:"column" json:"column"`
+	// the max length in bytes of the plaintext, the downstream column must be able to hold
+	// EncryptedLen(MaxLength), see Transformer.CheckColumns
+	MaxLength int `toml:"max-length" json:"max-length"`
+}
+
+func (r *Rule) match(schema, table, column string) bool {
+	return (len(r.Schema) == 0 || strings.EqualFold(r.Schema, schema)) &&
+		(len(r.Table) == 0 || strings.EqualFold(r.Table, table)) &&
+		strings.EqualFold(r.Column, column)
+}
+
+// Config is the configuration of the column encryption.
+// The key is the base64 encoded 32 bytes read from the environment variable KeyEnv,
+// or printed to stdout by KeyCommand, e.g., the command decrypting the data key by KMS.
+type Config struct {
+	// "encrypt" or "decrypt", default "encrypt"
+	Mode       string   `toml:"mode" json:"mode"`
+	Rules      []Rule   `toml:"column" json:"column"`
+	KeyEnv     string   `toml:"key-env" json:"key-env"`
+	KeyCommand []string `toml:"key-command" json:"key-command"`
+}
+
+// Validate checks whether the config is valid, the key is not loaded.
+func (c *Config) Validate() error {
+	if len(c.Mode) > 0 && c.Mode != ModeEncrypt && c.Mode != ModeDecrypt {
+		return errors.Errorf("mode must be %s or %s, got %s", ModeEncrypt, ModeDecrypt, c.Mode)
+	}
+	if len(c.Rules) == 0 {
+		return errors.New("no column to encrypt")
+	}
+	for _, r := range c.Rules {
+		if len(r.Column) == 0 {
+			return errors.Errorf("column of %s.%s is empty", r.Schema, r.Table)
+		}
+	}
+	if (len(c.KeyEnv) == 0) == (len(c.KeyCommand) == 0) {
+		return errors.New("one and only one of key-env and key-command must be set")
+	}
+	return nil
+}
+
+// loadKey reads the key from the environment variable or the output of the command
+func (c *Config) loadKey() ([]byte, error) {
+	var encoded string
+	if len(c.KeyEnv) > 0 {
+		var ok bool
+		if encoded, ok = os.LookupEnv(c.KeyEnv); !ok {
+			return nil, errors.Errorf("environment variable %s is not set", c.KeyEnv)
+		}
+	} else {
+		var stderr bytes.Buffer
+		cmd := exec.Command(c.KeyCommand[0], c.KeyCommand[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Annotatef(err, "run key command %s: %s", c.KeyCommand[0], stderr.String())
+		}
+		encoded = string(out)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Annotate(err, "key is not base64 encoded")
+	}
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Cipher encrypts the values by AES-GCM.
+// The nonce is derived from the plaintext, so the same value is always encrypted to the same one,
+// which makes the encrypted columns in the primary key or unique keys still work in the WHERE clauses,
+// the cost is that the equality of the values is not hidden.
+type Cipher struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// NewCipher returns a Cipher using key, the keys of encryption and the nonce are derived from it.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(deriveKey(key, "encryption"))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Cipher{aead: aead, nonceKey: deriveKey(key, "nonce")}, nil
+}
+
+func deriveKey(key []byte, usage string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(usage))
+	return mac.Sum(nil)
+}
+
+// EncryptedLen returns the length of the value encrypted from the plaintext of n bytes,
+// i.e., the length of Prefix + base64(nonce + ciphertext + tag).
+func EncryptedLen(n int) int {
+	// the nonce and tag of AES-GCM are 12 and 16 bytes
+	return len(Prefix) + base64.StdEncoding.EncodedLen(12+n+16)
+}
+
+// Encrypt returns the encrypted plaintext as Prefix + base64(nonce + ciphertext)
+func (c *Cipher) Encrypt(plaintext []byte) string {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write(plaintext)
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	return Prefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// Decrypt decrypts the value returned by Encrypt
+func (c *Cipher) Decrypt(value string) ([]byte, error) {
+	if !strings.HasPrefix(value, Prefix) {
+		return nil, errors.New("value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[len(Prefix):])
+	if err != nil {
+		return nil, errors.Annotate(err, "decode encrypted value failed")
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Annotate(err, "decrypt value failed")
+	}
+	return plaintext, nil
+}
+
+// Transformer encrypts or decrypts the columns of DMLs
+type Transformer struct {
+	cfg    Config
+	cipher *Cipher
+}
+
+// New loads the key and returns a Transformer
+func New(cfg *Config) (*Transformer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	key, err := cfg.loadKey()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c, err := NewCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Transformer{cfg: *cfg, cipher: c}, nil
+}
+
+// Transform encrypts or decrypts the values of the configured columns of dml, it implements loader.Transform.
+func (t *Transformer) Transform(dml *loader.DML) error {
+	if err := t.transformValues(dml.Database, dml.Table, dml.Values); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(t.transformValues(dml.Database, dml.Table, dml.OldValues))
+}
+
+func (t *Transformer) transformValues(schema, table string, values map[string]interface{}) error {
+	for column, value := range values {
+		if value == nil || !t.match(schema, table, column) {
+			continue
+		}
+
+		if t.cfg.Mode == ModeDecrypt {
+			var s string
+			switch v := value.(type) {
+			case string:
+				s = v
+			case []byte:
+				s = string(v)
+			default:
+				return errors.Errorf("column %s.%s.%s of %T can't be an encrypted value", schema, table, column, value)
+			}
+			// the values written before the encryption is enabled are kept as they are
+			if !strings.HasPrefix(s, Prefix) {
+				continue
+			}
+			plaintext, err := t.cipher.Decrypt(s)
+			if err != nil {
+				return errors.Annotatef(err, "column %s", column)
+			}
+			values[column] = string(plaintext)
+			continue
+		}
+
+		values[column] = t.cipher.Encrypt(toBytes(value))
+	}
+	return nil
+}
+
+func (t *Transformer) match(schema, table, column string) bool {
+	return t.maxLength(schema, table, column) >= 0
+}
+
+// maxLength returns the max Rule.MaxLength of the rules matching the column, -1 if none matches.
+func (t *Transformer) maxLength(schema, table, column string) int {
+	maxLength := -1
+	for i := range t.cfg.Rules {
+		if t.cfg.Rules[i].match(schema, table, column) && t.cfg.Rules[i].MaxLength > maxLength {
+			maxLength = t.cfg.Rules[i].MaxLength
+		}
+	}
+	return maxLength
+}
+
+// the types of the columns which can hold the encrypted values
+var textTypes = map[string]struct{}{
+	"char": {}, "varchar": {}, "binary": {}, "varbinary": {},
+	"tinytext": {}, "text": {}, "mediumtext": {}, "longtext": {},
+	"tinyblob": {}, "blob": {}, "mediumblob": {}, "longblob": {},
+}
+
+// CheckColumns checks whether the columns encrypted in downstream can hold the encrypted values, i.e., they are
+// of string or binary types and not shorter than EncryptedLen(Rule.MaxLength), so the values aren't truncated
+// or rejected in the middle of replicating. It's a no-op in the decrypt mode.
+func (t *Transformer) CheckColumns(db *sql.DB) error {
+	if t.cfg.Mode == ModeDecrypt {
+		return nil
+	}
+
+	columns := make([]string, 0, len(t.cfg.Rules))
+	args := make([]interface{}, 0, len(t.cfg.Rules))
+	for _, r := range t.cfg.Rules {
+		columns = append(columns, "?")
+		args = append(args, r.Column)
+	}
+	query := "SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS " +
+		"WHERE TABLE_SCHEMA NOT IN ('INFORMATION_SCHEMA', 'PERFORMANCE_SCHEMA', 'METRICS_SCHEMA', 'mysql') " +
+		"AND COLUMN_NAME IN (" + strings.Join(columns, ",") + ")"
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return errors.Annotate(err, "query the columns to encrypt failed")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			schema, table, column, tp string
+			width                     sql.NullInt64
+		)
+		if err = rows.Scan(&schema, &table, &column, &tp, &width); err != nil {
+			return errors.Trace(err)
+		}
+		maxLength := t.maxLength(schema, table, column)
+		if maxLength < 0 {
+			continue
+		}
+
+		if _, ok := textTypes[strings.ToLower(tp)]; !ok {
+			return errors.Errorf("column %s.%s.%s of type %s can't hold the encrypted values, which are text", schema, table, column, tp)
+		}
+		if need := EncryptedLen(maxLength); width.Valid && width.Int64 < int64(need) {
+			return errors.Errorf("column %s.%s.%s of %s(%d) can't hold the encrypted values of %d bytes, which need %d",
+				schema, table, column, tp, width.Int64, maxLength, need)
+		}
+	}
+	return errors.Trace(rows.Err())
+}
+
+func toBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
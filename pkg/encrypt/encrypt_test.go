@@ -0,0 +1,191 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+type encryptSuite struct{}
+
+var _ = Suite(&encryptSuite{})
+
+var testKey = bytes.Repeat([]byte{0x42}, KeySize)
+
+func (s *encryptSuite) TestCipher(c *C) {
+	_, err := NewCipher([]byte("short"))
+	c.Assert(err, ErrorMatches, ".*key must be 32 bytes.*")
+
+	cipher, err := NewCipher(testKey)
+	c.Assert(err, IsNil)
+
+	encrypted := cipher.Encrypt([]byte("a@pingcap.com"))
+	c.Assert(strings.HasPrefix(encrypted, Prefix), IsTrue)
+	c.Assert(strings.Contains(encrypted, "pingcap"), IsFalse)
+	// the same value is encrypted to the same one
+	c.Assert(cipher.Encrypt([]byte("a@pingcap.com")), Equals, encrypted)
+	c.Assert(cipher.Encrypt([]byte("b@pingcap.com")), Not(Equals), encrypted)
+
+	plaintext, err := cipher.Decrypt(encrypted)
+	c.Assert(err, IsNil)
+	c.Assert(string(plaintext), Equals, "a@pingcap.com")
+
+	other, err := NewCipher(bytes.Repeat([]byte{0x24}, KeySize))
+	c.Assert(err, IsNil)
+	_, err = other.Decrypt(encrypted)
+	c.Assert(err, ErrorMatches, ".*decrypt value failed.*")
+
+	_, err = cipher.Decrypt("plain")
+	c.Assert(err, ErrorMatches, ".*not encrypted.*")
+}
+
+func (s *encryptSuite) TestValidate(c *C) {
+	cfg := &Config{Rules: []Rule{{Column: "email"}}, KeyEnv: "KEY"}
+	c.Assert(cfg.Validate(), IsNil)
+
+	cfg.Mode = "hash"
+	c.Assert(cfg.Validate(), ErrorMatches, ".*mode must be.*")
+	cfg.Mode = ModeDecrypt
+
+	cfg.KeyCommand = []string{"echo"}
+	c.Assert(cfg.Validate(), ErrorMatches, ".*one and only one.*")
+	cfg.KeyEnv = ""
+	c.Assert(cfg.Validate(), IsNil)
+
+	cfg.Rules = []Rule{{Table: "user"}}
+	c.Assert(cfg.Validate(), ErrorMatches, ".*column of .user is empty.*")
+	cfg.Rules = nil
+	c.Assert(cfg.Validate(), ErrorMatches, ".*no column.*")
+}
+
+func (s *encryptSuite) TestLoadKey(c *C) {
+	encoded := base64.StdEncoding.EncodeToString(testKey)
+
+	os.Setenv("TEST_ENCRYPT_KEY", encoded)
+	defer os.Unsetenv("TEST_ENCRYPT_KEY")
+	key, err := (&Config{KeyEnv: "TEST_ENCRYPT_KEY"}).loadKey()
+	c.Assert(err, IsNil)
+	c.Assert(key, DeepEquals, testKey)
+
+	_, err = (&Config{KeyEnv: "TEST_ENCRYPT_KEY_NOT_EXIST"}).loadKey()
+	c.Assert(err, ErrorMatches, ".*not set.*")
+
+	key, err = (&Config{KeyCommand: []string{"echo", encoded}}).loadKey()
+	c.Assert(err, IsNil)
+	c.Assert(key, DeepEquals, testKey)
+
+	_, err = (&Config{KeyCommand: []string{"echo", "YWJj"}}).loadKey()
+	c.Assert(err, ErrorMatches, ".*key must be 32 bytes.*")
+
+	_, err = (&Config{KeyCommand: []string{"false"}}).loadKey()
+	c.Assert(err, ErrorMatches, ".*run key command.*")
+}
+
+func (s *encryptSuite) TestTransform(c *C) {
+	encoded := base64.StdEncoding.EncodeToString(testKey)
+	rules := []Rule{{Schema: "test", Table: "user", Column: "email"}, {Column: "phone"}}
+
+	enc, err := New(&Config{Rules: rules, KeyCommand: []string{"echo", encoded}})
+	c.Assert(err, IsNil)
+	dec, err := New(&Config{Mode: ModeDecrypt, Rules: rules, KeyCommand: []string{"echo", encoded}})
+	c.Assert(err, IsNil)
+
+	dml := &loader.DML{
+		Database:  "test",
+		Table:     "user",
+		Tp:        loader.UpdateDMLType,
+		Values:    map[string]interface{}{"id": 1, "email": "a@pingcap.com", "phone": int64(123), "name": nil},
+		OldValues: map[string]interface{}{"id": 1, "email": []byte("b@pingcap.com"), "phone": nil, "name": "a"},
+	}
+	c.Assert(enc.Transform(dml), IsNil)
+	c.Assert(dml.Values["id"], Equals, 1)
+	c.Assert(dml.Values["name"], IsNil)
+	c.Assert(dml.OldValues["phone"], IsNil)
+	c.Assert(dml.OldValues["name"], Equals, "a")
+	for _, v := range []interface{}{dml.Values["email"], dml.Values["phone"], dml.OldValues["email"]} {
+		c.Assert(strings.HasPrefix(v.(string), Prefix), IsTrue)
+	}
+
+	c.Assert(dec.Transform(dml), IsNil)
+	c.Assert(dml.Values, DeepEquals, map[string]interface{}{"id": 1, "email": "a@pingcap.com", "phone": "123", "name": nil})
+	c.Assert(dml.OldValues, DeepEquals, map[string]interface{}{"id": 1, "email": "b@pingcap.com", "phone": nil, "name": "a"})
+
+	// the plaintext values are kept when decrypting
+	c.Assert(dec.Transform(dml), IsNil)
+	c.Assert(dml.Values["email"], Equals, "a@pingcap.com")
+
+	other := &loader.DML{Database: "test", Table: "order", Values: map[string]interface{}{"email": "a@pingcap.com"}}
+	c.Assert(enc.Transform(other), IsNil)
+	c.Assert(other.Values["email"], Equals, "a@pingcap.com")
+
+	// the values not encrypted can't be of other types
+	numeric := &loader.DML{Database: "test", Table: "user", Values: map[string]interface{}{"phone": int64(123)}}
+	c.Assert(dec.Transform(numeric), ErrorMatches, "column test.user.phone of int64 can't be an encrypted value")
+}
+
+func (s *encryptSuite) TestEncryptedLen(c *C) {
+	cipher, err := NewCipher(testKey)
+	c.Assert(err, IsNil)
+	for _, n := range []int{0, 1, 2, 3, 100, 255} {
+		c.Assert(len(cipher.Encrypt(bytes.Repeat([]byte("a"), n))), Equals, EncryptedLen(n))
+	}
+}
+
+func (s *encryptSuite) TestCheckColumns(c *C) {
+	encoded := base64.StdEncoding.EncodeToString(testKey)
+	rules := []Rule{{Schema: "test", Table: "user", Column: "email", MaxLength: 30}, {Column: "phone"}}
+	enc, err := New(&Config{Rules: rules, KeyCommand: []string{"echo", encoded}})
+	c.Assert(err, IsNil)
+
+	check := func(rows *sqlmock.Rows) error {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		defer db.Close()
+		mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS").
+			WithArgs("email", "phone").WillReturnRows(rows)
+		err = enc.CheckColumns(db)
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		return err
+	}
+	columns := []string{"TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "CHARACTER_MAXIMUM_LENGTH"}
+
+	// EncryptedLen(30) = 84, EncryptedLen(0) = 44
+	err = check(sqlmock.NewRows(columns).AddRow("test", "user", "email", "varchar", 84).
+		AddRow("test", "user", "phone", "text", 65535).AddRow("test", "order", "email", "int", nil).
+		AddRow("test", "order", "phone", "varbinary", 44))
+	c.Assert(err, IsNil)
+
+	err = check(sqlmock.NewRows(columns).AddRow("test", "user", "email", "varchar", 83))
+	c.Assert(err, ErrorMatches, "column test.user.email of varchar\\(83\\) can't hold the encrypted values of 30 bytes, which need 84")
+
+	err = check(sqlmock.NewRows(columns).AddRow("test", "user", "phone", "bigint", nil))
+	c.Assert(err, ErrorMatches, "column test.user.phone of type bigint can't hold the encrypted values.*")
+
+	// the columns are not checked when decrypting
+	dec, err := New(&Config{Mode: ModeDecrypt, Rules: rules, KeyCommand: []string{"echo", encoded}})
+	c.Assert(err, IsNil)
+	c.Assert(dec.CheckColumns(nil), IsNil)
+}
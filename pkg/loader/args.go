@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+// wideTableColumns is the number of columns from which the args of the multi-row inserts are assembled
+// by wideInsertArgs
+const wideTableColumns = 64
+
+// insertArgs returns the values of columns of the rows of inserts in the order of the multi-row insert,
+// it's allocated from the pool and must be released by putArgs once it's not referenced
+func insertArgs(inserts []*DML, columns []string) []interface{} {
+	if inserts[0].hasVirtualArgs() {
+		return virtualInsertArgs(inserts, columns)
+	}
+	if len(columns) >= wideTableColumns {
+		return wideInsertArgs(inserts, columns)
+	}
+	return rowInsertArgs(inserts, columns)
+}
+
+func rowInsertArgs(inserts []*DML, columns []string) []interface{} {
+	args := getArgs(len(inserts) * len(columns))
+	for _, insert := range inserts {
+		for _, name := range columns {
+			args = append(args, insert.Values[name])
+		}
+	}
+	return args
+}
+
+// wideInsertArgs is insertArgs for the wide tables, the backing array is sized up front and the values of
+// each row are assigned into its own window of it, so there's no append on the hundreds of values per row.
+// The rows are kept as the outer loop, so the map of a row is probed for all the columns while it's in cache,
+// BenchmarkInsertArgs compares it with the columns in the outer loop.
+func wideInsertArgs(inserts []*DML, columns []string) []interface{} {
+	width := len(columns)
+	args := getArgs(len(inserts) * width)[:len(inserts)*width]
+	for r, insert := range inserts {
+		row := args[r*width : (r+1)*width]
+		for c, name := range columns {
+			row[c] = insert.Values[name]
+		}
+	}
+	return args
+}
+
+// virtualInsertArgs is insertArgs for the tables with the commit ts bound to their virtual columns, which follow
+// the values of each row, see VirtualColumns
+func virtualInsertArgs(inserts []*DML, columns []string) []interface{} {
+	args := getArgs(len(inserts) * (len(columns) + 1))
+	for _, insert := range inserts {
+		for _, name := range columns {
+			args = append(args, insert.Values[name])
+		}
+		args = insert.appendVirtualArgs(args)
+	}
+	return args
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"testing"
+
+	check "github.com/pingcap/check"
+)
+
+type argsSuite struct{}
+
+var _ = check.Suite(&argsSuite{})
+
+func newWideInserts(rows int, width int) ([]*DML, []string) {
+	columns := make([]string, 0, width)
+	for c := 0; c < width; c++ {
+		columns = append(columns, fmt.Sprintf("c%d", c))
+	}
+	info := &tableInfo{columns: columns}
+	inserts := make([]*DML, 0, rows)
+	for r := 0; r < rows; r++ {
+		values := make(map[string]interface{}, width)
+		for c, name := range columns {
+			values[name] = r*width + c
+		}
+		inserts = append(inserts, &DML{Database: "db", Table: "tbl", Tp: InsertDMLType, Values: values, info: info})
+	}
+	return inserts, columns
+}
+
+// columnarInsertArgs assembles the args by columns in the outer loop and rows in the inner loop,
+// it's the baseline of wideInsertArgs in BenchmarkInsertArgs
+func columnarInsertArgs(inserts []*DML, columns []string) []interface{} {
+	width := len(columns)
+	args := getArgs(len(inserts) * width)[:len(inserts)*width]
+	for c, name := range columns {
+		for r, i := 0, c; r < len(inserts); r, i = r+1, i+width {
+			args[i] = inserts[r].Values[name]
+		}
+	}
+	return args
+}
+
+func (s *argsSuite) TestInsertArgs(c *check.C) {
+	for _, width := range []int{3, wideTableColumns, wideTableColumns + 1} {
+		inserts, columns := newWideInserts(5, width)
+		expected := rowInsertArgs(inserts, columns)
+		c.Assert(expected, check.HasLen, 5*width)
+		for i, arg := range expected {
+			c.Assert(arg, check.Equals, i)
+		}
+		c.Assert(wideInsertArgs(inserts, columns), check.DeepEquals, expected)
+		c.Assert(columnarInsertArgs(inserts, columns), check.DeepEquals, expected)
+		c.Assert(insertArgs(inserts, columns), check.DeepEquals, expected)
+	}
+
+	c.Assert(holderString(3), check.Equals, "?,?,?")
+	c.Assert(holderString(0), check.Equals, "")
+	c.Assert(buildColumnList([]string{"a", "b"}), check.Equals, "`a`,`b`")
+}
+
+// the micro benchmarks of assembling the placeholders and the args of the multi-row inserts by table width
+
+var benchmarkWidths = []int{8, 64, 256, 512}
+
+func BenchmarkInsertArgs(b *testing.B) {
+	for _, width := range benchmarkWidths {
+		inserts, columns := newWideInserts(64, width)
+		for _, assembly := range []struct {
+			name string
+			fn   func([]*DML, []string) []interface{}
+		}{{"rows", rowInsertArgs}, {"wide", wideInsertArgs}, {"columns", columnarInsertArgs}} {
+			b.Run(fmt.Sprintf("width=%d/%s", width, assembly.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					putArgs(assembly.fn(inserts, columns))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkHolderString(b *testing.B) {
+	for _, width := range benchmarkWidths {
+		b.Run(fmt.Sprintf("width=%d", width), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				holderString(width)
+			}
+		})
+	}
+}
+
+func BenchmarkBulkReplaceStatement(b *testing.B) {
+	for _, width := range benchmarkWidths {
+		inserts, _ := newWideInserts(64, width)
+		b.Run(fmt.Sprintf("width=%d", width), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				putArgs(bulkReplaceStatement(inserts).Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// BarrierType is the reason a barrier is emitted in the pipeline of loader
+type BarrierType int
+
+// the types of barriers
+const (
+	// emitted before a DDL is executed
+	DDLBarrier BarrierType = iota + 1
+	// emitted after the table info of downstream is refreshed by a DDL
+	TableInfoBarrier
+	// emitted on a Flush, e.g., before the checkpoint is saved
+	FlushBarrier
+)
+
+func (t BarrierType) String() string {
+	switch t {
+	case DDLBarrier:
+		return "ddl"
+	case TableInfoBarrier:
+		return "table info"
+	case FlushBarrier:
+		return "flush"
+	default:
+		return "unknown"
+	}
+}
+
+// Barrier separates the txns input to loader into epochs. When a barrier is emitted, the DMLs of the txns
+// input before it have been committed in downstream, and none of the txns input after it has been executed,
+// the DMLs of different epochs are never executed in the same batch.
+type Barrier struct {
+	Tp BarrierType
+	// the epoch starting from the barrier
+	Epoch uint64
+	// the commit ts of the DDL for DDLBarrier and TableInfoBarrier, the applied ts for FlushBarrier
+	CommitTS int64
+}
+
+// checkEpoch returns an error if dmls belong to different epochs, i.e., they cross a barrier
+func checkEpoch(dmls []*DML) error {
+	for _, dml := range dmls {
+		if dml.epoch != dmls[0].epoch {
+			return errors.Errorf("dml of %s in epoch %d is executed with the dmls in epoch %d, it crosses a barrier",
+				dml.TableName(), dml.epoch, dmls[0].epoch)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type barrierSuite struct{}
+
+var _ = Suite(&barrierSuite{})
+
+func (s *barrierSuite) TestCheckEpoch(c *C) {
+	c.Assert(checkEpoch(nil), IsNil)
+	c.Assert(checkEpoch([]*DML{{epoch: 1}, {epoch: 1}}), IsNil)
+	err := checkEpoch([]*DML{{Database: "test", Table: "t", epoch: 1}, {Database: "test", Table: "t", epoch: 2}})
+	c.Assert(err, ErrorMatches, ".*in epoch 2 is executed with the dmls in epoch 1.*")
+}
+
+func (s *barrierSuite) TestBarriers(c *C) {
+	var executed [][]*DML
+	var events []string
+	var barriers []Barrier
+	bm := batchManager{
+		limit: 1024,
+		fExecDMLs: func(dmls []*DML) error {
+			executed = append(executed, append([]*DML(nil), dmls...))
+			events = append(events, "dmls")
+			return checkEpoch(dmls)
+		},
+		fDMLsSuccessCallback: func(...*Txn) {},
+		fExecDDL: func(*DDL) error {
+			events = append(events, "ddl")
+			return nil
+		},
+		fDDLSuccessCallback: func(*Txn) {},
+		fBarrierCallback: func(b Barrier) {
+			events = append(events, b.Tp.String())
+			barriers = append(barriers, b)
+		},
+	}
+
+	c.Assert(bm.put(&Txn{CommitTS: 1, DMLs: []*DML{{}, {}}}), IsNil)
+	c.Assert(bm.put(&Txn{CommitTS: 2, DDL: &DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"}}), IsNil)
+	c.Assert(bm.put(&Txn{CommitTS: 3, DMLs: []*DML{{}}}), IsNil)
+	c.Assert(bm.barrier(FlushBarrier, 3), IsNil)
+
+	c.Assert(events, DeepEquals, []string{"dmls", "ddl", "ddl", "table info", "dmls", "flush"})
+	c.Assert(barriers, DeepEquals, []Barrier{
+		{Tp: DDLBarrier, Epoch: 1, CommitTS: 2},
+		{Tp: TableInfoBarrier, Epoch: 2, CommitTS: 2},
+		{Tp: FlushBarrier, Epoch: 3, CommitTS: 3},
+	})
+	c.Assert(executed, HasLen, 2)
+	c.Assert(executed[0][0].epoch, Equals, uint64(0))
+	c.Assert(executed[1][0].epoch, Equals, uint64(2))
+
+	// the DDLs not changing the table info emit no TableInfoBarrier
+	barriers = nil
+	c.Assert(bm.put(&Txn{CommitTS: 4, DDL: &DDL{Database: "test", Table: "t", SQL: "DROP TABLE t"}}), IsNil)
+	c.Assert(barriers, DeepEquals, []Barrier{{Tp: DDLBarrier, Epoch: 4, CommitTS: 4}})
+}
@@ -0,0 +1,170 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"go.uber.org/zap"
+)
+
+// Report is the result of a benchmark
+type Report struct {
+	Txns     int
+	DMLs     int
+	Duration time.Duration
+	// the latency of each txn, from input to the loader to success
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// TxnsPerSecond returns the throughput in txns
+func (r *Report) TxnsPerSecond() float64 {
+	return float64(r.Txns) / r.Duration.Seconds()
+}
+
+// DMLsPerSecond returns the throughput in DMLs
+func (r *Report) DMLsPerSecond() float64 {
+	return float64(r.DMLs) / r.Duration.Seconds()
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "txns: %d, dmls: %d, duration: %s\n", r.Txns, r.DMLs, r.Duration)
+	fmt.Fprintf(&b, "throughput: %.1f txns/s, %.1f dmls/s\n", r.TxnsPerSecond(), r.DMLsPerSecond())
+	fmt.Fprintf(&b, "latency: p50 %s, p90 %s, p99 %s, max %s\n", r.P50, r.P90, r.P99, r.Max)
+	return b.String()
+}
+
+// newReport returns the report of the txns applied in duration with their latencies
+func newReport(dmls int, duration time.Duration, latencies []time.Duration) *Report {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	return &Report{
+		Txns:     len(latencies),
+		DMLs:     dmls,
+		Duration: duration,
+		P50:      percentile(0.5),
+		P90:      percentile(0.9),
+		P99:      percentile(0.99),
+		Max:      percentile(1),
+	}
+}
+
+// Run sets up the tables of the workload in db, inserts the initial rows, then applies the txns of the workload
+// by a loader created with opts and reports the throughput and latencies. The initial rows aren't measured.
+func Run(ctx context.Context, db *gosql.DB, w *Workload, opts ...loader.Option) (report *Report, err error) {
+	for _, sql := range w.SetupSQLs() {
+		if _, err = db.ExecContext(ctx, sql); err != nil {
+			return nil, errors.Annotatef(err, "set up tables, sql: %s", sql)
+		}
+	}
+
+	ld, err := loader.NewLoader(db, opts...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var runErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runErr = ld.Run()
+	}()
+	defer func() {
+		ld.Close()
+		for range ld.Successes() {
+		}
+		<-done
+		// the error of the loader is the cause of the failure if any
+		if runErr != nil {
+			report, err = nil, errors.Trace(runErr)
+		}
+	}()
+
+	initial := w.InitialTxns()
+	log.Info("insert the initial rows", zap.Int("txns", len(initial)))
+	if err = apply(ctx, ld, done, initial, nil); err != nil {
+		return nil, errors.Annotate(err, "insert the initial rows")
+	}
+
+	txns := make([]*loader.Txn, w.cfg.Txns)
+	for i := range txns {
+		txns[i] = w.NextTxn()
+	}
+	log.Info("start benchmark", zap.Int("txns", len(txns)), zap.Int("txn size", w.cfg.TxnSize))
+
+	latencies := make([]time.Duration, 0, len(txns))
+	dmls := 0
+	start := time.Now()
+	err = apply(ctx, ld, done, txns, func(txn *loader.Txn) {
+		latencies = append(latencies, time.Since(txn.Metadata.(time.Time)))
+		dmls += len(txn.DMLs)
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return newReport(dmls, time.Since(start), latencies), nil
+}
+
+// apply inputs the txns to the loader and waits for them to succeed, the input time of each txn is set in its
+// Metadata if onSuccess is not nil, which is called with each txn succeeded. done is closed when the loader quits.
+func apply(ctx context.Context, ld loader.Loader, done <-chan struct{}, txns []*loader.Txn, onSuccess func(*loader.Txn)) error {
+	sent := make(chan struct{})
+	defer func() { <-sent }()
+	go func() {
+		defer close(sent)
+		for _, txn := range txns {
+			if onSuccess != nil {
+				txn.Metadata = time.Now()
+			}
+			select {
+			case ld.Input() <- txn:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for range txns {
+		select {
+		case txn, ok := <-ld.Successes():
+			if !ok {
+				return errors.New("loader quit")
+			}
+			if onSuccess != nil {
+				onSuccess(txn)
+			}
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+	return nil
+}
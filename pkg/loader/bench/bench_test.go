@@ -0,0 +1,158 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+func TestClient(t *testing.T) {
+	check.TestingT(t)
+}
+
+var _ = check.Suite(&testBenchSuite{})
+
+type testBenchSuite struct{}
+
+func (s *testBenchSuite) TestValidate(c *check.C) {
+	cfg := DefaultConfig()
+	c.Assert(cfg.Validate(), check.IsNil)
+
+	cfg.InsertWeight, cfg.UpdateWeight, cfg.DeleteWeight = 0, 0, 0
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*weights.*")
+
+	cfg = DefaultConfig()
+	cfg.HotKeySkew = 0.5
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*hot key skew.*")
+
+	_, err := ProfileConfig("unknown")
+	c.Assert(err, check.ErrorMatches, ".*not found.*")
+	for name := range Profiles {
+		cfg, err := ProfileConfig(name)
+		c.Assert(err, check.IsNil)
+		c.Assert(cfg.Validate(), check.IsNil, check.Commentf("profile %s", name))
+	}
+}
+
+func (s *testBenchSuite) TestWorkload(c *check.C) {
+	cfg := DefaultConfig()
+	cfg.Tables = 2
+	cfg.Columns = 2
+	cfg.ValueSize = 16
+	cfg.InitialRows = 5
+	cfg.TxnSize = 4
+	cfg.HotKeySkew = 2
+	w, err := NewWorkload(cfg)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(w.SetupSQLs(), check.HasLen, 4)
+	initial := w.InitialTxns()
+	c.Assert(initial, check.HasLen, 3)
+	c.Assert(initial[2].DMLs, check.HasLen, 2)
+
+	// replay the DMLs on the rows to check the updates and deletes change the existing rows
+	rows := make(map[string]map[interface{}]map[string]interface{})
+	for _, t := range w.tables {
+		rows[t.name] = make(map[interface{}]map[string]interface{})
+	}
+	apply := func(txn *loader.Txn) {
+		for _, dml := range txn.DMLs {
+			table := rows[dml.Table]
+			key := dml.Values["id"]
+			switch dml.Tp {
+			case loader.InsertDMLType:
+				c.Assert(table[key], check.IsNil)
+				c.Assert(dml.Values["c1"], check.HasLen, 16)
+				table[key] = dml.Values
+			case loader.UpdateDMLType:
+				c.Assert(table[key], check.DeepEquals, dml.OldValues)
+				table[key] = dml.Values
+			case loader.DeleteDMLType:
+				c.Assert(table[key], check.DeepEquals, dml.Values)
+				delete(table, key)
+			}
+		}
+	}
+	for _, txn := range initial {
+		apply(txn)
+	}
+	for i := 0; i < 100; i++ {
+		txn := w.NextTxn()
+		c.Assert(txn.DMLs, check.HasLen, 4)
+		apply(txn)
+	}
+}
+
+func (s *testBenchSuite) TestRunWithBlackhole(c *check.C) {
+	cfg := DefaultConfig()
+	cfg.InitialRows = 100
+	cfg.Txns = 200
+	w, err := NewWorkload(cfg)
+	c.Assert(err, check.IsNil)
+
+	db, err := gosql.Open(BlackholeDriver, "")
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	report, err := Run(context.Background(), db, w, loader.WorkerCount(4), loader.SafeMode(true))
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Txns, check.Equals, 200)
+	c.Assert(report.DMLs, check.Equals, 200*cfg.TxnSize)
+	c.Assert(report.P50 <= report.P99, check.IsTrue)
+	c.Assert(report.P99 <= report.Max, check.IsTrue)
+	c.Assert(BlackholeStatements(db), check.Greater, int64(0))
+	c.Assert(report.String(), check.Matches, "(?s)txns: 200, dmls: 2000.*p50.*")
+}
+
+func (s *testBenchSuite) TestBlackhole(c *check.C) {
+	db, err := gosql.Open(BlackholeDriver, "latency=1ms")
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	_, err = gosql.Open(BlackholeDriver, "latency=fast")
+	c.Assert(err, check.ErrorMatches, ".*invalid latency.*")
+
+	_, err = db.Exec("USE test; CREATE TABLE t1 (id INT PRIMARY KEY, a INT NOT NULL, b INT DEFAULT 1, UNIQUE KEY uk_a(a, b))")
+	c.Assert(err, check.IsNil)
+	res, err := db.Exec("INSERT INTO t1 VALUES (?, ?, ?)", 1, 2, 3)
+	c.Assert(err, check.IsNil)
+	affected, err := res.RowsAffected()
+	c.Assert(err, check.IsNil)
+	c.Assert(affected, check.Equals, int64(1))
+	c.Assert(BlackholeStatements(db), check.Equals, int64(2))
+
+	var keys []string
+	rows, err := db.Query("SELECT non_unique, index_name, seq_in_index, column_name FROM information_schema.statistics WHERE table_schema = ? AND table_name = ?", "test", "t1")
+	c.Assert(err, check.IsNil)
+	for rows.Next() {
+		var nonUnique, seq int
+		var index, column string
+		c.Assert(rows.Scan(&nonUnique, &index, &seq, &column), check.IsNil)
+		keys = append(keys, fmt.Sprintf("%s.%d.%s", index, seq, column))
+	}
+	c.Assert(rows.Close(), check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"PRIMARY.1.id", "uk_a.1.a", "uk_a.2.b"})
+
+	_, err = db.Exec("DROP DATABASE test")
+	c.Assert(err, check.IsNil)
+	rows, err = db.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?", "test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(rows.Next(), check.IsFalse)
+	c.Assert(rows.Close(), check.IsNil)
+}
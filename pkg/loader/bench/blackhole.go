@@ -0,0 +1,351 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	// the parser driver must be imported to parse the values
+	_ "github.com/pingcap/tidb/types/parser_driver"
+)
+
+// BlackholeDriver is the name of the database/sql driver which accepts any statement and discards it, so the
+// loader can be benchmarked and profiled independent of the performance of downstream, e.g.,
+//
+//	db, err := sql.Open(bench.BlackholeDriver, "latency=1ms")
+//
+// The optional latency of the dsn is taken by each statement, e.g., to simulate the round trip time. The tables
+// created by CREATE TABLE are remembered, so the queries of the table info by the loader are answered, the other
+// queries return no rows. Each exec affects one row.
+const BlackholeDriver = "blackhole"
+
+func init() {
+	gosql.Register(BlackholeDriver, blackholeDriver{})
+}
+
+// BlackholeStatements returns the number of statements executed by db opened by BlackholeDriver
+func BlackholeStatements(db *gosql.DB) int64 {
+	if c, ok := db.Driver().(*blackholeConnector); ok {
+		return atomic.LoadInt64(&c.execs)
+	}
+	return 0
+}
+
+type blackholeDriver struct{}
+
+func (d blackholeDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector implements driver.DriverContext, the tables are shared by the connections of a db
+func (blackholeDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	values, err := url.ParseQuery(dsn)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid dsn %s", dsn)
+	}
+	c := &blackholeConnector{tables: make(map[string]*blackholeTable)}
+	if latency := values.Get("latency"); len(latency) > 0 {
+		if c.latency, err = time.ParseDuration(latency); err != nil {
+			return nil, errors.Annotatef(err, "invalid latency %s", latency)
+		}
+	}
+	return c, nil
+}
+
+type blackholeConnector struct {
+	latency time.Duration
+	execs   int64
+
+	mu sync.Mutex
+	// keyed by the lower case `schema`.`table`
+	tables map[string]*blackholeTable
+}
+
+// the rows of the table in information_schema.columns and information_schema.statistics
+type blackholeTable struct {
+	columns [][]driver.Value
+	keys    [][]driver.Value
+}
+
+func (c *blackholeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &blackholeConn{connector: c}, nil
+}
+
+func (c *blackholeConnector) Driver() driver.Driver {
+	return c
+}
+
+func (c *blackholeConnector) Open(string) (driver.Conn, error) {
+	return c.Connect(context.Background())
+}
+
+func tableKey(schema string, table string) string {
+	return strings.ToLower(schema + "." + table)
+}
+
+// execDDL remembers the tables created and forgets the ones dropped
+func (c *blackholeConnector) execDDL(currentDB string, query string) (string, error) {
+	stmts, _, err := parser.New().Parse(query, "", "")
+	if err != nil {
+		return currentDB, errors.Trace(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.UseStmt:
+			currentDB = s.DBName
+		case *ast.CreateTableStmt:
+			schema := s.Table.Schema.O
+			if len(schema) == 0 {
+				schema = currentDB
+			}
+			c.tables[tableKey(schema, s.Table.Name.O)] = newBlackholeTable(s)
+		case *ast.DropTableStmt:
+			for _, t := range s.Tables {
+				schema := t.Schema.O
+				if len(schema) == 0 {
+					schema = currentDB
+				}
+				delete(c.tables, tableKey(schema, t.Name.O))
+			}
+		case *ast.DropDatabaseStmt:
+			prefix := strings.ToLower(s.Name + ".")
+			for key := range c.tables {
+				if strings.HasPrefix(key, prefix) {
+					delete(c.tables, key)
+				}
+			}
+		}
+	}
+	return currentDB, nil
+}
+
+func newBlackholeTable(stmt *ast.CreateTableStmt) *blackholeTable {
+	t := new(blackholeTable)
+	notNull := make(map[string]bool)
+	var pk []string
+	var uniques [][]string
+	var names []string
+	for _, col := range stmt.Cols {
+		name := col.Name.Name.O
+		var extra string
+		var defaultValue driver.Value
+		for _, opt := range col.Options {
+			switch opt.Tp {
+			case ast.ColumnOptionPrimaryKey:
+				pk = []string{name}
+				notNull[name] = true
+			case ast.ColumnOptionUniqKey:
+				uniques = append(uniques, []string{name})
+				names = append(names, name)
+			case ast.ColumnOptionNotNull:
+				notNull[name] = true
+			case ast.ColumnOptionDefaultValue:
+				defaultValue = ""
+			case ast.ColumnOptionAutoIncrement:
+				extra = "auto_increment"
+			case ast.ColumnOptionGenerated:
+				extra = "VIRTUAL GENERATED"
+			}
+		}
+		t.columns = append(t.columns, []driver.Value{name, extra, "", defaultValue})
+	}
+	for _, cons := range stmt.Constraints {
+		var cols []string
+		for _, key := range cons.Keys {
+			cols = append(cols, key.Column.Name.O)
+		}
+		switch cons.Tp {
+		case ast.ConstraintPrimaryKey:
+			pk = cols
+			for _, col := range cols {
+				notNull[col] = true
+			}
+		case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+			name := cons.Name
+			if len(name) == 0 {
+				name = cols[0]
+			}
+			uniques = append(uniques, cols)
+			names = append(names, name)
+		}
+	}
+
+	for _, col := range t.columns {
+		col[2] = "YES"
+		if notNull[col[0].(string)] {
+			col[2] = "NO"
+		}
+	}
+	t.addKey("PRIMARY", pk)
+	for i, cols := range uniques {
+		t.addKey(names[i], cols)
+	}
+	return t
+}
+
+func (t *blackholeTable) addKey(name string, cols []string) {
+	for i, col := range cols {
+		t.keys = append(t.keys, []driver.Value{int64(0), name, int64(i + 1), col})
+	}
+}
+
+type blackholeConn struct {
+	connector *blackholeConnector
+	// the database used by USE
+	currentDB string
+}
+
+func (c *blackholeConn) Prepare(query string) (driver.Stmt, error) {
+	return &blackholeStmt{conn: c, query: query}, nil
+}
+
+func (c *blackholeConn) Close() error {
+	return nil
+}
+
+func (c *blackholeConn) Begin() (driver.Tx, error) {
+	c.wait()
+	return c, nil
+}
+
+func (c *blackholeConn) Commit() error {
+	c.wait()
+	return nil
+}
+
+func (c *blackholeConn) Rollback() error {
+	c.wait()
+	return nil
+}
+
+func (c *blackholeConn) wait() {
+	if c.connector.latency > 0 {
+		time.Sleep(c.connector.latency)
+	}
+}
+
+// isDDL returns true if the query may change the tables or the current database
+func isDDL(query string) bool {
+	query = strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(query, "CREATE") || strings.HasPrefix(query, "DROP") || strings.HasPrefix(query, "USE")
+}
+
+func (c *blackholeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.wait()
+	atomic.AddInt64(&c.connector.execs, 1)
+	if len(args) == 0 && isDDL(query) {
+		var err error
+		if c.currentDB, err = c.connector.execDDL(c.currentDB, query); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *blackholeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.wait()
+	rows := &blackholeRows{}
+	isColumns := strings.Contains(query, "information_schema.columns")
+	isKeys := strings.Contains(query, "information_schema.statistics")
+	if !isColumns && !isKeys || len(args) < 2 {
+		return rows, nil
+	}
+
+	schema, _ := args[0].Value.(string)
+	table, _ := args[1].Value.(string)
+	c.connector.mu.Lock()
+	t := c.connector.tables[tableKey(schema, table)]
+	c.connector.mu.Unlock()
+	if isColumns {
+		rows.columns = []string{"column_name", "extra", "is_nullable", "column_default"}
+		if t != nil {
+			rows.values = t.columns
+		}
+	} else {
+		rows.columns = []string{"non_unique", "index_name", "seq_in_index", "column_name"}
+		if t != nil {
+			rows.values = t.keys
+		}
+	}
+	return rows, nil
+}
+
+type blackholeStmt struct {
+	conn  *blackholeConn
+	query string
+}
+
+func (s *blackholeStmt) Close() error {
+	return nil
+}
+
+func (s *blackholeStmt) NumInput() int {
+	return -1
+}
+
+func (s *blackholeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *blackholeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, 0, len(args))
+	for i, arg := range args {
+		named = append(named, driver.NamedValue{Ordinal: i + 1, Value: arg})
+	}
+	return named
+}
+
+type blackholeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *blackholeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *blackholeRows) Close() error {
+	return nil
+}
+
+func (r *blackholeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench benchmarks the loader by the synthetic DML streams. The workload is tuned by the number of tables,
+// the width of the rows, the mix of inserts, updates and deletes and the skew of the keys updated and deleted,
+// the txns are applied by the loader to a target database or the blackhole driver discarding them, and the throughput and the latency
+// percentiles are reported, so the tuning changes of the loader can be evaluated objectively.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+// Config is the workload of a benchmark
+type Config struct {
+	// the schema the tables are created in, it's dropped and created again before the benchmark
+	Schema string
+	Tables int
+	// the columns besides the BIGINT primary key `id`
+	Columns int
+	// the length of the string values
+	ValueSize int
+	// the rows inserted into each table before the benchmark, so there are rows to update and delete
+	InitialRows int
+
+	// the txns applied in the benchmark
+	Txns int
+	// the DMLs of each txn, each DML is of a table picked at random
+	TxnSize int
+
+	// the weights of inserts, updates and deletes
+	InsertWeight int
+	UpdateWeight int
+	DeleteWeight int
+	// the exponent of the zipf distribution the updated and deleted keys follow, which must be greater than 1,
+	// the larger it is, the more the DMLs concentrate on a few hot keys. 0 means uniform.
+	HotKeySkew float64
+
+	Seed int64
+}
+
+// DefaultConfig returns the config of the "mixed" profile
+func DefaultConfig() Config {
+	return Config{
+		Schema:       "loader_bench",
+		Tables:       4,
+		Columns:      8,
+		ValueSize:    32,
+		InitialRows:  10000,
+		Txns:         10000,
+		TxnSize:      10,
+		InsertWeight: 6,
+		UpdateWeight: 3,
+		DeleteWeight: 1,
+		Seed:         1,
+	}
+}
+
+// Profiles are the workloads commonly used, each changes the mix and skew of the default config
+var Profiles = map[string]func(*Config){
+	"mixed": func(*Config) {},
+	"insert": func(cfg *Config) {
+		cfg.InsertWeight, cfg.UpdateWeight, cfg.DeleteWeight = 1, 0, 0
+	},
+	"update": func(cfg *Config) {
+		cfg.InsertWeight, cfg.UpdateWeight, cfg.DeleteWeight = 0, 1, 0
+	},
+	// the updates of a few hot rows, which conflict a lot
+	"hot-update": func(cfg *Config) {
+		cfg.InsertWeight, cfg.UpdateWeight, cfg.DeleteWeight = 0, 1, 0
+		cfg.HotKeySkew = 1.5
+	},
+	// the wide rows of large values
+	"wide": func(cfg *Config) {
+		cfg.Columns = 32
+		cfg.ValueSize = 256
+	},
+}
+
+// ProfileConfig returns the config of the profile name
+func ProfileConfig(name string) (Config, error) {
+	profile, ok := Profiles[name]
+	if !ok {
+		return Config{}, errors.NotFoundf("profile %s", name)
+	}
+	cfg := DefaultConfig()
+	profile(&cfg)
+	return cfg, nil
+}
+
+// Validate checks whether the config is valid
+func (cfg *Config) Validate() error {
+	if len(cfg.Schema) == 0 {
+		return errors.New("schema must be set")
+	}
+	if cfg.Tables <= 0 || cfg.Columns < 0 || cfg.ValueSize <= 0 || cfg.Txns <= 0 || cfg.TxnSize <= 0 || cfg.InitialRows < 0 {
+		return errors.New("tables, value size, txns and txn size must be positive, columns and initial rows must not be negative")
+	}
+	if cfg.InsertWeight < 0 || cfg.UpdateWeight < 0 || cfg.DeleteWeight < 0 || cfg.InsertWeight+cfg.UpdateWeight+cfg.DeleteWeight == 0 {
+		return errors.New("the weights of the DMLs must not be negative, and one of them must be positive")
+	}
+	if cfg.HotKeySkew != 0 && cfg.HotKeySkew <= 1 {
+		return errors.Errorf("hot key skew must be greater than 1 or 0, got %v", cfg.HotKeySkew)
+	}
+	return nil
+}
+
+// Workload generates the txns of the benchmark
+type Workload struct {
+	cfg     Config
+	rand    *rand.Rand
+	tables  []*table
+	columns []string
+}
+
+type table struct {
+	name string
+	// the keys of the rows existing, the ones at the front are the hot keys
+	keys []int64
+	// the version of each row, the values are derived from the key and version,
+	// so the old values of the updates needn't be kept
+	versions map[int64]int
+	nextKey  int64
+	// the zipf distribution over the indexes of keys, it's created again when the number of keys changes
+	zipf  *rand.Zipf
+	zipfN int
+}
+
+// NewWorkload returns the workload of cfg
+func NewWorkload(cfg Config) (*Workload, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	w := &Workload{cfg: cfg, rand: rand.New(rand.NewSource(cfg.Seed)), columns: []string{"id"}}
+	for i := 0; i < cfg.Columns; i++ {
+		w.columns = append(w.columns, fmt.Sprintf("c%d", i))
+	}
+	for i := 0; i < cfg.Tables; i++ {
+		w.tables = append(w.tables, &table{name: fmt.Sprintf("t%d", i), versions: make(map[int64]int)})
+	}
+	return w, nil
+}
+
+// SetupSQLs returns the statements creating the schema and tables of the workload
+func (w *Workload) SetupSQLs() []string {
+	colType := fmt.Sprintf("VARCHAR(%d)", w.cfg.ValueSize)
+	if w.cfg.ValueSize > 1024 {
+		colType = "MEDIUMTEXT"
+	}
+	defs := []string{"`id` BIGINT NOT NULL PRIMARY KEY"}
+	for _, col := range w.columns[1:] {
+		defs = append(defs, fmt.Sprintf("`%s` %s", col, colType))
+	}
+
+	sqls := []string{
+		fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", w.cfg.Schema),
+		fmt.Sprintf("CREATE DATABASE `%s`", w.cfg.Schema),
+	}
+	for _, t := range w.tables {
+		sqls = append(sqls, fmt.Sprintf("CREATE TABLE `%s`.`%s`(%s)", w.cfg.Schema, t.name, strings.Join(defs, ", ")))
+	}
+	return sqls
+}
+
+// InitialTxns returns the txns inserting the initial rows
+func (w *Workload) InitialTxns() []*loader.Txn {
+	var txns []*loader.Txn
+	txn := new(loader.Txn)
+	for _, t := range w.tables {
+		for i := 0; i < w.cfg.InitialRows; i++ {
+			txn.AppendDML(w.insert(t))
+			if len(txn.DMLs) >= w.cfg.TxnSize {
+				txns = append(txns, txn)
+				txn = new(loader.Txn)
+			}
+		}
+	}
+	if len(txn.DMLs) > 0 {
+		txns = append(txns, txn)
+	}
+	return txns
+}
+
+// NextTxn returns the next txn of the benchmark
+func (w *Workload) NextTxn() *loader.Txn {
+	txn := new(loader.Txn)
+	for len(txn.DMLs) < w.cfg.TxnSize {
+		t := w.tables[w.rand.Intn(len(w.tables))]
+		n := w.rand.Intn(w.cfg.InsertWeight + w.cfg.UpdateWeight + w.cfg.DeleteWeight)
+		switch {
+		case n < w.cfg.InsertWeight || len(t.keys) == 0:
+			txn.AppendDML(w.insert(t))
+		case n < w.cfg.InsertWeight+w.cfg.UpdateWeight:
+			txn.AppendDML(w.update(t))
+		default:
+			txn.AppendDML(w.delete(t))
+		}
+	}
+	return txn
+}
+
+func (w *Workload) values(key int64, version int) map[string]interface{} {
+	values := map[string]interface{}{"id": key}
+	for i, col := range w.columns[1:] {
+		value := fmt.Sprintf("%d-%d-%d-", key, version, i)
+		if len(value) < w.cfg.ValueSize {
+			value += strings.Repeat("x", w.cfg.ValueSize-len(value))
+		}
+		values[col] = value[:w.cfg.ValueSize]
+	}
+	return values
+}
+
+func (w *Workload) dml(t *table, tp loader.DMLType) *loader.DML {
+	return &loader.DML{Database: w.cfg.Schema, Table: t.name, Tp: tp}
+}
+
+func (w *Workload) insert(t *table) *loader.DML {
+	key := t.nextKey
+	t.nextKey++
+	t.keys = append(t.keys, key)
+	t.versions[key] = 0
+
+	dml := w.dml(t, loader.InsertDMLType)
+	dml.Values = w.values(key, 0)
+	return dml
+}
+
+// pick returns the index of the key updated or deleted
+func (w *Workload) pick(t *table) int {
+	n := len(t.keys)
+	if w.cfg.HotKeySkew == 0 {
+		return w.rand.Intn(n)
+	}
+	if t.zipf == nil || t.zipfN != n {
+		t.zipf = rand.NewZipf(w.rand, w.cfg.HotKeySkew, 1, uint64(n-1))
+		t.zipfN = n
+	}
+	return int(t.zipf.Uint64())
+}
+
+func (w *Workload) update(t *table) *loader.DML {
+	key := t.keys[w.pick(t)]
+	version := t.versions[key]
+	t.versions[key] = version + 1
+
+	dml := w.dml(t, loader.UpdateDMLType)
+	dml.OldValues = w.values(key, version)
+	dml.Values = w.values(key, version+1)
+	return dml
+}
+
+func (w *Workload) delete(t *table) *loader.DML {
+	i := w.pick(t)
+	key := t.keys[i]
+	// keep the order of the keys so the hot keys stay hot
+	t.keys = append(t.keys[:i], t.keys[i+1:]...)
+	version := t.versions[key]
+	delete(t.versions, key)
+
+	dml := w.dml(t, loader.DeleteDMLType)
+	dml.Values = w.values(key, version)
+	return dml
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	disableChecksSQL = "SET SESSION unique_checks = 0, foreign_key_checks = 0"
+	enableChecksSQL  = "SET SESSION unique_checks = 1, foreign_key_checks = 1"
+)
+
+// BulkImport makes loader apply the batches of only inserts, e.g., the ones replaying a full load into an empty
+// downstream, by multi-row INSERT statements in autocommit mode without merging, on the sessions whose unique_checks
+// and foreign_key_checks are disabled, they're enabled again before the connections are put back to the pool.
+// The rows of a batch aren't applied atomically, so the statements retried are REPLACE as the ones before may have
+// been committed, and so are the ones in safe mode. The batches having any update or delete are applied as usual.
+// It can't be used with Fencing, ProbeCommit or the loopback control, which write in the txns.
+func BulkImport(enable bool) Option {
+	return func(o *options) {
+		o.bulkImport = enable
+	}
+}
+
+// validateBulkImport checks the options writing in the txns are not set with BulkImport
+func validateBulkImport(opts options) error {
+	if !opts.bulkImport {
+		return nil
+	}
+	if opts.fenceLease > 0 || len(opts.probeSchema) > 0 || (opts.loopbackSync != nil && opts.loopbackSync.LoopbackControl) {
+		return errors.New("bulk import can't be used with fencing, commit probe or loopback control")
+	}
+	return nil
+}
+
+// allInserts returns true if all of dmls are inserts
+func allInserts(dmls []*DML) bool {
+	for _, dml := range dmls {
+		if dml.Tp != InsertDMLType {
+			return false
+		}
+	}
+	return true
+}
+
+// bulkImportStatements returns the multi-row INSERT or REPLACE statements of the rows of inserts,
+// one for the rows of each column set, the inserts replacing the tombstones of SoftDeletes are always REPLACE
+func bulkImportStatements(inserts []*DML, replace bool) []Statement {
+	if replace || (len(inserts) > 0 && inserts[0].replacesTombstone()) {
+		return bulkReplaceStatements(inserts)
+	}
+	var stmts []Statement
+	for _, group := range groupByColumns(inserts) {
+		stmts = append(stmts, bulkInsertStatement("INSERT", "INTO", group))
+	}
+	return stmts
+}
+
+// execBulkImport applies the inserts of each table by executor.execBulkImportRetry concurrently.
+// NOTE: DML.info are assumed to be already set.
+func (s *loaderImpl) execBulkImport(dmls []*DML, safeMode bool) error {
+	byTable := make(map[string][]*DML)
+	for _, dml := range dmls {
+		tblName := dml.TableName()
+		byTable[tblName] = append(byTable[tblName], dml)
+	}
+
+	executor := s.getExecutor()
+	errg, _ := errgroup.WithContext(s.ctx)
+	for _, dmls := range byTable {
+		dmls := dmls
+		errg.Go(func() error {
+			err := executor.execBulkImportRetry(s.ctx, dmls, safeMode, maxDMLRetryCount, time.Second)
+			if err != nil {
+				s.tableStatus.onDMLsError(dmls, err)
+			}
+			return err
+		})
+	}
+	return errors.Trace(errg.Wait())
+}
+
+// execBulkImportRetry inserts the rows of dmls, the inserts of the same table, by splits of e.batchSize,
+// the attempts after the first one replace the rows as some of them may have been inserted
+func (e *executor) execBulkImportRetry(ctx context.Context, dmls []*DML, safeMode bool, retryNum int, backoff time.Duration) error {
+	var attempts int
+	err := e.retry(ctx, dmls, retryNum, backoff, func() error {
+		replace := safeMode || attempts > 0
+		attempts++
+		return e.splitExecDML(ctx, dmls, func(split []*DML) error {
+			return e.bulkImport(ctx, split, replace)
+		})
+	})
+	return errors.Trace(err)
+}
+
+// bulkImport executes the statements inserting the rows of inserts in autocommit mode on a connection
+// whose checks are disabled until they're executed
+func (e *executor) bulkImport(ctx context.Context, inserts []*DML, replace bool) error {
+	if len(inserts) == 0 {
+		return nil
+	}
+
+	stmts := bulkImportStatements(inserts, replace)
+	defer releaseStatements(stmts)
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, disableChecksSQL); err != nil {
+		return errors.Annotate(err, "disable the checks of the session")
+	}
+	defer func() {
+		// the connection is reused by the txns after it's put back, which must be checked
+		if _, err := conn.ExecContext(context.Background(), enableChecksSQL); err != nil {
+			e.logger.Error("enable the checks of the session failed", zap.Error(err))
+		}
+	}()
+
+	for _, stmt := range stmts {
+		start := time.Now()
+		if _, err = conn.ExecContext(ctx, stmt.SQL, stmt.Args...); err != nil {
+			return errors.Annotatef(err, "bulk import into %s", inserts[0].TableName())
+		}
+		if e.queryHistogramVec != nil {
+			e.queryHistogramVec.WithLabelValues("exec").Observe(time.Since(start).Seconds())
+		}
+	}
+	return nil
+}
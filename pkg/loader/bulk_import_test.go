@@ -0,0 +1,132 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type bulkImportSuite struct{}
+
+var _ = Suite(&bulkImportSuite{})
+
+func newBulkImportInserts(n int) []*DML {
+	info := &tableInfo{columns: []string{"id", "name"}, uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	dmls := make([]*DML, 0, n)
+	for i := 0; i < n; i++ {
+		dmls = append(dmls, &DML{
+			Database: "db",
+			Table:    "tbl",
+			Tp:       InsertDMLType,
+			Values:   map[string]interface{}{"id": i, "name": "a"},
+			info:     info,
+		})
+	}
+	return dmls
+}
+
+func (s *bulkImportSuite) TestInvalidOptions(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, BulkImport(true), ProbeCommit("tidb_binlog", "drainer-1"))
+	c.Assert(err, ErrorMatches, "bulk import can't be used with.*")
+	_, err = NewLoader(db, BulkImport(true))
+	c.Assert(err, IsNil)
+}
+
+func (s *bulkImportSuite) TestAllInserts(c *C) {
+	dmls := newBulkImportInserts(2)
+	c.Assert(allInserts(dmls), IsTrue)
+	dmls[1].Tp = DeleteDMLType
+	c.Assert(allInserts(dmls), IsFalse)
+}
+
+func (s *bulkImportSuite) TestBulkImport(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withBatchSize(2)
+
+	// the splits are inserted in autocommit mode with the checks disabled
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(regexp.QuoteMeta(disableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `db`.`tbl`(`id`,`name`) VALUES (?,?),(?,?)")).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(regexp.QuoteMeta(enableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	e.workerCount = 1
+	err = e.execBulkImportRetry(context.Background(), newBulkImportInserts(4), false, 3, time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *bulkImportSuite) TestRetryByReplace(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	e := newExecutor(db)
+
+	// the checks are enabled again even if the insert fails
+	mock.ExpectExec(regexp.QuoteMeta(disableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `db`.`tbl`")).WillReturnError(errors.New("timeout"))
+	mock.ExpectExec(regexp.QuoteMeta(enableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	// the rows may have been inserted, so they're replaced by the retry
+	mock.ExpectExec(regexp.QuoteMeta(disableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(enableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = e.execBulkImportRetry(context.Background(), newBulkImportInserts(2), false, 3, time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *bulkImportSuite) TestExecDMLs(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, BulkImport(true), SafeMode(true))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+	inserts := newBulkImportInserts(2)
+	s0.tableInfos.Store(inserts[0].TableName(), inserts[0].info)
+
+	// the inserts are replaced in safe mode
+	mock.ExpectExec(regexp.QuoteMeta(disableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`tbl`(`id`,`name`) VALUES (?,?),(?,?)")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(enableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(s0.execDMLsRetry(inserts, s0.GetSafeMode()), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the batch having a delete is applied in a txn
+	dmls := newBulkImportInserts(1)
+	dmls[0].Tp = DeleteDMLType
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(s0.execDMLsRetry(dmls, s0.GetSafeMode()), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// chunkedExecStatements is singleExecStatements writing the string and []byte values longer than size in
+// chunks, so no statement carries more than about size bytes of a value. The row is written with the
+// first chunk of each large value, then the rest chunks are appended by `UPDATE ... SET col = CONCAT(col, ?)`,
+// all the statements of a DML are executed in the same txn. The DMLs of the row not identified by a
+// unique key excluding the large columns are executed as is.
+// NOTE: the whole value must still fit the max_allowed_packet of MySQL, as it's the limit of CONCAT too.
+func chunkedExecStatements(dmls []*DML, safeMode bool, size int) []Statement {
+	stmts := make([]Statement, 0, len(dmls))
+	for _, dml := range dmls {
+		large := largeColumns(dml, size)
+		// the chunks appended can't be resolved by the conflict policy
+		if len(large) == 0 || dml.resolvesConflict() {
+			stmts = append(stmts, singleExecStatements([]*DML{dml}, safeMode)...)
+			continue
+		}
+		key, ok := dml.chunkKey(large)
+		if !ok {
+			stmts = append(stmts, singleExecStatements([]*DML{dml}, safeMode)...)
+			continue
+		}
+
+		chunks := make(map[string][]interface{}, len(large))
+		for _, name := range large {
+			chunks[name] = splitValue(dml.Values[name], size)
+		}
+
+		// write the row with the first chunks
+		head := *dml
+		head.Values = make(map[string]interface{}, len(dml.Values))
+		for name, v := range dml.Values {
+			head.Values[name] = v
+		}
+		for _, name := range large {
+			head.Values[name] = chunks[name][0]
+		}
+		stmts = append(stmts, singleExecStatements([]*DML{&head}, safeMode)...)
+
+		// append the rest chunks
+		where, whereArgs := keyWhere(key, dml.Values)
+		for _, name := range large {
+			sql := fmt.Sprintf("%s %s SET %s = CONCAT(%s, ?) WHERE %s LIMIT 1",
+				dml.verb("UPDATE"), dml.TableName(), quoteName(name), quoteName(name), where)
+			for _, chunk := range chunks[name][1:] {
+				args := append([]interface{}{chunk}, whereArgs...)
+				stmts = append(stmts, Statement{SQL: sql, Args: args})
+			}
+		}
+	}
+	return stmts
+}
+
+// largeColumns returns the columns of the insert or update whose values are longer than size, sorted by name
+func largeColumns(dml *DML, size int) (names []string) {
+	if size <= 0 || dml.Tp == DeleteDMLType {
+		return nil
+	}
+	for _, name := range dml.info.columns {
+		if n, ok := valueLen(dml.Values[name]); ok && n > size {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// hasLargeValue returns true if any of dmls has a value longer than size
+func hasLargeValue(dmls []*DML, size int) bool {
+	for _, dml := range dmls {
+		if len(largeColumns(dml, size)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkKey returns the columns of the first unique key identifying the new row without the large columns
+func (dml *DML) chunkKey(large []string) (names []string, ok bool) {
+	isLarge := make(map[string]struct{}, len(large))
+	for _, name := range large {
+		isLarge[name] = struct{}{}
+	}
+
+	for _, index := range dml.info.uniqueKeys {
+		usable := true
+		for _, name := range index.columns {
+			_, large := isLarge[name]
+			if large || dml.Values[name] == nil {
+				usable = false
+				break
+			}
+		}
+		if usable {
+			return index.columns, true
+		}
+	}
+	return nil, false
+}
+
+func keyWhere(names []string, values map[string]interface{}) (where string, args []interface{}) {
+	conds := make([]string, 0, len(names))
+	for _, name := range names {
+		conds = append(conds, quoteName(name)+" = ?")
+		args = append(args, values[name])
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func valueLen(v interface{}) (n int, ok bool) {
+	switch v := v.(type) {
+	case string:
+		return len(v), true
+	case []byte:
+		return len(v), true
+	default:
+		return 0, false
+	}
+}
+
+// splitValue splits the string or []byte value into chunks of at most size bytes unless a character is longer,
+// the string is split at the boundaries of the UTF-8 characters so each chunk is a valid string.
+func splitValue(v interface{}, size int) (chunks []interface{}) {
+	switch v := v.(type) {
+	case string:
+		for len(v) > size {
+			end := size
+			for end > 0 && !utf8.RuneStart(v[end]) {
+				end--
+			}
+			// the character is longer than size, take it as a whole
+			if end == 0 {
+				end = size
+				for end < len(v) && !utf8.RuneStart(v[end]) {
+					end++
+				}
+			}
+			chunks = append(chunks, v[:end])
+			v = v[end:]
+		}
+		return append(chunks, v)
+	case []byte:
+		for len(v) > size {
+			chunks = append(chunks, v[:size])
+			v = v[size:]
+		}
+		return append(chunks, v)
+	default:
+		return []interface{}{v}
+	}
+}
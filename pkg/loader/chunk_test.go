@@ -0,0 +1,91 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type chunkSuite struct{}
+
+var _ = Suite(&chunkSuite{})
+
+func chunkTableInfo() *tableInfo {
+	info := &tableInfo{
+		columns:    []string{"id", "data"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	return info
+}
+
+func (s *chunkSuite) TestSplitValue(c *C) {
+	c.Assert(splitValue([]byte("abcde"), 2), DeepEquals, []interface{}{[]byte("ab"), []byte("cd"), []byte("e")})
+	c.Assert(splitValue("abcd", 2), DeepEquals, []interface{}{"ab", "cd"})
+	// "中" is 3 bytes in UTF-8, never split
+	c.Assert(splitValue("a中b", 2), DeepEquals, []interface{}{"a", "中", "b"})
+	c.Assert(splitValue(42, 2), DeepEquals, []interface{}{42})
+}
+
+func (s *chunkSuite) TestChunkedInsert(c *C) {
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"id": 1, "data": []byte("abcde")},
+		info:     chunkTableInfo(),
+	}
+
+	stmts := chunkedExecStatements([]*DML{dml}, false, 2)
+	c.Assert(stmts, DeepEquals, []Statement{
+		{SQL: "INSERT INTO `test`.`t`(`id`,`data`) VALUES(?,?)", Args: []interface{}{1, []byte("ab")}},
+		{SQL: "UPDATE `test`.`t` SET `data` = CONCAT(`data`, ?) WHERE `id` = ? LIMIT 1", Args: []interface{}{[]byte("cd"), 1}},
+		{SQL: "UPDATE `test`.`t` SET `data` = CONCAT(`data`, ?) WHERE `id` = ? LIMIT 1", Args: []interface{}{[]byte("e"), 1}},
+	})
+	// the DML is not changed
+	c.Assert(dml.Values["data"], DeepEquals, []byte("abcde"))
+
+	// the small values are written as is
+	c.Assert(chunkedExecStatements([]*DML{dml}, false, 5), DeepEquals, singleExecStatements([]*DML{dml}, false))
+}
+
+func (s *chunkSuite) TestChunkedUpdateInSafeMode(c *C) {
+	dml := &DML{
+		Database:  "test",
+		Table:     "t",
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": 1, "data": "abc"},
+		OldValues: map[string]interface{}{"id": 1, "data": "a"},
+		info:      chunkTableInfo(),
+	}
+
+	stmts := chunkedExecStatements([]*DML{dml}, true, 2)
+	c.Assert(stmts, DeepEquals, []Statement{
+		{SQL: "DELETE FROM `test`.`t` WHERE `id` = ? LIMIT 1", Args: []interface{}{1}},
+		{SQL: "REPLACE INTO `test`.`t`(`id`,`data`) VALUES(?,?)", Args: []interface{}{1, "ab"}},
+		{SQL: "UPDATE `test`.`t` SET `data` = CONCAT(`data`, ?) WHERE `id` = ? LIMIT 1", Args: []interface{}{"c", 1}},
+	})
+}
+
+func (s *chunkSuite) TestNoChunkWithoutKey(c *C) {
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"id": 1, "data": "abc"},
+		info:     &tableInfo{columns: []string{"id", "data"}},
+	}
+
+	c.Assert(chunkedExecStatements([]*DML{dml}, false, 2), DeepEquals, singleExecStatements([]*DML{dml}, false))
+}
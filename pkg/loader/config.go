@@ -0,0 +1,163 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+// ApplyConfig is the config of how the DMLs are applied shared by the tools loading into mysql/tidb, e.g., drainer
+// and reparo, it's embedded in their downstream configs so they're set by the same keys. The zero value keeps the
+// defaults of Loader.
+type ApplyConfig struct {
+	// in milliseconds, 0 means don't log the slow batches
+	SlowBatchThreshold int `toml:"slow-batch-threshold" json:"slow-batch-threshold"`
+	// check the DMLs against the downstream table schema before executing
+	ValidateDML bool `toml:"validate-dml" json:"validate-dml"`
+	// the values longer than it (in bytes) are written in chunks, 0 means disabled
+	LargeValueChunkSize int `toml:"large-value-chunk-size" json:"large-value-chunk-size"`
+	// the max DMLs of the small txns committed in one downstream txn, 0 means disabled
+	GroupCommitSize int `toml:"group-commit-size" json:"group-commit-size"`
+	// in milliseconds, the max time waiting for more txns to commit together
+	GroupCommitDelay int `toml:"group-commit-delay" json:"group-commit-delay"`
+	// set a savepoint before each txn of a group commit: "retry" or "quarantine", empty means disabled, only for mysql
+	GroupCommitSavepoint string `toml:"group-commit-savepoint" json:"group-commit-savepoint"`
+	// the max consecutive DMLs of the same statement digest sent in one round trip when executed one by one,
+	// e.g., in safe mode, 0 means disabled
+	DigestBatchSize int `toml:"digest-batch-size" json:"digest-batch-size"`
+	// the max bulk statements of a table batch executed concurrently, 0 means unlimited
+	SplitWorkerCount int `toml:"split-worker-count" json:"split-worker-count"`
+	// the max DMLs of the small txns committed before the batch of a large txn, 0 means disabled
+	PriorityTxnSize int `toml:"priority-txn-size" json:"priority-txn-size"`
+	// the optimizer hints or comments added to the DML statements of the tables
+	StatementHints []StatementHint `toml:"statement-hint" json:"statement-hint"`
+	// the apply semantics of the updates and deletes of the tables
+	ApplySemantics []TableSemantics `toml:"apply-semantics" json:"apply-semantics"`
+	// the name of the source written by the source-priority conflict policy, and the conflict policies of the tables
+	// merged from several sources, see ConflictResolution
+	ConflictSource     string          `toml:"conflict-source" json:"conflict-source"`
+	ConflictResolution []TableConflict `toml:"conflict-resolution" json:"conflict-resolution"`
+	// the columns of the downstream tables written by the SQL expressions, see VirtualColumns
+	VirtualColumns []VirtualColumn `toml:"virtual-column" json:"virtual-column"`
+	// record the changes of the tables in their append-only history tables, see HistoryTables
+	HistoryTables []HistoryTable `toml:"history-table" json:"history-table"`
+	// the tables whose deletes are applied as the updates of their tombstone columns, see SoftDeletes
+	SoftDeletes []SoftDelete `toml:"soft-delete" json:"soft-delete"`
+	// the policy of the tables without primary key or unique key: "degrade", "warn" or "refuse"
+	NoKeyTable string `toml:"no-key-table" json:"no-key-table"`
+	// check the updates and deletes executed one by one affect exactly one row, and react to the mismatches by
+	// "alarm" or "safe-mode", empty means disabled
+	AffectedRowsCheck string `toml:"affected-rows-check" json:"affected-rows-check"`
+	// how to handle the DMLs whose columns don't match the downstream table: "error", "ignore-extra" or
+	// "null-missing", empty means not checked
+	OnSchemaMismatch string `toml:"on-schema-mismatch" json:"on-schema-mismatch"`
+	// the isolation level of the txns applying the DMLs: "READ-COMMITTED" or "REPEATABLE-READ", empty means the
+	// default of the sessions, only for mysql
+	IsolationLevel string `toml:"isolation-level" json:"isolation-level"`
+	// the tables only inserted into, written by multi-row INSERT IGNORE
+	AppendOnlyTables []filter.TableName `toml:"append-only-table" json:"append-only-table"`
+	// insert the rows of the batches of only inserts by multi-row INSERT in autocommit mode, with the unique
+	// and foreign key checks of the sessions disabled, e.g., when replaying the full load into an empty downstream
+	BulkImport bool `toml:"bulk-import" json:"bulk-import"`
+	// execute the statements one by one instead of several in one query, e.g., when the downstream doesn't
+	// accept multiStatements, it's also switched to automatically once a multi-statement query is rejected
+	SingleStatements bool `toml:"single-statements" json:"single-statements"`
+	// open the connections, verify the privileges and prepare the statements of the warmup tables in downstream
+	// before applying any txn, see Warmup
+	Warmup       bool               `toml:"warmup" json:"warmup"`
+	WarmupTables []filter.TableName `toml:"warmup-table" json:"warmup-table"`
+}
+
+// Validate checks the sizes and durations are not negative, the policies are checked by NewLoader
+func (c *ApplyConfig) Validate() error {
+	if len(c.WarmupTables) > 0 && !c.Warmup {
+		return errors.New("warmup-table is set but warmup is disabled")
+	}
+	for _, t := range c.WarmupTables {
+		if len(t.Schema) == 0 || len(t.Table) == 0 {
+			return errors.Errorf("invalid warmup-table %s, db-name and tbl-name must be set", quoteSchema(t.Schema, t.Table))
+		}
+	}
+	if c.GroupCommitSize < 0 || c.GroupCommitDelay < 0 {
+		return errors.Errorf("invalid group-commit-size %d or group-commit-delay %d", c.GroupCommitSize, c.GroupCommitDelay)
+	}
+	if c.SlowBatchThreshold < 0 || c.LargeValueChunkSize < 0 || c.DigestBatchSize < 0 || c.SplitWorkerCount < 0 || c.PriorityTxnSize < 0 {
+		return errors.New("slow-batch-threshold, large-value-chunk-size, digest-batch-size, split-worker-count and priority-txn-size can't be negative")
+	}
+	return nil
+}
+
+// Options returns the options of Loader set by the config
+func (c *ApplyConfig) Options() []Option {
+	opts := []Option{ValidateDMLs(c.ValidateDML), AppendOnlyTables(c.AppendOnlyTables...),
+		LargeValueChunkSize(c.LargeValueChunkSize), StatementHints(c.StatementHints...)}
+	if c.SlowBatchThreshold > 0 {
+		opts = append(opts, SlowBatchThreshold(time.Duration(c.SlowBatchThreshold)*time.Millisecond))
+	}
+	if c.DigestBatchSize > 0 {
+		opts = append(opts, DigestBatch(c.DigestBatchSize))
+	}
+	if c.SplitWorkerCount > 0 {
+		opts = append(opts, SplitWorkerCount(c.SplitWorkerCount))
+	}
+	if c.PriorityTxnSize > 0 {
+		opts = append(opts, PriorityLane(c.PriorityTxnSize))
+	}
+	if len(c.AffectedRowsCheck) > 0 {
+		opts = append(opts, VerifyAffectedRows(RowsCheckPolicy(c.AffectedRowsCheck)))
+	}
+	if len(c.IsolationLevel) > 0 {
+		opts = append(opts, Isolation(IsolationLevel(c.IsolationLevel)))
+	}
+	if len(c.OnSchemaMismatch) > 0 {
+		opts = append(opts, OnSchemaMismatch(SchemaMismatchPolicy(c.OnSchemaMismatch)))
+	}
+	if len(c.ApplySemantics) > 0 {
+		opts = append(opts, ApplySemantics(c.ApplySemantics...))
+	}
+	if len(c.ConflictResolution) > 0 {
+		opts = append(opts, ConflictResolution(c.ConflictSource, c.ConflictResolution...))
+	}
+	if len(c.VirtualColumns) > 0 {
+		opts = append(opts, VirtualColumns(c.VirtualColumns...))
+	}
+	if len(c.HistoryTables) > 0 {
+		opts = append(opts, HistoryTables(c.HistoryTables...))
+	}
+	if len(c.SoftDeletes) > 0 {
+		opts = append(opts, SoftDeletes(c.SoftDeletes...))
+	}
+	if len(c.NoKeyTable) > 0 {
+		opts = append(opts, NoKeyTables(NoKeyTablePolicy(c.NoKeyTable)))
+	}
+	if c.GroupCommitSize > 0 {
+		opts = append(opts, GroupCommit(c.GroupCommitSize, time.Duration(c.GroupCommitDelay)*time.Millisecond))
+		if len(c.GroupCommitSavepoint) > 0 {
+			opts = append(opts, GroupCommitSavepoints(SavepointPolicy(c.GroupCommitSavepoint)))
+		}
+	}
+	if c.BulkImport {
+		opts = append(opts, BulkImport(true))
+	}
+	if c.SingleStatements {
+		opts = append(opts, MultiStatements(false))
+	}
+	if c.Warmup {
+		opts = append(opts, Warmup(c.WarmupTables...))
+	}
+	return opts
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type applyConfigSuite struct{}
+
+var _ = Suite(&applyConfigSuite{})
+
+func (s *applyConfigSuite) TestValidate(c *C) {
+	cfg := ApplyConfig{GroupCommitSize: -1}
+	c.Assert(cfg.Validate(), ErrorMatches, "invalid group-commit-size.*")
+	cfg = ApplyConfig{DigestBatchSize: -1}
+	c.Assert(cfg.Validate(), ErrorMatches, ".*can't be negative")
+	cfg = ApplyConfig{}
+	c.Assert(cfg.Validate(), IsNil)
+}
+
+func (s *applyConfigSuite) TestOptions(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	cfg := ApplyConfig{
+		SlowBatchThreshold: 100,
+		GroupCommitSize:    10,
+		GroupCommitDelay:   5,
+		AffectedRowsCheck:  string(RowsCheckAlarm),
+		NoKeyTable:         "invalid",
+	}
+	// the policies are checked by NewLoader
+	_, err = NewLoader(db, cfg.Options()...)
+	c.Assert(err, NotNil)
+
+	cfg.NoKeyTable = ""
+	ld, err := NewLoader(db, cfg.Options()...)
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+	c.Assert(s0.slowBatchThreshold, Equals, 100*time.Millisecond)
+	c.Assert(s0.groupCommitSize, Equals, 10)
+	c.Assert(s0.groupCommitDelay, Equals, 5*time.Millisecond)
+	c.Assert(s0.rowsCheck, NotNil)
+	c.Assert(s0.multiStatements.available(), IsTrue)
+
+	cfg.SingleStatements = true
+	ld, err = NewLoader(db, cfg.Options()...)
+	c.Assert(err, IsNil)
+	c.Assert(ld.(*loaderImpl).multiStatements.available(), IsFalse)
+}
@@ -0,0 +1,287 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ConflictPolicy is how the row written by a DML is resolved against the row of the same key in downstream,
+// which may be written by another source merged into the same downstream
+type ConflictPolicy string
+
+// the conflict policies, all of them compare the rows by Column of TableConflict
+const (
+	// ConflictLastWriterWins keeps the row of the latest commit ts, the commit ts of the txn is written to Column
+	ConflictLastWriterWins ConflictPolicy = "last-writer-wins"
+	// ConflictSourcePriority keeps the row of the source of higher priority, the source of the loader is written
+	// to Column, the rows of the same source are always overwritten
+	ConflictSourcePriority ConflictPolicy = "source-priority"
+	// ConflictColumn keeps the row of the greater value of Column, e.g., a version or the update time of the row
+	ConflictColumn ConflictPolicy = "column"
+)
+
+var sourceNameRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+// TableConflict is the conflict policy of the tables matched, the empty Schema or Table matches any.
+type TableConflict struct {
+	Schema string         `toml:"db-name" json:"db-name"`
+	Table  string         `toml:"tbl-name" json:"tbl-name"`
+	Policy ConflictPolicy `toml:"policy" json:"policy"`
+	// the column the rows are compared by, it must be in the downstream table
+	Column string `toml:"column" json:"column"`
+	// the sources from the lowest priority to the highest, only for ConflictSourcePriority,
+	// the rows of the sources not listed are of the lowest priority
+	Sources []string `toml:"sources" json:"sources"`
+
+	// the source of the loader, see ConflictResolution
+	source string
+}
+
+func (t *TableConflict) validate(source string) error {
+	switch t.Policy {
+	case ConflictLastWriterWins, ConflictColumn:
+	case ConflictSourcePriority:
+		if len(t.Sources) == 0 {
+			return errors.Errorf("the sources of the conflict policy of %s must be set", quoteSchema(t.Schema, t.Table))
+		}
+		// the source may be empty if the txns are tagged by their sources, see MultiSource
+		found := len(source) == 0
+		for _, s := range t.Sources {
+			if !sourceNameRegexp.MatchString(s) {
+				return errors.Errorf("invalid source %q of the conflict policy of %s, only letters, digits, _, . and - are allowed",
+					s, quoteSchema(t.Schema, t.Table))
+			}
+			found = found || s == source
+		}
+		if !found {
+			return errors.Errorf("the source %q of loader isn't in the sources of the conflict policy of %s",
+				source, quoteSchema(t.Schema, t.Table))
+		}
+	default:
+		return errors.Errorf("invalid conflict policy %s of %s, must be %s, %s or %s", t.Policy,
+			quoteSchema(t.Schema, t.Table), ConflictLastWriterWins, ConflictSourcePriority, ConflictColumn)
+	}
+	if len(t.Column) == 0 {
+		return errors.Errorf("the column of the conflict policy of %s must be set", quoteSchema(t.Schema, t.Table))
+	}
+	return nil
+}
+
+// ConflictResolution resolves the rows written to the tables matched against the rows of the same keys in
+// downstream by the policies, for merging several sources into one downstream, where the REPLACE of safe mode
+// would silently overwrite the newer rows written by the others. source names the source of the loader for
+// ConflictSourcePriority, the Source of the txns overrides it, e.g., when they're merged by MultiSource. The most
+// specific one is used for each table, the first one is used if there're more than one.
+//
+// The inserts and updates of the tables are written by INSERT ... ON DUPLICATE KEY UPDATE, which only changes the
+// row in downstream if the row written wins, the deletes only delete the row in downstream if it doesn't win the
+// delete, whether in safe mode or not, so they're idempotent. The tables must have a primary key or unique key,
+// and their DMLs are executed one by one, they're not checked by VerifyAffectedRows and the strict semantics.
+func ConflictResolution(source string, tables ...TableConflict) Option {
+	return func(o *options) {
+		o.conflictSource = source
+		o.conflicts = append(o.conflicts, tables...)
+	}
+}
+
+// conflictOf returns the most specific TableConflict matching the table, nil if none matches
+func conflictOf(conflicts []TableConflict, source string, schema string, table string) *TableConflict {
+	var found *TableConflict
+	best := -1
+	for i := range conflicts {
+		if specificity, ok := matchTable(conflicts[i].Schema, conflicts[i].Table, schema, table); ok && specificity > best {
+			c := conflicts[i]
+			c.source = source
+			found = &c
+			best = specificity
+		}
+	}
+	return found
+}
+
+// checkConflictTable checks the table can be resolved by the conflict policy
+func checkConflictTable(info *tableInfo, schema string, table string) error {
+	if info.conflict == nil {
+		return nil
+	}
+	if len(info.uniqueKeys) == 0 {
+		return errors.Errorf("table %s has no primary key or unique key, the conflicts can't be resolved", quoteSchema(schema, table))
+	}
+	for _, col := range info.columns {
+		if strings.EqualFold(col, info.conflict.Column) {
+			return nil
+		}
+	}
+	return errors.Errorf("the column %s of the conflict policy isn't in table %s", info.conflict.Column, quoteSchema(schema, table))
+}
+
+// checkConflictTS checks the commit ts of dml is set if it's resolved by ConflictLastWriterWins
+func checkConflictTS(dml *DML) error {
+	if dml.info == nil || dml.info.conflict == nil || dml.info.conflict.Policy != ConflictLastWriterWins {
+		return nil
+	}
+	if dml.txn == nil || dml.txn.CommitTS == 0 {
+		return errors.Errorf("the commit ts of the txn of %s must be set to resolve the conflicts by %s",
+			dml.TableName(), ConflictLastWriterWins)
+	}
+	return nil
+}
+
+// resolvesConflict returns true if dml is of a table with ConflictResolution
+func (dml *DML) resolvesConflict() bool {
+	return dml.info != nil && dml.info.conflict != nil
+}
+
+// conflictVersion returns the value of the conflict column written by dml, which is compared with the row in
+// downstream
+func (dml *DML) conflictVersion() interface{} {
+	c := dml.info.conflict
+	switch c.Policy {
+	case ConflictLastWriterWins:
+		if dml.txn == nil {
+			return int64(0)
+		}
+		return dml.txn.CommitTS
+	case ConflictSourcePriority:
+		if dml.txn != nil && len(dml.txn.Source) > 0 {
+			return dml.txn.Source
+		}
+		return c.source
+	}
+	return columnValue(dml.Values, c.Column)
+}
+
+// columnValue returns the value of the column, the names of the columns are case insensitive
+func columnValue(values map[string]interface{}, column string) interface{} {
+	if v, ok := values[column]; ok {
+		return v
+	}
+	for name, v := range values {
+		if strings.EqualFold(name, column) {
+			return v
+		}
+	}
+	return nil
+}
+
+// sourceField returns the expression of the priority of the source expr, 0 if it's not in the sources
+func (c *TableConflict) sourceField(expr string) string {
+	var b strings.Builder
+	b.WriteString("FIELD(")
+	b.WriteString(expr)
+	for _, s := range c.Sources {
+		// the sources are validated to be quoted as they are
+		fmt.Fprintf(&b, ",'%s'", s)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// winsCondition returns the condition of the row inserted winning the row of the same key in downstream,
+// in the ON DUPLICATE KEY UPDATE clause
+func (c *TableConflict) winsCondition() string {
+	column := quoteName(c.Column)
+	if c.Policy == ConflictSourcePriority {
+		return fmt.Sprintf("%s >= %s", c.sourceField("VALUES("+column+")"), c.sourceField(column))
+	}
+	return fmt.Sprintf("%s IS NULL OR VALUES(%s) >= %s", column, column, column)
+}
+
+// deleteCondition returns the condition of the row in downstream being deleted by the version, and its args
+func (c *TableConflict) deleteCondition(version interface{}) (string, []interface{}) {
+	column := quoteName(c.Column)
+	if c.Policy == ConflictSourcePriority {
+		return fmt.Sprintf("%s <= %s", c.sourceField(column), c.sourceField("?")), []interface{}{version}
+	}
+	return fmt.Sprintf("%s IS NULL OR %s <= ?", column, column), []interface{}{version}
+}
+
+// conflictUpsertSQL returns the INSERT ... ON DUPLICATE KEY UPDATE of the new row of dml, which changes the row of
+// the same key in downstream only if the new row wins. The conflict column is assigned at last, as the conditions of
+// the assignments after it would see its new value.
+func (dml *DML) conflictUpsertSQL(version interface{}) (sql string, args []interface{}) {
+	info := dml.info
+	c := info.conflict
+	builder := getBuffer()
+	defer putBuffer(builder)
+
+	fmt.Fprintf(builder, "%s INTO %s(%s%s) VALUES(%s%s) ON DUPLICATE KEY UPDATE ", dml.verb("INSERT"), dml.TableName(),
+		buildColumnList(info.columns), dml.virtualColumnList(), holderString(len(info.columns)), dml.virtualValues())
+	args = getArgs(len(info.columns))
+	cond := c.winsCondition()
+	var last string
+	for _, name := range info.columns {
+		if strings.EqualFold(name, c.Column) {
+			args = append(args, version)
+			last = name
+			continue
+		}
+		args = append(args, dml.Values[name])
+		fmt.Fprintf(builder, "%s = IF(%s, VALUES(%s), %s),", quoteName(name), cond, quoteName(name), quoteName(name))
+	}
+	args = dml.appendVirtualArgs(args)
+	for _, col := range info.virtual {
+		fmt.Fprintf(builder, "%s = IF(%s, VALUES(%s), %s),", quoteName(col.name), cond, quoteName(col.name), quoteName(col.name))
+	}
+	fmt.Fprintf(builder, "%s = IF(%s, VALUES(%s), %s)", quoteName(last), cond, quoteName(last), quoteName(last))
+	sql = builder.String()
+	return
+}
+
+// conflictDeleteSQL returns the DELETE of the row of dml, which only deletes the row in downstream if the version
+// wins it
+func (dml *DML) conflictDeleteSQL(version interface{}) (sql string, args []interface{}) {
+	builder := getBuffer()
+	defer putBuffer(builder)
+
+	builder.WriteString(dml.verb("DELETE"))
+	builder.WriteString(" FROM ")
+	builder.WriteString(dml.TableName())
+	builder.WriteString(" WHERE ")
+	args = dml.buildWhere(builder, getArgs(len(dml.info.columns)+1))
+	cond, condArgs := dml.info.conflict.deleteCondition(version)
+	builder.WriteString(" AND (")
+	builder.WriteString(cond)
+	builder.WriteString(") LIMIT 1")
+	args = append(args, condArgs...)
+
+	sql = builder.String()
+	return
+}
+
+// conflictStatements returns the statements applying dml resolved by its conflict policy, whether in safe mode or not
+func conflictStatements(dml *DML) []Statement {
+	version := dml.conflictVersion()
+	var stmts []Statement
+	switch dml.Tp {
+	case DeleteDMLType:
+		sql, args := dml.conflictDeleteSQL(version)
+		return append(stmts, Statement{SQL: sql, Args: args})
+	case UpdateDMLType:
+		if dml.updateKey() {
+			del, ins := dml.splitKeyUpdate()
+			sql, args := del.conflictDeleteSQL(version)
+			putDML(del)
+			putDML(ins)
+			stmts = append(stmts, Statement{SQL: sql, Args: args})
+		}
+	}
+	sql, args := dml.conflictUpsertSQL(version)
+	return append(stmts, Statement{SQL: sql, Args: args})
+}
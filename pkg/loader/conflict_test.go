@@ -0,0 +1,192 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type conflictSuite struct{}
+
+var _ = Suite(&conflictSuite{})
+
+func newConflictDML(tp DMLType, conflict *TableConflict) *DML {
+	pk := indexInfo{name: "PRIMARY", columns: []string{"id"}}
+	dml := &DML{
+		Database: "db",
+		Table:    "tbl",
+		Tp:       tp,
+		Values:   map[string]interface{}{"id": 1, "name": "b", "version": 2},
+		info: &tableInfo{
+			columns:    []string{"id", "name", "version"},
+			primaryKey: &pk,
+			uniqueKeys: []indexInfo{pk},
+			conflict:   conflict,
+		},
+		txn: &Txn{CommitTS: 42},
+	}
+	if tp == UpdateDMLType {
+		dml.OldValues = map[string]interface{}{"id": 1, "name": "a", "version": 1}
+	}
+	return dml
+}
+
+func (s *conflictSuite) TestInvalidConflict(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, ConflictResolution("", TableConflict{Schema: "db", Policy: "first-writer-wins", Column: "ts"}))
+	c.Assert(err, ErrorMatches, "invalid conflict policy first-writer-wins of `db`.``.*")
+	_, err = NewLoader(db, ConflictResolution("", TableConflict{Schema: "db", Policy: ConflictLastWriterWins}))
+	c.Assert(err, ErrorMatches, "the column of the conflict policy .* must be set")
+	_, err = NewLoader(db, ConflictResolution("dc1", TableConflict{Policy: ConflictSourcePriority, Column: "src"}))
+	c.Assert(err, ErrorMatches, "the sources of the conflict policy .* must be set")
+	_, err = NewLoader(db, ConflictResolution("dc3", TableConflict{Policy: ConflictSourcePriority, Column: "src", Sources: []string{"dc1", "dc2"}}))
+	c.Assert(err, ErrorMatches, `the source "dc3" of loader isn't in the sources.*`)
+	_, err = NewLoader(db, ConflictResolution("dc1", TableConflict{Policy: ConflictSourcePriority, Column: "src", Sources: []string{"dc1", "d'c2"}}))
+	c.Assert(err, ErrorMatches, `invalid source "d'c2".*`)
+	_, err = NewLoader(db, ConflictResolution("dc1",
+		TableConflict{Policy: ConflictSourcePriority, Column: "src", Sources: []string{"dc2", "dc1"}},
+		TableConflict{Schema: "db", Table: "tbl", Policy: ConflictColumn, Column: "version"}))
+	c.Assert(err, IsNil)
+}
+
+func (s *conflictSuite) TestConflictOf(c *C) {
+	conflicts := []TableConflict{
+		{Schema: "db", Policy: ConflictLastWriterWins, Column: "ts"},
+		{Schema: "db", Table: "orders", Policy: ConflictColumn, Column: "version"},
+	}
+	found := conflictOf(conflicts, "dc1", "DB", "orders")
+	c.Assert(found.Policy, Equals, ConflictColumn)
+	c.Assert(found.source, Equals, "dc1")
+	c.Assert(conflictOf(conflicts, "dc1", "db", "users").Policy, Equals, ConflictLastWriterWins)
+	c.Assert(conflictOf(conflicts, "dc1", "other", "orders"), IsNil)
+	// the configs aren't changed
+	c.Assert(conflicts[1].source, Equals, "")
+}
+
+func (s *conflictSuite) TestCheckTable(c *C) {
+	info := newConflictDML(InsertDMLType, &TableConflict{Policy: ConflictColumn, Column: "VERSION"}).info
+	c.Assert(checkConflictTable(info, "db", "tbl"), IsNil)
+
+	info.conflict.Column = "ts"
+	c.Assert(checkConflictTable(info, "db", "tbl"), ErrorMatches, "the column ts of the conflict policy isn't in table `db`.`tbl`")
+
+	info.uniqueKeys = nil
+	c.Assert(checkConflictTable(info, "db", "tbl"), ErrorMatches, ".*has no primary key or unique key.*")
+
+	info.conflict = nil
+	c.Assert(checkConflictTable(info, "db", "tbl"), IsNil)
+}
+
+func (s *conflictSuite) TestCheckTS(c *C) {
+	dml := newConflictDML(InsertDMLType, &TableConflict{Policy: ConflictLastWriterWins, Column: "version"})
+	c.Assert(checkConflictTS(dml), IsNil)
+	dml.txn.CommitTS = 0
+	c.Assert(checkConflictTS(dml), ErrorMatches, "the commit ts of the txn of `db`.`tbl` must be set.*")
+	dml.info.conflict.Policy = ConflictColumn
+	c.Assert(checkConflictTS(dml), IsNil)
+}
+
+func (s *conflictSuite) TestLastWriterWins(c *C) {
+	conflict := &TableConflict{Policy: ConflictLastWriterWins, Column: "version"}
+	cond := "`version` IS NULL OR VALUES(`version`) >= `version`"
+	upsert := "INSERT INTO `db`.`tbl`(`id`,`name`,`version`) VALUES(?,?,?) ON DUPLICATE KEY UPDATE " +
+		"`id` = IF(" + cond + ", VALUES(`id`), `id`)," +
+		"`name` = IF(" + cond + ", VALUES(`name`), `name`)," +
+		"`version` = IF(" + cond + ", VALUES(`version`), `version`)"
+
+	// the commit ts is written instead of the value of the column, whether in safe mode or not
+	for _, safeMode := range []bool{false, true} {
+		stmts := singleExecStatements([]*DML{newConflictDML(UpdateDMLType, conflict)}, safeMode)
+		c.Assert(stmts, HasLen, 1)
+		c.Assert(stmts[0].SQL, Equals, upsert)
+		c.Assert(stmts[0].Args, DeepEquals, []interface{}{1, "b", int64(42)})
+	}
+
+	stmts := singleExecStatements([]*DML{newConflictDML(DeleteDMLType, conflict)}, true)
+	c.Assert(stmts, HasLen, 1)
+	c.Assert(stmts[0].SQL, Equals, "DELETE FROM `db`.`tbl` WHERE `id` = ? AND (`version` IS NULL OR `version` <= ?) LIMIT 1")
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{1, int64(42)})
+
+	// the old row of the update changing the key is deleted if the update wins it
+	dml := newConflictDML(UpdateDMLType, conflict)
+	dml.Values["id"] = 2
+	stmts = singleExecStatements([]*DML{dml}, false)
+	c.Assert(stmts, HasLen, 2)
+	c.Assert(stmts[0].SQL, Equals, "DELETE FROM `db`.`tbl` WHERE `id` = ? AND (`version` IS NULL OR `version` <= ?) LIMIT 1")
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{1, int64(42)})
+	c.Assert(stmts[1].SQL, Equals, upsert)
+	c.Assert(stmts[1].Args, DeepEquals, []interface{}{2, "b", int64(42)})
+}
+
+func (s *conflictSuite) TestSourcePriority(c *C) {
+	conflict := &TableConflict{Policy: ConflictSourcePriority, Column: "version", Sources: []string{"dc2", "dc1"}, source: "dc1"}
+	dml := newConflictDML(InsertDMLType, conflict)
+	dml.info.columns = []string{"version", "id"}
+	stmts := singleExecStatements([]*DML{dml}, false)
+	c.Assert(stmts, HasLen, 1)
+	cond := "FIELD(VALUES(`version`),'dc2','dc1') >= FIELD(`version`,'dc2','dc1')"
+	// the conflict column is assigned at last
+	c.Assert(stmts[0].SQL, Equals, "INSERT INTO `db`.`tbl`(`version`,`id`) VALUES(?,?) ON DUPLICATE KEY UPDATE "+
+		"`id` = IF("+cond+", VALUES(`id`), `id`),`version` = IF("+cond+", VALUES(`version`), `version`)")
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{"dc1", 1})
+
+	stmts = singleExecStatements([]*DML{newConflictDML(DeleteDMLType, conflict)}, false)
+	c.Assert(stmts[0].SQL, Equals, "DELETE FROM `db`.`tbl` WHERE `id` = ? AND "+
+		"(FIELD(`version`,'dc2','dc1') <= FIELD(?,'dc2','dc1')) LIMIT 1")
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{1, "dc1"})
+}
+
+func (s *conflictSuite) TestColumn(c *C) {
+	conflict := &TableConflict{Policy: ConflictColumn, Column: "version"}
+	stmts := singleExecStatements([]*DML{newConflictDML(UpdateDMLType, conflict)}, false)
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{1, "b", 2})
+
+	stmts = singleExecStatements([]*DML{newConflictDML(DeleteDMLType, conflict)}, false)
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{1, 2})
+}
+
+func (s *conflictSuite) TestExec(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, VerifyAffectedRows(RowsCheckSafeMode))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+
+	// the row losing the conflict affects no row, it's not a drift
+	conflict := &TableConflict{Policy: ConflictLastWriterWins, Column: "version"}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `db`.`tbl`(`id`,`name`,`version`) VALUES(?,?,?) ON DUPLICATE KEY UPDATE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl` WHERE `id` = ? AND (")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	dmls := []*DML{newConflictDML(UpdateDMLType, conflict), newConflictDML(DeleteDMLType, conflict)}
+	err = s0.getExecutor().singleExec(dmls, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(ld.TableStatus(), HasLen, 0)
+
+	// the tables resolving the conflicts are not batched
+	s0.merge = true
+	batch, single := s0.groupDMLs(dmls)
+	c.Assert(batch, HasLen, 0)
+	c.Assert(single, HasLen, 2)
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+const (
+	maxReconnectCount = 3
+	connectRetryCount = 5
+)
+
+var connectRetryWait = time.Second
+
+const (
+	// the connections used besides the workers, e.g., by the DDLs and the queries of table info
+	defaultConnHeadroom = 2
+	// shorter than the idle timeout of most proxies and load balancers
+	defaultConnMaxLifetime = 5 * time.Minute
+	defaultPingInterval    = 30 * time.Second
+)
+
+// DBOpener opens a connection to the downstream at addr, the format of addr is "host:port".
+type DBOpener func(addr string) (*gosql.DB, error)
+
+// connSupervisor reopens the downstream connection when it's broken,
+// the addresses are tried in order until one of them is available.
+type connSupervisor struct {
+	open  DBOpener
+	addrs []string
+	// index of the address in use
+	current int
+	// nil means the global logger
+	logger FieldLogger
+}
+
+func newConnSupervisor(open DBOpener, addrs []string) *connSupervisor {
+	return &connSupervisor{
+		open:  open,
+		addrs: addrs,
+	}
+}
+
+// connect tries the address in use first, then the other addresses in order,
+// each address is retried with backoff before switching to the next one.
+func (c *connSupervisor) connect(ctx context.Context) (*gosql.DB, error) {
+	var lastErr error
+	for i := 0; i < len(c.addrs); i++ {
+		idx := (c.current + i) % len(c.addrs)
+		addr := c.addrs[idx]
+
+		var db *gosql.DB
+		err := util.RetryContext(ctx, connectRetryCount, connectRetryWait, 2, func(context.Context) error {
+			var err error
+			db, err = c.open(addr)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err = db.Ping(); err != nil {
+				db.Close()
+				return errors.Trace(err)
+			}
+			return nil
+		})
+		if err == nil {
+			if idx != c.current {
+				defaultLogger(c.logger).Info("switch downstream", zap.String("from", c.addrs[c.current]), zap.String("to", addr))
+			}
+			c.current = idx
+			return db, nil
+		}
+
+		defaultLogger(c.logger).Warn("connect to downstream failed", zap.String("addr", addr), zap.Error(err))
+		lastErr = err
+	}
+
+	return nil, errors.Annotatef(lastErr, "failed to connect to any downstream of %v", c.addrs)
+}
+
+// isConnError returns true if the error means the connection to downstream is broken. Access denied is returned
+// for the new connections of the pool after the password is rotated, reconnecting reads the new password by DBOpener.
+func isConnError(err error) bool {
+	if secret.IsAccessDenied(err) {
+		return true
+	}
+
+	err = errors.Cause(err)
+	switch err {
+	case driver.ErrBadConn, mysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// setupConnPool sizes the connection pool of db by the worker count and sets the lifetime of the connections
+func (s *loaderImpl) setupConnPool(db *gosql.DB) {
+	size := s.workerCount + s.connHeadroom
+	db.SetMaxOpenConns(size)
+	db.SetMaxIdleConns(size)
+	db.SetConnMaxLifetime(s.connMaxLifetime)
+}
+
+// pingDB checks the downstream is available, the broken connection found is discarded by database/sql,
+// and the one in use is reopened by the supervisor in execWithReconnect when a txn is loaded.
+func (s *loaderImpl) pingDB() {
+	ctx, cancel := context.WithTimeout(s.ctx, s.pingInterval)
+	defer cancel()
+	if err := s.getDB().PingContext(ctx); err != nil {
+		s.getLogger().Warn("ping downstream failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"net"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type connSuite struct{}
+
+var _ = check.Suite(&connSuite{})
+
+func (s *connSuite) TestIsConnError(c *check.C) {
+	c.Assert(isConnError(driver.ErrBadConn), check.IsTrue)
+	c.Assert(isConnError(errors.Trace(mysql.ErrInvalidConn)), check.IsTrue)
+	c.Assert(isConnError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}), check.IsTrue)
+	c.Assert(isConnError(errors.New("Duplicate entry")), check.IsFalse)
+	c.Assert(isConnError(&mysql.MySQLError{Number: 1062}), check.IsFalse)
+	c.Assert(isConnError(&mysql.MySQLError{Number: 1045}), check.IsTrue)
+}
+
+func (s *connSuite) TestConnectFailover(c *check.C) {
+	origWait := connectRetryWait
+	connectRetryWait = time.Millisecond
+	defer func() { connectRetryWait = origWait }()
+
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	var opened []string
+	open := func(addr string) (*gosql.DB, error) {
+		opened = append(opened, addr)
+		if addr == "proxy:3306" {
+			return nil, errors.New("proxy is down")
+		}
+		return db, nil
+	}
+
+	supervisor := newConnSupervisor(open, []string{"proxy:3306", "replica:3306"})
+	got, err := supervisor.connect(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.Equals, db)
+	c.Assert(supervisor.current, check.Equals, 1)
+	c.Assert(opened, check.HasLen, connectRetryCount+1)
+
+	// the address in use is tried first
+	opened = opened[:0]
+	_, err = supervisor.connect(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(opened, check.DeepEquals, []string{"replica:3306"})
+}
+
+func (s *connSuite) TestConnectFail(c *check.C) {
+	origWait := connectRetryWait
+	connectRetryWait = time.Millisecond
+	defer func() { connectRetryWait = origWait }()
+
+	open := func(addr string) (*gosql.DB, error) {
+		return nil, errors.New("down")
+	}
+	supervisor := newConnSupervisor(open, []string{"a:3306", "b:3306"})
+	_, err := supervisor.connect(context.Background())
+	c.Assert(err, check.ErrorMatches, ".*failed to connect to any downstream.*")
+	c.Assert(supervisor.current, check.Equals, 0)
+}
+
+func (s *connSuite) TestExecDDLReconnect(c *check.C) {
+	origRetryWait := execDDLRetryWait
+	execDDLRetryWait = time.Millisecond
+	defer func() { execDDLRetryWait = origRetryWait }()
+
+	brokenDB, brokenMock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer brokenDB.Close()
+	for i := 0; i < maxDDLRetryCount; i++ {
+		brokenMock.ExpectBegin().WillReturnError(mysql.ErrInvalidConn)
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	open := func(addr string) (*gosql.DB, error) {
+		return db, nil
+	}
+	loader := &loaderImpl{
+		db:          brokenDB,
+		originDB:    brokenDB,
+		workerCount: 1,
+		supervisor:  newConnSupervisor(open, []string{"replica:3306"}),
+		ctx:         context.Background(),
+	}
+
+	err = loader.execDDL(&DDL{SQL: "CREATE TABLE"})
+	c.Assert(err, check.IsNil)
+	c.Assert(loader.db, check.Equals, db)
+	c.Assert(loader.GetSafeMode(), check.IsFalse)
+
+	// the db opened by supervisor is closed by loader
+	loader.closeDB(loader.getDB())
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(brokenMock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *connSuite) TestExecWithoutSupervisor(c *check.C) {
+	loader := &loaderImpl{}
+	var calls int
+	err := loader.execWithReconnect(func(bool) error {
+		calls++
+		return driver.ErrBadConn
+	})
+	c.Assert(errors.Cause(err), check.Equals, driver.ErrBadConn)
+	c.Assert(calls, check.Equals, 1)
+}
+
+func (s *connSuite) TestReconnectInSafeMode(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mock.ExpectClose()
+	open := func(addr string) (*gosql.DB, error) {
+		return db, nil
+	}
+	loader := &loaderImpl{
+		workerCount: 1,
+		supervisor:  newConnSupervisor(open, []string{"replica:3306"}),
+		ctx:         context.Background(),
+	}
+
+	var safeModes []bool
+	err = loader.execWithReconnect(func(safeMode bool) error {
+		safeModes = append(safeModes, safeMode)
+		if len(safeModes) == 1 {
+			return driver.ErrBadConn
+		}
+		// the safe mode set by others meanwhile, e.g., by reloading the config, is kept
+		loader.SetSafeMode(true)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	// executed again in safe mode without changing the safe mode of loader
+	c.Assert(safeModes, check.DeepEquals, []bool{false, true})
+	c.Assert(loader.GetSafeMode(), check.IsTrue)
+	c.Assert(loader.getDB(), check.Equals, db)
+
+	loader.closeDB(loader.getDB())
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *connSuite) TestConnPool(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, WorkerCount(4))
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 4+defaultConnHeadroom)
+
+	_, err = NewLoader(db, WorkerCount(4), ConnPool(0, time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 4)
+
+	// resized with the worker count
+	ld.SetWorkerCount(8)
+	ld.(*loaderImpl).applyPendingOptions(&batchManager{})
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 8+defaultConnHeadroom)
+}
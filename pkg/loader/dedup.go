@@ -0,0 +1,76 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+)
+
+// dedupWindow remembers the keys of the latest DMLs to skip the ones delivered again,
+// e.g., the txns replayed by an at-least-once upstream after restarting.
+// The key of a DML is (commit ts, table, primary key or unique key or all the values, ordinal),
+// the ordinal distinguishes the DMLs of the same row in one txn.
+type dedupWindow struct {
+	size int
+	keys map[string]struct{}
+	// the keys in the order they are added, order[head] is the oldest one when it's full
+	order []string
+	head  int
+}
+
+func newDedupWindow(size int) *dedupWindow {
+	return &dedupWindow{
+		size:  size,
+		keys:  make(map[string]struct{}, size),
+		order: make([]string, 0, size),
+	}
+}
+
+// filter removes the DMLs in the window from txn and adds the others to the window,
+// it returns the number of DMLs removed. NOTE: DML.info are assumed to be already set.
+func (w *dedupWindow) filter(txn *Txn) (removed int) {
+	if txn.isDDL() || txn.CommitTS == 0 {
+		return 0
+	}
+
+	ordinals := make(map[string]int)
+	dmls := txn.DMLs[:0]
+	for _, dml := range txn.DMLs {
+		_, values := dml.whereSlice()
+		rowKey := fmt.Sprintf("%d/%s/%d/%s", txn.CommitTS, dml.TableName(), dml.Tp, formatKey(values))
+		key := fmt.Sprintf("%s/%d", rowKey, ordinals[rowKey])
+		ordinals[rowKey]++
+
+		if _, ok := w.keys[key]; ok {
+			removed++
+			continue
+		}
+		w.add(key)
+		dmls = append(dmls, dml)
+	}
+	txn.DMLs = dmls
+
+	return removed
+}
+
+func (w *dedupWindow) add(key string) {
+	if len(w.order) < w.size {
+		w.order = append(w.order, key)
+	} else {
+		delete(w.keys, w.order[w.head])
+		w.order[w.head] = key
+		w.head = (w.head + 1) % w.size
+	}
+	w.keys[key] = struct{}{}
+}
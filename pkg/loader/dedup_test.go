@@ -0,0 +1,105 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type dedupSuite struct{}
+
+var _ = check.Suite(&dedupSuite{})
+
+func (s *dedupSuite) TestFilter(c *check.C) {
+	info := &tableInfo{
+		columns:    []string{"id", "v"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+
+	newTxn := func(commitTS int64, ids ...int) *Txn {
+		txn := &Txn{CommitTS: commitTS}
+		for _, id := range ids {
+			txn.AppendDML(&DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": id, "v": 1}, info: info})
+		}
+		return txn
+	}
+
+	w := newDedupWindow(4)
+
+	// the DMLs of the same row in one txn are not duplicated
+	txn := newTxn(1, 1, 1, 2)
+	c.Assert(w.filter(txn), check.Equals, 0)
+	c.Assert(txn.DMLs, check.HasLen, 3)
+
+	// the txn is replayed
+	txn = newTxn(1, 1, 1, 2)
+	c.Assert(w.filter(txn), check.Equals, 3)
+	c.Assert(txn.DMLs, check.HasLen, 0)
+
+	// the same row in another txn
+	txn = newTxn(2, 1, 3)
+	c.Assert(w.filter(txn), check.Equals, 0)
+	c.Assert(txn.DMLs, check.HasLen, 2)
+	c.Assert(txn.DMLs[1].Values["id"], check.Equals, 3)
+
+	// the oldest key is evicted when the window is full
+	c.Assert(w.keys, check.HasLen, 4)
+	c.Assert(w.filter(newTxn(1, 2)), check.Equals, 1)
+	txn = newTxn(1, 1)
+	c.Assert(w.filter(txn), check.Equals, 0)
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	c.Assert(w.keys, check.HasLen, 4)
+
+	// the txns without commit ts are not deduplicated
+	txn = newTxn(0, 1)
+	c.Assert(w.filter(txn), check.Equals, 0)
+	c.Assert(w.filter(newTxn(0, 1)), check.Equals, 0)
+}
+
+func (s *dedupSuite) TestShouldSkipReplayedTxnsInRun(c *check.C) {
+	var executed []*DML
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: 1024,
+			fExecDMLs: func(dmls []*DML) error {
+				executed = append(executed, dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:      make(chan *Txn, 10),
+		successTxn: make(chan *Txn, 10),
+		dedup:      newDedupWindow(16),
+	}
+	info := &tableInfo{columns: []string{"id"}}
+	loader.tableInfos.Store(quoteSchema("test", "t"), info)
+
+	for i := 0; i < 3; i++ {
+		loader.input <- &Txn{CommitTS: 1, DMLs: []*DML{{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1}}}}
+	}
+	loader.input <- &Txn{CommitTS: 2, DMLs: []*DML{{Database: "test", Table: "t", Tp: DeleteDMLType, Values: map[string]interface{}{"id": 1}}}}
+	close(loader.input)
+
+	err := loader.Run()
+	c.Assert(err, check.IsNil)
+	c.Assert(executed, check.HasLen, 2)
+	c.Assert(executed[0].Tp, check.Equals, InsertDMLType)
+	c.Assert(executed[1].Tp, check.Equals, DeleteDMLType)
+}
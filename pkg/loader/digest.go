@@ -0,0 +1,85 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+)
+
+// DigestBatch makes loader send the DMLs executed one by one, e.g., the DMLs in safe mode or of the tables with
+// unique keys, in batches instead of one round trip per statement: up to size consecutive DMLs of a txn sharing the
+// same statement digest, i.e., the same statements except the values, are executed by one multi-statement query
+// with their parameters concatenated, so the order of the statements is kept. The DMLs whose affected rows are
+// checked by VerifyAffectedRows are executed alone. The db must enable interpolateParams, and multiStatements or
+// it's disabled, see MultiStatements.
+// It's disabled if size is 0 or 1.
+func DigestBatch(size int) Option {
+	return func(o *options) {
+		o.digestBatchSize = size
+	}
+}
+
+// digestBatcher merges the statements of the consecutive DMLs with the same digest
+type digestBatcher struct {
+	size int
+
+	digest string
+	count  int
+	sqls   []string
+	args   []interface{}
+}
+
+// statementsDigest returns the digest of the statements of a DML, the values are bound as the parameters,
+// so the SQLs are the same for the DMLs of the same shape
+func statementsDigest(stmts []Statement) string {
+	if len(stmts) == 1 {
+		return stmts[0].SQL
+	}
+	sqls := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		sqls = append(sqls, stmt.SQL)
+	}
+	return strings.Join(sqls, ";")
+}
+
+// add puts the statements of a DML into the batch, the batch is flushed to stmts first if the digest differs or
+// it's full, and the statements are appended to stmts as they are if the batching is disabled
+func (b *digestBatcher) add(stmts []Statement, dmlStmts []Statement) []Statement {
+	if b.size <= 1 || len(dmlStmts) == 0 {
+		return append(stmts, dmlStmts...)
+	}
+
+	digest := statementsDigest(dmlStmts)
+	if b.count > 0 && (digest != b.digest || b.count >= b.size) {
+		stmts = b.flush(stmts)
+	}
+	b.digest = digest
+	b.count++
+	for _, stmt := range dmlStmts {
+		b.sqls = append(b.sqls, stmt.SQL)
+		b.args = append(b.args, stmt.Args...)
+		putArgs(stmt.Args)
+	}
+	return stmts
+}
+
+// flush appends the statements in the batch to stmts as one multi-statement query
+func (b *digestBatcher) flush(stmts []Statement) []Statement {
+	if b.count == 0 {
+		return stmts
+	}
+	stmts = append(stmts, Statement{SQL: strings.Join(b.sqls, ";"), Args: b.args})
+	b.digest, b.count, b.sqls, b.args = "", 0, nil, nil
+	return stmts
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type digestSuite struct{}
+
+var _ = Suite(&digestSuite{})
+
+func (s *digestSuite) TestBatcher(c *C) {
+	b := &digestBatcher{size: 2}
+	del := func(id int) []Statement {
+		return []Statement{{SQL: "DELETE FROM t WHERE id = ?", Args: []interface{}{id}}}
+	}
+	replace := func(id int) []Statement {
+		return []Statement{{SQL: "DELETE FROM t WHERE id = ?", Args: []interface{}{id}}, {SQL: "REPLACE INTO t VALUES(?)", Args: []interface{}{id}}}
+	}
+
+	var stmts []Statement
+	for i := 1; i <= 3; i++ {
+		stmts = b.add(stmts, del(i))
+	}
+	stmts = b.add(stmts, replace(4))
+	stmts = b.add(stmts, replace(5))
+	stmts = b.flush(stmts)
+	c.Assert(stmts, DeepEquals, []Statement{
+		{SQL: "DELETE FROM t WHERE id = ?;DELETE FROM t WHERE id = ?", Args: []interface{}{1, 2}},
+		{SQL: "DELETE FROM t WHERE id = ?", Args: []interface{}{3}},
+		{SQL: "DELETE FROM t WHERE id = ?;REPLACE INTO t VALUES(?);DELETE FROM t WHERE id = ?;REPLACE INTO t VALUES(?)", Args: []interface{}{4, 4, 5, 5}},
+	})
+
+	// disabled
+	b = &digestBatcher{}
+	stmts = b.add(nil, del(1))
+	stmts = b.add(stmts, del(2))
+	c.Assert(b.flush(stmts), DeepEquals, append(del(1), del(2)...))
+}
+
+func (s *digestSuite) TestSingleExec(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, DigestBatch(16))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+
+	// the DMLs in safe mode are executed in one round trip
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`") + ".*;REPLACE INTO.*;DELETE FROM.*;REPLACE INTO.*").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate(), newRowsCheckUpdate()}, true)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the DMLs checked are executed alone
+	ld, err = NewLoader(db, DigestBatch(16), VerifyAffectedRows(RowsCheckAlarm))
+	c.Assert(err, IsNil)
+	s0 = ld.(*loaderImpl)
+	insert := &DML{
+		Database: "db",
+		Table:    "tbl",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"name": "tester", "age": 2019},
+		info:     newRowsCheckUpdate().info,
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`tbl` SET")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `db`.`tbl`") + ".*;INSERT INTO.*").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate(), insert, insert}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// NewInsert returns the DML inserting the row of values into the table, values maps the column names to the values.
+func NewInsert(database string, table string, values map[string]interface{}) *DML {
+	return &DML{Database: database, Table: table, Tp: InsertDMLType, Values: values}
+}
+
+// NewUpdate returns the DML changing the row of oldValues to values, both of them hold all the columns of the row.
+func NewUpdate(database string, table string, oldValues map[string]interface{}, values map[string]interface{}) *DML {
+	return &DML{Database: database, Table: table, Tp: UpdateDMLType, OldValues: oldValues, Values: values}
+}
+
+// NewDelete returns the DML deleting the row of values from the table.
+func NewDelete(database string, table string, values map[string]interface{}) *DML {
+	return &DML{Database: database, Table: table, Tp: DeleteDMLType, Values: values}
+}
+
+func (t DMLType) String() string {
+	switch t {
+	case InsertDMLType:
+		return "insert"
+	case UpdateDMLType:
+		return "update"
+	case DeleteDMLType:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Validate checks the DML is complete: the database, the table and the type are set, Values holds the row,
+// and OldValues is set if and only if it's an update. The DMLs built by NewInsert, NewUpdate and NewDelete
+// are valid if the maps are not empty.
+func (dml *DML) Validate() error {
+	if len(dml.Database) == 0 || len(dml.Table) == 0 {
+		return errors.Errorf("the database and table of the DML must be set, got %s", dml.TableName())
+	}
+	switch dml.Tp {
+	case InsertDMLType, DeleteDMLType:
+		if len(dml.OldValues) > 0 {
+			return errors.Errorf("the old values of the %s DML on %s must be empty", dml.Tp, dml.TableName())
+		}
+	case UpdateDMLType:
+		if len(dml.OldValues) == 0 {
+			return errors.Errorf("the old values of the update DML on %s must be set", dml.TableName())
+		}
+	default:
+		return errors.Errorf("unknown type %d of the DML on %s", dml.Tp, dml.TableName())
+	}
+	if len(dml.Values) == 0 {
+		return errors.Errorf("the values of the %s DML on %s must be set", dml.Tp, dml.TableName())
+	}
+	return nil
+}
+
+// withSchema returns a copy of dml of the table info of schema after checking the columns of the DML are
+// in schema, the DML itself isn't changed so it can still be pushed into the loader.
+func (dml *DML) withSchema(schema *TableSchema) (*DML, error) {
+	if err := dml.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(schema.Columns) == 0 {
+		return nil, errors.Errorf("the columns of %s must be set", dml.TableName())
+	}
+	columns := make(map[string]struct{}, len(schema.Columns))
+	for _, name := range schema.Columns {
+		columns[name] = struct{}{}
+	}
+	for _, values := range []map[string]interface{}{dml.Values, dml.OldValues} {
+		for name := range values {
+			if _, ok := columns[name]; !ok {
+				return nil, errors.Errorf("column %s of the DML isn't in the table %s", name, dml.TableName())
+			}
+		}
+	}
+
+	d := *dml
+	d.info = schema.tableInfo()
+	return &d, nil
+}
+
+// SQL returns the statement applying the DML out of safe mode: INSERT for an insert, UPDATE for an update and
+// DELETE for a delete. The rows are located by the first unique key of schema whose values are not NULL, or by
+// all the columns if there's no such key.
+func (dml *DML) SQL(schema *TableSchema) (Statement, error) {
+	d, err := dml.withSchema(schema)
+	if err != nil {
+		return Statement{}, errors.Trace(err)
+	}
+	sql, args := d.sql()
+	return Statement{SQL: sql, Args: args}, nil
+}
+
+// ReplaceSQL returns the REPLACE statement writing the new row of an insert or update, which is what the loader
+// executes for them in safe mode after deleting the old row of an update by DeleteSQL.
+func (dml *DML) ReplaceSQL(schema *TableSchema) (Statement, error) {
+	d, err := dml.withSchema(schema)
+	if err != nil {
+		return Statement{}, errors.Trace(err)
+	}
+	if d.Tp == DeleteDMLType {
+		return Statement{}, errors.Errorf("can't replace by the delete DML on %s", dml.TableName())
+	}
+	sql, args := d.replaceSQL()
+	return Statement{SQL: sql, Args: args}, nil
+}
+
+// DeleteSQL returns the DELETE statement of the row of a delete, or the old row of an update.
+func (dml *DML) DeleteSQL(schema *TableSchema) (Statement, error) {
+	d, err := dml.withSchema(schema)
+	if err != nil {
+		return Statement{}, errors.Trace(err)
+	}
+	if d.Tp == InsertDMLType {
+		return Statement{}, errors.Errorf("can't delete by the insert DML on %s", dml.TableName())
+	}
+	sql, args := d.deleteSQL()
+	return Statement{SQL: sql, Args: args}, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type publicDMLSuite struct{}
+
+var _ = Suite(&publicDMLSuite{})
+
+func (s *publicDMLSuite) TestValidate(c *C) {
+	row := map[string]interface{}{"id": 1}
+	c.Assert(NewInsert("db", "tbl", row).Validate(), IsNil)
+	c.Assert(NewUpdate("db", "tbl", row, row).Validate(), IsNil)
+	c.Assert(NewDelete("db", "tbl", row).Validate(), IsNil)
+
+	c.Assert(NewInsert("", "tbl", row).Validate(), ErrorMatches, ".*database and table.*")
+	c.Assert(NewInsert("db", "tbl", nil).Validate(), ErrorMatches, ".*values of the insert DML.*")
+	c.Assert(NewUpdate("db", "tbl", nil, row).Validate(), ErrorMatches, ".*old values of the update DML.*must be set.*")
+	c.Assert((&DML{Database: "db", Table: "tbl", Tp: DeleteDMLType, Values: row, OldValues: row}).Validate(),
+		ErrorMatches, ".*old values of the delete DML.*must be empty.*")
+	c.Assert((&DML{Database: "db", Table: "tbl", Values: row}).Validate(), ErrorMatches, ".*unknown type 0.*")
+}
+
+func (s *publicDMLSuite) TestSQL(c *C) {
+	schema := &TableSchema{Columns: []string{"id", "name"}, PrimaryKey: []string{"id"}}
+	oldRow := map[string]interface{}{"id": 1, "name": "a"}
+	row := map[string]interface{}{"id": 1, "name": "b"}
+
+	stmt, err := NewInsert("db", "tbl", row).SQL(schema)
+	c.Assert(err, IsNil)
+	c.Assert(stmt.SQL, Equals, "INSERT INTO `db`.`tbl`(`id`,`name`) VALUES(?,?)")
+	c.Assert(stmt.Args, DeepEquals, []interface{}{1, "b"})
+
+	update := NewUpdate("db", "tbl", oldRow, row)
+	stmt, err = update.SQL(schema)
+	c.Assert(err, IsNil)
+	c.Assert(stmt.SQL, Equals, "UPDATE `db`.`tbl` SET `id` = ?,`name` = ? WHERE `id` = ? LIMIT 1")
+	c.Assert(stmt.Args, DeepEquals, []interface{}{1, "b", 1})
+
+	// the statements of safe mode
+	stmt, err = update.DeleteSQL(schema)
+	c.Assert(err, IsNil)
+	c.Assert(stmt.SQL, Equals, "DELETE FROM `db`.`tbl` WHERE `id` = ? LIMIT 1")
+	c.Assert(stmt.Args, DeepEquals, []interface{}{1})
+	stmt, err = update.ReplaceSQL(schema)
+	c.Assert(err, IsNil)
+	c.Assert(stmt.SQL, Equals, "REPLACE INTO `db`.`tbl`(`id`,`name`) VALUES(?,?)")
+	c.Assert(stmt.Args, DeepEquals, []interface{}{1, "b"})
+	// the DML isn't bound to the schema
+	c.Assert(update.info, IsNil)
+
+	// the rows of the table without key are located by all the columns
+	stmt, err = NewDelete("db", "tbl", oldRow).SQL(&TableSchema{Columns: []string{"id", "name"}})
+	c.Assert(err, IsNil)
+	c.Assert(stmt.SQL, Equals, "DELETE FROM `db`.`tbl` WHERE `id` = ? AND `name` = ? LIMIT 1")
+	c.Assert(stmt.Args, DeepEquals, []interface{}{1, "a"})
+}
+
+func (s *publicDMLSuite) TestSQLInvalid(c *C) {
+	schema := &TableSchema{Columns: []string{"id"}, PrimaryKey: []string{"id"}}
+	row := map[string]interface{}{"id": 1}
+
+	_, err := NewInsert("db", "tbl", map[string]interface{}{"id": 1, "age": 2}).SQL(schema)
+	c.Assert(err, ErrorMatches, ".*column age of the DML isn't in the table.*")
+	_, err = NewInsert("db", "tbl", row).SQL(&TableSchema{})
+	c.Assert(err, ErrorMatches, ".*columns of `db`.`tbl` must be set.*")
+	_, err = NewInsert("db", "tbl", nil).SQL(schema)
+	c.Assert(err, ErrorMatches, ".*values of the insert DML.*")
+	_, err = NewDelete("db", "tbl", row).ReplaceSQL(schema)
+	c.Assert(err, ErrorMatches, ".*can't replace by the delete DML.*")
+	_, err = NewInsert("db", "tbl", row).DeleteSQL(schema)
+	c.Assert(err, ErrorMatches, ".*can't delete by the insert DML.*")
+}
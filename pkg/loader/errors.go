@@ -0,0 +1,135 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+// The typed errors returned by Run, they may be wrapped by errors.Trace or errors.Annotate, so they're found by
+// AsDownstreamDuplicate, AsSchemaMismatch and AsRetryExhausted, and errors.Cause of them is the error of downstream.
+
+// ErrDownstreamDuplicate is the error of a statement violating a unique key in downstream, e.g., the row has been
+// written to downstream by others.
+type ErrDownstreamDuplicate struct {
+	// the table of the txn, `db`.`table`
+	Table string
+	// the digest of the statement failed, the same as the one of TiDB
+	Digest string
+	// the commit ts of the first txn executed in the txn of downstream, 0 if it's unknown
+	CommitTS int64
+	Err      error
+}
+
+func (e *ErrDownstreamDuplicate) Error() string {
+	return fmt.Sprintf("duplicate entry in downstream, table %s, commit ts %d, digest %s: %v", e.Table, e.CommitTS, e.Digest, e.Err)
+}
+
+// Cause implements the causer of errors.Cause
+func (e *ErrDownstreamDuplicate) Cause() error {
+	return e.Err
+}
+
+// ErrSchemaMismatch is the error of a DML whose columns don't match its table in downstream, see OnSchemaMismatch.
+type ErrSchemaMismatch struct {
+	// the table of the DML, `db`.`table`
+	Table    string
+	CommitTS int64
+	// the columns of the DML downstream lacks, and the columns of downstream the DML lacks
+	Extra   []string
+	Missing []string
+}
+
+func (e *ErrSchemaMismatch) Error() string {
+	if len(e.Extra) > 0 {
+		return fmt.Sprintf("schema mismatch: columns %s don't exist in downstream", strings.Join(e.Extra, ", "))
+	}
+	return fmt.Sprintf("schema mismatch: columns %s of downstream are missing", strings.Join(e.Missing, ", "))
+}
+
+// ErrRetryExhausted is the error of the DMLs still failing after all the retries.
+type ErrRetryExhausted struct {
+	// the table and the digest of the statement of the first DML failed, `db`.`table`
+	Table  string
+	Digest string
+	// the commit ts of the txn of the first DML failed, 0 if it's unknown
+	CommitTS int64
+	Retries  int
+	// the error of the last attempt
+	Err error
+}
+
+func (e *ErrRetryExhausted) Error() string {
+	return fmt.Sprintf("retry %d times exhausted, table %s, commit ts %d, digest %s: %v", e.Retries, e.Table, e.CommitTS, e.Digest, e.Err)
+}
+
+// Cause implements the causer of errors.Cause
+func (e *ErrRetryExhausted) Cause() error {
+	return e.Err
+}
+
+// AsDownstreamDuplicate returns the ErrDownstreamDuplicate wrapped by err, false if there's none
+func AsDownstreamDuplicate(err error) (*ErrDownstreamDuplicate, bool) {
+	found, ok := errors.Find(err, func(err error) bool {
+		_, ok := err.(*ErrDownstreamDuplicate)
+		return ok
+	}).(*ErrDownstreamDuplicate)
+	return found, ok
+}
+
+// AsSchemaMismatch returns the ErrSchemaMismatch wrapped by err, false if there's none
+func AsSchemaMismatch(err error) (*ErrSchemaMismatch, bool) {
+	found, ok := errors.Find(err, func(err error) bool {
+		_, ok := err.(*ErrSchemaMismatch)
+		return ok
+	}).(*ErrSchemaMismatch)
+	return found, ok
+}
+
+// AsRetryExhausted returns the ErrRetryExhausted wrapped by err, false if there's none
+func AsRetryExhausted(err error) (*ErrRetryExhausted, bool) {
+	found, ok := errors.Find(err, func(err error) bool {
+		_, ok := err.(*ErrRetryExhausted)
+		return ok
+	}).(*ErrRetryExhausted)
+	return found, ok
+}
+
+func isDupEntryError(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && mysqlErr.Number == tmysql.ErrDupEntry
+}
+
+// newRetryExhausted returns the ErrRetryExhausted of the DMLs failed by err after the retries
+func newRetryExhausted(dmls []*DML, retries int, err error) error {
+	exhausted := &ErrRetryExhausted{Retries: retries, Err: err}
+	if len(dmls) > 0 {
+		dml := dmls[0]
+		exhausted.Table = dml.TableName()
+		if dml.info != nil {
+			sql, _ := dml.sql()
+			exhausted.Digest = parser.DigestHash(sql)
+		}
+		if dml.txn != nil {
+			exhausted.CommitTS = dml.txn.CommitTS
+		}
+	}
+	return exhausted
+}
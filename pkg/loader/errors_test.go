@@ -0,0 +1,108 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+type errorsSuite struct{}
+
+var _ = check.Suite(&errorsSuite{})
+
+func (s *errorsSuite) dml() *DML {
+	return &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"id": 1},
+		info:     &tableInfo{columns: []string{"id"}},
+		txn:      &Txn{CommitTS: 42},
+	}
+}
+
+func (s *errorsSuite) TestDownstreamDuplicate(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	dupErr := &mysql.MySQLError{Number: tmysql.ErrDupEntry, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnError(dupErr)
+	mock.ExpectRollback()
+
+	dml := s.dml()
+	sql, args := dml.sql()
+	err = newExecutor(db).execStatements([]*DML{dml}, []Statement{{SQL: sql, Args: args}})
+	c.Assert(errors.Cause(err), check.Equals, dupErr)
+
+	dup, ok := AsDownstreamDuplicate(errors.Annotate(err, "exec failed"))
+	c.Assert(ok, check.IsTrue)
+	c.Assert(dup.Table, check.Equals, "`test`.`t`")
+	c.Assert(dup.CommitTS, check.Equals, int64(42))
+	c.Assert(dup.Digest, check.Equals, parser.DigestHash(sql))
+	_, ok = AsRetryExhausted(err)
+	c.Assert(ok, check.IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *errorsSuite) TestRetryExhausted(c *check.C) {
+	fake := errors.New("fake")
+	dml := s.dml()
+	err := newExecutor(nil).retry(context.Background(), []*DML{dml}, 2, time.Millisecond, func() error {
+		return errors.Trace(fake)
+	})
+	c.Assert(errors.Cause(err), check.Equals, fake)
+
+	exhausted, ok := AsRetryExhausted(errors.Trace(err))
+	c.Assert(ok, check.IsTrue)
+	c.Assert(exhausted.Retries, check.Equals, 2)
+	c.Assert(exhausted.Table, check.Equals, "`test`.`t`")
+	c.Assert(exhausted.CommitTS, check.Equals, int64(42))
+	sql, _ := dml.sql()
+	c.Assert(exhausted.Digest, check.Equals, parser.DigestHash(sql))
+
+	// not exhausted if it's cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = newExecutor(nil).retry(ctx, []*DML{dml}, 2, time.Second, func() error {
+		return fake
+	})
+	_, ok = AsRetryExhausted(err)
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s *errorsSuite) TestSchemaMismatch(c *check.C) {
+	dml := s.dml()
+	dml.Values["name"] = "a"
+	err := checkColumns(dml, SchemaMismatchError)
+	c.Assert(err, check.ErrorMatches, "schema mismatch: columns name don't exist in downstream")
+
+	mismatch, ok := AsSchemaMismatch(errors.Annotate(err, "check schema failed"))
+	c.Assert(ok, check.IsTrue)
+	c.Assert(mismatch.Table, check.Equals, "`test`.`t`")
+	c.Assert(mismatch.Extra, check.DeepEquals, []string{"name"})
+	c.Assert(mismatch.Missing, check.HasLen, 0)
+
+	_, ok = AsSchemaMismatch(errors.New("fake"))
+	c.Assert(ok, check.IsFalse)
+}
@@ -22,8 +22,8 @@ func Example() {
 		log.Fatal(err)
 	}
 
-	// init loader
-	loader, err := NewLoader(db, WorkerCount(16), BatchSize(128))
+	// init loader, start in safe mode if the txns may have been loaded partially before
+	loader, err := NewLoader(db, WorkerCount(16), BatchSize(128), SafeMode(true))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -52,22 +52,22 @@ func Example() {
 	// push one insert dml txn
 	values := map[string]interface{}{"id": 1}
 	loader.Input() <- &Txn{
-		DMLs: []*DML{{Database: "test", Table: "test", Tp: InsertDMLType, Values: values}},
+		DMLs: []*DML{NewInsert("test", "test", values)},
 	}
 
 	// push one update dml txn
 	newValues := map[string]interface{}{"id": 2}
 	loader.Input() <- &Txn{
-		DMLs: []*DML{{Database: "test", Table: "test", Tp: UpdateDMLType, Values: newValues, OldValues: values}},
+		DMLs: []*DML{NewUpdate("test", "test", values, newValues)},
 	}
 
 	// you can set safe mode or not at run time
 	// which use replace for insert event and delete + replace for update make it be idempotent
-	loader.SetSafeMode(true)
+	loader.SetSafeMode(false)
 
 	// push one delete dml txn
 	loader.Input() <- &Txn{
-		DMLs: []*DML{{Database: "test", Table: "test", Tp: DeleteDMLType, Values: newValues}},
+		DMLs: []*DML{NewDelete("test", "test", newValues)},
 	}
 	//...
 
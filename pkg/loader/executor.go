@@ -16,13 +16,15 @@ package loader
 import (
 	"context"
 	gosql "database/sql"
-	"fmt"
-	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
 	"github.com/pingcap/log"
-	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/parser"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -34,12 +36,38 @@ type executor struct {
 	db                *gosql.DB
 	batchSize         int
 	queryHistogramVec *prometheus.HistogramVec
+	// count of the deadlock, lock wait timeout and write conflict errors
+	conflictCounterVec *prometheus.CounterVec
+	// log the batch taking longer than this, 0 means disabled
+	slowBatchThreshold time.Duration
+	logger             FieldLogger
+	// retry the write conflicts and region errors of TiDB sooner
+	tidbMode bool
+	// the values longer than it are written in chunks by singleExec, 0 means disabled
+	chunkSize int
+	// returns the statement marking each txn before committing, nil means disabled
+	markTxn func() Statement
+	// checks the affected rows of the DMLs executed by singleExec, nil means disabled
+	rowsCheck *rowsCheck
+	// checks the fence at the beginning of each txn, nil means disabled
+	fence *fence
+	// probes the txns failing to commit ambiguously, nil means disabled
+	probe *commitProbe
+	// the max DMLs of the same digest executed together by singleExec, 0 or 1 means disabled
+	digestBatchSize int
+	// nil means the multi-statement queries are available, see MultiStatements
+	multiStatements *multiStatements
+	// the max splits executed concurrently by splitExecDML, 0 means unlimited
+	workerCount int
+	// the isolation level of the txns, the default of the sessions if it's gosql.LevelDefault
+	isolation gosql.IsolationLevel
 }
 
 func newExecutor(db *gosql.DB) *executor {
 	exe := &executor{
 		db:        db,
 		batchSize: defaultBatchSize,
+		logger:    log.L(),
 	}
 
 	return exe
@@ -55,8 +83,73 @@ func (e *executor) withQueryHistogramVec(queryHistogramVec *prometheus.Histogram
 	return e
 }
 
+func (e *executor) withConflictCounterVec(conflictCounterVec *prometheus.CounterVec) *executor {
+	e.conflictCounterVec = conflictCounterVec
+	return e
+}
+
+func (e *executor) withLogger(logger FieldLogger) *executor {
+	e.logger = logger
+	return e
+}
+
+func (e *executor) withTiDBMode(tidbMode bool) *executor {
+	e.tidbMode = tidbMode
+	return e
+}
+
+func (e *executor) withChunkSize(size int) *executor {
+	e.chunkSize = size
+	return e
+}
+
+func (e *executor) withMarkTxn(markTxn func() Statement) *executor {
+	e.markTxn = markTxn
+	return e
+}
+
+func (e *executor) withRowsCheck(check *rowsCheck) *executor {
+	e.rowsCheck = check
+	return e
+}
+
+func (e *executor) withDigestBatchSize(size int) *executor {
+	e.digestBatchSize = size
+	return e
+}
+
+func (e *executor) withMultiStatements(m *multiStatements) *executor {
+	e.multiStatements = m
+	return e
+}
+
+func (e *executor) withWorkerCount(n int) *executor {
+	e.workerCount = n
+	return e
+}
+
+func (e *executor) withFence(f *fence) *executor {
+	e.fence = f
+	return e
+}
+
+func (e *executor) withIsolation(level gosql.IsolationLevel) *executor {
+	e.isolation = level
+	return e
+}
+
+func (e *executor) withProbe(p *commitProbe) *executor {
+	e.probe = p
+	return e
+}
+
+func (e *executor) withSlowBatchThreshold(threshold time.Duration) *executor {
+	e.slowBatchThreshold = threshold
+	return e
+}
+
 func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNum int, backoff time.Duration) error {
-	err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
+	err := e.retry(ctx, dmls, retryNum, backoff, func() error {
 		return e.execTableBatch(ctx, dmls)
 	})
 	return errors.Trace(err)
@@ -65,7 +158,19 @@ func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNu
 // a wrap of *sql.Tx with metrics
 type tx struct {
 	*gosql.Tx
-	queryHistogramVec *prometheus.HistogramVec
+	queryHistogramVec  *prometheus.HistogramVec
+	conflictCounterVec *prometheus.CounterVec
+	slowBatchThreshold time.Duration
+	logger             FieldLogger
+
+	start time.Time
+	// the first query executed, used to identify the slow batch
+	query     string
+	batchSize int
+	schema    string
+	table     string
+	// the commit ts of the txn of the first DML, 0 if it's unknown
+	commitTS int64
 }
 
 // wrap of sql.Tx.Exec()
@@ -75,16 +180,63 @@ func (tx *tx) exec(query string, args ...interface{}) (gosql.Result, error) {
 	if tx.queryHistogramVec != nil {
 		tx.queryHistogramVec.WithLabelValues("exec").Observe(time.Since(start).Seconds())
 	}
+	if len(tx.query) == 0 {
+		tx.query = query
+	}
+	tx.countConflict(err)
 
 	return res, err
 }
 
+// countConflict counts the deadlock, lock wait timeout and write conflict errors returned by downstream
+func (tx *tx) countConflict(err error) {
+	tp := conflictType(err)
+	if len(tp) == 0 {
+		return
+	}
+	tx.logger.Warn("meet conflict in downstream", zap.String("type", tp), zap.String("table", quoteSchema(tx.schema, tx.table)), zap.Error(err))
+	if tx.conflictCounterVec != nil {
+		tx.conflictCounterVec.WithLabelValues(tp).Inc()
+	}
+}
+
+func conflictType(err error) string {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	if !ok {
+		return ""
+	}
+
+	switch mysqlErr.Number {
+	case tmysql.ErrLockDeadlock:
+		return "deadlock"
+	case tmysql.ErrLockWaitTimeout:
+		return "lock_wait_timeout"
+	case tmysql.ErrWriteConflict, tmysql.ErrWriteConflictInTiDB:
+		return "write_conflict"
+	default:
+		return ""
+	}
+}
+
+// connectionID returns the thread id of the connection in downstream, 0 if failed to get it
+func (tx *tx) connectionID() int64 {
+	var id int64
+	if err := tx.QueryRow("SELECT CONNECTION_ID()").Scan(&id); err != nil {
+		tx.logger.Warn("get connection id failed", zap.Error(err))
+		return 0
+	}
+	return id
+}
+
 func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Result, err error) {
 	res, err = tx.exec(query, args...)
 	if err != nil {
-		log.Error("Exec fail, will rollback", zap.String("query", query), zap.Reflect("args", args), zap.Error(err))
+		tx.logger.Error("Exec fail, will rollback", zap.String("table", quoteSchema(tx.schema, tx.table)), zap.String("query", query), zap.Reflect("args", mask.Args(tx.schema, tx.table, args)), zap.Error(err))
 		if rbErr := tx.Rollback(); rbErr != nil {
-			log.Error("Auto rollback", zap.Error(rbErr))
+			tx.logger.Error("Auto rollback", zap.Error(rbErr))
+		}
+		if isDupEntryError(err) {
+			err = &ErrDownstreamDuplicate{Table: quoteSchema(tx.schema, tx.table), Digest: parser.DigestHash(query), CommitTS: tx.commitTS, Err: err}
 		}
 		err = errors.Trace(err)
 	}
@@ -93,26 +245,73 @@ func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Res
 
 // wrap of sql.Tx.Commit()
 func (tx *tx) commit() error {
+	// the connection is released after commit, so get the thread id before it
+	var threadID int64
+	isSlow := tx.slowBatchThreshold > 0 && time.Since(tx.start) > tx.slowBatchThreshold
+	if isSlow {
+		threadID = tx.connectionID()
+	}
+
 	start := time.Now()
 	err := tx.Tx.Commit()
 	if tx.queryHistogramVec != nil {
 		tx.queryHistogramVec.WithLabelValues("commit").Observe(time.Since(start).Seconds())
 	}
+	tx.countConflict(err)
+
+	if cost := time.Since(tx.start); tx.slowBatchThreshold > 0 && cost > tx.slowBatchThreshold {
+		tx.logger.Warn("slow batch",
+			zap.String("table", quoteSchema(tx.schema, tx.table)),
+			zap.Int("batch size", tx.batchSize),
+			zap.String("digest", parser.DigestHash(tx.query)),
+			zap.Int64("thread id", threadID),
+			zap.Duration("cost", cost),
+			zap.Error(err))
+	}
 
 	return errors.Trace(err)
 }
 
-// return a wrap of sql.Tx
-func (e *executor) begin() (*tx, error) {
-	sqlTx, err := e.db.Begin()
+// return a wrap of sql.Tx, dmls are the DMLs to be executed in the txn
+func (e *executor) begin(dmls []*DML) (*tx, error) {
+	start := time.Now()
+	var sqlTx *gosql.Tx
+	var err error
+	if e.isolation != gosql.LevelDefault {
+		sqlTx, err = e.db.BeginTx(context.Background(), &gosql.TxOptions{Isolation: e.isolation})
+	} else {
+		sqlTx, err = e.db.Begin()
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	return &tx{
-		Tx:                sqlTx,
-		queryHistogramVec: e.queryHistogramVec,
-	}, nil
+	tx := &tx{
+		Tx:                 sqlTx,
+		queryHistogramVec:  e.queryHistogramVec,
+		conflictCounterVec: e.conflictCounterVec,
+		slowBatchThreshold: e.slowBatchThreshold,
+		logger:             e.logger,
+		start:              start,
+		batchSize:          len(dmls),
+	}
+	if len(dmls) > 0 {
+		tx.schema, tx.table = dmls[0].Database, dmls[0].Table
+		if dmls[0].txn != nil {
+			tx.commitTS = dmls[0].txn.CommitTS
+		}
+	}
+
+	if e.fence != nil {
+		if err = e.fence.check(sqlTx); err != nil {
+			if rbErr := sqlTx.Rollback(); rbErr != nil {
+				e.logger.Error("Auto rollback", zap.Error(rbErr))
+			}
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return tx, nil
 }
 
 func (e *executor) bulkDelete(deletes []*DML) error {
@@ -120,27 +319,15 @@ func (e *executor) bulkDelete(deletes []*DML) error {
 		return nil
 	}
 
-	var sqls strings.Builder
-	argss := make([]interface{}, 0, len(deletes))
-
-	for _, dml := range deletes {
-		sql, args := dml.sql()
-		sqls.WriteString(sql)
-		sqls.WriteByte(';')
-		argss = append(argss, args...)
-	}
-	tx, err := e.begin()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	sql := sqls.String()
-	_, err = tx.autoRollbackExec(sql, argss...)
-	if err != nil {
-		return errors.Trace(err)
+	if !e.multiStatements.available() {
+		stmts := singleExecStatements(deletes, false)
+		defer releaseStatements(stmts)
+		return errors.Trace(e.execStatements(deletes, stmts))
 	}
 
-	err = tx.commit()
-	return errors.Trace(err)
+	stmt := bulkDeleteStatement(deletes)
+	defer putArgs(stmt.Args)
+	return errors.Trace(e.execStatements(deletes, []Statement{stmt}))
 }
 
 func (e *executor) bulkReplace(inserts []*DML) error {
@@ -148,37 +335,76 @@ func (e *executor) bulkReplace(inserts []*DML) error {
 		return nil
 	}
 
-	info := inserts[0].info
+	stmts := bulkReplaceStatements(inserts)
+	defer releaseStatements(stmts)
+	return errors.Trace(e.execStatements(inserts, stmts))
+}
 
-	var builder strings.Builder
+func (e *executor) bulkInsertIgnore(inserts []*DML) error {
+	if len(inserts) == 0 {
+		return nil
+	}
 
-	cols := "(" + buildColumnList(info.columns) + ")"
-	builder.WriteString("REPLACE INTO " + inserts[0].TableName() + cols + " VALUES ")
+	stmts := bulkInsertIgnoreStatements(inserts)
+	defer releaseStatements(stmts)
+	return errors.Trace(e.execStatements(inserts, stmts))
+}
 
-	holder := fmt.Sprintf("(%s)", holderString(len(info.columns)))
-	for i := 0; i < len(inserts); i++ {
-		if i > 0 {
-			builder.WriteByte(',')
-		}
-		builder.WriteString(holder)
-	}
+// execAppendOnlyRetry inserts the rows of dmls by multi-row INSERT IGNORE without merging them,
+// dmls must be the inserts of the same append-only table, it's idempotent as the rows existing are ignored.
+func (e *executor) execAppendOnlyRetry(ctx context.Context, dmls []*DML, retryNum int, backoff time.Duration) error {
+	err := e.retry(ctx, dmls, retryNum, backoff, func() error {
+		return e.splitExecDML(ctx, dmls, e.bulkInsertIgnore)
+	})
+	return errors.Trace(err)
+}
 
-	args := make([]interface{}, 0, len(inserts)*len(info.columns))
-	for _, insert := range inserts {
-		for _, name := range info.columns {
-			v := insert.Values[name]
-			args = append(args, v)
-		}
-	}
-	tx, err := e.begin()
+// execStatements executes the statements generated from dmls in a txn
+func (e *executor) execStatements(dmls []*DML, stmts []Statement) error {
+	return errors.Trace(e.execCheckedStatements(dmls, stmts, nil))
+}
+
+// execCheckedStatements is execStatements checking the affected rows of the statements by e.checkRows,
+// checks are the DMLs of the statements checked keyed by the indexes of the statements.
+func (e *executor) execCheckedStatements(dmls []*DML, stmts []Statement, checks map[int]*DML) error {
+	tx, err := e.begin(dmls)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	_, err = tx.autoRollbackExec(builder.String(), args...)
-	if err != nil {
-		return errors.Trace(err)
+
+	for i, stmt := range stmts {
+		res, err := tx.autoRollbackExec(stmt.SQL, stmt.Args...)
+		if err != nil {
+			// the txn is retried with the statements executed one by one
+			e.multiStatements.checkRejected(stmt.SQL, err, e.logger)
+			return errors.Trace(err)
+		}
+		if dml, ok := checks[i]; ok {
+			if err = e.checkRows(dml, res); err != nil {
+				if rbErr := tx.Rollback(); rbErr != nil {
+					tx.logger.Error("Auto rollback", zap.Error(rbErr))
+				}
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	if e.markTxn != nil {
+		mark := e.markTxn()
+		if _, err = tx.autoRollbackExec(mark.SQL, mark.Args...); err != nil {
+			return errors.Trace(err)
+		}
 	}
-	err = tx.commit()
+
+	// simulate the crash after the statements are executed but before the txn is committed
+	failpoint.Inject("failBeforeCommit", func() {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			tx.logger.Error("Auto rollback", zap.Error(rbErr))
+		}
+		failpoint.Return(errors.New("injected failure before commit"))
+	})
+
+	err = e.commit(tx)
 	return errors.Trace(err)
 }
 
@@ -193,12 +419,24 @@ func (e *executor) execTableBatch(ctx context.Context, dmls []*DML) error {
 		return nil
 	}
 
-	types, err := mergeByPrimaryKey(dmls)
+	keyUpdated := hasKeyUpdate(dmls)
+	types, err := mergeByPrimaryKey(dmls, e.logger)
 	if err != nil {
 		return errors.Trace(err)
 	}
-
-	log.Debug("merge dmls", zap.Reflect("dmls", dmls), zap.Reflect("merged", types))
+	defer releaseDMLs(types)
+
+	e.logger.Debug("merge dmls", zap.String("table", dmls[0].TableName()), zap.Int("dmls", len(dmls)),
+		zap.Int("deletes", len(types[DeleteDMLType])), zap.Int("inserts", len(types[InsertDMLType])),
+		zap.Int("updates", len(types[UpdateDMLType])), zap.Bool("key updated", keyUpdated))
+
+	// the updates changing the primary key are split into the deletes of the old rows and the inserts of
+	// the new rows, execute them in one txn so the rows are never found missing in downstream
+	if keyUpdated {
+		stmts := tableBatchStatements(types, e.batchSize, e.multiStatements.available())
+		defer releaseStatements(stmts)
+		return errors.Trace(e.execStatements(dmls, stmts))
+	}
 
 	if allDeletes, ok := types[DeleteDMLType]; ok {
 		if err := e.splitExecDML(ctx, allDeletes, e.bulkDelete); err != nil {
@@ -221,13 +459,34 @@ func (e *executor) execTableBatch(ctx context.Context, dmls []*DML) error {
 	return nil
 }
 
-// splitExecDML split dmls to size of e.batchSize and call exec concurrently
+// splitExecDML split dmls to size of e.batchSize and call exec concurrently,
+// at most e.workerCount splits are executed at the same time if it's positive
 func (e *executor) splitExecDML(ctx context.Context, dmls []*DML, exec func(dmls []*DML) error) error {
 	errg, _ := errgroup.WithContext(ctx)
 
-	for _, split := range splitDMLs(dmls, e.batchSize) {
+	var workers chan struct{}
+	if e.workerCount > 0 {
+		workers = make(chan struct{}, e.workerCount)
+	}
+
+	for i, split := range splitDMLs(dmls, e.batchSize) {
+		// fail the split of the index given, the other splits are executed as usual
+		failpoint.Inject("failSplitExec", func(val failpoint.Value) {
+			if i == val.(int) {
+				err := errors.Errorf("injected failure of split %d", i)
+				errg.Go(func() error { return err })
+				failpoint.Continue()
+			}
+		})
+
+		if workers != nil {
+			workers <- struct{}{}
+		}
 		split := split
 		errg.Go(func() error {
+			if workers != nil {
+				defer func() { <-workers }()
+			}
 			err := exec(split)
 			if err != nil {
 				return errors.Trace(err)
@@ -241,7 +500,7 @@ func (e *executor) splitExecDML(ctx context.Context, dmls []*DML, exec func(dmls
 
 func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode bool, retryNum int, backoff time.Duration) error {
 	for _, dmls := range splitDMLs(allDMLs, e.batchSize) {
-		err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
+		err := e.retry(ctx, dmls, retryNum, backoff, func() error {
 			return e.singleExec(dmls, safeMode)
 		})
 		if err != nil {
@@ -253,39 +512,44 @@ func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode
 }
 
 func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
-	tx, err := e.begin()
-	if err != nil {
-		return errors.Trace(err)
+	digestBatchSize := e.digestBatchSize
+	if !e.multiStatements.available() {
+		digestBatchSize = 0
+	}
+	if e.rowsCheck == nil && digestBatchSize <= 1 && !hasSemantics(dmls) {
+		stmts := e.singleExecStatements(dmls, safeMode)
+		defer releaseStatements(stmts)
+		return errors.Trace(e.execStatements(dmls, stmts))
 	}
 
+	var stmts []Statement
+	checks := make(map[int]*DML)
+	batcher := &digestBatcher{size: digestBatchSize}
 	for _, dml := range dmls {
-		if safeMode && dml.Tp == UpdateDMLType {
-			sql, args := dml.deleteSQL()
-			_, err := tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
-
-			sql, args = dml.replaceSQL()
-			_, err = tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
-		} else if safeMode && dml.Tp == InsertDMLType {
-			sql, args := dml.replaceSQL()
-			_, err := tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
-		} else {
-			sql, args := dml.sql()
-			_, err := tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
+		tableSafeMode := safeMode || (e.rowsCheck != nil && e.rowsCheck.isSafeMode(dml)) || dml.upsert()
+		dmlStmts := e.singleExecStatements([]*DML{dml}, tableSafeMode)
+		if !tableSafeMode && needsRowsCheck(dml) && !dml.resolvesConflict() && (dml.strict() || (e.rowsCheck != nil && !dml.idempotent())) {
+			stmts = batcher.flush(stmts)
+			checks[len(stmts)] = dml
+			stmts = append(stmts, dmlStmts...)
+			continue
 		}
+		stmts = batcher.add(stmts, dmlStmts)
 	}
+	stmts = batcher.flush(stmts)
 
-	err = tx.commit()
+	err := e.execCheckedStatements(dmls, stmts, checks)
+	releaseStatements(stmts)
+	if errors.Cause(err) == errRowsDrift {
+		// the table drifted is switched to safe mode, execute the DMLs again to rewrite its rows
+		return errors.Trace(e.singleExec(dmls, safeMode))
+	}
 	return errors.Trace(err)
 }
+
+func (e *executor) singleExecStatements(dmls []*DML, safeMode bool) []Statement {
+	if e.chunkSize > 0 {
+		return chunkedExecStatements(dmls, safeMode, e.chunkSize)
+	}
+	return singleExecStatements(dmls, safeMode)
+}
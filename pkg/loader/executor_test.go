@@ -17,13 +17,21 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
+	"os"
 	"regexp"
 	"sync/atomic"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
 	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
 type executorSuite struct{}
@@ -41,6 +49,16 @@ func (s *executorSuite) TestNewExecutor(c *C) {
 	c.Assert(e.queryHistogramVec, NotNil)
 }
 
+func (s *executorSuite) TestConflictType(c *C) {
+	c.Assert(conflictType(nil), Equals, "")
+	c.Assert(conflictType(errors.New("fake")), Equals, "")
+	c.Assert(conflictType(&mysql.MySQLError{Number: tmysql.ErrDupEntry}), Equals, "")
+	c.Assert(conflictType(errors.Trace(&mysql.MySQLError{Number: tmysql.ErrLockDeadlock})), Equals, "deadlock")
+	c.Assert(conflictType(&mysql.MySQLError{Number: tmysql.ErrLockWaitTimeout}), Equals, "lock_wait_timeout")
+	c.Assert(conflictType(&mysql.MySQLError{Number: tmysql.ErrWriteConflict}), Equals, "write_conflict")
+	c.Assert(conflictType(&mysql.MySQLError{Number: tmysql.ErrWriteConflictInTiDB}), Equals, "write_conflict")
+}
+
 func (s *executorSuite) TestSplitExecDML(c *C) {
 	var dmls []*DML
 	for i := 0; i < 5; i++ {
@@ -75,6 +93,202 @@ func (s *executorSuite) TestSplitExecDML(c *C) {
 	c.Assert(counter, Equals, int32(3))
 }
 
+func (s *executorSuite) TestSplitExecDMLWorkerCount(c *C) {
+	dmls := make([]*DML, 10)
+	for i := range dmls {
+		dmls[i] = &DML{Database: "db", Table: "tbl", Tp: InsertDMLType}
+	}
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	e := newExecutor(db).withBatchSize(1).withWorkerCount(2)
+
+	var running, maxRunning, executed int32
+	err = e.splitExecDML(context.Background(), dmls, func(group []*DML) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&executed, int32(len(group)))
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(&executed), Equals, int32(10))
+	c.Assert(atomic.LoadInt32(&maxRunning) <= 2, IsTrue)
+}
+
+func (s *executorSuite) TestExecAppendOnly(c *C) {
+	info := &tableInfo{columns: []string{"id", "msg"}}
+	var dmls []*DML
+	for i := 0; i < 3; i++ {
+		dmls = append(dmls, &DML{
+			Database: "test",
+			Table:    "events",
+			Tp:       InsertDMLType,
+			Values:   map[string]interface{}{"id": i, "msg": "m"},
+			info:     info,
+		})
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `test`.`events`(`id`,`msg`) VALUES (?,?),(?,?),(?,?)")).
+		WithArgs(0, "m", 1, "m", 2, "m").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withBatchSize(10)
+	err = e.execAppendOnlyRetry(context.Background(), dmls, 1, time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *executorSuite) TestExecTableBatchUpdateKey(c *C) {
+	info := &tableInfo{
+		columns:    []string{"id", "name"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	dmls := []*DML{{
+		Database:  "test",
+		Table:     "t",
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": 2, "name": "a"},
+		OldValues: map[string]interface{}{"id": 1, "name": "a"},
+		info:      info,
+	}}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the delete of the old row and the replace of the new row are in one txn
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`.`t` WHERE `id` = ? LIMIT 1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`t`(`id`,`name`) VALUES (?,?)")).
+		WithArgs(2, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withBatchSize(10)
+	err = e.execTableBatch(context.Background(), dmls)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *executorSuite) TestExecExactValues(c *C) {
+	dec := new(types.MyDecimal)
+	c.Assert(dec.FromString([]byte("99999999999999999999.999999999")), IsNil)
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"u": uint64(math.MaxUint64), "d": dec},
+		info:     &tableInfo{columns: []string{"u", "d"}},
+	}
+	exactValues(dml)
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the values are passed to the driver as is, without rounding or overflow
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`t`(`u`,`d`) VALUES(?,?)")).
+		WithArgs("18446744073709551615", "99999999999999999999.999999999").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db)
+	err = e.singleExec([]*DML{dml}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+const failpointPrefix = "github.com/pingcap/tidb-binlog/pkg/loader/"
+
+// failpointSuite tests the failures injected by the failpoints, which take effect only
+// after the markers are rewritten by `make failpoint-enable`
+type failpointSuite struct{}
+
+var _ = Suite(&failpointSuite{})
+
+func (s *failpointSuite) SetUpSuite(c *C) {
+	if _, err := os.Stat("binding__failpoint_binding__.go"); err != nil {
+		c.Skip("failpoints are not enabled")
+	}
+}
+
+func (s *failpointSuite) TestFailBeforeCommit(c *C) {
+	c.Assert(failpoint.Enable(failpointPrefix+"failBeforeCommit", "return(true)"), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(failpointPrefix+"failBeforeCommit"), IsNil)
+	}()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	e := newExecutor(db)
+	err = e.execStatements(nil, []Statement{{SQL: "DELETE FROM `db`.`tbl` WHERE `id` = ?", Args: []interface{}{1}}})
+	c.Assert(err, ErrorMatches, ".*injected failure before commit.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *failpointSuite) TestFailSplitExec(c *C) {
+	c.Assert(failpoint.Enable(failpointPrefix+"failSplitExec", "return(1)"), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(failpointPrefix+"failSplitExec"), IsNil)
+	}()
+
+	dmls := make([]*DML, 5)
+	for i := range dmls {
+		dmls[i] = &DML{Database: "db", Table: "tbl", Tp: InsertDMLType}
+	}
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	e := newExecutor(db).withBatchSize(2)
+
+	var executed int32
+	err = e.splitExecDML(context.Background(), dmls, func(dmls []*DML) error {
+		atomic.AddInt32(&executed, int32(len(dmls)))
+		return nil
+	})
+	c.Assert(err, ErrorMatches, ".*injected failure of split 1.*")
+	// the first and the last split are executed
+	c.Assert(atomic.LoadInt32(&executed), Equals, int32(3))
+}
+
+func (s *failpointSuite) TestFailRetryAttempt(c *C) {
+	c.Assert(failpoint.Enable(failpointPrefix+"failRetryAttempt", "return(2)"), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(failpointPrefix+"failRetryAttempt"), IsNil)
+	}()
+
+	e := newExecutor(nil)
+	var calls int
+	fn := func() error {
+		calls++
+		return nil
+	}
+
+	err := e.retry(context.Background(), nil, 2, time.Millisecond, fn)
+	c.Assert(err, ErrorMatches, ".*injected failure of attempt 1.*")
+	c.Assert(calls, Equals, 2)
+
+	calls = 0
+	err = e.retry(context.Background(), nil, 3, time.Millisecond, fn)
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 3)
+}
+
 type singleExecSuite struct {
 	db     *sql.DB
 	dbMock sqlmock.Sqlmock
@@ -101,6 +315,49 @@ func (s *singleExecSuite) TestFailedToBeginTx(c *C) {
 	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *singleExecSuite) TestSlowBatchAndConflict(c *C) {
+	dml := DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       DeleteDMLType,
+		Values: map[string]interface{}{
+			"name": "tester",
+		},
+		info: &tableInfo{
+			columns: []string{"name"},
+		},
+	}
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "conflict"}, []string{"type"})
+
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec("DELETE FROM `unicorn`.`users`.*").
+		WithArgs("tester").WillDelayFor(10 * time.Millisecond).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT CONNECTION_ID()")).
+		WillReturnRows(sqlmock.NewRows([]string{"CONNECTION_ID()"}).AddRow(42))
+	s.dbMock.ExpectCommit()
+
+	e := newExecutor(s.db).withSlowBatchThreshold(time.Millisecond).withConflictCounterVec(counter)
+	err := e.singleExec([]*DML{&dml}, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	s.resetMock(c)
+
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec("DELETE FROM `unicorn`.`users`.*").
+		WithArgs("tester").WillReturnError(&mysql.MySQLError{Number: tmysql.ErrLockDeadlock})
+
+	e = newExecutor(s.db).withConflictCounterVec(counter)
+	err = e.singleExec([]*DML{&dml}, false)
+	c.Assert(err, NotNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	err = counter.WithLabelValues("deadlock").Write(&metric)
+	c.Assert(err, IsNil)
+	c.Assert(metric.Counter.GetValue(), Equals, float64(1))
+}
+
 func (s *singleExecSuite) TestInsert(c *C) {
 	dml := DML{
 		Database: "unicorn",
@@ -296,3 +553,54 @@ func (s *bulkReplaceSuite) TestReplaceInBulk(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
+
+func (s *bulkReplaceSuite) TestReplaceMixedColumns(c *C) {
+	info := &tableInfo{columns: []string{"a", "b", "c"}}
+	dmls := []*DML{
+		{Database: "d", Table: "t", Tp: InsertDMLType, info: info, Values: map[string]interface{}{"a": 1, "b": 1}},
+		{Database: "d", Table: "t", Tp: InsertDMLType, info: info, Values: map[string]interface{}{"a": 2, "b": 2, "c": 2}},
+		{Database: "d", Table: "t", Tp: InsertDMLType, info: info, Values: map[string]interface{}{"a": 3, "b": 3}},
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	// the rows of the old schema version lacking c are replaced apart, c is left to its default value
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `d`.`t`(`a`,`b`) VALUES (?,?),(?,?)")).
+		WithArgs(1, 1, 3, 3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `d`.`t`(`a`,`b`,`c`) VALUES (?,?,?)")).
+		WithArgs(2, 2, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db)
+	err = e.bulkReplace(dmls)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *bulkReplaceSuite) TestGroupByColumns(c *C) {
+	info := &tableInfo{columns: []string{"a", "b"}}
+	newInsert := func(values map[string]interface{}) *DML {
+		return &DML{Database: "d", Table: "t", Tp: InsertDMLType, info: info, Values: values}
+	}
+
+	full := []*DML{newInsert(map[string]interface{}{"a": 1, "b": 1}), newInsert(map[string]interface{}{"a": 2, "b": 2})}
+	groups := groupByColumns(full)
+	c.Assert(groups, HasLen, 1)
+	c.Assert(groups[0], DeepEquals, full)
+
+	// the DMLs of the table info of another version with the same columns are in the same group
+	other := newInsert(map[string]interface{}{"a": 3, "b": 3})
+	other.info = &tableInfo{columns: []string{"a", "b"}}
+	c.Assert(groupByColumns(append(full, other)), HasLen, 1)
+
+	partial := newInsert(map[string]interface{}{"b": 4})
+	groups = groupByColumns([]*DML{full[0], partial, full[1]})
+	c.Assert(groups, HasLen, 2)
+	c.Assert(groups[0], DeepEquals, full)
+	c.Assert(groups[1], DeepEquals, []*DML{partial})
+	c.Assert(insertColumns(partial), DeepEquals, []string{"b"})
+
+	c.Assert(groupByColumns(nil), HasLen, 0)
+}
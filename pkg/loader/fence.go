@@ -0,0 +1,234 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// FenceTable is the downstream table holding the fencing tokens, see Fencing
+const FenceTable = "_loader_fence"
+
+var (
+	// errFenced means another loader has taken over the fence, the loader must stop writing
+	errFenced = errors.New("fenced by another loader")
+	// errFenceHeld means the lease of the fence held by another loader hasn't expired
+	errFenceHeld = errors.New("fence is held by another loader")
+
+	fenceRetryWait = time.Second
+)
+
+// Fencing protects downstream from the loaders writing it at the same time, e.g., the drainers of a botched
+// failover. The loader takes over the fence named name in the table FenceTable of schema in downstream before
+// applying any txn, which increases the fencing token, and every txn applied checks the token is still its own,
+// so the loader taken over stops with an error instead of interleaving its writes with the new one.
+//
+// The fence is leased to owner, the loader waits up to lease for the lease held by another owner to expire, e.g.,
+// the one of a crashed loader, and fails if it's still renewed. The lease is renewed by Run between the batches,
+// so it should be longer than the slowest batch or DDL. It's disabled if lease is 0.
+//
+// On mysql, the token is read with a shared lock held until the txn is committed, so taking over waits for the
+// txns in progress. TiDB has no shared lock, so a txn started before the take over may still be committed.
+func Fencing(schema string, name string, owner string, lease time.Duration) Option {
+	return func(o *options) {
+		o.fenceSchema = schema
+		o.fenceName = name
+		o.fenceOwner = owner
+		o.fenceLease = lease
+	}
+}
+
+type fence struct {
+	schema   string
+	name     string
+	owner    string
+	lease    time.Duration
+	tidbMode bool
+
+	// the token taken over, it's only set before any txn is applied
+	token     int64
+	renewTime time.Time
+}
+
+func newFence(opts options) *fence {
+	return &fence{
+		schema:   opts.fenceSchema,
+		name:     opts.fenceName,
+		owner:    opts.fenceOwner,
+		lease:    opts.fenceLease,
+		tidbMode: opts.tidbMode,
+	}
+}
+
+func (f *fence) validate() error {
+	if len(f.name) == 0 || len(f.owner) == 0 {
+		return errors.New("the name and owner of the fence must be set")
+	}
+	if f.lease < time.Second {
+		return errors.Errorf("the lease of the fence must be at least 1s, got %s", f.lease)
+	}
+	return nil
+}
+
+func (f *fence) table() string {
+	return quoteSchema(f.schema, FenceTable)
+}
+
+// createFenceTableSQLs returns the statements creating the fence table if it doesn't exist, the expire time is
+// in microseconds so that each renewal changes the row and is counted in the affected rows
+func createFenceTableSQLs(schema string) []string {
+	return []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(schema)),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s("+
+			"`name` VARCHAR(255) NOT NULL PRIMARY KEY, `token` BIGINT NOT NULL, "+
+			"`owner` VARCHAR(255) NOT NULL, `expire_time` DATETIME(6) NOT NULL)", quoteSchema(schema, FenceTable)),
+	}
+}
+
+// leaseMicroseconds returns the lease in microseconds, the expire time is computed by the clock of downstream
+// so that the loaders needn't agree on the time
+func (f *fence) leaseMicroseconds() int64 {
+	return int64(f.lease / time.Microsecond)
+}
+
+// acquire takes over the fence, it waits up to the lease if the fence is held by another owner
+func (f *fence) acquire(ctx context.Context, db *gosql.DB, logger FieldLogger) error {
+	for _, sql := range createFenceTableSQLs(f.schema) {
+		if _, err := db.Exec(sql); err != nil {
+			return errors.Annotatef(err, "create fence table failed, sql: %s", sql)
+		}
+	}
+
+	deadline := time.Now().Add(f.lease)
+	for {
+		err := f.tryAcquire(db, logger)
+		if errors.Cause(err) != errFenceHeld || time.Now().After(deadline) {
+			return errors.Trace(err)
+		}
+		logger.Warn("wait for the lease of the fence to expire", zap.String("fence", f.name), zap.Error(err))
+		select {
+		case <-time.After(fenceRetryWait):
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+}
+
+func (f *fence) tryAcquire(db *gosql.DB, logger FieldLogger) error {
+	// the row is created first so that it can be locked, the initial one has expired
+	_, err := db.Exec(fmt.Sprintf("INSERT IGNORE INTO %s(`name`,`token`,`owner`,`expire_time`) VALUES(?,0,'',NOW(6))", f.table()), f.name)
+	if err != nil {
+		return errors.Annotate(err, "init fence")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	rollback := func() {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logger.Error("Auto rollback", zap.Error(rbErr))
+		}
+	}
+
+	var token int64
+	var owner string
+	var active bool
+	row := tx.QueryRow(fmt.Sprintf("SELECT `token`,`owner`,`expire_time` > NOW(6) FROM %s WHERE `name` = ? FOR UPDATE", f.table()), f.name)
+	if err = row.Scan(&token, &owner, &active); err != nil {
+		rollback()
+		return errors.Annotate(err, "read fence")
+	}
+	// the loader restarted takes over the fence of its own at once
+	if active && owner != f.owner {
+		rollback()
+		return errors.Annotatef(errFenceHeld, "owner: %s, token: %d", owner, token)
+	}
+
+	// the token is compared in case the row is not locked, e.g., by the optimistic txn of TiDB
+	res, err := tx.Exec(fmt.Sprintf("UPDATE %s SET `token` = ?, `owner` = ?, `expire_time` = DATE_ADD(NOW(6), INTERVAL ? MICROSECOND) "+
+		"WHERE `name` = ? AND `token` = ?", f.table()), token+1, f.owner, f.leaseMicroseconds(), f.name, token)
+	if err != nil {
+		rollback()
+		return errors.Annotate(err, "take over fence")
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		rollback()
+		return errors.Annotatef(errFenceHeld, "token %d is taken over concurrently", token)
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Trace(err)
+	}
+
+	f.token = token + 1
+	f.renewTime = time.Now()
+	return nil
+}
+
+// renew extends the lease, it returns errFenced if the fence has been taken over
+func (f *fence) renew(db *gosql.DB) error {
+	f.renewTime = time.Now()
+	res, err := db.Exec(fmt.Sprintf("UPDATE %s SET `expire_time` = DATE_ADD(NOW(6), INTERVAL ? MICROSECOND) WHERE `name` = ? AND `token` = ?",
+		f.table()), f.leaseMicroseconds(), f.name, f.token)
+	if err != nil {
+		return errors.Annotate(err, "renew fence")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Annotate(err, "renew fence")
+	}
+	if affected == 0 {
+		return errors.Annotatef(errFenced, "token %d of fence %s is taken over", f.token, f.name)
+	}
+	return nil
+}
+
+// needRenew returns true if a third of the lease has passed since the last renewal
+func (f *fence) needRenew() bool {
+	return time.Since(f.renewTime) >= f.lease/3
+}
+
+// check returns errFenced if the fence has been taken over, it must be called in the txn applying the DMLs or DDL
+func (f *fence) check(tx *gosql.Tx) error {
+	sql := fmt.Sprintf("SELECT `token` FROM %s WHERE `name` = ?", f.table())
+	if !f.tidbMode {
+		sql += " LOCK IN SHARE MODE"
+	}
+	var token int64
+	if err := tx.QueryRow(sql, f.name).Scan(&token); err != nil {
+		return errors.Annotate(err, "check fence")
+	}
+	if token != f.token {
+		return errors.Annotatef(errFenced, "token %d of fence %s is taken over by token %d", f.token, f.name, token)
+	}
+	return nil
+}
+
+// renewFence renews the lease of the fence, the failure is only logged unless the fence has been taken over
+func (s *loaderImpl) renewFence() error {
+	err := s.fence.renew(s.getDB())
+	if errors.Cause(err) == errFenced {
+		return errors.Trace(err)
+	}
+	if err != nil {
+		s.getLogger().Warn("renew the lease of the fence failed", zap.String("fence", s.fence.name), zap.Error(err))
+	}
+	return nil
+}
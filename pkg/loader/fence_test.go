@@ -0,0 +1,159 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+)
+
+type fenceSuite struct{}
+
+var _ = Suite(&fenceSuite{})
+
+func newTestFence() *fence {
+	return &fence{schema: "tidb_binlog", name: "cluster", owner: "drainer-1", lease: time.Second}
+}
+
+func (s *fenceSuite) TestInvalidFencing(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, Fencing("tidb_binlog", "", "drainer-1", time.Minute))
+	c.Assert(err, ErrorMatches, ".*name and owner.*")
+	_, err = NewLoader(db, Fencing("tidb_binlog", "cluster", "drainer-1", time.Millisecond))
+	c.Assert(err, ErrorMatches, ".*at least 1s.*")
+	_, err = NewLoader(db, Fencing("tidb_binlog", "cluster", "drainer-1", time.Minute))
+	c.Assert(err, IsNil)
+}
+
+func expectTryAcquire(mock sqlmock.Sqlmock, token int64, owner string, active bool) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `tidb_binlog`.`_loader_fence`")).
+		WithArgs("cluster").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"token", "owner", "active"}).AddRow(token, owner, active)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `token`,`owner`,`expire_time` > NOW(6) FROM `tidb_binlog`.`_loader_fence`")).
+		WithArgs("cluster").WillReturnRows(rows)
+}
+
+func (s *fenceSuite) TestAcquire(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	f := newTestFence()
+	for _, sql := range createFenceTableSQLs("tidb_binlog") {
+		mock.ExpectExec(regexp.QuoteMeta(sql)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	// the lease of the crashed owner has expired
+	expectTryAcquire(mock, 3, "drainer-2", false)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `tidb_binlog`.`_loader_fence` SET `token` = ?")).
+		WithArgs(4, "drainer-1", int64(1000000), "cluster", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = f.acquire(context.Background(), db, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(f.token, Equals, int64(4))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the fence of its own is taken over at once
+	expectTryAcquire(mock, 4, "drainer-1", true)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `tidb_binlog`.`_loader_fence` SET `token` = ?")).
+		WithArgs(5, "drainer-1", int64(1000000), "cluster", 4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	err = f.tryAcquire(db, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(f.token, Equals, int64(5))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *fenceSuite) TestAcquireHeld(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	origWait := fenceRetryWait
+	fenceRetryWait = 30 * time.Millisecond
+	defer func() { fenceRetryWait = origWait }()
+
+	f := newTestFence()
+	f.lease = 50 * time.Millisecond
+	for _, sql := range createFenceTableSQLs("tidb_binlog") {
+		mock.ExpectExec(regexp.QuoteMeta(sql)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	// the owner keeps renewing the lease
+	for i := 0; i < 3; i++ {
+		expectTryAcquire(mock, 3, "drainer-2", true)
+		mock.ExpectRollback()
+	}
+
+	err = f.acquire(context.Background(), db, log.L())
+	c.Assert(errors.Cause(err), Equals, errFenceHeld)
+	c.Assert(err, ErrorMatches, ".*owner: drainer-2, token: 3.*")
+	c.Assert(f.token, Equals, int64(0))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *fenceSuite) TestRenew(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	f := newTestFence()
+	f.token = 4
+	renew := regexp.QuoteMeta("UPDATE `tidb_binlog`.`_loader_fence` SET `expire_time`")
+	mock.ExpectExec(renew).WithArgs(int64(1000000), "cluster", 4).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(f.renew(db), IsNil)
+	c.Assert(f.needRenew(), IsFalse)
+
+	// taken over by another loader
+	mock.ExpectExec(renew).WithArgs(int64(1000000), "cluster", 4).WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(errors.Cause(f.renew(db)), Equals, errFenced)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *fenceSuite) TestRefuseToApply(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, Fencing("tidb_binlog", "cluster", "drainer-1", time.Minute))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+	s0.fence.token = 4
+
+	check := regexp.QuoteMeta("SELECT `token` FROM `tidb_binlog`.`_loader_fence` WHERE `name` = ? LOCK IN SHARE MODE")
+	mock.ExpectBegin()
+	mock.ExpectQuery(check).WithArgs("cluster").WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow(4))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`tbl` SET")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate()}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the txn is rolled back without executing any DML
+	mock.ExpectBegin()
+	mock.ExpectQuery(check).WithArgs("cluster").WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow(5))
+	mock.ExpectRollback()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate()}, false)
+	c.Assert(errors.Cause(err), Equals, errFenced)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
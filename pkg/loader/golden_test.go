@@ -0,0 +1,172 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader_test
+
+import (
+	"path/filepath"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loader/loadertest"
+)
+
+type goldenSuite struct{}
+
+var _ = check.Suite(&goldenSuite{})
+
+var pkSchema = &loader.TableSchema{
+	Columns:    []string{"id", "name", "age"},
+	PrimaryKey: []string{"id"},
+}
+
+var pkHintSchema = &loader.TableSchema{
+	Columns:    []string{"id", "name", "age"},
+	PrimaryKey: []string{"id"},
+	Hint:       "/*+ IGNORE_INDEX(pk, idx_name) */",
+}
+
+var ukSchema = &loader.TableSchema{
+	Columns:    []string{"id", "email"},
+	UniqueKeys: [][]string{{"email"}},
+}
+
+func pkDMLs() []*loader.DML {
+	return []*loader.DML{
+		{
+			Database: "test",
+			Table:    "pk",
+			Tp:       loader.InsertDMLType,
+			Values:   map[string]interface{}{"id": 1, "name": "a", "age": 10},
+		},
+		{
+			Database:  "test",
+			Table:     "pk",
+			Tp:        loader.UpdateDMLType,
+			Values:    map[string]interface{}{"id": 2, "name": "c", "age": 20},
+			OldValues: map[string]interface{}{"id": 2, "name": "b", "age": 20},
+		},
+		{
+			Database: "test",
+			Table:    "pk",
+			Tp:       loader.DeleteDMLType,
+			Values:   map[string]interface{}{"id": 3, "name": "d", "age": nil},
+		},
+		{
+			Database: "test",
+			Table:    "pk",
+			Tp:       loader.InsertDMLType,
+			Values:   map[string]interface{}{"id": 4, "name": "e", "age": nil},
+		},
+	}
+}
+
+// the update changing the primary key is turned into delete + replace in one txn
+func pkUpdateDMLs() []*loader.DML {
+	return []*loader.DML{
+		{
+			Database:  "test",
+			Table:     "pk",
+			Tp:        loader.UpdateDMLType,
+			Values:    map[string]interface{}{"id": 2, "name": "b", "age": 20},
+			OldValues: map[string]interface{}{"id": 1, "name": "a", "age": 20},
+		},
+		{
+			Database:  "test",
+			Table:     "pk",
+			Tp:        loader.UpdateDMLType,
+			Values:    map[string]interface{}{"id": 3, "name": "d", "age": 30},
+			OldValues: map[string]interface{}{"id": 3, "name": "c", "age": 30},
+		},
+	}
+}
+
+func ukDMLs() []*loader.DML {
+	return []*loader.DML{
+		{
+			Database:  "test",
+			Table:     "uk",
+			Tp:        loader.UpdateDMLType,
+			Values:    map[string]interface{}{"id": 1, "email": "a@pingcap.com"},
+			OldValues: map[string]interface{}{"id": 1, "email": nil},
+		},
+		{
+			Database: "test",
+			Table:    "uk",
+			Tp:       loader.DeleteDMLType,
+			Values:   map[string]interface{}{"id": 2, "email": "b@pingcap.com"},
+		},
+	}
+}
+
+func (s *goldenSuite) TestGolden(c *check.C) {
+	tests := []struct {
+		name      string
+		table     string
+		schema    *loader.TableSchema
+		dmls      func() []*loader.DML
+		merge     bool
+		safeMode  bool
+		batchSize int
+	}{
+		{name: "single", table: "pk", schema: pkSchema, dmls: pkDMLs, batchSize: 2},
+		{name: "single_safe_mode", table: "pk", schema: pkSchema, dmls: pkDMLs, safeMode: true, batchSize: 2},
+		{name: "merge", table: "pk", schema: pkSchema, dmls: pkDMLs, merge: true, batchSize: 2},
+		{name: "update_key", table: "pk", schema: pkSchema, dmls: pkUpdateDMLs, batchSize: 10},
+		{name: "update_key_merge", table: "pk", schema: pkSchema, dmls: pkUpdateDMLs, merge: true, batchSize: 10},
+		{name: "unique_key", table: "uk", schema: ukSchema, dmls: ukDMLs, batchSize: 10},
+		{name: "hint", table: "pk", schema: pkHintSchema, dmls: pkDMLs, safeMode: true, batchSize: 2},
+		{name: "hint_merge", table: "pk", schema: pkHintSchema, dmls: pkDMLs, merge: true, batchSize: 2},
+	}
+
+	for _, t := range tests {
+		txns, err := loader.GenerateStatements(t.schema, t.dmls(), t.merge, t.safeMode, t.batchSize)
+		c.Assert(err, check.IsNil)
+		loadertest.CheckGolden(c, filepath.Join("testdata", t.name+".golden"), txns)
+
+		// the loader only merges the DMLs of the tables having primary key and no other unique keys
+		if !t.merge {
+			s.checkLoaderExec(c, t.table, t.schema, t.dmls(), t.safeMode, t.batchSize, txns)
+		}
+	}
+}
+
+// checkLoaderExec checks the loader executes exactly the statements for the dmls
+func (s *goldenSuite) checkLoaderExec(c *check.C, table string, schema *loader.TableSchema, dmls []*loader.DML, safeMode bool, batchSize int, txns [][]loader.Statement) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	loadertest.ExpectTableSchema(mock, "test", table, schema)
+	loadertest.ExpectStatements(mock, txns)
+
+	opts := []loader.Option{loader.WorkerCount(1), loader.BatchSize(batchSize)}
+	if len(schema.Hint) > 0 {
+		opts = append(opts, loader.StatementHints(loader.StatementHint{Schema: "test", Table: table, Hint: schema.Hint}))
+	}
+	ld, err := loader.NewLoader(db, opts...)
+	c.Assert(err, check.IsNil)
+	ld.SetSafeMode(safeMode)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ld.Run()
+	}()
+
+	ld.Input() <- &loader.Txn{DMLs: dmls}
+	<-ld.Successes()
+	ld.Close()
+
+	c.Assert(<-runErr, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
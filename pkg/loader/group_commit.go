@@ -0,0 +1,94 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// groupCommitWait returns how long to wait for more txns before executing the DMLs accumulated in batch,
+// it's not positive if the group commit is disabled or the delay after the first txn is put has passed.
+func (s *loaderImpl) groupCommitWait(batch *batchManager) time.Duration {
+	if s.groupCommitSize <= 0 {
+		return 0
+	}
+	return s.groupCommitDelay - time.Since(batch.firstPut)
+}
+
+// execGroupCommit executes dmls of any tables in one txn.
+// NOTE: DML.info are assumed to be already set.
+func (s *loaderImpl) execGroupCommit(dmls []*DML, safeMode bool) error {
+	stmts, err := s.groupCommitStatements(dmls, safeMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer releaseStatements(stmts)
+
+	executor := s.getExecutor()
+	err = executor.retry(s.ctx, dmls, maxDMLRetryCount, time.Second, func() error {
+		return executor.execStatements(dmls, stmts)
+	})
+	if err != nil {
+		s.tableStatus.onDMLsError(dmls, err)
+	}
+	return errors.Trace(err)
+}
+
+// groupCommitStatements returns the statements executing dmls in one txn. The DMLs of a table are written
+// the same way as they are by the workers, the tables are in the order of their first DMLs, followed by
+// the DMLs executed one by one.
+func (s *loaderImpl) groupCommitStatements(dmls []*DML, safeMode bool) ([]Statement, error) {
+	var tables []string
+	seen := make(map[string]struct{})
+	for _, dml := range dmls {
+		tblName := dml.TableName()
+		if _, ok := seen[tblName]; !ok {
+			seen[tblName] = struct{}{}
+			tables = append(tables, tblName)
+		}
+	}
+
+	appendOnly, others, err := s.splitAppendOnly(dmls)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	batchTables, singleDMLs := s.groupDMLs(others)
+
+	var stmts []Statement
+	for _, tblName := range tables {
+		if inserts, ok := appendOnly[tblName]; ok {
+			for _, split := range splitDMLs(inserts, s.batchSize) {
+				stmts = append(stmts, bulkInsertIgnoreStatements(split)...)
+			}
+			continue
+		}
+		if tblDMLs, ok := batchTables[tblName]; ok {
+			types, err := mergeByPrimaryKey(tblDMLs, s.getLogger())
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			stmts = append(stmts, tableBatchStatements(types, s.batchSize, s.multiStatements.available())...)
+			releaseDMLs(types)
+		}
+	}
+
+	if s.chunkSize > 0 {
+		stmts = append(stmts, chunkedExecStatements(singleDMLs, safeMode, s.chunkSize)...)
+	} else {
+		stmts = append(stmts, singleExecStatements(singleDMLs, safeMode)...)
+	}
+	return stmts, nil
+}
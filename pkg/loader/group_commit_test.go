@@ -0,0 +1,205 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type groupCommitSuite struct{}
+
+var _ = Suite(&groupCommitSuite{})
+
+func groupCommitDMLs() []*DML {
+	pkInfo := &tableInfo{
+		columns:    []string{"id", "name"},
+		primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}},
+	}
+	noKeyInfo := &tableInfo{columns: []string{"id", "name"}}
+
+	return []*DML{
+		{Database: "test", Table: "t1", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a"}, info: pkInfo},
+		{Database: "test", Table: "t2", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a"}, info: noKeyInfo},
+		{Database: "test", Table: "t1", Tp: UpdateDMLType, Values: map[string]interface{}{"id": 1, "name": "b"},
+			OldValues: map[string]interface{}{"id": 1, "name": "a"}, info: pkInfo},
+	}
+}
+
+func (s *groupCommitSuite) TestGroupCommitStatements(c *C) {
+	loader := &loaderImpl{merge: true, batchSize: 10}
+	stmts, err := loader.groupCommitStatements(groupCommitDMLs(), false)
+	c.Assert(err, IsNil)
+	c.Assert(stmts, DeepEquals, []Statement{
+		{SQL: "REPLACE INTO `test`.`t1`(`id`,`name`) VALUES (?,?)", Args: []interface{}{1, "b"}},
+		{SQL: "INSERT INTO `test`.`t2`(`id`,`name`) VALUES(?,?)", Args: []interface{}{1, "a"}},
+	})
+}
+
+func (s *groupCommitSuite) TestExecGroupCommitInOneTxn(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	loader := &loaderImpl{db: db, merge: true, batchSize: 10, ctx: context.Background()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REPLACE INTO `test`.`t1`").WithArgs(1, "b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `test`.`t2`").WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = loader.execGroupCommit(groupCommitDMLs(), false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *groupCommitSuite) TestBatchManagerCommitBeforeExceedingLimit(c *C) {
+	var executed []int
+	bm := batchManager{
+		limit:       3,
+		groupCommit: true,
+		fExecDMLs: func(dmls []*DML) error {
+			executed = append(executed, len(dmls))
+			return nil
+		},
+	}
+	for _, n := range []int{2, 2, 1} {
+		var dmls []*DML
+		for i := 0; i < n; i++ {
+			dmls = append(dmls, &DML{})
+		}
+		err := bm.put(&Txn{DMLs: dmls})
+		c.Assert(err, IsNil)
+	}
+	c.Assert(executed, DeepEquals, []int{2, 3})
+	c.Assert(bm.dmls, HasLen, 0)
+}
+
+func (s *groupCommitSuite) TestRunWaitForMoreTxns(c *C) {
+	executed := make(chan []*DML, 2)
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit:       s.batchLimit(),
+			groupCommit: true,
+			fExecDMLs: func(dmls []*DML) error {
+				executed <- dmls
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:            make(chan *Txn, 10),
+		successTxn:       make(chan *Txn, 10),
+		groupCommitSize:  100,
+		groupCommitDelay: 500 * time.Millisecond,
+	}
+	go func() {
+		err := loader.Run()
+		c.Assert(err, IsNil)
+	}()
+	defer close(loader.input)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		loader.input <- &Txn{DMLs: []*DML{{Tp: InsertDMLType}}}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case dmls := <-executed:
+		c.Assert(dmls, HasLen, 3)
+		c.Assert(time.Since(start) >= 500*time.Millisecond, IsTrue)
+	case <-time.After(2 * time.Second):
+		c.Fatal("Timeout waiting to be executed.")
+	}
+}
+
+func savepointDMLs() []*DML {
+	dmls := groupCommitDMLs()
+	txn1, txn2 := &Txn{CommitTS: 1}, &Txn{CommitTS: 2}
+	dmls[0].txn = txn1
+	dmls[1].txn = txn2
+	dmls[2].txn = txn2
+	return dmls
+}
+
+func (s *groupCommitSuite) TestSplitByTxn(c *C) {
+	dmls := savepointDMLs()
+	c.Assert(splitByTxn(dmls), DeepEquals, [][]*DML{dmls[:1], dmls[1:]})
+	c.Assert(splitByTxn(nil), HasLen, 0)
+}
+
+func (s *groupCommitSuite) TestExecGroupCommitSavepointRetry(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	loader := &loaderImpl{db: db, merge: true, batchSize: 10, ctx: context.Background(), savepointPolicy: SavepointRetry}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txn_0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REPLACE INTO `test`.`t1`").WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SAVEPOINT txn_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REPLACE INTO `test`.`t1`").WithArgs(1, "b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `test`.`t2`").WithArgs(1, "a").WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txn_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REPLACE INTO `test`.`t1`").WithArgs(1, "b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `test`.`t2`").WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = loader.execGroupCommitSavepoints(savepointDMLs(), false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *groupCommitSuite) TestExecGroupCommitSavepointQuarantine(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	loader := &loaderImpl{db: db, merge: true, batchSize: 10, ctx: context.Background(), savepointPolicy: SavepointQuarantine}
+	origBackoff := savepointRetryBackoff
+	savepointRetryBackoff = 20 * time.Millisecond
+	defer func() { savepointRetryBackoff = origBackoff }()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txn_0").WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < savepointRetryCount; i++ {
+		mock.ExpectExec("REPLACE INTO `test`.`t1`").WithArgs(1, "a").WillReturnError(errors.New("duplicate entry"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT txn_0").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("SAVEPOINT txn_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REPLACE INTO `test`.`t1`").WithArgs(1, "b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `test`.`t2`").WithArgs(1, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	start := time.Now()
+	err = loader.execGroupCommitSavepoints(savepointDMLs(), false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	// backoff 20ms and 40ms before the retries
+	c.Assert(time.Since(start) >= 60*time.Millisecond, IsTrue)
+	c.Assert(loader.tableStatus.get("test", "t1").LastError, Matches, ".*duplicate entry.*")
+	c.Assert(loader.tableStatus.get("test", "t2").LastError, Equals, "")
+
+	status := loader.TableStatus()
+	c.Assert(status, HasLen, 2)
+	c.Assert(status[0].QuarantinedCount, Equals, int64(1))
+	c.Assert(status[0].Quarantined, HasLen, 1)
+	c.Assert(status[0].Quarantined[0].CommitTS, Equals, int64(1))
+	c.Assert(status[0].Quarantined[0].Error, Matches, ".*duplicate entry.*")
+	c.Assert(status[1].Quarantined, HasLen, 0)
+}
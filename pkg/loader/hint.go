@@ -0,0 +1,77 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// StatementHint is the optimizer hint or comment added to the DML statements of the tables matched,
+// e.g., "/*+ IGNORE_INDEX(t, idx) */" or "/* drainer */". The empty Schema or Table matches any.
+type StatementHint struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Hint   string `toml:"hint" json:"hint"`
+}
+
+// validate checks that the hint is a single comment, so it can't change the statements
+func (h *StatementHint) validate() error {
+	hint := strings.TrimSpace(h.Hint)
+	if !strings.HasPrefix(hint, "/*") || !strings.HasSuffix(hint, "*/") || len(hint) < 4 ||
+		strings.Contains(hint[2:len(hint)-2], "*/") {
+		return errors.Errorf("invalid hint %q of %s, it must be a comment like /*+ ... */ or /* ... */",
+			h.Hint, quoteSchema(h.Schema, h.Table))
+	}
+	return nil
+}
+
+// matches returns whether the hint applies to the table, and how specific it is, see matchTable
+func (h *StatementHint) matches(schema string, table string) (specificity int, ok bool) {
+	return matchTable(h.Schema, h.Table, schema, table)
+}
+
+// matchTable returns whether the table is matched by the schema and table name of a rule, the empty ones match any,
+// and how specific the rule is, the exact table name is more specific than the schema, which is more specific than
+// the table name only
+func matchTable(ruleSchema string, ruleTable string, schema string, table string) (specificity int, ok bool) {
+	if len(ruleSchema) > 0 {
+		if !strings.EqualFold(ruleSchema, schema) {
+			return 0, false
+		}
+		specificity += 2
+	}
+	if len(ruleTable) > 0 {
+		if !strings.EqualFold(ruleTable, table) {
+			return 0, false
+		}
+		specificity++
+	}
+	return specificity, true
+}
+
+// hintOf returns the hint of the most specific StatementHint matching the table,
+// the first one is used if there're more than one, it's empty if none matches.
+func hintOf(hints []StatementHint, schema string, table string) string {
+	var hint string
+	best := -1
+	for i := range hints {
+		if specificity, ok := hints[i].matches(schema, table); ok && specificity > best {
+			hint = strings.TrimSpace(hints[i].Hint)
+			best = specificity
+		}
+	}
+	return hint
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type hintSuite struct{}
+
+var _ = Suite(&hintSuite{})
+
+func (s *hintSuite) TestValidate(c *C) {
+	for _, hint := range []string{"/* drainer */", "/*+ IGNORE_INDEX(t, idx) */", " /**/ "} {
+		h := StatementHint{Hint: hint}
+		c.Assert(h.validate(), IsNil, Commentf("hint %s", hint))
+	}
+	for _, hint := range []string{"", "drainer", "/* a */ b", "/* a */ DROP TABLE t; /* b */", "/*/", "-- drainer"} {
+		h := StatementHint{Schema: "test", Hint: hint}
+		c.Assert(h.validate(), ErrorMatches, "invalid hint.*", Commentf("hint %s", hint))
+	}
+}
+
+func (s *hintSuite) TestHintOf(c *C) {
+	hints := []StatementHint{
+		{Hint: "/* all */"},
+		{Table: "t", Hint: "/* any t */"},
+		{Schema: "test", Hint: "/* test */"},
+		{Schema: "test", Table: "t", Hint: "/* test.t */"},
+	}
+	c.Assert(hintOf(hints, "test", "t"), Equals, "/* test.t */")
+	c.Assert(hintOf(hints, "TEST", "T"), Equals, "/* test.t */")
+	c.Assert(hintOf(hints, "test", "t2"), Equals, "/* test */")
+	c.Assert(hintOf(hints, "db", "t"), Equals, "/* any t */")
+	c.Assert(hintOf(hints, "db", "t2"), Equals, "/* all */")
+	c.Assert(hintOf(hints[1:], "db", "t2"), Equals, "")
+	c.Assert(hintOf(nil, "db", "t2"), Equals, "")
+}
+
+func (s *hintSuite) TestStatementsWithHint(c *C) {
+	info := &tableInfo{columns: []string{"id", "data"}, hint: "/* drainer */"}
+	info.uniqueKeys = []indexInfo{{name: "PRIMARY", columns: []string{"id"}}}
+	info.primaryKey = &info.uniqueKeys[0]
+	dml := &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "data": "abc"}, info: info}
+
+	sql, _ := dml.sql()
+	c.Assert(sql, Equals, "INSERT /* drainer */ INTO `test`.`t`(`id`,`data`) VALUES(?,?)")
+	c.Assert(bulkInsertIgnoreStatement([]*DML{dml}).SQL, Equals, "INSERT /* drainer */ IGNORE INTO `test`.`t`(`id`,`data`) VALUES (?,?)")
+
+	stmts := chunkedExecStatements([]*DML{dml}, false, 2)
+	c.Assert(stmts[1].SQL, Equals, "UPDATE /* drainer */ `test`.`t` SET `data` = CONCAT(`data`, ?) WHERE `id` = ? LIMIT 1")
+
+	dml.Tp = UpdateDMLType
+	dml.OldValues = map[string]interface{}{"id": 1, "data": "a"}
+	sql, _ = dml.sql()
+	c.Assert(sql, Equals, "UPDATE /* drainer */ `test`.`t` SET `data` = ?,`id` = ? WHERE `id` = ? LIMIT 1")
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+// the columns of the history tables besides the ones of their base tables, the primary key of a history table
+// must be (_commit_ts, _seq), so the rows written again, e.g., after a restart, are ignored
+const (
+	HistoryCommitTSColumn = "_commit_ts"
+	HistorySeqColumn      = "_seq"
+	HistoryOpColumn       = "_op"
+)
+
+// DefaultHistorySuffix is appended to the names of the base tables for the names of their history tables
+const DefaultHistorySuffix = "__history"
+
+// the values of HistoryOpColumn, an update is recorded by the row before it and the row after it
+const (
+	HistoryOpInsert       = "insert"
+	HistoryOpUpdateBefore = "update-before"
+	HistoryOpUpdateAfter  = "update-after"
+	HistoryOpDelete       = "delete"
+)
+
+// HistoryMode is whether the changes of a table are applied to it besides recorded in its history table
+type HistoryMode string
+
+const (
+	// HistoryAlongside applies the changes to the base table and records them in the history table
+	HistoryAlongside HistoryMode = "alongside"
+	// HistoryOnly records the changes in the history table only, the base table isn't written
+	HistoryOnly HistoryMode = "only"
+)
+
+// HistoryTable records the changes of the table in an append-only history table in the same database, the empty
+// Mode is HistoryAlongside, and the empty Suffix is DefaultHistorySuffix.
+type HistoryTable struct {
+	Schema string      `toml:"db-name" json:"db-name"`
+	Table  string      `toml:"tbl-name" json:"tbl-name"`
+	Mode   HistoryMode `toml:"mode" json:"mode"`
+	Suffix string      `toml:"suffix" json:"suffix"`
+}
+
+func (h *HistoryTable) validate() error {
+	if len(h.Schema) == 0 || len(h.Table) == 0 {
+		return errors.Errorf("invalid history table %s, db-name and tbl-name must be set", quoteSchema(h.Schema, h.Table))
+	}
+	switch h.Mode {
+	case "", HistoryAlongside, HistoryOnly:
+	default:
+		return errors.Errorf("invalid history mode %s of %s, must be %s or %s", h.Mode, quoteSchema(h.Schema, h.Table),
+			HistoryAlongside, HistoryOnly)
+	}
+	return nil
+}
+
+// historyName returns the name of the history table
+func (h *HistoryTable) historyName() string {
+	if len(h.Suffix) == 0 {
+		return h.Table + DefaultHistorySuffix
+	}
+	return h.Table + h.Suffix
+}
+
+// HistoryTables makes loader record every change of the tables in their history tables, e.g., for auditing or
+// querying the rows at a time. An insert is recorded by the row inserted, an update by the rows before and after
+// it, and a delete by the row deleted, with the commit ts of the txn, the sequence in the txn and the op. The
+// history tables must be created in downstream with the columns of their base tables, and HistoryCommitTSColumn
+// (BIGINT), HistorySeqColumn (INT) and HistoryOpColumn (VARCHAR) as the primary key of the first two, without the
+// other unique keys. They're written as the append-only tables, see AppendOnlyTables. The DDLs of the base tables
+// aren't applied to the history tables.
+func HistoryTables(tables ...HistoryTable) Option {
+	return func(o *options) {
+		o.history = append(o.history, tables...)
+	}
+}
+
+// historyTables is the HistoryTables by the quoted base table names in lower case, nil means none
+type historyTables map[string]*HistoryTable
+
+func newHistoryTables(tables []HistoryTable) historyTables {
+	if len(tables) == 0 {
+		return nil
+	}
+	h := make(historyTables, len(tables))
+	for i := range tables {
+		h[strings.ToLower(quoteSchema(tables[i].Schema, tables[i].Table))] = &tables[i]
+	}
+	return h
+}
+
+// names returns the names of the history tables
+func (h historyTables) names() []filter.TableName {
+	names := make([]filter.TableName, 0, len(h))
+	for _, t := range h {
+		names = append(names, filter.TableName{Schema: t.Schema, Table: t.historyName()})
+	}
+	return names
+}
+
+// record appends the rows recording the DMLs of txn to their history tables, the DMLs of the tables recorded by
+// HistoryOnly are dropped
+func (h historyTables) record(txn *Txn) {
+	if len(h) == 0 || txn.isDDL() {
+		return
+	}
+
+	var rows []*DML
+	kept := txn.DMLs[:0]
+	for _, dml := range txn.DMLs {
+		t, ok := h[strings.ToLower(dml.TableName())]
+		if !ok {
+			kept = append(kept, dml)
+			continue
+		}
+		if t.Mode != HistoryOnly {
+			kept = append(kept, dml)
+		}
+		switch dml.Tp {
+		case InsertDMLType:
+			rows = append(rows, t.row(txn, len(rows), HistoryOpInsert, dml.Values))
+		case UpdateDMLType:
+			rows = append(rows, t.row(txn, len(rows), HistoryOpUpdateBefore, dml.OldValues))
+			rows = append(rows, t.row(txn, len(rows), HistoryOpUpdateAfter, dml.Values))
+		case DeleteDMLType:
+			rows = append(rows, t.row(txn, len(rows), HistoryOpDelete, dml.Values))
+		}
+	}
+	txn.DMLs = append(kept, rows...)
+}
+
+// row returns the insert of the row recording values in the history table
+func (h *HistoryTable) row(txn *Txn, seq int, op string, values map[string]interface{}) *DML {
+	row := make(map[string]interface{}, len(values)+3)
+	for name, v := range values {
+		row[name] = v
+	}
+	row[HistoryCommitTSColumn] = txn.CommitTS
+	row[HistorySeqColumn] = seq
+	row[HistoryOpColumn] = op
+	return NewInsert(h.Schema, h.historyName(), row)
+}
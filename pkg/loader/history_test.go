@@ -0,0 +1,74 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type historySuite struct{}
+
+var _ = Suite(&historySuite{})
+
+func (s *historySuite) TestInvalidHistory(c *C) {
+	c.Assert((&HistoryTable{Schema: "test"}).validate(), ErrorMatches, ".*db-name and tbl-name must be set.*")
+	c.Assert((&HistoryTable{Schema: "test", Table: "t", Mode: "both"}).validate(), ErrorMatches, ".*invalid history mode.*")
+	c.Assert((&HistoryTable{Schema: "test", Table: "t", Mode: HistoryOnly}).validate(), IsNil)
+}
+
+func (s *historySuite) TestRecord(c *C) {
+	h := newHistoryTables([]HistoryTable{
+		{Schema: "test", Table: "t"},
+		{Schema: "test", Table: "only", Mode: HistoryOnly, Suffix: "_log"},
+	})
+	insert := NewInsert("test", "t", map[string]interface{}{"id": 1})
+	update := NewUpdate("test", "only", map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2})
+	other := NewDelete("test", "other", map[string]interface{}{"id": 1})
+	txn := &Txn{CommitTS: 10, DMLs: []*DML{insert, update, other}}
+	h.record(txn)
+
+	c.Assert(txn.DMLs, HasLen, 5)
+	c.Assert(txn.DMLs[:2], DeepEquals, []*DML{insert, other})
+	c.Assert(txn.DMLs[2].TableName(), Equals, "`test`.`t__history`")
+	c.Assert(txn.DMLs[2].Values, DeepEquals, map[string]interface{}{
+		"id": 1, HistoryCommitTSColumn: int64(10), HistorySeqColumn: 0, HistoryOpColumn: HistoryOpInsert})
+	c.Assert(txn.DMLs[3].TableName(), Equals, "`test`.`only_log`")
+	c.Assert(txn.DMLs[3].Values, DeepEquals, map[string]interface{}{
+		"id": 1, HistoryCommitTSColumn: int64(10), HistorySeqColumn: 1, HistoryOpColumn: HistoryOpUpdateBefore})
+	c.Assert(txn.DMLs[4].Values, DeepEquals, map[string]interface{}{
+		"id": 2, HistoryCommitTSColumn: int64(10), HistorySeqColumn: 2, HistoryOpColumn: HistoryOpUpdateAfter})
+
+	// the rows recorded are copies
+	c.Assert(insert.Values, HasLen, 1)
+
+	var none historyTables
+	txn = &Txn{DMLs: []*DML{insert}}
+	none.record(txn)
+	c.Assert(txn.DMLs, HasLen, 1)
+}
+
+func (s *historySuite) TestAppendOnly(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, HistoryTables(HistoryTable{Schema: "test", Table: "t"}))
+	c.Assert(err, IsNil)
+	appendOnly, others, err := ld.(*loaderImpl).splitAppendOnly([]*DML{
+		NewInsert("test", "t__history", nil), NewInsert("test", "t", nil)})
+	c.Assert(err, IsNil)
+	c.Assert(appendOnly["`test`.`t__history`"], HasLen, 1)
+	c.Assert(others, HasLen, 1)
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+
+	"github.com/pingcap/errors"
+)
+
+// IsolationLevel is the transaction isolation level of the txns applying the DMLs in downstream, the names are
+// the values of the `transaction_isolation` variable of MySQL.
+type IsolationLevel string
+
+// the isolation levels supported
+const (
+	// IsolationReadCommitted takes no gap locks for the DMLs by unique keys, which avoids most of the deadlocks
+	// between the concurrent batches on MySQL
+	IsolationReadCommitted IsolationLevel = "READ-COMMITTED"
+	// IsolationRepeatableRead is the default of MySQL and TiDB
+	IsolationRepeatableRead IsolationLevel = "REPEATABLE-READ"
+)
+
+func (l IsolationLevel) validate() error {
+	switch l {
+	case "", IsolationReadCommitted, IsolationRepeatableRead:
+		return nil
+	}
+	return errors.Errorf("invalid isolation level: %s, must be %s or %s", l, IsolationReadCommitted, IsolationRepeatableRead)
+}
+
+// sqlLevel returns the level of database/sql, the default of the session is used if l is empty
+func (l IsolationLevel) sqlLevel() gosql.IsolationLevel {
+	switch l {
+	case IsolationReadCommitted:
+		return gosql.LevelReadCommitted
+	case IsolationRepeatableRead:
+		return gosql.LevelRepeatableRead
+	}
+	return gosql.LevelDefault
+}
+
+// Isolation makes loader begin each txn applying the DMLs at the isolation level, by a SET TRANSACTION statement
+// sent by the driver before the txn, regardless of the default of the downstream sessions. The DDLs are not affected.
+// By default the txns are at the isolation level of the sessions. TiDB only supports IsolationReadCommitted with
+// the pessimistic txns.
+func Isolation(level IsolationLevel) Option {
+	return func(o *options) {
+		o.isolation = level
+	}
+}
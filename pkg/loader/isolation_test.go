@@ -0,0 +1,57 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type isolationSuite struct{}
+
+var _ = Suite(&isolationSuite{})
+
+func (s *isolationSuite) TestValidate(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, Isolation("SERIALIZABLE"))
+	c.Assert(err, ErrorMatches, "invalid isolation level.*")
+	_, err = NewLoader(db, Isolation(IsolationReadCommitted))
+	c.Assert(err, IsNil)
+}
+
+func (s *isolationSuite) TestSQLLevel(c *C) {
+	c.Assert(IsolationLevel("").sqlLevel(), Equals, gosql.LevelDefault)
+	c.Assert(IsolationReadCommitted.sqlLevel(), Equals, gosql.LevelReadCommitted)
+	c.Assert(IsolationRepeatableRead.sqlLevel(), Equals, gosql.LevelRepeatableRead)
+}
+
+func (s *isolationSuite) TestBeginWithIsolation(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := newExecutor(db).withIsolation(IsolationReadCommitted.sqlLevel())
+	err = e.execStatements(nil, []Statement{{SQL: "DELETE FROM `db`.`tbl` WHERE `id` = ?", Args: []interface{}{1}}})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"fmt"
+
+	"github.com/pingcap/errors"
+)
+
+// kafkaCheckpoint saves the position of KafkaSource in the downstream, so it's saved only if the
+// downstream is available, and can be resumed from the downstream alone.
+// offset and commitTS are of the last binlog loaded, the binlogs with offset <= safeOffset may have been
+// fed to Loader, they're fed before safeOffset is saved, so safeOffset > offset means not all of them
+// are known to be loaded, they have to be loaded again in safe mode after restarting.
+type kafkaCheckpoint struct {
+	db       *gosql.DB
+	database string
+	table    string
+	topic    string
+}
+
+type kafkaPosition struct {
+	offset     int64
+	commitTS   int64
+	safeOffset int64
+}
+
+func newKafkaCheckpoint(db *gosql.DB, topic string) (*kafkaCheckpoint, error) {
+	cp := &kafkaCheckpoint{
+		db:       db,
+		database: "tidb_binlog",
+		table:    "kafka_source_checkpoint",
+		topic:    topic,
+	}
+
+	if err := cp.createSchemaIfNeed(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return cp, nil
+}
+
+func (c *kafkaCheckpoint) createSchemaIfNeed() error {
+	sql := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(c.database))
+	if _, err := c.db.Exec(sql); err != nil {
+		return errors.Trace(err)
+	}
+
+	sql = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+		topic_name VARCHAR(255) PRIMARY KEY, kafka_offset BIGINT NOT NULL, commit_ts BIGINT NOT NULL, safe_offset BIGINT NOT NULL)`,
+		quoteSchema(c.database, c.table))
+	if _, err := c.db.Exec(sql); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+func (c *kafkaCheckpoint) save(pos kafkaPosition) error {
+	sql := fmt.Sprintf("REPLACE INTO %s(topic_name, kafka_offset, commit_ts, safe_offset) VALUES(?,?,?,?)",
+		quoteSchema(c.database, c.table))
+	if _, err := c.db.Exec(sql, c.topic, pos.offset, pos.commitTS, pos.safeOffset); err != nil {
+		return errors.Annotatef(err, "save kafka checkpoint of %s", c.topic)
+	}
+	return nil
+}
+
+// load returns the saved position, it returns errors.NotFound if no checkpoint is saved
+func (c *kafkaCheckpoint) load() (pos kafkaPosition, err error) {
+	sql := fmt.Sprintf("SELECT kafka_offset, commit_ts, safe_offset FROM %s WHERE topic_name = ?",
+		quoteSchema(c.database, c.table))
+
+	err = c.db.QueryRow(sql, c.topic).Scan(&pos.offset, &pos.commitTS, &pos.safeOffset)
+	if err != nil {
+		if errors.Cause(err) == gosql.ErrNoRows {
+			return pos, errors.NotFoundf("kafka checkpoint of %s", c.topic)
+		}
+		return pos, errors.Trace(err)
+	}
+	return pos, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	"go.uber.org/zap"
+)
+
+var (
+	// make it possible to mock the kafka reader
+	newKafkaReader = reader.NewReader
+
+	// the safe offset is saved as offset + kafkaSafeOffsetLease before feeding the binlog whose
+	// offset > the safe offset saved, so it's saved once per kafkaSafeOffsetLease binlogs.
+	kafkaSafeOffsetLease int64 = 1024
+	// the position of the binlogs loaded is saved at most once per kafkaCheckpointInterval
+	kafkaCheckpointInterval = time.Second
+)
+
+// KafkaSource consumes the binlogs written to kafka by drainer(db-type = "kafka"), translates them
+// into txns and feeds them to a Loader, so the Loader can be used as a standalone downstream syncer.
+// The Metadata of the txns is the *reader.Message, the commit ts of the txns received from
+// Loader.Successes() can be saved as the checkpoint, and passed as reader.Config.CommitTS to resume.
+// Or use NewKafkaSourceWithCheckpoint to save the checkpoint in the downstream.
+type KafkaSource struct {
+	reader   *reader.Reader
+	messages <-chan *reader.Message
+	logger   FieldLogger
+
+	// nil means the checkpoint is disabled
+	checkpoint *kafkaCheckpoint
+	// pos is the position saved, protected by posMu
+	pos   kafkaPosition
+	posMu sync.Mutex
+	// the txns with offset <= safeUntil are loaded in safe mode, -1 means none
+	safeUntil int64
+	// the offset of the last binlog fed to Loader, -1 means none
+	fedOffset int64
+	// the commit ts of the last binlog received
+	receivedTS int64
+
+	closeOnce sync.Once
+}
+
+// NewKafkaSource creates a KafkaSource reading the binlogs with commit ts > cfg.CommitTS,
+// a nil logger means the global logger.
+func NewKafkaSource(cfg *reader.Config, logger FieldLogger) (*KafkaSource, error) {
+	r, err := newKafkaReader(cfg)
+	if err != nil {
+		return nil, errors.Annotate(err, "create kafka reader failed")
+	}
+
+	return &KafkaSource{
+		reader:     r,
+		messages:   r.Messages(),
+		logger:     logger,
+		safeUntil:  -1,
+		fedOffset:  -1,
+		receivedTS: cfg.CommitTS,
+	}, nil
+}
+
+// NewKafkaSourceWithCheckpoint creates a KafkaSource saving the position of the binlogs loaded in the
+// downstream db, and resuming from it if it's found, cfg.Offset and cfg.CommitTS are used otherwise.
+// The binlogs are loaded exactly once across restarts: the position is saved only after the binlogs
+// are committed in the downstream, and the binlogs which may have been loaded before restarting but
+// are not covered by the position saved are loaded again in safe mode, which is idempotent.
+func NewKafkaSourceWithCheckpoint(cfg *reader.Config, db *gosql.DB, logger FieldLogger) (*KafkaSource, error) {
+	if len(cfg.Topic) == 0 {
+		return nil, errors.New("topic must be set to save the checkpoint")
+	}
+
+	cp, err := newKafkaCheckpoint(db, cfg.Topic)
+	if err != nil {
+		return nil, errors.Annotate(err, "create kafka checkpoint failed")
+	}
+
+	pos := kafkaPosition{offset: -1, commitTS: cfg.CommitTS, safeOffset: -1}
+	safeUntil := int64(-1)
+	readerCfg := *cfg
+	loaded, err := cp.load()
+	if err == nil {
+		pos = loaded
+		if pos.safeOffset > pos.offset {
+			safeUntil = pos.safeOffset
+		}
+		readerCfg.Offset = pos.offset + 1
+		readerCfg.CommitTS = 0
+	} else if !errors.IsNotFound(err) {
+		return nil, errors.Annotate(err, "load kafka checkpoint failed")
+	}
+	defaultLogger(logger).Info("resume kafka source", zap.String("topic", cfg.Topic), zap.Int64("offset", readerCfg.Offset),
+		zap.Int64("commit ts", pos.commitTS), zap.Int64("safe mode until offset", safeUntil))
+
+	s, err := NewKafkaSource(&readerCfg, logger)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.checkpoint = cp
+	s.pos = pos
+	s.safeUntil = safeUntil
+	s.receivedTS = pos.commitTS
+
+	return s, nil
+}
+
+func (s *KafkaSource) getLogger() FieldLogger {
+	return defaultLogger(s.logger)
+}
+
+// Run feeds the txns to ld until the source is closed or ctx is done, ld is closed when it returns,
+// so ld.Run() returns after the txns fed are loaded. The binlogs replayed by kafka are skipped.
+// If the checkpoint is enabled, Run consumes ld.Successes() to save the position of the binlogs
+// loaded, and returns after ld.Run() returns. Cancel ctx if ld.Run() fails, or Run may be blocked.
+func (s *KafkaSource) Run(ctx context.Context, ld Loader) error {
+	if s.checkpoint == nil {
+		return errors.Trace(s.feed(ctx, ld))
+	}
+
+	safeMode := ld.GetSafeMode()
+	if s.safeUntil >= 0 {
+		ld.SetSafeMode(true)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.saveCheckpoints(ld, safeMode)
+	}()
+
+	err := s.feed(ctx, ld)
+	wg.Wait()
+	return errors.Trace(err)
+}
+
+func (s *KafkaSource) feed(ctx context.Context, ld Loader) error {
+	dest := ld.Input()
+	defer ld.Close()
+
+	for {
+		var msg *reader.Message
+		var ok bool
+		select {
+		case msg, ok = <-s.messages:
+			if !ok {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+
+		logger := withFields(s.getLogger(), zap.Int64("commit ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
+		logger.Debug("recv msg from kafka reader")
+
+		if msg.Binlog.CommitTs <= s.receivedTS {
+			logger.Info("skip repeated binlog")
+			continue
+		}
+		s.receivedTS = msg.Binlog.CommitTs
+
+		txn, err := SlaveBinlogToTxn(msg.Binlog)
+		if err != nil {
+			return errors.Annotatef(err, "translate binlog at offset %d", msg.Offset)
+		}
+		txn.Metadata = msg
+
+		if err := s.extendSafeOffset(msg.Offset); err != nil {
+			return errors.Trace(err)
+		}
+
+		select {
+		case dest <- txn:
+			atomic.StoreInt64(&s.fedOffset, msg.Offset)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// extendSafeOffset saves a larger safe offset before the binlog at offset is fed if it's not covered
+func (s *KafkaSource) extendSafeOffset(offset int64) error {
+	if s.checkpoint == nil {
+		return nil
+	}
+
+	s.posMu.Lock()
+	defer s.posMu.Unlock()
+
+	if offset <= s.pos.safeOffset {
+		return nil
+	}
+	pos := s.pos
+	pos.safeOffset = offset + kafkaSafeOffsetLease
+	if err := s.checkpoint.save(pos); err != nil {
+		return errors.Trace(err)
+	}
+	s.pos = pos
+	return nil
+}
+
+// saveCheckpoints saves the position of the txns loaded until ld.Successes() is closed,
+// and restores the safe mode of ld after the txns may have been loaded before are loaded again.
+func (s *KafkaSource) saveCheckpoints(ld Loader, safeMode bool) {
+	var lastSaveTime time.Time
+	for txn := range ld.Successes() {
+		msg := txn.Metadata.(*reader.Message)
+
+		s.posMu.Lock()
+		s.pos.offset = msg.Offset
+		s.pos.commitTS = msg.Binlog.CommitTs
+		if time.Since(lastSaveTime) >= kafkaCheckpointInterval {
+			// the position not saved is covered by the safe offset, it's fine to save it next time
+			if err := s.checkpoint.save(s.pos); err != nil {
+				s.getLogger().Warn("save kafka checkpoint failed", zap.Int64("offset", msg.Offset), zap.Error(err))
+			} else {
+				lastSaveTime = time.Now()
+			}
+		}
+		s.posMu.Unlock()
+
+		if s.safeUntil >= 0 && msg.Offset >= s.safeUntil {
+			s.getLogger().Info("the binlogs may have been loaded are loaded again, restore safe mode",
+				zap.Int64("offset", msg.Offset), zap.Bool("safe mode", safeMode))
+			ld.SetSafeMode(safeMode)
+			s.safeUntil = -1
+		}
+	}
+
+	s.posMu.Lock()
+	defer s.posMu.Unlock()
+	// no binlog is fed but not loaded, so no binlog has to be loaded in safe mode after restarting
+	if s.pos.offset == atomic.LoadInt64(&s.fedOffset) {
+		s.pos.safeOffset = s.pos.offset
+	}
+	if err := s.checkpoint.save(s.pos); err != nil {
+		s.getLogger().Error("save kafka checkpoint failed", zap.Int64("offset", s.pos.offset), zap.Error(err))
+	}
+}
+
+// Close stops reading from kafka, Run returns after the messages read are fed.
+func (s *KafkaSource) Close() {
+	s.closeOnce.Do(func() {
+		if s.reader != nil {
+			s.reader.Close()
+		}
+	})
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+type kafkaSourceSuite struct{}
+
+var _ = Suite(&kafkaSourceSuite{})
+
+type inputLoader struct {
+	Loader
+	input  chan *Txn
+	closed bool
+}
+
+func (l *inputLoader) Input() chan<- *Txn {
+	return l.input
+}
+
+func (l *inputLoader) Close() {
+	l.closed = true
+}
+
+func newDDLMessage(commitTS int64, offset int64) *reader.Message {
+	db, table := "test", "t"
+	return &reader.Message{
+		Offset: offset,
+		Binlog: &pb.Binlog{
+			Type:     pb.BinlogType_DDL,
+			CommitTs: commitTS,
+			DdlData:  &pb.DDLData{SchemaName: &db, TableName: &table, DdlQuery: []byte("create table t(id int)")},
+		},
+	}
+}
+
+func (s *kafkaSourceSuite) TestNewKafkaSource(c *C) {
+	orig := newKafkaReader
+	defer func() { newKafkaReader = orig }()
+	newKafkaReader = func(cfg *reader.Config) (*reader.Reader, error) {
+		return nil, errors.New("no kafka")
+	}
+
+	_, err := NewKafkaSource(&reader.Config{Topic: "test"}, nil)
+	c.Assert(err, ErrorMatches, "create kafka reader failed: no kafka")
+}
+
+func (s *kafkaSourceSuite) TestRun(c *C) {
+	messages := make(chan *reader.Message, 10)
+	messages <- newDDLMessage(1, 0)
+	messages <- newDDLMessage(2, 1)
+	// replayed by kafka
+	messages <- newDDLMessage(1, 2)
+	messages <- newDDLMessage(3, 3)
+	close(messages)
+
+	ld := &inputLoader{input: make(chan *Txn, 10)}
+	source := &KafkaSource{messages: messages}
+	err := source.Run(context.Background(), ld)
+	c.Assert(err, IsNil)
+	c.Assert(ld.closed, IsTrue)
+
+	close(ld.input)
+	var offsets []int64
+	for txn := range ld.input {
+		c.Assert(txn.DDL.SQL, Equals, "create table t(id int)")
+		offsets = append(offsets, txn.Metadata.(*reader.Message).Offset)
+	}
+	c.Assert(offsets, DeepEquals, []int64{0, 1, 3})
+	source.Close()
+}
+
+func (s *kafkaSourceSuite) TestRunCanceled(c *C) {
+	messages := make(chan *reader.Message, 10)
+	messages <- newDDLMessage(1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ld := &inputLoader{input: make(chan *Txn)}
+	source := &KafkaSource{messages: messages}
+
+	done := make(chan error)
+	go func() {
+		done <- source.Run(ctx, ld)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		c.Assert(err, IsNil)
+		c.Assert(ld.closed, IsTrue)
+	case <-time.After(time.Second):
+		c.Fatal("Run doesn't return after ctx is canceled")
+	}
+}
+
+type successLoader struct {
+	Loader
+	input     chan *Txn
+	successes chan *Txn
+	safeMode  int32
+	// the safe mode when each txn is loaded
+	loadedSafe []bool
+}
+
+func newSuccessLoader() *successLoader {
+	l := &successLoader{input: make(chan *Txn), successes: make(chan *Txn)}
+	go func() {
+		for txn := range l.input {
+			l.loadedSafe = append(l.loadedSafe, l.GetSafeMode())
+			l.successes <- txn
+		}
+		close(l.successes)
+	}()
+	return l
+}
+
+func (l *successLoader) Input() chan<- *Txn {
+	return l.input
+}
+
+func (l *successLoader) Successes() <-chan *Txn {
+	return l.successes
+}
+
+func (l *successLoader) Close() {
+	close(l.input)
+}
+
+func (l *successLoader) SetSafeMode(safe bool) {
+	var v int32
+	if safe {
+		v = 1
+	}
+	atomic.StoreInt32(&l.safeMode, v)
+}
+
+func (l *successLoader) GetSafeMode() bool {
+	return atomic.LoadInt32(&l.safeMode) == 1
+}
+
+func newDMLMessage(commitTS int64, offset int64) *reader.Message {
+	msg := newDDLMessage(commitTS, offset)
+	msg.Binlog.Type = pb.BinlogType_DML
+	msg.Binlog.DdlData = nil
+	msg.Binlog.DmlData = &pb.DMLData{}
+	return msg
+}
+
+func expectKafkaCheckpointSchema(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `tidb_binlog`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `tidb_binlog`.`kafka_source_checkpoint`").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func (s *kafkaSourceSuite) TestNewKafkaSourceWithCheckpoint(c *C) {
+	var readerCfg *reader.Config
+	orig := newKafkaReader
+	defer func() { newKafkaReader = orig }()
+	newKafkaReader = func(cfg *reader.Config) (*reader.Reader, error) {
+		readerCfg = cfg
+		return &reader.Reader{}, nil
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewKafkaSourceWithCheckpoint(&reader.Config{}, db, nil)
+	c.Assert(err, ErrorMatches, "topic must be set.*")
+
+	// no checkpoint, the config is used
+	expectKafkaCheckpointSchema(mock)
+	mock.ExpectQuery("SELECT kafka_offset, commit_ts, safe_offset FROM `tidb_binlog`.`kafka_source_checkpoint`").
+		WithArgs("test").WillReturnRows(sqlmock.NewRows([]string{"kafka_offset", "commit_ts", "safe_offset"}))
+	source, err := NewKafkaSourceWithCheckpoint(&reader.Config{Topic: "test", CommitTS: 42}, db, nil)
+	c.Assert(err, IsNil)
+	c.Assert(readerCfg.CommitTS, Equals, int64(42))
+	c.Assert(source.safeUntil, Equals, int64(-1))
+	c.Assert(source.receivedTS, Equals, int64(42))
+
+	// resume from the checkpoint
+	expectKafkaCheckpointSchema(mock)
+	mock.ExpectQuery("SELECT kafka_offset, commit_ts, safe_offset").WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"kafka_offset", "commit_ts", "safe_offset"}).AddRow(10, 100, 20))
+	source, err = NewKafkaSourceWithCheckpoint(&reader.Config{Topic: "test", CommitTS: 42}, db, nil)
+	c.Assert(err, IsNil)
+	c.Assert(readerCfg.Offset, Equals, int64(11))
+	c.Assert(readerCfg.CommitTS, Equals, int64(0))
+	c.Assert(source.safeUntil, Equals, int64(20))
+	c.Assert(source.receivedTS, Equals, int64(100))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *kafkaSourceSuite) TestRunWithCheckpoint(c *C) {
+	origLease, origInterval := kafkaSafeOffsetLease, kafkaCheckpointInterval
+	defer func() { kafkaSafeOffsetLease, kafkaCheckpointInterval = origLease, origInterval }()
+	kafkaSafeOffsetLease, kafkaCheckpointInterval = 100, time.Hour
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the binlogs with offset <= 12 may have been loaded before restarting
+	source := &KafkaSource{
+		checkpoint: &kafkaCheckpoint{db: db, database: "tidb_binlog", table: "kafka_source_checkpoint", topic: "test"},
+		pos:        kafkaPosition{offset: 10, commitTS: 100, safeOffset: 12},
+		safeUntil:  12,
+		fedOffset:  -1,
+		receivedTS: 100,
+	}
+	messages := make(chan *reader.Message, 10)
+	messages <- newDMLMessage(101, 11)
+	messages <- newDMLMessage(102, 12)
+	messages <- newDMLMessage(103, 13)
+	close(messages)
+	source.messages = messages
+
+	replace := "REPLACE INTO `tidb_binlog`.`kafka_source_checkpoint`"
+	// saved after the first txn is loaded, and the safe offset is extended to 113 before feeding
+	// the binlog at offset 13, in any order
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(replace).WithArgs("test", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	// all the binlogs fed are loaded
+	mock.ExpectExec(replace).WithArgs("test", 13, 103, 13).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ld := newSuccessLoader()
+	err = source.Run(context.Background(), ld)
+	c.Assert(err, IsNil)
+	c.Assert(ld.loadedSafe, HasLen, 3)
+	c.Assert(ld.loadedSafe[:2], DeepEquals, []bool{true, true})
+	c.Assert(ld.GetSafeMode(), IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
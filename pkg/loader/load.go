@@ -17,13 +17,18 @@ import (
 	"context"
 	gosql "database/sql"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
 	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -45,6 +50,7 @@ var (
 	execDDLRetryWait            = time.Second
 	fNewBatchManager            = newBatchManager
 	fGetAppliedTS               = getAppliedTS
+	fGetGTIDExecuted            = getGTIDExecuted
 	updateLastAppliedTSInterval = time.Minute
 )
 
@@ -52,8 +58,37 @@ var (
 type Loader interface {
 	SetSafeMode(bool)
 	GetSafeMode() bool
+	// SetWorkerCount and SetBatchSize take effect between txns, no need to restart Loader
+	SetWorkerCount(int)
+	SetBatchSize(int)
+	// Input receives the txns to load, close the Loader instead of the channel when no more txns
 	Input() chan<- *Txn
+	// Successes returns the txns loaded in the order they're input, so the position of the last one can
+	// be saved as the checkpoint, it must be consumed and is closed when Run returns
 	Successes() <-chan *Txn
+	// TableStatus returns the replication status of the tables loaded
+	TableStatus() []TableStatus
+	// PauseTable stops applying the DMLs of the table while the other tables continue, they're buffered in memory
+	// until ResumeTable, which applies them before the later DMLs of the table. The txns having any DML buffered and
+	// the ones after them are reported by Successes after the DMLs are applied, so the txns of the paused table are
+	// not applied atomically with the other tables. A DDL of the table resumes it, and the tables paused are resumed
+	// when the Loader is closed. They're marked by TableStatus.Paused until their DMLs buffered are applied.
+	PauseTable(database string, table string)
+	ResumeTable(database string, table string)
+	// CopySnapshot copies the rows of the tables from the snapshot of the upstream TiDB at ts into the downstream,
+	// and hands them off to the txns input, so the tables added to a task are synced without an external dumper.
+	// The tables are paused while copying, then their DMLs committed after ts are applied, and the ones not after
+	// ts are dropped. ts 0 means the current ts of upstream, the ts used is returned. The tables are kept paused
+	// if it fails, call it again with the ts returned to retry, and no DDL of them is allowed while copying.
+	CopySnapshot(ctx context.Context, upstream *gosql.DB, ts int64, tables ...filter.TableName) (int64, error)
+	// Flush returns after the txns input before it are committed in the downstream, appliedTS is the
+	// CommitTS of the last txn loaded. It must not be called after Close, and Run must be running.
+	Flush(ctx context.Context) (appliedTS int64, err error)
+	// Watermark returns the progress of the txns applied, see OnWatermark to be called back when it advances
+	Watermark() Watermark
+	// SubscribeWatermark returns a channel receiving the latest watermark each time it advances, starting with the
+	// current one, the ones not received before the next are dropped. Call cancel to unsubscribe, which closes it.
+	SubscribeWatermark() (ch <-chan Watermark, cancel func())
 	Close()
 	Run() error
 }
@@ -62,13 +97,29 @@ var _ Loader = &loaderImpl{}
 
 type loaderImpl struct {
 	// we can get table info from downstream db
-	// like column name, pk & uk
-	db *gosql.DB
+	// like column name, pk & uk, use getDB to read it as it's replaced by reconnect, dbMu protects it
+	dbMu sync.RWMutex
+	db   *gosql.DB
+	// the db passed by NewLoader, which is closed by the caller,
+	// db will be replaced by a new one if the connection is reopened by supervisor.
+	originDB   *gosql.DB
+	supervisor *connSupervisor
 
 	tableInfos sync.Map
 
+	tableStatus tableStatusTracker
+	// the CommitTS of the last txn loaded, only accessed in Run
+	appliedTS int64
+	// nil means not tracked, see Watermark
+	watermark *watermarkTracker
+
 	batchSize   int
 	workerCount int
+	// see SplitWorkerCount
+	splitWorkerCount int
+	// set by SetBatchSize and SetWorkerCount, applied in Run between txns
+	pendingBatchSize   int32
+	pendingWorkerCount int32
 
 	input      chan *Txn
 	successTxn chan *Txn
@@ -86,17 +137,116 @@ type loaderImpl struct {
 	// value can be tidb or mysql
 	saveAppliedTS           bool
 	lastUpdateAppliedTSTime time.Time
+	// see CaptureGTID
+	captureGTID bool
+
+	slowBatchThreshold time.Duration
+
+	// nil means the global logger
+	logger FieldLogger
+
+	transforms []Transform
+	// validate the DMLs against the table info of downstream before executing
+	validateDMLs bool
+	// nil means the missing tables are not created
+	tableCreator TableCreator
+	// the downstream is TiDB with TiDBSessionVars set
+	tidbMode bool
+	// the extra connections beyond workerCount and the lifetime of the connections, see ConnPool
+	connHeadroom    int
+	connMaxLifetime time.Duration
+	// 0 means the downstream is not pinged
+	pingInterval time.Duration
+	// the values longer than it are written in chunks, 0 means disabled
+	chunkSize int
+	// the max DMLs committed in one downstream txn and the max delay waiting for more txns, see GroupCommit
+	groupCommitSize  int
+	groupCommitDelay time.Duration
+	// nil means the barriers are not reported
+	onBarrier func(Barrier)
+	// the hints added to the DML statements, see StatementHints
+	hints []StatementHint
+	// see ApplySemantics
+	semantics []TableSemantics
+	// see ConflictResolution
+	conflictSource string
+	conflicts      []TableConflict
+	// see VirtualColumns
+	virtualColumns []VirtualColumn
+	// see HistoryTables
+	history historyTables
+	// see SoftDeletes
+	softDeletes []SoftDelete
+	// see BulkImport
+	bulkImport bool
+	// buffers the DMLs of the tables paused, see PauseTable
+	pause *tablePause
+	// drops the DMLs of the tables copied from the snapshots, see CopySnapshot
+	snapshots *snapshotTables
+	// the worker count and batch size of copying the snapshots, they're not changed by SetWorkerCount and
+	// SetBatchSize, which are applied by Run
+	snapshotWorkers   int
+	snapshotChunkSize int
+	// nil means the txns applied are not marked, see LoopbackSync
+	loopbackSync *loopbacksync.LoopBackSync
+	// the sequence of the txns marked, only accessed atomically
+	markSeq int64
+	// the names of the append-only tables in lower case, see AppendOnlyTables
+	appendOnlyTables map[string]struct{}
+	// nil means the dedup is disabled
+	dedup *dedupWindow
+	// see NoKeyTables
+	noKeyPolicy NoKeyTablePolicy
+	// empty means the txns of a group commit are not separated by savepoints, see GroupCommitSavepoints
+	savepointPolicy SavepointPolicy
+	// nil means the affected rows are not checked, see VerifyAffectedRows
+	rowsCheck *rowsCheck
+	// nil means the fencing is disabled, see Fencing
+	fence *fence
+	// nil means the txns failing to commit aren't probed, see ProbeCommit
+	probe *commitProbe
+	// see Isolation
+	isolation IsolationLevel
+	// see DigestBatch
+	digestBatchSize int
+	// nil means the multi-statement queries are available, see MultiStatements
+	multiStatements *multiStatements
+	// empty means the columns of the DMLs are not checked, see OnSchemaMismatch
+	schemaMismatchPolicy SchemaMismatchPolicy
+	// nil means the small txns are never pulled forward, see PriorityLane
+	priority *priorityLane
+	// warm up the downstream before applying any txn, see Warmup
+	warmupEnabled bool
+	warmupTables  []filter.TableName
+	// the stats are exported every statsInterval if it's positive, see ExportStats
+	statsSchema     string
+	statsInterval   time.Duration
+	statsExportTime time.Time
+	// the status of the tables at the last export, keyed by the quoted table names
+	statsExported map[string]TableStatus
+	// the names of the tables without key warned by NoKeyTableWarn
+	noKeyWarned sync.Map
 
 	// TODO: remove this ctx, context shouldn't stored in struct
 	// https://github.com/pingcap/tidb-binlog/pull/691#issuecomment-515387824
 	ctx    context.Context
 	cancel context.CancelFunc
+	// closed when Run returns
+	done chan struct{}
 }
 
 // MetricsGroup contains metrics of Loader
 type MetricsGroup struct {
 	EventCounterVec   *prometheus.CounterVec
 	QueryHistogramVec *prometheus.HistogramVec
+	// ConflictCounterVec counts the deadlock, lock wait timeout and write conflict errors, labeled by "type"
+	ConflictCounterVec *prometheus.CounterVec
+	// DriftCounterVec counts the updates and deletes not affecting exactly one row, labeled by "type",
+	// see VerifyAffectedRows
+	DriftCounterVec *prometheus.CounterVec
+	// TxnLatencyHistogram observes the seconds from the upstream commit time derived from the commit ts
+	// to the commit in downstream of each txn applied, i.e., the end-to-end latency
+	TxnLatencyHistogram prometheus.Histogram
 }
 
 type options struct {
@@ -104,6 +254,60 @@ type options struct {
 	batchSize     int
 	metrics       *MetricsGroup
 	saveAppliedTS bool
+	safeMode      bool
+	dbOpener      DBOpener
+	addrs         []string
+	logger        FieldLogger
+	transforms    []Transform
+	dedupWindow   int
+	validateDMLs  bool
+	tableCreator  TableCreator
+	tidbMode      bool
+	appendOnly    []filter.TableName
+
+	slowBatchThreshold time.Duration
+
+	connHeadroom    int
+	connMaxLifetime time.Duration
+	pingInterval    time.Duration
+	chunkSize       int
+
+	groupCommitSize  int
+	groupCommitDelay time.Duration
+	onBarrier        func(Barrier)
+	hints            []StatementHint
+	semantics        []TableSemantics
+	conflictSource   string
+	conflicts        []TableConflict
+	virtualColumns   []VirtualColumn
+	history          []HistoryTable
+	softDeletes      []SoftDelete
+	bulkImport       bool
+	pauseBufferSize  int
+	loopbackSync     *loopbacksync.LoopBackSync
+	noKeyPolicy      NoKeyTablePolicy
+	savepointPolicy  SavepointPolicy
+	rowsCheckPolicy  RowsCheckPolicy
+	statsSchema      string
+	statsInterval    time.Duration
+	fenceSchema      string
+	fenceName        string
+	fenceOwner       string
+	fenceLease       time.Duration
+	probeSchema      string
+	probeName        string
+	isolation        IsolationLevel
+	captureGTID      bool
+	digestBatchSize  int
+	splitWorkerCount int
+	singleStatements bool
+	onWatermark      func(Watermark)
+
+	prioritySmallTxnSize int
+	schemaMismatchPolicy SchemaMismatchPolicy
+
+	warmup       bool
+	warmupTables []filter.TableName
 }
 
 var defaultLoaderOptions = options{
@@ -111,6 +315,12 @@ var defaultLoaderOptions = options{
 	batchSize:     20,
 	metrics:       nil,
 	saveAppliedTS: false,
+
+	connHeadroom:    defaultConnHeadroom,
+	connMaxLifetime: defaultConnMaxLifetime,
+	pingInterval:    defaultPingInterval,
+	noKeyPolicy:     NoKeyTableDegrade,
+	pauseBufferSize: defaultPauseBufferSize,
 }
 
 // A Option sets options such batch size, worker count etc.
@@ -130,6 +340,23 @@ func BatchSize(n int) Option {
 	}
 }
 
+// SplitWorkerCount limits the splits of batch size executed concurrently for the DMLs of a table merged by
+// primary key to n, e.g., a large txn or a batch of many txns of a table is split into many bulk statements,
+// which are executed by as many goroutines and connections without it, and may exceed the connection limit
+// of downstream. It's unlimited if n is 0.
+func SplitWorkerCount(n int) Option {
+	return func(o *options) {
+		o.splitWorkerCount = n
+	}
+}
+
+// SafeMode set the initial safe mode of loader, it can be changed by Loader.SetSafeMode at run time
+func SafeMode(safe bool) Option {
+	return func(o *options) {
+		o.safeMode = safe
+	}
+}
+
 // SaveAppliedTS set downstream type, values can be tidb or mysql
 func SaveAppliedTS(save bool) Option {
 	return func(o *options) {
@@ -137,6 +364,169 @@ func SaveAppliedTS(save bool) Option {
 	}
 }
 
+// CaptureGTID makes loader read the GTID set executed in the downstream MySQL after each batch is committed, and
+// set it to Txn.GTIDSet of the last txn of the batch, so the position of the downstream can be saved with the
+// checkpoint and another replication chained off the downstream can be coordinated with the upstream commit ts.
+// The GTID set includes the txns reported before, and it may include the writes of the others to downstream.
+func CaptureGTID(capture bool) Option {
+	return func(o *options) {
+		o.captureGTID = capture
+	}
+}
+
+// SlowBatchThreshold makes loader log the batch taking longer than threshold to execute,
+// with the table, batch size, statement digest and thread id of the downstream connection.
+// It's disabled if threshold is 0.
+func SlowBatchThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowBatchThreshold = threshold
+	}
+}
+
+// Reconnect makes loader reopen the connection by `open` when the connection to downstream is broken,
+// `addrs` are tried in order, so loader fails over among them if more than one address is given,
+// e.g., a proxy followed by the replicas.
+func Reconnect(open DBOpener, addrs ...string) Option {
+	return func(o *options) {
+		o.dbOpener = open
+		o.addrs = addrs
+	}
+}
+
+// ConnPool sizes the connection pool of the downstream db to the worker count plus headroom, both the
+// max open and max idle connections, so the connections are reused instead of being closed and reopened
+// between batches. The connections are recycled after maxLifetime, which should be shorter than the
+// idle timeout of the downstream and the proxies in between, 0 means they're reused forever.
+func ConnPool(headroom int, maxLifetime time.Duration) Option {
+	return func(o *options) {
+		o.connHeadroom = headroom
+		o.connMaxLifetime = maxLifetime
+	}
+}
+
+// PingInterval makes loader ping the downstream every interval when no txn is loaded, so the broken
+// connections are detected and discarded before they're used by txns. It's disabled if interval is 0.
+func PingInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pingInterval = interval
+	}
+}
+
+// LargeValueChunkSize makes loader write the string and []byte values longer than size, e.g., the huge
+// BLOB and TEXT values, in chunks of size by appending them with CONCAT one by one after the row is written,
+// so the statements don't exceed the max_allowed_packet of downstream. The rows must be identified by a
+// unique key without the large columns. The DMLs of the tables having large values are executed one by
+// one instead of by the bulk statements, except the ones of AppendOnlyTables.
+// It's disabled if size is 0.
+func LargeValueChunkSize(size int) Option {
+	return func(o *options) {
+		o.chunkSize = size
+	}
+}
+
+// GroupCommit makes loader commit the DMLs of many small txns in one downstream txn, up to maxDMLs DMLs,
+// waiting at most maxDelay after the first txn for more txns to come, which saves the commits of the
+// downstream for the workloads of tiny txns, e.g., the single-row txns. The statements of the group are
+// executed one after another in the txn instead of by the workers concurrently, the txns having more than
+// maxDMLs DMLs are executed as usual. It's disabled if maxDMLs is 0.
+func GroupCommit(maxDMLs int, maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.groupCommitSize = maxDMLs
+		o.groupCommitDelay = maxDelay
+	}
+}
+
+// BarrierCallback makes loader call f on each barrier emitted before a DDL, after the table info is
+// refreshed by a DDL and on a Flush, when all the txns input before the barrier have been committed in
+// downstream and none after it has been executed. f is called in Run, it must not block.
+func BarrierCallback(f func(Barrier)) Option {
+	return func(o *options) {
+		o.onBarrier = f
+	}
+}
+
+// StatementHints makes loader add the hints to the DML statements of the tables matched, right after the
+// INSERT/REPLACE/UPDATE/DELETE keyword, where the optimizer hints take effect. E.g., the optimizer hints working
+// around the bad plans of downstream, or a comment marking the replicated traffic so the downstream, its audit
+// logs and the tools reading its statements, e.g., the other direction of a bidirectional sync, can identify it.
+// The hint of the most specific StatementHint is used for each table.
+func StatementHints(hints ...StatementHint) Option {
+	return func(o *options) {
+		o.hints = append(o.hints, hints...)
+	}
+}
+
+// LoopbackSync makes loader mark each txn it applies by writing the mark table of loopbacksync in the txn
+// if info.LoopbackControl is true, so the drainer capturing the changes of downstream can skip the txns,
+// which prevents the changes from being echoed back in a bidirectional sync. The mark table is created
+// when Run starts. The DDLs are not marked.
+func LoopbackSync(info *loopbacksync.LoopBackSync) Option {
+	return func(o *options) {
+		o.loopbackSync = info
+	}
+}
+
+// Logger set the logger of loader, the logs of loader carry the fields of logger, e.g., the task id
+// in a multi-task deployment, so they can be told apart. It can be a *zap.Logger or any FieldLogger,
+// the global logger is used by default.
+func Logger(logger FieldLogger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// Transforms set the transforms applied to each DML before it's executed, in order
+func Transforms(fs ...Transform) Option {
+	return func(o *options) {
+		o.transforms = append(o.transforms, fs...)
+	}
+}
+
+// DedupWindow set the number of the latest DMLs remembered to skip the ones delivered again,
+// which is needed if the txns may be replayed, e.g., the upstream delivers at least once. 0 means disabled.
+// The DMLs are identified by the commit ts of txn, so the txns must have the CommitTS set.
+func DedupWindow(size int) Option {
+	return func(o *options) {
+		o.dedupWindow = size
+	}
+}
+
+// ValidateDMLs makes loader check the DMLs against the table info of downstream before executing them:
+// the columns must exist, the not null columns without default value must be set for insert, and the
+// primary key must be set for update and delete. An invalid DML makes Run return an error naming the
+// table and the column, instead of failing in the middle of a batch.
+func ValidateDMLs(validate bool) Option {
+	return func(o *options) {
+		o.validateDMLs = validate
+	}
+}
+
+// AutoCreateTable makes loader create the table by the statement returned by `create` when the
+// table of a DML doesn't exist in downstream, the database is created too if it doesn't exist.
+// It's useful when loading into an empty database without the schema dumped.
+func AutoCreateTable(create TableCreator) Option {
+	return func(o *options) {
+		o.tableCreator = create
+	}
+}
+
+// OptimizeForTiDB makes loader optimized for a TiDB downstream, whose sessions must have TiDBSessionVars set,
+// the write conflicts and region errors expected with optimistic txns are retried with a short backoff.
+func OptimizeForTiDB(optimize bool) Option {
+	return func(o *options) {
+		o.tidbMode = optimize
+	}
+}
+
+// AppendOnlyTables declares the tables which are only inserted into, e.g., the event or log tables,
+// their rows are inserted by multi-row INSERT IGNORE without merging, regardless of the safe mode.
+// An update or delete of them makes Run return an error.
+func AppendOnlyTables(tables ...filter.TableName) Option {
+	return func(o *options) {
+		o.appendOnly = append(o.appendOnly, tables...)
+	}
+}
+
 // Metrics set metrics of loader
 func Metrics(m *MetricsGroup) Option {
 	return func(o *options) {
@@ -152,10 +542,78 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 		o(&opts)
 	}
 
+	for i := range opts.hints {
+		if err := opts.hints[i].validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for i := range opts.semantics {
+		if err := opts.semantics[i].validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for i := range opts.conflicts {
+		if err := opts.conflicts[i].validate(opts.conflictSource); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for i := range opts.virtualColumns {
+		if err := opts.virtualColumns[i].validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for i := range opts.history {
+		if err := opts.history[i].validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for i := range opts.softDeletes {
+		if err := opts.softDeletes[i].validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if err := opts.noKeyPolicy.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := opts.savepointPolicy.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := opts.rowsCheckPolicy.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := opts.schemaMismatchPolicy.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := opts.isolation.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := validateBulkImport(opts); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if opts.pauseBufferSize <= 0 {
+		return nil, errors.Errorf("invalid pause buffer size %d, it must be positive", opts.pauseBufferSize)
+	}
+	var fence *fence
+	if opts.fenceLease > 0 {
+		fence = newFence(opts)
+		if err := fence.validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var probe *commitProbe
+	if len(opts.probeSchema) > 0 {
+		probe = newCommitProbe(opts)
+		if err := probe.validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	s := &loaderImpl{
 		db:            db,
+		originDB:      db,
 		workerCount:   opts.workerCount,
 		batchSize:     opts.batchSize,
 		metrics:       opts.metrics,
@@ -164,16 +622,92 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 		merge:         true,
 		saveAppliedTS: opts.saveAppliedTS,
 
+		slowBatchThreshold: opts.slowBatchThreshold,
+		logger:             opts.logger,
+		transforms:         opts.transforms,
+		validateDMLs:       opts.validateDMLs,
+		tableCreator:       opts.tableCreator,
+		tidbMode:           opts.tidbMode,
+		connHeadroom:       opts.connHeadroom,
+		connMaxLifetime:    opts.connMaxLifetime,
+		pingInterval:       opts.pingInterval,
+		chunkSize:          opts.chunkSize,
+		groupCommitSize:    opts.groupCommitSize,
+		groupCommitDelay:   opts.groupCommitDelay,
+		onBarrier:          opts.onBarrier,
+		hints:              opts.hints,
+		semantics:          opts.semantics,
+		conflictSource:     opts.conflictSource,
+		conflicts:          opts.conflicts,
+		virtualColumns:     opts.virtualColumns,
+		history:            newHistoryTables(opts.history),
+		softDeletes:        opts.softDeletes,
+		bulkImport:         opts.bulkImport,
+		pause:              newTablePause(opts.pauseBufferSize),
+		snapshots:          newSnapshotTables(),
+		snapshotWorkers:    opts.workerCount,
+		snapshotChunkSize:  opts.batchSize,
+		loopbackSync:       opts.loopbackSync,
+		noKeyPolicy:        opts.noKeyPolicy,
+		savepointPolicy:    opts.savepointPolicy,
+		statsSchema:        opts.statsSchema,
+		statsInterval:      opts.statsInterval,
+		fence:              fence,
+		probe:              probe,
+		isolation:          opts.isolation,
+		captureGTID:        opts.captureGTID,
+		digestBatchSize:    opts.digestBatchSize,
+		multiStatements:    newMultiStatements(!opts.singleStatements),
+		watermark:          newWatermarkTracker(opts.onWatermark),
+		splitWorkerCount:   opts.splitWorkerCount,
+		warmupEnabled:      opts.warmup,
+		warmupTables:       opts.warmupTables,
+
 		ctx:    ctx,
 		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	s.SetSafeMode(opts.safeMode)
+
+	// the history tables are only inserted into
+	appendOnly := append(append([]filter.TableName(nil), opts.appendOnly...), s.history.names()...)
+	if len(appendOnly) > 0 {
+		s.appendOnlyTables = make(map[string]struct{}, len(appendOnly))
+		for _, t := range appendOnly {
+			s.appendOnlyTables[strings.ToLower(quoteSchema(t.Schema, t.Table))] = struct{}{}
+		}
+	}
+
+	if opts.dedupWindow > 0 {
+		s.dedup = newDedupWindow(opts.dedupWindow)
+	}
+
+	if opts.prioritySmallTxnSize > 0 {
+		s.priority = newPriorityLane(opts.prioritySmallTxnSize)
 	}
 
-	db.SetMaxOpenConns(opts.workerCount)
-	db.SetMaxIdleConns(opts.workerCount)
+	s.schemaMismatchPolicy = opts.schemaMismatchPolicy
+
+	if len(opts.rowsCheckPolicy) > 0 {
+		s.rowsCheck = &rowsCheck{policy: opts.rowsCheckPolicy}
+		s.rowsCheck.onDrift = s.onRowsDrift
+	}
+
+	if opts.dbOpener != nil && len(opts.addrs) > 0 {
+		s.supervisor = newConnSupervisor(opts.dbOpener, opts.addrs)
+		s.supervisor.logger = opts.logger
+	}
+
+	s.setupConnPool(db)
 
 	return s, nil
 }
 
+func (s *loaderImpl) getLogger() FieldLogger {
+	return defaultLogger(s.logger)
+}
+
 func (s *loaderImpl) metricsInputTxn(txn *Txn) {
 	if s.metrics == nil || s.metrics.EventCounterVec == nil {
 		return
@@ -207,15 +741,90 @@ func (s *loaderImpl) GetSafeMode() bool {
 	return v != 0
 }
 
+// SetWorkerCount set worker count
+func (s *loaderImpl) SetWorkerCount(n int) {
+	atomic.StoreInt32(&s.pendingWorkerCount, int32(n))
+}
+
+// SetBatchSize set batch size
+func (s *loaderImpl) SetBatchSize(n int) {
+	atomic.StoreInt32(&s.pendingBatchSize, int32(n))
+}
+
+// applyPendingOptions applies the worker count and batch size set by SetWorkerCount and SetBatchSize,
+// it must be called in Run so that no DML is being executed.
+func (s *loaderImpl) applyPendingOptions(batch *batchManager) {
+	workerCount := int(atomic.SwapInt32(&s.pendingWorkerCount, 0))
+	batchSize := int(atomic.SwapInt32(&s.pendingBatchSize, 0))
+	if workerCount <= 0 && batchSize <= 0 {
+		return
+	}
+
+	if workerCount > 0 {
+		s.workerCount = workerCount
+		s.setupConnPool(s.getDB())
+	}
+	if batchSize > 0 {
+		s.batchSize = batchSize
+	}
+	batch.limit = s.batchLimit()
+	s.getLogger().Info("loader options changed", zap.Int("worker count", s.workerCount), zap.Int("batch size", s.batchSize))
+}
+
+// batchLimit returns the number of DMLs accumulated to execute together
+func (s *loaderImpl) batchLimit() int {
+	if s.groupCommitSize > 0 {
+		return s.groupCommitSize
+	}
+	return s.batchSize * s.workerCount * execLimitMultiple
+}
+
 func (s *loaderImpl) markSuccess(txns ...*Txn) {
+	if s.priority != nil {
+		// the txns pulled forward are reported after the ones before them
+		txns = s.priority.succeed(txns)
+	}
+	// the txns having DMLs of the paused tables and the ones after them are reported after the DMLs are applied
+	s.reportSuccess(s.pause.succeed(txns)...)
+}
+
+// reportSuccess sends the txns to Successes in order
+func (s *loaderImpl) reportSuccess(txns ...*Txn) {
 	if s.saveAppliedTS && len(txns) > 0 && time.Since(s.lastUpdateAppliedTSTime) > updateLastAppliedTSInterval {
-		txns[len(txns)-1].AppliedTS = fGetAppliedTS(s.db)
+		txns[len(txns)-1].AppliedTS = fGetAppliedTS(s.getDB())
 		s.lastUpdateAppliedTSTime = time.Now()
 	}
+	if s.captureGTID && len(txns) > 0 {
+		txns[len(txns)-1].GTIDSet = fGetGTIDExecuted(s.getDB(), s.getLogger())
+	}
+	s.tableStatus.onSuccess(txns...)
+	now := time.Now()
 	for _, txn := range txns {
+		if txn.CommitTS > 0 {
+			s.appliedTS = txn.CommitTS
+			if s.metrics != nil && s.metrics.TxnLatencyHistogram != nil {
+				s.metrics.TxnLatencyHistogram.Observe(now.Sub(oracle.GetTimeFromTS(uint64(txn.CommitTS))).Seconds())
+			}
+		}
 		s.successTxn <- txn
 	}
-	log.Debug("markSuccess txns", zap.Int("txns len", len(txns)))
+	s.watermark.applied(txns)
+	s.getLogger().Debug("markSuccess txns", zap.Int("txns len", len(txns)))
+}
+
+// TableStatus implements Loader interface
+func (s *loaderImpl) TableStatus() []TableStatus {
+	return s.tableStatus.status()
+}
+
+// Watermark implements Loader interface
+func (s *loaderImpl) Watermark() Watermark {
+	return s.watermark.watermark()
+}
+
+// SubscribeWatermark implements Loader interface
+func (s *loaderImpl) SubscribeWatermark() (<-chan Watermark, func()) {
+	return s.watermark.subscribe()
 }
 
 // Input returns input channel which used to put Txn into Loader
@@ -228,6 +837,34 @@ func (s *loaderImpl) Successes() <-chan *Txn {
 	return s.successTxn
 }
 
+// Flush implements Loader interface, the request is sent through Input() so that it's handled
+// after the txns input before it
+func (s *loaderImpl) Flush(ctx context.Context) (appliedTS int64, err error) {
+	req := &Txn{flush: make(chan int64, 1)}
+	select {
+	case s.input <- req:
+	case <-s.done:
+		return 0, errors.New("loader is not running")
+	case <-ctx.Done():
+		return 0, errors.Trace(ctx.Err())
+	}
+
+	select {
+	case appliedTS = <-req.flush:
+		return appliedTS, nil
+	case <-s.done:
+		// Run may return right after the request is handled
+		select {
+		case appliedTS = <-req.flush:
+			return appliedTS, nil
+		default:
+			return 0, errors.New("loader quit before flushed")
+		}
+	case <-ctx.Done():
+		return 0, errors.Trace(ctx.Err())
+	}
+}
+
 // Close close the Loader, no more Txn can be push into Input()
 // Run will quit when all data is drained
 func (s *loaderImpl) Close() {
@@ -238,7 +875,7 @@ func (s *loaderImpl) Close() {
 var utilGetTableInfo = getTableInfo
 
 func (s *loaderImpl) refreshTableInfo(schema string, table string) (info *tableInfo, err error) {
-	log.Info("refresh table info", zap.String("schema", schema), zap.String("table", table))
+	s.getLogger().Info("refresh table info", zap.String("schema", schema), zap.String("table", table))
 
 	if len(schema) == 0 {
 		return nil, errors.New("schema is empty")
@@ -248,16 +885,28 @@ func (s *loaderImpl) refreshTableInfo(schema string, table string) (info *tableI
 		return nil, nil
 	}
 
-	info, err = utilGetTableInfo(s.db, schema, table)
+	info, err = utilGetTableInfo(s.getDB(), schema, table)
 	if err != nil {
 		return info, errors.Trace(err)
 	}
+	info.hint = hintOf(s.hints, schema, table)
+	if err = setVirtualColumns(info, virtualColumnsOf(s.virtualColumns, schema, table), schema, table); err != nil {
+		return nil, errors.Trace(err)
+	}
+	semantics := semanticsOf(s.semantics, schema, table)
+	info.update, info.delete = semantics.Update, semantics.Delete
+	info.conflict = conflictOf(s.conflicts, s.conflictSource, schema, table)
+	info.softDelete = softDeleteOf(s.softDeletes, schema, table) != nil
+	if err = checkConflictTable(info, schema, table); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	if len(info.uniqueKeys) == 0 {
-		log.Warn("table has no any primary key and unique index, it may be slow when syncing data to downstream, we highly recommend add primary key or unique key for table", zap.String("table", quoteSchema(schema, table)))
+		s.getLogger().Warn("table has no any primary key and unique index, it may be slow when syncing data to downstream, we highly recommend add primary key or unique key for table", zap.String("table", quoteSchema(schema, table)))
 	}
 
 	s.tableInfos.Store(quoteSchema(schema, table), info)
+	s.tableStatus.onTableInfo(schema, table, info)
 
 	return
 }
@@ -269,7 +918,32 @@ func (s *loaderImpl) getTableInfo(schema string, table string) (info *tableInfo,
 		return
 	}
 
-	return s.refreshTableInfo(schema, table)
+	info, err = s.refreshTableInfo(schema, table)
+	if errors.Cause(err) == ErrTableNotExist && s.tableCreator != nil {
+		if err = s.createTable(schema, table); err != nil {
+			return nil, errors.Trace(err)
+		}
+		info, err = s.refreshTableInfo(schema, table)
+	}
+	return
+}
+
+// createTable creates the table missing in downstream by tableCreator
+func (s *loaderImpl) createTable(schema string, table string) error {
+	sql, err := s.tableCreator(schema, table)
+	if err != nil {
+		return errors.Annotatef(err, "get create table statement of %s", quoteSchema(schema, table))
+	}
+
+	s.getLogger().Info("create missing table", zap.String("table", quoteSchema(schema, table)), zap.String("sql", sql))
+	createDB := &DDL{Database: schema, SQL: fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(schema))}
+	if err := s.execDDL(createDB); err != nil {
+		return errors.Annotatef(err, "create database %s", quoteName(schema))
+	}
+	if err := s.execDDL(&DDL{Database: schema, Table: table, SQL: sql}); err != nil {
+		return errors.Annotatef(err, "create table %s", quoteSchema(schema, table))
+	}
+	return nil
 }
 
 func needRefreshTableInfo(sql string) bool {
@@ -293,6 +967,21 @@ func needRefreshTableInfo(sql string) bool {
 	return true
 }
 
+// splitDDL returns the statements of the DDL executed one by one, as the downstream may not allow multiple
+// statements in one query, e.g., the ones generated by drainer to move a table before creating it again
+func splitDDL(sql string) []string {
+	stmts, _, err := parser.New().Parse(sql, "", "")
+	if err != nil || len(stmts) <= 1 {
+		return []string{sql}
+	}
+
+	sqls := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		sqls = append(sqls, strings.TrimSpace(stmt.Text()))
+	}
+	return sqls
+}
+
 func isCreateDatabaseDDL(sql string) bool {
 	stmt, err := parser.New().ParseOneStmt(sql, "", "")
 	if err != nil {
@@ -304,44 +993,120 @@ func isCreateDatabaseDDL(sql string) bool {
 	return isCreateDatabase
 }
 
+// execWithReconnect reconnects to downstream and executes `fn` again if the connection is broken.
+// `fn` must wait for all the transactions it starts to finish, so that no transaction is
+// in flight on the broken connection when switching to the new one. The safe mode passed to `fn`
+// is the one of loader at first, and it's always true when executed again.
+func (s *loaderImpl) execWithReconnect(fn func(safeMode bool) error) error {
+	err := fn(s.GetSafeMode())
+	for i := 0; i < maxReconnectCount && err != nil && s.supervisor != nil && isConnError(err); i++ {
+		s.getLogger().Warn("connection to downstream is broken, reconnect", zap.Error(err))
+		if err := s.reconnect(); err != nil {
+			return errors.Trace(err)
+		}
+
+		// the transactions may have been committed partially before the connection
+		// is broken, so execute them again in safe mode to make it reentrant.
+		err = fn(true)
+	}
+
+	return errors.Trace(err)
+}
+
+func (s *loaderImpl) reconnect() error {
+	db, err := s.supervisor.connect(s.ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	s.setupConnPool(db)
+
+	s.dbMu.Lock()
+	old := s.db
+	s.db = db
+	s.dbMu.Unlock()
+
+	s.closeDB(old)
+	return nil
+}
+
+// getDB returns the db in use, it's replaced when reconnected.
+func (s *loaderImpl) getDB() *gosql.DB {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	return s.db
+}
+
+// closeDB closes db if it's opened by supervisor.
+func (s *loaderImpl) closeDB(db *gosql.DB) {
+	if s.supervisor != nil && db != s.originDB {
+		if err := db.Close(); err != nil {
+			s.getLogger().Warn("close db failed", zap.Error(err))
+		}
+	}
+}
+
 func (s *loaderImpl) execDDL(ddl *DDL) error {
-	log.Debug("exec ddl", zap.Reflect("ddl", ddl))
+	err := s.execWithReconnect(func(bool) error {
+		return s.execDDLRetry(ddl)
+	})
+	if err != nil {
+		s.tableStatus.onDDLError(ddl, err)
+	}
+	return err
+}
+
+func (s *loaderImpl) execDDLRetry(ddl *DDL) error {
+	s.getLogger().Debug("exec ddl", zap.Reflect("ddl", ddl))
 
 	err := util.RetryContext(s.ctx, maxDDLRetryCount, execDDLRetryWait, 1, func(context.Context) error {
-		tx, err := s.db.Begin()
+		tx, err := s.getDB().Begin()
 		if err != nil {
 			return err
 		}
 
-		if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
+		if s.fence != nil {
+			if err = s.fence.check(tx); err != nil {
+				if rbErr := tx.Rollback(); rbErr != nil {
+					s.getLogger().Error("Rollback failed", zap.Error(rbErr))
+				}
+				return err
+			}
+		}
+
+		sqls := splitDDL(ddl.SQL)
+		if len(ddl.Database) > 0 && !isCreateDatabaseDDL(sqls[0]) {
 			_, err = tx.Exec(fmt.Sprintf("use %s;", quoteName(ddl.Database)))
 			if err != nil {
 				if rbErr := tx.Rollback(); rbErr != nil {
-					log.Error("Rollback failed", zap.Error(rbErr))
+					s.getLogger().Error("Rollback failed", zap.Error(rbErr))
 				}
 				return err
 			}
 		}
 
-		if _, err = tx.Exec(ddl.SQL); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				log.Error("Rollback failed", zap.String("sql", ddl.SQL), zap.Error(rbErr))
+		for _, sql := range sqls {
+			if _, err = tx.Exec(sql); err != nil {
+				if rbErr := tx.Rollback(); rbErr != nil {
+					s.getLogger().Error("Rollback failed", zap.String("sql", sql), zap.Error(rbErr))
+				}
+				return err
 			}
-			return err
 		}
 
 		if err = tx.Commit(); err != nil {
 			return err
 		}
 
-		log.Info("exec ddl success", zap.String("sql", ddl.SQL))
+		s.getLogger().Info("exec ddl success", zap.String("sql", ddl.SQL))
 		return nil
 	})
 
 	return errors.Trace(err)
 }
 
-func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
+func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML, safeMode bool) error {
 	errg, _ := errgroup.WithContext(s.ctx)
 
 	for _, dmls := range byHash {
@@ -352,7 +1117,10 @@ func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 		dmls := dmls
 
 		errg.Go(func() error {
-			err := executor.singleExecRetry(s.ctx, dmls, s.GetSafeMode(), maxDMLRetryCount, time.Second)
+			err := executor.singleExecRetry(s.ctx, dmls, safeMode, maxDMLRetryCount, time.Second)
+			if err != nil {
+				s.tableStatus.onDMLsError(dmls, err)
+			}
 			return err
 		})
 	}
@@ -362,20 +1130,20 @@ func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 	return errors.Trace(err)
 }
 
-func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
+func (s *loaderImpl) singleExec(executor *executor, dmls []*DML, safeMode bool) error {
 	causality := NewCausality()
 
 	var byHash = make([][]*DML, s.workerCount)
 
 	for _, dml := range dmls {
 		keys := getKeys(dml)
-		log.Debug("get keys", zap.Reflect("dml", dml), zap.Strings("keys", keys))
+		s.getLogger().Debug("get keys", zap.Stringer("dml", dml), zap.Strings("keys", mask.Strings(dml.Database, dml.Table, keys)))
 		conflict := causality.DetectConflict(keys)
 		if conflict {
-			log.Info("meet causality.DetectConflict exec now",
+			s.getLogger().Info("meet causality.DetectConflict exec now",
 				zap.String("table name", dml.TableName()),
-				zap.Strings("keys", keys))
-			if err := s.execByHash(executor, byHash); err != nil {
+				zap.Strings("keys", mask.Strings(dml.Database, dml.Table, keys)))
+			if err := s.execByHash(executor, byHash, safeMode); err != nil {
 				return errors.Trace(err)
 			}
 
@@ -386,7 +1154,7 @@ func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 		}
 
 		if err := causality.Add(keys); err != nil {
-			log.Error("Add keys to causality failed", zap.Error(err), zap.Strings("keys", keys))
+			s.getLogger().Error("Add keys to causality failed", zap.Error(err), zap.Strings("keys", mask.Strings(dml.Database, dml.Table, keys)))
 		}
 		key := causality.Get(keys[0])
 		idx := int(genHashKey(key)) % len(byHash)
@@ -394,7 +1162,7 @@ func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 
 	}
 
-	err := s.execByHash(executor, byHash)
+	err := s.execByHash(executor, byHash, safeMode)
 	return errors.Trace(err)
 }
 
@@ -403,33 +1171,76 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 		return nil
 	}
 
+	return s.execWithReconnect(func(safeMode bool) error {
+		return s.execDMLsRetry(dmls, safeMode)
+	})
+}
+
+func (s *loaderImpl) execDMLsRetry(dmls []*DML, safeMode bool) error {
+	if err := checkEpoch(dmls); err != nil {
+		return errors.Trace(err)
+	}
+
 	for _, dml := range dmls {
-		if err := s.setDMLInfo(dml); err != nil {
+		if err := s.setFreshDMLInfo(dml); err != nil {
+			return errors.Trace(err)
+		}
+		if err := checkConflictTS(dml); err != nil {
 			return errors.Trace(err)
 		}
 		filterGeneratedCols(dml)
+		exactValues(dml)
+	}
+
+	if s.bulkImport && allInserts(dmls) {
+		return errors.Trace(s.execBulkImport(dmls, safeMode))
+	}
+
+	if s.groupCommitSize > 0 && len(dmls) <= s.groupCommitSize && !hasSemantics(dmls) {
+		if len(s.savepointPolicy) > 0 {
+			return errors.Trace(s.execGroupCommitSavepoints(dmls, safeMode))
+		}
+		return errors.Trace(s.execGroupCommit(dmls, safeMode))
 	}
 
+	appendOnly, dmls, err := s.splitAppendOnly(dmls)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	batchTables, singleDMLs := s.groupDMLs(dmls)
 
 	executor := s.getExecutor()
 	errg, _ := errgroup.WithContext(s.ctx)
 
+	for _, dmls := range appendOnly {
+		dmls := dmls
+		errg.Go(func() error {
+			err := executor.execAppendOnlyRetry(s.ctx, dmls, maxDMLRetryCount, time.Second)
+			if err != nil {
+				s.tableStatus.onDMLsError(dmls, err)
+			}
+			return err
+		})
+	}
+
 	for _, dmls := range batchTables {
 		// https://golang.org/doc/faq#closures_and_goroutines
 		dmls := dmls
 		errg.Go(func() error {
 			err := executor.execTableBatchRetry(s.ctx, dmls, maxDMLRetryCount, time.Second)
+			if err != nil {
+				s.tableStatus.onDMLsError(dmls, err)
+			}
 			return err
 		})
 	}
 
 	errg.Go(func() error {
-		err := s.singleExec(executor, singleDMLs)
+		err := s.singleExec(executor, singleDMLs, safeMode)
 		return errors.Trace(err)
 	})
 
-	err := errg.Wait()
+	err = errg.Wait()
 
 	return errors.Trace(err)
 }
@@ -437,35 +1248,130 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 // Run will quit when meet any error, or all the txn are drained
 func (s *loaderImpl) Run() error {
 	txnManager := newTxnManager(1024, s.input)
+	txnManager.logger = s.logger
 	defer func() {
-		log.Info("Run()... in Loader quit")
+		s.getLogger().Info("Run()... in Loader quit")
 		close(s.successTxn)
 		txnManager.Close()
+		if s.statsInterval > 0 {
+			s.exportStats()
+		}
+		s.closeDB(s.getDB())
+		s.tableStatus.dump(s.getLogger())
+		if s.done != nil {
+			close(s.done)
+		}
 	}()
 
+	if s.warmupEnabled {
+		if err := s.warmup(s.ctx); err != nil {
+			return errors.Annotate(err, "warm up downstream failed")
+		}
+	}
+	if s.loopbackControl() {
+		if err := s.createMarkTable(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if s.statsInterval > 0 {
+		if err := s.createStatsTable(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if s.probe != nil {
+		if err := s.probe.createTable(s.getDB()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// nil if the fencing is disabled, it wakes up the idle loop to renew the lease
+	var fenceTick <-chan time.Time
+	if s.fence != nil {
+		if err := s.fence.acquire(s.ctx, s.getDB(), s.getLogger()); err != nil {
+			return errors.Annotatef(err, "acquire fence %s", s.fence.name)
+		}
+		s.getLogger().Info("fence acquired", zap.String("fence", s.fence.name), zap.Int64("token", s.fence.token))
+		ticker := time.NewTicker(s.fence.lease / 3)
+		defer ticker.Stop()
+		fenceTick = ticker.C
+	}
+
 	batch := fNewBatchManager(s)
 	input := txnManager.run()
+	if s.priority != nil {
+		batch.fBeforeFullExec = func() error {
+			return errors.Trace(s.pullForward(txnManager, input, batch))
+		}
+	}
+
+	// nil if the ping is disabled, so it's never selected
+	var ping <-chan time.Time
+	if s.pingInterval > 0 {
+		ticker := time.NewTicker(s.pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	// nil if the stats are not exported, it wakes up the idle loop to export the last changes
+	var statsTick <-chan time.Time
+	if s.statsInterval > 0 {
+		ticker := time.NewTicker(s.statsInterval)
+		defer ticker.Stop()
+		statsTick = ticker.C
+		s.statsExportTime = time.Now()
+	}
 
 	for {
+		s.applyPendingOptions(batch)
+		if err := s.drainResumed(batch); err != nil {
+			return errors.Trace(err)
+		}
+		if s.statsInterval > 0 && time.Since(s.statsExportTime) >= s.statsInterval {
+			s.exportStats()
+		}
+		if s.fence != nil && s.fence.needRenew() {
+			if err := s.renewFence(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		// the txns read ahead by the priority lane are handled before the input
+		if s.priority != nil {
+			if d, ok := s.priority.nextDeferred(); ok {
+				if err := s.handleDeferredTxn(batch, d); err != nil {
+					return errors.Trace(err)
+				}
+				continue
+			}
+		}
+
 		select {
 		case txn, ok := <-input:
 			if !ok {
-				log.Info("Loader closed, quit running")
-				if err := batch.execAccumulatedDMLs(); err != nil {
-					return errors.Trace(err)
-				}
-				return nil
+				s.getLogger().Info("Loader closed, quit running")
+				return errors.Trace(s.drainOnClose(batch))
 			}
 
-			s.metricsInputTxn(txn)
-			txnManager.pop(txn)
-			if err := batch.put(txn); err != nil {
+			if err := s.handleTxn(txnManager, batch, txn); err != nil {
 				return errors.Trace(err)
 			}
 
 		default:
 			// execute DMLs ASAP if the `input` channel is empty
-			if len(batch.dmls) > 0 {
+			if len(batch.txns) > 0 {
+				// in the group commit mode, wait for more txns until the delay after the first one is put
+				if wait := s.groupCommitWait(batch); wait > 0 {
+					select {
+					case txn, ok := <-input:
+						if !ok {
+							s.getLogger().Info("Loader closed, quit running")
+							return errors.Trace(s.drainOnClose(batch))
+						}
+						if err := s.handleTxn(txnManager, batch, txn); err != nil {
+							return errors.Trace(err)
+						}
+					case <-time.After(wait):
+					}
+					continue
+				}
+
 				if err := batch.execAccumulatedDMLs(); err != nil {
 					return errors.Trace(err)
 				}
@@ -473,21 +1379,170 @@ func (s *loaderImpl) Run() error {
 				continue
 			}
 
-			// get first
-			txn, ok := <-input
+			// get first, and ping the downstream while waiting
+			var txn *Txn
+			var ok bool
+			select {
+			case txn, ok = <-input:
+			case <-ping:
+				s.pingDB()
+				continue
+			case <-statsTick:
+				continue
+			case <-fenceTick:
+				continue
+			case <-s.pause.resumed():
+				continue
+			}
 			if !ok {
-				return nil
+				return errors.Trace(s.drainAll(batch))
 			}
 
-			s.metricsInputTxn(txn)
-			txnManager.pop(txn)
-			if err := batch.put(txn); err != nil {
+			if err := s.handleTxn(txnManager, batch, txn); err != nil {
 				return errors.Trace(err)
 			}
 		}
 	}
 }
 
+// drainOnClose applies the DMLs buffered of the paused tables and the ones accumulated in batch before Run quits
+func (s *loaderImpl) drainOnClose(batch *batchManager) error {
+	if err := s.drainAll(batch); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(batch.execAccumulatedDMLs())
+}
+
+func (s *loaderImpl) handleTxn(txnManager *txnManager, batch *batchManager, txn *Txn) error {
+	txnManager.pop(txn)
+	s.watermark.input(txn)
+	if s.priority != nil {
+		s.priority.input(txn)
+	}
+	return errors.Trace(s.processTxn(batch, txn))
+}
+
+// handleDeferredTxn handles the txn read ahead by the priority lane
+func (s *loaderImpl) handleDeferredTxn(batch *batchManager, d deferredTxn) error {
+	if d.prepared {
+		return errors.Trace(s.putTxn(batch, d.txn))
+	}
+	return errors.Trace(s.processTxn(batch, d.txn))
+}
+
+func (s *loaderImpl) processTxn(batch *batchManager, txn *Txn) error {
+	if txn.flush != nil {
+		if err := batch.barrier(FlushBarrier, s.appliedTS); err != nil {
+			return errors.Trace(err)
+		}
+		txn.flush <- s.appliedTS
+		return nil
+	}
+
+	if err := s.prepareTxn(txn); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.putTxn(batch, txn))
+}
+
+// putTxn puts the txn prepared into batch, the DMLs of the paused tables are buffered instead
+func (s *loaderImpl) putTxn(batch *batchManager, txn *Txn) error {
+	if err := s.holdPaused(batch, txn); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(batch.put(txn))
+}
+
+// prepareTxn drops the DMLs copied from the snapshots, dedups, transforms, records the history, turns the soft
+// deletes into updates, checks the columns and validates the DMLs of txn before it's put into the batch
+func (s *loaderImpl) prepareTxn(txn *Txn) error {
+	s.metricsInputTxn(txn)
+	if removed := s.snapshots.filter(txn); removed > 0 {
+		s.getLogger().Debug("skip the dmls in the snapshots copied", zap.Int64("commit ts", txn.CommitTS), zap.Int("count", removed))
+	}
+	if err := s.dedupTxn(txn); err != nil {
+		return errors.Trace(err)
+	}
+	if err := s.transform(txn); err != nil {
+		return errors.Trace(err)
+	}
+	s.history.record(txn)
+	s.softDelete(txn)
+	if err := s.checkSchema(txn); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.validate(txn))
+}
+
+// dedupTxn removes the DMLs of txn delivered before
+func (s *loaderImpl) dedupTxn(txn *Txn) error {
+	if s.dedup == nil || txn.isDDL() {
+		return nil
+	}
+	for _, dml := range txn.DMLs {
+		if err := s.setDMLInfo(dml); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if removed := s.dedup.filter(txn); removed > 0 {
+		s.getLogger().Info("skip duplicated dmls", zap.Int64("commit ts", txn.CommitTS), zap.Int("count", removed))
+	}
+	return nil
+}
+
+// transform applies the transforms to the DMLs of txn
+func (s *loaderImpl) transform(txn *Txn) error {
+	if len(s.transforms) == 0 || txn.isDDL() {
+		return nil
+	}
+	for _, dml := range txn.DMLs {
+		for _, f := range s.transforms {
+			if err := f(dml); err != nil {
+				return errors.Annotatef(err, "transform dml of %s at commit ts %d", dml.TableName(), txn.CommitTS)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the DMLs of txn if validateDMLs is enabled
+func (s *loaderImpl) validate(txn *Txn) error {
+	if !s.validateDMLs || txn.isDDL() {
+		return nil
+	}
+	for _, dml := range txn.DMLs {
+		if err := s.setDMLInfo(dml); err != nil {
+			return errors.Annotatef(err, "validate dml of %s at commit ts %d", dml.TableName(), txn.CommitTS)
+		}
+		if err := validateDML(dml); err != nil {
+			return errors.Annotatef(err, "invalid dml of %s at commit ts %d", dml.TableName(), txn.CommitTS)
+		}
+	}
+	return nil
+}
+
+// splitAppendOnly groups the DMLs of the append-only tables by table in appendOnly, and returns the others,
+// it fails if there's an update or delete of an append-only table.
+func (s *loaderImpl) splitAppendOnly(dmls []*DML) (appendOnly map[string][]*DML, others []*DML, err error) {
+	if len(s.appendOnlyTables) == 0 {
+		return nil, dmls, nil
+	}
+
+	appendOnly = make(map[string][]*DML)
+	for _, dml := range dmls {
+		tblName := dml.TableName()
+		if _, ok := s.appendOnlyTables[strings.ToLower(tblName)]; !ok {
+			others = append(others, dml)
+			continue
+		}
+		if dml.Tp != InsertDMLType {
+			return nil, nil, errors.Errorf("table %s is declared append-only, but got %s", tblName, dml.String())
+		}
+		appendOnly[tblName] = append(appendOnly[tblName], dml)
+	}
+	return appendOnly, others, nil
+}
+
 // groupDMLs group DMLs by table in batchByTbls and
 // collects DMLs that can't be executed in bulk in singleDMLs.
 // NOTE: DML.info are assumed to be already set.
@@ -499,13 +1554,21 @@ func (s *loaderImpl) groupDMLs(dmls []*DML) (batchByTbls map[string][]*DML, sing
 	batchByTbls = make(map[string][]*DML)
 	for _, dml := range dmls {
 		info := dml.info
-		if info.primaryKey != nil && len(info.uniqueKeys) == 0 {
+		if info.primaryKey != nil && len(info.uniqueKeys) == 0 && !info.hasSemantics() {
 			tblName := dml.TableName()
 			batchByTbls[tblName] = append(batchByTbls[tblName], dml)
 		} else {
 			singleDMLs = append(singleDMLs, dml)
 		}
 	}
+
+	// the large values can't be written by the bulk statements
+	for tblName, tblDMLs := range batchByTbls {
+		if hasLargeValue(tblDMLs, s.chunkSize) {
+			singleDMLs = append(singleDMLs, tblDMLs...)
+			delete(batchByTbls, tblName)
+		}
+	}
 	return
 }
 
@@ -526,7 +1589,11 @@ func countEvents(dmls []*DML) (insertEvent float64, deleteEvent float64, updateE
 func (s *loaderImpl) setDMLInfo(dml *DML) (err error) {
 	dml.info, err = s.getTableInfo(dml.Database, dml.Table)
 	if err != nil {
-		err = errors.Trace(err)
+		return errors.Trace(err)
+	}
+
+	if len(dml.info.uniqueKeys) == 0 {
+		err = s.checkNoKey(dml)
 	}
 	return
 }
@@ -543,24 +1610,44 @@ func filterGeneratedCols(dml *DML) {
 }
 
 func (s *loaderImpl) getExecutor() *executor {
-	e := newExecutor(s.db).withBatchSize(s.batchSize)
+	e := newExecutor(s.getDB()).withBatchSize(s.batchSize).withSlowBatchThreshold(s.slowBatchThreshold).withLogger(s.getLogger()).withTiDBMode(s.tidbMode).withChunkSize(s.chunkSize).withDigestBatchSize(s.digestBatchSize).withMultiStatements(s.multiStatements).withWorkerCount(s.splitWorkerCount).withIsolation(s.isolation.sqlLevel())
 	if s.metrics != nil && s.metrics.QueryHistogramVec != nil {
 		e = e.withQueryHistogramVec(s.metrics.QueryHistogramVec)
 	}
+	if s.metrics != nil && s.metrics.ConflictCounterVec != nil {
+		e = e.withConflictCounterVec(s.metrics.ConflictCounterVec)
+	}
+	if s.loopbackControl() {
+		e = e.withMarkTxn(s.markStatement)
+	}
+	if s.rowsCheck != nil {
+		e = e.withRowsCheck(s.rowsCheck)
+	}
+	if s.fence != nil {
+		e = e.withFence(s.fence)
+	}
+	if s.probe != nil {
+		e = e.withProbe(s.probe)
+	}
 	return e
 }
 
 func newBatchManager(s *loaderImpl) *batchManager {
 	return &batchManager{
-		limit:                s.batchSize * s.workerCount * execLimitMultiple,
+		limit:                s.batchLimit(),
+		groupCommit:          s.groupCommitSize > 0,
+		logger:               s.logger,
 		fExecDMLs:            s.execDMLs,
 		fDMLsSuccessCallback: s.markSuccess,
 		fExecDDL:             s.execDDL,
+		fBarrierCallback:     s.onBarrier,
 		fDDLSuccessCallback: func(txn *Txn) {
 			s.markSuccess(txn)
 			if needRefreshTableInfo(txn.DDL.SQL) {
 				if _, err := s.refreshTableInfo(txn.DDL.Database, txn.DDL.Table); err != nil {
-					log.Error("refresh table info failed", zap.String("database", txn.DDL.Database), zap.String("table", txn.DDL.Table), zap.Error(err))
+					s.getLogger().Error("refresh table info failed", zap.String("database", txn.DDL.Database), zap.String("table", txn.DDL.Table), zap.Int64("commit ts", txn.CommitTS), zap.Error(err))
+					// the DMLs after the DDL must not be written by the info of the old schema
+					s.evictTableInfo(txn.DDL.Database, txn.DDL.Table)
 				}
 			}
 		},
@@ -575,14 +1662,37 @@ type batchManager struct {
 	fDMLsSuccessCallback func(...*Txn)
 	fExecDDL             func(*DDL) error
 	fDDLSuccessCallback  func(*Txn)
+	logger               FieldLogger
+	// commit the accumulated DMLs before exceeding limit, and the time the first of them is put
+	groupCommit bool
+	firstPut    time.Time
+	// the epoch of the txns put, increased by each barrier
+	epoch            uint64
+	fBarrierCallback func(Barrier)
+	// called before the DMLs accumulated are executed for reaching the limit, see PriorityLane
+	fBeforeFullExec func() error
+}
+
+func (b *batchManager) getLogger() FieldLogger {
+	return defaultLogger(b.logger)
 }
 
 func (b *batchManager) execAccumulatedDMLs() (err error) {
 	if len(b.dmls) == 0 {
+		// the txns whose DMLs are all removed, e.g., deduped or buffered for the paused tables
+		if len(b.txns) > 0 && b.fDMLsSuccessCallback != nil {
+			b.fDMLsSuccessCallback(b.txns...)
+		}
+		b.txns = b.txns[:0]
 		return nil
 	}
 
 	if err := b.fExecDMLs(b.dmls); err != nil {
+		b.getLogger().Error("exec dmls failed",
+			zap.Int("txns", len(b.txns)),
+			zap.Int64("first commit ts", b.txns[0].CommitTS),
+			zap.Int64("last commit ts", b.txns[len(b.txns)-1].CommitTS),
+			zap.Error(err))
 		return errors.Trace(err)
 	}
 
@@ -597,16 +1707,29 @@ func (b *batchManager) execAccumulatedDMLs() (err error) {
 func (b *batchManager) execDDL(txn *Txn) error {
 	if err := b.fExecDDL(txn.DDL); err != nil {
 		if !pkgsql.IgnoreDDLError(err) {
-			log.Error("exec failed", zap.String("sql", txn.DDL.SQL), zap.Error(err))
+			b.getLogger().Error("exec failed", zap.String("table", quoteSchema(txn.DDL.Database, txn.DDL.Table)), zap.Int64("commit ts", txn.CommitTS), zap.String("sql", txn.DDL.SQL), zap.Error(err))
 			return errors.Trace(err)
 		}
-		log.Warn("ignore ddl", zap.Error(err), zap.String("ddl", txn.DDL.SQL))
+		b.getLogger().Warn("ignore ddl", zap.String("table", quoteSchema(txn.DDL.Database, txn.DDL.Table)), zap.Int64("commit ts", txn.CommitTS), zap.Error(err), zap.String("ddl", txn.DDL.SQL))
 	}
 
 	b.fDDLSuccessCallback(txn)
 	return nil
 }
 
+// barrier executes the DMLs accumulated so none of them crosses the barrier, then starts a new epoch
+func (b *batchManager) barrier(tp BarrierType, commitTS int64) error {
+	if err := b.execAccumulatedDMLs(); err != nil {
+		return errors.Trace(err)
+	}
+
+	b.epoch++
+	if b.fBarrierCallback != nil {
+		b.fBarrierCallback(Barrier{Tp: tp, Epoch: b.epoch, CommitTS: commitTS})
+	}
+	return nil
+}
+
 func (b *batchManager) put(txn *Txn) error {
 	// we always executor the previous dmls when we meet ddl,
 	// and executor ddl one by one.
@@ -615,19 +1738,40 @@ func (b *batchManager) put(txn *Txn) error {
 			return errors.Errorf("get DDL Txn with empty database, ddl: %s", txn.DDL.SQL)
 		}
 
-		if err := b.execAccumulatedDMLs(); err != nil {
+		if err := b.barrier(DDLBarrier, txn.CommitTS); err != nil {
 			return errors.Trace(err)
 		}
 		if err := b.execDDL(txn); err != nil {
 			return errors.Trace(err)
 		}
+		// the table info is refreshed by fDDLSuccessCallback
+		if needRefreshTableInfo(txn.DDL.SQL) {
+			return errors.Trace(b.barrier(TableInfoBarrier, txn.CommitTS))
+		}
 		return nil
 	}
+	if b.groupCommit && len(b.dmls) > 0 && len(b.dmls)+len(txn.DMLs) > b.limit {
+		if err := b.execAccumulatedDMLs(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if len(b.dmls) == 0 {
+		b.firstPut = time.Now()
+	}
+	for _, dml := range txn.DMLs {
+		dml.epoch = b.epoch
+		dml.txn = txn
+	}
 	b.dmls = append(b.dmls, txn.DMLs...)
 	b.txns = append(b.txns, txn)
 
 	// reach a limit size to exec
 	if len(b.dmls) >= b.limit {
+		if b.fBeforeFullExec != nil {
+			if err := b.fBeforeFullExec(); err != nil {
+				return errors.Trace(err)
+			}
+		}
 		if err := b.execAccumulatedDMLs(); err != nil {
 			return errors.Trace(err)
 		}
@@ -644,6 +1788,11 @@ type txnManager struct {
 	maxCacheSize int
 	cond         *sync.Cond
 	isClosed     int32
+	logger       FieldLogger
+}
+
+func (t *txnManager) getLogger() FieldLogger {
+	return defaultLogger(t.logger)
 }
 
 func newTxnManager(maxCacheSize int, input chan *Txn) *txnManager {
@@ -662,7 +1811,7 @@ func (t *txnManager) run() chan *Txn {
 	input := t.input
 	go func() {
 		defer func() {
-			log.Info("run()... in txnManager quit")
+			t.getLogger().Info("run()... in txnManager quit")
 			close(ret)
 		}()
 
@@ -672,7 +1821,7 @@ func (t *txnManager) run() chan *Txn {
 			select {
 			case txn, ok = <-input:
 				if !ok {
-					log.Info("Loader has been closed. Start quitting txnManager")
+					t.getLogger().Info("Loader has been closed. Start quitting txnManager")
 					return
 				}
 			case <-t.shutdown:
@@ -718,7 +1867,7 @@ func (t *txnManager) Close() {
 	}
 	close(t.shutdown)
 	t.cond.Signal()
-	log.Info("txnManager has been closed")
+	t.getLogger().Info("txnManager has been closed")
 }
 
 func getAppliedTS(db *gosql.DB) int64 {
@@ -733,3 +1882,12 @@ func getAppliedTS(db *gosql.DB) int64 {
 	}
 	return appliedTS
 }
+
+func getGTIDExecuted(db *gosql.DB, logger FieldLogger) string {
+	gtidSet, err := pkgsql.GetGTIDExecuted(db)
+	if err != nil {
+		logger.Warn("get the gtid set executed in downstream failed", zap.Error(err))
+		return ""
+	}
+	return gtidSet
+}
@@ -16,14 +16,21 @@ package loader
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
 	check "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type LoadSuite struct {
@@ -50,6 +57,43 @@ func (cs *LoadSuite) TestOptions(c *check.C) {
 	c.Assert(o.saveAppliedTS, check.Equals, true)
 }
 
+func (cs *LoadSuite) TestNewLoaderWithSafeMode(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	loader, err := NewLoader(db)
+	c.Assert(err, check.IsNil)
+	c.Assert(loader.GetSafeMode(), check.IsFalse)
+
+	loader, err = NewLoader(db, SafeMode(true))
+	c.Assert(err, check.IsNil)
+	c.Assert(loader.GetSafeMode(), check.IsTrue)
+}
+
+func (cs *LoadSuite) TestApplyPendingOptions(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	loader := &loaderImpl{db: db, batchSize: 20, workerCount: 16}
+	batch := newBatchManager(loader)
+
+	loader.applyPendingOptions(batch)
+	c.Assert(batch.limit, check.Equals, 20*16*execLimitMultiple)
+
+	loader.SetWorkerCount(4)
+	loader.SetBatchSize(10)
+	loader.applyPendingOptions(batch)
+	c.Assert(loader.workerCount, check.Equals, 4)
+	c.Assert(loader.batchSize, check.Equals, 10)
+	c.Assert(batch.limit, check.Equals, 10*4*execLimitMultiple)
+
+	loader.SetBatchSize(100)
+	loader.applyPendingOptions(batch)
+	c.Assert(loader.workerCount, check.Equals, 4)
+	c.Assert(loader.batchSize, check.Equals, 100)
+	c.Assert(batch.limit, check.Equals, 100*4*execLimitMultiple)
+}
+
 func (cs *LoadSuite) TestGetExecutor(c *check.C) {
 	db, _, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
@@ -222,6 +266,84 @@ func (s *getTblInfoSuite) TestShouldCacheResult(c *check.C) {
 	c.Assert(nCalled, check.Equals, 1)
 }
 
+func (s *getTblInfoSuite) TestShouldCreateMissingTable(c *check.C) {
+	origGet := utilGetTableInfo
+	created := false
+	utilGetTableInfo = func(db *sql.DB, schema string, table string) (info *tableInfo, err error) {
+		if !created || table != "t" {
+			return nil, ErrTableNotExist
+		}
+		return &tableInfo{columns: []string{"id"}}, nil
+	}
+	defer func() {
+		utilGetTableInfo = origGet
+	}()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	// not created if no TableCreator
+	ld := &loaderImpl{db: db, ctx: context.Background()}
+	_, err = ld.getTableInfo("test", "t")
+	c.Assert(errors.Cause(err), check.Equals, ErrTableNotExist)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `t`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	ld.tableCreator = func(database string, table string) (string, error) {
+		created = true
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(id int primary key)", quoteName(table)), nil
+	}
+	info, err := ld.getTableInfo("test", "t")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"id"})
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	ld.tableCreator = func(database string, table string) (string, error) {
+		return "", errors.New("unknown table")
+	}
+	_, err = ld.getTableInfo("test", "t2")
+	c.Assert(err, check.ErrorMatches, "get create table statement of `test`.`t2`: unknown table")
+}
+
+type appendOnlySuite struct{}
+
+var _ = check.Suite(&appendOnlySuite{})
+
+func (s *appendOnlySuite) TestSplitAppendOnly(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, AppendOnlyTables(filter.TableName{Schema: "test", Table: "Events"}))
+	c.Assert(err, check.IsNil)
+	loader := ld.(*loaderImpl)
+
+	event := &DML{Database: "test", Table: "events", Tp: InsertDMLType}
+	user := &DML{Database: "test", Table: "users", Tp: UpdateDMLType}
+	appendOnly, others, err := loader.splitAppendOnly([]*DML{event, user, event})
+	c.Assert(err, check.IsNil)
+	c.Assert(appendOnly, check.DeepEquals, map[string][]*DML{"`test`.`events`": {event, event}})
+	c.Assert(others, check.DeepEquals, []*DML{user})
+
+	deleteEvent := &DML{Database: "test", Table: "events", Tp: DeleteDMLType, Values: map[string]interface{}{"id": 1}}
+	_, _, err = loader.splitAppendOnly([]*DML{event, deleteEvent})
+	c.Assert(err, check.ErrorMatches, "table `test`.`events` is declared append-only, but got .*")
+
+	// no append-only tables
+	loader.appendOnlyTables = nil
+	appendOnly, others, err = loader.splitAppendOnly([]*DML{event, user})
+	c.Assert(err, check.IsNil)
+	c.Assert(appendOnly, check.HasLen, 0)
+	c.Assert(others, check.HasLen, 2)
+}
+
 type isCreateDBDDLSuite struct{}
 
 var _ = check.Suite(&isCreateDBDDLSuite{})
@@ -240,6 +362,18 @@ func (s *isCreateDBDDLSuite) TestCreateDBSQL(c *check.C) {
 	c.Assert(isCreateDatabaseDDL("create database `db2`;"), check.IsTrue)
 }
 
+type splitDDLSuite struct{}
+
+var _ = check.Suite(&splitDDLSuite{})
+
+func (s *splitDDLSuite) TestSplitDDL(c *check.C) {
+	c.Assert(splitDDL("create table t (id int)"), check.DeepEquals, []string{"create table t (id int)"})
+	// executed as it is if it can't be parsed
+	c.Assert(splitDDL("create table t (id int; drop table t"), check.DeepEquals, []string{"create table t (id int; drop table t"})
+	c.Assert(splitDDL("CREATE DATABASE IF NOT EXISTS `r`; RENAME TABLE `db`.`t` TO `r`.`t_1`; CREATE TABLE `db`.`t` LIKE `r`.`t_1`"),
+		check.DeepEquals, []string{"CREATE DATABASE IF NOT EXISTS `r`;", "RENAME TABLE `db`.`t` TO `r`.`t_1`;", "CREATE TABLE `db`.`t` LIKE `r`.`t_1`"})
+}
+
 type needRefreshTableInfoSuite struct{}
 
 var _ = check.Suite(&needRefreshTableInfoSuite{})
@@ -346,6 +480,35 @@ func (s *batchManagerSuite) TestShouldHandleDDLError(c *check.C) {
 	c.Assert(nCalled, check.Equals, 1)
 }
 
+func (s *batchManagerSuite) TestLogWithFields(c *check.C) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core).With(zap.String("task", "task-1"))
+
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	ld, err := NewLoader(db, Logger(logger))
+	c.Assert(err, check.IsNil)
+	bm := newBatchManager(ld.(*loaderImpl))
+	bm.fExecDDL = func(ddl *DDL) error {
+		return errors.New("DDL")
+	}
+
+	txn := Txn{
+		DDL:      &DDL{Database: "test", Table: "Hey", SQL: "CREATE"},
+		CommitTS: 42,
+	}
+	err = bm.put(&txn)
+	c.Assert(err, check.ErrorMatches, "DDL")
+
+	entries := logs.FilterMessage("exec failed").All()
+	c.Assert(entries, check.HasLen, 1)
+	fields := entries[0].ContextMap()
+	c.Assert(fields["task"], check.Equals, "task-1")
+	c.Assert(fields["table"], check.Equals, "`test`.`Hey`")
+	c.Assert(fields["commit ts"], check.Equals, int64(42))
+}
+
 func (s *batchManagerSuite) TestShouldExecAccumulatedDMLs(c *check.C) {
 	var executed []*DML
 	var calledback []*Txn
@@ -564,6 +727,51 @@ func (s *runSuite) TestShouldExecuteAllPendingDMLsOnClose(c *check.C) {
 	c.Assert(cbTxns, check.HasLen, 7)
 }
 
+func (s *runSuite) TestFlush(c *check.C) {
+	var executed []*DML
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: 1024,
+			fExecDMLs: func(dmls []*DML) error {
+				executed = append(executed, dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: s.markSuccess,
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:      make(chan *Txn, 10),
+		successTxn: make(chan *Txn, 10),
+		done:       make(chan struct{}),
+	}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- loader.Run()
+	}()
+
+	loader.input <- &Txn{CommitTS: 1, DMLs: []*DML{{Tp: InsertDMLType}}}
+	loader.input <- &Txn{CommitTS: 2, DMLs: []*DML{{Tp: InsertDMLType}, {Tp: DeleteDMLType}}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	appliedTS, err := loader.Flush(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(appliedTS, check.Equals, int64(2))
+	c.Assert(executed, check.HasLen, 3)
+	c.Assert(loader.successTxn, check.HasLen, 2)
+
+	close(loader.input)
+	c.Assert(<-runErr, check.IsNil)
+
+	// Run has returned
+	loader = &loaderImpl{input: make(chan *Txn), done: make(chan struct{})}
+	close(loader.done)
+	_, err = loader.Flush(ctx)
+	c.Assert(err, check.ErrorMatches, "loader is not running")
+}
+
 func (s *runSuite) TestShouldFlushWhenInputIsEmpty(c *check.C) {
 	executed := make(chan []*DML, 2)
 	origF := fNewBatchManager
@@ -613,6 +821,47 @@ func (s *runSuite) TestShouldFlushWhenInputIsEmpty(c *check.C) {
 	assertExecuted(7)
 }
 
+func (s *runSuite) TestShouldApplyTransforms(c *check.C) {
+	var executed []*DML
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: 1024,
+			fExecDMLs: func(dmls []*DML) error {
+				executed = append(executed, dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+			fExecDDL:             func(*DDL) error { return nil },
+			fDDLSuccessCallback:  func(*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	upper := func(dml *DML) error {
+		if dml.Table == "bad" {
+			return errors.New("test")
+		}
+		dml.Values["name"] = strings.ToUpper(dml.Values["name"].(string))
+		return nil
+	}
+
+	loader := &loaderImpl{
+		input:      make(chan *Txn, 10),
+		successTxn: make(chan *Txn, 10),
+		transforms: []Transform{upper},
+	}
+	loader.input <- &Txn{DMLs: []*DML{{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"name": "a"}}}}
+	loader.input <- NewDDLTxn("test", "t", "alter table t add column age int")
+	loader.input <- &Txn{CommitTS: 42, DMLs: []*DML{{Database: "test", Table: "bad", Tp: InsertDMLType}}}
+	close(loader.input)
+
+	err := loader.Run()
+	c.Assert(err, check.ErrorMatches, "transform dml of `test`.`bad` at commit ts 42: test")
+	c.Assert(executed, check.HasLen, 1)
+	c.Assert(executed[0].Values["name"], check.Equals, "A")
+}
+
 type markSuccessesSuite struct{}
 
 var _ = check.Suite(&markSuccessesSuite{})
@@ -654,3 +903,37 @@ func (ms *markSuccessesSuite) TestShouldSetAppliedTS(c *check.C) {
 	loader.markSuccess(txns...)
 	c.Assert(txns[len(txns)-1].AppliedTS, check.Equals, int64(88881234))
 }
+
+func (ms *markSuccessesSuite) TestShouldSetGTIDSet(c *check.C) {
+	origF := fGetGTIDExecuted
+	defer func() {
+		fGetGTIDExecuted = origF
+	}()
+	fGetGTIDExecuted = func(*sql.DB, FieldLogger) string {
+		return "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	}
+	loader := &loaderImpl{captureGTID: true, successTxn: make(chan *Txn, 64)}
+	loader.markSuccess([]*Txn{}...)
+	txns := []*Txn{{Metadata: 1}, {Metadata: 3}}
+	loader.markSuccess(txns...)
+	c.Assert(txns[0].GTIDSet, check.Equals, "")
+	c.Assert(txns[1].GTIDSet, check.Equals, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+
+	loader.captureGTID = false
+	txns = []*Txn{{Metadata: 5}}
+	loader.markSuccess(txns...)
+	c.Assert(txns[0].GTIDSet, check.Equals, "")
+}
+
+func (ms *markSuccessesSuite) TestTxnLatency(c *check.C) {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "txn_latency"})
+	loader := &loaderImpl{successTxn: make(chan *Txn, 64), metrics: &MetricsGroup{TxnLatencyHistogram: histogram}}
+	commitTS := int64(oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0))
+	// the txns without commit ts aren't observed
+	loader.markSuccess(&Txn{CommitTS: commitTS}, &Txn{Metadata: 1})
+
+	var metric io_prometheus_client.Metric
+	c.Assert(histogram.Write(&metric), check.IsNil)
+	c.Assert(metric.Histogram.GetSampleCount(), check.Equals, uint64(1))
+	c.Assert(metric.Histogram.GetSampleSum() >= time.Minute.Seconds(), check.IsTrue)
+}
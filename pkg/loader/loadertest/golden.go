@@ -0,0 +1,96 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadertest provides utilities to test the SQL statements generated by the loader
+// against golden files, so the changes of SQL generation can be reviewed as changes of
+// the golden files.
+package loadertest
+
+import (
+	"database/sql/driver"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+var update = flag.Bool("update-golden", false, "update the golden files with the generated statements")
+
+// CheckGolden checks the statements are the same as the ones in the golden file at path,
+// the golden file is overwritten instead if the test is run with -update-golden.
+func CheckGolden(c *check.C, path string, txns [][]loader.Statement) {
+	got := loader.FormatStatements(txns)
+
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		c.Assert(err, check.IsNil)
+		err = ioutil.WriteFile(path, []byte(got), 0644)
+		c.Assert(err, check.IsNil)
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil, check.Commentf("run the test with -update-golden to create the golden file"))
+	c.Assert(got, check.Equals, string(expected), check.Commentf("golden file %s", path))
+}
+
+// ExpectStatements sets the expectations of mock to the transactions executing the statements in order,
+// it can be used to check the loader executes exactly the statements of the golden files.
+func ExpectStatements(mock sqlmock.Sqlmock, txns [][]loader.Statement) {
+	for _, stmts := range txns {
+		mock.ExpectBegin()
+		for _, stmt := range stmts {
+			exec := mock.ExpectExec("^" + regexp.QuoteMeta(stmt.SQL) + "$")
+			if len(stmt.Args) > 0 {
+				exec.WithArgs(driverValues(stmt.Args)...)
+			}
+			exec.WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+	}
+}
+
+// ExpectTableSchema sets the expectations of mock to the queries the loader gets the information
+// of the table by, the table is described by schema.
+func ExpectTableSchema(mock sqlmock.Sqlmock, database string, table string, schema *loader.TableSchema) {
+	columns := sqlmock.NewRows([]string{"column_name", "extra", "is_nullable", "column_default"})
+	for _, column := range schema.Columns {
+		columns.AddRow(column, "", "YES", nil)
+	}
+	mock.ExpectQuery("information_schema.columns").WithArgs(database, table).WillReturnRows(columns)
+
+	indexes := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"})
+	for i, column := range schema.PrimaryKey {
+		indexes.AddRow(0, "PRIMARY", i+1, column)
+	}
+	for i, uk := range schema.UniqueKeys {
+		for j, column := range uk {
+			indexes.AddRow(0, fmt.Sprintf("uk_%d", i), j+1, column)
+		}
+	}
+	mock.ExpectQuery("information_schema.statistics").WithArgs(database, table).WillReturnRows(indexes)
+}
+
+func driverValues(args []interface{}) []driver.Value {
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg)
+	}
+	return values
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// FieldLogger writes the logs of loader with structured fields, e.g., the table and commit ts.
+// *zap.Logger implements it, and so can any logger compatible with zap, see Logger.
+type FieldLogger interface {
+	Debug(msg string, fields ...zap.Field)
+	Info(msg string, fields ...zap.Field)
+	Warn(msg string, fields ...zap.Field)
+	Error(msg string, fields ...zap.Field)
+}
+
+// defaultLogger returns the global logger if logger is nil
+func defaultLogger(logger FieldLogger) FieldLogger {
+	if l, ok := logger.(*zap.Logger); logger == nil || (ok && l == nil) {
+		return log.L()
+	}
+	return logger
+}
+
+// withFields returns the logger adding fields to each log of logger, like zap.Logger.With.
+func withFields(logger FieldLogger, fields ...zap.Field) FieldLogger {
+	if l, ok := logger.(*zap.Logger); ok {
+		return l.With(fields...)
+	}
+	return &fieldsLogger{logger: logger, fields: fields}
+}
+
+type fieldsLogger struct {
+	logger FieldLogger
+	fields []zap.Field
+}
+
+func (l *fieldsLogger) with(fields []zap.Field) []zap.Field {
+	res := make([]zap.Field, 0, len(l.fields)+len(fields))
+	return append(append(res, l.fields...), fields...)
+}
+
+func (l *fieldsLogger) Debug(msg string, fields ...zap.Field) {
+	l.logger.Debug(msg, l.with(fields)...)
+}
+
+func (l *fieldsLogger) Info(msg string, fields ...zap.Field) {
+	l.logger.Info(msg, l.with(fields)...)
+}
+
+func (l *fieldsLogger) Warn(msg string, fields ...zap.Field) {
+	l.logger.Warn(msg, l.with(fields)...)
+}
+
+func (l *fieldsLogger) Error(msg string, fields ...zap.Field) {
+	l.logger.Error(msg, l.with(fields)...)
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"errors"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type loggerSuite struct{}
+
+var _ = check.Suite(&loggerSuite{})
+
+// recordLogger is a FieldLogger not based on zap, it records the logs with their fields
+type recordLogger struct {
+	logs []recordLog
+}
+
+type recordLog struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+func (l *recordLogger) record(level string, msg string, fields []zap.Field) {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	l.logs = append(l.logs, recordLog{level: level, msg: msg, fields: enc.Fields})
+}
+
+func (l *recordLogger) Debug(msg string, fields ...zap.Field) { l.record("debug", msg, fields) }
+func (l *recordLogger) Info(msg string, fields ...zap.Field)  { l.record("info", msg, fields) }
+func (l *recordLogger) Warn(msg string, fields ...zap.Field)  { l.record("warn", msg, fields) }
+func (l *recordLogger) Error(msg string, fields ...zap.Field) { l.record("error", msg, fields) }
+
+func (s *loggerSuite) TestDefaultLogger(c *check.C) {
+	c.Assert(defaultLogger(nil), check.Equals, FieldLogger(log.L()))
+	var nilLogger *zap.Logger
+	c.Assert(defaultLogger(nilLogger), check.Equals, FieldLogger(log.L()))
+
+	logger := new(recordLogger)
+	c.Assert(defaultLogger(logger), check.Equals, FieldLogger(logger))
+}
+
+func (s *loggerSuite) TestWithFields(c *check.C) {
+	logger := new(recordLogger)
+	withFields(logger, zap.String("table", "`test`.`t`")).Warn("exec failed", zap.Int64("commit ts", 42))
+	c.Assert(logger.logs, check.DeepEquals, []recordLog{{
+		level:  "warn",
+		msg:    "exec failed",
+		fields: map[string]interface{}{"table": "`test`.`t`", "commit ts": int64(42)},
+	}})
+
+	_, ok := withFields(log.L(), zap.String("table", "t")).(*zap.Logger)
+	c.Assert(ok, check.IsTrue)
+}
+
+func (s *loggerSuite) TestInjectLogger(c *check.C) {
+	logger := new(recordLogger)
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	ld, err := NewLoader(db, Logger(logger))
+	c.Assert(err, check.IsNil)
+	bm := newBatchManager(ld.(*loaderImpl))
+	bm.fExecDDL = func(ddl *DDL) error {
+		return errors.New("DDL")
+	}
+
+	err = bm.put(&Txn{DDL: &DDL{Database: "test", Table: "t", SQL: "CREATE"}, CommitTS: 42})
+	c.Assert(err, check.ErrorMatches, "DDL")
+
+	var found bool
+	for _, l := range logger.logs {
+		if l.msg == "exec failed" {
+			found = true
+			c.Assert(l.fields["table"], check.Equals, "`test`.`t`")
+			c.Assert(l.fields["commit ts"], check.Equals, int64(42))
+		}
+	}
+	c.Assert(found, check.IsTrue)
+}
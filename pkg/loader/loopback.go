@@ -0,0 +1,46 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	"go.uber.org/zap"
+)
+
+// loopbackControl returns true if the txns applied are marked, see LoopbackSync
+func (s *loaderImpl) loopbackControl() bool {
+	return s.loopbackSync != nil && s.loopbackSync.LoopbackControl
+}
+
+// createMarkTable creates the mark table in downstream if it doesn't exist
+func (s *loaderImpl) createMarkTable() error {
+	for _, sql := range loopbacksync.CreateMarkTableSQLs() {
+		if _, err := s.getDB().Exec(sql); err != nil {
+			return errors.Annotatef(err, "create mark table failed, sql: %s", sql)
+		}
+	}
+	s.getLogger().Info("mark table created", zap.String("table", quoteSchema(loopbacksync.MarkDB, loopbacksync.MarkTable)),
+		zap.Int64("channel id", s.loopbackSync.ChannelID))
+	return nil
+}
+
+// markStatement returns the statement writing the mark table in a txn, the rows of the channel are written
+// in turn so the concurrent txns rarely wait for each other
+func (s *loaderImpl) markStatement() Statement {
+	id := atomic.AddInt64(&s.markSeq, 1) % int64(s.workerCount)
+	return Statement{SQL: loopbacksync.MarkSQL, Args: []interface{}{id, s.loopbackSync.ChannelID}}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+)
+
+type loopbackSuite struct{}
+
+var _ = Suite(&loopbackSuite{})
+
+func (s *loopbackSuite) TestMarkStatement(c *C) {
+	loader := &loaderImpl{workerCount: 2, loopbackSync: loopbacksync.NewLoopBackSyncInfo(7, true, true)}
+	c.Assert(loader.markStatement().Args, DeepEquals, []interface{}{int64(1), int64(7)})
+	c.Assert(loader.markStatement().Args, DeepEquals, []interface{}{int64(0), int64(7)})
+	c.Assert(loader.markStatement().Args, DeepEquals, []interface{}{int64(1), int64(7)})
+}
+
+func (s *loopbackSuite) TestMarkTxn(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	loader := &loaderImpl{db: db, workerCount: 1, loopbackSync: loopbacksync.NewLoopBackSyncInfo(7, true, true)}
+
+	for _, sql := range loopbacksync.CreateMarkTableSQLs() {
+		mock.ExpectExec(regexp.QuoteMeta(sql)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	c.Assert(loader.createMarkTable(), IsNil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(loopbacksync.MarkSQL)).WithArgs(0, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	e := loader.getExecutor()
+	err = e.execStatements(nil, []Statement{{SQL: "DELETE FROM `db`.`tbl` WHERE `id` = ?", Args: []interface{}{1}}})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the txns are not marked without the loopback control
+	loader.loopbackSync.LoopbackControl = false
+	c.Assert(loader.getExecutor().markTxn, IsNil)
+}
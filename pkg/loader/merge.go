@@ -15,7 +15,6 @@ package loader
 
 import (
 	"github.com/pingcap/errors"
-	"github.com/pingcap/log"
 	"go.uber.org/zap"
 )
 
@@ -31,7 +30,9 @@ import (
 // update + delete -> delete
 // update + update -> update
 // update + insert -> -       invalid
-func mergeByPrimaryKey(dmls []*DML) (types map[DMLType][]*DML, err error) {
+// the DMLs returned are allocated from the pool, they must be released by releaseDMLs once the statements
+// are generated from them, the DMLs passed in are never modified.
+func mergeByPrimaryKey(dmls []*DML, logger FieldLogger) (types map[DMLType][]*DML, err error) {
 	if len(dmls) == 0 {
 		return
 	}
@@ -41,39 +42,21 @@ func mergeByPrimaryKey(dmls []*DML) (types map[DMLType][]*DML, err error) {
 		return nil, errors.Errorf("%s.%s no pk", dmls[0].Database, dmls[0].Table)
 	}
 
-	var res = make(map[string]*DML)
+	var res = make(map[string]*DML, len(dmls))
+	// keys in the order they first appear, so the result is deterministic
+	keys := make([]string, 0, len(dmls))
 
 	// if update primary key, replace update -> delete(old one) + insert(new one)
-	var tmpDmls []*DML
+	tmpDmls := make([]*DML, 0, len(dmls))
 	for _, dml := range dmls {
 		if dml.Tp == UpdateDMLType && dml.updateKey() {
-			deleteDML := &DML{
-				Database: dml.Database,
-				Table:    dml.Table,
-				Tp:       DeleteDMLType,
-				Values:   dml.OldValues,
-				info:     dml.info,
-			}
-			tmpDmls = append(tmpDmls, deleteDML)
-
-			insertDML := &DML{
-				Database:  dml.Database,
-				Table:     dml.Table,
-				Tp:        InsertDMLType,
-				Values:    dml.Values,
-				OldValues: nil,
-				info:      dml.info,
-			}
-			tmpDmls = append(tmpDmls, insertDML)
+			deleteDML, insertDML := dml.splitKeyUpdate()
+			tmpDmls = append(tmpDmls, deleteDML, insertDML)
 		} else {
-			tmpDML := &DML{
-				Database:  dml.Database,
-				Table:     dml.Table,
-				Tp:        dml.Tp,
-				Values:    dml.Values,
-				OldValues: dml.OldValues,
-				info:      dml.info,
-			}
+			tmpDML := newDML()
+			tmpDML.Database, tmpDML.Table, tmpDML.Tp = dml.Database, dml.Table, dml.Tp
+			tmpDML.Values, tmpDML.OldValues, tmpDML.info = dml.Values, dml.OldValues, dml.info
+			tmpDML.txn, tmpDML.epoch = dml.txn, dml.epoch
 
 			tmpDmls = append(tmpDmls, tmpDML)
 		}
@@ -85,6 +68,7 @@ func mergeByPrimaryKey(dmls []*DML) (types map[DMLType][]*DML, err error) {
 		oldDML, ok := res[key]
 		if !ok {
 			res[key] = dml
+			keys = append(keys, key)
 			continue
 		}
 
@@ -93,7 +77,7 @@ func mergeByPrimaryKey(dmls []*DML) (types map[DMLType][]*DML, err error) {
 			// ignore the previous delete
 			if oldDML.Tp == DeleteDMLType {
 			} else if oldDML.Tp == UpdateDMLType || oldDML.Tp == InsertDMLType {
-				log.Warn("update-insert/insert-insert happen", zap.Reflect("before", oldDML), zap.Reflect("after", dml))
+				logger.Warn("update-insert/insert-insert happen", zap.String("table", dml.TableName()), zap.Stringer("before", oldDML), zap.Stringer("after", dml))
 			}
 			res[key] = dml
 		case DeleteDMLType:
@@ -109,17 +93,20 @@ func mergeByPrimaryKey(dmls []*DML) (types map[DMLType][]*DML, err error) {
 				dml.OldValues = oldDML.OldValues
 			} else if oldDML.Tp == DeleteDMLType {
 				// delete + update -> invalid
-				log.Warn("abnormal case delete + update, just remain update now")
+				logger.Warn("abnormal case delete + update, just remain update now", zap.String("table", dml.TableName()))
 			}
 			res[key] = dml
 
 		default:
 			return nil, errors.Errorf("unknown tp: %v", dml.Tp)
 		}
+		// the DML merged is replaced by dml
+		putDML(oldDML)
 	}
 
-	types = make(map[DMLType][]*DML)
-	for _, dml := range res {
+	types = make(map[DMLType][]*DML, 3)
+	for _, key := range keys {
+		dml := res[key]
 		dmls = types[dml.Tp]
 		dmls = append(dmls, dml)
 		types[dml.Tp] = dmls
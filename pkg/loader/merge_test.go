@@ -17,6 +17,7 @@ import (
 	"math/rand"
 
 	check "github.com/pingcap/check"
+	"github.com/pingcap/log"
 )
 
 type modelSuite struct {
@@ -121,7 +122,7 @@ func (m *modelSuite) TestMerge(c *check.C) {
 		logDMLs(dmls[i:end], c)
 		kv = apply(kv, dmls[i:end])
 
-		res, err := mergeByPrimaryKey(dmls[i:end])
+		res, err := mergeByPrimaryKey(dmls[i:end], log.L())
 		c.Assert(err, check.IsNil)
 
 		noMergeNumber := end - i
@@ -148,6 +149,34 @@ func (m *modelSuite) TestMerge(c *check.C) {
 	}
 }
 
+func (m *modelSuite) TestMergeKeepsTxn(c *check.C) {
+	info := &tableInfo{
+		columns:    []string{"k", "v"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"k"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+
+	txn1, txn2 := &Txn{CommitTS: 1}, &Txn{CommitTS: 2}
+	dmls := []*DML{
+		{Tp: InsertDMLType, Values: map[string]interface{}{"k": 1, "v": 1}, info: info, txn: txn1, epoch: 3},
+		{Tp: UpdateDMLType, Values: map[string]interface{}{"k": 1, "v": 2}, OldValues: map[string]interface{}{"k": 1, "v": 1},
+			info: info, txn: txn2, epoch: 3},
+		{Tp: UpdateDMLType, Values: map[string]interface{}{"k": 3, "v": 2}, OldValues: map[string]interface{}{"k": 2, "v": 2},
+			info: info, txn: txn2, epoch: 3},
+	}
+	res, err := mergeByPrimaryKey(dmls, log.L())
+	c.Assert(err, check.IsNil)
+	defer releaseDMLs(res)
+
+	// insert + update -> insert of the later txn, the update of key -> delete + insert
+	c.Assert(res[InsertDMLType], check.HasLen, 2)
+	c.Assert(res[DeleteDMLType], check.HasLen, 1)
+	for _, merged := range append(res[InsertDMLType], res[DeleteDMLType]...) {
+		c.Assert(merged.txn, check.Equals, txn2)
+		c.Assert(merged.epoch, check.Equals, uint64(3))
+	}
+}
+
 func logDMLs(dmls []*DML, c *check.C) {
 	c.Log("dmls: ", len(dmls))
 	for _, dml := range dmls {
@@ -14,11 +14,16 @@
 package loader
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	"github.com/pingcap/tidb/types"
 	"go.uber.org/zap"
 )
 
@@ -33,19 +38,33 @@ const (
 	DeleteDMLType  DMLType = 3
 )
 
-// DML holds the dml info
+// DML holds the change of a row, it's built by NewInsert, NewUpdate or NewDelete and pushed into the loader
+// in a Txn. The SQL it's applied by is generated from the table info of downstream, see SQL, ReplaceSQL and
+// DeleteSQL for the statements of a given TableSchema.
 type DML struct {
 	Database string
 	Table    string
 
 	Tp DMLType
-	// only set when Tp = UpdateDMLType
+	// the row before the update, keyed by the column names, only set when Tp = UpdateDMLType
 	OldValues map[string]interface{}
-	Values    map[string]interface{}
+	// the row inserted, deleted or after the update, keyed by the column names
+	Values map[string]interface{}
 
 	info *tableInfo
+	// the epoch of the txn, which is separated by the barriers, see Barrier
+	epoch uint64
+	// the txn of the DML, set when it's put in batchManager
+	txn *Txn
 }
 
+// Transform changes the values of the DML before it's executed, e.g., encrypts some columns
+type Transform func(dml *DML) error
+
+// TableCreator returns the statement creating the table missing in downstream, e.g., generated from
+// the table info of upstream, it's executed in the database of the table.
+type TableCreator func(database string, table string) (sql string, err error)
+
 // DDL holds the ddl info
 type DDL struct {
 	Database string
@@ -59,10 +78,24 @@ type Txn struct {
 	DDL  *DDL
 
 	AppliedTS int64
+	// the GTID set executed in the downstream MySQL after the txn is committed, it's only set for
+	// the last txn of a batch by CaptureGTID
+	GTIDSet string
+	// CommitTS is the commit ts of the txn in upstream, it's optional and
+	// only used to track the applied ts of each table.
+	CommitTS int64
+	// Source is the upstream source of the txn, it's optional and set by MultiSource, the DMLs of the txn are
+	// resolved by ConflictSourcePriority as written by it instead of the source of the loader.
+	Source string
 
 	// This field is used to hold arbitrary data you wish to include so it
 	// will be available when receiving on the Successes channel
 	Metadata interface{}
+
+	// not nil means it's a flush request sent by Loader.Flush, not a txn to load
+	flush chan int64
+	// the sequence in the input, only set by PriorityLane
+	seq uint64
 }
 
 // AppendDML append a dml
@@ -127,7 +160,7 @@ func (dml *DML) updateKey() bool {
 	oldValues := dml.oldPrimaryKeyValues()
 
 	for i := 0; i < len(values); i++ {
-		if values[i] != oldValues[i] {
+		if !valueEqual(values[i], oldValues[i]) {
 			return true
 		}
 	}
@@ -135,6 +168,29 @@ func (dml *DML) updateKey() bool {
 	return false
 }
 
+// splitKeyUpdate returns the delete of the old row and the insert of the new row of an update
+// changing the primary key, executing the delete before the insert is equivalent to the update.
+// They're allocated from the pool and must be released by putDML.
+func (dml *DML) splitKeyUpdate() (del *DML, ins *DML) {
+	del = newDML()
+	del.Database, del.Table, del.Tp, del.Values, del.info = dml.Database, dml.Table, DeleteDMLType, dml.OldValues, dml.info
+	ins = newDML()
+	ins.Database, ins.Table, ins.Tp, ins.Values, ins.info = dml.Database, dml.Table, InsertDMLType, dml.Values, dml.info
+	del.txn, del.epoch = dml.txn, dml.epoch
+	ins.txn, ins.epoch = dml.txn, dml.epoch
+	return
+}
+
+// valueEqual compares the column values, []byte values are not comparable by ==
+func valueEqual(a, b interface{}) bool {
+	ab, aok := a.([]byte)
+	bb, bok := b.([]byte)
+	if aok || bok {
+		return aok && bok && bytes.Equal(ab, bb)
+	}
+	return a == b
+}
+
 func (dml *DML) String() string {
 	return fmt.Sprintf("{db: %s, table: %s,tp: %v values: %d old_values: %d}",
 		dml.Database, dml.Table, dml.Tp, len(dml.Values), len(dml.OldValues))
@@ -161,43 +217,74 @@ func (dml *DML) TableName() string {
 	return quoteSchema(dml.Database, dml.Table)
 }
 
-func (dml *DML) updateSQL() (sql string, args []interface{}) {
-	builder := new(strings.Builder)
+// verb returns verb followed by the hint of the table if any, the optimizer hints only take effect
+// right after the verb of the statement
+func (dml *DML) verb(verb string) string {
+	if dml.info == nil || len(dml.info.hint) == 0 {
+		return verb
+	}
+	return verb + " " + dml.info.hint
+}
 
-	fmt.Fprintf(builder, "UPDATE %s SET ", dml.TableName())
+func (dml *DML) updateSQL() (sql string, args []interface{}) {
+	builder := getBuffer()
+	defer putBuffer(builder)
+
+	builder.WriteString(dml.verb("UPDATE"))
+	builder.WriteByte(' ')
+	builder.WriteString(dml.TableName())
+	builder.WriteString(" SET ")
+
+	// sort the columns to generate the same SQL for the same DML
+	names := make([]string, 0, len(dml.Values))
+	for name := range dml.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	for name, arg := range dml.Values {
+	args = getArgs(len(names) + len(dml.info.columns))
+	for _, name := range names {
 		if len(args) > 0 {
 			builder.WriteByte(',')
 		}
-		fmt.Fprintf(builder, "%s = ?", quoteName(name))
-		args = append(args, arg)
+		builder.WriteString(quoteName(name))
+		builder.WriteString(" = ?")
+		args = append(args, dml.Values[name])
+	}
+	for _, col := range dml.info.virtual {
+		builder.WriteByte(',')
+		builder.WriteString(quoteName(col.name))
+		builder.WriteString(" = ")
+		builder.WriteString(col.expr)
 	}
+	args = dml.appendVirtualArgs(args)
 
 	builder.WriteString(" WHERE ")
 
-	whereArgs := dml.buildWhere(builder)
-	args = append(args, whereArgs...)
+	args = dml.buildWhere(builder, args)
 
 	builder.WriteString(" LIMIT 1")
 	sql = builder.String()
 	return
 }
 
-func (dml *DML) buildWhere(builder *strings.Builder) (args []interface{}) {
+// buildWhere writes the WHERE conditions of dml to builder and returns args appended with their arguments
+func (dml *DML) buildWhere(builder *bytes.Buffer, args []interface{}) []interface{} {
 	wnames, wargs := dml.whereSlice()
 	for i := 0; i < len(wnames); i++ {
 		if i > 0 {
 			builder.WriteString(" AND ")
 		}
 		if wargs[i] == nil {
-			builder.WriteString(quoteName(wnames[i]) + " IS NULL")
+			builder.WriteString(quoteName(wnames[i]))
+			builder.WriteString(" IS NULL")
 		} else {
-			builder.WriteString(quoteName(wnames[i]) + " = ?")
+			builder.WriteString(quoteName(wnames[i]))
+			builder.WriteString(" = ?")
 			args = append(args, wargs[i])
 		}
 	}
-	return
+	return args
 }
 
 func (dml *DML) whereValues(names []string) (values []interface{}) {
@@ -234,10 +321,14 @@ func (dml *DML) whereSlice() (colNames []string, args []interface{}) {
 }
 
 func (dml *DML) deleteSQL() (sql string, args []interface{}) {
-	builder := new(strings.Builder)
+	builder := getBuffer()
+	defer putBuffer(builder)
 
-	fmt.Fprintf(builder, "DELETE FROM %s WHERE ", dml.TableName())
-	args = dml.buildWhere(builder)
+	builder.WriteString(dml.verb("DELETE"))
+	builder.WriteString(" FROM ")
+	builder.WriteString(dml.TableName())
+	builder.WriteString(" WHERE ")
+	args = dml.buildWhere(builder, getArgs(len(dml.info.columns)))
 	builder.WriteString(" LIMIT 1")
 
 	sql = builder.String()
@@ -246,11 +337,14 @@ func (dml *DML) deleteSQL() (sql string, args []interface{}) {
 
 func (dml *DML) replaceSQL() (sql string, args []interface{}) {
 	info := dml.info
-	sql = fmt.Sprintf("REPLACE INTO %s(%s) VALUES(%s)", dml.TableName(), buildColumnList(info.columns), holderString(len(info.columns)))
+	sql = fmt.Sprintf("%s INTO %s(%s%s) VALUES(%s%s)", dml.verb("REPLACE"), dml.TableName(), buildColumnList(info.columns),
+		dml.virtualColumnList(), holderString(len(info.columns)), dml.virtualValues())
+	args = getArgs(len(info.columns))
 	for _, name := range info.columns {
 		v := dml.Values[name]
 		args = append(args, v)
 	}
+	args = dml.appendVirtualArgs(args)
 	return
 }
 
@@ -270,13 +364,14 @@ func (dml *DML) sql() (sql string, args []interface{}) {
 		return dml.deleteSQL()
 	}
 
-	log.Debug("get sql for dml", zap.Reflect("dml", dml), zap.String("sql", sql), zap.Reflect("args", args))
+	log.Debug("get sql for dml", zap.Stringer("dml", dml), zap.String("sql", sql), zap.Reflect("args", mask.Args(dml.Database, dml.Table, args)))
 
 	return
 }
 
 func formatKey(values []interface{}) string {
-	builder := new(strings.Builder)
+	builder := getBuffer()
+	defer putBuffer(builder)
 	for i, v := range values {
 		if i != 0 {
 			builder.WriteString("--")
@@ -288,7 +383,8 @@ func formatKey(values []interface{}) string {
 }
 
 func getKey(names []string, values map[string]interface{}) string {
-	builder := new(strings.Builder)
+	builder := getBuffer()
+	defer putBuffer(builder)
 	for _, name := range names {
 		v := values[name]
 		if v == nil {
@@ -341,3 +437,31 @@ func getKeys(dml *DML) (keys []string) {
 
 	return
 }
+
+// exactValues replaces the values of dml which may lose precision when passed to the driver by exactValue
+func exactValues(dml *DML) {
+	for name, v := range dml.Values {
+		dml.Values[name] = exactValue(v)
+	}
+	for name, v := range dml.OldValues {
+		dml.OldValues[name] = exactValue(v)
+	}
+}
+
+// exactValue returns the value passed to the driver without losing precision: the uint64 values above
+// math.MaxInt64 (unsigned BIGINT) are rejected by the default converter of database/sql, and the DECIMAL
+// values decoded by TiDB are not supported by the driver and must not be passed as float64, so they're
+// passed as their decimal strings instead, which are converted to the column type exactly by downstream.
+func exactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			return strconv.FormatUint(v, 10)
+		}
+	case *types.MyDecimal:
+		if v != nil {
+			return v.String()
+		}
+	}
+	return v
+}
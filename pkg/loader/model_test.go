@@ -14,9 +14,12 @@
 package loader
 
 import (
+	"bytes"
+	"math"
 	"strings"
 
 	check "github.com/pingcap/check"
+	"github.com/pingcap/tidb/types"
 )
 
 type dmlSuite struct {
@@ -65,8 +68,8 @@ func (d *dmlSuite) testWhere(c *check.C, tp DMLType) {
 	c.Assert(names, check.DeepEquals, []string{"id"})
 	c.Assert(args, check.DeepEquals, []interface{}{1})
 
-	builder := new(strings.Builder)
-	args = dml.buildWhere(builder)
+	builder := new(bytes.Buffer)
+	args = dml.buildWhere(builder, nil)
 	c.Assert(args, check.DeepEquals, []interface{}{1})
 	c.Assert(strings.Count(builder.String(), "?"), check.Equals, len(args))
 
@@ -83,14 +86,14 @@ func (d *dmlSuite) testWhere(c *check.C, tp DMLType) {
 	c.Assert(args, check.DeepEquals, []interface{}{1, 1})
 
 	builder.Reset()
-	args = dml.buildWhere(builder)
+	args = dml.buildWhere(builder, nil)
 	c.Assert(args, check.DeepEquals, []interface{}{1, 1})
 	c.Assert(strings.Count(builder.String(), "?"), check.Equals, len(args))
 
 	// set a1 to NULL value
 	values["a1"] = nil
 	builder.Reset()
-	args = dml.buildWhere(builder)
+	args = dml.buildWhere(builder, nil)
 	c.Assert(args, check.DeepEquals, []interface{}{1})
 	c.Assert(strings.Count(builder.String(), "?"), check.Equals, len(args))
 }
@@ -228,3 +231,45 @@ func (s *SQLSuite) TestUpdateSQL(c *check.C) {
 	c.Assert(args[0], check.Equals, "pc")
 	c.Assert(args[1], check.Equals, "pingcap")
 }
+
+func (s *SQLSuite) TestUpdateKey(c *check.C) {
+	info := &tableInfo{
+		columns:    []string{"id", "name"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+
+	dml := DML{
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": []byte("a"), "name": "pc"},
+		OldValues: map[string]interface{}{"id": []byte("a"), "name": "pingcap"},
+		info:      info,
+	}
+	c.Assert(dml.updateKey(), check.IsFalse)
+
+	dml.Values["id"] = []byte("b")
+	c.Assert(dml.updateKey(), check.IsTrue)
+
+	del, ins := dml.splitKeyUpdate()
+	c.Assert(del.Tp, check.Equals, DeleteDMLType)
+	c.Assert(del.Values, check.DeepEquals, dml.OldValues)
+	c.Assert(ins.Tp, check.Equals, InsertDMLType)
+	c.Assert(ins.Values, check.DeepEquals, dml.Values)
+	c.Assert(ins.OldValues, check.IsNil)
+}
+
+func (s *SQLSuite) TestExactValues(c *check.C) {
+	dec := new(types.MyDecimal)
+	c.Assert(dec.FromString([]byte("-12345678901234567890.123456789012345678")), check.IsNil)
+
+	dml := DML{
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"u": uint64(math.MaxUint64), "d": dec, "f": 0.1, "n": nil},
+		OldValues: map[string]interface{}{"u": uint64(math.MaxInt64), "d": "1.10"},
+	}
+	exactValues(&dml)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{
+		"u": "18446744073709551615", "d": "-12345678901234567890.123456789012345678", "f": 0.1, "n": nil,
+	})
+	c.Assert(dml.OldValues, check.DeepEquals, map[string]interface{}{"u": uint64(math.MaxInt64), "d": "1.10"})
+}
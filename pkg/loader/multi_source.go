@@ -0,0 +1,174 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// MultiSource merges the txns of several upstream sources, e.g., the TiDB clusters or the shards merged into one
+// downstream, into one Loader. Each source has its own input, the txns are tagged by Txn.Source and fed to the
+// Loader in the order they're received, so the DMLs of the same key from different sources are serialized by the
+// Loader as the ones of the same source, and the DDLs of any source wait for the DMLs fed before them. The commit ts
+// of the last txn of each source loaded is tracked as its checkpoint, which is where to resume the source from.
+//
+// The commit ts of the txns of a source must be increasing, the txns not after the checkpoint of their source are
+// skipped as they have been loaded. See ConflictResolution to resolve the rows written by different sources.
+type MultiSource struct {
+	inputs    map[string]chan *Txn
+	successes chan *Txn
+
+	// the commit ts of the last txn of each source loaded or skipped, protected by mu
+	mu          sync.Mutex
+	checkpoints map[string]int64
+}
+
+// NewMultiSource returns a MultiSource of the sources in checkpoints, which are the commit ts of the last txns loaded
+// of the sources, 0 means none is loaded.
+func NewMultiSource(checkpoints map[string]int64) (*MultiSource, error) {
+	if len(checkpoints) == 0 {
+		return nil, errors.New("no source to merge")
+	}
+	m := &MultiSource{
+		inputs:      make(map[string]chan *Txn, len(checkpoints)),
+		successes:   make(chan *Txn),
+		checkpoints: make(map[string]int64, len(checkpoints)),
+	}
+	for source, ts := range checkpoints {
+		if len(source) == 0 {
+			return nil, errors.New("the name of the source can't be empty")
+		}
+		m.inputs[source] = make(chan *Txn)
+		m.checkpoints[source] = ts
+	}
+	return m, nil
+}
+
+// Sources returns the names of the sources in order
+func (m *MultiSource) Sources() []string {
+	sources := make([]string, 0, len(m.inputs))
+	for source := range m.inputs {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// Input receives the txns of the source, close it when there's no more txn of the source, nil if the source is unknown
+func (m *MultiSource) Input(source string) chan<- *Txn {
+	input, ok := m.inputs[source]
+	if !ok {
+		return nil
+	}
+	return input
+}
+
+// Successes returns the txns loaded in the order they're fed, with Txn.Source set, it replaces Loader.Successes,
+// which must not be consumed by others. It must be consumed and is closed when Run returns.
+func (m *MultiSource) Successes() <-chan *Txn {
+	return m.successes
+}
+
+// Checkpoints returns the commit ts of the last txn loaded of each source
+func (m *MultiSource) Checkpoints() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checkpoints := make(map[string]int64, len(m.checkpoints))
+	for source, ts := range m.checkpoints {
+		checkpoints[source] = ts
+	}
+	return checkpoints
+}
+
+// Run feeds the txns of the sources to ld until all the inputs are closed or ctx is done, then closes ld and returns
+// after the txns loaded are received from Successes. ld.Run must be run by the caller, and ctx must be canceled if
+// it fails, as the txns are no longer received by ld.
+func (m *MultiSource) Run(ctx context.Context, ld Loader) error {
+	var loaded sync.WaitGroup
+	loaded.Add(1)
+	go func() {
+		defer loaded.Done()
+		m.receiveSuccesses(ld)
+	}()
+
+	var fed sync.WaitGroup
+	for source, input := range m.inputs {
+		fed.Add(1)
+		go func(source string, input chan *Txn) {
+			defer fed.Done()
+			m.feed(ctx, ld, source, input)
+		}(source, input)
+	}
+	fed.Wait()
+
+	ld.Close()
+	loaded.Wait()
+	return nil
+}
+
+// feed feeds the txns of the source to ld until input is closed or ctx is done
+func (m *MultiSource) feed(ctx context.Context, ld Loader, source string, input chan *Txn) {
+	logger := withFields(log.L(), zap.String("source", source))
+	received := m.Checkpoints()[source]
+	for {
+		var txn *Txn
+		var ok bool
+		select {
+		case txn, ok = <-input:
+			if !ok {
+				logger.Info("all txns of the source are fed")
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		if txn.CommitTS > 0 {
+			if txn.CommitTS <= received {
+				logger.Info("skip the txn loaded", zap.Int64("commit ts", txn.CommitTS))
+				continue
+			}
+			received = txn.CommitTS
+		}
+		txn.Source = source
+
+		select {
+		case ld.Input() <- txn:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receiveSuccesses tracks the checkpoints of the sources by the txns loaded and passes them to Successes until
+// ld.Successes() is closed
+func (m *MultiSource) receiveSuccesses(ld Loader) {
+	defer close(m.successes)
+	for txn := range ld.Successes() {
+		if txn.CommitTS > 0 {
+			m.mu.Lock()
+			if ts, ok := m.checkpoints[txn.Source]; ok && txn.CommitTS > ts {
+				m.checkpoints[txn.Source] = txn.CommitTS
+			}
+			m.mu.Unlock()
+		}
+		m.successes <- txn
+	}
+}
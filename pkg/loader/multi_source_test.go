@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type multiSourceSuite struct{}
+
+var _ = Suite(&multiSourceSuite{})
+
+func (s *multiSourceSuite) TestNew(c *C) {
+	_, err := NewMultiSource(nil)
+	c.Assert(err, ErrorMatches, "no source to merge")
+	_, err = NewMultiSource(map[string]int64{"": 0})
+	c.Assert(err, ErrorMatches, ".*can't be empty")
+
+	m, err := NewMultiSource(map[string]int64{"dc2": 0, "dc1": 10})
+	c.Assert(err, IsNil)
+	c.Assert(m.Sources(), DeepEquals, []string{"dc1", "dc2"})
+	c.Assert(m.Input("dc1"), NotNil)
+	c.Assert(m.Input("dc3"), IsNil)
+	c.Assert(m.Checkpoints(), DeepEquals, map[string]int64{"dc1": 10, "dc2": 0})
+}
+
+func (s *multiSourceSuite) TestRun(c *C) {
+	m, err := NewMultiSource(map[string]int64{"dc1": 10, "dc2": 0})
+	c.Assert(err, IsNil)
+	ld := newSuccessLoader()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run(context.Background(), ld)
+	}()
+
+	var loaded []*Txn
+	received := make(chan struct{})
+	go func() {
+		for txn := range m.Successes() {
+			loaded = append(loaded, txn)
+		}
+		close(received)
+	}()
+
+	// the txn of dc1 loaded before is skipped
+	m.Input("dc1") <- &Txn{CommitTS: 10}
+	m.Input("dc1") <- &Txn{CommitTS: 11}
+	m.Input("dc2") <- &Txn{CommitTS: 5}
+	// the repeated txn is skipped
+	m.Input("dc2") <- &Txn{CommitTS: 5}
+	m.Input("dc1") <- &Txn{CommitTS: 12, Source: "other"}
+	close(m.Input("dc1"))
+	close(m.Input("dc2"))
+
+	select {
+	case err := <-done:
+		c.Assert(err, IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("Run doesn't return after the inputs are closed")
+	}
+	<-received
+
+	// the txns of different sources are fed concurrently
+	c.Assert(loaded, HasLen, 3)
+	sources := make(map[int64]string)
+	for _, txn := range loaded {
+		sources[txn.CommitTS] = txn.Source
+	}
+	c.Assert(sources, DeepEquals, map[int64]string{11: "dc1", 5: "dc2", 12: "dc1"})
+	c.Assert(m.Checkpoints(), DeepEquals, map[string]int64{"dc1": 12, "dc2": 5})
+}
+
+func (s *multiSourceSuite) TestCancel(c *C) {
+	m, err := NewMultiSource(map[string]int64{"dc1": 0})
+	c.Assert(err, IsNil)
+	ld := newSuccessLoader()
+	go func() {
+		for range m.Successes() {
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run(ctx, ld)
+	}()
+	m.Input("dc1") <- &Txn{CommitTS: 1}
+	cancel()
+
+	select {
+	case err := <-done:
+		c.Assert(err, IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("Run doesn't return after ctx is canceled")
+	}
+}
+
+func (s *multiSourceSuite) TestSourcePriority(c *C) {
+	conflict := &TableConflict{Policy: ConflictSourcePriority, Column: "version", Sources: []string{"dc2", "dc1"}}
+	dml := newConflictDML(InsertDMLType, conflict)
+	dml.txn.Source = "dc2"
+	c.Assert(dml.conflictVersion(), Equals, "dc2")
+}
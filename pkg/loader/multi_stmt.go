@@ -0,0 +1,79 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	tmysql "github.com/pingcap/parser/mysql"
+	"go.uber.org/zap"
+)
+
+// MultiStatements makes loader send several statements in one query, e.g., the bulk deletes and the DMLs batched
+// by DigestBatch, which requires multiStatements in the DSN of the db. If it's false, the statements are executed
+// one by one in the txn instead, and so they are once the downstream rejects a multi-statement query, e.g., the DSN
+// doesn't enable it, then the txn is retried. It's enabled by default.
+func MultiStatements(enable bool) Option {
+	return func(o *options) {
+		o.singleStatements = !enable
+	}
+}
+
+// multiStatements tells whether the db accepts several statements in one query, shared by the executors of a loader
+type multiStatements struct {
+	unavailable int32
+}
+
+func newMultiStatements(available bool) *multiStatements {
+	m := new(multiStatements)
+	if !available {
+		m.unavailable = 1
+	}
+	return m
+}
+
+// available returns true if the statements can be sent in one query, nil means they can
+func (m *multiStatements) available() bool {
+	return m == nil || atomic.LoadInt32(&m.unavailable) == 0
+}
+
+// checkRejected disables the multi-statement queries if err is the db rejecting the multi-statement query sql,
+// which is a syntax error as the server doesn't split the statements, it returns true if they're disabled by it
+func (m *multiStatements) checkRejected(sql string, err error, logger FieldLogger) bool {
+	if m == nil || !strings.Contains(sql, ";") {
+		return false
+	}
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	if !ok || mysqlErr.Number != tmysql.ErrParse {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&m.unavailable, 0, 1) {
+		logger.Warn("the downstream rejects the multi-statement queries, execute the statements one by one, "+
+			"enable multiStatements in the DSN to send them in one round trip", zap.Error(err))
+	}
+	return true
+}
+
+// checkRejectedStatements is checkRejected of any multi-statement query of stmts failing with err
+func (m *multiStatements) checkRejectedStatements(stmts []Statement, err error, logger FieldLogger) bool {
+	for _, stmt := range stmts {
+		if m.checkRejected(stmt.SQL, err, logger) {
+			return true
+		}
+	}
+	return false
+}
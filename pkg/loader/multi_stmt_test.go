@@ -0,0 +1,84 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+type multiStmtSuite struct{}
+
+var _ = Suite(&multiStmtSuite{})
+
+func (s *multiStmtSuite) TestFallback(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, DigestBatch(16))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+	c.Assert(s0.multiStatements.available(), IsTrue)
+
+	// the multi-statement query is rejected, and the txn is retried with the statements one by one
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`") + ".*;REPLACE INTO.*").
+		WillReturnError(&mysql.MySQLError{Number: tmysql.ErrParse, Message: "You have an error in your SQL syntax"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec("^" + regexp.QuoteMeta("DELETE FROM `db`.`tbl`") + "[^;]*$").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("^" + regexp.QuoteMeta("REPLACE INTO `db`.`tbl`") + "[^;]*$").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExecRetry(context.Background(), []*DML{newRowsCheckUpdate(), newRowsCheckUpdate()}, true, 2, time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(s0.multiStatements.available(), IsFalse)
+}
+
+func (s *multiStmtSuite) TestDisabled(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, MultiStatements(false))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+
+	del := func() *DML {
+		dml := newRowsCheckUpdate()
+		dml.Tp, dml.Values = DeleteDMLType, dml.OldValues
+		return dml
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("^" + regexp.QuoteMeta("DELETE FROM `db`.`tbl`") + "[^;]*$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^" + regexp.QuoteMeta("DELETE FROM `db`.`tbl`") + "[^;]*$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(s0.getExecutor().bulkDelete([]*DML{del(), del()}), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the other errors don't disable them
+	m := newMultiStatements(true)
+	c.Assert(m.checkRejected("DELETE 1;DELETE 2", &mysql.MySQLError{Number: tmysql.ErrDupEntry}, s0.logger), IsFalse)
+	c.Assert(m.checkRejected("DELETE 1", &mysql.MySQLError{Number: tmysql.ErrParse}, s0.logger), IsFalse)
+	c.Assert(m.available(), IsTrue)
+}
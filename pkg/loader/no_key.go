@@ -0,0 +1,66 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// NoKeyTablePolicy is how the DMLs of the tables without primary key or unique key are handled, their rows are
+// located by the values of all the columns, so an update or delete may affect a wrong row if the rows aren't unique.
+type NoKeyTablePolicy string
+
+// the policies of the tables without primary key or unique key
+const (
+	// NoKeyTableDegrade applies the DMLs by matching the full rows
+	NoKeyTableDegrade NoKeyTablePolicy = "degrade"
+	// NoKeyTableWarn applies the DMLs by matching the full rows, and logs a warning on the first update or delete of each table
+	NoKeyTableWarn NoKeyTablePolicy = "warn"
+	// NoKeyTableRefuse makes Run return an error on the first DML of the tables
+	NoKeyTableRefuse NoKeyTablePolicy = "refuse"
+)
+
+func (p NoKeyTablePolicy) validate() error {
+	switch p {
+	case NoKeyTableDegrade, NoKeyTableWarn, NoKeyTableRefuse:
+		return nil
+	}
+	return errors.Errorf("invalid no-key table policy: %s, must be %s, %s or %s", p, NoKeyTableDegrade, NoKeyTableWarn, NoKeyTableRefuse)
+}
+
+// NoKeyTables sets the policy of the tables without primary key or unique key, the default is NoKeyTableDegrade.
+// The tables are marked by TableStatus.NoKey.
+func NoKeyTables(policy NoKeyTablePolicy) Option {
+	return func(o *options) {
+		o.noKeyPolicy = policy
+	}
+}
+
+// checkNoKey applies the policy to the DML of a table without primary key or unique key
+func (s *loaderImpl) checkNoKey(dml *DML) error {
+	switch s.noKeyPolicy {
+	case NoKeyTableRefuse:
+		return errors.Errorf("table %s has no primary key or unique key, its DMLs are refused", dml.TableName())
+	case NoKeyTableWarn:
+		if dml.Tp == InsertDMLType {
+			return nil
+		}
+		if _, warned := s.noKeyWarned.LoadOrStore(dml.TableName(), struct{}{}); !warned {
+			s.getLogger().Warn("update or delete the table without primary key or unique key by matching the full row, it may affect a wrong row if the rows aren't unique",
+				zap.String("table", dml.TableName()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"database/sql"
+
+	. "github.com/pingcap/check"
+)
+
+type noKeySuite struct{}
+
+var _ = Suite(&noKeySuite{})
+
+func (s *noKeySuite) TestSetDMLInfo(c *C) {
+	noKey := &tableInfo{columns: []string{"a", "b"}}
+	keyed := &tableInfo{columns: []string{"id"}, uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}}}
+
+	origGet := utilGetTableInfo
+	utilGetTableInfo = func(db *sql.DB, schema string, table string) (*tableInfo, error) {
+		if table == "keyed" {
+			return keyed, nil
+		}
+		return noKey, nil
+	}
+	defer func() { utilGetTableInfo = origGet }()
+
+	tests := []struct {
+		policy NoKeyTablePolicy
+		dml    *DML
+		isErr  bool
+	}{
+		{NoKeyTableDegrade, &DML{Database: "test", Table: "t", Tp: UpdateDMLType}, false},
+		{NoKeyTableWarn, &DML{Database: "test", Table: "t", Tp: DeleteDMLType}, false},
+		{NoKeyTableRefuse, &DML{Database: "test", Table: "t", Tp: InsertDMLType}, true},
+		{NoKeyTableRefuse, &DML{Database: "test", Table: "keyed", Tp: UpdateDMLType}, false},
+	}
+
+	for _, test := range tests {
+		loader := &loaderImpl{noKeyPolicy: test.policy}
+		err := loader.setDMLInfo(test.dml)
+		c.Assert(err != nil, Equals, test.isErr, Commentf("%s %s: %v", test.policy, test.dml.Table, err))
+	}
+
+	loader := &loaderImpl{noKeyPolicy: NoKeyTableWarn}
+	c.Assert(loader.setDMLInfo(&DML{Database: "test", Table: "t", Tp: UpdateDMLType}), IsNil)
+	c.Assert(loader.setDMLInfo(&DML{Database: "test", Table: "keyed", Tp: UpdateDMLType}), IsNil)
+	_, warned := loader.noKeyWarned.Load("`test`.`t`")
+	c.Assert(warned, IsTrue)
+
+	status := loader.TableStatus()
+	c.Assert(status, HasLen, 2)
+	c.Assert(status[0].Table, Equals, "keyed")
+	c.Assert(status[0].NoKey, IsFalse)
+	c.Assert(status[1].Table, Equals, "t")
+	c.Assert(status[1].NoKey, IsTrue)
+}
+
+func (s *noKeySuite) TestInvalidPolicy(c *C) {
+	_, err := NewLoader(nil, NoKeyTables("ignore"))
+	c.Assert(err, ErrorMatches, ".*invalid no-key table policy.*")
+}
@@ -0,0 +1,346 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"go.uber.org/zap"
+)
+
+const defaultPauseBufferSize = 1000000
+
+// PauseBufferSize sets the max DMLs buffered for the paused tables, Run stops taking the txns input
+// until a table is resumed when it's reached, see Loader.PauseTable.
+func PauseBufferSize(n int) Option {
+	return func(o *options) {
+		o.pauseBufferSize = n
+	}
+}
+
+// tablePause buffers the DMLs of the paused tables, and holds the txns having them and the ones after them
+// from being reported until the DMLs are applied, so the checkpoint never passes the DMLs not applied.
+// The methods used by Run take nil as no table paused.
+type tablePause struct {
+	mu struct {
+		sync.Mutex
+		// the tables paused, keyed by the quoted table names
+		paused map[string]filter.TableName
+		// the tables resumed but not drained yet
+		resumed []filter.TableName
+	}
+	// wakes up Run waiting for the input to drain the tables resumed
+	resumeCh chan struct{}
+	limit    int
+
+	// the following are only accessed in Run
+
+	// the DMLs of the tables paused or not drained yet, in the order they're input
+	buffered map[string][]*DML
+	size     int
+	// the count of the DMLs buffered of each txn
+	pending map[*Txn]int
+	// the whole DMLs of the txns having any DML buffered, they're restored before the txns are reported
+	dmls map[*Txn][]*DML
+	// the txns succeeded waiting for the txns before them having DMLs buffered
+	queue []*Txn
+}
+
+func newTablePause(limit int) *tablePause {
+	p := &tablePause{
+		resumeCh: make(chan struct{}, 1),
+		limit:    limit,
+		buffered: make(map[string][]*DML),
+		pending:  make(map[*Txn]int),
+		dmls:     make(map[*Txn][]*DML),
+	}
+	p.mu.paused = make(map[string]filter.TableName)
+	return p
+}
+
+func (p *tablePause) pause(database string, table string) {
+	p.mu.Lock()
+	p.mu.paused[quoteSchema(database, table)] = filter.TableName{Schema: database, Table: table}
+	p.mu.Unlock()
+}
+
+// resume returns false if the table isn't paused
+func (p *tablePause) resume(database string, table string) bool {
+	key := quoteSchema(database, table)
+	p.mu.Lock()
+	name, ok := p.mu.paused[key]
+	if ok {
+		delete(p.mu.paused, key)
+		p.mu.resumed = append(p.mu.resumed, name)
+	}
+	p.mu.Unlock()
+
+	if ok {
+		select {
+		case p.resumeCh <- struct{}{}:
+		default:
+		}
+	}
+	return ok
+}
+
+// resumeMatched resumes the tables paused matched by the schema and table name, the empty table matches any,
+// it returns the tables resumed
+func (p *tablePause) resumeMatched(database string, table string) (resumed []filter.TableName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, name := range p.mu.paused {
+		if name.Schema == database && (len(table) == 0 || name.Table == table) {
+			delete(p.mu.paused, key)
+			p.mu.resumed = append(p.mu.resumed, name)
+			resumed = append(resumed, name)
+		}
+	}
+	return resumed
+}
+
+// resumeAll resumes all the tables paused
+func (p *tablePause) resumeAll() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, name := range p.mu.paused {
+		delete(p.mu.paused, key)
+		p.mu.resumed = append(p.mu.resumed, name)
+	}
+}
+
+// takeResumed returns the tables resumed since the last call and still not paused
+func (p *tablePause) takeResumed() []filter.TableName {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var resumed []filter.TableName
+	for _, name := range p.mu.resumed {
+		if _, ok := p.mu.paused[quoteSchema(name.Schema, name.Table)]; !ok {
+			resumed = append(resumed, name)
+		}
+	}
+	p.mu.resumed = nil
+	return resumed
+}
+
+// holds returns true if the DMLs of the table must be buffered, i.e., it's paused or its DMLs buffered
+// are not drained yet
+func (p *tablePause) holds(key string) bool {
+	if len(p.buffered[key]) > 0 {
+		return true
+	}
+	p.mu.Lock()
+	_, ok := p.mu.paused[key]
+	p.mu.Unlock()
+	return ok
+}
+
+// idle returns true if no table is paused or has DMLs buffered
+func (p *tablePause) idle() bool {
+	if p == nil {
+		return true
+	}
+	if len(p.buffered) > 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.mu.paused) == 0
+}
+
+// resumed returns the channel notified when a table is resumed, it's nil if p is nil
+func (p *tablePause) resumed() <-chan struct{} {
+	if p == nil {
+		return nil
+	}
+	return p.resumeCh
+}
+
+// hold buffers the DMLs of the paused tables of txn, the other DMLs are left in txn.DMLs,
+// it returns false if there's none
+func (p *tablePause) hold(txn *Txn, epoch uint64) bool {
+	var kept []*DML
+	held := false
+	for i, dml := range txn.DMLs {
+		key := dml.TableName()
+		if !p.holds(key) {
+			if held {
+				kept = append(kept, dml)
+			}
+			continue
+		}
+		if !held {
+			held = true
+			kept = append(kept, txn.DMLs[:i]...)
+		}
+		dml.txn = txn
+		dml.epoch = epoch
+		p.buffered[key] = append(p.buffered[key], dml)
+		p.pending[txn]++
+		p.size++
+	}
+	if held {
+		p.dmls[txn] = txn.DMLs
+		txn.DMLs = kept
+	}
+	return held
+}
+
+// applied marks the DMLs buffered applied
+func (p *tablePause) applied(dmls []*DML) {
+	for _, dml := range dmls {
+		if p.pending[dml.txn]--; p.pending[dml.txn] <= 0 {
+			delete(p.pending, dml.txn)
+		}
+	}
+	p.size -= len(dmls)
+}
+
+// succeed returns the txns which can be reported in order after txns succeed
+func (p *tablePause) succeed(txns []*Txn) []*Txn {
+	if p == nil || (len(p.queue) == 0 && len(p.dmls) == 0) {
+		return txns
+	}
+	p.queue = append(p.queue, txns...)
+	return p.ready()
+}
+
+// ready pops the txns succeeded which have no DMLs buffered and no txns before them having any,
+// their whole DMLs are restored
+func (p *tablePause) ready() []*Txn {
+	if p == nil {
+		return nil
+	}
+	n := 0
+	for ; n < len(p.queue); n++ {
+		txn := p.queue[n]
+		if p.pending[txn] > 0 {
+			break
+		}
+		if dmls, ok := p.dmls[txn]; ok {
+			txn.DMLs = dmls
+			delete(p.dmls, txn)
+		}
+	}
+	ready := make([]*Txn, n)
+	copy(ready, p.queue[:n])
+	p.queue = p.queue[n:]
+	return ready
+}
+
+// PauseTable implements Loader interface
+func (s *loaderImpl) PauseTable(database string, table string) {
+	s.pause.pause(database, table)
+	s.tableStatus.onPause(database, table, true)
+	s.getLogger().Info("pause table", zap.String("table", quoteSchema(database, table)))
+}
+
+// ResumeTable implements Loader interface
+func (s *loaderImpl) ResumeTable(database string, table string) {
+	if s.pause.resume(database, table) {
+		s.getLogger().Info("resume table", zap.String("table", quoteSchema(database, table)))
+	}
+}
+
+// holdPaused buffers the DMLs of the paused tables of txn before it's put into the batch, it waits for a table
+// to be resumed if the buffer is full. A DDL of the paused tables resumes them, so their DMLs are applied before it.
+func (s *loaderImpl) holdPaused(batch *batchManager, txn *Txn) error {
+	if s.pause.idle() {
+		return nil
+	}
+	if txn.isDDL() {
+		for _, name := range s.pause.resumeMatched(txn.DDL.Database, txn.DDL.Table) {
+			s.getLogger().Warn("resume the paused table for the ddl", zap.String("table", quoteSchema(name.Schema, name.Table)),
+				zap.String("ddl", txn.DDL.SQL))
+		}
+		return errors.Trace(s.drainResumed(batch))
+	}
+
+	if !s.pause.hold(txn, batch.epoch) {
+		return nil
+	}
+	for s.pause.size >= s.pause.limit {
+		s.getLogger().Warn("the buffer of the paused tables is full, wait for any of them to be resumed", zap.Int("size", s.pause.size))
+		select {
+		case <-s.pause.resumeCh:
+			if err := s.drainResumed(batch); err != nil {
+				return errors.Trace(err)
+			}
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// drainResumed applies the DMLs buffered of the tables resumed by batch.fExecDMLs, then reports the txns ready
+func (s *loaderImpl) drainResumed(batch *batchManager) error {
+	for _, name := range s.pause.takeResumed() {
+		key := quoteSchema(name.Schema, name.Table)
+		dmls := s.dropSnapshotted(s.pause.buffered[key])
+		for len(dmls) > 0 {
+			// the DMLs of a batch must be of the same epoch
+			n := 1
+			for n < len(dmls) && n < s.batchLimit() && dmls[n].epoch == dmls[0].epoch {
+				n++
+			}
+			if err := batch.fExecDMLs(dmls[:n]); err != nil {
+				return errors.Annotatef(err, "apply the dmls buffered of the resumed table %s", key)
+			}
+			s.pause.applied(dmls[:n])
+			dmls = dmls[n:]
+			s.pause.buffered[key] = dmls
+		}
+		delete(s.pause.buffered, key)
+		s.tableStatus.onPause(name.Schema, name.Table, false)
+		s.getLogger().Info("the dmls buffered of the resumed table are applied", zap.String("table", key))
+	}
+	if ready := s.pause.ready(); len(ready) > 0 {
+		s.reportSuccess(ready...)
+	}
+	return nil
+}
+
+// dropSnapshotted marks the DMLs buffered in the snapshots copied applied, and returns the others,
+// see Loader.CopySnapshot
+func (s *loaderImpl) dropSnapshotted(dmls []*DML) []*DML {
+	var dropped, kept []*DML
+	for _, dml := range dmls {
+		if s.snapshots.covers(dml, dml.txn.CommitTS) {
+			dropped = append(dropped, dml)
+		} else {
+			kept = append(kept, dml)
+		}
+	}
+	if len(dropped) > 0 {
+		s.pause.applied(dropped)
+		s.getLogger().Info("skip the dmls buffered in the snapshot copied", zap.String("table", dropped[0].TableName()),
+			zap.Int("count", len(dropped)))
+	}
+	return kept
+}
+
+// drainAll resumes all the tables paused and applies their DMLs buffered, e.g., before Run quits
+func (s *loaderImpl) drainAll(batch *batchManager) error {
+	s.pause.resumeAll()
+	return errors.Trace(s.drainResumed(batch))
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type pauseSuite struct{}
+
+var _ = Suite(&pauseSuite{})
+
+func newPauseDML(table string, id int) *DML {
+	return &DML{
+		Database: "test",
+		Table:    table,
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"id": id},
+	}
+}
+
+func (s *pauseSuite) TestInvalidBufferSize(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, PauseBufferSize(0))
+	c.Assert(err, ErrorMatches, ".*pause buffer size.*")
+}
+
+func (s *pauseSuite) TestHoldAndReport(c *C) {
+	p := newTablePause(10)
+	c.Assert(p.idle(), IsTrue)
+	p.pause("test", "t1")
+	c.Assert(p.idle(), IsFalse)
+
+	txn1 := &Txn{CommitTS: 1, DMLs: []*DML{newPauseDML("t2", 1), newPauseDML("t1", 1)}}
+	txn2 := &Txn{CommitTS: 2, DMLs: []*DML{newPauseDML("t2", 2)}}
+	all := txn1.DMLs
+	c.Assert(p.hold(txn1, 0), IsTrue)
+	c.Assert(txn1.DMLs, DeepEquals, all[:1])
+	c.Assert(p.hold(txn2, 0), IsFalse)
+	c.Assert(p.size, Equals, 1)
+
+	// txn2 is held after txn1 though it has nothing buffered
+	c.Assert(p.succeed([]*Txn{txn1, txn2}), HasLen, 0)
+
+	c.Assert(p.resume("test", "t1"), IsTrue)
+	c.Assert(p.resume("test", "t1"), IsFalse)
+	c.Assert(p.takeResumed(), HasLen, 1)
+	p.applied(p.buffered["`test`.`t1`"])
+	delete(p.buffered, "`test`.`t1`")
+
+	c.Assert(p.ready(), DeepEquals, []*Txn{txn1, txn2})
+	c.Assert(txn1.DMLs, DeepEquals, all)
+	c.Assert(p.idle(), IsTrue)
+}
+
+func (s *pauseSuite) TestResumeMatched(c *C) {
+	p := newTablePause(10)
+	p.pause("test", "t1")
+	p.pause("test", "t2")
+	p.pause("other", "t1")
+	c.Assert(p.resumeMatched("test", "t1"), HasLen, 1)
+	c.Assert(p.resumeMatched("test", ""), HasLen, 1)
+	c.Assert(p.takeResumed(), HasLen, 2)
+	p.resumeAll()
+	c.Assert(p.takeResumed(), HasLen, 1)
+	c.Assert(p.idle(), IsTrue)
+}
+
+func (s *pauseSuite) TestRunPauseAndResume(c *C) {
+	executed := make(chan []*DML, 10)
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: s.batchLimit(),
+			fExecDMLs: func(dmls []*DML) error {
+				// the slice is reused by the batch after it's executed
+				executed <- append([]*DML(nil), dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: s.markSuccess,
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:      make(chan *Txn, 10),
+		successTxn: make(chan *Txn, 10),
+		ctx:        context.Background(),
+		pause:      newTablePause(10),
+	}
+	loader.PauseTable("test", "t1")
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- loader.Run()
+	}()
+
+	txn1 := &Txn{CommitTS: 1, DMLs: []*DML{newPauseDML("t1", 1), newPauseDML("t2", 1)}}
+	txn2 := &Txn{CommitTS: 2, DMLs: []*DML{newPauseDML("t2", 2)}}
+	loader.input <- txn1
+	loader.input <- txn2
+
+	// the DMLs of t2 are applied while the ones of t1 are buffered
+	var applied []*DML
+	for len(applied) < 2 {
+		select {
+		case dmls := <-executed:
+			for _, dml := range dmls {
+				c.Assert(dml.Table, Equals, "t2")
+			}
+			applied = append(applied, dmls...)
+		case <-time.After(2 * time.Second):
+			c.Fatal("Timeout waiting for the dmls of t2 to be executed.")
+		}
+	}
+	select {
+	case txn := <-loader.Successes():
+		c.Fatalf("txn %d is reported before the dmls of the paused table are applied", txn.CommitTS)
+	case <-time.After(100 * time.Millisecond):
+	}
+	status := loader.TableStatus()
+	c.Assert(status, HasLen, 1)
+	c.Assert(status[0].Paused, IsTrue)
+
+	loader.ResumeTable("test", "t1")
+	select {
+	case dmls := <-executed:
+		c.Assert(dmls, HasLen, 1)
+		c.Assert(dmls[0].Table, Equals, "t1")
+	case <-time.After(2 * time.Second):
+		c.Fatal("Timeout waiting for the dmls of t1 to be executed.")
+	}
+	for _, expected := range []*Txn{txn1, txn2} {
+		select {
+		case txn := <-loader.Successes():
+			c.Assert(txn, Equals, expected)
+		case <-time.After(2 * time.Second):
+			c.Fatal("Timeout waiting for the txns to be reported.")
+		}
+	}
+	c.Assert(txn1.DMLs, HasLen, 2)
+	c.Assert(loader.TableStatus()[0].Paused, IsFalse)
+
+	close(loader.input)
+	c.Assert(<-errCh, IsNil)
+}
+
+func (s *pauseSuite) TestDrainOnClose(c *C) {
+	var executed []*DML
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: s.batchLimit(),
+			fExecDMLs: func(dmls []*DML) error {
+				executed = append(executed, dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: s.markSuccess,
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:      make(chan *Txn, 10),
+		successTxn: make(chan *Txn, 10),
+		ctx:        context.Background(),
+		pause:      newTablePause(10),
+	}
+	loader.PauseTable("test", "t1")
+	txn := &Txn{CommitTS: 1, DMLs: []*DML{newPauseDML("t1", 1)}}
+	loader.input <- txn
+	close(loader.input)
+
+	// the DMLs buffered are applied before Run quits
+	c.Assert(loader.Run(), IsNil)
+	c.Assert(executed, HasLen, 1)
+	c.Assert(<-loader.Successes(), Equals, txn)
+}
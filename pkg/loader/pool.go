@@ -0,0 +1,97 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"bytes"
+	"sync"
+)
+
+// the objects allocated for each DML on the hot path are reused by the pools to reduce the pressure of GC.
+// The buffers building the SQLs are bytes.Buffer instead of strings.Builder, whose buffer can't be reused
+// once String is called.
+var (
+	dmlPool    = sync.Pool{New: func() interface{} { return new(DML) }}
+	bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	argsPool   sync.Pool
+)
+
+// the buffers and arg slices larger than them are left to GC, so a few huge txns don't pin the memory
+const (
+	maxPooledBufferSize = 64 * 1024
+	maxPooledArgs       = 64 * 1024
+)
+
+// newDML returns a zero DML from the pool, it must be released by putDML when it's not referenced any more
+func newDML() *DML {
+	return dmlPool.Get().(*DML)
+}
+
+func putDML(dml *DML) {
+	*dml = DML{}
+	dmlPool.Put(dml)
+}
+
+// releaseDMLs puts the DMLs returned by mergeByPrimaryKey back into the pool
+func releaseDMLs(types map[DMLType][]*DML) {
+	for _, dmls := range types {
+		for _, dml := range dmls {
+			putDML(dml)
+		}
+	}
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// getArgs returns an empty arg slice of the capacity at least n
+func getArgs(n int) []interface{} {
+	if p, ok := argsPool.Get().(*[]interface{}); ok {
+		if cap(*p) >= n {
+			return (*p)[:0]
+		}
+		argsPool.Put(p)
+	}
+	return make([]interface{}, 0, n)
+}
+
+// putArgs puts args back into the pool, it must not be referenced any more
+func putArgs(args []interface{}) {
+	if cap(args) == 0 || cap(args) > maxPooledArgs {
+		return
+	}
+	// don't keep the values alive
+	args = args[:cap(args)]
+	for i := range args {
+		args[i] = nil
+	}
+	args = args[:0]
+	argsPool.Put(&args)
+}
+
+// releaseStatements puts the arg slices of stmts back into the pool after they're executed for the last time
+func releaseStatements(stmts []Statement) {
+	for _, stmt := range stmts {
+		putArgs(stmt.Args)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"testing"
+
+	check "github.com/pingcap/check"
+)
+
+type poolSuite struct{}
+
+var _ = check.Suite(&poolSuite{})
+
+func (s *poolSuite) TestArgs(c *check.C) {
+	args := getArgs(4)
+	c.Assert(args, check.HasLen, 0)
+	c.Assert(cap(args) >= 4, check.IsTrue)
+
+	args = append(args, 1, "a")
+	putArgs(args)
+	// the values are cleared so they aren't kept alive by the pool
+	c.Assert(args[:2], check.DeepEquals, []interface{}{nil, nil})
+
+	args = getArgs(maxPooledArgs + 1)
+	c.Assert(cap(args) > maxPooledArgs, check.IsTrue)
+	putArgs(args)
+}
+
+func (s *poolSuite) TestMergeReleased(c *check.C) {
+	info := &tableInfo{
+		columns:    []string{"k", "v"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"k"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	dmls := []*DML{
+		{Database: "db", Table: "tbl", Tp: InsertDMLType, Values: map[string]interface{}{"k": 1, "v": 1}, info: info},
+		{Database: "db", Table: "tbl", Tp: UpdateDMLType, Values: map[string]interface{}{"k": 1, "v": 2},
+			OldValues: map[string]interface{}{"k": 1, "v": 1}, info: info},
+	}
+
+	types, err := mergeByPrimaryKey(dmls, nil)
+	c.Assert(err, check.IsNil)
+	stmts := tableBatchStatements(types, 10, true)
+	releaseDMLs(types)
+	c.Assert(stmts, check.HasLen, 1)
+	c.Assert(stmts[0].Args, check.DeepEquals, []interface{}{1, 2})
+
+	// the DMLs passed in are never modified
+	c.Assert(dmls[1].Tp, check.Equals, UpdateDMLType)
+	c.Assert(dmls[1].OldValues, check.NotNil)
+	releaseStatements(stmts)
+}
+
+func BenchmarkTableBatchStatements(b *testing.B) {
+	info := &tableInfo{
+		columns:    []string{"k", "v"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"k"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	dmls := make([]*DML, 0, 128)
+	for i := 0; i < 128; i++ {
+		dmls = append(dmls, &DML{Database: "db", Table: "tbl", Tp: UpdateDMLType, info: info,
+			Values: map[string]interface{}{"k": i, "v": i + 1}, OldValues: map[string]interface{}{"k": i, "v": i}})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		types, err := mergeByPrimaryKey(dmls, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		stmts := tableBatchStatements(types, 64, true)
+		releaseDMLs(types)
+		releaseStatements(stmts)
+	}
+}
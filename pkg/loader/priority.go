@@ -0,0 +1,186 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// priorityReadAhead is the max number of txns read ahead from the input before a batch of a large txn is executed
+const priorityReadAhead = 1024
+
+// PriorityLane makes loader commit the small txns, with at most smallTxnSize DMLs, before the batch of a large txn
+// filling the whole batch, e.g., a backfill, so the interactive writes aren't stuck behind it. Before such a batch is
+// executed, the txns already queued in the input are read ahead, the small ones not touching any table of the batch
+// or of the txns read ahead before them are pulled forward and committed first, the others are handled in order
+// after the batch as usual. The read-ahead stops at a DDL or a flush, the barriers are never crossed, so a DDL is
+// still applied after all the txns before it, and right after the batch instead of behind the small txns.
+// The txns are reported by Successes in the order they're input regardless. It's disabled if smallTxnSize is 0.
+func PriorityLane(smallTxnSize int) Option {
+	return func(o *options) {
+		o.prioritySmallTxnSize = smallTxnSize
+	}
+}
+
+type priorityLane struct {
+	smallTxnSize int
+	// the txns read ahead but not pulled forward, they're handled before the input
+	deferred []deferredTxn
+	// the sequence of the last txn input, and the one of the next txn to report success
+	inputSeq  uint64
+	reportSeq uint64
+	// the txns succeeded but not reported yet as the ones before them haven't succeeded, keyed by the sequences
+	succeeded map[uint64]*Txn
+}
+
+type deferredTxn struct {
+	txn *Txn
+	// the txn is already prepared by loaderImpl.prepareTxn, the DDLs and flushes are never prepared
+	prepared bool
+}
+
+func newPriorityLane(smallTxnSize int) *priorityLane {
+	return &priorityLane{smallTxnSize: smallTxnSize, reportSeq: 1, succeeded: make(map[uint64]*Txn)}
+}
+
+// input assigns the sequence to the txn input, the flushes aren't reported so they don't take any
+func (p *priorityLane) input(txn *Txn) {
+	if txn.flush == nil {
+		p.inputSeq++
+		txn.seq = p.inputSeq
+	}
+}
+
+// succeed returns the txns which can be reported in order after txns succeed
+func (p *priorityLane) succeed(txns []*Txn) []*Txn {
+	for _, txn := range txns {
+		p.succeeded[txn.seq] = txn
+	}
+	var ready []*Txn
+	for {
+		txn, ok := p.succeeded[p.reportSeq]
+		if !ok {
+			return ready
+		}
+		delete(p.succeeded, p.reportSeq)
+		ready = append(ready, txn)
+		p.reportSeq++
+	}
+}
+
+// nextDeferred returns the first txn deferred, ok is false if there's none
+func (p *priorityLane) nextDeferred() (txn deferredTxn, ok bool) {
+	if len(p.deferred) == 0 {
+		return
+	}
+	txn = p.deferred[0]
+	p.deferred[0] = deferredTxn{}
+	p.deferred = p.deferred[1:]
+	return txn, true
+}
+
+// hasLargeTxn returns true if any txn of the batch fills the whole batch alone
+func hasLargeTxn(batch *batchManager) bool {
+	for _, txn := range batch.txns {
+		if len(txn.DMLs) >= batch.limit {
+			return true
+		}
+	}
+	return false
+}
+
+// pullForward reads ahead the txns queued in input and commits the small ones not conflicting with the batch
+// before the batch is executed
+func (s *loaderImpl) pullForward(txnManager *txnManager, input <-chan *Txn, batch *batchManager) error {
+	p := s.priority
+	// the txns of the paused tables are not pulled forward
+	if !hasLargeTxn(batch) || !s.pause.idle() {
+		return nil
+	}
+
+	tables := make(map[string]struct{})
+	for _, dml := range batch.dmls {
+		tables[dml.TableName()] = struct{}{}
+	}
+	for _, d := range p.deferred {
+		for _, dml := range d.txn.DMLs {
+			tables[dml.TableName()] = struct{}{}
+		}
+		if d.txn.isDDL() || d.txn.flush != nil {
+			// a barrier is waiting
+			return nil
+		}
+	}
+
+	var pulled []*Txn
+readAhead:
+	for i := 0; i < priorityReadAhead; i++ {
+		var txn *Txn
+		select {
+		case t, ok := <-input:
+			if !ok {
+				break readAhead
+			}
+			txn = t
+		default:
+			break readAhead
+		}
+		txnManager.pop(txn)
+		p.input(txn)
+		if txn.isDDL() || txn.flush != nil {
+			p.deferred = append(p.deferred, deferredTxn{txn: txn})
+			break
+		}
+
+		// the txns are prepared first, the tables may be renamed by the transforms
+		if err := s.prepareTxn(txn); err != nil {
+			return errors.Trace(err)
+		}
+		deferTxn := len(txn.DMLs) > p.smallTxnSize
+		for _, dml := range txn.DMLs {
+			if _, ok := tables[dml.TableName()]; ok {
+				deferTxn = true
+				break
+			}
+		}
+		if deferTxn {
+			p.deferred = append(p.deferred, deferredTxn{txn: txn, prepared: true})
+			for _, dml := range txn.DMLs {
+				tables[dml.TableName()] = struct{}{}
+			}
+			continue
+		}
+		pulled = append(pulled, txn)
+	}
+	if len(pulled) == 0 {
+		return nil
+	}
+
+	var dmls []*DML
+	for _, txn := range pulled {
+		for _, dml := range txn.DMLs {
+			dml.epoch = batch.epoch
+			dml.txn = txn
+		}
+		dmls = append(dmls, txn.DMLs...)
+	}
+	s.getLogger().Debug("pull forward small txns", zap.Int("txns", len(pulled)), zap.Int("dmls", len(dmls)),
+		zap.Int("deferred", len(p.deferred)))
+	if err := batch.fExecDMLs(dmls); err != nil {
+		return errors.Annotate(err, "exec the small txns pulled forward")
+	}
+	s.markSuccess(pulled...)
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type prioritySuite struct{}
+
+var _ = check.Suite(&prioritySuite{})
+
+func newPriorityTxn(commitTS int64, table string, n int) *Txn {
+	txn := &Txn{CommitTS: commitTS}
+	for i := 0; i < n; i++ {
+		txn.AppendDML(&DML{Database: "db", Table: table, Tp: InsertDMLType, Values: map[string]interface{}{"id": i}})
+	}
+	return txn
+}
+
+func (s *prioritySuite) TestSucceedInOrder(c *check.C) {
+	p := newPriorityLane(1)
+	txns := make([]*Txn, 0, 4)
+	for i := 0; i < 4; i++ {
+		txn := &Txn{CommitTS: int64(i)}
+		p.input(txn)
+		txns = append(txns, txn)
+	}
+	p.input(&Txn{flush: make(chan int64)})
+	c.Assert(p.inputSeq, check.Equals, uint64(4))
+
+	// the txns pulled forward are held until the ones before them succeed
+	c.Assert(p.succeed(txns[2:3]), check.HasLen, 0)
+	c.Assert(p.succeed(txns[:2]), check.DeepEquals, txns[:3])
+	c.Assert(p.succeed(txns[3:]), check.DeepEquals, txns[3:])
+	c.Assert(p.succeeded, check.HasLen, 0)
+}
+
+func (s *prioritySuite) TestPullForward(c *check.C) {
+	var executed [][]*DML
+	loader := &loaderImpl{successTxn: make(chan *Txn, 16), priority: newPriorityLane(2)}
+	batch := &batchManager{
+		limit: 4,
+		fExecDMLs: func(dmls []*DML) error {
+			executed = append(executed, dmls)
+			return nil
+		},
+		fDMLsSuccessCallback: loader.markSuccess,
+	}
+	txnManager := newTxnManager(1024, nil)
+
+	large := newPriorityTxn(1, "large", 4)
+	handleTxn := func(txn *Txn) {
+		loader.priority.input(txn)
+		c.Assert(batch.put(txn), check.IsNil)
+	}
+	handleTxn(newPriorityTxn(0, "t", 1))
+	c.Assert(batch.dmls, check.HasLen, 1)
+
+	input := make(chan *Txn, 16)
+	queued := []*Txn{
+		// pulled forward
+		newPriorityTxn(2, "small", 1),
+		// deferred for touching the table of the batch
+		newPriorityTxn(3, "large", 1),
+		// deferred for being large
+		newPriorityTxn(4, "other", 3),
+		// deferred for touching the table of the txn deferred before it
+		newPriorityTxn(5, "other", 1),
+		// pulled forward
+		newPriorityTxn(6, "small", 2),
+		// the read-ahead stops at the DDL
+		NewDDLTxn("db", "small", "ALTER TABLE small ADD COLUMN c INT"),
+		newPriorityTxn(8, "small2", 1),
+	}
+	for _, txn := range queued {
+		input <- txn
+	}
+	batch.fBeforeFullExec = func() error {
+		return loader.pullForward(txnManager, input, batch)
+	}
+	handleTxn(large)
+
+	c.Assert(executed, check.HasLen, 2)
+	c.Assert(executed[0], check.HasLen, 3)
+	c.Assert(executed[0][0].txn, check.Equals, queued[0])
+	c.Assert(executed[0][1].txn, check.Equals, queued[4])
+	c.Assert(executed[1], check.HasLen, 5)
+	c.Assert(len(input), check.Equals, 1)
+
+	var deferred []*Txn
+	for {
+		d, ok := loader.priority.nextDeferred()
+		if !ok {
+			break
+		}
+		c.Assert(d.prepared, check.Equals, !d.txn.isDDL())
+		deferred = append(deferred, d.txn)
+	}
+	c.Assert(deferred, check.DeepEquals, []*Txn{queued[1], queued[2], queued[3], queued[5]})
+
+	// the txns pulled forward are reported after the deferred ones
+	c.Assert(loader.successTxn, check.HasLen, 3)
+	loader.markSuccess(queued[1:4]...)
+	var commitTSs []int64
+	for len(loader.successTxn) > 0 {
+		commitTSs = append(commitTSs, (<-loader.successTxn).CommitTS)
+	}
+	c.Assert(commitTSs, check.DeepEquals, []int64{0, 1, 2, 3, 4, 5, 6})
+}
+
+func (s *prioritySuite) TestNoLargeTxn(c *check.C) {
+	loader := &loaderImpl{priority: newPriorityLane(2)}
+	batch := &batchManager{limit: 4}
+	batch.txns = []*Txn{newPriorityTxn(1, "t", 3)}
+	input := make(chan *Txn, 1)
+	input <- newPriorityTxn(2, "small", 1)
+	c.Assert(loader.pullForward(newTxnManager(1024, nil), input, batch), check.IsNil)
+	c.Assert(len(input), check.Equals, 1)
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// TxnMarkerTable is the downstream table holding the markers of the txns, see ProbeCommit
+const TxnMarkerTable = "_loader_txn_marker"
+
+var (
+	// errCommitUnknown means the commit failed ambiguously and the probe failed too, so it's unknown whether
+	// the txn is committed, it's not retried in case the txn is applied twice
+	errCommitUnknown = errors.New("unknown whether the txn is committed")
+
+	probeRetryCount = 3
+	probeRetryWait  = time.Second
+)
+
+// ProbeCommit makes loader find out whether a txn is committed when its commit fails ambiguously, i.e., the
+// connection is broken or timed out during the commit, so the txn may or may not be committed in downstream.
+// Each txn writes a marker row of a unique token in the table TxnMarkerTable of schema in downstream, and the
+// marker is read by a new connection after such a failure, the txn is taken as committed instead of being retried
+// if the marker is found, which prevents the non-idempotent statements, e.g., the ones out of safe mode, from being
+// applied twice. If the probe fails too, Run returns an error instead of retrying the txn.
+//
+// The markers are kept in a row per concurrent txn, which are named by name, so the loaders sharing the schema
+// must have different names.
+func ProbeCommit(schema string, name string) Option {
+	return func(o *options) {
+		o.probeSchema = schema
+		o.probeName = name
+	}
+}
+
+// commitProbe allocates the marker rows to the txns, a row is held by at most one txn at any time, so the marker
+// read after a failed commit is either the one of the txn or the one of the txn before it
+type commitProbe struct {
+	schema   string
+	name     string
+	tidbMode bool
+
+	mu struct {
+		sync.Mutex
+		free []int
+		next int
+	}
+	// the last token given, it starts from the start time so the tokens of the restarted loader are new
+	token int64
+}
+
+// txnMarker is the marker written by a txn
+type txnMarker struct {
+	slot  int
+	token int64
+}
+
+func newCommitProbe(opts options) *commitProbe {
+	return &commitProbe{
+		schema:   opts.probeSchema,
+		name:     opts.probeName,
+		tidbMode: opts.tidbMode,
+		token:    time.Now().UnixNano(),
+	}
+}
+
+func (p *commitProbe) validate() error {
+	if len(p.name) == 0 {
+		return errors.New("the name of the commit probe must be set")
+	}
+	return nil
+}
+
+func (p *commitProbe) table() string {
+	return quoteSchema(p.schema, TxnMarkerTable)
+}
+
+// createTxnMarkerTableSQLs returns the statements creating the txn marker table if it doesn't exist
+func createTxnMarkerTableSQLs(schema string) []string {
+	return []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(schema)),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s("+
+			"`name` VARCHAR(255) NOT NULL, `slot` INT NOT NULL, `token` BIGINT NOT NULL, "+
+			"PRIMARY KEY(`name`, `slot`))", quoteSchema(schema, TxnMarkerTable)),
+	}
+}
+
+// createTable creates the txn marker table in downstream if it doesn't exist
+func (p *commitProbe) createTable(db *gosql.DB) error {
+	for _, sql := range createTxnMarkerTableSQLs(p.schema) {
+		if _, err := db.Exec(sql); err != nil {
+			return errors.Annotatef(err, "create txn marker table failed, sql: %s", sql)
+		}
+	}
+	return nil
+}
+
+// acquire returns a new marker in a row not held by any other txn, it must be released after the txn is resolved
+func (p *commitProbe) acquire() *txnMarker {
+	m := &txnMarker{token: atomic.AddInt64(&p.token, 1)}
+
+	p.mu.Lock()
+	if n := len(p.mu.free); n > 0 {
+		m.slot = p.mu.free[n-1]
+		p.mu.free = p.mu.free[:n-1]
+	} else {
+		m.slot = p.mu.next
+		p.mu.next++
+	}
+	p.mu.Unlock()
+	return m
+}
+
+func (p *commitProbe) release(m *txnMarker) {
+	p.mu.Lock()
+	p.mu.free = append(p.mu.free, m.slot)
+	p.mu.Unlock()
+}
+
+// mark writes the marker in the txn
+func (p *commitProbe) mark(tx *tx, m *txnMarker) error {
+	_, err := tx.autoRollbackExec(fmt.Sprintf("REPLACE INTO %s(`name`,`slot`,`token`) VALUES(?,?,?)", p.table()), p.name, m.slot, m.token)
+	return errors.Annotate(err, "write txn marker")
+}
+
+// committed reads the marker of the row by a new connection, it waits for the txn still committing on mysql
+func (p *commitProbe) committed(db *gosql.DB, m *txnMarker) (bool, error) {
+	sql := fmt.Sprintf("SELECT `token` FROM %s WHERE `name` = ? AND `slot` = ?", p.table())
+	if !p.tidbMode {
+		sql += " LOCK IN SHARE MODE"
+	}
+	var token int64
+	err := db.QueryRow(sql, p.name, m.slot).Scan(&token)
+	if err == gosql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Annotate(err, "read txn marker")
+	}
+	return token == m.token, nil
+}
+
+// resolve finds out whether the txn failing to commit by commitErr is committed, it returns nil if it's committed,
+// commitErr if it's not, and errCommitUnknown if the marker can't be read
+func (p *commitProbe) resolve(db *gosql.DB, m *txnMarker, commitErr error, logger FieldLogger) error {
+	var err error
+	for i := 0; i < probeRetryCount; i++ {
+		if i > 0 {
+			time.Sleep(probeRetryWait)
+		}
+		var committed bool
+		committed, err = p.committed(db, m)
+		if err != nil {
+			logger.Warn("probe the txn failing to commit failed", zap.Int("retry", i), zap.Error(err))
+			continue
+		}
+		if committed {
+			logger.Warn("the txn is committed though the commit failed", zap.Int64("token", m.token), zap.Error(commitErr))
+			return nil
+		}
+		logger.Info("the txn failing to commit isn't committed", zap.Int64("token", m.token), zap.Error(commitErr))
+		return errors.Trace(commitErr)
+	}
+	return errors.Annotatef(errCommitUnknown, "commit: %v, probe: %v", commitErr, err)
+}
+
+// commit writes the marker and commits the txn if the commit probe is enabled, the txn failing to commit
+// ambiguously is probed, see ProbeCommit
+func (e *executor) commit(tx *tx) error {
+	if e.probe == nil {
+		return errors.Trace(tx.commit())
+	}
+
+	m := e.probe.acquire()
+	defer e.probe.release(m)
+	if err := e.probe.mark(tx, m); err != nil {
+		return errors.Trace(err)
+	}
+
+	err := tx.commit()
+	if err == nil || !isConnError(err) {
+		return errors.Trace(err)
+	}
+	return errors.Trace(e.probe.resolve(e.db, m, err, tx.logger))
+}
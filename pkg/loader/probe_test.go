@@ -0,0 +1,140 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type probeSuite struct{}
+
+var _ = Suite(&probeSuite{})
+
+func newTestProbe() *commitProbe {
+	return &commitProbe{schema: "tidb_binlog", name: "drainer-1", token: 100}
+}
+
+func (s *probeSuite) TestInvalidProbeCommit(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, ProbeCommit("tidb_binlog", ""))
+	c.Assert(err, ErrorMatches, ".*name of the commit probe.*")
+	_, err = NewLoader(db, ProbeCommit("tidb_binlog", "drainer-1"))
+	c.Assert(err, IsNil)
+}
+
+func (s *probeSuite) TestAcquire(c *C) {
+	p := newTestProbe()
+	m1 := p.acquire()
+	m2 := p.acquire()
+	c.Assert(m1.slot, Equals, 0)
+	c.Assert(m2.slot, Equals, 1)
+	c.Assert(m2.token, Equals, m1.token+1)
+
+	// the slot released is reused by the next txn with a new token
+	p.release(m1)
+	m3 := p.acquire()
+	c.Assert(m3.slot, Equals, 0)
+	c.Assert(m3.token, Equals, int64(103))
+}
+
+func expectMarker(mock sqlmock.Sqlmock, token int64) {
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `tidb_binlog`.`_loader_txn_marker`(`name`,`slot`,`token`) VALUES(?,?,?)")).
+		WithArgs("drainer-1", 0, token).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectProbe(mock sqlmock.Sqlmock, token int64) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `token` FROM `tidb_binlog`.`_loader_txn_marker` WHERE `name` = ? AND `slot` = ? LOCK IN SHARE MODE")).
+		WithArgs("drainer-1", 0).WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow(token))
+}
+
+func (s *probeSuite) TestCommitted(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withProbe(newTestProbe())
+	stmts := []Statement{{SQL: "INSERT INTO `db`.`tbl`(`id`) VALUES(?)", Args: []interface{}{1}}}
+
+	// the commit fails after it's done in downstream, the txn isn't retried
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectMarker(mock, 101)
+	mock.ExpectCommit().WillReturnError(mysql.ErrInvalidConn)
+	expectProbe(mock, 101)
+
+	err = e.execStatements(nil, stmts)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the marker is the one of the txn before, so the txn isn't committed
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectMarker(mock, 102)
+	mock.ExpectCommit().WillReturnError(mysql.ErrInvalidConn)
+	expectProbe(mock, 101)
+
+	err = e.execStatements(nil, stmts)
+	c.Assert(errors.Cause(err), Equals, mysql.ErrInvalidConn)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the commit failing by the other errors isn't probed
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectMarker(mock, 103)
+	mock.ExpectCommit().WillReturnError(errors.New("deadlock"))
+
+	err = e.execStatements(nil, stmts)
+	c.Assert(err, ErrorMatches, ".*deadlock.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *probeSuite) TestCommitUnknown(c *C) {
+	origWait := probeRetryWait
+	probeRetryWait = time.Millisecond
+	defer func() {
+		probeRetryWait = origWait
+	}()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	e := newExecutor(db).withProbe(newTestProbe())
+	mock.ExpectBegin()
+	expectMarker(mock, 101)
+	mock.ExpectCommit().WillReturnError(mysql.ErrInvalidConn)
+	for i := 0; i < probeRetryCount; i++ {
+		mock.ExpectQuery("SELECT `token`").WillReturnError(errors.New("timeout"))
+	}
+
+	var calls int
+	err = e.retry(context.Background(), nil, 3, time.Millisecond, func() error {
+		calls++
+		return e.execStatements(nil, nil)
+	})
+	c.Assert(errors.Cause(err), Equals, errCommitUnknown)
+	// the txn may have been committed, so it's not retried
+	c.Assert(calls, Equals, 1)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	"go.uber.org/zap"
+)
+
+// RowsCheckPolicy is how the loader reacts when an update or delete executed one by one doesn't affect exactly
+// one row, which means the row is missing in downstream or different from upstream, i.e., downstream has diverged.
+type RowsCheckPolicy string
+
+// the policies of the affected rows mismatches
+const (
+	// RowsCheckAlarm logs an error and counts the drift by MetricsGroup.DriftCounterVec, the txn is committed as it is
+	RowsCheckAlarm RowsCheckPolicy = "alarm"
+	// RowsCheckSafeMode raises the alarm, then rolls back the txn and executes it again with the table in safe mode,
+	// so the updates rewrite the rows found missing. The table is kept in safe mode until the loader quits.
+	RowsCheckSafeMode RowsCheckPolicy = "safe-mode"
+)
+
+var errRowsDrift = errors.New("affected rows mismatch")
+
+func (p RowsCheckPolicy) validate() error {
+	switch p {
+	case "", RowsCheckAlarm, RowsCheckSafeMode:
+		return nil
+	}
+	return errors.Errorf("invalid rows check policy: %s, must be %s or %s", p, RowsCheckAlarm, RowsCheckSafeMode)
+}
+
+// VerifyAffectedRows checks the affected rows of the updates and deletes executed one by one, i.e., the DMLs of the
+// tables with unique keys or without primary key, each of them must affect exactly one row. The bulk statements
+// of the tables with only primary key can't be checked. The updates not changing any value aren't checked as
+// mysql reports no affected rows for them, and neither are the DMLs executed in safe mode.
+// The drifts are counted in TableStatus.Drifts.
+func VerifyAffectedRows(policy RowsCheckPolicy) Option {
+	return func(o *options) {
+		o.rowsCheckPolicy = policy
+	}
+}
+
+// rowsCheck checks the affected rows of the statements executed by executor.singleExec
+type rowsCheck struct {
+	policy RowsCheckPolicy
+	// the tables switched to safe mode by RowsCheckSafeMode, keyed by the quoted table names
+	safeTables sync.Map
+	onDrift    func(dml *DML, affected int64)
+}
+
+// isSafeMode returns true if the table of dml is switched to safe mode
+func (c *rowsCheck) isSafeMode(dml *DML) bool {
+	_, ok := c.safeTables.Load(dml.TableName())
+	return ok
+}
+
+// check returns errRowsDrift if the table of dml is switched to safe mode, the txn must be rolled back then
+func (c *rowsCheck) check(dml *DML, res gosql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if affected == 1 {
+		return nil
+	}
+
+	if c.policy == RowsCheckSafeMode {
+		c.safeTables.Store(dml.TableName(), struct{}{})
+	}
+	c.onDrift(dml, affected)
+	if c.policy == RowsCheckSafeMode {
+		return errRowsDrift
+	}
+	return nil
+}
+
+// needsRowsCheck returns true if the first statement of dml executed not in safe mode must affect exactly one row,
+// it's the update or delete, or the delete of the old row if the update changes the primary key.
+func needsRowsCheck(dml *DML) bool {
+	switch dml.Tp {
+	case DeleteDMLType:
+		return true
+	case UpdateDMLType:
+		return dml.valuesChanged()
+	}
+	return false
+}
+
+// valuesChanged returns true if the update changes any value of the row
+func (dml *DML) valuesChanged() bool {
+	for name, value := range dml.Values {
+		if old, ok := dml.OldValues[name]; !ok || !valueEqual(value, old) {
+			return true
+		}
+	}
+	return false
+}
+
+// onRowsDrift raises the alarm of the DML not affecting exactly one row
+func (s *loaderImpl) onRowsDrift(dml *DML, affected int64) {
+	tp := "delete"
+	if dml.Tp == UpdateDMLType {
+		tp = "update"
+	}
+	var commitTS int64
+	if dml.txn != nil {
+		commitTS = dml.txn.CommitTS
+	}
+	s.getLogger().Error("affected rows mismatch, downstream may have diverged from upstream",
+		zap.String("table", dml.TableName()),
+		zap.String("type", tp),
+		zap.Int64("affected rows", affected),
+		zap.Int64("commit ts", commitTS),
+		zap.Strings("keys", mask.Strings(dml.Database, dml.Table, getKeys(dml))),
+		zap.Bool("switch to safe mode", s.rowsCheck.policy == RowsCheckSafeMode))
+
+	if s.metrics != nil && s.metrics.DriftCounterVec != nil {
+		s.metrics.DriftCounterVec.WithLabelValues(tp).Inc()
+	}
+	s.tableStatus.onDrift(dml, s.rowsCheck.policy == RowsCheckSafeMode)
+}
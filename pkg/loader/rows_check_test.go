@@ -0,0 +1,134 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type rowsCheckSuite struct{}
+
+var _ = Suite(&rowsCheckSuite{})
+
+func newRowsCheckUpdate() *DML {
+	return &DML{
+		Database:  "db",
+		Table:     "tbl",
+		Tp:        UpdateDMLType,
+		OldValues: map[string]interface{}{"name": "tester", "age": 1999},
+		Values:    map[string]interface{}{"name": "tester", "age": 2019},
+		info: &tableInfo{
+			columns:    []string{"name", "age"},
+			uniqueKeys: []indexInfo{{name: "name", columns: []string{"name"}}},
+		},
+	}
+}
+
+func (s *rowsCheckSuite) TestNeedsRowsCheck(c *C) {
+	update := newRowsCheckUpdate()
+	c.Assert(needsRowsCheck(update), IsTrue)
+
+	update.Values["age"] = 1999
+	c.Assert(needsRowsCheck(update), IsFalse)
+
+	c.Assert(needsRowsCheck(&DML{Tp: DeleteDMLType}), IsTrue)
+	c.Assert(needsRowsCheck(&DML{Tp: InsertDMLType}), IsFalse)
+}
+
+func (s *rowsCheckSuite) TestInvalidPolicy(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, VerifyAffectedRows("fail"))
+	c.Assert(err, ErrorMatches, "invalid rows check policy.*")
+}
+
+func (s *rowsCheckSuite) TestAlarm(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "drift"}, []string{"type"})
+	ld, err := NewLoader(db, VerifyAffectedRows(RowsCheckAlarm), Metrics(&MetricsGroup{DriftCounterVec: counter}))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+
+	// the row is missing in downstream, the txn is committed as it is
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`tbl` SET")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate()}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the DMLs in safe mode are not checked
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate()}, true)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var metric io_prometheus_client.Metric
+	c.Assert(counter.WithLabelValues("update").Write(&metric), IsNil)
+	c.Assert(metric.Counter.GetValue(), Equals, float64(1))
+
+	status := ld.TableStatus()
+	c.Assert(status, HasLen, 1)
+	c.Assert(status[0].Drifts, Equals, int64(1))
+	c.Assert(status[0].SafeMode, IsFalse)
+}
+
+func (s *rowsCheckSuite) TestSwitchToSafeMode(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, VerifyAffectedRows(RowsCheckSafeMode))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+
+	// the txn is rolled back and executed again in safe mode
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`tbl` SET")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate()}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the table is kept in safe mode
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newRowsCheckUpdate()}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	status := ld.TableStatus()
+	c.Assert(status, HasLen, 1)
+	c.Assert(status[0].Drifts, Equals, int64(1))
+	c.Assert(status[0].SafeMode, IsTrue)
+}
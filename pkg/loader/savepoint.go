@@ -0,0 +1,201 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// SavepointPolicy is how a failed upstream txn of a group commit is handled when the txns of the group are
+// separated by savepoints, so the failure rolls back only the statements of that txn instead of the whole group.
+type SavepointPolicy string
+
+// the policies of the failed txns of a group commit
+const (
+	// SavepointRetry rolls back to the savepoint of the txn and retries it alone, the whole group is rolled
+	// back and retried as usual if it still fails
+	SavepointRetry SavepointPolicy = "retry"
+	// SavepointQuarantine rolls back to the savepoint of the txn and retries it alone, and skips it if it still
+	// fails, the other txns of the group are committed, the txn skipped is logged with its commit ts and kept in
+	// TableStatus.Quarantined of its tables
+	SavepointQuarantine SavepointPolicy = "quarantine"
+)
+
+// the times a txn is executed from its savepoint before it's given up
+const savepointRetryCount = 3
+
+// the backoff before the first retry from the savepoint, it's doubled for each of the following ones
+var savepointRetryBackoff = 50 * time.Millisecond
+
+func (p SavepointPolicy) validate() error {
+	switch p {
+	case "", SavepointRetry, SavepointQuarantine:
+		return nil
+	}
+	return errors.Errorf("invalid savepoint policy: %s, must be %s or %s", p, SavepointRetry, SavepointQuarantine)
+}
+
+// GroupCommitSavepoints makes loader set a savepoint before each upstream txn of a group commit, a txn failing
+// is rolled back to its savepoint and retried alone, then handled by the policy. The downstream must support
+// SAVEPOINT, e.g., mysql, it takes effect only with GroupCommit.
+func GroupCommitSavepoints(policy SavepointPolicy) Option {
+	return func(o *options) {
+		o.savepointPolicy = policy
+	}
+}
+
+// splitByTxn splits dmls into the groups of the DMLs of each txn, which are put contiguously by batchManager
+func splitByTxn(dmls []*DML) [][]*DML {
+	var groups [][]*DML
+	for i, dml := range dmls {
+		if i == 0 || dml.txn != dmls[i-1].txn {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], dml)
+	}
+	return groups
+}
+
+// execGroupCommitSavepoints executes dmls of any tables in one txn, the statements of each upstream txn
+// are executed after a savepoint, see GroupCommitSavepoints.
+// NOTE: DML.info are assumed to be already set.
+func (s *loaderImpl) execGroupCommitSavepoints(dmls []*DML, safeMode bool) error {
+	groups := splitByTxn(dmls)
+	stmts := make([][]Statement, len(groups))
+	for i, group := range groups {
+		var err error
+		stmts[i], err = s.groupCommitStatements(group, safeMode)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	var quarantined map[int]error
+	executor := s.getExecutor()
+	err := executor.retry(s.ctx, dmls, maxDMLRetryCount, time.Second, func() error {
+		var err error
+		quarantined, err = executor.execSavepoints(dmls, stmts, s.savepointPolicy == SavepointQuarantine)
+		return err
+	})
+	if err != nil {
+		s.tableStatus.onDMLsError(dmls, err)
+		return errors.Trace(err)
+	}
+
+	for i, err := range quarantined {
+		var commitTS int64
+		if txn := groups[i][0].txn; txn != nil {
+			commitTS = txn.CommitTS
+		}
+		s.getLogger().Error("skip the txn failing in group commit", zap.Int64("commit ts", commitTS),
+			zap.Int("dmls", len(groups[i])), zap.Error(err))
+		s.tableStatus.onDMLsError(groups[i], err)
+		s.tableStatus.onQuarantine(groups[i], commitTS, err)
+	}
+	return nil
+}
+
+// execSavepoints executes the statements of each group after a savepoint in one txn. The groups still failing
+// after retried from their savepoints are skipped if quarantine is true and returned with their errors, otherwise
+// the txn is rolled back and the error is returned.
+func (e *executor) execSavepoints(dmls []*DML, groups [][]Statement, quarantine bool) (map[int]error, error) {
+	tx, err := e.begin(dmls)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	rollback := func() {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			tx.logger.Error("Auto rollback", zap.Error(rbErr))
+		}
+	}
+
+	quarantined := make(map[int]error)
+	for i, stmts := range groups {
+		name := fmt.Sprintf("txn_%d", i)
+		if _, err = tx.exec("SAVEPOINT " + name); err != nil {
+			rollback()
+			return nil, errors.Annotate(err, "set savepoint")
+		}
+
+		err = execFromSavepoint(tx, name, stmts)
+		if err == nil {
+			continue
+		}
+		// the txn is retried with the statements executed one by one, it's not the fault of the group
+		rejected := e.multiStatements.checkRejectedStatements(stmts, err, e.logger)
+		if _, ok := errors.Cause(err).(*savepointLostError); ok || !quarantine || rejected {
+			rollback()
+			return nil, errors.Trace(err)
+		}
+		quarantined[i] = err
+	}
+
+	if e.markTxn != nil {
+		mark := e.markTxn()
+		if _, err = tx.autoRollbackExec(mark.SQL, mark.Args...); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	if err = e.commit(tx); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return quarantined, nil
+}
+
+// savepointLostError means the txn can't be rolled back to the savepoint, e.g., the whole txn has been rolled
+// back by a deadlock or the connection is broken, so the txn can't go on
+type savepointLostError struct {
+	err error
+}
+
+func (e *savepointLostError) Error() string {
+	return "rollback to savepoint: " + e.err.Error()
+}
+
+// execFromSavepoint executes stmts after the savepoint, rolling back to the savepoint and retrying on error
+// with an exponential backoff, e.g., to wait for the lock conflicting to be released,
+// it's rolled back to the savepoint if it still fails after savepointRetryCount times.
+func execFromSavepoint(tx *tx, name string, stmts []Statement) error {
+	var err error
+	backoff := savepointRetryBackoff
+	for i := 0; i < savepointRetryCount; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = execAll(tx, stmts); err == nil {
+			return nil
+		}
+		tx.logger.Warn("exec failed, rollback to savepoint", zap.String("savepoint", name), zap.Int("retry", i), zap.Error(err))
+		if _, rbErr := tx.exec("ROLLBACK TO SAVEPOINT " + name); rbErr != nil {
+			return errors.Trace(&savepointLostError{err: rbErr})
+		}
+	}
+	return errors.Trace(err)
+}
+
+func execAll(tx *tx, stmts []Statement) error {
+	for _, stmt := range stmts {
+		if _, err := tx.exec(stmt.SQL, stmt.Args...); err != nil {
+			return errors.Annotatef(err, "exec %s", stmt.SQL)
+		}
+	}
+	return nil
+}
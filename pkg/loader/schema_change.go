@@ -0,0 +1,67 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// unknownColumn returns a column of dml its table info doesn't know, empty if there's none
+func unknownColumn(dml *DML) string {
+	known := make(map[string]struct{}, len(dml.info.columns)+len(dml.info.generatedColumns))
+	for _, col := range dml.info.columns {
+		known[col] = struct{}{}
+	}
+	for _, col := range dml.info.generatedColumns {
+		known[col] = struct{}{}
+	}
+	for col := range dml.Values {
+		if _, ok := known[col]; !ok {
+			return col
+		}
+	}
+	return ""
+}
+
+// setFreshDMLInfo is setDMLInfo, but the table info is loaded again if dml has a column it doesn't know, e.g.,
+// the info is loaded before the DDL adding the column is applied. Otherwise the values of the column would be
+// dropped as the ones of the generated columns, and the rows are written under the old schema.
+func (s *loaderImpl) setFreshDMLInfo(dml *DML) error {
+	if err := s.setDMLInfo(dml); err != nil {
+		return errors.Trace(err)
+	}
+	if dml.info.reloaded {
+		return nil
+	}
+	col := unknownColumn(dml)
+	if len(col) == 0 {
+		return nil
+	}
+
+	s.getLogger().Info("table info is stale, the dml has an unknown column",
+		zap.String("table", quoteSchema(dml.Database, dml.Table)), zap.String("column", col))
+	info, err := s.refreshTableInfo(dml.Database, dml.Table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the columns still unknown aren't in downstream, don't load it again until the next DDL
+	info.reloaded = true
+	return errors.Trace(s.setDMLInfo(dml))
+}
+
+// evictTableInfo removes the cached table info, so it's loaded again by the next DML of the table
+func (s *loaderImpl) evictTableInfo(schema string, table string) {
+	s.tableInfos.Delete(quoteSchema(schema, table))
+}
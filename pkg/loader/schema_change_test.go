@@ -0,0 +1,168 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"database/sql"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type schemaChangeSuite struct {
+	origGet func(db *sql.DB, schema string, table string) (*tableInfo, error)
+	// the columns of the table in downstream
+	columns []string
+	nLoad   int
+	loadErr error
+}
+
+var _ = check.Suite(&schemaChangeSuite{})
+
+func (s *schemaChangeSuite) SetUpTest(c *check.C) {
+	s.origGet = utilGetTableInfo
+	s.columns = []string{"id", "name"}
+	s.nLoad = 0
+	s.loadErr = nil
+	utilGetTableInfo = func(db *sql.DB, schema string, table string) (*tableInfo, error) {
+		s.nLoad++
+		if s.loadErr != nil {
+			return nil, s.loadErr
+		}
+		return &tableInfo{
+			columns:    append([]string(nil), s.columns...),
+			primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}},
+			uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+		}, nil
+	}
+}
+
+func (s *schemaChangeSuite) TearDownTest(c *check.C) {
+	utilGetTableInfo = s.origGet
+}
+
+func (s *schemaChangeSuite) insert(values map[string]interface{}) *DML {
+	return &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: values}
+}
+
+func (s *schemaChangeSuite) TestUnknownColumn(c *check.C) {
+	dml := s.insert(map[string]interface{}{"id": 1, "name": "a", "full": "a"})
+	dml.info = &tableInfo{columns: []string{"id", "name"}}
+	c.Assert(unknownColumn(dml), check.Equals, "full")
+
+	dml.info.generatedColumns = []string{"full"}
+	c.Assert(unknownColumn(dml), check.Equals, "")
+}
+
+func (s *schemaChangeSuite) TestReloadStaleInfo(c *check.C) {
+	ld := &loaderImpl{}
+	_, err := ld.getTableInfo("test", "t")
+	c.Assert(err, check.IsNil)
+
+	// the column is added in downstream after the info is cached
+	s.columns = append(s.columns, "age")
+	dml := s.insert(map[string]interface{}{"id": 1, "name": "a", "age": 18})
+	c.Assert(ld.setFreshDMLInfo(dml), check.IsNil)
+	c.Assert(s.nLoad, check.Equals, 2)
+	c.Assert(dml.info.columns, check.DeepEquals, []string{"id", "name", "age"})
+
+	filterGeneratedCols(dml)
+	sql, args := dml.sql()
+	c.Assert(sql, check.Equals, "INSERT INTO `test`.`t`(`id`,`name`,`age`) VALUES(?,?,?)")
+	c.Assert(args, check.DeepEquals, []interface{}{1, "a", 18})
+
+	// the info is loaded for the DMLs, so the columns still unknown aren't in downstream, it's not loaded again
+	// until the next DDL
+	for i := 0; i < 2; i++ {
+		dml = s.insert(map[string]interface{}{"id": 1, "name": "a", "age": 18, "extra": 1})
+		c.Assert(ld.setFreshDMLInfo(dml), check.IsNil)
+	}
+	c.Assert(s.nLoad, check.Equals, 2)
+	filterGeneratedCols(dml)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1, "name": "a", "age": 18})
+}
+
+func (s *schemaChangeSuite) TestReloadFailed(c *check.C) {
+	ld := &loaderImpl{}
+	_, err := ld.getTableInfo("test", "t")
+	c.Assert(err, check.IsNil)
+
+	s.columns = append(s.columns, "age")
+	s.loadErr = errors.New("load failed")
+	dml := s.insert(map[string]interface{}{"id": 1, "name": "a", "age": 18})
+	c.Assert(ld.setFreshDMLInfo(dml), check.ErrorMatches, "load failed")
+}
+
+// the DMLs before the DDL adding a column with default value are written by the old schema, and backfilled by
+// the default in downstream, the ones after it are written with the column by the new schema
+func (s *schemaChangeSuite) TestAddColumnWithDefault(c *check.C) {
+	ld := &loaderImpl{successTxn: make(chan *Txn, 8)}
+	bm := newBatchManager(ld)
+	var sqls []string
+	bm.fExecDMLs = func(dmls []*DML) error {
+		for _, dml := range dmls {
+			if err := ld.setFreshDMLInfo(dml); err != nil {
+				return err
+			}
+			filterGeneratedCols(dml)
+			sql, _ := dml.sql()
+			sqls = append(sqls, sql)
+		}
+		return nil
+	}
+	bm.fExecDDL = func(*DDL) error {
+		s.columns = append(s.columns, "age")
+		return nil
+	}
+
+	c.Assert(bm.put(&Txn{CommitTS: 1, DMLs: []*DML{s.insert(map[string]interface{}{"id": 1, "name": "a"})}}), check.IsNil)
+	c.Assert(bm.put(&Txn{CommitTS: 2, DDL: &DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN age INT DEFAULT 18"}}), check.IsNil)
+	// the rows after the DDL have the default value
+	c.Assert(bm.put(&Txn{CommitTS: 3, DMLs: []*DML{
+		s.insert(map[string]interface{}{"id": 2, "name": "b", "age": 18}),
+		s.insert(map[string]interface{}{"id": 3, "name": "c", "age": 20}),
+	}}), check.IsNil)
+	c.Assert(bm.execAccumulatedDMLs(), check.IsNil)
+
+	c.Assert(sqls, check.DeepEquals, []string{
+		"INSERT INTO `test`.`t`(`id`,`name`) VALUES(?,?)",
+		"INSERT INTO `test`.`t`(`id`,`name`,`age`) VALUES(?,?,?)",
+		"INSERT INTO `test`.`t`(`id`,`name`,`age`) VALUES(?,?,?)",
+	})
+	// loaded by the first DML and refreshed after the DDL
+	c.Assert(s.nLoad, check.Equals, 2)
+}
+
+// the table info of the old schema is evicted if it fails to be refreshed after the DDL
+func (s *schemaChangeSuite) TestAddColumnRefreshFailed(c *check.C) {
+	ld := &loaderImpl{successTxn: make(chan *Txn, 1)}
+	bm := newBatchManager(ld)
+	_, err := ld.getTableInfo("test", "t")
+	c.Assert(err, check.IsNil)
+
+	s.columns = append(s.columns, "age")
+	s.loadErr = errors.New("load failed")
+	ddl := &Txn{DDL: &DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN age INT DEFAULT 18"}}
+	bm.fDDLSuccessCallback(ddl)
+	_, ok := ld.tableInfos.Load(quoteSchema("test", "t"))
+	c.Assert(ok, check.IsFalse)
+
+	// the DML fails instead of being written by the old schema, and succeeds once it's loaded
+	dml := s.insert(map[string]interface{}{"id": 1, "name": "a"})
+	c.Assert(ld.setFreshDMLInfo(dml), check.ErrorMatches, "load failed")
+
+	s.loadErr = nil
+	c.Assert(ld.setFreshDMLInfo(dml), check.IsNil)
+	c.Assert(dml.info.columns, check.DeepEquals, []string{"id", "name", "age"})
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sort"
+
+	"github.com/pingcap/errors"
+)
+
+// SchemaMismatchPolicy is how the loader reacts when the columns of a DML don't match the columns of its table
+// in downstream, e.g., a DDL isn't replicated or downstream has been changed by hand.
+type SchemaMismatchPolicy string
+
+// the policies of the schema mismatches
+const (
+	// SchemaMismatchError makes Run return an error if the DML has columns downstream lacks, or lacks columns
+	// downstream has
+	SchemaMismatchError SchemaMismatchPolicy = "error"
+	// SchemaMismatchIgnoreExtra drops the values of the columns downstream lacks, and returns an error if
+	// the DML lacks columns downstream has
+	SchemaMismatchIgnoreExtra SchemaMismatchPolicy = "ignore-extra"
+	// SchemaMismatchNullMissing writes NULL to the columns the insert or update lacks, and returns an error if
+	// the DML has columns downstream lacks
+	SchemaMismatchNullMissing SchemaMismatchPolicy = "null-missing"
+)
+
+func (p SchemaMismatchPolicy) validate() error {
+	switch p {
+	case "", SchemaMismatchError, SchemaMismatchIgnoreExtra, SchemaMismatchNullMissing:
+		return nil
+	}
+	return errors.Errorf("invalid schema mismatch policy: %s, must be %s, %s or %s",
+		p, SchemaMismatchError, SchemaMismatchIgnoreExtra, SchemaMismatchNullMissing)
+}
+
+// OnSchemaMismatch sets the policy of the DMLs whose columns don't match the table in downstream, they're checked
+// before the txn is put into a batch, so the divergence is reported with the table and the columns instead of
+// failing in the middle of a batch by a downstream error. The generated columns of downstream are neither extra
+// nor missing. By default the columns aren't checked, the missing columns are left to downstream, i.e., the default
+// values for inserts and unchanged for updates, and the statements with the extra columns fail in downstream.
+func OnSchemaMismatch(policy SchemaMismatchPolicy) Option {
+	return func(o *options) {
+		o.schemaMismatchPolicy = policy
+	}
+}
+
+// checkColumns checks the columns of dml against dml.info by the policy, the values of the extra columns are
+// removed by SchemaMismatchIgnoreExtra, and the values of the missing columns are set to NULL by
+// SchemaMismatchNullMissing.
+// NOTE: DML.info is assumed to be already set.
+func checkColumns(dml *DML, policy SchemaMismatchPolicy) error {
+	info := dml.info
+
+	extra := extraColumns(info, dml.Values, dml.OldValues)
+	if len(extra) > 0 {
+		if policy != SchemaMismatchIgnoreExtra {
+			return &ErrSchemaMismatch{Table: dml.TableName(), Extra: extra}
+		}
+		for _, col := range extra {
+			delete(dml.Values, col)
+			delete(dml.OldValues, col)
+		}
+	}
+
+	var missing []string
+	for _, col := range info.columns {
+		if _, ok := dml.Values[col]; ok {
+			continue
+		}
+		if policy == SchemaMismatchNullMissing {
+			if dml.Tp != DeleteDMLType {
+				dml.Values[col] = nil
+			}
+			continue
+		}
+		missing = append(missing, col)
+	}
+	if len(missing) > 0 {
+		return &ErrSchemaMismatch{Table: dml.TableName(), Missing: missing}
+	}
+	return nil
+}
+
+// extraColumns returns the columns of the values not in the table, in order
+func extraColumns(info *tableInfo, values ...map[string]interface{}) []string {
+	var extra []string
+	for _, vals := range values {
+		for col := range vals {
+			if info.hasColumn(col) {
+				continue
+			}
+			if len(extra) == 0 || !containsString(extra, col) {
+				extra = append(extra, col)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return extra
+}
+
+func (info *tableInfo) hasColumn(col string) bool {
+	return containsString(info.columns, col) || containsString(info.generatedColumns, col)
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSchema checks the columns of the DMLs of txn if the schema mismatch policy is set
+func (s *loaderImpl) checkSchema(txn *Txn) error {
+	if len(s.schemaMismatchPolicy) == 0 || txn.isDDL() {
+		return nil
+	}
+	for _, dml := range txn.DMLs {
+		if err := s.setDMLInfo(dml); err != nil {
+			return errors.Annotatef(err, "check schema of %s at commit ts %d", dml.TableName(), txn.CommitTS)
+		}
+		if err := checkColumns(dml, s.schemaMismatchPolicy); err != nil {
+			if mismatch, ok := err.(*ErrSchemaMismatch); ok {
+				mismatch.CommitTS = txn.CommitTS
+			}
+			return errors.Annotatef(err, "dml of %s at commit ts %d", dml.TableName(), txn.CommitTS)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+)
+
+type schemaMismatchSuite struct{}
+
+var _ = check.Suite(&schemaMismatchSuite{})
+
+func (s *schemaMismatchSuite) TestCheckColumns(c *check.C) {
+	info := &tableInfo{
+		columns:          []string{"id", "name", "note"},
+		generatedColumns: []string{"upper_name"},
+	}
+	newDMLs := func() []*DML {
+		return []*DML{
+			// matched, the generated column is neither extra nor missing
+			{Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a", "note": "n", "upper_name": "A"}},
+			// extra
+			{Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a", "note": "n", "age": 10}},
+			// missing
+			{Tp: UpdateDMLType, Values: map[string]interface{}{"id": 1, "name": "b"}, OldValues: map[string]interface{}{"id": 1, "name": "a"}},
+			// both
+			{Tp: DeleteDMLType, Values: map[string]interface{}{"id": 1, "nick": "a"}},
+		}
+	}
+
+	tests := []struct {
+		policy SchemaMismatchPolicy
+		errs   []string
+	}{
+		{
+			policy: SchemaMismatchError,
+			errs: []string{
+				"",
+				"schema mismatch: columns age don't exist in downstream",
+				"schema mismatch: columns note of downstream are missing",
+				"schema mismatch: columns nick don't exist in downstream",
+			},
+		},
+		{
+			policy: SchemaMismatchIgnoreExtra,
+			errs: []string{
+				"",
+				"",
+				"schema mismatch: columns note of downstream are missing",
+				"schema mismatch: columns name, note of downstream are missing",
+			},
+		},
+		{
+			policy: SchemaMismatchNullMissing,
+			errs: []string{
+				"",
+				"schema mismatch: columns age don't exist in downstream",
+				"",
+				"schema mismatch: columns nick don't exist in downstream",
+			},
+		},
+	}
+	for _, t := range tests {
+		dmls := newDMLs()
+		for i, dml := range dmls {
+			dml.info = info
+			err := checkColumns(dml, t.policy)
+			comment := check.Commentf("policy %s, case %d", t.policy, i)
+			if len(t.errs[i]) == 0 {
+				c.Assert(err, check.IsNil, comment)
+			} else {
+				c.Assert(err, check.ErrorMatches, t.errs[i], comment)
+			}
+		}
+		switch t.policy {
+		case SchemaMismatchIgnoreExtra:
+			c.Assert(dmls[1].Values, check.DeepEquals, map[string]interface{}{"id": 1, "name": "a", "note": "n"})
+			c.Assert(dmls[3].Values, check.DeepEquals, map[string]interface{}{"id": 1})
+		case SchemaMismatchNullMissing:
+			c.Assert(dmls[2].Values, check.DeepEquals, map[string]interface{}{"id": 1, "name": "b", "note": nil})
+			c.Assert(dmls[2].OldValues, check.HasLen, 2)
+		}
+	}
+}
+
+func (s *schemaMismatchSuite) TestShouldStopRunOnMismatch(c *check.C) {
+	var executed []*DML
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: 1024,
+			fExecDMLs: func(dmls []*DML) error {
+				executed = append(executed, dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:                make(chan *Txn, 10),
+		successTxn:           make(chan *Txn, 10),
+		schemaMismatchPolicy: SchemaMismatchIgnoreExtra,
+	}
+	info := &tableInfo{columns: []string{"id", "v"}}
+	loader.tableInfos.Store(quoteSchema("test", "t"), info)
+
+	extra := &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "v": 1, "w": 1}}
+	loader.input <- &Txn{CommitTS: 1, DMLs: []*DML{extra}}
+	loader.input <- &Txn{CommitTS: 2, DMLs: []*DML{{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2}}}}
+	close(loader.input)
+
+	err := loader.Run()
+	c.Assert(err, check.ErrorMatches, "dml of `test`.`t` at commit ts 2: schema mismatch: columns v of downstream are missing")
+	c.Assert(extra.Values, check.DeepEquals, map[string]interface{}{"id": 1, "v": 1})
+	for _, dml := range executed {
+		c.Assert(dml.Values["id"], check.Equals, 1)
+	}
+}
+
+func (s *schemaMismatchSuite) TestInvalidPolicy(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, OnSchemaMismatch("strict"))
+	c.Assert(err, check.ErrorMatches, "invalid schema mismatch policy.*")
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+)
+
+// UpdateSemantics is how the updates of a table are applied when their rows are missing in downstream
+type UpdateSemantics string
+
+// DeleteSemantics is how the deletes of a table are applied when their rows are missing in downstream
+type DeleteSemantics string
+
+// the apply semantics, the empty ones follow the settings of the loader, i.e., the safe mode and VerifyAffectedRows
+const (
+	// UpdateStrict makes Run return an error if the UPDATE doesn't affect exactly one row
+	UpdateStrict UpdateSemantics = "strict"
+	// UpdateUpsert applies the updates as in safe mode, i.e., deletes the old row and replaces the new one,
+	// so the row missing is inserted
+	UpdateUpsert UpdateSemantics = "upsert"
+
+	// DeleteStrict makes Run return an error if the DELETE doesn't affect exactly one row
+	DeleteStrict DeleteSemantics = "strict"
+	// DeleteIdempotent ignores the deletes of the rows missing, they're not checked by VerifyAffectedRows
+	DeleteIdempotent DeleteSemantics = "idempotent"
+)
+
+var errRowMissing = errors.New("the row is missing or differs in downstream")
+
+// TableSemantics is the apply semantics of the updates and deletes of the tables matched, the empty Schema or Table
+// matches any.
+type TableSemantics struct {
+	Schema string          `toml:"db-name" json:"db-name"`
+	Table  string          `toml:"tbl-name" json:"tbl-name"`
+	Update UpdateSemantics `toml:"update" json:"update"`
+	Delete DeleteSemantics `toml:"delete" json:"delete"`
+}
+
+func (t *TableSemantics) validate() error {
+	switch t.Update {
+	case "", UpdateStrict, UpdateUpsert:
+	default:
+		return errors.Errorf("invalid update semantics %s of %s, must be %s or %s",
+			t.Update, quoteSchema(t.Schema, t.Table), UpdateStrict, UpdateUpsert)
+	}
+	switch t.Delete {
+	case "", DeleteStrict, DeleteIdempotent:
+	default:
+		return errors.Errorf("invalid delete semantics %s of %s, must be %s or %s",
+			t.Delete, quoteSchema(t.Schema, t.Table), DeleteStrict, DeleteIdempotent)
+	}
+	return nil
+}
+
+// ApplySemantics sets the apply semantics of the tables matched, which trades the divergence detection for the
+// resilience per table: the strict ones stop the loader on the first row found missing, the upsert and idempotent
+// ones apply the DMLs regardless. The most specific one is used for each table, the first one is used if there're
+// more than one. The DMLs of the tables with any semantics set are executed one by one, out of the bulk statements
+// and the group commits. In safe mode the strict ones are not checked, as the DMLs may have been applied before.
+// The updates not changing any value can't be checked, as mysql reports no affected rows for them.
+func ApplySemantics(tables ...TableSemantics) Option {
+	return func(o *options) {
+		o.semantics = append(o.semantics, tables...)
+	}
+}
+
+// semanticsOf returns the most specific TableSemantics matching the table, it's zero if none matches
+func semanticsOf(semantics []TableSemantics, schema string, table string) TableSemantics {
+	var found TableSemantics
+	best := -1
+	for i := range semantics {
+		if specificity, ok := matchTable(semantics[i].Schema, semantics[i].Table, schema, table); ok && specificity > best {
+			found = semantics[i]
+			best = specificity
+		}
+	}
+	return found
+}
+
+// hasSemantics returns true if the DMLs of the table are applied by the semantics other than the default,
+// or resolved by a conflict policy
+func (info *tableInfo) hasSemantics() bool {
+	return len(info.update) > 0 || len(info.delete) > 0 || info.conflict != nil
+}
+
+// hasSemantics returns true if any of dmls is of the table with apply semantics
+func hasSemantics(dmls []*DML) bool {
+	for _, dml := range dmls {
+		if dml.info != nil && dml.info.hasSemantics() {
+			return true
+		}
+	}
+	return false
+}
+
+// upsert returns true if dml is an update applied by UpdateUpsert
+func (dml *DML) upsert() bool {
+	return dml.Tp == UpdateDMLType && dml.info != nil && dml.info.update == UpdateUpsert
+}
+
+// strict returns true if dml must affect exactly one row
+func (dml *DML) strict() bool {
+	if dml.info == nil || dml.info.conflict != nil {
+		return false
+	}
+	switch dml.Tp {
+	case UpdateDMLType:
+		return dml.info.update == UpdateStrict
+	case DeleteDMLType:
+		return dml.info.delete == DeleteStrict
+	}
+	return false
+}
+
+// idempotent returns true if dml is a delete applied by DeleteIdempotent
+func (dml *DML) idempotent() bool {
+	return dml.Tp == DeleteDMLType && dml.info != nil && dml.info.delete == DeleteIdempotent
+}
+
+// checkRows checks the affected rows of the first statement of dml, the strict DMLs must affect exactly one row,
+// the others are checked by e.rowsCheck
+func (e *executor) checkRows(dml *DML, res gosql.Result) error {
+	if !dml.strict() {
+		if e.rowsCheck == nil {
+			return nil
+		}
+		return errors.Trace(e.rowsCheck.check(dml, res))
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if affected != 1 {
+		return errors.Annotatef(errRowMissing, "the strict %s of %s affected %d rows, keys: %v",
+			dml.Tp, dml.TableName(), affected, mask.Strings(dml.Database, dml.Table, getKeys(dml)))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type semanticsSuite struct{}
+
+var _ = Suite(&semanticsSuite{})
+
+func newSemanticsDML(tp DMLType, update UpdateSemantics, del DeleteSemantics) *DML {
+	dml := newRowsCheckUpdate()
+	dml.Tp = tp
+	if tp == DeleteDMLType {
+		dml.OldValues = nil
+	}
+	dml.info.update = update
+	dml.info.delete = del
+	return dml
+}
+
+func (s *semanticsSuite) TestInvalidSemantics(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, ApplySemantics(TableSemantics{Schema: "db", Update: "insert"}))
+	c.Assert(err, ErrorMatches, "invalid update semantics insert of `db`.``.*")
+	_, err = NewLoader(db, ApplySemantics(TableSemantics{Schema: "db", Delete: "upsert"}))
+	c.Assert(err, ErrorMatches, "invalid delete semantics upsert.*")
+	_, err = NewLoader(db, ApplySemantics(TableSemantics{Schema: "db", Update: UpdateUpsert, Delete: DeleteStrict}))
+	c.Assert(err, IsNil)
+}
+
+func (s *semanticsSuite) TestSemanticsOf(c *C) {
+	semantics := []TableSemantics{
+		{Schema: "db", Update: UpdateUpsert},
+		{Schema: "db", Table: "orders", Update: UpdateStrict, Delete: DeleteStrict},
+		{Table: "logs", Delete: DeleteIdempotent},
+	}
+	c.Assert(semanticsOf(semantics, "db", "orders").Update, Equals, UpdateStrict)
+	c.Assert(semanticsOf(semantics, "DB", "users").Update, Equals, UpdateUpsert)
+	c.Assert(semanticsOf(semantics, "db", "logs").Update, Equals, UpdateUpsert)
+	c.Assert(semanticsOf(semantics, "other", "logs").Delete, Equals, DeleteIdempotent)
+	c.Assert(semanticsOf(semantics, "other", "users"), DeepEquals, TableSemantics{})
+}
+
+func (s *semanticsSuite) TestStrict(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	e := newExecutor(db)
+
+	// the row is missing, the txn is rolled back and not retried
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `db`.`tbl` SET")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	err = e.singleExecRetry(context.Background(), []*DML{newSemanticsDML(UpdateDMLType, UpdateStrict, "")}, false, 3, time.Millisecond)
+	c.Assert(errors.Cause(err), Equals, errRowMissing)
+	c.Assert(err, ErrorMatches, ".*the strict update of `db`.`tbl` affected 0 rows.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	err = e.singleExec([]*DML{newSemanticsDML(DeleteDMLType, "", DeleteStrict)}, false)
+	c.Assert(errors.Cause(err), Equals, errRowMissing)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the row found is applied
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	err = e.singleExec([]*DML{newSemanticsDML(DeleteDMLType, "", DeleteStrict)}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the DMLs in safe mode are not checked
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = e.singleExec([]*DML{newSemanticsDML(DeleteDMLType, "", DeleteStrict)}, true)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *semanticsSuite) TestUpsert(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the update is applied as in safe mode out of safe mode, the insert isn't affected
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	insert := newSemanticsDML(InsertDMLType, UpdateUpsert, "")
+	insert.OldValues = nil
+	err = newExecutor(db).singleExec([]*DML{insert, newSemanticsDML(UpdateDMLType, UpdateUpsert, "")}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *semanticsSuite) TestIdempotent(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, VerifyAffectedRows(RowsCheckSafeMode))
+	c.Assert(err, IsNil)
+	s0 := ld.(*loaderImpl)
+
+	// the delete of the row missing isn't a drift
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = s0.getExecutor().singleExec([]*DML{newSemanticsDML(DeleteDMLType, "", DeleteIdempotent)}, false)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(ld.TableStatus(), HasLen, 0)
+}
+
+func (s *semanticsSuite) TestNotBatched(c *C) {
+	s0 := &loaderImpl{merge: true}
+	dml := &DML{
+		Database: "db",
+		Table:    "tbl",
+		Tp:       InsertDMLType,
+		info:     &tableInfo{columns: []string{"id"}, primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	batch, single := s0.groupDMLs([]*DML{dml})
+	c.Assert(batch, HasLen, 1)
+	c.Assert(single, HasLen, 0)
+
+	dml.info.update = UpdateStrict
+	batch, single = s0.groupDMLs([]*DML{dml})
+	c.Assert(batch, HasLen, 0)
+	c.Assert(single, HasLen, 1)
+}
@@ -0,0 +1,325 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
+)
+
+// ShardMethod is how the shard of a row is computed from the values of its key columns
+type ShardMethod string
+
+// the shard methods
+const (
+	// ShardMod is the integer value of the only key column mod the shards
+	ShardMod ShardMethod = "mod"
+	// ShardHash is the CRC32 of the values of the key columns mod the shards
+	ShardHash ShardMethod = "hash"
+	// ShardRange is the index of the first bound of Ranges greater than the integer value of the only key column
+	ShardRange ShardMethod = "range"
+)
+
+// the placeholder of the index of the shard in the target names of ShardRule
+const shardPlaceholder = "{shard}"
+
+// ShardRule splits the rows of a table into the shards by the values of the key columns.
+type ShardRule struct {
+	Schema  string      `toml:"db-name" json:"db-name"`
+	Table   string      `toml:"tbl-name" json:"tbl-name"`
+	Columns []string    `toml:"columns" json:"columns"`
+	Method  ShardMethod `toml:"method" json:"method"`
+	// the number of the shards of mod and hash, the shards of range are len(Ranges) + 1
+	Shards int `toml:"shards" json:"shards"`
+	// the exclusive upper bounds of the shards but the last in ascending order, only for range
+	Ranges []int64 `toml:"ranges" json:"ranges"`
+	// the names of the database and the table of the shards in downstream, "{shard}" is replaced by the index of
+	// the shard, empty means the names of upstream
+	TargetSchema string `toml:"target-db-name" json:"target-db-name"`
+	TargetTable  string `toml:"target-tbl-name" json:"target-tbl-name"`
+}
+
+func (r *ShardRule) validate() error {
+	name := quoteSchema(r.Schema, r.Table)
+	if len(r.Schema) == 0 || len(r.Table) == 0 {
+		return errors.Errorf("the db-name and tbl-name of the shard rule %s must be set", name)
+	}
+	if len(r.Columns) == 0 {
+		return errors.Errorf("the key columns of the shard rule of %s must be set", name)
+	}
+	switch r.Method {
+	case ShardMod, ShardHash:
+		if r.Shards <= 0 {
+			return errors.Errorf("the shards of the shard rule of %s must be positive", name)
+		}
+	case ShardRange:
+		if len(r.Ranges) == 0 {
+			return errors.Errorf("the ranges of the shard rule of %s must be set", name)
+		}
+		for i := 1; i < len(r.Ranges); i++ {
+			if r.Ranges[i] <= r.Ranges[i-1] {
+				return errors.Errorf("the ranges of the shard rule of %s must be ascending", name)
+			}
+		}
+	default:
+		return errors.Errorf("invalid shard method %s of %s, must be %s, %s or %s", r.Method, name, ShardMod, ShardHash, ShardRange)
+	}
+	if r.Method != ShardHash && len(r.Columns) != 1 {
+		return errors.Errorf("the shard method %s of %s must have only one key column", r.Method, name)
+	}
+	if r.count() > 1 && !strings.Contains(r.TargetSchema+r.TargetTable, shardPlaceholder) {
+		return errors.Errorf("the target-db-name or target-tbl-name of the shard rule of %s must have %s", name, shardPlaceholder)
+	}
+	return nil
+}
+
+// count returns the number of the shards
+func (r *ShardRule) count() int {
+	if r.Method == ShardRange {
+		return len(r.Ranges) + 1
+	}
+	return r.Shards
+}
+
+// target returns the names of the database and the table of the shard in downstream
+func (r *ShardRule) target(shard int) (schema string, table string) {
+	schema, table = r.Schema, r.Table
+	index := strconv.Itoa(shard)
+	if len(r.TargetSchema) > 0 {
+		schema = strings.Replace(r.TargetSchema, shardPlaceholder, index, -1)
+	}
+	if len(r.TargetTable) > 0 {
+		table = strings.Replace(r.TargetTable, shardPlaceholder, index, -1)
+	}
+	return
+}
+
+// shardOf returns the shard of the row of values
+func (r *ShardRule) shardOf(values map[string]interface{}) (int, error) {
+	keys := make([]interface{}, 0, len(r.Columns))
+	for _, col := range r.Columns {
+		v := columnValue(values, col)
+		if v == nil {
+			return 0, errors.Errorf("the shard key %s of %s is NULL", col, quoteSchema(r.Schema, r.Table))
+		}
+		keys = append(keys, v)
+	}
+
+	switch r.Method {
+	case ShardHash:
+		h := crc32.NewIEEE()
+		for i, v := range keys {
+			if i > 0 {
+				h.Write([]byte{0})
+			}
+			if b, ok := v.([]byte); ok {
+				h.Write(b)
+			} else {
+				fmt.Fprintf(h, "%v", v)
+			}
+		}
+		return int(h.Sum32() % uint32(r.Shards)), nil
+	case ShardMod:
+		n, err := shardInt(keys[0])
+		if err != nil {
+			return 0, errors.Annotatef(err, "shard %s", quoteSchema(r.Schema, r.Table))
+		}
+		shard := n % int64(r.Shards)
+		if shard < 0 {
+			shard += int64(r.Shards)
+		}
+		return int(shard), nil
+	default:
+		n, err := shardInt(keys[0])
+		if err != nil {
+			return 0, errors.Annotatef(err, "shard %s", quoteSchema(r.Schema, r.Table))
+		}
+		for i, bound := range r.Ranges {
+			if n < bound {
+				return i, nil
+			}
+		}
+		return len(r.Ranges), nil
+	}
+}
+
+// shardInt returns the integer value of the shard key
+func shardInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	}
+	return 0, errors.Errorf("the shard key %v of type %T isn't an integer", v, v)
+}
+
+// ShardRouter splits the txns into the txns of the downstreams by the shard rules, for splitting the huge tables
+// into several downstream databases or tables. The shard i of a table is written to the downstream
+// i % downstreams, the tables not sharded are written to the downstream 0.
+type ShardRouter struct {
+	downstreams int
+	// [lower schema, lower table] -> rule
+	rules map[[2]string]*ShardRule
+}
+
+// NewShardRouter returns a ShardRouter of the rules into the downstreams
+func NewShardRouter(downstreams int, rules ...ShardRule) (*ShardRouter, error) {
+	if downstreams <= 0 {
+		return nil, errors.Errorf("invalid downstreams %d", downstreams)
+	}
+	r := &ShardRouter{downstreams: downstreams, rules: make(map[[2]string]*ShardRule, len(rules))}
+	for i := range rules {
+		rule := rules[i]
+		if err := rule.validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		key := [2]string{strings.ToLower(rule.Schema), strings.ToLower(rule.Table)}
+		if _, ok := r.rules[key]; ok {
+			return nil, errors.Errorf("duplicate shard rules of %s", quoteSchema(rule.Schema, rule.Table))
+		}
+		r.rules[key] = &rule
+	}
+	return r, nil
+}
+
+func (r *ShardRouter) ruleOf(schema string, table string) *ShardRule {
+	return r.rules[[2]string{strings.ToLower(schema), strings.ToLower(table)}]
+}
+
+// Split returns the txns of each downstream split from txn, the DMLs of the shards are changed to the tables of
+// the shards in place. An update moving the row into another shard is split into the delete of the old row and
+// the insert of the new one. The DDL of a sharded table is rewritten for the table of each shard, the other DDLs
+// are executed in the downstream 0. The downstreams without any DML or DDL of txn have no txn.
+func (r *ShardRouter) Split(txn *Txn) ([][]*Txn, error) {
+	split := make([][]*Txn, r.downstreams)
+	if txn.isDDL() {
+		rule := r.ruleOf(txn.DDL.Database, txn.DDL.Table)
+		if rule == nil {
+			split[0] = []*Txn{txn}
+			return split, nil
+		}
+		for shard := 0; shard < rule.count(); shard++ {
+			ddl, err := rule.rewriteDDL(txn.DDL, shard)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			t := *txn
+			t.DDL = ddl
+			i := shard % r.downstreams
+			split[i] = append(split[i], &t)
+		}
+		return split, nil
+	}
+
+	dmls := make([][]*DML, r.downstreams)
+	for _, dml := range txn.DMLs {
+		rule := r.ruleOf(dml.Database, dml.Table)
+		if rule == nil {
+			dmls[0] = append(dmls[0], dml)
+			continue
+		}
+		shard, err := rule.shardOf(dml.Values)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if dml.Tp == UpdateDMLType {
+			oldShard, err := rule.shardOf(dml.OldValues)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if oldShard != shard {
+				del := NewDelete(dml.Database, dml.Table, dml.OldValues)
+				del.Database, del.Table = rule.target(oldShard)
+				dmls[oldShard%r.downstreams] = append(dmls[oldShard%r.downstreams], del)
+				dml = NewInsert(dml.Database, dml.Table, dml.Values)
+			}
+		}
+		dml.Database, dml.Table = rule.target(shard)
+		dmls[shard%r.downstreams] = append(dmls[shard%r.downstreams], dml)
+	}
+	for i := range dmls {
+		if len(dmls[i]) == 0 {
+			continue
+		}
+		t := *txn
+		t.DMLs = dmls[i]
+		split[i] = []*Txn{&t}
+	}
+	return split, nil
+}
+
+// rewriteDDL returns the DDL of the table of the shard
+func (r *ShardRule) rewriteDDL(ddl *DDL, shard int) (*DDL, error) {
+	stmt, err := parser.New().ParseOneStmt(ddl.SQL, "", "")
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse the DDL of the sharded table %s", quoteSchema(ddl.Database, ddl.Table))
+	}
+	schema, table := r.target(shard)
+	stmt.Accept(&shardTableRenamer{rule: r, defaultSchema: ddl.Database, schema: schema, table: table})
+
+	var b strings.Builder
+	if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &b)); err != nil {
+		return nil, errors.Annotatef(err, "restore the DDL %s", ddl.SQL)
+	}
+	return &DDL{Database: schema, Table: table, SQL: b.String()}, nil
+}
+
+// shardTableRenamer renames the sharded table in a DDL to the table of a shard
+type shardTableRenamer struct {
+	rule          *ShardRule
+	defaultSchema string
+	schema        string
+	table         string
+}
+
+// Enter implements ast.Visitor
+func (v *shardTableRenamer) Enter(in ast.Node) (ast.Node, bool) {
+	name, ok := in.(*ast.TableName)
+	if !ok {
+		return in, false
+	}
+	schema := name.Schema.O
+	if len(schema) == 0 {
+		schema = v.defaultSchema
+	}
+	if strings.EqualFold(schema, v.rule.Schema) && strings.EqualFold(name.Name.O, v.rule.Table) {
+		name.Schema = model.NewCIStr(v.schema)
+		name.Name = model.NewCIStr(v.table)
+	}
+	return in, true
+}
+
+// Leave implements ast.Visitor
+func (v *shardTableRenamer) Leave(in ast.Node) (ast.Node, bool) {
+	return in, true
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type shardSuite struct{}
+
+var _ = Suite(&shardSuite{})
+
+func (s *shardSuite) TestValidate(c *C) {
+	_, err := NewShardRouter(0)
+	c.Assert(err, ErrorMatches, "invalid downstreams 0")
+
+	rule := ShardRule{Schema: "db", Table: "orders", Columns: []string{"uid"}, Method: ShardMod, Shards: 4, TargetTable: "orders_{shard}"}
+	_, err = NewShardRouter(2, rule)
+	c.Assert(err, IsNil)
+	_, err = NewShardRouter(2, rule, rule)
+	c.Assert(err, ErrorMatches, "duplicate shard rules of `db`.`orders`")
+
+	invalid := rule
+	invalid.TargetTable = ""
+	_, err = NewShardRouter(2, invalid)
+	c.Assert(err, ErrorMatches, ".*must have \\{shard\\}")
+	invalid = rule
+	invalid.Method = "list"
+	_, err = NewShardRouter(2, invalid)
+	c.Assert(err, ErrorMatches, "invalid shard method list.*")
+	invalid = rule
+	invalid.Columns = []string{"uid", "oid"}
+	_, err = NewShardRouter(2, invalid)
+	c.Assert(err, ErrorMatches, ".*must have only one key column")
+	invalid.Method = ShardHash
+	_, err = NewShardRouter(2, invalid)
+	c.Assert(err, IsNil)
+	invalid = rule
+	invalid.Method, invalid.Ranges = ShardRange, []int64{10, 10}
+	_, err = NewShardRouter(2, invalid)
+	c.Assert(err, ErrorMatches, ".*must be ascending")
+	invalid = rule
+	invalid.Table = ""
+	_, err = NewShardRouter(2, invalid)
+	c.Assert(err, ErrorMatches, ".*must be set")
+}
+
+func (s *shardSuite) TestShardOf(c *C) {
+	mod := &ShardRule{Schema: "db", Table: "t", Columns: []string{"uid"}, Method: ShardMod, Shards: 4}
+	shard, err := mod.shardOf(map[string]interface{}{"UID": int64(7)})
+	c.Assert(err, IsNil)
+	c.Assert(shard, Equals, 3)
+	shard, err = mod.shardOf(map[string]interface{}{"uid": "-1"})
+	c.Assert(err, IsNil)
+	c.Assert(shard, Equals, 3)
+	_, err = mod.shardOf(map[string]interface{}{"uid": nil})
+	c.Assert(err, ErrorMatches, "the shard key uid of `db`.`t` is NULL")
+	_, err = mod.shardOf(map[string]interface{}{"uid": 1.5})
+	c.Assert(err, ErrorMatches, ".*isn't an integer")
+
+	ranges := &ShardRule{Columns: []string{"uid"}, Method: ShardRange, Ranges: []int64{100, 200}}
+	for v, expected := range map[int64]int{-1: 0, 99: 0, 100: 1, 199: 1, 200: 2, 1000: 2} {
+		shard, err = ranges.shardOf(map[string]interface{}{"uid": v})
+		c.Assert(err, IsNil)
+		c.Assert(shard, Equals, expected)
+	}
+
+	hash := &ShardRule{Columns: []string{"a", "b"}, Method: ShardHash, Shards: 8}
+	shard, err = hash.shardOf(map[string]interface{}{"a": "x", "b": []byte("y")})
+	c.Assert(err, IsNil)
+	again, err := hash.shardOf(map[string]interface{}{"a": []byte("x"), "b": "y"})
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, shard)
+	c.Assert(shard >= 0 && shard < 8, IsTrue)
+}
+
+func (s *shardSuite) TestSplitDMLs(c *C) {
+	router, err := NewShardRouter(2, ShardRule{Schema: "db", Table: "orders", Columns: []string{"uid"}, Method: ShardMod,
+		Shards: 4, TargetSchema: "db_{shard}", TargetTable: "orders"})
+	c.Assert(err, IsNil)
+
+	txn := &Txn{CommitTS: 10, DMLs: []*DML{
+		NewInsert("db", "orders", map[string]interface{}{"id": 1, "uid": int64(1)}),
+		NewInsert("db", "users", map[string]interface{}{"id": 1}),
+		NewInsert("db", "orders", map[string]interface{}{"id": 2, "uid": int64(2)}),
+		// moved from the shard 3 to the shard 1
+		NewUpdate("db", "orders", map[string]interface{}{"id": 3, "uid": int64(3)}, map[string]interface{}{"id": 3, "uid": int64(5)}),
+		NewUpdate("db", "orders", map[string]interface{}{"id": 4, "uid": int64(4)}, map[string]interface{}{"id": 4, "uid": int64(8)}),
+	}}
+	split, err := router.Split(txn)
+	c.Assert(err, IsNil)
+	c.Assert(split, HasLen, 2)
+	c.Assert(split[0], HasLen, 1)
+	c.Assert(split[1], HasLen, 1)
+
+	names := func(t *Txn) (names []string) {
+		for _, dml := range t.DMLs {
+			names = append(names, dml.Tp.String()+" "+dml.TableName())
+		}
+		return
+	}
+	c.Assert(split[0][0].CommitTS, Equals, int64(10))
+	c.Assert(names(split[0][0]), DeepEquals, []string{"insert `db`.`users`", "insert `db_2`.`orders`", "update `db_0`.`orders`"})
+	c.Assert(names(split[1][0]), DeepEquals, []string{"insert `db_1`.`orders`", "delete `db_3`.`orders`", "insert `db_1`.`orders`"})
+	c.Assert(split[1][0].DMLs[1].Values["uid"], Equals, int64(3))
+	c.Assert(split[1][0].DMLs[2].Values["uid"], Equals, int64(5))
+
+	// the downstream without any DML has no txn
+	split, err = router.Split(&Txn{DMLs: []*DML{NewInsert("db", "users", map[string]interface{}{"id": 1})}})
+	c.Assert(err, IsNil)
+	c.Assert(split[0], HasLen, 1)
+	c.Assert(split[1], HasLen, 0)
+
+	_, err = router.Split(&Txn{DMLs: []*DML{NewInsert("db", "orders", map[string]interface{}{"id": 1})}})
+	c.Assert(err, ErrorMatches, ".*the shard key uid of `db`.`orders` is NULL")
+}
+
+func (s *shardSuite) TestSplitDDL(c *C) {
+	router, err := NewShardRouter(2, ShardRule{Schema: "db", Table: "orders", Columns: []string{"uid"}, Method: ShardRange,
+		Ranges: []int64{100, 200}, TargetTable: "orders_{shard}"})
+	c.Assert(err, IsNil)
+
+	split, err := router.Split(NewDDLTxn("db", "orders", "ALTER TABLE orders ADD COLUMN c INT"))
+	c.Assert(err, IsNil)
+	c.Assert(split[0], HasLen, 2)
+	c.Assert(split[1], HasLen, 1)
+	c.Assert(*split[0][0].DDL, DeepEquals, DDL{Database: "db", Table: "orders_0", SQL: "ALTER TABLE `db`.`orders_0` ADD COLUMN `c` INT"})
+	c.Assert(*split[1][0].DDL, DeepEquals, DDL{Database: "db", Table: "orders_1", SQL: "ALTER TABLE `db`.`orders_1` ADD COLUMN `c` INT"})
+	c.Assert(split[0][1].DDL.SQL, Equals, "ALTER TABLE `db`.`orders_2` ADD COLUMN `c` INT")
+
+	// the other tables in the DDL are kept
+	split, err = router.Split(NewDDLTxn("db", "orders", "CREATE TABLE db.orders LIKE tpl"))
+	c.Assert(err, IsNil)
+	c.Assert(split[1][0].DDL.SQL, Equals, "CREATE TABLE `db`.`orders_1` LIKE `tpl`")
+
+	split, err = router.Split(NewDDLTxn("db", "", "CREATE DATABASE db"))
+	c.Assert(err, IsNil)
+	c.Assert(split[0], HasLen, 1)
+	c.Assert(split[0][0].DDL.SQL, Equals, "CREATE DATABASE db")
+	c.Assert(split[1], HasLen, 0)
+}
@@ -0,0 +1,323 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	currentTSSQL     = "SELECT @@tidb_current_ts"
+	setSnapshotSQL   = "SET @@tidb_snapshot = ?"
+	resetSnapshotSQL = "SET @@tidb_snapshot = ''"
+	// the handle of the rows of the tables without primary key in TiDB
+	tidbRowID = "_tidb_rowid"
+)
+
+// snapshotTables drops the DMLs of the tables copied from the snapshots of upstream which are committed not after
+// the snapshots, as they're already in the rows copied, see Loader.CopySnapshot. The methods used by Run take nil
+// as no table copied.
+type snapshotTables struct {
+	mu sync.Mutex
+	// quoted table name -> snapshot ts
+	ts map[string]int64
+}
+
+func newSnapshotTables() *snapshotTables {
+	return &snapshotTables{ts: make(map[string]int64)}
+}
+
+func (t *snapshotTables) set(name string, ts int64) {
+	t.mu.Lock()
+	t.ts[name] = ts
+	t.mu.Unlock()
+}
+
+// covers returns true if the DML committed at commitTS is in the snapshot copied of its table
+func (t *snapshotTables) covers(dml *DML, commitTS int64) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts, ok := t.ts[dml.TableName()]
+	return ok && commitTS <= ts
+}
+
+// filter removes the DMLs of txn in the snapshots copied, it returns the count removed
+func (t *snapshotTables) filter(txn *Txn) int {
+	if t == nil || txn.isDDL() {
+		return 0
+	}
+	t.mu.Lock()
+	empty := len(t.ts) == 0
+	t.mu.Unlock()
+	if empty {
+		return 0
+	}
+
+	kept := txn.DMLs[:0]
+	for _, dml := range txn.DMLs {
+		if !t.covers(dml, txn.CommitTS) {
+			kept = append(kept, dml)
+		}
+	}
+	removed := len(txn.DMLs) - len(kept)
+	txn.DMLs = kept
+	return removed
+}
+
+// CopySnapshot implements Loader interface. The rows are read by the chunks of the batch size ordered by the
+// primary key, or _tidb_rowid if there's none, and written by the multi-row REPLACE statements of the worker count
+// concurrently into the db passed to NewLoader, so it can be retried.
+func (s *loaderImpl) CopySnapshot(ctx context.Context, upstream *gosql.DB, ts int64, tables ...filter.TableName) (int64, error) {
+	// buffer the DMLs input while copying, the ones input before are not applied as the tables are not synced yet
+	for _, name := range tables {
+		s.PauseTable(name.Schema, name.Table)
+	}
+	if ts == 0 {
+		var err error
+		if ts, err = currentTS(ctx, upstream); err != nil {
+			return 0, errors.Annotate(err, "get the current ts of upstream")
+		}
+	}
+	for _, name := range tables {
+		s.snapshots.set(quoteSchema(name.Schema, name.Table), ts)
+	}
+
+	logger := withFields(s.getLogger(), zap.Int64("snapshot ts", ts))
+	for _, name := range tables {
+		start := time.Now()
+		rows, err := s.copyTable(ctx, upstream, ts, name.Schema, name.Table)
+		if err != nil {
+			return ts, errors.Annotatef(err, "copy %s from the snapshot at %d", quoteSchema(name.Schema, name.Table), ts)
+		}
+		logger.Info("table copied from the snapshot", zap.String("table", quoteSchema(name.Schema, name.Table)),
+			zap.Int("rows", rows), zap.Duration("cost", time.Since(start)))
+	}
+
+	for _, name := range tables {
+		s.ResumeTable(name.Schema, name.Table)
+	}
+	return ts, nil
+}
+
+// currentTS returns the ts of a txn started in upstream
+func currentTS(ctx context.Context, db *gosql.DB) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer tx.Rollback()
+
+	var ts int64
+	if err := tx.QueryRowContext(ctx, currentTSSQL).Scan(&ts); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if ts <= 0 {
+		return 0, errors.New("the upstream isn't TiDB")
+	}
+	return ts, nil
+}
+
+// snapshotTableInfo returns the info of the table in downstream, the table is created if it's missing
+// and AutoCreateTable is set
+func (s *loaderImpl) snapshotTableInfo(ctx context.Context, schema string, table string) (*tableInfo, error) {
+	info, err := utilGetTableInfo(s.originDB, schema, table)
+	if errors.Cause(err) != ErrTableNotExist || s.tableCreator == nil {
+		return info, errors.Trace(err)
+	}
+
+	sql, err := s.tableCreator(schema, table)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get create table statement of %s", quoteSchema(schema, table))
+	}
+	s.getLogger().Info("create missing table", zap.String("table", quoteSchema(schema, table)), zap.String("sql", sql))
+	if _, err = s.originDB.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(schema))); err != nil {
+		return nil, errors.Annotatef(err, "create database %s", quoteName(schema))
+	}
+	if err = execInSchema(ctx, s.originDB, schema, sql); err != nil {
+		return nil, errors.Annotatef(err, "create table %s", quoteSchema(schema, table))
+	}
+	return utilGetTableInfo(s.originDB, schema, table)
+}
+
+// execInSchema executes the statement in the database schema
+func execInSchema(ctx context.Context, db *gosql.DB, schema string, sql string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("use %s;", quoteName(schema))); err != nil {
+		tx.Rollback()
+		return errors.Trace(err)
+	}
+	if _, err = tx.ExecContext(ctx, sql); err != nil {
+		tx.Rollback()
+		return errors.Trace(err)
+	}
+	return errors.Trace(tx.Commit())
+}
+
+// copyTable copies the rows of the table at the snapshot ts, it returns the count of the rows copied
+func (s *loaderImpl) copyTable(ctx context.Context, upstream *gosql.DB, ts int64, schema string, table string) (int, error) {
+	info, err := s.snapshotTableInfo(ctx, schema, table)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	conn, err := upstream.Conn(ctx)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, setSnapshotSQL, strconv.FormatInt(ts, 10)); err != nil {
+		return 0, errors.Annotate(err, "set the snapshot")
+	}
+	defer func() {
+		// the connection is put back to the pool of upstream
+		if _, err := conn.ExecContext(context.Background(), resetSnapshotSQL); err != nil {
+			s.getLogger().Warn("reset the snapshot of the session failed", zap.Error(err))
+		}
+	}()
+
+	errg, gctx := errgroup.WithContext(ctx)
+	chunks := make(chan []*DML, s.snapshotWorkers)
+	executor := newExecutor(s.originDB).withBatchSize(s.snapshotChunkSize).withLogger(s.getLogger())
+	for i := 0; i < s.snapshotWorkers; i++ {
+		errg.Go(func() error {
+			for chunk := range chunks {
+				if err := executor.execBulkImportRetry(gctx, chunk, true, maxDMLRetryCount, time.Second); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return nil
+		})
+	}
+
+	var rows int
+	errg.Go(func() error {
+		defer close(chunks)
+		var err error
+		rows, err = readChunks(gctx, conn, info, schema, table, s.snapshotChunkSize, chunks)
+		return errors.Trace(err)
+	})
+	if err = errg.Wait(); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return rows, nil
+}
+
+// chunkQuery returns the query of the chunk after the key of the last row of the previous chunk, the key columns
+// are the primary key or _tidb_rowid, which is selected first
+func chunkQuery(info *tableInfo, schema string, table string, first bool, limit int) (query string, keys []string) {
+	keys = []string{tidbRowID}
+	if info.primaryKey != nil {
+		keys = info.primaryKey.columns
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if info.primaryKey == nil {
+		b.WriteString(tidbRowID + ",")
+	}
+	fmt.Fprintf(&b, "%s FROM %s", buildColumnList(info.columns), quoteSchema(schema, table))
+	if !first {
+		fmt.Fprintf(&b, " WHERE (%s) > (%s)", buildColumnList(keys), holderString(len(keys)))
+	}
+	fmt.Fprintf(&b, " ORDER BY %s LIMIT %d", buildColumnList(keys), limit)
+	return b.String(), keys
+}
+
+// readChunks reads the rows of the table by chunks and sends them as the inserts, it returns the count of the rows
+func readChunks(ctx context.Context, conn *gosql.Conn, info *tableInfo, schema string, table string, size int, chunks chan<- []*DML) (int, error) {
+	var total int
+	var last []interface{}
+	for {
+		query, keys := chunkQuery(info, schema, table, last == nil, size)
+		chunk, err := readChunk(ctx, conn, info, schema, table, query, last)
+		if err != nil {
+			return total, errors.Trace(err)
+		}
+		if len(chunk) == 0 {
+			return total, nil
+		}
+		total += len(chunk)
+
+		lastRow := chunk[len(chunk)-1]
+		last = make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			last = append(last, lastRow.Values[key])
+		}
+		if info.primaryKey == nil {
+			// the row id isn't a column of the table
+			for _, dml := range chunk {
+				delete(dml.Values, tidbRowID)
+			}
+		}
+
+		select {
+		case chunks <- chunk:
+		case <-ctx.Done():
+			return total, errors.Trace(ctx.Err())
+		}
+		if len(chunk) < size {
+			return total, nil
+		}
+	}
+}
+
+// readChunk returns the rows of the query as the inserts
+func readChunk(ctx context.Context, conn *gosql.Conn, info *tableInfo, schema string, table string, query string, args []interface{}) ([]*DML, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var chunk []*DML
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col] = values[i]
+		}
+		dml := NewInsert(schema, table, row)
+		dml.info = info
+		chunk = append(chunk, dml)
+	}
+	return chunk, errors.Trace(rows.Err())
+}
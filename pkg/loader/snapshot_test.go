@@ -0,0 +1,128 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type snapshotSuite struct{}
+
+var _ = Suite(&snapshotSuite{})
+
+func (s *snapshotSuite) TestFilter(c *C) {
+	t := newSnapshotTables()
+	txn := &Txn{CommitTS: 10, DMLs: []*DML{newPauseDML("t1", 1), newPauseDML("t2", 1)}}
+	c.Assert(t.filter(txn), Equals, 0)
+
+	t.set("`test`.`t1`", 10)
+	c.Assert(t.filter(txn), Equals, 1)
+	c.Assert(txn.DMLs, HasLen, 1)
+	c.Assert(txn.DMLs[0].Table, Equals, "t2")
+
+	// the DMLs committed after the snapshot are kept
+	txn = &Txn{CommitTS: 11, DMLs: []*DML{newPauseDML("t1", 1)}}
+	c.Assert(t.filter(txn), Equals, 0)
+	c.Assert(txn.DMLs, HasLen, 1)
+}
+
+func (s *snapshotSuite) TestChunkQuery(c *C) {
+	info := &tableInfo{columns: []string{"id", "name"}, primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}}}
+	query, keys := chunkQuery(info, "test", "t", true, 100)
+	c.Assert(query, Equals, "SELECT `id`,`name` FROM `test`.`t` ORDER BY `id` LIMIT 100")
+	c.Assert(keys, DeepEquals, []string{"id"})
+	query, _ = chunkQuery(info, "test", "t", false, 100)
+	c.Assert(query, Equals, "SELECT `id`,`name` FROM `test`.`t` WHERE (`id`) > (?) ORDER BY `id` LIMIT 100")
+
+	info.primaryKey = nil
+	query, keys = chunkQuery(info, "test", "t", false, 100)
+	c.Assert(query, Equals, "SELECT _tidb_rowid,`id`,`name` FROM `test`.`t` WHERE (`_tidb_rowid`) > (?) ORDER BY `_tidb_rowid` LIMIT 100")
+	c.Assert(keys, DeepEquals, []string{"_tidb_rowid"})
+}
+
+func (s *snapshotSuite) TestCopySnapshot(c *C) {
+	origGet := utilGetTableInfo
+	utilGetTableInfo = func(db *sql.DB, schema string, table string) (*tableInfo, error) {
+		return &tableInfo{columns: []string{"id", "name"}, primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}}}, nil
+	}
+	defer func() {
+		utilGetTableInfo = origGet
+	}()
+
+	upstream, upMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer upstream.Close()
+	downstream, downMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer downstream.Close()
+
+	upMock.ExpectBegin()
+	upMock.ExpectQuery(regexp.QuoteMeta(currentTSSQL)).WillReturnRows(sqlmock.NewRows([]string{"ts"}).AddRow(100))
+	upMock.ExpectRollback()
+	upMock.ExpectExec(regexp.QuoteMeta(setSnapshotSQL)).WithArgs("100").WillReturnResult(sqlmock.NewResult(0, 0))
+	upMock.ExpectQuery("SELECT .* ORDER BY `id` LIMIT 2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b"))
+	upMock.ExpectQuery("SELECT .* WHERE \\(`id`\\) > \\(\\?\\) ORDER BY `id` LIMIT 2").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "c"))
+	upMock.ExpectExec(regexp.QuoteMeta(resetSnapshotSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for _, args := range [][]driver.Value{{1, "a", 2, "b"}, {3, "c"}} {
+		downMock.ExpectExec(regexp.QuoteMeta(disableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+		downMock.ExpectExec("REPLACE INTO `test`.`t`.*").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, int64(len(args)/2)))
+		downMock.ExpectExec(regexp.QuoteMeta(enableChecksSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	ld, err := NewLoader(downstream, WorkerCount(1), BatchSize(2))
+	c.Assert(err, IsNil)
+	impl := ld.(*loaderImpl)
+	ts, err := ld.CopySnapshot(context.Background(), upstream, 0, filter.TableName{Schema: "test", Table: "t"})
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(100))
+	c.Assert(upMock.ExpectationsWereMet(), IsNil)
+	c.Assert(downMock.ExpectationsWereMet(), IsNil)
+
+	// the table is resumed, and its DMLs in the snapshot are dropped
+	c.Assert(impl.pause.takeResumed(), DeepEquals, []filter.TableName{{Schema: "test", Table: "t"}})
+	c.Assert(impl.snapshots.covers(&DML{Database: "test", Table: "t"}, 100), IsTrue)
+	c.Assert(impl.snapshots.covers(&DML{Database: "test", Table: "t"}, 101), IsFalse)
+}
+
+func (s *snapshotSuite) TestDropSnapshotted(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	ld, err := NewLoader(db)
+	c.Assert(err, IsNil)
+	impl := ld.(*loaderImpl)
+
+	impl.pause.pause("test", "t1")
+	txn1 := &Txn{CommitTS: 10, DMLs: []*DML{newPauseDML("t1", 1)}}
+	txn2 := &Txn{CommitTS: 11, DMLs: []*DML{newPauseDML("t1", 2)}}
+	c.Assert(impl.pause.hold(txn1, 0), IsTrue)
+	c.Assert(impl.pause.hold(txn2, 0), IsTrue)
+	impl.snapshots.set("`test`.`t1`", 10)
+
+	kept := impl.dropSnapshotted(impl.pause.buffered["`test`.`t1`"])
+	c.Assert(kept, HasLen, 1)
+	c.Assert(kept[0].Values["id"], Equals, 2)
+	c.Assert(impl.pause.size, Equals, 1)
+	c.Assert(impl.pause.pending[txn1], Equals, 0)
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// the bits of the logical part of a TSO, the physical part is the milliseconds before it
+const tsoLogicalBits = 18
+
+// SoftDelete turns the deletes of the tables matched into the updates setting Column, the tombstone of the rows,
+// e.g., deleted_at, to the commit time of the txn. The empty Schema or Table matches any.
+type SoftDelete struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Column string `toml:"column" json:"column"`
+}
+
+func (d *SoftDelete) validate() error {
+	if len(d.Column) == 0 {
+		return errors.Errorf("invalid soft delete of %s, column must be set", quoteSchema(d.Schema, d.Table))
+	}
+	return nil
+}
+
+// SoftDeletes makes loader keep the rows deleted in the tables matched, e.g., for the analytics downstreams which
+// must not lose any row, the deletes are applied as the updates setting the tombstone columns to the commit time of
+// the txns, or the current time if the commit ts isn't set. The column must be in the downstream table and can hold
+// a time, e.g., DATETIME(3), and be NULL by default. The inserts of the tables are applied as REPLACE even out of
+// safe mode, so a row inserted again with the same key replaces the tombstone and its column is NULL again.
+// The most specific one is used for each table, the first one is used if there're more than one.
+func SoftDeletes(tables ...SoftDelete) Option {
+	return func(o *options) {
+		o.softDeletes = append(o.softDeletes, tables...)
+	}
+}
+
+// softDeleteOf returns the most specific SoftDelete matching the table, nil if none matches
+func softDeleteOf(deletes []SoftDelete, schema string, table string) *SoftDelete {
+	var found *SoftDelete
+	best := -1
+	for i := range deletes {
+		if specificity, ok := matchTable(deletes[i].Schema, deletes[i].Table, schema, table); ok && specificity > best {
+			found = &deletes[i]
+			best = specificity
+		}
+	}
+	return found
+}
+
+// softDelete turns the deletes of txn of the tables matched by SoftDeletes into the updates of their tombstones
+func (s *loaderImpl) softDelete(txn *Txn) {
+	if len(s.softDeletes) == 0 || txn.isDDL() {
+		return
+	}
+	for _, dml := range txn.DMLs {
+		if dml.Tp != DeleteDMLType {
+			continue
+		}
+		d := softDeleteOf(s.softDeletes, dml.Database, dml.Table)
+		if d == nil {
+			continue
+		}
+		values := make(map[string]interface{}, len(dml.Values)+1)
+		for name, v := range dml.Values {
+			values[name] = v
+		}
+		values[d.Column] = commitTime(txn.CommitTS)
+		dml.Tp, dml.OldValues, dml.Values = UpdateDMLType, dml.Values, values
+	}
+}
+
+// replacesTombstone returns true if dml is an insert of a table matched by SoftDeletes, the row deleted before
+// is kept as a tombstone, so it's replaced instead of inserted
+func (dml *DML) replacesTombstone() bool {
+	return dml.Tp == InsertDMLType && dml.info != nil && dml.info.softDelete
+}
+
+// commitTime returns the physical time of the commit ts, or the current time if it's 0
+func commitTime(commitTS int64) time.Time {
+	if commitTS <= 0 {
+		return time.Now()
+	}
+	return time.Unix(0, (commitTS>>tsoLogicalBits)*int64(time.Millisecond))
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type softDeleteSuite struct{}
+
+var _ = Suite(&softDeleteSuite{})
+
+func (s *softDeleteSuite) TestSoftDeleteOf(c *C) {
+	deletes := []SoftDelete{
+		{Column: "deleted_at"},
+		{Schema: "test", Table: "t", Column: "removed_at"},
+	}
+	c.Assert(softDeleteOf(deletes, "test", "t").Column, Equals, "removed_at")
+	c.Assert(softDeleteOf(deletes, "test", "t2").Column, Equals, "deleted_at")
+	c.Assert(softDeleteOf(nil, "test", "t"), IsNil)
+	c.Assert((&SoftDelete{Schema: "test"}).validate(), NotNil)
+}
+
+func (s *softDeleteSuite) TestSoftDelete(c *C) {
+	ld := &loaderImpl{softDeletes: []SoftDelete{{Schema: "test", Table: "t", Column: "deleted_at"}}}
+	del := NewDelete("test", "t", map[string]interface{}{"id": 1})
+	other := NewDelete("test", "other", map[string]interface{}{"id": 1})
+	insert := NewInsert("test", "t", map[string]interface{}{"id": 2})
+	// 1000 ms in physical
+	txn := &Txn{CommitTS: 1000 << tsoLogicalBits, DMLs: []*DML{del, other, insert}}
+	ld.softDelete(txn)
+
+	c.Assert(del.Tp, Equals, UpdateDMLType)
+	c.Assert(del.OldValues, DeepEquals, map[string]interface{}{"id": 1})
+	c.Assert(del.Values, DeepEquals, map[string]interface{}{"id": 1, "deleted_at": time.Unix(1, 0)})
+	c.Assert(other.Tp, Equals, DeleteDMLType)
+	c.Assert(insert.Tp, Equals, InsertDMLType)
+	c.Assert(insert.Values, HasLen, 1)
+}
+
+func (s *softDeleteSuite) TestReinsert(c *C) {
+	pk := indexInfo{name: "PRIMARY", columns: []string{"id"}}
+	info := &tableInfo{columns: []string{"id", "name", "deleted_at"}, primaryKey: &pk, uniqueKeys: []indexInfo{pk}, softDelete: true}
+	ld := &loaderImpl{softDeletes: []SoftDelete{{Schema: "test", Table: "t", Column: "deleted_at"}}}
+	deleted := time.Unix(1, 0)
+
+	for _, safeMode := range []bool{false, true} {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+
+		del := NewDelete("test", "t", map[string]interface{}{"id": 1, "name": "a"})
+		del.info = info
+		ld.softDelete(&Txn{CommitTS: 1000 << tsoLogicalBits, DMLs: []*DML{del}})
+		insert := NewInsert("test", "t", map[string]interface{}{"id": 1, "name": "b"})
+		insert.info = info
+
+		mock.ExpectBegin()
+		if safeMode {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`.`t` WHERE `id` = ? LIMIT 1")).
+				WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`t`(`id`,`name`,`deleted_at`) VALUES(?,?,?)")).
+				WithArgs(1, "a", deleted).WillReturnResult(sqlmock.NewResult(0, 1))
+		} else {
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `test`.`t` SET `deleted_at` = ?,`id` = ?,`name` = ? WHERE `id` = ? LIMIT 1")).
+				WithArgs(deleted, 1, "a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		// the row kept as a tombstone is replaced, with the tombstone column cleared
+		mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`t`(`id`,`name`,`deleted_at`) VALUES(?,?,?)")).
+			WithArgs(1, "b", nil).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		err = newExecutor(db).singleExec([]*DML{del, insert}, safeMode)
+		c.Assert(err, IsNil)
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		db.Close()
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxCachedSQLs is the max number of the bulk SQLs cached per table, most batches are full,
+// so the SQLs of the batch size are the ones cached first
+const maxCachedSQLs = 16
+
+type sqlCacheKey struct {
+	verb   string
+	into   string
+	schema string
+	table  string
+	rows   int
+	// the columns of the rows if they lack some columns of the table, see insertColumns
+	columns string
+}
+
+// sqlCache caches the SQL texts of the multi-row REPLACE and DELETE statements of a table by the number of rows,
+// it's held by the tableInfo, so it's dropped together with the table info refreshed on schema change.
+type sqlCache struct {
+	mu   sync.RWMutex
+	sqls map[sqlCacheKey]string
+}
+
+// get returns the SQL of key, it's built by build and cached if missing
+func (c *sqlCache) get(key sqlCacheKey, build func() string) string {
+	c.mu.RLock()
+	sql, ok := c.sqls[key]
+	c.mu.RUnlock()
+	if ok {
+		return sql
+	}
+
+	sql = build()
+	c.mu.Lock()
+	if c.sqls == nil {
+		c.sqls = make(map[sqlCacheKey]string)
+	}
+	if len(c.sqls) < maxCachedSQLs {
+		c.sqls[key] = sql
+	}
+	c.mu.Unlock()
+	return sql
+}
+
+// deleteByPrimaryKey returns true if the delete SQL of each of deletes is by the primary key, i.e.,
+// the SQLs are the same except the values
+func deleteByPrimaryKey(deletes []*DML) bool {
+	pk := deletes[0].info.primaryKey
+	// the where clause is built by the first unique key without NULL values
+	if pk == nil || deletes[0].info.uniqueKeys[0].name != pk.name {
+		return false
+	}
+	for _, dml := range deletes {
+		for _, name := range pk.columns {
+			if dml.Values[name] == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bulkDeleteByPrimaryKeySQL returns the SQL of bulkDeleteStatement if deleteByPrimaryKey(deletes) is true
+func bulkDeleteByPrimaryKeySQL(deletes []*DML) string {
+	first := deletes[0]
+	key := sqlCacheKey{verb: "DELETE", schema: first.Database, table: first.Table, rows: len(deletes)}
+	return first.info.sqls.get(key, func() string {
+		sql, args := first.deleteSQL()
+		putArgs(args)
+		return strings.Repeat(sql+";", len(deletes))
+	})
+}
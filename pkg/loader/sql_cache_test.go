@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"testing"
+
+	check "github.com/pingcap/check"
+)
+
+type sqlCacheSuite struct{}
+
+var _ = check.Suite(&sqlCacheSuite{})
+
+func newSQLCacheDMLs(info *tableInfo, tp DMLType, n int) []*DML {
+	dmls := make([]*DML, 0, n)
+	for i := 0; i < n; i++ {
+		dmls = append(dmls, &DML{Database: "db", Table: "tbl", Tp: tp, info: info,
+			Values: map[string]interface{}{"id": i, "name": fmt.Sprintf("name%d", i)}})
+	}
+	return dmls
+}
+
+func newSQLCacheTableInfo() *tableInfo {
+	return (&TableSchema{Columns: []string{"id", "name"}, PrimaryKey: []string{"id"}}).tableInfo()
+}
+
+func (s *sqlCacheSuite) TestBulkStatements(c *check.C) {
+	info := newSQLCacheTableInfo()
+
+	stmt := bulkReplaceStatement(newSQLCacheDMLs(info, InsertDMLType, 2))
+	c.Assert(stmt.SQL, check.Equals, "REPLACE INTO `db`.`tbl`(`id`,`name`) VALUES (?,?),(?,?)")
+	c.Assert(stmt.Args, check.DeepEquals, []interface{}{0, "name0", 1, "name1"})
+	// the SQL is cached by the number of rows
+	c.Assert(bulkReplaceStatement(newSQLCacheDMLs(info, InsertDMLType, 2)).SQL, check.Equals, stmt.SQL)
+	c.Assert(bulkReplaceStatement(newSQLCacheDMLs(info, InsertDMLType, 1)).SQL, check.Equals,
+		"REPLACE INTO `db`.`tbl`(`id`,`name`) VALUES (?,?)")
+	c.Assert(bulkInsertIgnoreStatement(newSQLCacheDMLs(info, InsertDMLType, 1)).SQL, check.Equals,
+		"INSERT IGNORE INTO `db`.`tbl`(`id`,`name`) VALUES (?,?)")
+	c.Assert(info.sqls.sqls, check.HasLen, 3)
+
+	stmt = bulkDeleteStatement(newSQLCacheDMLs(info, DeleteDMLType, 2))
+	c.Assert(stmt.SQL, check.Equals, "DELETE FROM `db`.`tbl` WHERE `id` = ? LIMIT 1;DELETE FROM `db`.`tbl` WHERE `id` = ? LIMIT 1;")
+	c.Assert(stmt.Args, check.DeepEquals, []interface{}{0, 1})
+	c.Assert(info.sqls.sqls, check.HasLen, 4)
+
+	// the deletes with NULL primary key values aren't cached
+	deletes := newSQLCacheDMLs(info, DeleteDMLType, 2)
+	deletes[1].Values["id"] = nil
+	stmt = bulkDeleteStatement(deletes)
+	c.Assert(stmt.SQL, check.Equals,
+		"DELETE FROM `db`.`tbl` WHERE `id` = ? LIMIT 1;DELETE FROM `db`.`tbl` WHERE `id` IS NULL AND `name` = ? LIMIT 1;")
+	c.Assert(stmt.Args, check.DeepEquals, []interface{}{0, "name1"})
+	c.Assert(info.sqls.sqls, check.HasLen, 4)
+
+	// the table info refreshed on schema change has no SQLs cached
+	info = newSQLCacheTableInfo()
+	info.columns = append(info.columns, "age")
+	inserts := newSQLCacheDMLs(info, InsertDMLType, 1)
+	inserts[0].Values["age"] = 18
+	stmt = bulkReplaceStatement(inserts)
+	c.Assert(stmt.SQL, check.Equals, "REPLACE INTO `db`.`tbl`(`id`,`name`,`age`) VALUES (?,?,?)")
+
+	// the rows lacking columns are cached by the columns too
+	stmt = bulkReplaceStatement(newSQLCacheDMLs(info, InsertDMLType, 1))
+	c.Assert(stmt.SQL, check.Equals, "REPLACE INTO `db`.`tbl`(`id`,`name`) VALUES (?,?)")
+	c.Assert(info.sqls.sqls, check.HasLen, 2)
+}
+
+func (s *sqlCacheSuite) TestMaxCachedSQLs(c *check.C) {
+	info := newSQLCacheTableInfo()
+	for n := 1; n <= maxCachedSQLs+4; n++ {
+		bulkReplaceStatement(newSQLCacheDMLs(info, InsertDMLType, n))
+	}
+	c.Assert(info.sqls.sqls, check.HasLen, maxCachedSQLs)
+}
+
+// BenchmarkBulkStatements compares the allocations of the bulk statements with the SQLs cached by the
+// table info and the ones built every time
+func BenchmarkBulkStatements(b *testing.B) {
+	for _, cached := range []bool{true, false} {
+		b.Run(fmt.Sprintf("cached=%v", cached), func(b *testing.B) {
+			info := newSQLCacheTableInfo()
+			inserts := newSQLCacheDMLs(info, InsertDMLType, 128)
+			deletes := newSQLCacheDMLs(info, DeleteDMLType, 128)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !cached {
+					info.sqls = sqlCache{}
+				}
+				putArgs(bulkReplaceStatement(inserts).Args)
+				putArgs(bulkDeleteStatement(deletes).Args)
+			}
+		})
+	}
+}
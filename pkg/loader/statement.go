@@ -0,0 +1,336 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+)
+
+// Statement is a SQL statement with its arguments executed in downstream
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// TableSchema describes the table the DMLs belong to, it's used to generate
+// the SQL statements without querying downstream for the table information.
+type TableSchema struct {
+	// the non-generated columns in order
+	Columns []string
+	// empty if the table has no primary key
+	PrimaryKey []string
+	// the unique keys other than the primary key
+	UniqueKeys [][]string
+	// the hint added to the statements, see StatementHints
+	Hint string
+}
+
+func (s *TableSchema) tableInfo() *tableInfo {
+	info := &tableInfo{columns: s.Columns, hint: s.Hint}
+	if len(s.PrimaryKey) > 0 {
+		info.uniqueKeys = append(info.uniqueKeys, indexInfo{name: "PRIMARY", columns: s.PrimaryKey})
+		info.primaryKey = &info.uniqueKeys[0]
+	}
+	for i, columns := range s.UniqueKeys {
+		info.uniqueKeys = append(info.uniqueKeys, indexInfo{name: fmt.Sprintf("uk_%d", i), columns: columns})
+	}
+	return info
+}
+
+// GenerateStatements returns the statements the loader executes for the DMLs of a table,
+// each element holds the statements executed in one transaction.
+// The DMLs are merged by primary key and executed in batches if merge is true like the loader
+// does when it's enabled and the table has primary key, otherwise they are executed one by one.
+// The merged DMLs are executed in one transaction if any update changes the primary key.
+// Note the table information of dmls is set to the one of schema.
+func GenerateStatements(schema *TableSchema, dmls []*DML, merge bool, safeMode bool, batchSize int) ([][]Statement, error) {
+	info := schema.tableInfo()
+	for _, dml := range dmls {
+		dml.info = info
+	}
+
+	var txns [][]Statement
+	if !merge {
+		for _, split := range splitDMLs(dmls, batchSize) {
+			txns = append(txns, singleExecStatements(split, safeMode))
+		}
+		return txns, nil
+	}
+
+	keyUpdated := hasKeyUpdate(dmls)
+	types, err := mergeByPrimaryKey(dmls, log.L())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer releaseDMLs(types)
+	if keyUpdated {
+		return [][]Statement{tableBatchStatements(types, batchSize, true)}, nil
+	}
+	for _, split := range splitDMLs(types[DeleteDMLType], batchSize) {
+		txns = append(txns, []Statement{bulkDeleteStatement(split)})
+	}
+	for _, split := range splitDMLs(types[InsertDMLType], batchSize) {
+		txns = append(txns, bulkReplaceStatements(split))
+	}
+	for _, split := range splitDMLs(types[UpdateDMLType], batchSize) {
+		txns = append(txns, bulkReplaceStatements(split))
+	}
+	return txns, nil
+}
+
+// FormatStatements formats the statements of the transactions as text, one statement per line
+// followed by its arguments, it's used to compare the generated statements with the golden files.
+func FormatStatements(txns [][]Statement) string {
+	var b strings.Builder
+	for _, stmts := range txns {
+		b.WriteString("BEGIN;\n")
+		for _, stmt := range stmts {
+			b.WriteString(stmt.SQL)
+			b.WriteString(";\n")
+			if len(stmt.Args) > 0 {
+				args := make([]string, 0, len(stmt.Args))
+				for _, arg := range stmt.Args {
+					args = append(args, fmt.Sprintf("%#v", arg))
+				}
+				fmt.Fprintf(&b, "-- args: %s\n", strings.Join(args, ", "))
+			}
+		}
+		b.WriteString("COMMIT;\n")
+	}
+	return b.String()
+}
+
+// bulkDeleteStatement returns the statement deleting all the rows of deletes
+func bulkDeleteStatement(deletes []*DML) Statement {
+	if deleteByPrimaryKey(deletes) {
+		pk := deletes[0].info.primaryKey.columns
+		args := getArgs(len(deletes) * len(pk))
+		for _, dml := range deletes {
+			for _, name := range pk {
+				args = append(args, dml.Values[name])
+			}
+		}
+		return Statement{SQL: bulkDeleteByPrimaryKeySQL(deletes), Args: args}
+	}
+
+	sqls := getBuffer()
+	defer putBuffer(sqls)
+	argss := getArgs(len(deletes))
+
+	for _, dml := range deletes {
+		sql, args := dml.sql()
+		sqls.WriteString(sql)
+		sqls.WriteByte(';')
+		argss = append(argss, args...)
+		putArgs(args)
+	}
+
+	return Statement{SQL: sqls.String(), Args: argss}
+}
+
+// bulkReplaceStatement returns the statement replacing all the rows of inserts,
+// they must belong to the same table and have the same columns, see groupByColumns.
+func bulkReplaceStatement(inserts []*DML) Statement {
+	return bulkInsertStatement("REPLACE", "INTO", inserts)
+}
+
+// bulkReplaceStatements returns the statements replacing all the rows of inserts, one for the rows of each
+// column set, they must belong to the same table.
+func bulkReplaceStatements(inserts []*DML) []Statement {
+	var stmts []Statement
+	for _, group := range groupByColumns(inserts) {
+		stmts = append(stmts, bulkReplaceStatement(group))
+	}
+	return stmts
+}
+
+// bulkInsertIgnoreStatement returns the statement inserting all the rows of inserts and ignoring
+// the ones existing, they must belong to the same table and have the same columns, see groupByColumns.
+func bulkInsertIgnoreStatement(inserts []*DML) Statement {
+	return bulkInsertStatement("INSERT", "IGNORE INTO", inserts)
+}
+
+// bulkInsertIgnoreStatements is bulkInsertIgnoreStatement for the rows of different column sets.
+func bulkInsertIgnoreStatements(inserts []*DML) []Statement {
+	var stmts []Statement
+	for _, group := range groupByColumns(inserts) {
+		stmts = append(stmts, bulkInsertIgnoreStatement(group))
+	}
+	return stmts
+}
+
+func bulkInsertStatement(verb string, into string, inserts []*DML) Statement {
+	info := inserts[0].info
+	columns := insertColumns(inserts[0])
+	key := sqlCacheKey{verb: verb, into: into, schema: inserts[0].Database, table: inserts[0].Table, rows: len(inserts)}
+	if len(columns) < len(info.columns) {
+		key.columns = strings.Join(columns, ",")
+	}
+	sql := info.sqls.get(key, func() string {
+		builder := getBuffer()
+		defer putBuffer(builder)
+
+		cols := "(" + buildColumnList(columns) + inserts[0].virtualColumnList() + ")"
+		builder.WriteString(inserts[0].verb(verb) + " " + into + " " + inserts[0].TableName() + cols + " VALUES ")
+
+		holder := fmt.Sprintf("(%s%s)", holderString(len(columns)), inserts[0].virtualValues())
+		for i := 0; i < len(inserts); i++ {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			builder.WriteString(holder)
+		}
+		return builder.String()
+	})
+
+	args := insertArgs(inserts, columns)
+
+	return Statement{SQL: sql, Args: args}
+}
+
+// insertColumns returns the columns of the table info of dml which dml has values of, in the order of the table,
+// the columns lacked, e.g., the ones added by a later schema version, are left to the default values of downstream.
+func insertColumns(dml *DML) []string {
+	columns := dml.info.columns
+	for i, col := range columns {
+		if _, ok := dml.Values[col]; ok {
+			continue
+		}
+		// rarely reached, the columns are copied only if some are lacked
+		present := append([]string(nil), columns[:i]...)
+		for _, col := range columns[i+1:] {
+			if _, ok := dml.Values[col]; ok {
+				present = append(present, col)
+			}
+		}
+		return present
+	}
+	return columns
+}
+
+// groupByColumns groups the inserts of a table by the columns of their values in their table infos, e.g., the DMLs
+// produced under different schema versions in a batch, so that the rows of a multi-row statement have the same
+// columns. The groups are in the order of their first DMLs, and the DMLs of a group are kept in order.
+func groupByColumns(inserts []*DML) [][]*DML {
+	if len(inserts) == 0 {
+		return nil
+	}
+	if sameColumns(inserts) {
+		return [][]*DML{inserts}
+	}
+
+	var groups [][]*DML
+	indexes := make(map[string]int)
+	for _, dml := range inserts {
+		key := strings.Join(insertColumns(dml), ",")
+		i, ok := indexes[key]
+		if !ok {
+			i = len(groups)
+			indexes[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], dml)
+	}
+	return groups
+}
+
+// sameColumns returns true if the inserts have the same columns in their table infos and values of all of them,
+// which is the common case checked without allocation
+func sameColumns(inserts []*DML) bool {
+	info := inserts[0].info
+	for _, dml := range inserts {
+		if dml.info != info && !equalStrings(dml.info.columns, info.columns) {
+			return false
+		}
+		for _, col := range info.columns {
+			if _, ok := dml.Values[col]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tableBatchStatements returns the bulk statements of the DMLs merged by mergeByPrimaryKey in the
+// order they must be executed, the deletes first, then the inserts and updates. The deletes are executed one by
+// one if multi is false, as bulkDeleteStatement is a multi-statement query.
+func tableBatchStatements(types map[DMLType][]*DML, batchSize int, multi bool) []Statement {
+	var stmts []Statement
+	for _, split := range splitDMLs(types[DeleteDMLType], batchSize) {
+		if !multi {
+			stmts = append(stmts, singleExecStatements(split, false)...)
+			continue
+		}
+		stmts = append(stmts, bulkDeleteStatement(split))
+	}
+	for _, split := range splitDMLs(types[InsertDMLType], batchSize) {
+		stmts = append(stmts, bulkReplaceStatements(split)...)
+	}
+	for _, split := range splitDMLs(types[UpdateDMLType], batchSize) {
+		stmts = append(stmts, bulkReplaceStatements(split)...)
+	}
+	return stmts
+}
+
+// hasKeyUpdate returns true if any of dmls is an update changing the primary key
+func hasKeyUpdate(dmls []*DML) bool {
+	for _, dml := range dmls {
+		if dml.Tp == UpdateDMLType && dml.updateKey() {
+			return true
+		}
+	}
+	return false
+}
+
+// singleExecStatements returns the statements executing dmls one by one,
+// in safe mode the update is turned into delete + replace, and the insert is turned into replace.
+// The update changing the primary key is always turned into delete + replace, and the insert replacing
+// a tombstone of SoftDeletes is always turned into replace.
+func singleExecStatements(dmls []*DML, safeMode bool) []Statement {
+	stmts := make([]Statement, 0, len(dmls))
+	for _, dml := range dmls {
+		if dml.resolvesConflict() {
+			stmts = append(stmts, conflictStatements(dml)...)
+		} else if dml.Tp == UpdateDMLType && (safeMode || dml.updateKey()) {
+			sql, args := dml.deleteSQL()
+			stmts = append(stmts, Statement{SQL: sql, Args: args})
+
+			sql, args = dml.replaceSQL()
+			stmts = append(stmts, Statement{SQL: sql, Args: args})
+		} else if (safeMode && dml.Tp == InsertDMLType) || dml.replacesTombstone() {
+			sql, args := dml.replaceSQL()
+			stmts = append(stmts, Statement{SQL: sql, Args: args})
+		} else {
+			sql, args := dml.sql()
+			stmts = append(stmts, Statement{SQL: sql, Args: args})
+		}
+	}
+	return stmts
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
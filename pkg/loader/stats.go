@@ -0,0 +1,123 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// StatsTable is the downstream table the per-table apply statistics are exported to, see ExportStats
+const StatsTable = "_loader_stats"
+
+// ExportStats makes loader write the applied row counts and the latest commit ts of each table into the table
+// StatsTable of schema in downstream every interval, so the consumers of downstream can tell the freshness of
+// each table by plain SQL. The counts written are the increments since the last export, so they accumulate
+// across the restarts. It's disabled if interval is 0.
+func ExportStats(schema string, interval time.Duration) Option {
+	return func(o *options) {
+		o.statsSchema = schema
+		o.statsInterval = interval
+	}
+}
+
+// createStatsTableSQLs returns the statements creating the stats table if it doesn't exist
+func createStatsTableSQLs(schema string) []string {
+	return []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteName(schema)),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s("+
+			"`db_name` VARCHAR(255) NOT NULL, `tbl_name` VARCHAR(255) NOT NULL, "+
+			"`applied_ts` BIGINT NOT NULL DEFAULT 0, `inserted` BIGINT NOT NULL DEFAULT 0, "+
+			"`updated` BIGINT NOT NULL DEFAULT 0, `deleted` BIGINT NOT NULL DEFAULT 0, `ddls` BIGINT NOT NULL DEFAULT 0, "+
+			"`update_time` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, "+
+			"PRIMARY KEY (`db_name`, `tbl_name`))", quoteSchema(schema, StatsTable)),
+	}
+}
+
+// statsSQL is the statement adding the increments of the counts of a table and advancing its applied ts
+func statsSQL(schema string) string {
+	return fmt.Sprintf("INSERT INTO %s(`db_name`,`tbl_name`,`applied_ts`,`inserted`,`updated`,`deleted`,`ddls`) VALUES(?,?,?,?,?,?,?) "+
+		"ON DUPLICATE KEY UPDATE `applied_ts` = GREATEST(`applied_ts`, VALUES(`applied_ts`)), `inserted` = `inserted` + VALUES(`inserted`), "+
+		"`updated` = `updated` + VALUES(`updated`), `deleted` = `deleted` + VALUES(`deleted`), `ddls` = `ddls` + VALUES(`ddls`)",
+		quoteSchema(schema, StatsTable))
+}
+
+// createStatsTable creates the stats table in downstream if it doesn't exist
+func (s *loaderImpl) createStatsTable() error {
+	for _, sql := range createStatsTableSQLs(s.statsSchema) {
+		if _, err := s.getDB().Exec(sql); err != nil {
+			return errors.Annotatef(err, "create stats table failed, sql: %s", sql)
+		}
+	}
+	return nil
+}
+
+// statsStatements returns the statements exporting the changes of the tables since the last export,
+// and the status of the tables at the moment
+func (s *loaderImpl) statsStatements() ([]Statement, map[string]TableStatus) {
+	sql := statsSQL(s.statsSchema)
+	statuses := s.tableStatus.status()
+	current := make(map[string]TableStatus, len(statuses))
+	var stmts []Statement
+	for _, status := range statuses {
+		key := quoteSchema(status.Database, status.Table)
+		current[key] = status
+		last := s.statsExported[key]
+		if status.AppliedTS == last.AppliedTS && status.Inserted == last.Inserted && status.Updated == last.Updated &&
+			status.Deleted == last.Deleted && status.DDLs == last.DDLs {
+			continue
+		}
+		stmts = append(stmts, Statement{SQL: sql, Args: []interface{}{status.Database, status.Table, status.AppliedTS,
+			status.Inserted - last.Inserted, status.Updated - last.Updated, status.Deleted - last.Deleted, status.DDLs - last.DDLs}})
+	}
+	return stmts, current
+}
+
+// exportStats writes the changes of the tables since the last export into the stats table in one txn,
+// the failure is only logged and the changes are written by the next export
+func (s *loaderImpl) exportStats() {
+	s.statsExportTime = time.Now()
+	stmts, current := s.statsStatements()
+	if len(stmts) == 0 {
+		return
+	}
+	if s.loopbackControl() {
+		stmts = append(stmts, s.markStatement())
+	}
+
+	if err := s.execStats(stmts); err != nil {
+		s.getLogger().Warn("export stats failed", zap.String("table", quoteSchema(s.statsSchema, StatsTable)), zap.Error(err))
+		return
+	}
+	s.statsExported = current
+}
+
+func (s *loaderImpl) execStats(stmts []Statement) error {
+	tx, err := s.getDB().Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt.SQL, stmt.Args...); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				s.getLogger().Error("Auto rollback", zap.Error(rbErr))
+			}
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(tx.Commit())
+}
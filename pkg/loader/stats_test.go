@@ -0,0 +1,71 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type statsSuite struct{}
+
+var _ = Suite(&statsSuite{})
+
+func (s *statsSuite) TestStatsStatements(c *C) {
+	loader := &loaderImpl{statsSchema: "tidb_binlog"}
+	loader.tableStatus.onSuccess(&Txn{CommitTS: 10, DMLs: []*DML{
+		{Database: "test", Table: "t1", Tp: InsertDMLType},
+		{Database: "test", Table: "t1", Tp: InsertDMLType},
+		{Database: "test", Table: "t2", Tp: DeleteDMLType},
+	}})
+
+	stmts, current := loader.statsStatements()
+	c.Assert(stmts, HasLen, 2)
+	c.Assert(stmts[0].SQL, Matches, "INSERT INTO `tidb_binlog`.`_loader_stats`.*ON DUPLICATE KEY UPDATE.*")
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{"test", "t1", int64(10), int64(2), int64(0), int64(0), int64(0)})
+	c.Assert(stmts[1].Args, DeepEquals, []interface{}{"test", "t2", int64(10), int64(0), int64(0), int64(1), int64(0)})
+	loader.statsExported = current
+
+	// only the increments of the tables changed are exported
+	loader.tableStatus.onSuccess(&Txn{CommitTS: 20, DMLs: []*DML{{Database: "test", Table: "t1", Tp: UpdateDMLType}}})
+	stmts, _ = loader.statsStatements()
+	c.Assert(stmts, HasLen, 1)
+	c.Assert(stmts[0].Args, DeepEquals, []interface{}{"test", "t1", int64(20), int64(0), int64(1), int64(0), int64(0)})
+}
+
+func (s *statsSuite) TestExportStats(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	loader := &loaderImpl{db: db, statsSchema: "tidb_binlog"}
+	loader.tableStatus.onSuccess(&Txn{CommitTS: 10, DMLs: []*DML{{Database: "test", Table: "t1", Tp: InsertDMLType}}})
+
+	// the failed export is retried by the next one
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `tidb_binlog`.`_loader_stats`").WillReturnError(errors.New("fake"))
+	mock.ExpectRollback()
+	loader.exportStats()
+	c.Assert(loader.statsExported, HasLen, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `tidb_binlog`.`_loader_stats`").WithArgs("test", "t1", 10, 1, 0, 0, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	loader.exportStats()
+	c.Assert(loader.statsExported, HasLen, 1)
+
+	// nothing changed
+	loader.exportStats()
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
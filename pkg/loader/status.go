@@ -0,0 +1,205 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TableStatus is the replication status of a table.
+type TableStatus struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// commit ts of the last txn loaded to this table, it's 0 if Txn.CommitTS is not set
+	AppliedTS int64 `json:"applied-ts"`
+	Inserted  int64 `json:"inserted"`
+	Updated   int64 `json:"updated"`
+	Deleted   int64 `json:"deleted"`
+	DDLs      int64 `json:"ddls"`
+	// the table has no primary key or unique key, see NoKeyTables
+	NoKey bool `json:"no-key,omitempty"`
+	// the updates and deletes not affecting exactly one row, and whether the table is switched to safe mode
+	// for them, see VerifyAffectedRows
+	Drifts   int64 `json:"drifts,omitempty"`
+	SafeMode bool  `json:"safe-mode,omitempty"`
+	// the table is paused or its DMLs buffered are not applied yet, see Loader.PauseTable
+	Paused bool `json:"paused,omitempty"`
+
+	LastError     string    `json:"last-error,omitempty"`
+	LastErrorTime time.Time `json:"last-error-time,omitempty"`
+
+	// the txns skipped by SavepointQuarantine, only the last maxQuarantinedTxns ones are kept
+	Quarantined      []QuarantinedTxn `json:"quarantined,omitempty"`
+	QuarantinedCount int64            `json:"quarantined-count,omitempty"`
+}
+
+// QuarantinedTxn is an upstream txn skipped after failing in group commit, see SavepointQuarantine.
+type QuarantinedTxn struct {
+	// it's 0 if Txn.CommitTS is not set
+	CommitTS int64     `json:"commit-ts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// the max number of the txns quarantined kept in the TableStatus of a table
+const maxQuarantinedTxns = 100
+
+// tableStatusTracker tracks the TableStatus of all the tables loaded.
+// The zero value is ready to use.
+type tableStatusTracker struct {
+	sync.Mutex
+	tables map[string]*TableStatus
+}
+
+// get returns the status of the table, the caller must hold the lock.
+func (t *tableStatusTracker) get(database string, table string) *TableStatus {
+	if t.tables == nil {
+		t.tables = make(map[string]*TableStatus)
+	}
+	key := quoteSchema(database, table)
+	status, ok := t.tables[key]
+	if !ok {
+		status = &TableStatus{Database: database, Table: table}
+		t.tables[key] = status
+	}
+	return status
+}
+
+func (t *tableStatusTracker) onSuccess(txns ...*Txn) {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, txn := range txns {
+		if txn.isDDL() {
+			status := t.get(txn.DDL.Database, txn.DDL.Table)
+			status.DDLs++
+			if txn.CommitTS > status.AppliedTS {
+				status.AppliedTS = txn.CommitTS
+			}
+			continue
+		}
+
+		for _, dml := range txn.DMLs {
+			status := t.get(dml.Database, dml.Table)
+			switch dml.Tp {
+			case InsertDMLType:
+				status.Inserted++
+			case UpdateDMLType:
+				status.Updated++
+			case DeleteDMLType:
+				status.Deleted++
+			}
+			if txn.CommitTS > status.AppliedTS {
+				status.AppliedTS = txn.CommitTS
+			}
+		}
+	}
+}
+
+func (t *tableStatusTracker) onTableInfo(database string, table string, info *tableInfo) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.get(database, table).NoKey = len(info.uniqueKeys) == 0
+}
+
+func (t *tableStatusTracker) onDMLsError(dmls []*DML, err error) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	for _, dml := range dmls {
+		status := t.get(dml.Database, dml.Table)
+		status.LastError = err.Error()
+		status.LastErrorTime = now
+	}
+}
+
+// onQuarantine records the txn of dmls skipped in the status of each table it changes.
+func (t *tableStatusTracker) onQuarantine(dmls []*DML, commitTS int64, err error) {
+	t.Lock()
+	defer t.Unlock()
+
+	txn := QuarantinedTxn{CommitTS: commitTS, Error: err.Error(), Time: time.Now()}
+	recorded := make(map[*TableStatus]struct{})
+	for _, dml := range dmls {
+		status := t.get(dml.Database, dml.Table)
+		if _, ok := recorded[status]; ok {
+			continue
+		}
+		recorded[status] = struct{}{}
+
+		status.QuarantinedCount++
+		if len(status.Quarantined) >= maxQuarantinedTxns {
+			status.Quarantined = status.Quarantined[1:]
+		}
+		status.Quarantined = append(status.Quarantined, txn)
+	}
+}
+
+func (t *tableStatusTracker) onDrift(dml *DML, safeMode bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	status := t.get(dml.Database, dml.Table)
+	status.Drifts++
+	status.SafeMode = status.SafeMode || safeMode
+}
+
+func (t *tableStatusTracker) onPause(database string, table string, paused bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.get(database, table).Paused = paused
+}
+
+func (t *tableStatusTracker) onDDLError(ddl *DDL, err error) {
+	t.Lock()
+	defer t.Unlock()
+
+	status := t.get(ddl.Database, ddl.Table)
+	status.LastError = err.Error()
+	status.LastErrorTime = time.Now()
+}
+
+// status returns the status of all tables sorted by database and table name.
+func (t *tableStatusTracker) status() []TableStatus {
+	t.Lock()
+	defer t.Unlock()
+
+	res := make([]TableStatus, 0, len(t.tables))
+	for _, status := range t.tables {
+		s := *status
+		s.Quarantined = append([]QuarantinedTxn(nil), status.Quarantined...)
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Database != res[j].Database {
+			return res[i].Database < res[j].Database
+		}
+		return res[i].Table < res[j].Table
+	})
+
+	return res
+}
+
+func (t *tableStatusTracker) dump(logger FieldLogger) {
+	for _, status := range t.status() {
+		logger.Info("table status", zap.Reflect("status", status))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"errors"
+
+	check "github.com/pingcap/check"
+)
+
+type tableStatusSuite struct{}
+
+var _ = check.Suite(&tableStatusSuite{})
+
+func (s *tableStatusSuite) TestTrack(c *check.C) {
+	var tracker tableStatusTracker
+	c.Assert(tracker.status(), check.HasLen, 0)
+
+	dmls := []*DML{
+		{Database: "test", Table: "b", Tp: InsertDMLType},
+		{Database: "test", Table: "b", Tp: UpdateDMLType},
+		{Database: "test", Table: "a", Tp: DeleteDMLType},
+	}
+	tracker.onSuccess(&Txn{DMLs: dmls[:2], CommitTS: 10}, &Txn{DMLs: dmls[2:], CommitTS: 11})
+	tracker.onSuccess(NewDDLTxn("test", "a", "alter table a add column c int"))
+	tracker.onDMLsError(dmls[:1], errors.New("Lock wait timeout exceeded"))
+
+	status := tracker.status()
+	c.Assert(status, check.HasLen, 2)
+
+	c.Assert(status[0].Table, check.Equals, "a")
+	c.Assert(status[0].AppliedTS, check.Equals, int64(11))
+	c.Assert(status[0].Deleted, check.Equals, int64(1))
+	c.Assert(status[0].DDLs, check.Equals, int64(1))
+	c.Assert(status[0].LastError, check.Equals, "")
+
+	c.Assert(status[1].Table, check.Equals, "b")
+	c.Assert(status[1].AppliedTS, check.Equals, int64(10))
+	c.Assert(status[1].Inserted, check.Equals, int64(1))
+	c.Assert(status[1].Updated, check.Equals, int64(1))
+	c.Assert(status[1].LastError, check.Equals, "Lock wait timeout exceeded")
+	c.Assert(status[1].LastErrorTime.IsZero(), check.IsFalse)
+}
+
+func (s *tableStatusSuite) TestQuarantine(c *check.C) {
+	var tracker tableStatusTracker
+	dmls := []*DML{
+		{Database: "test", Table: "a", Tp: InsertDMLType},
+		{Database: "test", Table: "a", Tp: UpdateDMLType},
+	}
+	for i := 0; i <= maxQuarantinedTxns; i++ {
+		tracker.onQuarantine(dmls, int64(i), errors.New("duplicate entry"))
+	}
+
+	status := tracker.status()
+	c.Assert(status, check.HasLen, 1)
+	c.Assert(status[0].QuarantinedCount, check.Equals, int64(maxQuarantinedTxns+1))
+	c.Assert(status[0].Quarantined, check.HasLen, maxQuarantinedTxns)
+	c.Assert(status[0].Quarantined[0].CommitTS, check.Equals, int64(1))
+	c.Assert(status[0].Quarantined[maxQuarantinedTxns-1].CommitTS, check.Equals, int64(maxQuarantinedTxns))
+	c.Assert(status[0].Quarantined[0].Error, check.Equals, "duplicate entry")
+
+	// the status returned is a copy
+	status[0].Quarantined[0].CommitTS = -1
+	c.Assert(tracker.status()[0].Quarantined[0].CommitTS, check.Equals, int64(1))
+}
+
+func (s *tableStatusSuite) TestMarkSuccess(c *check.C) {
+	loader := &loaderImpl{successTxn: make(chan *Txn, 1)}
+	loader.markSuccess(&Txn{DMLs: []*DML{{Database: "test", Table: "t", Tp: InsertDMLType}}, CommitTS: 5})
+
+	status := loader.TableStatus()
+	c.Assert(status, check.HasLen, 1)
+	c.Assert(status[0].Inserted, check.Equals, int64(1))
+	c.Assert(status[0].AppliedTS, check.Equals, int64(5))
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+// TiDBSessionVars are the session variables of the downstream TiDB for OptimizeForTiDB, pass them to
+// CreateDBWithSessionVars. The unique constraints are checked when committing instead of by each
+// statement, and TiDB retries the optimistic txns meeting write conflicts itself, which is safe as the
+// statements executed by loader don't depend on what's read in the txn.
+// NOTE: `tidb_batch_commit` and the like are not set, they only take effect in autocommit statements,
+// but loader always executes the statements in explicit txns.
+var TiDBSessionVars = map[string]string{
+	"tidb_constraint_check_in_place": "0",
+	"tidb_txn_mode":                  "'optimistic'",
+	"tidb_disable_txn_auto_retry":    "0",
+	"tidb_retry_limit":               "10",
+}
+
+// the first backoff of retrying the txn failed by a write conflict or region error in the TiDB mode,
+// it's doubled each time up to the backoff of the other errors.
+var tidbRetryBackoff = 10 * time.Millisecond
+
+// isTiDBRetryableError returns true if err is a write conflict, region error or schema change of TiDB,
+// which is expected with optimistic txns and likely to succeed soon if retried.
+func isTiDBRetryableError(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+
+	switch mysqlErr.Number {
+	case tmysql.ErrWriteConflict, tmysql.ErrWriteConflictInTiDB, tmysql.ErrRegionUnavailable,
+		tmysql.ErrInfoSchemaExpired, tmysql.ErrInfoSchemaChanged:
+		return true
+	default:
+		return false
+	}
+}
+
+// retry calls fn executing dmls until it returns no error or ctx is done, for at most retryNum times, waiting
+// backoff before retrying, the error of the last attempt is returned as an ErrRetryExhausted. In the TiDB mode, the write conflicts and region errors are retried sooner, waiting
+// from tidbRetryBackoff and growing exponentially up to backoff.
+func (e *executor) retry(ctx context.Context, dmls []*DML, retryNum int, backoff time.Duration, fn func() error) error {
+	tidbBackoff := tidbRetryBackoff
+	var err error
+	for i := 0; i < retryNum; i++ {
+		err = fn()
+		// fail the attempts before the index given even if they succeed, as if the connection is lost
+		// after the txn is committed, so the retries must be idempotent
+		failpoint.Inject("failRetryAttempt", func(val failpoint.Value) {
+			if err == nil && i < val.(int) {
+				err = errors.Errorf("injected failure of attempt %d", i)
+			}
+		})
+		if err == nil {
+			return nil
+		}
+		// the loader fenced must stop writing at once, and the txn may have been committed if unknown
+		// the strict DMLs fail the same way again
+		if cause := errors.Cause(err); cause == errFenced || cause == errCommitUnknown || cause == errRowMissing {
+			return err
+		}
+
+		wait := backoff
+		if e.tidbMode && isTiDBRetryableError(err) && tidbBackoff < backoff {
+			wait = tidbBackoff
+			tidbBackoff *= 2
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	return newRetryExhausted(dmls, retryNum, err)
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+type tidbSuite struct{}
+
+var _ = Suite(&tidbSuite{})
+
+func (s *tidbSuite) TestIsTiDBRetryableError(c *C) {
+	c.Assert(isTiDBRetryableError(nil), IsFalse)
+	c.Assert(isTiDBRetryableError(errors.New("fake")), IsFalse)
+	c.Assert(isTiDBRetryableError(&mysql.MySQLError{Number: tmysql.ErrLockDeadlock}), IsFalse)
+	c.Assert(isTiDBRetryableError(errors.Trace(&mysql.MySQLError{Number: tmysql.ErrWriteConflict})), IsTrue)
+	c.Assert(isTiDBRetryableError(&mysql.MySQLError{Number: tmysql.ErrWriteConflictInTiDB}), IsTrue)
+	c.Assert(isTiDBRetryableError(&mysql.MySQLError{Number: tmysql.ErrRegionUnavailable}), IsTrue)
+	c.Assert(isTiDBRetryableError(&mysql.MySQLError{Number: tmysql.ErrInfoSchemaChanged}), IsTrue)
+}
+
+func (s *tidbSuite) TestRetry(c *C) {
+	conflict := &mysql.MySQLError{Number: tmysql.ErrWriteConflict}
+	failTimes := func(n int, err error) func() error {
+		called := 0
+		return func() error {
+			called++
+			if called <= n {
+				return err
+			}
+			return nil
+		}
+	}
+
+	// the write conflicts are retried sooner in the TiDB mode
+	e := newExecutor(nil).withTiDBMode(true)
+	start := time.Now()
+	err := e.retry(context.Background(), nil, 5, time.Second, failTimes(3, conflict))
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start), Less, time.Second)
+
+	// the other errors wait the backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = e.retry(ctx, nil, 5, time.Second, failTimes(3, errors.New("fake")))
+	c.Assert(err, ErrorMatches, "fake")
+
+	// not in the TiDB mode
+	e = newExecutor(nil)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = e.retry(ctx, nil, 5, time.Second, failTimes(3, conflict))
+	c.Assert(errors.Cause(err), Equals, conflict)
+
+	err = e.retry(context.Background(), nil, 2, time.Millisecond, failTimes(3, conflict))
+	c.Assert(errors.Cause(err), Equals, conflict)
+}
@@ -14,6 +14,8 @@
 package loader
 
 import (
+	"strconv"
+
 	pb "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
 	"github.com/pingcap/tidb/types"
 )
@@ -21,6 +23,7 @@ import (
 // SlaveBinlogToTxn translate the Binlog format into Txn
 func SlaveBinlogToTxn(binlog *pb.Binlog) (*Txn, error) {
 	txn := new(Txn)
+	txn.CommitTS = binlog.CommitTs
 	var err error
 	switch binlog.Type {
 	case pb.BinlogType_DDL:
@@ -84,6 +87,11 @@ func columnToArg(mysqlType string, c *pb.Column) (arg interface{}, err error) {
 	}
 
 	if c.DoubleValue != nil {
+		// the DECIMAL value is passed as the shortest string converted back to the same float64,
+		// instead of the float64 which may be formatted with an exponent or rounded by the driver
+		if mysqlType == "decimal" {
+			return strconv.FormatFloat(c.GetDoubleValue(), 'f', -1, 64), nil
+		}
 		return c.GetDoubleValue(), nil
 	}
 
@@ -27,7 +27,8 @@ func (s *slaveBinlogToTxnSuite) TestTranslateDDL(c *C) {
 	db, table := "test", "hello"
 	sql := "CREATE TABLE hello (id INT AUTO_INCREMENT) PRIMARY KEY(id);"
 	binlog := pb.Binlog{
-		Type: pb.BinlogType_DDL,
+		Type:     pb.BinlogType_DDL,
+		CommitTs: 42,
 		DdlData: &pb.DDLData{
 			SchemaName: &db,
 			TableName:  &table,
@@ -39,6 +40,7 @@ func (s *slaveBinlogToTxnSuite) TestTranslateDDL(c *C) {
 	c.Assert(txn.DDL.Database, Equals, db)
 	c.Assert(txn.DDL.Table, Equals, table)
 	c.Assert(txn.DDL.SQL, Equals, sql)
+	c.Assert(txn.CommitTS, Equals, binlog.CommitTs)
 }
 
 func (s *slaveBinlogToTxnSuite) TestTranslateDML(c *C) {
@@ -122,6 +124,22 @@ func (s *columnToArgSuite) TestHandleMySQLJSON(c *C) {
 	c.Assert(arg, Equals, colVal)
 }
 
+func (s *columnToArgSuite) TestHandleDecimalDouble(c *C) {
+	for _, t := range []struct {
+		v   float64
+		exp string
+	}{
+		{0.1, "0.1"},
+		{1e21, "1000000000000000000000"},
+		{-123.456, "-123.456"},
+	} {
+		v := t.v
+		arg, err := columnToArg("decimal", &pb.Column{DoubleValue: &v})
+		c.Assert(err, IsNil)
+		c.Assert(arg, Equals, t.exp)
+	}
+}
+
 func (s *columnToArgSuite) TestGetCorrectArgs(c *C) {
 	isNull := true
 	col := &pb.Column{IsNull: &isNull}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"hash/crc32"
 	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/pingcap/errors"
@@ -30,7 +31,7 @@ var (
 
 const (
 	colsSQL = `
-SELECT column_name, extra FROM information_schema.columns
+SELECT column_name, extra, is_nullable, column_default FROM information_schema.columns
 WHERE table_schema = ? AND table_name = ?;`
 	uniqKeysSQL = `
 SELECT non_unique, index_name, seq_in_index, column_name 
@@ -40,10 +41,29 @@ ORDER BY seq_in_index ASC;`
 )
 
 type tableInfo struct {
-	columns    []string
-	primaryKey *indexInfo
+	columns []string
+	// the generated columns, which are excluded from columns
+	generatedColumns []string
+	// the not null columns without default value, they must be set when inserting
+	requiredColumns []string
+	primaryKey      *indexInfo
 	// include primary key if have
 	uniqueKeys []indexInfo
+	// the hint added to the DML statements, see StatementHints
+	hint string
+	// the columns written by the expressions, which are excluded from columns, see VirtualColumns
+	virtual []virtualColumn
+	// the apply semantics of the updates and deletes, see ApplySemantics
+	update UpdateSemantics
+	delete DeleteSemantics
+	// the conflict policy of the rows, nil means the rows are overwritten, see ConflictResolution
+	conflict *TableConflict
+	// the deletes are turned into the updates of a tombstone column, so the inserts replace the rows, see SoftDeletes
+	softDelete bool
+	// the SQLs of the bulk statements
+	sqls sqlCache
+	// loaded again for the columns of a DML it doesn't have, so they're not in downstream, see setFreshDMLInfo
+	reloaded bool
 }
 
 type indexInfo struct {
@@ -56,7 +76,7 @@ type indexInfo struct {
 func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, err error) {
 	info = new(tableInfo)
 
-	if info.columns, err = getColsOfTbl(db, schema, table); err != nil {
+	if err = getColsOfTbl(db, schema, table, info); err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table)
 	}
 
@@ -79,11 +99,36 @@ func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, e
 
 // CreateDBWithSQLMode return sql.DB
 func CreateDBWithSQLMode(user string, password string, host string, port int, sqlMode *string) (db *gosql.DB, err error) {
+	return CreateDBWithTimeZone(user, password, host, port, sqlMode, "")
+}
+
+// CreateDBWithTimeZone return sql.DB whose sessions set `time_zone` to timeZone,
+// the TIMESTAMP values are interpreted in the server default time zone if timeZone is empty.
+func CreateDBWithTimeZone(user string, password string, host string, port int, sqlMode *string, timeZone string) (db *gosql.DB, err error) {
+	return CreateDBWithSessionVars(user, password, host, port, sqlMode, timeZone, nil)
+}
+
+// CreateDBWithSessionVars return sql.DB whose sessions set the session variables in vars besides
+// `sql_mode` and `time_zone`, the values are set as is, so the string values must be quoted.
+func CreateDBWithSessionVars(user string, password string, host string, port int, sqlMode *string, timeZone string, vars map[string]string) (db *gosql.DB, err error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4,utf8&interpolateParams=true&readTimeout=1m&multiStatements=true", user, password, host, port)
 	if sqlMode != nil {
 		// same as "set sql_mode = '<sqlMode>'"
 		dsn += "&sql_mode='" + url.QueryEscape(*sqlMode) + "'"
 	}
+	if len(timeZone) > 0 {
+		// same as "set time_zone = '<timeZone>'"
+		dsn += "&time_zone='" + url.QueryEscape(timeZone) + "'"
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// same as "set <name> = <value>"
+		dsn += "&" + name + "=" + url.QueryEscape(vars[name])
+	}
 
 	db, err = gosql.Open("mysql", dsn)
 	if err != nil {
@@ -111,6 +156,7 @@ func escapeName(name string) string {
 
 func holderString(n int) string {
 	builder := new(strings.Builder)
+	builder.Grow(2 * n)
 	for i := 0; i < n; i++ {
 		if i > 0 {
 			builder.WriteString(",")
@@ -138,6 +184,12 @@ func splitDMLs(dmls []*DML, size int) (res [][]*DML) {
 
 func buildColumnList(names []string) string {
 	var b strings.Builder
+	// the names are quoted by backticks
+	size := 0
+	for _, name := range names {
+		size += len(name) + 3
+	}
+	b.Grow(size)
 	for i, name := range names {
 		if i > 0 {
 			b.WriteString(",")
@@ -149,40 +201,49 @@ func buildColumnList(names []string) string {
 	return b.String()
 }
 
-// getColsOfTbl returns a slice of the names of all columns,
-// generated columns are excluded.
+// getColsOfTbl sets the names of all columns to info.columns, generated columns are excluded,
+// and sets info.generatedColumns and info.requiredColumns.
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/columns-table.html
-func getColsOfTbl(db *gosql.DB, schema, table string) ([]string, error) {
+func getColsOfTbl(db *gosql.DB, schema, table string, info *tableInfo) error {
 	rows, err := db.Query(colsSQL, schema, table)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
 	defer rows.Close()
 
 	cols := make([]string, 0, 1)
+	var generated, required []string
 	for rows.Next() {
-		var name, extra string
-		err = rows.Scan(&name, &extra)
+		var name, extra, nullable string
+		var defaultValue gosql.NullString
+		err = rows.Scan(&name, &extra, &nullable, &defaultValue)
 		if err != nil {
-			return nil, errors.Trace(err)
+			return errors.Trace(err)
 		}
 		isGenerated := strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED")
 		if isGenerated {
+			generated = append(generated, name)
 			continue
 		}
 		cols = append(cols, name)
+		if nullable == "NO" && !defaultValue.Valid && !strings.Contains(strings.ToLower(extra), "auto_increment") {
+			required = append(required, name)
+		}
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
 
 	// if no any columns returns, means the table not exist.
 	if len(cols) == 0 {
-		return nil, ErrTableNotExist
+		return ErrTableNotExist
 	}
 
-	return cols, nil
+	info.columns = cols
+	info.generatedColumns = generated
+	info.requiredColumns = required
+	return nil
 }
 
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/statistics-table.html
@@ -38,7 +38,7 @@ func (cs *UtilSuite) TestGetTableInfoTableNotExist(c *check.C) {
 	defer db.Close()
 
 	// return empty rows
-	columnRows := sqlmock.NewRows([]string{"Field", "Extra"})
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Null", "Default"})
 	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
 
 	_, err = getTableInfo(db, "test", "test1")
@@ -55,12 +55,12 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 	// (id, a1, a2, a3, a4)
 	// primary key: id
 	// unique key: (a1) (a2,a3)
-	columnRows := sqlmock.NewRows([]string{"Field", "Extra"}).
-		AddRow("id", "").
-		AddRow("a1", "").
-		AddRow("a2", "").
-		AddRow("a3", "VIRTUAL GENERATED").
-		AddRow("a4", "")
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Null", "Default"}).
+		AddRow("id", "auto_increment", "NO", nil).
+		AddRow("a1", "", "NO", nil).
+		AddRow("a2", "", "NO", "0").
+		AddRow("a3", "VIRTUAL GENERATED", "YES", nil).
+		AddRow("a4", "", "YES", nil)
 	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
 
 	indexRows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}).
@@ -77,8 +77,10 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 	c.Assert(info, check.NotNil)
 
 	c.Assert(info, check.DeepEquals, &tableInfo{
-		columns:    []string{"id", "a1", "a2", "a4"}, // generated column a3 is ignored
-		primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+		columns:          []string{"id", "a1", "a2", "a4"}, // generated column a3 is ignored
+		generatedColumns: []string{"a3"},
+		requiredColumns:  []string{"a1"},
+		primaryKey:       &indexInfo{"PRIMARY", []string{"id"}},
 		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}},
 			{"dex1", []string{"a1"}},
 			{"dex2", []string{"a2", "a3"}},
@@ -0,0 +1,76 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// validateDML checks dml against the table info of downstream, so the DMLs which can't be executed
+// are reported with the reason before executing, instead of failing the batch with a downstream error.
+// NOTE: DML.info is assumed to be already set.
+func validateDML(dml *DML) error {
+	info := dml.info
+
+	known := make(map[string]struct{}, len(info.columns)+len(info.generatedColumns))
+	for _, col := range info.columns {
+		known[col] = struct{}{}
+	}
+	for _, col := range info.generatedColumns {
+		known[col] = struct{}{}
+	}
+	for _, values := range []map[string]interface{}{dml.Values, dml.OldValues} {
+		for col := range values {
+			if _, ok := known[col]; !ok {
+				return errors.NotFoundf("column %s in downstream", col)
+			}
+		}
+	}
+
+	switch dml.Tp {
+	case InsertDMLType:
+		if col, ok := missingValue(dml.Values, info.requiredColumns); !ok {
+			return errors.Errorf("value of not null column %s without default value is missing for insert", col)
+		}
+	case UpdateDMLType:
+		if info.primaryKey == nil {
+			break
+		}
+		if col, ok := missingValue(dml.OldValues, info.primaryKey.columns); !ok {
+			return errors.Errorf("old value of primary key column %s is missing for update", col)
+		}
+		if col, ok := missingValue(dml.Values, info.primaryKey.columns); !ok {
+			return errors.Errorf("value of primary key column %s is missing for update", col)
+		}
+	case DeleteDMLType:
+		if info.primaryKey == nil {
+			break
+		}
+		if col, ok := missingValue(dml.Values, info.primaryKey.columns); !ok {
+			return errors.Errorf("value of primary key column %s is missing for delete", col)
+		}
+	}
+
+	return nil
+}
+
+// missingValue returns the first column of cols whose value is absent or NULL in values
+func missingValue(values map[string]interface{}, cols []string) (col string, ok bool) {
+	for _, col := range cols {
+		if v, found := values[col]; !found || v == nil {
+			return col, false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type validateSuite struct{}
+
+var _ = check.Suite(&validateSuite{})
+
+func (s *validateSuite) TestValidateDML(c *check.C) {
+	info := &tableInfo{
+		columns:          []string{"id", "name", "note"},
+		generatedColumns: []string{"upper_name"},
+		requiredColumns:  []string{"name"},
+		uniqueKeys:       []indexInfo{{"PRIMARY", []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+
+	tests := []struct {
+		dml *DML
+		err string
+	}{
+		{
+			dml: &DML{Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a", "upper_name": "A"}},
+		},
+		{
+			dml: &DML{Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a", "age": 10}},
+			err: "column age in downstream not found",
+		},
+		{
+			dml: &DML{Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": nil}},
+			err: "value of not null column name without default value is missing for insert",
+		},
+		{
+			dml: &DML{Tp: UpdateDMLType, Values: map[string]interface{}{"id": 1, "name": "b"}, OldValues: map[string]interface{}{"id": 1, "name": "a"}},
+		},
+		{
+			dml: &DML{Tp: UpdateDMLType, Values: map[string]interface{}{"id": 1, "name": "b"}, OldValues: map[string]interface{}{"name": "a"}},
+			err: "old value of primary key column id is missing for update",
+		},
+		{
+			dml: &DML{Tp: UpdateDMLType, Values: map[string]interface{}{"id": 1}, OldValues: map[string]interface{}{"id": 1, "nick": "a"}},
+			err: "column nick in downstream not found",
+		},
+		{
+			dml: &DML{Tp: DeleteDMLType, Values: map[string]interface{}{"name": "a"}},
+			err: "value of primary key column id is missing for delete",
+		},
+	}
+
+	for i, t := range tests {
+		t.dml.info = info
+		err := validateDML(t.dml)
+		if len(t.err) == 0 {
+			c.Assert(err, check.IsNil, check.Commentf("case %d", i))
+		} else {
+			c.Assert(err, check.ErrorMatches, t.err, check.Commentf("case %d", i))
+		}
+	}
+
+	// no primary key, the row is identified by all the columns
+	info.primaryKey = nil
+	err := validateDML(&DML{Tp: DeleteDMLType, Values: map[string]interface{}{"name": "a"}, info: info})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *validateSuite) TestShouldStopRunOnInvalidDML(c *check.C) {
+	var executed []*DML
+	origF := fNewBatchManager
+	fNewBatchManager = func(s *loaderImpl) *batchManager {
+		return &batchManager{
+			limit: 1024,
+			fExecDMLs: func(dmls []*DML) error {
+				executed = append(executed, dmls...)
+				return nil
+			},
+			fDMLsSuccessCallback: func(txns ...*Txn) {},
+		}
+	}
+	defer func() { fNewBatchManager = origF }()
+
+	loader := &loaderImpl{
+		input:        make(chan *Txn, 10),
+		successTxn:   make(chan *Txn, 10),
+		validateDMLs: true,
+	}
+	info := &tableInfo{columns: []string{"id"}}
+	loader.tableInfos.Store(quoteSchema("test", "t"), info)
+
+	loader.input <- &Txn{CommitTS: 1, DMLs: []*DML{{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1}}}}
+	loader.input <- &Txn{CommitTS: 2, DMLs: []*DML{{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2, "v": 1}}}}
+	close(loader.input)
+
+	err := loader.Run()
+	c.Assert(err, check.ErrorMatches, "invalid dml of `test`.`t` at commit ts 2: column v in downstream not found")
+	for _, dml := range executed {
+		c.Assert(dml.Values["id"], check.Equals, 1)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// VirtualColumn is a column of the downstream tables matched which isn't in upstream, it's set to the SQL
+// expression Expr by the inserts and updates, e.g., "NOW(6)" for the time synced, "'cluster-a'" for the source,
+// or "?" for the commit ts of the txn, each ? in Expr is bound to the commit ts. The empty Schema or Table matches any.
+type VirtualColumn struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Column string `toml:"column" json:"column"`
+	Expr   string `toml:"expr" json:"expr"`
+}
+
+func (c *VirtualColumn) validate() error {
+	if len(c.Column) == 0 || len(strings.TrimSpace(c.Expr)) == 0 {
+		return errors.Errorf("invalid virtual column of %s, column and expr must be set", quoteSchema(c.Schema, c.Table))
+	}
+	if strings.Contains(c.Expr, ";") {
+		return errors.Errorf("invalid expr %q of the virtual column %s, it must be a single expression", c.Expr, c.Column)
+	}
+	return nil
+}
+
+// virtualColumn is a VirtualColumn of a table, with the count of the commit ts bound to its expression
+type virtualColumn struct {
+	name   string
+	expr   string
+	params int
+}
+
+// VirtualColumns makes loader write the virtual columns to the tables matched, they're appended to the columns of
+// the INSERT/REPLACE statements and assigned by the UPDATE statements, e.g., for auditing when the rows are synced,
+// or telling the sources of the rows merged into one downstream. The columns must be in the downstream tables but
+// not in their keys or the upstream tables. If a column is matched by more than one, the most specific one is used.
+// The commit ts of the rows copied by CopySnapshot is 0.
+func VirtualColumns(columns ...VirtualColumn) Option {
+	return func(o *options) {
+		o.virtualColumns = append(o.virtualColumns, columns...)
+	}
+}
+
+// virtualColumnsOf returns the virtual columns of the table, the most specific one is used for each column
+func virtualColumnsOf(columns []VirtualColumn, schema string, table string) []virtualColumn {
+	var found []virtualColumn
+	var specificities []int
+	indexes := make(map[string]int)
+	for i := range columns {
+		specificity, ok := matchTable(columns[i].Schema, columns[i].Table, schema, table)
+		if !ok {
+			continue
+		}
+		col := virtualColumn{name: columns[i].Column, expr: strings.TrimSpace(columns[i].Expr), params: countParams(columns[i].Expr)}
+		j, ok := indexes[strings.ToLower(col.name)]
+		if !ok {
+			indexes[strings.ToLower(col.name)] = len(found)
+			found = append(found, col)
+			specificities = append(specificities, specificity)
+		} else if specificity > specificities[j] {
+			found[j], specificities[j] = col, specificity
+		}
+	}
+	return found
+}
+
+// countParams returns the count of the ? in expr out of the quoted strings and names
+func countParams(expr string) int {
+	var count int
+	var quote rune
+	for _, r := range expr {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			count++
+		}
+	}
+	return count
+}
+
+// setVirtualColumns sets the virtual columns of info, they're removed from the columns of upstream
+func setVirtualColumns(info *tableInfo, columns []virtualColumn, schema string, table string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	for _, col := range columns {
+		if !containsFold(info.columns, col.name) {
+			return errors.Errorf("the virtual column %s isn't in table %s", col.name, quoteSchema(schema, table))
+		}
+		for _, index := range info.uniqueKeys {
+			if containsFold(index.columns, col.name) {
+				return errors.Errorf("the virtual column %s of table %s can't be in the key %s", col.name, quoteSchema(schema, table), index.name)
+			}
+		}
+	}
+	isVirtual := func(name string) bool {
+		for _, col := range columns {
+			if strings.EqualFold(col.name, name) {
+				return true
+			}
+		}
+		return false
+	}
+	info.columns = removeStrings(info.columns, isVirtual)
+	info.requiredColumns = removeStrings(info.requiredColumns, isVirtual)
+	info.virtual = columns
+	return nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeStrings returns a copy of names without the ones removed
+func removeStrings(names []string, removed func(string) bool) []string {
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		if !removed(name) {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// commitTS returns the commit ts of the txn of dml, 0 if it's unknown
+func (dml *DML) commitTS() int64 {
+	if dml.txn == nil {
+		return 0
+	}
+	return dml.txn.CommitTS
+}
+
+// virtualColumnList returns the names of the virtual columns of dml appended to the column list of the inserts,
+// starting with a comma, it's empty if there's none
+func (dml *DML) virtualColumnList() string {
+	if dml.info == nil || len(dml.info.virtual) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(dml.info.virtual))
+	for _, col := range dml.info.virtual {
+		names = append(names, col.name)
+	}
+	return "," + buildColumnList(names)
+}
+
+// virtualValues returns the expressions of the virtual columns of dml appended to the values of the inserts,
+// starting with a comma, it's empty if there's none
+func (dml *DML) virtualValues() string {
+	if dml.info == nil || len(dml.info.virtual) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, col := range dml.info.virtual {
+		b.WriteByte(',')
+		b.WriteString(col.expr)
+	}
+	return b.String()
+}
+
+// hasVirtualArgs returns true if the commit ts is bound to any virtual column of dml
+func (dml *DML) hasVirtualArgs() bool {
+	if dml.info == nil {
+		return false
+	}
+	for _, col := range dml.info.virtual {
+		if col.params > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// appendVirtualArgs appends the commit ts of dml bound to the expressions of the virtual columns to args
+func (dml *DML) appendVirtualArgs(args []interface{}) []interface{} {
+	if dml.info == nil {
+		return args
+	}
+	for _, col := range dml.info.virtual {
+		for i := 0; i < col.params; i++ {
+			args = append(args, dml.commitTS())
+		}
+	}
+	return args
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type virtualSuite struct{}
+
+var _ = Suite(&virtualSuite{})
+
+func newVirtualInfo(c *C) *tableInfo {
+	info := &tableInfo{
+		columns:    []string{"id", "name", "_synced_at", "_commit_ts"},
+		primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	columns := virtualColumnsOf([]VirtualColumn{
+		{Column: "_synced_at", Expr: "NOW()"},
+		{Schema: "test", Column: "_synced_at", Expr: "NOW(6)"},
+		{Schema: "test", Table: "t", Column: "_commit_ts", Expr: "?"},
+		{Schema: "other", Column: "_commit_ts", Expr: "0"},
+	}, "test", "t")
+	c.Assert(setVirtualColumns(info, columns, "test", "t"), IsNil)
+	return info
+}
+
+func (s *virtualSuite) TestVirtualColumnsOf(c *C) {
+	info := newVirtualInfo(c)
+	c.Assert(info.columns, DeepEquals, []string{"id", "name"})
+	c.Assert(info.virtual, DeepEquals, []virtualColumn{
+		{name: "_synced_at", expr: "NOW(6)"},
+		{name: "_commit_ts", expr: "?", params: 1},
+	})
+
+	c.Assert(countParams("CONCAT('?', ?, `a?`)"), Equals, 1)
+	c.Assert((&VirtualColumn{Column: "a", Expr: "1; DROP TABLE t"}).validate(), NotNil)
+	c.Assert((&VirtualColumn{Column: "a"}).validate(), NotNil)
+}
+
+func (s *virtualSuite) TestSetVirtualColumns(c *C) {
+	info := &tableInfo{columns: []string{"id"}, uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}}}
+	err := setVirtualColumns(info, []virtualColumn{{name: "_source", expr: "'a'"}}, "test", "t")
+	c.Assert(err, ErrorMatches, ".*isn't in table.*")
+	err = setVirtualColumns(info, []virtualColumn{{name: "ID", expr: "1"}}, "test", "t")
+	c.Assert(err, ErrorMatches, ".*can't be in the key PRIMARY.*")
+}
+
+func (s *virtualSuite) TestSQL(c *C) {
+	info := newVirtualInfo(c)
+	txn := &Txn{CommitTS: 42}
+	insert := &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 1, "name": "a"}, info: info, txn: txn}
+
+	sql, args := insert.sql()
+	c.Assert(sql, Equals, "INSERT INTO `test`.`t`(`id`,`name`,`_synced_at`,`_commit_ts`) VALUES(?,?,NOW(6),?)")
+	c.Assert(args, DeepEquals, []interface{}{1, "a", int64(42)})
+
+	update := &DML{Database: "test", Table: "t", Tp: UpdateDMLType, Values: map[string]interface{}{"id": 1, "name": "b"},
+		OldValues: map[string]interface{}{"id": 1, "name": "a"}, info: info, txn: txn}
+	sql, args = update.sql()
+	c.Assert(sql, Equals, "UPDATE `test`.`t` SET `id` = ?,`name` = ?,`_synced_at` = NOW(6),`_commit_ts` = ? WHERE `id` = ? LIMIT 1")
+	c.Assert(args, DeepEquals, []interface{}{1, "b", int64(42), 1})
+
+	insert2 := &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": 2, "name": "b"}, info: info}
+	stmt := bulkReplaceStatement([]*DML{insert, insert2})
+	c.Assert(stmt.SQL, Equals, "REPLACE INTO `test`.`t`(`id`,`name`,`_synced_at`,`_commit_ts`) VALUES (?,?,NOW(6),?),(?,?,NOW(6),?)")
+	c.Assert(stmt.Args, DeepEquals, []interface{}{1, "a", int64(42), 2, "b", int64(0)})
+}
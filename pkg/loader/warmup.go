@@ -0,0 +1,277 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"go.uber.org/zap"
+)
+
+// the privileges required to apply the txns, CREATE is for the DDLs and the tables created by loader
+var warmupPrivileges = []string{"INSERT", "UPDATE", "DELETE", "CREATE"}
+
+var grantRegexp = regexp.MustCompile(`(?i)^GRANT (.+?) ON (.+?) TO (\S+)`)
+
+// Warmup makes Run warm up the downstream before applying any txn, so it fails fast by what's wrong instead of
+// at the first txn touching it:
+//   - all the connections of the pool are opened and pinged, so the first batches don't wait for connecting
+//   - the privileges INSERT, UPDATE, DELETE and CREATE are verified by SHOW GRANTS on each of the tables,
+//     or on any scope if there's no table, they're only warned if there's a role granted
+//   - the table infos of the tables are loaded, and their statements are built and prepared in downstream
+func Warmup(tables ...filter.TableName) Option {
+	return func(o *options) {
+		o.warmup = true
+		o.warmupTables = tables
+	}
+}
+
+// warmup warms up the downstream, see Warmup
+func (s *loaderImpl) warmup(ctx context.Context) error {
+	conns, err := s.openConns(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := s.checkPrivileges(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	for _, t := range s.warmupTables {
+		if err := s.prepareTable(ctx, t.Schema, t.Table); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	s.getLogger().Info("downstream warmed up", zap.Int("connections", conns), zap.Int("tables", len(s.warmupTables)))
+	return nil
+}
+
+// openConns opens and pings all the connections of the pool, they're kept idle in the pool after returned
+func (s *loaderImpl) openConns(ctx context.Context) (int, error) {
+	size := s.workerCount + s.connHeadroom
+	conns := make([]*gosql.Conn, 0, size)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < size; i++ {
+		conn, err := s.getDB().Conn(ctx)
+		if err != nil {
+			return 0, errors.Annotatef(err, "open connection %d of %d to downstream failed, check the address, "+
+				"the user and password of downstream, and that its max_connections allows %d more", i+1, size, size)
+		}
+		conns = append(conns, conn)
+		if err = conn.PingContext(ctx); err != nil {
+			return 0, errors.Annotatef(err, "ping connection %d of %d to downstream failed", i+1, size)
+		}
+	}
+	return size, nil
+}
+
+// grant is a line of SHOW GRANTS on a scope
+type grant struct {
+	privileges map[string]struct{}
+	// * means any, the schema may have the wildcards % and _
+	schema string
+	table  string
+}
+
+// parseGrant parses a line of SHOW GRANTS, false if it's not a grant of privileges, e.g., the grant of a role
+func parseGrant(line string) (g grant, user string, ok bool) {
+	m := grantRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return grant{}, "", false
+	}
+	g.privileges = make(map[string]struct{})
+	for _, p := range strings.Split(m[1], ",") {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		// the privileges on some columns don't cover the DMLs of the table
+		if strings.Contains(p, "(") {
+			continue
+		}
+		if p == "ALL PRIVILEGES" {
+			p = "ALL"
+		}
+		g.privileges[p] = struct{}{}
+	}
+	g.schema, g.table = splitScope(m[2])
+	return g, m[3], true
+}
+
+// splitScope splits the scope of a grant, e.g., *.*, `db`.* or `db`.`table`, into the unquoted names
+func splitScope(scope string) (schema string, table string) {
+	sep := strings.Index(scope, ".")
+	if strings.HasPrefix(scope, "`") {
+		if end := strings.Index(scope[1:], "`"); end >= 0 {
+			sep = end + 2
+		}
+	}
+	if sep < 0 || sep >= len(scope) {
+		return unquoteName(scope), "*"
+	}
+	return unquoteName(scope[:sep]), unquoteName(scope[sep+1:])
+}
+
+func unquoteName(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, "`") && strings.HasSuffix(name, "`") {
+		return strings.Replace(name[1:len(name)-1], "``", "`", -1)
+	}
+	return name
+}
+
+// has returns whether the privilege is granted on the table, an empty schema means any table
+func (g grant) has(privilege string, schema string, table string) bool {
+	_, all := g.privileges["ALL"]
+	if _, ok := g.privileges[privilege]; !ok && !all {
+		return false
+	}
+	if len(schema) == 0 || g.schema == "*" {
+		return true
+	}
+	return matchSchemaPattern(g.schema, schema) && (g.table == "*" || strings.EqualFold(g.table, table))
+}
+
+// matchSchemaPattern matches the schema by the name of a grant, which may have the wildcards % and _
+func matchSchemaPattern(pattern string, schema string) bool {
+	var expr strings.Builder
+	expr.WriteString("(?i)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '%':
+			expr.WriteString(".*")
+		case c == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	matched, err := regexp.MatchString(expr.String(), schema)
+	return err == nil && matched
+}
+
+// checkPrivileges verifies the privileges of applying the txns are granted on the tables of warmup
+func (s *loaderImpl) checkPrivileges(ctx context.Context) error {
+	rows, err := s.getDB().QueryContext(ctx, "SHOW GRANTS")
+	if err != nil {
+		return errors.Annotate(err, "show grants of the user of downstream failed")
+	}
+	defer rows.Close()
+
+	var grants []grant
+	var user string
+	roles := false
+	for rows.Next() {
+		var line string
+		if err = rows.Scan(&line); err != nil {
+			return errors.Trace(err)
+		}
+		g, to, ok := parseGrant(line)
+		if !ok {
+			roles = true
+			continue
+		}
+		grants = append(grants, g)
+		user = to
+	}
+	if err = rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	tables := s.warmupTables
+	if len(tables) == 0 {
+		tables = []filter.TableName{{}}
+	}
+	for _, t := range tables {
+		missing := missingPrivileges(grants, t.Schema, t.Table)
+		if len(missing) == 0 {
+			continue
+		}
+		scope := "*.*"
+		if len(t.Schema) > 0 {
+			scope = quoteSchema(t.Schema, t.Table)
+		}
+		if roles {
+			s.getLogger().Warn("privileges may be missing in downstream, they aren't verified since roles are granted",
+				zap.Strings("privileges", missing), zap.String("scope", scope))
+			continue
+		}
+		return errors.Errorf("privileges %s are missing in downstream, grant them by `GRANT %s ON %s TO %s`",
+			strings.Join(missing, ", "), strings.Join(missing, ", "), scope, user)
+	}
+	return nil
+}
+
+func missingPrivileges(grants []grant, schema string, table string) []string {
+	var missing []string
+	for _, privilege := range warmupPrivileges {
+		granted := false
+		for _, g := range grants {
+			if g.has(privilege, schema, table) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			missing = append(missing, privilege)
+		}
+	}
+	return missing
+}
+
+// prepareTable loads the table info, builds the statements of the table and prepares them in downstream to
+// check they're valid, the SQLs of the bulk statements are cached by the table info
+func (s *loaderImpl) prepareTable(ctx context.Context, schema string, table string) error {
+	info, err := s.getTableInfo(schema, table)
+	if err != nil {
+		return errors.Annotatef(err, "load table info of %s failed, check the table exists in downstream", quoteSchema(schema, table))
+	}
+
+	values := make(map[string]interface{}, len(info.columns))
+	for _, col := range info.columns {
+		values[col] = 0
+	}
+	newDML := func(tp DMLType) *DML {
+		return &DML{Database: schema, Table: table, Tp: tp, Values: values, OldValues: values, info: info}
+	}
+	var sqls []string
+	for _, tp := range []DMLType{InsertDMLType, UpdateDMLType, DeleteDMLType} {
+		sql, args := newDML(tp).sql()
+		putArgs(args)
+		sqls = append(sqls, sql)
+	}
+	inserts := make([]*DML, s.batchSize)
+	for i := range inserts {
+		inserts[i] = newDML(InsertDMLType)
+	}
+	if len(inserts) > 0 {
+		sqls = append(sqls, bulkReplaceStatement(inserts).SQL)
+	}
+
+	for _, sql := range sqls {
+		stmt, err := s.getDB().PrepareContext(ctx, sql)
+		if err != nil {
+			return errors.Annotatef(err, "prepare the statement of %s in downstream failed, sql: %s", quoteSchema(schema, table), sql)
+		}
+		stmt.Close()
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type warmupSuite struct{}
+
+var _ = Suite(&warmupSuite{})
+
+func (s *warmupSuite) TestParseGrant(c *C) {
+	g, user, ok := parseGrant("GRANT ALL PRIVILEGES ON *.* TO 'root'@'%' WITH GRANT OPTION")
+	c.Assert(ok, IsTrue)
+	c.Assert(user, Equals, "'root'@'%'")
+	c.Assert(g.has("CREATE", "test", "t"), IsTrue)
+
+	g, _, ok = parseGrant("GRANT SELECT, INSERT, UPDATE (`name`) ON `test`.`t` TO 'binlog'@'%'")
+	c.Assert(ok, IsTrue)
+	c.Assert(g.schema, Equals, "test")
+	c.Assert(g.table, Equals, "t")
+	c.Assert(g.has("INSERT", "test", "t"), IsTrue)
+	c.Assert(g.has("INSERT", "test", "t2"), IsFalse)
+	// the privilege on a column doesn't cover the table
+	c.Assert(g.has("UPDATE", "test", "t"), IsFalse)
+
+	g, _, ok = parseGrant("GRANT INSERT ON `test\\_%`.* TO 'binlog'@'%'")
+	c.Assert(ok, IsTrue)
+	c.Assert(g.has("INSERT", "test_1", "t"), IsTrue)
+	c.Assert(g.has("INSERT", "testa1", "t"), IsFalse)
+
+	_, _, ok = parseGrant("GRANT `r1`@`%` TO `binlog`@`%`")
+	c.Assert(ok, IsFalse)
+}
+
+func (s *warmupSuite) TestCheckPrivileges(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld := &loaderImpl{db: db, warmupTables: []filter.TableName{{Schema: "test", Table: "t"}}}
+	mock.ExpectQuery("SHOW GRANTS").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT USAGE ON *.* TO 'binlog'@'%'").
+		AddRow("GRANT INSERT, UPDATE ON `test`.* TO 'binlog'@'%'"))
+	err = ld.checkPrivileges(context.Background())
+	c.Assert(err, ErrorMatches, "privileges DELETE, CREATE are missing in downstream, grant them by `GRANT DELETE, CREATE ON `test`.`t` TO 'binlog'@'%'`")
+
+	// only warned if a role is granted
+	mock.ExpectQuery("SHOW GRANTS").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT INSERT, UPDATE ON `test`.* TO 'binlog'@'%'").
+		AddRow("GRANT `writer`@`%` TO `binlog`@`%`"))
+	c.Assert(ld.checkPrivileges(context.Background()), IsNil)
+
+	// any scope if there's no table
+	ld.warmupTables = nil
+	mock.ExpectQuery("SHOW GRANTS").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT INSERT, UPDATE, DELETE, CREATE ON `test`.* TO 'binlog'@'%'"))
+	c.Assert(ld.checkPrivileges(context.Background()), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *warmupSuite) TestWarmup(c *C) {
+	origGet := utilGetTableInfo
+	defer func() { utilGetTableInfo = origGet }()
+	utilGetTableInfo = func(db *sql.DB, schema string, table string) (*tableInfo, error) {
+		return &tableInfo{
+			columns:    []string{"id", "name"},
+			primaryKey: &indexInfo{name: "PRIMARY", columns: []string{"id"}},
+			uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+		}, nil
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld := &loaderImpl{db: db, workerCount: 2, connHeadroom: 1, batchSize: 2, warmupTables: []filter.TableName{{Schema: "test", Table: "t"}}}
+	mock.ExpectQuery("SHOW GRANTS").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT ALL PRIVILEGES ON *.* TO 'root'@'%'"))
+	for _, sql := range []string{
+		"INSERT INTO `test`.`t`(`id`,`name`) VALUES(?,?)",
+		"UPDATE `test`.`t` SET `id` = ?,`name` = ? WHERE `id` = ? LIMIT 1",
+		"DELETE FROM `test`.`t` WHERE `id` = ? LIMIT 1",
+		"REPLACE INTO `test`.`t`(`id`,`name`) VALUES (?,?),(?,?)",
+	} {
+		mock.ExpectPrepare(regexp.QuoteMeta(sql)).WillBeClosed()
+	}
+	c.Assert(ld.warmup(context.Background()), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the SQL of the bulk statement is cached
+	info, err := ld.getTableInfo("test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(info.sqls.sqls, HasLen, 1)
+}
+
+func (s *warmupSuite) TestWarmupFailed(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ld := &loaderImpl{db: db, workerCount: 1, warmupTables: []filter.TableName{{Schema: "test", Table: "t"}}}
+	mock.ExpectQuery("SHOW GRANTS").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT ALL PRIVILEGES ON *.* TO 'root'@'%'"))
+	mock.ExpectQuery(".*").WillReturnError(ErrTableNotExist)
+	err = ld.warmup(context.Background())
+	c.Assert(err, ErrorMatches, "load table info of `test`.`t` failed, check the table exists in downstream.*")
+}
+
+func (s *warmupSuite) TestApplyConfig(c *C) {
+	cfg := ApplyConfig{WarmupTables: []filter.TableName{{Schema: "test", Table: "t"}}}
+	c.Assert(cfg.Validate(), ErrorMatches, "warmup-table is set but warmup is disabled")
+	cfg.Warmup = true
+	c.Assert(cfg.Validate(), IsNil)
+	cfg.WarmupTables = append(cfg.WarmupTables, filter.TableName{Schema: "test"})
+	c.Assert(cfg.Validate(), ErrorMatches, "invalid warmup-table .*")
+}
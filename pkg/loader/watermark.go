@@ -0,0 +1,146 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+)
+
+// Watermark is the progress of the txns applied in downstream by their commit ts, e.g., for the caller to decide
+// how far the upstream GC safepoint or the purge of pump can advance without losing the txns not applied yet.
+type Watermark struct {
+	// all the txns with commit ts <= AppliedTS are applied in downstream
+	AppliedTS int64 `json:"applied-ts"`
+	// the min commit ts of the txns taken from Input but not applied yet, 0 if there's none, so the ones with
+	// commit ts < it are all applied. The txns still in Input aren't counted.
+	MinUnappliedTS int64 `json:"min-unapplied-ts"`
+}
+
+// OnWatermark sets the callback called with the new watermark each time it advances, it's called by the goroutine
+// of Run, so it must not block.
+func OnWatermark(fn func(Watermark)) Option {
+	return func(o *options) {
+		o.onWatermark = fn
+	}
+}
+
+// watermarkTracker tracks the commit ts of the txns taken from Input until they're reported by Successes,
+// which are both in commit ts order
+type watermarkTracker struct {
+	sync.Mutex
+	// the commit ts of the txns not applied in order
+	unapplied []int64
+	current   Watermark
+	callback  func(Watermark)
+	subs      map[chan Watermark]struct{}
+}
+
+func newWatermarkTracker(callback func(Watermark)) *watermarkTracker {
+	return &watermarkTracker{callback: callback, subs: make(map[chan Watermark]struct{})}
+}
+
+// input records the txn taken from Input, nil tracker is a no-op
+func (t *watermarkTracker) input(txn *Txn) {
+	if t == nil || txn.CommitTS <= 0 || txn.flush != nil {
+		return
+	}
+	t.Lock()
+	t.unapplied = append(t.unapplied, txn.CommitTS)
+	if t.current.MinUnappliedTS == 0 {
+		t.advance(t.current.AppliedTS)
+	}
+	t.Unlock()
+}
+
+// applied advances the watermark by the txns reported by Successes
+func (t *watermarkTracker) applied(txns []*Txn) {
+	if t == nil {
+		return
+	}
+	var ts int64
+	for _, txn := range txns {
+		if txn.CommitTS > ts {
+			ts = txn.CommitTS
+		}
+	}
+	if ts == 0 {
+		return
+	}
+	t.Lock()
+	t.advance(ts)
+	t.Unlock()
+}
+
+// advance sets the applied ts, and notifies the new watermark if it changes, the lock must be held
+func (t *watermarkTracker) advance(appliedTS int64) {
+	if appliedTS < t.current.AppliedTS {
+		appliedTS = t.current.AppliedTS
+	}
+	n := 0
+	for n < len(t.unapplied) && t.unapplied[n] <= appliedTS {
+		n++
+	}
+	t.unapplied = t.unapplied[n:]
+
+	next := Watermark{AppliedTS: appliedTS}
+	if len(t.unapplied) > 0 {
+		next.MinUnappliedTS = t.unapplied[0]
+	}
+	if next == t.current {
+		return
+	}
+	t.current = next
+
+	if t.callback != nil {
+		t.callback(next)
+	}
+	for ch := range t.subs {
+		// only the latest one is kept for the subscribers not catching up
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- next
+	}
+}
+
+// watermark returns the current watermark
+func (t *watermarkTracker) watermark() Watermark {
+	if t == nil {
+		return Watermark{}
+	}
+	t.Lock()
+	defer t.Unlock()
+	return t.current
+}
+
+// subscribe returns a channel receiving the latest watermark each time it changes, starting with the current one,
+// the ones not received before the next change are dropped. The channel is closed by the cancel func returned.
+func (t *watermarkTracker) subscribe() (<-chan Watermark, func()) {
+	ch := make(chan Watermark, 1)
+	t.Lock()
+	t.subs[ch] = struct{}{}
+	ch <- t.current
+	t.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			t.Lock()
+			delete(t.subs, ch)
+			close(ch)
+			t.Unlock()
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type watermarkSuite struct{}
+
+var _ = Suite(&watermarkSuite{})
+
+func (s *watermarkSuite) TestTrack(c *C) {
+	var called []Watermark
+	t := newWatermarkTracker(func(w Watermark) { called = append(called, w) })
+	ch, cancel := t.subscribe()
+	c.Assert(<-ch, Equals, Watermark{})
+
+	t.input(&Txn{CommitTS: 10})
+	t.input(&Txn{CommitTS: 20})
+	// the flush requests are not tracked
+	t.input(&Txn{flush: make(chan int64)})
+	c.Assert(t.watermark(), Equals, Watermark{MinUnappliedTS: 10})
+
+	t.applied([]*Txn{{CommitTS: 10}})
+	c.Assert(t.watermark(), Equals, Watermark{AppliedTS: 10, MinUnappliedTS: 20})
+	t.applied([]*Txn{{CommitTS: 20}})
+	c.Assert(t.watermark(), Equals, Watermark{AppliedTS: 20})
+	c.Assert(called, DeepEquals, []Watermark{{MinUnappliedTS: 10}, {AppliedTS: 10, MinUnappliedTS: 20}, {AppliedTS: 20}})
+
+	// the subscriber not catching up only gets the latest one
+	c.Assert(<-ch, Equals, Watermark{AppliedTS: 20})
+	select {
+	case w := <-ch:
+		c.Fatalf("unexpected watermark %v", w)
+	default:
+	}
+
+	cancel()
+	cancel()
+	_, ok := <-ch
+	c.Assert(ok, IsFalse)
+	t.applied([]*Txn{{CommitTS: 30}})
+	c.Assert(t.watermark().AppliedTS, Equals, int64(30))
+}
+
+func (s *watermarkSuite) TestNilTracker(c *C) {
+	var t *watermarkTracker
+	t.input(&Txn{CommitTS: 10})
+	t.applied([]*Txn{{CommitTS: 10}})
+	c.Assert(t.watermark(), Equals, Watermark{})
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loopbacksync prevents the txns replicated between two clusters syncing to each other from
+// being echoed back. The loader marks each txn it applies by writing the mark table in the txn, and
+// the drainer capturing the changes of the cluster skips the txns writing the mark table.
+package loopbacksync
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MarkDB is the database of the mark table
+	MarkDB = "retl"
+	// MarkTable is the table written in each txn applied by the loader
+	MarkTable = "_drainer_repl_mark"
+)
+
+// LoopBackSync is the loopback control of a replication channel
+type LoopBackSync struct {
+	// identifies the channel writing the mark rows, the channels syncing into the same cluster
+	// must use different ids so they don't contend on the rows
+	ChannelID int64
+	// write the mark table in the txns applied, and skip the txns writing it when capturing
+	LoopbackControl bool
+	// sync the DDLs, which can't be marked, so only one direction of the bidirectional sync should sync them
+	SyncDDL bool
+}
+
+// NewLoopBackSyncInfo returns a LoopBackSync
+func NewLoopBackSyncInfo(channelID int64, loopbackControl, syncDDL bool) *LoopBackSync {
+	return &LoopBackSync{
+		ChannelID:       channelID,
+		LoopbackControl: loopbackControl,
+		SyncDDL:         syncDDL,
+	}
+}
+
+// IsMarkTable returns true if the table is the mark table
+func IsMarkTable(schema, table string) bool {
+	return strings.EqualFold(schema, MarkDB) && strings.EqualFold(table, MarkTable)
+}
+
+// CreateMarkTableSQLs returns the statements creating the mark table if it doesn't exist
+func CreateMarkTableSQLs() []string {
+	return []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", MarkDB),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` ("+
+			"`id` BIGINT NOT NULL, `channel_id` BIGINT NOT NULL, `val` BIGINT NOT NULL DEFAULT 0, "+
+			"PRIMARY KEY (`id`, `channel_id`))", MarkDB, MarkTable),
+	}
+}
+
+// MarkSQL is the statement marking a txn by the row of id and the channel id,
+// which is inserted the first time and updated afterwards
+var MarkSQL = fmt.Sprintf("INSERT INTO `%s`.`%s`(`id`,`channel_id`,`val`) VALUES(?,?,1) "+
+	"ON DUPLICATE KEY UPDATE `val` = `val` + 1", MarkDB, MarkTable)
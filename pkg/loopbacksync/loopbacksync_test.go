@@ -0,0 +1,41 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopbacksync
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type loopbackSuite struct{}
+
+var _ = Suite(&loopbackSuite{})
+
+func (s *loopbackSuite) TestIsMarkTable(c *C) {
+	c.Assert(IsMarkTable("retl", "_drainer_repl_mark"), IsTrue)
+	c.Assert(IsMarkTable("RETL", "_DRAINER_REPL_MARK"), IsTrue)
+	c.Assert(IsMarkTable("test", "_drainer_repl_mark"), IsFalse)
+	c.Assert(IsMarkTable("retl", "t"), IsFalse)
+}
+
+func (s *loopbackSuite) TestCreateMarkTableSQLs(c *C) {
+	sqls := CreateMarkTableSQLs()
+	c.Assert(sqls, HasLen, 2)
+	c.Assert(sqls[0], Equals, "CREATE DATABASE IF NOT EXISTS `retl`")
+	c.Assert(strings.HasPrefix(sqls[1], "CREATE TABLE IF NOT EXISTS `retl`.`_drainer_repl_mark`"), IsTrue)
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mask masks the sensitive values of rows before they are written to the logs
+// or the other outputs for auditing, e.g., the args of the SQL failed to execute.
+package mask
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+)
+
+// Masked replaces the values of the columns configured to be masked
+const Masked = "******"
+
+// Rule selects the columns to mask, an empty Column means all the columns of the table,
+// an empty Table means all the tables of the schema and an empty Schema means all the schemas.
+type Rule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Column string `toml:"column" json:"column"`
+}
+
+func (r *Rule) matchTable(schema, table string) bool {
+	return (len(r.Schema) == 0 || strings.EqualFold(r.Schema, schema)) &&
+		(len(r.Table) == 0 || strings.EqualFold(r.Table, table))
+}
+
+func (r *Rule) match(schema, table, column string) bool {
+	return r.matchTable(schema, table) && (len(r.Column) == 0 || strings.EqualFold(r.Column, column))
+}
+
+// Config is the configuration of masking
+type Config struct {
+	// the values of the columns matching the rules are replaced by Masked
+	Rules []Rule `toml:"rule" json:"rule"`
+	// the string values longer than HashOver are replaced by their hash, 0 means disabled
+	HashOver int `toml:"hash-over" json:"hash-over"`
+}
+
+// Masker masks the values by the rules of Config, a nil Masker keeps the values as they are
+type Masker struct {
+	cfg Config
+}
+
+// New returns a Masker, it returns nil if cfg is nil or masks nothing
+func New(cfg *Config) *Masker {
+	if cfg == nil || (len(cfg.Rules) == 0 && cfg.HashOver <= 0) {
+		return nil
+	}
+	return &Masker{cfg: *cfg}
+}
+
+func (m *Masker) matchTable(schema, table string) bool {
+	// the table is unknown, it may be any of the tables configured
+	if len(schema) == 0 && len(table) == 0 {
+		return len(m.cfg.Rules) > 0
+	}
+	for i := range m.cfg.Rules {
+		if m.cfg.Rules[i].matchTable(schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Masker) matchColumn(schema, table, column string) bool {
+	for i := range m.cfg.Rules {
+		if m.cfg.Rules[i].match(schema, table, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value masks the value of the column
+func (m *Masker) Value(schema, table, column string, value interface{}) interface{} {
+	if m == nil || value == nil {
+		return value
+	}
+	if m.matchColumn(schema, table, column) {
+		return Masked
+	}
+	return m.hash(value)
+}
+
+// Values returns a copy of the values of the columns with the sensitive ones masked
+func (m *Masker) Values(schema, table string, values map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return values
+	}
+	masked := make(map[string]interface{}, len(values))
+	for column, value := range values {
+		masked[column] = m.Value(schema, table, column, value)
+	}
+	return masked
+}
+
+// Args masks the args of the SQL executed on the table, the columns of the args are unknown,
+// so all of them are masked if any column of the table is configured to be masked.
+// Empty schema and table mean the table is unknown, which matches any rule.
+func (m *Masker) Args(schema, table string, args []interface{}) []interface{} {
+	if m == nil {
+		return args
+	}
+	matched := m.matchTable(schema, table)
+	masked := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if matched && arg != nil {
+			masked = append(masked, Masked)
+		} else {
+			masked = append(masked, m.hash(arg))
+		}
+	}
+	return masked
+}
+
+// Strings masks the strings containing the values of the table, e.g., the causality keys
+func (m *Masker) Strings(schema, table string, strs []string) []string {
+	if m == nil {
+		return strs
+	}
+	matched := m.matchTable(schema, table)
+	masked := make([]string, 0, len(strs))
+	for _, str := range strs {
+		if matched {
+			masked = append(masked, Masked)
+		} else {
+			masked = append(masked, m.hash(str).(string))
+		}
+	}
+	return masked
+}
+
+func (m *Masker) hash(value interface{}) interface{} {
+	if m.cfg.HashOver <= 0 {
+		return value
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		if len(v) <= m.cfg.HashOver {
+			return value
+		}
+		data = []byte(v)
+	case []byte:
+		if len(v) <= m.cfg.HashOver {
+			return value
+		}
+		data = v
+	default:
+		return value
+	}
+
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+var global atomic.Value
+
+func init() {
+	global.Store((*Masker)(nil))
+}
+
+// SetGlobal replaces the global Masker used by the package level functions
+func SetGlobal(m *Masker) {
+	global.Store(m)
+}
+
+// Global returns the global Masker
+func Global() *Masker {
+	return global.Load().(*Masker)
+}
+
+// Value masks the value of the column by the global Masker
+func Value(schema, table, column string, value interface{}) interface{} {
+	return Global().Value(schema, table, column, value)
+}
+
+// Values masks the values of the columns by the global Masker
+func Values(schema, table string, values map[string]interface{}) map[string]interface{} {
+	return Global().Values(schema, table, values)
+}
+
+// Args masks the args of the SQL executed on the table by the global Masker
+func Args(schema, table string, args []interface{}) []interface{} {
+	return Global().Args(schema, table, args)
+}
+
+// Strings masks the strings containing the values of the table by the global Masker
+func Strings(schema, table string, strs []string) []string {
+	return Global().Strings(schema, table, strs)
+}
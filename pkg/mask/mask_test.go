@@ -0,0 +1,91 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mask
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type maskSuite struct{}
+
+var _ = Suite(&maskSuite{})
+
+func (s *maskSuite) TestNilMasker(c *C) {
+	c.Assert(New(nil), IsNil)
+	c.Assert(New(&Config{}), IsNil)
+
+	var m *Masker
+	args := []interface{}{1, "a"}
+	c.Assert(m.Args("test", "t", args), DeepEquals, args)
+	c.Assert(m.Value("test", "t", "a", "a"), Equals, "a")
+	c.Assert(m.Strings("test", "t", []string{"(id: 1)"}), DeepEquals, []string{"(id: 1)"})
+}
+
+func (s *maskSuite) TestRules(c *C) {
+	m := New(&Config{Rules: []Rule{
+		{Schema: "test", Table: "user", Column: "email"},
+		{Schema: "secret"},
+	}})
+
+	c.Assert(m.Value("test", "user", "email", "a@pingcap.com"), Equals, Masked)
+	c.Assert(m.Value("TEST", "User", "Email", "a@pingcap.com"), Equals, Masked)
+	c.Assert(m.Value("test", "user", "email", nil), IsNil)
+	c.Assert(m.Value("test", "user", "id", 1), Equals, 1)
+	c.Assert(m.Value("test", "order", "email", "a@pingcap.com"), Equals, "a@pingcap.com")
+	c.Assert(m.Value("secret", "any", "any", 1), Equals, Masked)
+
+	values := map[string]interface{}{"id": 1, "email": "a@pingcap.com"}
+	c.Assert(m.Values("test", "user", values), DeepEquals, map[string]interface{}{"id": 1, "email": Masked})
+	c.Assert(values["email"], Equals, "a@pingcap.com")
+
+	// the columns of args are unknown, so all the args of the table are masked
+	c.Assert(m.Args("test", "user", []interface{}{1, nil, "a"}), DeepEquals, []interface{}{Masked, nil, Masked})
+	c.Assert(m.Args("test", "order", []interface{}{1, "a"}), DeepEquals, []interface{}{1, "a"})
+	c.Assert(m.Strings("test", "user", []string{"(id: 1)"}), DeepEquals, []string{Masked})
+	// the table is unknown, it may be the one configured
+	c.Assert(m.Args("", "", []interface{}{1}), DeepEquals, []interface{}{Masked})
+
+	m = New(&Config{Rules: []Rule{{}}})
+	c.Assert(m.Args("", "", []interface{}{1}), DeepEquals, []interface{}{Masked})
+}
+
+func (s *maskSuite) TestHashOver(c *C) {
+	m := New(&Config{HashOver: 4})
+
+	c.Assert(m.Value("test", "t", "a", "abcd"), Equals, "abcd")
+	hashed := m.Value("test", "t", "a", "abcde")
+	c.Assert(strings.HasPrefix(hashed.(string), "sha256:"), IsTrue)
+	c.Assert(hashed, HasLen, len("sha256:")+16)
+	// the same value has the same hash
+	c.Assert(m.Value("test", "t", "b", []byte("abcde")), Equals, hashed)
+	c.Assert(m.Value("test", "t", "a", int64(123456)), Equals, int64(123456))
+	c.Assert(m.Args("test", "t", []interface{}{"abcde", 1}), DeepEquals, []interface{}{hashed, 1})
+}
+
+func (s *maskSuite) TestGlobal(c *C) {
+	c.Assert(Global(), IsNil)
+	c.Assert(Args("test", "t", []interface{}{"a"}), DeepEquals, []interface{}{"a"})
+
+	SetGlobal(New(&Config{Rules: []Rule{{Schema: "test"}}}))
+	defer SetGlobal(nil)
+	c.Assert(Args("test", "t", []interface{}{"a"}), DeepEquals, []interface{}{Masked})
+	c.Assert(Value("test", "t", "a", "a"), Equals, Masked)
+	c.Assert(Values("test", "t", map[string]interface{}{"a": "a"}), DeepEquals, map[string]interface{}{"a": Masked})
+	c.Assert(Strings("test", "t", []string{"a"}), DeepEquals, []string{Masked})
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scrub anonymizes the values of the configured columns before they are written to downstream,
+// e.g., to build a staging environment from the binlogs of production without the personal data.
+package scrub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+const (
+	// MethodHash replaces the value by the hex of its hash
+	MethodHash = "hash"
+	// MethodHashEmail replaces the value by an email of the hash of it at EmailDomain
+	MethodHashEmail = "hash-email"
+	// MethodRandomizeName replaces the value by a full name picked by the hash of it
+	MethodRandomizeName = "randomize-name"
+	// MethodNullify replaces the value by NULL
+	MethodNullify = "nullify"
+)
+
+// EmailDomain is the domain of the emails scrubbed by MethodHashEmail, it's reserved so they're never delivered
+const EmailDomain = "example.com"
+
+// the length of the hex of the hash kept by MethodHash and MethodHashEmail
+const hashLen = 16
+
+var (
+	firstNames = []string{"Alex", "Bailey", "Casey", "Dana", "Eden", "Finley", "Gray", "Harper", "Indigo", "Jordan",
+		"Kai", "Logan", "Morgan", "Noel", "Oakley", "Parker", "Quinn", "Riley", "Sage", "Taylor"}
+	lastNames = []string{"Adams", "Brooks", "Carter", "Diaz", "Evans", "Foster", "Garcia", "Hayes", "Ito", "Jensen",
+		"Khan", "Lopez", "Miller", "Nguyen", "Okafor", "Patel", "Reyes", "Smith", "Tanaka", "Walker"}
+)
+
+// Rule selects the column to scrub and how, an empty Schema or Table matches all.
+type Rule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Column string `toml:"column" json:"column"`
+	// one of "hash", "hash-email", "randomize-name" and "nullify"
+	Method string `toml:"method" json:"method"`
+}
+
+func (r *Rule) match(schema, table, column string) bool {
+	return (len(r.Schema) == 0 || strings.EqualFold(r.Schema, schema)) &&
+		(len(r.Table) == 0 || strings.EqualFold(r.Table, table)) &&
+		strings.EqualFold(r.Column, column)
+}
+
+// Config is the configuration of scrubbing. The values are scrubbed deterministically, i.e., the same value is
+// always replaced by the same one, so the scrubbed columns in the unique keys still identify the rows in the WHERE
+// clauses of the updates and deletes. The hashes are keyed by the salt read from the environment variable SaltEnv,
+// so they can't be reversed by hashing the guesses without it.
+type Config struct {
+	Rules   []Rule `toml:"column" json:"column"`
+	SaltEnv string `toml:"salt-env" json:"salt-env"`
+}
+
+// Validate checks whether the config is valid, the salt is not loaded.
+func (c *Config) Validate() error {
+	if len(c.Rules) == 0 {
+		return errors.New("no column to scrub")
+	}
+	for _, r := range c.Rules {
+		if len(r.Column) == 0 {
+			return errors.Errorf("column of %s.%s is empty", r.Schema, r.Table)
+		}
+		switch r.Method {
+		case MethodHash, MethodHashEmail, MethodRandomizeName, MethodNullify:
+		default:
+			return errors.Errorf("method of %s.%s.%s must be %s, %s, %s or %s, got %s", r.Schema, r.Table, r.Column,
+				MethodHash, MethodHashEmail, MethodRandomizeName, MethodNullify, r.Method)
+		}
+	}
+	return nil
+}
+
+// Scrubber replaces the values of the configured columns of DMLs
+type Scrubber struct {
+	cfg  Config
+	salt []byte
+}
+
+// New loads the salt and returns a Scrubber
+func New(cfg *Config) (*Scrubber, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &Scrubber{cfg: *cfg}
+	if len(cfg.SaltEnv) > 0 {
+		salt, ok := os.LookupEnv(cfg.SaltEnv)
+		if !ok {
+			return nil, errors.Errorf("environment variable %s is not set", cfg.SaltEnv)
+		}
+		s.salt = []byte(salt)
+	}
+	return s, nil
+}
+
+// Transform scrubs the values of the configured columns of dml, it implements loader.Transform.
+func (s *Scrubber) Transform(dml *loader.DML) error {
+	s.scrubValues(dml.Database, dml.Table, dml.Values)
+	s.scrubValues(dml.Database, dml.Table, dml.OldValues)
+	return nil
+}
+
+func (s *Scrubber) scrubValues(schema, table string, values map[string]interface{}) {
+	for column, value := range values {
+		if value == nil {
+			continue
+		}
+		rule := s.match(schema, table, column)
+		if rule == nil {
+			continue
+		}
+		values[column] = s.Scrub(rule.Method, value)
+	}
+}
+
+func (s *Scrubber) match(schema, table, column string) *Rule {
+	for i := range s.cfg.Rules {
+		if s.cfg.Rules[i].match(schema, table, column) {
+			return &s.cfg.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Scrub returns the value scrubbed by the method, the same value is always scrubbed to the same one
+func (s *Scrubber) Scrub(method string, value interface{}) interface{} {
+	switch method {
+	case MethodNullify:
+		return nil
+	case MethodHashEmail:
+		return fmt.Sprintf("%s@%s", s.hash(value)[:hashLen], EmailDomain)
+	case MethodRandomizeName:
+		sum := s.sum(value)
+		first := binary.BigEndian.Uint32(sum[0:4]) % uint32(len(firstNames))
+		last := binary.BigEndian.Uint32(sum[4:8]) % uint32(len(lastNames))
+		return firstNames[first] + " " + lastNames[last]
+	default:
+		return s.hash(value)[:hashLen]
+	}
+}
+
+func (s *Scrubber) sum(value interface{}) []byte {
+	mac := hmac.New(sha256.New, s.salt)
+	mac.Write(toBytes(value))
+	return mac.Sum(nil)
+}
+
+func (s *Scrubber) hash(value interface{}) string {
+	return hex.EncodeToString(s.sum(value))
+}
+
+func toBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
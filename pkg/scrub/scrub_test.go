@@ -0,0 +1,114 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrub
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+type scrubSuite struct{}
+
+var _ = Suite(&scrubSuite{})
+
+func (s *scrubSuite) TestValidate(c *C) {
+	cfg := &Config{Rules: []Rule{{Column: "email", Method: MethodHashEmail}}}
+	c.Assert(cfg.Validate(), IsNil)
+
+	cfg.Rules[0].Method = "mask"
+	c.Assert(cfg.Validate(), ErrorMatches, ".*method of .*email must be.*got mask.*")
+
+	cfg.Rules = []Rule{{Table: "user", Method: MethodHash}}
+	c.Assert(cfg.Validate(), ErrorMatches, ".*column of .user is empty.*")
+	cfg.Rules = nil
+	c.Assert(cfg.Validate(), ErrorMatches, ".*no column.*")
+}
+
+func (s *scrubSuite) TestSalt(c *C) {
+	cfg := &Config{Rules: []Rule{{Column: "email", Method: MethodHash}}, SaltEnv: "TEST_SCRUB_SALT"}
+	os.Unsetenv("TEST_SCRUB_SALT")
+	_, err := New(cfg)
+	c.Assert(err, ErrorMatches, ".*TEST_SCRUB_SALT is not set.*")
+
+	os.Setenv("TEST_SCRUB_SALT", "a")
+	defer os.Unsetenv("TEST_SCRUB_SALT")
+	salted, err := New(cfg)
+	c.Assert(err, IsNil)
+	os.Setenv("TEST_SCRUB_SALT", "b")
+	other, err := New(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(salted.Scrub(MethodHash, "a@pingcap.com"), Not(Equals), other.Scrub(MethodHash, "a@pingcap.com"))
+}
+
+func (s *scrubSuite) TestScrub(c *C) {
+	scrubber, err := New(&Config{Rules: []Rule{{Column: "c", Method: MethodHash}}})
+	c.Assert(err, IsNil)
+
+	hash := scrubber.Scrub(MethodHash, "a@pingcap.com").(string)
+	c.Assert(hash, Matches, "[0-9a-f]{16}")
+	// the same value is scrubbed to the same one, whatever its type is
+	c.Assert(scrubber.Scrub(MethodHash, []byte("a@pingcap.com")), Equals, hash)
+	c.Assert(scrubber.Scrub(MethodHash, "b@pingcap.com"), Not(Equals), hash)
+	c.Assert(scrubber.Scrub(MethodHash, int64(42)), Equals, scrubber.Scrub(MethodHash, "42"))
+
+	email := scrubber.Scrub(MethodHashEmail, "a@pingcap.com").(string)
+	c.Assert(email, Equals, hash+"@"+EmailDomain)
+
+	name := scrubber.Scrub(MethodRandomizeName, "Alice Liddell").(string)
+	c.Assert(name, Matches, "[A-Z][a-z]+ [A-Z][a-z]+")
+	c.Assert(scrubber.Scrub(MethodRandomizeName, "Alice Liddell"), Equals, name)
+
+	c.Assert(scrubber.Scrub(MethodNullify, "free text"), IsNil)
+}
+
+func (s *scrubSuite) TestTransform(c *C) {
+	scrubber, err := New(&Config{Rules: []Rule{
+		{Schema: "test", Table: "user", Column: "email", Method: MethodHashEmail},
+		{Schema: "test", Table: "user", Column: "name", Method: MethodRandomizeName},
+		{Column: "comment", Method: MethodNullify},
+	}})
+	c.Assert(err, IsNil)
+
+	dml := &loader.DML{
+		Database:  "test",
+		Table:     "user",
+		Tp:        loader.UpdateDMLType,
+		Values:    map[string]interface{}{"id": 1, "email": "b@pingcap.com", "name": "Bob", "comment": "vip", "note": nil},
+		OldValues: map[string]interface{}{"id": 1, "email": "a@pingcap.com", "name": "Alice", "comment": nil},
+	}
+	c.Assert(scrubber.Transform(dml), IsNil)
+	c.Assert(dml.Values["id"], Equals, 1)
+	c.Assert(dml.Values["email"], Equals, scrubber.Scrub(MethodHashEmail, "b@pingcap.com"))
+	c.Assert(dml.OldValues["email"], Equals, scrubber.Scrub(MethodHashEmail, "a@pingcap.com"))
+	c.Assert(dml.OldValues["name"], Equals, scrubber.Scrub(MethodRandomizeName, "Alice"))
+	c.Assert(dml.Values["comment"], IsNil)
+	c.Assert(dml.OldValues["comment"], IsNil)
+	c.Assert(dml.Values["note"], IsNil)
+
+	// the columns of the other tables are kept
+	other := &loader.DML{Database: "test", Table: "order", Tp: loader.InsertDMLType,
+		Values: map[string]interface{}{"email": "a@pingcap.com", "comment": "gift"}}
+	c.Assert(scrubber.Transform(other), IsNil)
+	c.Assert(other.Values["email"], Equals, "a@pingcap.com")
+	c.Assert(other.Values["comment"], IsNil)
+	c.Assert(strings.Contains(dml.Values["email"].(string), "pingcap"), IsFalse)
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secret reads the secrets, e.g., the passwords of the databases, from the environment variables, the files
+// or the commands, so they needn't be written in plaintext in the config files. The external secret stores are read
+// by their commands, e.g., `vault kv get -field=password secret/db` for Vault, or `aws secretsmanager get-secret-value
+// --secret-id db --query SecretString --output text` for AWS Secrets Manager.
+//
+// The secrets are read every time they're used instead of cached, so the rotated ones are picked up when the
+// connections are reopened.
+package secret
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+// Source is where a secret is read from, one and only one of the fields must be set.
+type Source struct {
+	// the environment variable holding the secret
+	Env string `toml:"env" json:"env"`
+	// the file holding the secret, e.g., the file of a Kubernetes secret, which is updated on rotation
+	File string `toml:"file" json:"file"`
+	// the command printing the secret to stdout
+	Command []string `toml:"command" json:"command"`
+}
+
+// Validate checks whether the source is valid, the secret is not read.
+func (s *Source) Validate() error {
+	set := 0
+	for _, ok := range []bool{len(s.Env) > 0, len(s.File) > 0, len(s.Command) > 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("one and only one of env, file and command must be set")
+	}
+	return nil
+}
+
+// Read reads the secret, the trailing newline of the file or the command output is removed.
+func (s *Source) Read() (string, error) {
+	switch {
+	case len(s.Env) > 0:
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", errors.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	case len(s.File) > 0:
+		data, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", errors.Annotate(err, "read secret file")
+		}
+		return trimNewline(string(data)), nil
+	case len(s.Command) > 0:
+		var stderr bytes.Buffer
+		cmd := exec.Command(s.Command[0], s.Command[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", errors.Annotatef(err, "run secret command %s: %s", s.Command[0], stderr.String())
+		}
+		return trimNewline(string(out)), nil
+	}
+	return "", errors.New("secret source is empty")
+}
+
+// Password returns the password read from `from` if it's set, or plain otherwise.
+func Password(plain string, from *Source) (string, error) {
+	if from == nil {
+		return plain, nil
+	}
+	password, err := from.Read()
+	if err != nil {
+		return "", errors.Annotate(err, "read password")
+	}
+	return password, nil
+}
+
+// CheckPassword checks whether the password is configured either in plaintext or by the source, but not both.
+func CheckPassword(plain string, from *Source) error {
+	if from == nil {
+		return nil
+	}
+	if len(plain) > 0 {
+		return errors.New("password and password-from can't be both set")
+	}
+	return errors.Annotate(from.Validate(), "invalid password-from")
+}
+
+// IsAccessDenied returns true if the error is returned by mysql for the wrong password,
+// e.g., the new connections opened with the password before rotation.
+func IsAccessDenied(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && mysqlErr.Number == tmysql.ErrAccessDenied
+}
+
+func trimNewline(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
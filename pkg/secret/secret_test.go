@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testSecretSuite{})
+
+type testSecretSuite struct{}
+
+func (s *testSecretSuite) TestValidate(c *C) {
+	c.Assert((&Source{}).Validate(), ErrorMatches, ".*one and only one.*")
+	c.Assert((&Source{Env: "PSWD", File: "pswd"}).Validate(), ErrorMatches, ".*one and only one.*")
+	c.Assert((&Source{Env: "PSWD"}).Validate(), IsNil)
+	c.Assert((&Source{File: "pswd"}).Validate(), IsNil)
+	c.Assert((&Source{Command: []string{"cat", "pswd"}}).Validate(), IsNil)
+}
+
+func (s *testSecretSuite) TestRead(c *C) {
+	os.Setenv("TEST_SECRET_PASSWORD", "env pswd")
+	defer os.Unsetenv("TEST_SECRET_PASSWORD")
+	value, err := (&Source{Env: "TEST_SECRET_PASSWORD"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "env pswd")
+
+	_, err = (&Source{Env: "TEST_SECRET_PASSWORD_NOT_EXIST"}).Read()
+	c.Assert(err, ErrorMatches, ".*not set.*")
+
+	path := filepath.Join(c.MkDir(), "pswd")
+	c.Assert(ioutil.WriteFile(path, []byte("file pswd\n"), 0600), IsNil)
+	value, err = (&Source{File: path}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "file pswd")
+
+	// the rotated secret is read again
+	c.Assert(ioutil.WriteFile(path, []byte("rotated pswd\n"), 0600), IsNil)
+	value, err = (&Source{File: path}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "rotated pswd")
+
+	value, err = (&Source{Command: []string{"echo", "command pswd"}}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "command pswd")
+
+	_, err = (&Source{Command: []string{"false"}}).Read()
+	c.Assert(err, ErrorMatches, ".*run secret command.*")
+}
+
+func (s *testSecretSuite) TestPassword(c *C) {
+	password, err := Password("plain", nil)
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "plain")
+
+	password, err = Password("", &Source{Command: []string{"echo", "pswd"}})
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "pswd")
+
+	c.Assert(CheckPassword("plain", nil), IsNil)
+	c.Assert(CheckPassword("", &Source{Env: "PSWD"}), IsNil)
+	c.Assert(CheckPassword("plain", &Source{Env: "PSWD"}), ErrorMatches, ".*can't be both set.*")
+	c.Assert(CheckPassword("", &Source{}), ErrorMatches, "invalid password-from.*")
+}
+
+func (s *testSecretSuite) TestIsAccessDenied(c *C) {
+	c.Assert(IsAccessDenied(errors.Trace(&mysql.MySQLError{Number: 1045})), IsTrue)
+	c.Assert(IsAccessDenied(&mysql.MySQLError{Number: 1062}), IsFalse)
+	c.Assert(IsAccessDenied(errors.New("Access denied")), IsFalse)
+}
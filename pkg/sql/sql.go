@@ -27,6 +27,7 @@ import (
 	"github.com/pingcap/log"
 	tmysql "github.com/pingcap/parser/mysql"
 	"github.com/pingcap/parser/terror"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	tddl "github.com/pingcap/tidb/ddl"
 	"github.com/pingcap/tidb/infoschema"
@@ -89,7 +90,7 @@ func ExecuteTxnWithHistogram(db *sql.DB, sqls []string, args [][]interface{}, hi
 
 		_, err = txn.Exec(sqls[i], args[i]...)
 		if err != nil {
-			log.Error("exec failed", zap.String("sql", sqls[i]), zap.Reflect("args", args[i]), zap.Error(err))
+			log.Error("exec failed", zap.String("sql", sqls[i]), zap.Reflect("args", mask.Args("", "", args[i])), zap.Error(err))
 			rerr := txn.Rollback()
 			if rerr != nil {
 				log.Error("Rollback failed", zap.Error(rerr))
@@ -102,7 +103,7 @@ func ExecuteTxnWithHistogram(db *sql.DB, sqls []string, args [][]interface{}, hi
 			hist.WithLabelValues("exec").Observe(takeDuration.Seconds())
 		}
 		if takeDuration > SlowWarnLog {
-			log.Warn("exec slow log", zap.Duration("take", takeDuration), zap.String("sql", sqls[i]), zap.Reflect("args", args[i]))
+			log.Warn("exec slow log", zap.Duration("take", takeDuration), zap.String("sql", sqls[i]), zap.Reflect("args", mask.Args("", "", args[i])))
 		}
 	}
 
@@ -302,3 +303,13 @@ func QuoteName(name string) string {
 func escapeName(name string) string {
 	return strings.Replace(name, "`", "``", -1)
 }
+
+// GetGTIDExecuted gets the GTID set executed in mysql, it's empty if GTID is disabled.
+func GetGTIDExecuted(db *sql.DB) (string, error) {
+	var gtidSet string
+	if err := db.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&gtidSet); err != nil {
+		return "", errors.Trace(err)
+	}
+	// the GTID sets of different servers are separated by a newline
+	return strings.Replace(gtidSet, "\n", "", -1), nil
+}
@@ -16,6 +16,7 @@ package sql
 import (
 	"database/sql"
 	"errors"
+	"regexp"
 	"testing"
 	"time"
 
@@ -121,6 +122,17 @@ func (s *sqlSuite) TestGetTidbPosition(c *C) {
 	c.Assert(tso, Equals, int64(407774332609932))
 }
 
+func (s *sqlSuite) TestGetGTIDExecuted(c *C) {
+	s.mock.ExpectQuery(regexp.QuoteMeta("SELECT @@GLOBAL.gtid_executed")).WillReturnRows(
+		sqlmock.NewRows([]string{"@@GLOBAL.gtid_executed"}).
+			AddRow("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:1-3"),
+	)
+
+	gtidSet, err := GetGTIDExecuted(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(gtidSet, Equals, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-3")
+}
+
 const (
 	testQuery1 = "UPDATE foo SET bar = bar - ?"
 	testQuery2 = "DELETE FROM foo WHERE bar <= ?"
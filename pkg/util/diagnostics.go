@@ -0,0 +1,106 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	rpprof "runtime/pprof"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// the profiles written by DumpProfiles and their debug levels, the goroutines are dumped with their full stacks
+var dumpedProfiles = []struct {
+	name  string
+	debug int
+}{
+	{"goroutine", 2},
+	{"heap", 0},
+}
+
+// NewDiagnosticsMux returns the mux of the diagnostics endpoints, which is meant to be served on an address
+// separate from the APIs, e.g., bound to the localhost:
+//   - `/debug/pprof/` the profiles of net/http/pprof
+//   - `PUT /debug/dump` dumps the goroutines and the heap to files in dumpDir by DumpProfiles
+//   - `GET /debug/state` the internal state returned by state, e.g., the sizes of the queues
+func NewDiagnosticsMux(dumpDir string, state func() interface{}) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/dump", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			WriteJSON(w, http.StatusMethodNotAllowed, ErrResponsef("method %s not allowed", r.Method))
+			return
+		}
+		files, err := DumpProfiles(dumpDir)
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrResponsef("dump profiles failed: %v", err))
+			return
+		}
+		WriteJSON(w, http.StatusOK, SuccessResponse("dump profiles success", files))
+	})
+	mux.HandleFunc("/debug/state", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteJSON(w, http.StatusMethodNotAllowed, ErrResponsef("method %s not allowed", r.Method))
+			return
+		}
+		WriteJSON(w, http.StatusOK, SuccessResponse("get state success", state()))
+	})
+	return mux
+}
+
+// DumpProfiles writes the goroutine and heap profiles to the files in dir named by the profile and the time,
+// and returns the files written.
+func DumpProfiles(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	now := time.Now().Format("20060102-150405.000")
+	var files []string
+	for _, p := range dumpedProfiles {
+		name := filepath.Join(dir, fmt.Sprintf("%s-%s.pprof", p.name, now))
+		if p.debug > 0 {
+			name = filepath.Join(dir, fmt.Sprintf("%s-%s.txt", p.name, now))
+		}
+		if err := writeProfile(name, p.name, p.debug); err != nil {
+			return files, errors.Annotatef(err, "dump %s", p.name)
+		}
+		files = append(files, name)
+	}
+	log.Info("profiles dumped", zap.Strings("files", files))
+	return files, nil
+}
+
+func writeProfile(name string, profile string, debug int) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = rpprof.Lookup(profile).WriteTo(f, debug); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
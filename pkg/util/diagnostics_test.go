@@ -0,0 +1,73 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+)
+
+type diagnosticsSuite struct{}
+
+var _ = Suite(&diagnosticsSuite{})
+
+func (s *diagnosticsSuite) TestDumpProfiles(c *C) {
+	dir := filepath.Join(c.MkDir(), "diagnostics")
+	mux := NewDiagnosticsMux(dir, nil)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/dump", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/debug/dump", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+	c.Assert(resp.Data, HasLen, 2)
+	c.Assert(resp.Data[0], Matches, `.*/goroutine-.*\.txt`)
+	c.Assert(resp.Data[1], Matches, `.*/heap-.*\.pprof`)
+	for _, name := range resp.Data {
+		c.Assert(filepath.Dir(name), Equals, dir)
+		info, err := os.Stat(name)
+		c.Assert(err, IsNil)
+		c.Assert(info.Size(), Greater, int64(0))
+	}
+}
+
+func (s *diagnosticsSuite) TestState(c *C) {
+	mux := NewDiagnosticsMux(c.MkDir(), func() interface{} {
+		return map[string]int{"queue": 42}
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/state", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var resp struct {
+		Data map[string]int `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+	c.Assert(resp.Data, DeepEquals, map[string]int{"queue": 42})
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+}
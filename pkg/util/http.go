@@ -14,9 +14,13 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 const (
@@ -61,3 +65,32 @@ func ErrResponsef(format string, args ...interface{}) *Response {
 		Message: errMsg,
 	}
 }
+
+// WriteJSON writes the response to w in json.
+func WriteJSON(w http.ResponseWriter, statusCode int, resp *Response) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error("Failed to write JSON response", zap.Error(err))
+	}
+}
+
+// LogLevelHandler returns the log level for GET, and changes the log level
+// for PUT, e.g., `curl -X PUT http://127.0.0.1:8250/log-level?level=debug`.
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		WriteJSON(w, http.StatusOK, SuccessResponse("get log level success", log.GetLevel().String()))
+	case http.MethodPut:
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(r.FormValue("level"))); err != nil {
+			WriteJSON(w, http.StatusBadRequest, ErrResponsef("invalid log level %s", r.FormValue("level")))
+			return
+		}
+		log.SetLevel(level)
+		log.Info("log level changed", zap.Stringer("level", level))
+		WriteJSON(w, http.StatusOK, SuccessResponse("change log level success", level.String()))
+	default:
+		WriteJSON(w, http.StatusMethodNotAllowed, ErrResponsef("method %s not allowed", r.Method))
+	}
+}
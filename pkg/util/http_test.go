@@ -14,7 +14,13 @@
 package util
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
 	. "github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"go.uber.org/zap/zapcore"
 )
 
 type httpSuite struct{}
@@ -39,3 +45,29 @@ func (s *httpSuite) TestErrResponsef(c *C) {
 	c.Assert(resp.Message, Equals, "doctor 42")
 	c.Assert(resp.Code, Equals, statusOtherError)
 }
+
+func (s *httpSuite) TestLogLevelHandler(c *C) {
+	origLevel := log.GetLevel()
+	defer log.SetLevel(origLevel)
+
+	w := httptest.NewRecorder()
+	LogLevelHandler(w, httptest.NewRequest("PUT", "/log-level?level=debug", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(log.GetLevel(), Equals, zapcore.DebugLevel)
+
+	w = httptest.NewRecorder()
+	LogLevelHandler(w, httptest.NewRequest("GET", "/log-level", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var resp Response
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+	c.Assert(resp.Data, Equals, "debug")
+
+	w = httptest.NewRecorder()
+	LogLevelHandler(w, httptest.NewRequest("PUT", "/log-level?level=nosuchlevel", nil))
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(log.GetLevel(), Equals, zapcore.DebugLevel)
+
+	w = httptest.NewRecorder()
+	LogLevelHandler(w, httptest.NewRequest("DELETE", "/log-level", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+}
@@ -57,6 +57,11 @@ func (mc MetricClient) Start(ctx context.Context, grouping map[string]string) {
 	}
 }
 
+// Push pushes the metrics to Prometheus Pushgateway once, e.g., the final values of a one-shot job before it exits.
+func (mc MetricClient) Push(grouping map[string]string) error {
+	return addToPusher("binlog", grouping, mc.addr, mc.registry)
+}
+
 func addFromGatherer(job string, grouping map[string]string, url string, g prometheus.Gatherer) error {
 	pusher := push.New(url, job)
 	// add grouping
@@ -66,3 +66,22 @@ func (s *p8sSuite) TestAddToPusher(c *C) {
 	c.Assert(nCalled, GreaterEqual, 4)
 	c.Assert(nCalled, LessEqual, 6)
 }
+
+func (s *p8sSuite) TestPush(c *C) {
+	mc := NewMetricClient("localhost:9999", 0, prometheus.NewRegistry())
+
+	var nCalled int
+	orig := addToPusher
+	addToPusher = func(job string, grouping map[string]string, url string, g prometheus.Gatherer) error {
+		c.Assert(grouping, DeepEquals, map[string]string{"instance": "reparo-1"})
+		c.Assert(url, Equals, mc.addr)
+		nCalled++
+		return nil
+	}
+	defer func() {
+		addToPusher = orig
+	}()
+
+	c.Assert(mc.Push(map[string]string{"instance": "reparo-1"}), IsNil)
+	c.Assert(nCalled, Equals, 1)
+}
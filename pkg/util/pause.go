@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"sync"
+)
+
+// Pauser is used to pause and resume a procedure, the procedure calls Wait
+// before handling the next item, and Wait blocks while it's paused.
+type Pauser struct {
+	mu     sync.Mutex
+	paused bool
+	// closed when resumed
+	resumed chan struct{}
+}
+
+// Pause pauses the procedure, it's a no-op if already paused.
+func (p *Pauser) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return
+	}
+	p.paused = true
+	p.resumed = make(chan struct{})
+}
+
+// Resume resumes the procedure, it's a no-op if not paused.
+func (p *Pauser) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	close(p.resumed)
+}
+
+// IsPaused returns true if it's paused.
+func (p *Pauser) IsPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+// Resumed returns a channel closed when the procedure is resumed, it's already closed if not paused.
+// It can be used to wait in a select which also handles other events.
+func (p *Pauser) Resumed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		resumed := make(chan struct{})
+		close(resumed)
+		return resumed
+	}
+	return p.resumed
+}
+
+// Wait blocks until resumed or the context is done.
+func (p *Pauser) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.paused {
+		p.mu.Unlock()
+		return nil
+	}
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type pauserSuite struct{}
+
+var _ = Suite(&pauserSuite{})
+
+func (s *pauserSuite) TestPauseAndResume(c *C) {
+	var p Pauser
+	c.Assert(p.IsPaused(), IsFalse)
+	c.Assert(p.Wait(context.Background()), IsNil)
+
+	p.Pause()
+	p.Pause()
+	c.Assert(p.IsPaused(), IsTrue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(p.Wait(ctx), Equals, context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Wait(context.Background())
+	}()
+
+	p.Resume()
+	p.Resume()
+	c.Assert(p.IsPaused(), IsFalse)
+	select {
+	case err := <-done:
+		c.Assert(err, IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("Wait is not unblocked by Resume")
+	}
+}
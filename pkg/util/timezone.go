@@ -0,0 +1,179 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+const timestampLayout = "2006-01-02 15:04:05"
+
+// ParseTimeZone parses the time zone of the configuration, it can be
+// empty or "Local" for the local time zone of the process, "SYSTEM" as in MySQL,
+// an offset like "+08:00" or "-03:30", or a name of the IANA time zone database like "Asia/Shanghai".
+func ParseTimeZone(name string) (*time.Location, error) {
+	switch {
+	case name == "" || strings.EqualFold(name, "Local") || strings.EqualFold(name, "SYSTEM"):
+		return time.Local, nil
+	case strings.EqualFold(name, "UTC"):
+		return time.UTC, nil
+	case name[0] == '+' || name[0] == '-':
+		offset, err := parseOffset(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return time.FixedZone(name, offset), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid time zone %s", name)
+	}
+	return loc, nil
+}
+
+func parseOffset(name string) (int, error) {
+	parts := strings.Split(name[1:], ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, errors.Errorf("invalid time zone offset %s, should be like +08:00", name)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour > 14 {
+		return 0, errors.Errorf("invalid time zone offset %s, should be like +08:00", name)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute >= 60 {
+		return 0, errors.Errorf("invalid time zone offset %s, should be like +08:00", name)
+	}
+
+	offset := hour*3600 + minute*60
+	if name[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// FormatTimeZoneOffset returns the offset of the location at the time as "+hh:mm"
+func FormatTimeZoneOffset(loc *time.Location, t time.Time) string {
+	_, offset := t.In(loc).Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// SessionTimeZone returns the value to set the session variable `time_zone` to so that the
+// server interprets TIMESTAMP values in the time zone of the configuration, it's empty if the
+// server default should be kept, which is the case of "SYSTEM" as in MySQL.
+// Named time zones are kept as is so the DST is handled by the server (which must have
+// the time zone tables loaded for MySQL), and the local time zone is sent by its name too,
+// or by its offset if it never changes, as a fixed offset is wrong after the next DST transition.
+func SessionTimeZone(name string) (string, error) {
+	loc, err := ParseTimeZone(name)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	switch {
+	case strings.EqualFold(name, "SYSTEM"):
+		return "", nil
+	case loc == time.Local:
+		return localSessionTimeZone()
+	case loc == time.UTC:
+		return "+00:00", nil
+	}
+	return name, nil
+}
+
+// the file linking to the local time zone in the time zone database, should only be changed by the tests
+var localTimeFile = "/etc/localtime"
+
+func localSessionTimeZone() (string, error) {
+	if name := localTimeZoneName(); len(name) > 0 {
+		return name, nil
+	}
+	if offset, ok := fixedOffset(time.Local, time.Now()); ok {
+		return offset, nil
+	}
+	return "", errors.New("the name of the local time zone is unknown and its offset changes with DST, set the time zone to a name like Europe/Berlin")
+}
+
+// localTimeZoneName returns the name of the local time zone in the time zone database, which is found from
+// $TZ or the link of /etc/localtime, it's empty if not found.
+func localTimeZoneName() string {
+	name, ok := os.LookupEnv("TZ")
+	if ok {
+		if len(name) == 0 {
+			return "UTC"
+		}
+		name = strings.TrimPrefix(name, ":")
+	} else {
+		var err error
+		if name, err = os.Readlink(localTimeFile); err != nil {
+			return ""
+		}
+	}
+
+	// a path in the time zone database, like /usr/share/zoneinfo/Europe/Berlin
+	if idx := strings.LastIndex(name, "zoneinfo/"); idx >= 0 {
+		name = name[idx+len("zoneinfo/"):]
+	}
+	if len(name) == 0 || strings.HasPrefix(name, "/") {
+		return ""
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// fixedOffset returns the offset of loc as "+hh:mm" if it's the same in the winter and summer around t.
+func fixedOffset(loc *time.Location, t time.Time) (string, bool) {
+	offset := FormatTimeZoneOffset(loc, t)
+	for year := t.Year() - 1; year <= t.Year()+1; year++ {
+		for _, month := range []time.Month{time.January, time.July} {
+			if FormatTimeZoneOffset(loc, time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)) != offset {
+				return "", false
+			}
+		}
+	}
+	return offset, true
+}
+
+// ConvertTimestamp converts the TIMESTAMP value formatted as "2006-01-02 15:04:05[.fraction]" from
+// the time zone `from` to the time zone `to`, the precision of the fractional seconds is kept.
+// The zero value is returned as is because it doesn't represent any point in time.
+func ConvertTimestamp(value string, from, to *time.Location) (string, error) {
+	if from == to || strings.HasPrefix(value, "0000-00-00") {
+		return value, nil
+	}
+
+	layout := timestampLayout
+	if idx := strings.IndexByte(value, '.'); idx >= 0 {
+		layout += "." + strings.Repeat("0", len(value)-idx-1)
+	}
+	t, err := time.ParseInLocation(layout, value, from)
+	if err != nil {
+		return "", errors.Annotatef(err, "invalid timestamp %s", value)
+	}
+	return t.In(to).Format(layout), nil
+}
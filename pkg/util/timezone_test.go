@@ -0,0 +1,184 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type timeZoneSuite struct{}
+
+var _ = Suite(&timeZoneSuite{})
+
+func (s *timeZoneSuite) TestParseTimeZone(c *C) {
+	for _, name := range []string{"", "Local", "SYSTEM"} {
+		loc, err := ParseTimeZone(name)
+		c.Assert(err, IsNil)
+		c.Assert(loc, Equals, time.Local)
+	}
+
+	loc, err := ParseTimeZone("UTC")
+	c.Assert(err, IsNil)
+	c.Assert(loc, Equals, time.UTC)
+
+	loc, err = ParseTimeZone("+05:30")
+	c.Assert(err, IsNil)
+	c.Assert(FormatTimeZoneOffset(loc, time.Now()), Equals, "+05:30")
+
+	loc, err = ParseTimeZone("-03:30")
+	c.Assert(err, IsNil)
+	c.Assert(FormatTimeZoneOffset(loc, time.Now()), Equals, "-03:30")
+
+	for _, name := range []string{"+8:00", "+08", "+08:60", "+15:00", "-ab:00", "Mars/Olympus"} {
+		_, err = ParseTimeZone(name)
+		c.Assert(err, NotNil, Commentf("time zone %s", name))
+	}
+}
+
+func (s *timeZoneSuite) TestSessionTimeZone(c *C) {
+	tz, err := SessionTimeZone("UTC")
+	c.Assert(err, IsNil)
+	c.Assert(tz, Equals, "+00:00")
+
+	tz, err = SessionTimeZone("+05:45")
+	c.Assert(err, IsNil)
+	c.Assert(tz, Equals, "+05:45")
+
+	tz, err = SessionTimeZone("Europe/Berlin")
+	c.Assert(err, IsNil)
+	c.Assert(tz, Equals, "Europe/Berlin")
+
+	// the server default is kept
+	tz, err = SessionTimeZone("SYSTEM")
+	c.Assert(err, IsNil)
+	c.Assert(tz, Equals, "")
+
+	_, err = SessionTimeZone("+5")
+	c.Assert(err, NotNil)
+}
+
+func setTZ(c *C, value string, set bool) func() {
+	orig, ok := os.LookupEnv("TZ")
+	if set {
+		c.Assert(os.Setenv("TZ", value), IsNil)
+	} else {
+		c.Assert(os.Unsetenv("TZ"), IsNil)
+	}
+	return func() {
+		if ok {
+			os.Setenv("TZ", orig)
+		} else {
+			os.Unsetenv("TZ")
+		}
+	}
+}
+
+func (s *timeZoneSuite) TestLocalSessionTimeZone(c *C) {
+	defer setTZ(c, "Europe/Berlin", true)()
+	for _, name := range []string{"", "Local"} {
+		tz, err := SessionTimeZone(name)
+		c.Assert(err, IsNil)
+		c.Assert(tz, Equals, "Europe/Berlin")
+	}
+
+	c.Assert(os.Setenv("TZ", ":/usr/share/zoneinfo/Asia/Shanghai"), IsNil)
+	c.Assert(localTimeZoneName(), Equals, "Asia/Shanghai")
+
+	// found by the link of /etc/localtime
+	c.Assert(os.Unsetenv("TZ"), IsNil)
+	origLocalTimeFile := localTimeFile
+	defer func() {
+		localTimeFile = origLocalTimeFile
+	}()
+	localTimeFile = filepath.Join(c.MkDir(), "localtime")
+	c.Assert(os.Symlink("/usr/share/zoneinfo/America/New_York", localTimeFile), IsNil)
+	c.Assert(localTimeZoneName(), Equals, "America/New_York")
+
+	localTimeFile = filepath.Join(c.MkDir(), "localtime")
+	c.Assert(localTimeZoneName(), Equals, "")
+}
+
+func (s *timeZoneSuite) TestSessionTimeZoneAcrossDST(c *C) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	c.Assert(err, IsNil)
+
+	// the offset of the local time zone taken in winter is wrong after the DST transition at 2019-03-31 01:00 UTC,
+	// so the offset is used only if it never changes
+	winter := time.Date(2019, 3, 31, 0, 30, 0, 0, time.UTC)
+	summer := time.Date(2019, 3, 31, 1, 30, 0, 0, time.UTC)
+	c.Assert(FormatTimeZoneOffset(berlin, winter), Equals, "+01:00")
+	c.Assert(FormatTimeZoneOffset(berlin, summer), Equals, "+02:00")
+	_, ok := fixedOffset(berlin, winter)
+	c.Assert(ok, IsFalse)
+
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	c.Assert(err, IsNil)
+	offset, ok := fixedOffset(shanghai, winter)
+	c.Assert(ok, IsTrue)
+	c.Assert(offset, Equals, "+08:00")
+
+	// the name sent to the server is the same on both sides of the transition, so the values are interpreted by
+	// the offsets at their own time
+	defer setTZ(c, "Europe/Berlin", true)()
+	tz, err := SessionTimeZone("Local")
+	c.Assert(err, IsNil)
+	loc, err := time.LoadLocation(tz)
+	c.Assert(err, IsNil)
+	c.Assert(winter.In(loc).Format(timestampLayout), Equals, "2019-03-31 01:30:00")
+	c.Assert(summer.In(loc).Format(timestampLayout), Equals, "2019-03-31 03:30:00")
+}
+
+func (s *timeZoneSuite) TestConvertTimestamp(c *C) {
+	from, err := ParseTimeZone("+08:00")
+	c.Assert(err, IsNil)
+	to, err := ParseTimeZone("-03:30")
+	c.Assert(err, IsNil)
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"2019-05-01 08:00:00", "2019-04-30 20:30:00"},
+		{"2019-05-01 08:00:00.5", "2019-04-30 20:30:00.5"},
+		{"2019-05-01 08:00:00.000123", "2019-04-30 20:30:00.000123"},
+		{"0000-00-00 00:00:00", "0000-00-00 00:00:00"},
+	}
+	for _, t := range tests {
+		value, err := ConvertTimestamp(t.value, from, to)
+		c.Assert(err, IsNil)
+		c.Assert(value, Equals, t.expected)
+	}
+
+	_, err = ConvertTimestamp("2019-05-01", from, to)
+	c.Assert(err, NotNil)
+}
+
+func (s *timeZoneSuite) TestConvertTimestampAcrossDST(c *C) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		c.Skip("time zone database is not available")
+	}
+
+	// EST is UTC-5 and EDT is UTC-4
+	value, err := ConvertTimestamp("2019-03-10 06:59:59", time.UTC, ny)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "2019-03-10 01:59:59")
+	value, err = ConvertTimestamp("2019-03-10 07:00:00", time.UTC, ny)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "2019-03-10 03:00:00")
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/config"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
@@ -71,12 +72,13 @@ type Config struct {
 
 	GenFakeBinlogInterval int `toml:"gen-binlog-interval" json:"gen-binlog-interval"`
 
-	MetricsAddr     string
-	MetricsInterval int
-	configFile      string
-	printVersion    bool
-	tls             *tls.Config
-	Storage         storage.Config `toml:"storage" json:"storage"`
+	MetricsAddr          string
+	MetricsInterval      int
+	configFile           string
+	printVersion         bool
+	printEffectiveConfig bool
+	tls                  *tls.Config
+	Storage              storage.Config `toml:"storage" json:"storage"`
 }
 
 // NewConfig return an instance of configuration
@@ -105,6 +107,7 @@ func NewConfig() *Config {
 	fs.IntVar(&cfg.MetricsInterval, "metrics-interval", 15, "prometheus client push interval in second, set \"0\" to disable prometheus push")
 	fs.StringVar(&cfg.configFile, "config", "", "path to the pump configuration file")
 	fs.BoolVar(&cfg.printVersion, "V", false, "print version information and exit")
+	fs.BoolVar(&cfg.printEffectiveConfig, "print-effective-config", false, "print the effective config in TOML after parsing the config file and flags and exit")
 	fs.StringVar(&cfg.LogFile, "log-file", "", "log file path")
 	fs.IntVar(&cfg.GenFakeBinlogInterval, "fake-binlog-interval", defaultGenFakeBinlogInterval, "interval time to generate fake binlog, the unit is second")
 
@@ -170,11 +173,20 @@ func (cfg *Config) Parse(arguments []string) error {
 	util.AdjustString(&cfg.DataDir, defaultDataDir)
 	util.AdjustInt(&cfg.HeartbeatInterval, defaultHeartbeatInterval)
 
-	return cfg.validate()
+	if err := cfg.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.printEffectiveConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			return errors.Trace(err)
+		}
+		os.Exit(0)
+	}
+	return nil
 }
 
 func (cfg *Config) configFromFile(path string) error {
-	return util.StrictDecodeFile(path, "pump", cfg)
+	return config.Load(path, "pump", cfg)
 }
 
 // validate checks whether the configuration is valid
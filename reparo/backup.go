@@ -0,0 +1,407 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
+	"go.uber.org/zap"
+)
+
+const (
+	backupLoaderMyloader  = "myloader"
+	backupLoaderLightning = "lightning"
+	backupLoaderSQL       = "sql"
+
+	backupMetadataFile = "metadata"
+)
+
+// FullBackupConfig is the configuration of the full backup, which is restored before replaying binlogs.
+type FullBackupConfig struct {
+	// Dir is the directory of the full backup dumped by mydumper.
+	Dir string `toml:"dir" json:"dir"`
+	// Loader can be "myloader", "lightning" or "sql", "sql" means executing the sql files by reparo itself.
+	Loader string `toml:"loader" json:"loader"`
+	// LoaderPath is the path of the myloader or tidb-lightning binary.
+	LoaderPath string `toml:"loader-path" json:"loader-path"`
+	// LoaderArgs are the extra arguments passed to the loader binary.
+	LoaderArgs []string `toml:"loader-args" json:"loader-args"`
+	// SnapshotTSO is the ts of the full backup, it's read from the metadata file of the backup if it's 0.
+	SnapshotTSO int64 `toml:"snapshot-tso" json:"snapshot-tso"`
+}
+
+// Validate checks the config.
+func (c *FullBackupConfig) Validate() error {
+	if c.Dir == "" {
+		return errors.New("dir of full-backup must not be empty")
+	}
+
+	switch c.Loader {
+	case backupLoaderMyloader, backupLoaderLightning:
+		if c.LoaderPath == "" {
+			return errors.Errorf("loader-path must be set for loader %s", c.Loader)
+		}
+	case backupLoaderSQL:
+	default:
+		return errors.Errorf("loader %s is not supported", c.Loader)
+	}
+
+	return nil
+}
+
+// should be only used for unit test
+var execCommand = exec.CommandContext
+
+// restoreFullBackup loads the full backup into downstream and returns the snapshot ts of the backup,
+// the loader binary is killed if ctx is done. The binlogs are replayed from the one after the snapshot ts,
+// so a startTS configured otherwise is an error, 0 means it's not configured.
+func restoreFullBackup(ctx context.Context, cfg *FullBackupConfig, dest *syncer.DBConfig, startTS int64, logger *zap.Logger) (int64, error) {
+	ts := cfg.SnapshotTSO
+	if ts == 0 {
+		var err error
+		ts, err = readSnapshotTS(filepath.Join(cfg.Dir, backupMetadataFile))
+		if err != nil {
+			return 0, errors.Annotate(err, "read snapshot ts of full backup failed")
+		}
+	}
+	if startTS != 0 && startTS != ts+1 {
+		return 0, errors.Errorf("start-tso %d disagrees with the snapshot ts %d of the full backup, the binlogs are replayed from %d, "+
+			"unset start-tso and start-datetime or set the snapshot-tso of full-backup", startTS, ts, ts+1)
+	}
+	logger.Info("restore full backup", zap.String("dir", cfg.Dir), zap.String("loader", cfg.Loader), zap.Int64("snapshot ts", ts))
+
+	password, err := dest.GetPassword()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	switch cfg.Loader {
+	case backupLoaderSQL:
+		db, err := createDB(dest.User, password, dest.Host, dest.Port)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		defer db.Close()
+
+		if err = loadSQLFiles(ctx, db, cfg.Dir, logger); err != nil {
+			return 0, errors.Trace(err)
+		}
+	default:
+		cmd, cleanup, err := loaderCommand(ctx, cfg, dest, password, logger)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		defer cleanup()
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return 0, errors.Annotatef(err, "run %s failed", cfg.LoaderPath)
+		}
+	}
+
+	logger.Info("restore full backup success", zap.Int64("snapshot ts", ts))
+	return ts, nil
+}
+
+// loaderCommand returns the command running the loader binary. The password is never passed by the arguments,
+// which can be read by all the local users, myloader reads it from MYSQL_PWD in the environment, and tidb-lightning
+// reads it from a config file only accessible to the current user, which is removed by cleanup.
+func loaderCommand(ctx context.Context, cfg *FullBackupConfig, dest *syncer.DBConfig, password string, logger *zap.Logger) (cmd *exec.Cmd, cleanup func(), err error) {
+	cleanup = func() {}
+	args := loaderArgs(cfg, dest)
+	var env []string
+	if len(password) > 0 {
+		switch cfg.Loader {
+		case backupLoaderMyloader:
+			env = append(os.Environ(), "MYSQL_PWD="+password)
+		case backupLoaderLightning:
+			name, err := writeLightningPassword(password)
+			if err != nil {
+				return nil, nil, errors.Annotate(err, "write the password for tidb-lightning failed")
+			}
+			cleanup = func() {
+				if err := os.Remove(name); err != nil {
+					logger.Warn("remove the config file of tidb-lightning failed", zap.String("file", name), zap.Error(err))
+				}
+			}
+			// put first so a config given by loader-args takes effect instead
+			args = append([]string{"--config", name}, args...)
+		}
+	}
+
+	cmd = execCommand(ctx, cfg.LoaderPath, args...)
+	cmd.Env = env
+	return cmd, cleanup, nil
+}
+
+func loaderArgs(cfg *FullBackupConfig, dest *syncer.DBConfig) []string {
+	var args []string
+	switch cfg.Loader {
+	case backupLoaderMyloader:
+		args = []string{
+			"-d", cfg.Dir,
+			"-h", dest.Host,
+			"-P", strconv.Itoa(dest.Port),
+			"-u", dest.User,
+		}
+	case backupLoaderLightning:
+		args = []string{
+			"-d", cfg.Dir,
+			"--backend", "tidb",
+			"--tidb-host", dest.Host,
+			"--tidb-port", strconv.Itoa(dest.Port),
+			"--tidb-user", dest.User,
+		}
+	}
+	return append(args, cfg.LoaderArgs...)
+}
+
+// writeLightningPassword writes the password to a temporary config file of tidb-lightning with mode 0600,
+// and returns the name of the file.
+func writeLightningPassword(password string) (string, error) {
+	f, err := ioutil.TempFile("", "reparo-lightning-*.toml")
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	var lightningCfg struct {
+		TiDB struct {
+			Password string `toml:"password"`
+		} `toml:"tidb"`
+	}
+	lightningCfg.TiDB.Password = password
+	err = toml.NewEncoder(f).Encode(&lightningCfg)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", errors.Trace(err)
+	}
+	return f.Name(), nil
+}
+
+// readSnapshotTS reads the ts from the metadata file written by mydumper, which is like:
+//
+//	SHOW MASTER STATUS:
+//		Log: tidb-binlog
+//		Pos: 409633583059992577
+func readSnapshotTS(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "Pos:") {
+			continue
+		}
+		ts, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "Pos:")), 10, 64)
+		if err != nil {
+			return 0, errors.Annotatef(err, "invalid position %s", line)
+		}
+		return ts, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	return 0, errors.Errorf("position not found in %s", path)
+}
+
+// loadSQLFiles executes the sql files dumped by mydumper, the files are named as:
+// {db}-schema-create.sql, {db}.{table}-schema.sql and {db}.{table}.sql or {db}.{table}.{part}.sql,
+// the database schemas are created first, then the table schemas, and the data at last.
+func loadSQLFiles(ctx context.Context, db *sql.DB, dir string, logger *zap.Logger) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var dbSchemas, tableSchemas, data []string
+	for _, f := range files {
+		name := f.Name()
+		switch {
+		case f.IsDir() || !strings.HasSuffix(name, ".sql"):
+		case strings.HasSuffix(name, "-schema-create.sql"):
+			dbSchemas = append(dbSchemas, name)
+		case strings.HasSuffix(name, "-schema.sql"):
+			tableSchemas = append(tableSchemas, name)
+		default:
+			data = append(data, name)
+		}
+	}
+
+	for _, names := range [][]string{dbSchemas, tableSchemas, data} {
+		sort.Strings(names)
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return errors.Trace(err)
+			}
+			if err := execSQLFile(ctx, db, dir, name, logger); err != nil {
+				return errors.Annotatef(err, "execute %s failed", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func execSQLFile(ctx context.Context, db *sql.DB, dir string, name string, logger *zap.Logger) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	// the database name is the prefix of file name, and the sql files of tables don't specify database
+	schema := strings.SplitN(name, ".", 2)[0]
+	schema = strings.TrimSuffix(schema, "-schema-create")
+
+	// the data files may be too large to be read at once, so they're executed statement by statement
+	reader := newSQLStatementReader(f)
+	p := parser.New()
+	var count int
+	for {
+		text, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		stmts, _, err := p.Parse(text, "", "")
+		if err != nil {
+			return errors.Annotatef(err, "parse %s", truncate(text, 256))
+		}
+		for _, stmt := range stmts {
+			query := stmtText(stmt)
+			if _, ok := stmt.(*ast.CreateDatabaseStmt); !ok {
+				query = fmt.Sprintf("use %s; %s", pkgsql.QuoteName(schema), query)
+			}
+			if _, err = db.ExecContext(ctx, query); err != nil {
+				return errors.Annotatef(err, "execute %s", truncate(query, 256))
+			}
+			count++
+		}
+	}
+
+	logger.Info("execute sql file success", zap.String("file", name), zap.Int("statements", count))
+	return nil
+}
+
+// sqlStatementReader reads the statements of a sql file one by one, they're split by the semicolons out of the
+// quoted strings, names and comments.
+type sqlStatementReader struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+}
+
+func newSQLStatementReader(r io.Reader) *sqlStatementReader {
+	return &sqlStatementReader{r: bufio.NewReaderSize(r, 1<<20)}
+}
+
+// next returns the next statement without the trailing semicolon, it returns io.EOF if there's no more.
+func (s *sqlStatementReader) next() (string, error) {
+	s.buf.Reset()
+	var (
+		quote        byte
+		escaped      bool
+		lineComment  bool
+		blockComment bool
+		prev         byte
+	)
+	for {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			if text := strings.TrimSpace(s.buf.String()); len(text) > 0 {
+				return text, nil
+			}
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if c == '\\' && quote != '`' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case lineComment:
+			lineComment = c != '\n'
+		case blockComment:
+			blockComment = !(prev == '*' && c == '/')
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || (prev == '-' && c == '-' && s.followedBySpace()):
+			lineComment = true
+		case prev == '/' && c == '*':
+			blockComment = true
+			// the '*' opening the comment doesn't close it in "/*/"
+			s.buf.WriteByte(c)
+			prev = 0
+			continue
+		case c == ';':
+			if text := strings.TrimSpace(s.buf.String()); len(text) > 0 {
+				return text, nil
+			}
+			s.buf.Reset()
+			prev = 0
+			continue
+		}
+		s.buf.WriteByte(c)
+		prev = c
+	}
+}
+
+// followedBySpace returns true if the next byte is a space or the end, as "--" starts a comment only if so.
+func (s *sqlStatementReader) followedBySpace() bool {
+	next, err := s.r.Peek(1)
+	return err != nil || unicode.IsSpace(rune(next[0]))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
+)
+
+type testBackupSuite struct{}
+
+var _ = Suite(&testBackupSuite{})
+
+func writeFile(c *C, dir string, name string, content string) {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *testBackupSuite) TestReadSnapshotTS(c *C) {
+	dir := c.MkDir()
+	writeFile(c, dir, backupMetadataFile, "Started dump at: 2019-12-02 10:00:00\nSHOW MASTER STATUS:\n\tLog: tidb-binlog\n\tPos: 412998468339499009\n\tGTID:\n\nFinished dump at: 2019-12-02 10:00:01\n")
+	ts, err := readSnapshotTS(filepath.Join(dir, backupMetadataFile))
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(412998468339499009))
+
+	writeFile(c, dir, backupMetadataFile, "Started dump at: 2019-12-02 10:00:00\n")
+	_, err = readSnapshotTS(filepath.Join(dir, backupMetadataFile))
+	c.Assert(err, ErrorMatches, "position not found.*")
+}
+
+func (s *testBackupSuite) TestValidate(c *C) {
+	cfg := &FullBackupConfig{Dir: "dump", Loader: "myloader"}
+	c.Assert(cfg.Validate(), ErrorMatches, "loader-path must be set.*")
+	cfg.LoaderPath = "/bin/myloader"
+	c.Assert(cfg.Validate(), IsNil)
+	cfg.Loader = "unknown"
+	c.Assert(cfg.Validate(), ErrorMatches, "loader unknown is not supported")
+	cfg.Loader = "sql"
+	cfg.LoaderPath = ""
+	c.Assert(cfg.Validate(), IsNil)
+	cfg.Dir = ""
+	c.Assert(cfg.Validate(), NotNil)
+}
+
+func (s *testBackupSuite) TestRestoreByLoaderBinary(c *C) {
+	var name string
+	var args []string
+	origExecCommand := execCommand
+	execCommand = func(ctx context.Context, n string, arg ...string) *exec.Cmd {
+		name, args = n, arg
+		return exec.Command("true")
+	}
+	defer func() { execCommand = origExecCommand }()
+
+	cfg := &FullBackupConfig{
+		Dir:         "dump",
+		Loader:      "lightning",
+		LoaderPath:  "/bin/tidb-lightning",
+		LoaderArgs:  []string{"--log-file", "lightning.log"},
+		SnapshotTSO: 42,
+	}
+	dest := &syncer.DBConfig{Host: "127.0.0.1", Port: 4000, User: "root"}
+	ts, err := restoreFullBackup(context.Background(), cfg, dest, 0, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(42))
+	c.Assert(name, Equals, "/bin/tidb-lightning")
+	c.Assert(args, DeepEquals, []string{"-d", "dump", "--backend", "tidb", "--tidb-host", "127.0.0.1", "--tidb-port", "4000",
+		"--tidb-user", "root", "--log-file", "lightning.log"})
+
+	cfg.Loader = "myloader"
+	cfg.LoaderArgs = nil
+	_, err = restoreFullBackup(context.Background(), cfg, dest, 0, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{"-d", "dump", "-h", "127.0.0.1", "-P", "4000", "-u", "root"})
+}
+
+func (s *testBackupSuite) TestStartTSOConflict(c *C) {
+	called := false
+	origExecCommand := execCommand
+	execCommand = func(ctx context.Context, n string, arg ...string) *exec.Cmd {
+		called = true
+		return exec.Command("true")
+	}
+	defer func() { execCommand = origExecCommand }()
+
+	cfg := &FullBackupConfig{Dir: "dump", Loader: "myloader", LoaderPath: "/bin/myloader", SnapshotTSO: 42}
+	dest := &syncer.DBConfig{Host: "127.0.0.1", Port: 4000, User: "root"}
+	_, err := restoreFullBackup(context.Background(), cfg, dest, 10, log.L())
+	c.Assert(err, ErrorMatches, "start-tso 10 disagrees with the snapshot ts 42.*")
+	c.Assert(called, IsFalse)
+
+	ts, err := restoreFullBackup(context.Background(), cfg, dest, 43, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(42))
+	c.Assert(called, IsTrue)
+}
+
+func (s *testBackupSuite) TestLoaderPassword(c *C) {
+	cfg := &FullBackupConfig{Dir: "dump", Loader: "myloader", LoaderPath: "/bin/myloader"}
+	dest := &syncer.DBConfig{Host: "127.0.0.1", Port: 4000, User: "root"}
+
+	// myloader reads the password from the environment
+	cmd, cleanup, err := loaderCommand(context.Background(), cfg, dest, "p@ss\"word", log.L())
+	c.Assert(err, IsNil)
+	cleanup()
+	c.Assert(strings.Join(cmd.Args, " "), Not(Matches), ".*p@ss.*")
+	c.Assert(cmd.Env, Not(HasLen), 0)
+	c.Assert(cmd.Env[len(cmd.Env)-1], Equals, "MYSQL_PWD=p@ss\"word")
+
+	// tidb-lightning reads the password from the config file only readable by the current user
+	cfg.Loader, cfg.LoaderPath = "lightning", "/bin/tidb-lightning"
+	cmd, cleanup, err = loaderCommand(context.Background(), cfg, dest, "p@ss\"word", log.L())
+	c.Assert(err, IsNil)
+	c.Assert(strings.Join(cmd.Args, " "), Not(Matches), ".*p@ss.*")
+	c.Assert(cmd.Args[1], Equals, "--config")
+	name := cmd.Args[2]
+	info, err := os.Stat(name)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0600))
+	var lightningCfg struct {
+		TiDB struct {
+			Password string `toml:"password"`
+		} `toml:"tidb"`
+	}
+	_, err = toml.DecodeFile(name, &lightningCfg)
+	c.Assert(err, IsNil)
+	c.Assert(lightningCfg.TiDB.Password, Equals, "p@ss\"word")
+
+	cleanup()
+	_, err = os.Stat(name)
+	c.Assert(os.IsNotExist(err), IsTrue)
+}
+
+func (s *testBackupSuite) TestLoaderPasswordFrom(c *C) {
+	var cmd *exec.Cmd
+	origExecCommand := execCommand
+	execCommand = func(ctx context.Context, n string, arg ...string) *exec.Cmd {
+		cmd = exec.Command("true")
+		return cmd
+	}
+	defer func() { execCommand = origExecCommand }()
+
+	passwordFile := filepath.Join(c.MkDir(), "password")
+	writeFile(c, filepath.Dir(passwordFile), "password", "rotated\n")
+	cfg := &FullBackupConfig{Dir: "dump", Loader: "myloader", LoaderPath: "/bin/myloader", SnapshotTSO: 42}
+	dest := &syncer.DBConfig{Host: "127.0.0.1", Port: 4000, User: "root", PasswordFrom: &secret.Source{File: passwordFile}}
+	_, err := restoreFullBackup(context.Background(), cfg, dest, 0, log.L())
+	c.Assert(err, IsNil)
+
+	// the password read from the source is passed by the environment rather than the arguments
+	c.Assert(strings.Join(cmd.Args, " "), Not(Matches), ".*rotated.*")
+	c.Assert(cmd.Env, Not(HasLen), 0)
+	c.Assert(cmd.Env[len(cmd.Env)-1], Equals, "MYSQL_PWD=rotated")
+}
+
+func (s *testBackupSuite) TestLoadSQLFiles(c *C) {
+	dir := c.MkDir()
+	writeFile(c, dir, backupMetadataFile, "Pos: 42\n")
+	writeFile(c, dir, "test-schema-create.sql", "CREATE DATABASE `test`;\n")
+	writeFile(c, dir, "test.t1-schema.sql", "/*!40101 SET NAMES binary*/;\nCREATE TABLE `t1` (\n  `id` int(11) NOT NULL\n);\n")
+	writeFile(c, dir, "test.t1.sql", "INSERT INTO `t1` VALUES\n(1),\n(2);\n")
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE `test`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("use `test`; /*!40101 SET NAMES binary*/")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("use `test`; CREATE TABLE `t1`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("use `test`; INSERT INTO `t1` VALUES\n(1),\n(2)")).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = loadSQLFiles(context.Background(), db, dir, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testBackupSuite) TestLoadSQLFilesCancelled(c *C) {
+	dir := c.MkDir()
+	writeFile(c, dir, "test-schema-create.sql", "CREATE DATABASE `test`;\n")
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = loadSQLFiles(ctx, db, dir, log.L())
+	c.Assert(errors.Cause(err), Equals, context.Canceled)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testBackupSuite) TestSQLStatementReader(c *C) {
+	input := "/*!40101 SET NAMES binary*/;\n" +
+		"-- comment; not a statement\n" +
+		"# another; comment\n" +
+		"INSERT INTO `t;1` VALUES ('a;b', \"c\\\";d\", 'e\\'f');\n" +
+		"/* block; comment */ SELECT 1--1;\n" +
+		"INSERT INTO t VALUES (1)"
+	r := newSQLStatementReader(strings.NewReader(input))
+	var stmts []string
+	for {
+		stmt, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		stmts = append(stmts, stmt)
+	}
+	c.Assert(stmts, DeepEquals, []string{
+		"/*!40101 SET NAMES binary*/",
+		"-- comment; not a statement\n# another; comment\nINSERT INTO `t;1` VALUES ('a;b', \"c\\\";d\", 'e\\'f')",
+		"/* block; comment */ SELECT 1--1",
+		"INSERT INTO t VALUES (1)",
+	})
+}
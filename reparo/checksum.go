@@ -0,0 +1,164 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// TableChecksum is the result of `ADMIN CHECKSUM TABLE`.
+type TableChecksum struct {
+	Database   string `json:"database"`
+	Table      string `json:"table"`
+	Checksum   uint64 `json:"checksum"`
+	TotalKvs   uint64 `json:"total-kvs"`
+	TotalBytes uint64 `json:"total-bytes"`
+}
+
+// loadChecksums reads the expected checksums, the file is a json array of TableChecksum.
+func loadChecksums(path string) ([]TableChecksum, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var checksums []TableChecksum
+	if err = json.Unmarshal(data, &checksums); err != nil {
+		return nil, errors.Annotatef(err, "parse %s", path)
+	}
+	return checksums, nil
+}
+
+// metadataChecksumSection starts the checksum of a table in the metadata file of the full backup.
+const metadataChecksumSection = "ADMIN CHECKSUM TABLE:"
+
+// readMetadataChecksums reads the checksums recorded in the metadata file of the full backup,
+// each table has a section like the one of `SHOW MASTER STATUS`:
+//
+//	ADMIN CHECKSUM TABLE:
+//		Database: test
+//		Table: t1
+//		Checksum: 1
+//		Total_kvs: 2
+//		Total_bytes: 3
+//
+// it returns nil if there's no checksum in the file.
+func readMetadataChecksums(path string) ([]TableChecksum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	var (
+		checksums []TableChecksum
+		current   *TableChecksum
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+			// a new section starts
+			current = nil
+			if strings.TrimSpace(line) == metadataChecksumSection {
+				checksums = append(checksums, TableChecksum{})
+				current = &checksums[len(checksums)-1]
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		kv := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := kv[0], strings.TrimSpace(kv[1])
+		var target *uint64
+		switch key {
+		case "Database":
+			current.Database = value
+		case "Table":
+			current.Table = value
+		case "Checksum":
+			target = &current.Checksum
+		case "Total_kvs":
+			target = &current.TotalKvs
+		case "Total_bytes":
+			target = &current.TotalBytes
+		}
+		if target != nil {
+			if *target, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, errors.Annotatef(err, "invalid %s of checksum in %s", key, path)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for _, checksum := range checksums {
+		if checksum.Database == "" || checksum.Table == "" {
+			return nil, errors.Errorf("database or table of checksum is missing in %s", path)
+		}
+	}
+	return checksums, nil
+}
+
+func adminChecksum(db *sql.DB, schema string, table string) (*TableChecksum, error) {
+	checksum := new(TableChecksum)
+	query := fmt.Sprintf("ADMIN CHECKSUM TABLE %s", pkgsql.QuoteSchema(schema, table))
+	err := db.QueryRow(query).Scan(&checksum.Database, &checksum.Table, &checksum.Checksum, &checksum.TotalKvs, &checksum.TotalBytes)
+	if err != nil {
+		return nil, errors.Annotatef(err, "query %s", query)
+	}
+	return checksum, nil
+}
+
+// verifyChecksums compares the checksums of the tables in downstream with the expected ones,
+// all the tables are checked and an error is returned if any of them mismatches.
+func verifyChecksums(db *sql.DB, expected []TableChecksum, logger *zap.Logger) error {
+	var mismatched int
+	for _, e := range expected {
+		actual, err := adminChecksum(db, e.Database, e.Table)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		if actual.Checksum != e.Checksum || actual.TotalKvs != e.TotalKvs || actual.TotalBytes != e.TotalBytes {
+			mismatched++
+			logger.Error("checksum mismatched", zap.String("database", e.Database), zap.String("table", e.Table),
+				zap.Reflect("expected", e), zap.Reflect("actual", actual))
+			continue
+		}
+		logger.Info("checksum matched", zap.String("database", e.Database), zap.String("table", e.Table))
+	}
+
+	if mismatched > 0 {
+		return errors.Errorf("checksum of %d/%d tables mismatched", mismatched, len(expected))
+	}
+	return nil
+}
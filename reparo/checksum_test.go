@@ -0,0 +1,105 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"path/filepath"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/log"
+)
+
+type testChecksumSuite struct{}
+
+var _ = Suite(&testChecksumSuite{})
+
+func (s *testChecksumSuite) TestLoadChecksums(c *C) {
+	dir := c.MkDir()
+	writeFile(c, dir, "checksum.json", `[{"database": "test", "table": "t1", "checksum": 1, "total-kvs": 2, "total-bytes": 3}]`)
+	checksums, err := loadChecksums(filepath.Join(dir, "checksum.json"))
+	c.Assert(err, IsNil)
+	c.Assert(checksums, DeepEquals, []TableChecksum{{Database: "test", Table: "t1", Checksum: 1, TotalKvs: 2, TotalBytes: 3}})
+
+	writeFile(c, dir, "invalid.json", `{"database": "test"}`)
+	_, err = loadChecksums(filepath.Join(dir, "invalid.json"))
+	c.Assert(err, NotNil)
+}
+
+func (s *testChecksumSuite) TestReadMetadataChecksums(c *C) {
+	dir := c.MkDir()
+	writeFile(c, dir, backupMetadataFile, "Started dump at: 2019-06-13 10:00:00\n"+
+		"SHOW MASTER STATUS:\n\tLog: tidb-binlog\n\tPos: 42\n\n"+
+		"ADMIN CHECKSUM TABLE:\n\tDatabase: test\n\tTable: t1\n\tChecksum: 1\n\tTotal_kvs: 2\n\tTotal_bytes: 3\n\n"+
+		"ADMIN CHECKSUM TABLE:\n\tDatabase: test\n\tTable: t2\n\tChecksum: 4\n\tTotal_kvs: 5\n\tTotal_bytes: 6\n\n"+
+		"Finished dump at: 2019-06-13 10:00:01\n")
+	checksums, err := readMetadataChecksums(filepath.Join(dir, backupMetadataFile))
+	c.Assert(err, IsNil)
+	c.Assert(checksums, DeepEquals, []TableChecksum{
+		{Database: "test", Table: "t1", Checksum: 1, TotalKvs: 2, TotalBytes: 3},
+		{Database: "test", Table: "t2", Checksum: 4, TotalKvs: 5, TotalBytes: 6},
+	})
+
+	// the metadata without checksums
+	writeFile(c, dir, backupMetadataFile, "SHOW MASTER STATUS:\n\tLog: tidb-binlog\n\tPos: 42\n")
+	checksums, err = readMetadataChecksums(filepath.Join(dir, backupMetadataFile))
+	c.Assert(err, IsNil)
+	c.Assert(checksums, HasLen, 0)
+
+	writeFile(c, dir, backupMetadataFile, "ADMIN CHECKSUM TABLE:\n\tDatabase: test\n\tChecksum: x\n")
+	_, err = readMetadataChecksums(filepath.Join(dir, backupMetadataFile))
+	c.Assert(err, ErrorMatches, "invalid Checksum of checksum.*")
+}
+
+func (s *testChecksumSuite) TestExpectedChecksums(c *C) {
+	dir := c.MkDir()
+	writeFile(c, dir, backupMetadataFile, "ADMIN CHECKSUM TABLE:\n\tDatabase: test\n\tTable: t1\n\tChecksum: 1\n")
+	writeFile(c, dir, "checksum.json", `[{"database": "test", "table": "t2", "checksum": 2}]`)
+
+	r := &Reparo{cfg: &Config{}}
+	checksums, err := r.expectedChecksums()
+	c.Assert(err, IsNil)
+	c.Assert(checksums, HasLen, 0)
+
+	r.cfg.FullBackup = &FullBackupConfig{Dir: dir}
+	checksums, err = r.expectedChecksums()
+	c.Assert(err, IsNil)
+	c.Assert(checksums, DeepEquals, []TableChecksum{{Database: "test", Table: "t1", Checksum: 1}})
+
+	// checksum-file overrides the checksums in the metadata
+	r.cfg.ChecksumFile = filepath.Join(dir, "checksum.json")
+	checksums, err = r.expectedChecksums()
+	c.Assert(err, IsNil)
+	c.Assert(checksums, DeepEquals, []TableChecksum{{Database: "test", Table: "t2", Checksum: 2}})
+}
+
+func (s *testChecksumSuite) TestVerifyChecksums(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	columns := []string{"Db_name", "Table_name", "Checksum_crc64_xor", "Total_kvs", "Total_bytes"}
+	mock.ExpectQuery(regexp.QuoteMeta("ADMIN CHECKSUM TABLE `test`.`t1`")).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("test", "t1", 1, 2, 3))
+	mock.ExpectQuery(regexp.QuoteMeta("ADMIN CHECKSUM TABLE `test`.`t2`")).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("test", "t2", 4, 5, 7))
+
+	err = verifyChecksums(db, []TableChecksum{
+		{Database: "test", Table: "t1", Checksum: 1, TotalKvs: 2, TotalBytes: 3},
+		{Database: "test", Table: "t2", Checksum: 4, TotalKvs: 5, TotalBytes: 6},
+	}, log.L())
+	c.Assert(err, ErrorMatches, "checksum of 1/2 tables mismatched")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -18,14 +18,16 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/config"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
-	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"github.com/pingcap/tidb-binlog/reparo/syncer"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -47,8 +49,28 @@ type Config struct {
 	TxnBatch      int    `toml:"txn-batch" json:"txn-batch"`
 	WorkerCount   int    `toml:"worker-count" json:"worker-count"`
 
-	DestType string           `toml:"dest-type" json:"dest-type"`
-	DestDB   *syncer.DBConfig `toml:"dest-db" json:"dest-db"`
+	DestType string             `toml:"dest-type" json:"dest-type"`
+	DestDB   *syncer.DBConfig   `toml:"dest-db" json:"dest-db"`
+	DestFile *syncer.FileConfig `toml:"dest-file" json:"dest-file"`
+	// the binlogs are printed as text to stdout if DestPrint is nil when dest-type is print
+	DestPrint *syncer.PrintConfig `toml:"dest-print" json:"dest-print"`
+	// the statistics of the binlogs are written to stdout in text if DestStats is nil when dest-type is stats
+	DestStats *syncer.StatsConfig `toml:"dest-stats" json:"dest-stats"`
+
+	// the schema snapshot at start-tso is exported from SourceDB if it's set, and saved to SchemaFile if
+	// SchemaFile is set, otherwise the schema snapshot is loaded from SchemaFile if it's set.
+	// The schema snapshot is applied to downstream before replaying binlogs.
+	SourceDB   *syncer.DBConfig `toml:"source-db" json:"source-db"`
+	SchemaFile string           `toml:"schema-file" json:"schema-file"`
+
+	// the full backup is restored before replaying binlogs, and the binlogs are replayed from its snapshot ts.
+	FullBackup *FullBackupConfig `toml:"full-backup" json:"full-backup"`
+
+	// the checksums of the tables in downstream are compared with the ones in ChecksumFile after restoring,
+	// or the ones recorded in the metadata of FullBackup if ChecksumFile is not set.
+	ChecksumFile string `toml:"checksum-file" json:"checksum-file"`
+	// the directory of the full backup restored before continuing from the state, see backupMetadata
+	restoredBackupDir string
 
 	DoTables []filter.TableName `toml:"replicate-do-table" json:"replicate-do-table"`
 	DoDBs    []string           `toml:"replicate-do-db" json:"replicate-do-db"`
@@ -56,13 +78,45 @@ type Config struct {
 	IgnoreTables []filter.TableName `toml:"replicate-ignore-table" json:"replicate-ignore-table"`
 	IgnoreDBs    []string           `toml:"replicate-ignore-db" json:"replicate-ignore-db"`
 
+	// restore only the rows matching the expressions of the tables, see RowFilterConfig
+	RowFilters []RowFilterConfig `toml:"row-filter" json:"row-filter"`
+
+	// the sensitive values are masked in the logs and the output of dest-type print
+	Mask *mask.Config `toml:"mask" json:"mask"`
+
+	// the task id is added to the logs as field "task" if it's set
+	TaskID string `toml:"task-id" json:"task-id"`
+
 	LogFile  string `toml:"log-file" json:"log-file"`
 	LogLevel string `toml:"log-level" json:"log-level"`
 
 	SafeMode bool `toml:"safe-mode" json:"safe-mode"`
 
-	configFile   string
-	printVersion bool
+	// replay the binlogs in real time by the spacing of their commit ts divided by ReplaySpeed, 0 means as fast as
+	// possible, see pacer
+	ReplaySpeed float64 `toml:"replay-speed" json:"replay-speed"`
+
+	StatusAddr string `toml:"status-addr" json:"status-addr"`
+
+	// the metrics are pushed to Pushgateway periodically and once more on exit if Metrics.Addr is set
+	Metrics Metrics `toml:"metrics" json:"metrics"`
+
+	// the state of restoring is saved to StateFile when reparo fails, see State
+	StateFile string `toml:"state-file" json:"state-file"`
+	// the state file saved by the failed restoring to continue, see Config.continueFrom
+	ContinueFrom string `toml:"-" json:"continue-from"`
+
+	configFile           string
+	printVersion         bool
+	printEffectiveConfig bool
+}
+
+// Metrics is configuration of metrics
+type Metrics struct {
+	// the address of Prometheus Pushgateway, empty means disabled
+	Addr string `toml:"addr" json:"addr"`
+	// the interval in seconds of pushing, 0 means the metrics are only pushed on exit
+	Interval int `toml:"interval" json:"interval"`
 }
 
 // NewConfig creates a Config object.
@@ -82,11 +136,21 @@ func NewConfig() *Config {
 	fs.IntVar(&c.TxnBatch, "txn-batch", 20, "number of binlog events in a transaction batch")
 	fs.IntVar(&c.WorkerCount, "c", 16, "parallel worker count")
 	fs.StringVar(&c.LogFile, "log-file", "", "log file path")
-	fs.StringVar(&c.DestType, "dest-type", "print", "dest type, values can be [print,mysql]")
+	fs.StringVar(&c.TaskID, "task-id", "", "id of the task, it's added to the logs to tell apart the tasks in a multi-task deployment")
+	fs.StringVar(&c.DestType, "dest-type", "print", "dest type, values can be [print,mysql,file,stats]")
 	fs.StringVar(&c.LogLevel, "L", "info", "log level: debug, info, warn, error, fatal")
 	fs.StringVar(&c.configFile, "config", "", "[REQUIRED] path to configuration file")
 	fs.BoolVar(&c.printVersion, "V", false, "print reparo version info")
+	fs.BoolVar(&c.printEffectiveConfig, "print-effective-config", false, "print the effective config in TOML after parsing the config file and flags and exit")
 	fs.BoolVar(&c.SafeMode, "safe-mode", false, "enable safe mode to make syncer reentrant")
+	fs.Float64Var(&c.ReplaySpeed, "replay-speed", 0, "replay the binlogs in real time by the spacing of their commit ts divided by replay-speed, e.g. 2 replays twice as fast as the original, 0 means as fast as possible")
+	fs.StringVar(&c.SchemaFile, "schema-file", "", "path of the schema snapshot file, which is applied to downstream before replaying binlogs")
+	fs.StringVar(&c.ChecksumFile, "checksum-file", "", "path of the expected checksums file, the restored tables are verified by ADMIN CHECKSUM TABLE if it's set")
+	fs.StringVar(&c.StatusAddr, "status-addr", "", "addr (i.e. 'host:port') to serve the status and admin APIs on, empty means disabled")
+	fs.StringVar(&c.Metrics.Addr, "metrics.addr", "", "prometheus pushgateway address, leaves it empty will disable prometheus push")
+	fs.IntVar(&c.Metrics.Interval, "metrics.interval", 15, "prometheus client push interval in second, set \"0\" to push only on exit")
+	fs.StringVar(&c.StateFile, "state-file", "reparo-state.json", "path of the file the state of restoring is saved to when reparo fails, empty means disabled")
+	fs.StringVar(&c.ContinueFrom, "continue-from", "", "path of the state file saved by the failed restoring, the restoring is continued from the binlog after the last one applied")
 	return c
 }
 
@@ -118,8 +182,8 @@ func (c *Config) Parse(args []string) (err error) {
 		os.Exit(0)
 	}
 
-	// the mysql configuration should be in the file.
-	if c.DestType == "mysql" && c.configFile == "" {
+	// the mysql and file configuration should be in the file.
+	if (c.DestType == "mysql" || c.DestType == "file") && c.configFile == "" {
 		return errors.Errorf("please specify config file")
 	}
 
@@ -160,7 +224,38 @@ func (c *Config) Parse(args []string) (err error) {
 		log.Info("Parsed stop TSO", zap.Int64("ts", c.StopTSO))
 	}
 
-	return errors.Trace(c.validate())
+	if c.ContinueFrom != "" {
+		state, err := loadState(c.ContinueFrom)
+		if err != nil {
+			return errors.Annotate(err, "load state failed")
+		}
+		c.continueFrom(state)
+		log.Info("continue from the state", zap.String("file", c.ContinueFrom), zap.String("stage", state.Stage),
+			zap.Int64("applied ts", state.AppliedTS), zap.Int64("start ts", c.StartTSO))
+	}
+
+	if err := c.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if c.printEffectiveConfig {
+		if err := config.Print(os.Stdout, c); err != nil {
+			return errors.Trace(err)
+		}
+		os.Exit(0)
+	}
+	return nil
+}
+
+// backupMetadata returns the path of the metadata file of the full backup, it's empty if there's no full backup.
+func (c *Config) backupMetadata() string {
+	dir := c.restoredBackupDir
+	if c.FullBackup != nil {
+		dir = c.FullBackup.Dir
+	}
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, backupMetadataFile)
 }
 
 func (c *Config) adjustDoDBAndTable() {
@@ -174,7 +269,7 @@ func (c *Config) adjustDoDBAndTable() {
 }
 
 func (c *Config) configFromFile(path string) error {
-	return util.StrictDecodeFile(path, "reparo", c)
+	return config.Load(path, "reparo", c)
 }
 
 func (c *Config) validate() error {
@@ -182,14 +277,73 @@ func (c *Config) validate() error {
 		return errors.New("data-dir is empty")
 	}
 
+	if c.ChecksumFile != "" && c.DestType != "mysql" {
+		return errors.New("checksum-file can only be used when dest-type is mysql")
+	}
+
+	if c.FullBackup != nil {
+		if err := c.FullBackup.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+		if c.DestType != "mysql" {
+			return errors.New("full-backup can only be restored when dest-type is mysql")
+		}
+		if c.SourceDB != nil || c.SchemaFile != "" {
+			return errors.New("schema snapshot is unnecessary when full-backup is configured")
+		}
+	}
+
+	if _, err := newRowFilter(c.RowFilters); err != nil {
+		return errors.Trace(err)
+	}
+
+	if c.ReplaySpeed < 0 {
+		return errors.Errorf("invalid replay-speed %v", c.ReplaySpeed)
+	}
+
+	if c.Metrics.Interval < 0 {
+		return errors.Errorf("invalid metrics.interval %d", c.Metrics.Interval)
+	}
+
+	if c.SourceDB != nil {
+		if err := c.SourceDB.Validate(); err != nil {
+			return errors.Annotate(err, "invalid source-db")
+		}
+	}
+
 	switch c.DestType {
 	case "mysql":
 		if c.DestDB == nil {
 			return errors.New("dest-db config must not be empty")
 		}
+		return errors.Trace(c.DestDB.Validate())
+	case "file":
+		if c.DestFile == nil {
+			return errors.New("dest-file config must not be empty")
+		}
+		if err := c.DestFile.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+		if filepath.Clean(c.DestFile.Dir) == filepath.Clean(c.Dir) {
+			return errors.New("dir of dest-file must be different from data-dir")
+		}
 		return nil
 	case "print":
+		if c.DestPrint == nil {
+			return nil
+		}
+		if err := c.DestPrint.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+		if c.DestPrint.Dir != "" && filepath.Clean(c.DestPrint.Dir) == filepath.Clean(c.Dir) {
+			return errors.New("dir of dest-print must be different from data-dir")
+		}
 		return nil
+	case "stats":
+		if c.DestStats == nil {
+			return nil
+		}
+		return errors.Trace(c.DestStats.Validate())
 	case "memory":
 		return nil
 	default:
@@ -22,7 +22,11 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/encrypt"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
 )
 
 type testConfigSuite struct{}
@@ -50,6 +54,61 @@ func (s *testConfigSuite) TestTSORangeParsing(c *check.C) {
 	c.Assert(config.StopTSO, check.Not(check.Equals), 0)
 }
 
+func (s *testConfigSuite) TestValidateDestFile(c *check.C) {
+	config := &Config{Dir: "/tmp/data", DestType: "file"}
+	c.Assert(config.validate(), check.ErrorMatches, "dest-file config must not be empty")
+
+	config.DestFile = &syncer.FileConfig{Dir: "/tmp/data/"}
+	c.Assert(config.validate(), check.ErrorMatches, "dir of dest-file must be different from data-dir")
+
+	config.DestFile.Dir = "/tmp/split"
+	c.Assert(config.validate(), check.IsNil)
+}
+
+func (s *testConfigSuite) TestValidateDestPrint(c *check.C) {
+	config := &Config{Dir: "/tmp/data", DestType: "print"}
+	c.Assert(config.validate(), check.IsNil)
+
+	config.DestPrint = &syncer.PrintConfig{Format: "csv"}
+	c.Assert(config.validate(), check.ErrorMatches, "format csv of dest-print is not supported.*")
+
+	config.DestPrint = &syncer.PrintConfig{Format: syncer.PrintSQL, Dir: "/tmp/data/"}
+	c.Assert(config.validate(), check.ErrorMatches, "dir of dest-print must be different from data-dir")
+
+	config.DestPrint.Dir = "/tmp/print"
+	c.Assert(config.validate(), check.IsNil)
+}
+
+func (s *testConfigSuite) TestValidateDestDBTimeZone(c *check.C) {
+	config := &Config{Dir: "/tmp/data", DestType: "mysql", DestDB: &syncer.DBConfig{TimeZone: "+08"}}
+	c.Assert(config.validate(), check.ErrorMatches, "invalid time-zone.*")
+
+	config.DestDB.TimeZone = "+08:00"
+	config.DestDB.BinlogTimeZone = "Mars/Olympus"
+	c.Assert(config.validate(), check.ErrorMatches, "invalid binlog-time-zone.*")
+
+	config.DestDB.BinlogTimeZone = "UTC"
+	c.Assert(config.validate(), check.IsNil)
+}
+
+func (s *testConfigSuite) TestValidateDestDBEncryption(c *check.C) {
+	encryption := &encrypt.Config{Mode: "decrypt", KeyEnv: "KEY"}
+	config := &Config{Dir: "/tmp/data", DestType: "mysql", DestDB: &syncer.DBConfig{Encryption: encryption}}
+	c.Assert(config.validate(), check.ErrorMatches, "invalid encryption: no column to encrypt")
+
+	encryption.Rules = []encrypt.Rule{{Column: "email"}}
+	c.Assert(config.validate(), check.IsNil)
+}
+
+func (s *testConfigSuite) TestValidateDestDBGroupCommit(c *check.C) {
+	config := &Config{Dir: "/tmp/data", DestType: "mysql", DestDB: &syncer.DBConfig{ApplyConfig: loader.ApplyConfig{GroupCommitSize: -1}}}
+	c.Assert(config.validate(), check.ErrorMatches, "invalid group-commit-size.*")
+
+	config.DestDB.GroupCommitSize = 100
+	config.DestDB.GroupCommitDelay = 10
+	c.Assert(config.validate(), check.IsNil)
+}
+
 func (s *testConfigSuite) TestDateTimeToTSO(c *check.C) {
 	_, err := dateTimeToTSO("123123")
 	c.Assert(err, check.NotNil)
@@ -115,6 +174,31 @@ func (s *testConfigSuite) TestParseConfigFileWithInvalidArgs(c *check.C) {
 	c.Assert(err, check.ErrorMatches, ".*contained unknown configuration options: unrecognized-option-test.*")
 }
 
+func (s *testConfigSuite) TestParseDestDBApplyConfig(c *check.C) {
+	configFilename := path.Join(c.MkDir(), "reparo_apply.toml")
+	err := ioutil.WriteFile(configFilename, []byte(`
+data-dir = "/tmp/reparo"
+dest-type = "mysql"
+[dest-db]
+host = "127.0.0.1"
+port = 3306
+group-commit-size = 100
+affected-rows-check = "alarm"
+[[dest-db.apply-semantics]]
+db-name = "test"
+update = "upsert"
+`), 0644)
+	c.Assert(err, check.IsNil)
+
+	// the keys shared with drainer are decoded into the embedded loader.ApplyConfig
+	cfg := NewConfig()
+	err = cfg.Parse([]string{"--config", configFilename})
+	c.Assert(err, check.IsNil)
+	c.Assert(cfg.DestDB.GroupCommitSize, check.Equals, 100)
+	c.Assert(cfg.DestDB.AffectedRowsCheck, check.Equals, "alarm")
+	c.Assert(cfg.DestDB.ApplySemantics, check.DeepEquals, []loader.TableSemantics{{Schema: "test", Update: loader.UpdateUpsert}})
+}
+
 func getTemplateConfigFilePath() string {
 	// we put the template config file in "cmd/reapro/reparo.toml"
 	_, filename, _, _ := runtime.Caller(0)
@@ -122,3 +206,15 @@ func getTemplateConfigFilePath() string {
 
 	return path
 }
+
+func (s *testConfigSuite) TestValidatePasswordFrom(c *check.C) {
+	from := &secret.Source{Env: "REPARO_PSWD"}
+	config := &Config{Dir: "/tmp/data", DestType: "mysql", DestDB: &syncer.DBConfig{Password: "plaintext", PasswordFrom: from}}
+	c.Assert(config.validate(), check.ErrorMatches, ".*password and password-from can't be both set.*")
+
+	config.DestDB.Password = ""
+	c.Assert(config.validate(), check.IsNil)
+
+	config.SourceDB = &syncer.DBConfig{PasswordFrom: &secret.Source{}}
+	c.Assert(config.validate(), check.ErrorMatches, "invalid source-db.*")
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"fmt"
+)
+
+// Error is the error failing the restoring returned by Start, errors.Cause of it is the cause of the failure.
+// The errors of applying the binlogs to mysql, e.g., the unique key conflicts in downstream, are found by
+// loader.AsDownstreamDuplicate, loader.AsSchemaMismatch and loader.AsRetryExhausted.
+type Error struct {
+	// the stage failed: full-backup, schema-snapshot or replay
+	Stage string
+	// the first binlog not applied, it's the one failed or in the same batch with it, nil if it's unknown
+	FailedEvent *FailedEvent
+	Err         error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("restore %s failed: %v", e.Stage, e.Err)
+}
+
+// Cause implements the causer of errors.Cause
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the error wrapped for errors.Is and errors.As
+func (e *Error) Unwrap() error {
+	return e.Err
+}
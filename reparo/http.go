@@ -0,0 +1,97 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Status is the status of reparo.
+type Status struct {
+	// commit ts of the last binlog read from files
+	ReadTS int64 `json:"read-ts"`
+	// commit ts of the last binlog synced to downstream
+	AppliedTS  int64   `json:"applied-ts"`
+	LagSeconds float64 `json:"lag-seconds"`
+	Paused     bool    `json:"paused"`
+}
+
+// Status returns the status of reparo.
+func (r *Reparo) Status() *Status {
+	status := &Status{
+		ReadTS:    atomic.LoadInt64(&r.readTS),
+		AppliedTS: atomic.LoadInt64(&r.appliedTS),
+		Paused:    r.pauser.IsPaused(),
+	}
+	if status.AppliedTS > 0 {
+		lag := time.Since(oracle.GetTimeFromTS(uint64(status.AppliedTS)))
+		status.LagSeconds = lag.Seconds()
+	}
+
+	return status
+}
+
+// Pause stops syncing binlogs to downstream until Resume is called.
+func (r *Reparo) Pause() {
+	r.pauser.Pause()
+	r.logger.Info("reparo paused")
+}
+
+// Resume resumes syncing binlogs to downstream.
+func (r *Reparo) Resume() {
+	r.pauser.Resume()
+	r.logger.Info("reparo resumed")
+}
+
+// RegisterHTTPHandlers registers the admin APIs of reparo to mux, including
+// `GET /status`, `PUT /pause`, `PUT /resume` and `GET/PUT /log-level`, and the metrics on `GET /metrics`.
+func (r *Reparo) RegisterHTTPHandlers(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/status", r.handleStatus)
+	mux.HandleFunc("/pause", r.handlePause)
+	mux.HandleFunc("/resume", r.handleResume)
+	mux.HandleFunc("/log-level", util.LogLevelHandler)
+}
+
+func (r *Reparo) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", req.Method))
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("get reparo's status success", r.Status()))
+}
+
+func (r *Reparo) handlePause(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", req.Method))
+		return
+	}
+	r.Pause()
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("pause reparo success", nil))
+}
+
+func (r *Reparo) handleResume(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		util.WriteJSON(w, http.StatusMethodNotAllowed, util.ErrResponsef("method %s not allowed", req.Method))
+		return
+	}
+	r.Resume()
+	util.WriteJSON(w, http.StatusOK, util.SuccessResponse("resume reparo success", nil))
+}
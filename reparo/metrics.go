@@ -0,0 +1,149 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"os"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	eventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "event",
+			Help:      "the count of events decoded from files and applied to downstream.",
+		}, []string{"stage", "type"})
+
+	readBytesCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "read_bytes",
+			Help:      "the bytes of binlogs read from files.",
+		})
+
+	currentFileGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "current_file",
+			Help:      "the binlog file being read, the value is 1 for the current file.",
+		}, []string{"file"})
+
+	tsoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "tso",
+			Help:      "the commit ts of the last binlog read from files and applied to downstream.",
+		}, []string{"type"})
+
+	errorCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "error_count",
+			Help:      "the count of errors of reading, filtering and syncing binlogs.",
+		}, []string{"type"})
+
+	queryHistogramVec = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "query_duration_time",
+			Help:      "Bucketed histogram of processing time (s) of a query to sync data to downstream.",
+			Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 18),
+		}, []string{"type"})
+
+	conflictCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "conflict_count",
+			Help:      "the count of deadlock, lock wait timeout and write conflict errors in downstream.",
+		}, []string{"type"})
+
+	driftCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "reparo",
+			Name:      "drift_count",
+			Help:      "the count of updates and deletes not affecting exactly one row in downstream.",
+		}, []string{"type"})
+
+	// the metrics of the loader applying to mysql/tidb, the latency of txns isn't observed as they're restored
+	// long after committed
+	loaderMetrics = &loader.MetricsGroup{
+		QueryHistogramVec:  queryHistogramVec,
+		ConflictCounterVec: conflictCounter,
+		DriftCounterVec:    driftCounter,
+	}
+)
+
+// Registry is the metrics registry of reparo
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	Registry.MustRegister(prometheus.NewGoCollector())
+
+	Registry.MustRegister(eventCounter)
+	Registry.MustRegister(readBytesCounter)
+	Registry.MustRegister(currentFileGauge)
+	Registry.MustRegister(tsoGauge)
+	Registry.MustRegister(errorCounter)
+	Registry.MustRegister(queryHistogramVec)
+	Registry.MustRegister(conflictCounter)
+	Registry.MustRegister(driftCounter)
+}
+
+// countEvents counts the events of the binlog at the stage, a DDL binlog is counted as one event
+func countEvents(stage string, binlog *pb.Binlog) {
+	switch binlog.Tp {
+	case pb.BinlogType_DDL:
+		eventCounter.WithLabelValues(stage, "ddl").Inc()
+	case pb.BinlogType_DML:
+		eventCounter.WithLabelValues(stage, "dml").Add(float64(len(binlog.GetDmlData().GetEvents())))
+	}
+}
+
+// setCurrentFile sets the file being read
+func setCurrentFile(file string) {
+	currentFileGauge.Reset()
+	currentFileGauge.WithLabelValues(file).Set(1)
+}
+
+var getHostname = os.Hostname
+
+// metricsGrouping returns the grouping key of the metrics pushed to Pushgateway, the instance is the task id
+// if it's set, so the restores on the same host are told apart, or the hostname otherwise.
+func metricsGrouping(taskID string) map[string]string {
+	instance := taskID
+	if len(instance) == 0 {
+		hostname, err := getHostname()
+		if err != nil {
+			log.Error("Failed to get hostname", zap.Error(err))
+			hostname = "unknown"
+		}
+		instance = hostname
+	}
+	return map[string]string{"instance": instance}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+var _ = Suite(&testMetricsSuite{})
+
+type testMetricsSuite struct{}
+
+func metricValue(c *C, collector prometheus.Collector) float64 {
+	var metric io_prometheus_client.Metric
+	switch m := collector.(type) {
+	// a gauge implements prometheus.Counter too
+	case prometheus.Gauge:
+		c.Assert(m.Write(&metric), IsNil)
+		return metric.Gauge.GetValue()
+	case prometheus.Counter:
+		c.Assert(m.Write(&metric), IsNil)
+		return metric.Counter.GetValue()
+	}
+	c.Fatalf("unknown metric %T", collector)
+	return 0
+}
+
+func (s *testMetricsSuite) TestProcessMetrics(c *C) {
+	dir := c.MkDir()
+	binlogs := writeBinlogsInDir(dir, c)
+
+	config := NewConfig()
+	err := config.Parse([]string{
+		fmt.Sprintf("-config=%s", getTemplateConfigFilePath()),
+		fmt.Sprintf("-data-dir=%s", dir),
+		"-dest-type=memory",
+	})
+	c.Assert(err, IsNil)
+	repora, err := New(config)
+	c.Assert(err, IsNil)
+
+	// the metrics are shared by the tests
+	decoded := metricValue(c, eventCounter.WithLabelValues("decoded", "ddl"))
+	applied := metricValue(c, eventCounter.WithLabelValues("applied", "ddl"))
+	readBytes := metricValue(c, readBytesCounter)
+
+	c.Assert(repora.Process(), IsNil)
+	c.Assert(repora.Close(), IsNil)
+
+	c.Assert(metricValue(c, eventCounter.WithLabelValues("decoded", "ddl"))-decoded, Equals, float64(len(binlogs)))
+	c.Assert(metricValue(c, eventCounter.WithLabelValues("applied", "ddl"))-applied, Equals, float64(len(binlogs)))
+	c.Assert(metricValue(c, readBytesCounter)-readBytes, Greater, float64(0))
+	c.Assert(metricValue(c, tsoGauge.WithLabelValues("applied")), Equals, float64(binlogs[len(binlogs)-1].CommitTs))
+	lastFile := path.Join(dir, binlogfile.BinlogName(9))
+	c.Assert(metricValue(c, currentFileGauge.WithLabelValues(lastFile)), Equals, float64(1))
+
+	mux := http.NewServeMux()
+	repora.RegisterHTTPHandlers(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `(?s).*binlog_reparo_event\{stage="applied",type="ddl"\}.*`)
+}
+
+func (s *testMetricsSuite) TestMetricsGrouping(c *C) {
+	c.Assert(metricsGrouping("restore-1"), DeepEquals, map[string]string{"instance": "restore-1"})
+
+	orig := getHostname
+	defer func() { getHostname = orig }()
+	getHostname = func() (string, error) { return "host-1", nil }
+	c.Assert(metricsGrouping(""), DeepEquals, map[string]string{"instance": "host-1"})
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// pacer replays the binlogs by the spacing of their commit ts divided by the speed, e.g., to reproduce the write
+// pattern of production against a test cluster. The pace is anchored at the first binlog, and re-anchored at the
+// binlog late for its time, so the spacing is kept instead of bursting to catch up after reparo is paused or
+// downstream falls behind.
+type pacer struct {
+	speed float64
+	// the physical time of the commit ts of the anchored binlog, and the time it's replayed
+	anchorTS   time.Time
+	anchorTime time.Time
+	// make it possible to mock the time
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newPacer returns the pacer of the speed, nil if speed is 0, i.e., replaying as fast as possible
+func newPacer(speed float64) *pacer {
+	if speed <= 0 {
+		return nil
+	}
+	return &pacer{speed: speed, now: time.Now, sleep: sleepContext}
+}
+
+// wait waits until the time to replay the binlog committed at ts, nil pacer returns at once
+func (p *pacer) wait(ctx context.Context, ts int64) error {
+	if p == nil {
+		return nil
+	}
+	commitTime := oracle.GetTimeFromTS(uint64(ts))
+	now := p.now()
+	if p.anchorTime.IsZero() {
+		p.anchorTS, p.anchorTime = commitTime, now
+		return nil
+	}
+
+	due := p.anchorTime.Add(time.Duration(float64(commitTime.Sub(p.anchorTS)) / p.speed))
+	if d := due.Sub(now); d > 0 {
+		return errors.Trace(p.sleep(ctx, d))
+	}
+	if due.Before(now) {
+		p.anchorTS, p.anchorTime = commitTime, now
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type testPaceSuite struct{}
+
+var _ = check.Suite(&testPaceSuite{})
+
+func tsAt(t time.Time) int64 {
+	return int64(oracle.ComposeTS(oracle.GetPhysical(t), 0))
+}
+
+func (s *testPaceSuite) TestWait(c *check.C) {
+	c.Assert(newPacer(0), check.IsNil)
+	var p *pacer
+	c.Assert(p.wait(context.Background(), 42), check.IsNil)
+
+	now := time.Now()
+	var slept []time.Duration
+	p = newPacer(2)
+	p.now = func() time.Time { return now }
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	commit := now.Add(-time.Hour)
+	ctx := context.Background()
+	c.Assert(p.wait(ctx, tsAt(commit)), check.IsNil)
+	// committed 10s after the first one, replayed 5s after it
+	c.Assert(p.wait(ctx, tsAt(commit.Add(10*time.Second))), check.IsNil)
+	c.Assert(slept, check.DeepEquals, []time.Duration{5 * time.Second})
+	// the time spent on replaying is deducted
+	now = now.Add(3 * time.Second)
+	c.Assert(p.wait(ctx, tsAt(commit.Add(20*time.Second))), check.IsNil)
+	c.Assert(slept[1], check.Equals, 2*time.Second)
+
+	// late for a minute, e.g., paused, the spacing is kept from now on instead of catching up
+	now = now.Add(time.Minute)
+	c.Assert(p.wait(ctx, tsAt(commit.Add(22*time.Second))), check.IsNil)
+	c.Assert(slept, check.HasLen, 2)
+	c.Assert(p.wait(ctx, tsAt(commit.Add(24*time.Second))), check.IsNil)
+	c.Assert(slept[2], check.Equals, time.Second)
+}
+
+func (s *testPaceSuite) TestWaitCancelled(c *check.C) {
+	p := newPacer(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	commit := time.Now().Add(-time.Hour)
+	c.Assert(p.wait(ctx, tsAt(commit)), check.IsNil)
+	cancel()
+	err := p.wait(ctx, tsAt(commit.Add(time.Hour)))
+	c.Assert(errors.Cause(err), check.Equals, context.Canceled)
+}
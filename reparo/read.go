@@ -40,9 +40,20 @@ type dirPbReader struct {
 	file   *os.File
 	reader *bufio.Reader
 	idx    int // index of next file to read in files
+	// the offsets of the start and end of the last binlog read in the file
+	start int64
+	end   int64
 }
 
-var _ PbReader = &dirPbReader{}
+var _ binlogReader = &dirPbReader{}
+
+// binlogReader is a PbReader telling the positions of the binlogs read
+type binlogReader interface {
+	PbReader
+	// position returns the position of the binlog, which is the last one read
+	position(binlog *pb.Binlog) *binlogPos
+	close()
+}
 
 // newDirPbReader return a Reader to read binlogs with commit ts in [startTS, endTS]
 func newDirPbReader(dir string, startTS int64, endTS int64) (r *dirPbReader, err error) {
@@ -98,6 +109,8 @@ func (r *dirPbReader) nextFile() (err error) {
 	}
 
 	r.reader = bufio.NewReader(r.file)
+	r.start, r.end = 0, 0
+	setCurrentFile(bfile)
 
 	r.idx++
 
@@ -110,11 +123,15 @@ func (r *dirPbReader) read() (binlog *pb.Binlog, err error) {
 	}
 
 	for {
-		binlog, _, err = Decode(r.reader)
+		var length int64
+		binlog, length, err = Decode(r.reader)
 		if err == nil {
+			r.start, r.end = r.end, r.end+length
+			readBytesCounter.Add(float64(length))
 			if !isAcceptableBinlog(binlog, r.startTS, r.endTS) {
 				continue
 			}
+			countEvents("decoded", binlog)
 
 			return
 		}
@@ -131,3 +148,93 @@ func (r *dirPbReader) read() (binlog *pb.Binlog, err error) {
 		return nil, errors.Annotate(err, "decode failed")
 	}
 }
+
+// position returns the position of the binlog, which is the last one read
+func (r *dirPbReader) position(binlog *pb.Binlog) *binlogPos {
+	pos := &binlogPos{binlog: binlog, start: r.start, end: r.end}
+	if r.idx > 0 {
+		pos.file = r.files[r.idx-1]
+	}
+	return pos
+}
+
+// Source is a stream of the binlogs in the format of the binlog files of drainer, e.g., a file downloaded from
+// the object storage, the sources are read in order as the files of Config.Dir
+type Source struct {
+	// the name of the source, it's the file in the positions of the binlogs
+	Name   string
+	Reader io.Reader
+}
+
+type sourcePbReader struct {
+	sources []Source
+
+	startTS int64
+	endTS   int64
+
+	reader *bufio.Reader
+	idx    int // index of next source to read in sources
+	// the offsets of the start and end of the last binlog read in the source
+	start int64
+	end   int64
+}
+
+var _ binlogReader = &sourcePbReader{}
+
+// newSourcePbReader return a Reader to read binlogs with commit ts in [startTS, endTS] from the sources
+func newSourcePbReader(sources []Source, startTS int64, endTS int64) *sourcePbReader {
+	return &sourcePbReader{sources: sources, startTS: startTS, endTS: endTS}
+}
+
+// close closes the sources read which are io.Closer
+func (r *sourcePbReader) close() {
+	for _, source := range r.sources[:r.idx] {
+		if closer, ok := source.Reader.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+func (r *sourcePbReader) read() (binlog *pb.Binlog, err error) {
+	for {
+		if r.reader == nil {
+			if r.idx >= len(r.sources) {
+				return nil, io.EOF
+			}
+			r.reader = bufio.NewReader(r.sources[r.idx].Reader)
+			r.start, r.end = 0, 0
+			setCurrentFile(r.sources[r.idx].Name)
+			r.idx++
+		}
+
+		var length int64
+		binlog, length, err = Decode(r.reader)
+		if err == nil {
+			r.start, r.end = r.end, r.end+length
+			readBytesCounter.Add(float64(length))
+			if !isAcceptableBinlog(binlog, r.startTS, r.endTS) {
+				continue
+			}
+			countEvents("decoded", binlog)
+
+			return
+		}
+
+		if errors.Cause(err) == io.EOF {
+			log.Info("read source end", zap.String("source", r.sources[r.idx-1].Name))
+			r.reader = nil
+			continue
+		}
+
+		return nil, errors.Annotatef(err, "decode %s failed", r.sources[r.idx-1].Name)
+	}
+}
+
+// position returns the position of the binlog, which is the last one read
+func (r *sourcePbReader) position(binlog *pb.Binlog) *binlogPos {
+	pos := &binlogPos{binlog: binlog, start: r.start, end: r.end}
+	if r.idx > 0 {
+		pos.file = r.sources[r.idx-1].Name
+	}
+	return pos
+}
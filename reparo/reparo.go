@@ -14,84 +14,402 @@
 package reparo
 
 import (
+	"context"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	"github.com/pingcap/tidb-binlog/reparo/syncer"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.uber.org/zap"
 )
 
+// should be only used for unit test to create mock db
+var createDB = loader.CreateDB
+
 // Reparo i the main part of the recovery tool.
 type Reparo struct {
 	cfg    *Config
 	syncer syncer.Syncer
+	// carries the task id if it's configured
+	logger *zap.Logger
 
 	filter *filter.Filter
+	// nil if there's no row filter
+	rowFilter *rowFilter
+
+	pauser util.Pauser
+	// nil if the binlogs are replayed as fast as possible
+	pacer *pacer
+	// commit ts of the last binlog read from files
+	readTS int64
+	// commit ts of the last binlog synced to downstream
+	appliedTS int64
+	// the time the progress is logged, only accessed by the success callback of syncer
+	lastProgressLog time.Time
+
+	// the stage of restoring, see State
+	stage string
+	// the positions of the binlogs synced but not applied yet in order, the last one applied and the last one read
+	posMu      sync.Mutex
+	pending    []*binlogPos
+	appliedPos binlogPos
+	readPos    binlogPos
+
+	// pushes the metrics to Pushgateway, nil if it's not configured
+	metrics *util.MetricClient
+
+	// the binlogs are read from them instead of Config.Dir if they're set
+	sources []Source
+	// the number of the binlogs applied
+	applied    int64
+	onProgress func(Progress)
+}
+
+// Option customizes Reparo embedded as a library
+type Option func(*Reparo)
+
+// WithSources makes Reparo read the binlogs from the sources in order instead of the files in Config.Dir,
+// the sources which are io.Closer are closed after they're read.
+func WithSources(sources ...Source) Option {
+	return func(r *Reparo) {
+		r.sources = sources
+	}
+}
+
+// OnProgress sets the callback called with the progress each time a binlog is applied or the stage changes,
+// it must not block.
+func OnProgress(fn func(Progress)) Option {
+	return func(r *Reparo) {
+		r.onProgress = fn
+	}
+}
+
+// Progress is the progress of restoring reported to the callback set by OnProgress
+type Progress struct {
+	// the stage of restoring: full-backup, schema-snapshot or replay
+	Stage string
+	// commit ts of the last binlog read and the last one applied to downstream
+	ReadTS    int64
+	AppliedTS int64
+	// the number of the binlogs applied, including the ones of the schema snapshot
+	Applied int64
 }
 
+// the interval of logging the progress of restoring
+const progressLogInterval = 10 * time.Second
+
 // New creates a Reparo object.
-func New(cfg *Config) (*Reparo, error) {
-	log.Info("New Reparo", zap.Stringer("config", cfg))
+func New(cfg *Config, opts ...Option) (*Reparo, error) {
+	logger := log.L()
+	if len(cfg.TaskID) > 0 {
+		logger = logger.With(zap.String("task", cfg.TaskID))
+	}
+	logger.Info("New Reparo", zap.Stringer("config", cfg))
+	mask.SetGlobal(mask.New(cfg.Mask))
 
-	syncer, err := syncer.New(cfg.DestType, cfg.DestDB, cfg.WorkerCount, cfg.TxnBatch, cfg.SafeMode)
+	rowFilter, err := newRowFilter(cfg.RowFilters)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if cfg.DestDB != nil {
+		cfg.DestDB.Metrics = loaderMetrics
+	}
+	syncer, err := syncer.New(cfg.DestType, cfg.DestDB, cfg.DestFile, cfg.DestPrint, cfg.DestStats, cfg.WorkerCount, cfg.TxnBatch, cfg.SafeMode, logger)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	filter := filter.NewFilter(cfg.IgnoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
 
-	return &Reparo{
-		cfg:    cfg,
-		syncer: syncer,
-		filter: filter,
-	}, nil
+	r := &Reparo{
+		cfg:       cfg,
+		syncer:    syncer,
+		logger:    logger,
+		filter:    filter,
+		rowFilter: rowFilter,
+		pacer:     newPacer(cfg.ReplaySpeed),
+	}
+	if cfg.Metrics.Addr != "" {
+		r.metrics = util.NewMetricClient(cfg.Metrics.Addr, time.Duration(cfg.Metrics.Interval)*time.Second, Registry)
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
 }
 
-// Process runs the main procedure.
+// Process runs the main procedure, it's Start without cancellation.
 func (r *Reparo) Process() error {
-	pbReader, err := newDirPbReader(r.cfg.Dir, r.cfg.StartTSO, r.cfg.StopTSO)
+	return r.Start(context.Background())
+}
+
+// Start restores until all the binlogs are synced to downstream or ctx is done, the ones synced are all applied
+// after Close returns. The error returned is an *Error telling the stage and the binlog failed.
+func (r *Reparo) Start(ctx context.Context) error {
+	if err := r.start(ctx); err != nil {
+		return &Error{Stage: r.stage, FailedEvent: r.State(nil).FailedEvent, Err: err}
+	}
+	return nil
+}
+
+func (r *Reparo) start(ctx context.Context) error {
+	if r.metrics != nil && r.cfg.Metrics.Interval > 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go r.metrics.Start(ctx, metricsGrouping(r.cfg.TaskID))
+	}
+
+	if r.cfg.FullBackup != nil {
+		r.setStage(StageFullBackup)
+		ts, err := restoreFullBackup(ctx, r.cfg.FullBackup, r.cfg.DestDB, r.cfg.StartTSO, r.logger)
+		if err != nil {
+			return errors.Annotate(err, "restore full backup failed")
+		}
+		// the backup contains all the txns committed before or at ts
+		r.cfg.StartTSO = ts + 1
+	}
+
+	r.setStage(StageSchemaSnapshot)
+	if err := r.applySchemaSnapshot(ctx); err != nil {
+		return errors.Trace(err)
+	}
+
+	r.setStage(StageReplay)
+
+	pbReader, err := r.newReader()
 	if err != nil {
 		return errors.Annotatef(err, "new reader failed dir: %s", r.cfg.Dir)
 	}
 	defer pbReader.close()
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return errors.Trace(err)
+		}
 		binlog, err := pbReader.read()
 		if err != nil {
 			if errors.Cause(err) == io.EOF {
 				return nil
 			}
 
+			errorCounter.WithLabelValues("read").Inc()
 			return errors.Trace(err)
 		}
 
-		ignore, err := filterBinlog(r.filter, binlog)
-		if err != nil {
-			return errors.Annotate(err, "filter binlog failed")
+		if err := r.pacer.wait(ctx, binlog.CommitTs); err != nil {
+			return errors.Trace(err)
 		}
 
-		if ignore {
-			continue
+		pos := pbReader.position(binlog)
+		r.posMu.Lock()
+		r.readPos = *pos
+		r.posMu.Unlock()
+
+		if err := r.syncBinlog(ctx, pos); err != nil {
+			return errors.Trace(err)
 		}
+	}
+}
+
+// newReader returns the reader of the sources if they're set, or the files in Config.Dir otherwise
+func (r *Reparo) newReader() (binlogReader, error) {
+	if len(r.sources) > 0 {
+		return newSourcePbReader(r.sources, r.cfg.StartTSO, r.cfg.StopTSO), nil
+	}
+	return newDirPbReader(r.cfg.Dir, r.cfg.StartTSO, r.cfg.StopTSO)
+}
+
+// setStage sets the stage of restoring and reports the progress
+func (r *Reparo) setStage(stage string) {
+	r.posMu.Lock()
+	r.stage = stage
+	r.posMu.Unlock()
+	r.reportProgress()
+}
+
+func (r *Reparo) reportProgress() {
+	if r.onProgress == nil {
+		return
+	}
+	r.posMu.Lock()
+	stage := r.stage
+	r.posMu.Unlock()
+	r.onProgress(Progress{
+		Stage:     stage,
+		ReadTS:    atomic.LoadInt64(&r.readTS),
+		AppliedTS: atomic.LoadInt64(&r.appliedTS),
+		Applied:   atomic.LoadInt64(&r.applied),
+	})
+}
 
-		err = r.syncer.Sync(binlog, func(binlog *pb.Binlog) {
-			dt := oracle.GetTimeFromTS(uint64(binlog.CommitTs))
-			log.Info("sync binlog success", zap.Int64("ts", binlog.CommitTs), zap.Time("datetime", dt))
-		})
+func (r *Reparo) syncBinlog(ctx context.Context, pos *binlogPos) error {
+	binlog := pos.binlog
 
+	ignore, err := filterBinlog(r.filter, binlog)
+	if err != nil {
+		errorCounter.WithLabelValues("filter").Inc()
+		return errors.Annotate(err, "filter binlog failed")
+	}
+	if !ignore {
+		if ignore, err = r.rowFilter.filter(binlog); err != nil {
+			errorCounter.WithLabelValues("filter").Inc()
+			return errors.Annotate(err, "filter rows failed")
+		}
+	}
+
+	if ignore {
+		return nil
+	}
+
+	if err := r.pauser.Wait(ctx); err != nil {
+		return errors.Trace(err)
+	}
+
+	atomic.StoreInt64(&r.readTS, binlog.CommitTs)
+	tsoGauge.WithLabelValues("read").Set(float64(binlog.CommitTs))
+	r.posMu.Lock()
+	r.pending = append(r.pending, pos)
+	r.posMu.Unlock()
+
+	err = r.syncer.Sync(binlog, func(binlog *pb.Binlog) {
+		atomic.StoreInt64(&r.appliedTS, binlog.CommitTs)
+		tsoGauge.WithLabelValues("applied").Set(float64(binlog.CommitTs))
+		countEvents("applied", binlog)
+		// the binlogs are applied in the order they're synced
+		r.posMu.Lock()
+		r.appliedPos = *r.pending[0]
+		r.pending[0] = nil
+		r.pending = r.pending[1:]
+		r.posMu.Unlock()
+		atomic.AddInt64(&r.applied, 1)
+		r.reportProgress()
+
+		dt := oracle.GetTimeFromTS(uint64(binlog.CommitTs))
+		// logging each binlog slows down restoring the small txns, so only the progress is logged periodically
+		if time.Since(r.lastProgressLog) < progressLogInterval {
+			r.logger.Debug("sync binlog success", zap.Int64("ts", binlog.CommitTs), zap.Time("datetime", dt))
+			return
+		}
+		r.lastProgressLog = time.Now()
+		r.logger.Info("sync binlog success", zap.Int64("ts", binlog.CommitTs), zap.Time("datetime", dt))
+	})
+	if err != nil {
+		errorCounter.WithLabelValues("sync").Inc()
+	}
+
+	return errors.Annotate(err, "sync failed")
+}
+
+// applySchemaSnapshot creates the databases and tables in downstream before replaying binlogs,
+// the schema is exported from source-db at start-tso if source-db is configured,
+// or loaded from schema-file otherwise.
+func (r *Reparo) applySchemaSnapshot(ctx context.Context) error {
+	var snapshot *schemaSnapshot
+	switch {
+	case r.cfg.SourceDB != nil:
+		password, err := r.cfg.SourceDB.GetPassword()
 		if err != nil {
-			return errors.Annotate(err, "sync failed")
+			return errors.Trace(err)
+		}
+		db, err := createDB(r.cfg.SourceDB.User, password, r.cfg.SourceDB.Host, r.cfg.SourceDB.Port)
+		if err != nil {
+			return errors.Trace(err)
 		}
+		defer db.Close()
+
+		snapshot, err = exportSchemaSnapshot(db, r.cfg.StartTSO, r.filter, r.logger)
+		if err != nil {
+			return errors.Annotate(err, "export schema snapshot failed")
+		}
+		if r.cfg.SchemaFile != "" {
+			if err = snapshot.save(r.cfg.SchemaFile); err != nil {
+				return errors.Annotatef(err, "save schema snapshot to %s failed", r.cfg.SchemaFile)
+			}
+		}
+	case r.cfg.SchemaFile != "":
+		var err error
+		snapshot, err = loadSchemaSnapshot(r.cfg.SchemaFile)
+		if err != nil {
+			return errors.Annotatef(err, "load schema snapshot from %s failed", r.cfg.SchemaFile)
+		}
+	default:
+		return nil
+	}
+
+	for _, binlog := range snapshot.binlogs() {
+		if err := r.syncBinlog(ctx, &binlogPos{binlog: binlog}); err != nil {
+			return errors.Annotate(err, "apply schema snapshot failed")
+		}
+	}
+	r.logger.Info("apply schema snapshot success", zap.Int64("ts", snapshot.ts))
+
+	return nil
+}
+
+// expectedChecksums returns the checksums in checksum-file if it's set,
+// otherwise the ones recorded in the metadata of the full backup.
+func (r *Reparo) expectedChecksums() ([]TableChecksum, error) {
+	if r.cfg.ChecksumFile != "" {
+		checksums, err := loadChecksums(r.cfg.ChecksumFile)
+		return checksums, errors.Annotatef(err, "load checksums from %s failed", r.cfg.ChecksumFile)
+	}
+
+	metadata := r.cfg.backupMetadata()
+	if metadata == "" {
+		return nil, nil
+	}
+	checksums, err := readMetadataChecksums(metadata)
+	return checksums, errors.Annotatef(err, "read checksums from %s failed", metadata)
+}
+
+// Verify checks the checksums of the restored tables against the ones recorded in checksum-file or the metadata
+// of the full backup, it should be called after all the binlogs are synced, i.e. after Close.
+func (r *Reparo) Verify() error {
+	expected, err := r.expectedChecksums()
+	if err != nil {
+		return errors.Trace(err)
 	}
+	if len(expected) == 0 {
+		return nil
+	}
+
+	password, err := r.cfg.DestDB.GetPassword()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	db, err := createDB(r.cfg.DestDB.User, password, r.cfg.DestDB.Host, r.cfg.DestDB.Port)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	if err = verifyChecksums(db, expected, r.logger); err != nil {
+		return errors.Trace(err)
+	}
+	r.logger.Info("verify checksums success", zap.Int("tables", len(expected)))
+
+	return nil
 }
 
-// Close closes the Reparo object.
+// Close closes the Reparo object, the final metrics are pushed after the syncer is closed,
+// i.e., all the binlogs synced are applied.
 func (r *Reparo) Close() error {
-	return errors.Trace(r.syncer.Close())
+	err := r.syncer.Close()
+	if r.metrics != nil {
+		if pushErr := r.metrics.Push(metricsGrouping(r.cfg.TaskID)); pushErr != nil {
+			r.logger.Error("push metrics to Prometheus Pushgateway failed", zap.Error(pushErr))
+		}
+	}
+	return errors.Trace(err)
 }
 
 // may drop some DML event of binlog
@@ -14,11 +14,20 @@
 package reparo
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	"github.com/pingcap/tidb-binlog/reparo/syncer"
@@ -171,4 +180,168 @@ func (s *testReparoSuite) TestProcess(c *C) {
 
 	memSyncer := repora.syncer.(*syncer.MemSyncer)
 	c.Assert(memSyncer.GetBinlogs(), DeepEquals, binlogs)
+
+	status := repora.Status()
+	c.Assert(status.ReadTS, Equals, binlogs[len(binlogs)-1].CommitTs)
+	c.Assert(status.AppliedTS, Equals, binlogs[len(binlogs)-1].CommitTs)
+}
+
+func (s *testReparoSuite) TestPauseByHTTP(c *C) {
+	config := NewConfig()
+	dir := c.MkDir()
+	binlogs := writeBinlogsInDir(dir, c)
+
+	err := config.Parse([]string{
+		fmt.Sprintf("-config=%s", getTemplateConfigFilePath()),
+		fmt.Sprintf("-data-dir=%s", dir),
+		"-dest-type=memory",
+	})
+	c.Assert(err, IsNil)
+
+	repora, err := New(config)
+	c.Assert(err, IsNil)
+	mux := http.NewServeMux()
+	repora.RegisterHTTPHandlers(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/pause", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(repora.Status().Paused, IsTrue)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- repora.Process()
+	}()
+
+	select {
+	case <-errCh:
+		c.Fatal("should not finish when paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Assert(atomic.LoadInt64(&repora.appliedTS), Equals, int64(0))
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/resume", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(<-errCh, IsNil)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var resp struct {
+		Data Status `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+	c.Assert(resp.Data.AppliedTS, Equals, binlogs[len(binlogs)-1].CommitTs)
+	c.Assert(resp.Data.Paused, IsFalse)
+}
+
+// closeBuffer is a source closed after it's read
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (s *testReparoSuite) TestStartWithSources(c *C) {
+	var binlogs []*pb.Binlog
+	sources := make([]Source, 2)
+	buffers := make([]*closeBuffer, 2)
+	for i := range sources {
+		buffers[i] = new(closeBuffer)
+		for j := 0; j < 3; j++ {
+			binlog := &pb.Binlog{CommitTs: int64(len(binlogs) + 1), Tp: pb.BinlogType_DDL, DdlQuery: []byte("create database test")}
+			data, err := binlog.Marshal()
+			c.Assert(err, IsNil)
+			buffers[i].Write(binlogfile.Encode(data))
+			binlogs = append(binlogs, binlog)
+		}
+		sources[i] = Source{Name: fmt.Sprintf("source-%d", i), Reader: buffers[i]}
+	}
+
+	config := NewConfig()
+	err := config.Parse([]string{
+		fmt.Sprintf("-config=%s", getTemplateConfigFilePath()),
+		fmt.Sprintf("-data-dir=%s", c.MkDir()),
+		"-dest-type=memory",
+	})
+	c.Assert(err, IsNil)
+
+	var progresses []Progress
+	repora, err := New(config, WithSources(sources...), OnProgress(func(p Progress) {
+		progresses = append(progresses, p)
+	}))
+	c.Assert(err, IsNil)
+	c.Assert(repora.Start(context.Background()), IsNil)
+	c.Assert(repora.Close(), IsNil)
+
+	memSyncer := repora.syncer.(*syncer.MemSyncer)
+	c.Assert(memSyncer.GetBinlogs(), DeepEquals, binlogs)
+	c.Assert(buffers[0].closed, IsTrue)
+	c.Assert(buffers[1].closed, IsTrue)
+
+	c.Assert(progresses[0], DeepEquals, Progress{Stage: StageSchemaSnapshot})
+	c.Assert(progresses[len(progresses)-1], DeepEquals, Progress{Stage: StageReplay, ReadTS: 6, AppliedTS: 6, Applied: 6})
+
+	state := repora.State(nil)
+	c.Assert(state.AppliedFile, Equals, "source-1")
+}
+
+func (s *testReparoSuite) TestStartCancelled(c *C) {
+	config := NewConfig()
+	dir := c.MkDir()
+	writeBinlogsInDir(dir, c)
+	err := config.Parse([]string{
+		fmt.Sprintf("-config=%s", getTemplateConfigFilePath()),
+		fmt.Sprintf("-data-dir=%s", dir),
+		"-dest-type=memory",
+	})
+	c.Assert(err, IsNil)
+
+	repora, err := New(config)
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = repora.Start(ctx)
+	c.Assert(errors.Cause(err), Equals, context.Canceled)
+	restoreErr, ok := err.(*Error)
+	c.Assert(ok, IsTrue)
+	c.Assert(restoreErr.Stage, Equals, StageReplay)
+	c.Assert(repora.Close(), IsNil)
+}
+
+func (s *testReparoSuite) TestCancelWhilePaused(c *C) {
+	config := NewConfig()
+	dir := c.MkDir()
+	writeBinlogsInDir(dir, c)
+	err := config.Parse([]string{
+		fmt.Sprintf("-config=%s", getTemplateConfigFilePath()),
+		fmt.Sprintf("-data-dir=%s", dir),
+		"-dest-type=memory",
+	})
+	c.Assert(err, IsNil)
+
+	repora, err := New(config)
+	c.Assert(err, IsNil)
+	repora.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- repora.Start(ctx)
+	}()
+	cancel()
+	select {
+	case err = <-errCh:
+		c.Assert(errors.Cause(err), Equals, context.Canceled)
+	case <-time.After(time.Second):
+		c.Fatal("should finish when cancelled")
+	}
+	c.Assert(repora.Close(), IsNil)
+	c.Assert(atomic.LoadInt64(&repora.appliedTS), Equals, int64(0))
 }
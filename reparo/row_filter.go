@@ -0,0 +1,387 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/opcode"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// RowFilterConfig restores only the rows of the table matching Where, e.g., `tenant_id = 42` or
+// `id BETWEEN 1000 AND 2000`. The expression supports the columns, the literals, the comparisons, IN, BETWEEN,
+// IS NULL, AND, OR, NOT and the parentheses, and it's evaluated by the three-valued logic of SQL, so the rows it's
+// NULL for are skipped.
+type RowFilterConfig struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Where  string `toml:"where" json:"where"`
+}
+
+// rowFilter drops the DML events of the rows not matching the row filter of their tables. An update of a row
+// moving into the matched rows is restored as an insert of the new row, and the one moving out as a delete of the
+// old row, so the restored rows are always the matched ones.
+type rowFilter struct {
+	// keyed by the lower-case quoted table names
+	wheres map[string]ast.ExprNode
+	sc     *stmtctx.StatementContext
+}
+
+// newRowFilter returns nil if there's no row filter
+func newRowFilter(cfgs []RowFilterConfig) (*rowFilter, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	f := &rowFilter{wheres: make(map[string]ast.ExprNode, len(cfgs)), sc: new(stmtctx.StatementContext)}
+	for _, cfg := range cfgs {
+		name := rowFilterKey(cfg.Schema, cfg.Table)
+		if len(cfg.Schema) == 0 || len(cfg.Table) == 0 {
+			return nil, errors.Errorf("invalid row-filter of %s, db-name and tbl-name must be set", name)
+		}
+		if _, ok := f.wheres[name]; ok {
+			return nil, errors.Errorf("duplicate row-filter of %s", name)
+		}
+		stmt, err := parser.New().ParseOneStmt("SELECT 1 FROM t WHERE "+cfg.Where, "", "")
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid where of row-filter of %s", name)
+		}
+		where := stmt.(*ast.SelectStmt).Where
+		if where == nil {
+			return nil, errors.Errorf("the where of row-filter of %s is empty", name)
+		}
+		// checks all the expressions are supported, any column is NULL
+		if _, err = f.eval(where, func(string) (types.Datum, bool) { return types.Datum{}, true }); err != nil {
+			return nil, errors.Annotatef(err, "invalid where of row-filter of %s", name)
+		}
+		f.wheres[name] = where
+	}
+	return f, nil
+}
+
+func rowFilterKey(schema string, table string) string {
+	return strings.ToLower(fmt.Sprintf("`%s`.`%s`", schema, table))
+}
+
+// filter drops the DML events of binlog not matching, ignore is true if none of them is left
+func (f *rowFilter) filter(binlog *pb.Binlog) (ignore bool, err error) {
+	if f == nil || binlog.Tp != pb.BinlogType_DML {
+		return false, nil
+	}
+	events := binlog.DmlData.Events[:0]
+	for i := range binlog.DmlData.Events {
+		event := &binlog.DmlData.Events[i]
+		keep, err := f.filterEvent(event)
+		if err != nil {
+			return false, errors.Annotatef(err, "filter the row of %s", rowFilterKey(event.GetSchemaName(), event.GetTableName()))
+		}
+		if keep {
+			events = append(events, *event)
+		}
+	}
+	binlog.DmlData.Events = events
+	return len(events) == 0, nil
+}
+
+// filterEvent returns whether the event is kept, the update moving across the matched rows is changed into an
+// insert or a delete
+func (f *rowFilter) filterEvent(event *pb.Event) (bool, error) {
+	where, ok := f.wheres[rowFilterKey(event.GetSchemaName(), event.GetTableName())]
+	if !ok {
+		return true, nil
+	}
+
+	cols := make([]*pb.Column, 0, len(event.Row))
+	for _, data := range event.Row {
+		col := new(pb.Column)
+		if err := col.Unmarshal(data); err != nil {
+			return false, errors.Trace(err)
+		}
+		cols = append(cols, col)
+	}
+
+	oldMatched, err := f.match(where, cols, func(col *pb.Column) []byte { return col.Value })
+	if err != nil || event.GetTp() != pb.EventType_Update {
+		return oldMatched, errors.Trace(err)
+	}
+	newMatched, err := f.match(where, cols, func(col *pb.Column) []byte { return col.ChangedValue })
+	if err != nil || oldMatched == newMatched {
+		return oldMatched, errors.Trace(err)
+	}
+
+	// an update moving the row into the matched ones is an insert of the new row, and moving out is a delete
+	tp := pb.EventType_Delete
+	if newMatched {
+		tp = pb.EventType_Insert
+	}
+	row := make([][]byte, 0, len(cols))
+	for _, col := range cols {
+		if newMatched {
+			col.Value = col.ChangedValue
+		}
+		col.ChangedValue = nil
+		data, err := col.Marshal()
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		row = append(row, data)
+	}
+	event.Tp = tp
+	event.Row = row
+	return true, nil
+}
+
+// match evaluates where by the values of the columns returned by value
+func (f *rowFilter) match(where ast.ExprNode, cols []*pb.Column, value func(*pb.Column) []byte) (bool, error) {
+	row := make(map[string]types.Datum, len(cols))
+	for _, col := range cols {
+		d, err := columnDatum(value(col), col.Tp[0])
+		if err != nil {
+			return false, errors.Annotatef(err, "decode column %s", col.Name)
+		}
+		row[strings.ToLower(col.Name)] = d
+	}
+	res, err := f.eval(where, func(name string) (types.Datum, bool) {
+		d, ok := row[strings.ToLower(name)]
+		return d, ok
+	})
+	if err != nil || res.IsNull() {
+		return false, errors.Trace(err)
+	}
+	b, err := res.ToBool(f.sc)
+	return b == 1, errors.Trace(err)
+}
+
+// columnDatum decodes the value of a column, the strings and the temporal types are compared as strings
+func columnDatum(value []byte, tp byte) (types.Datum, error) {
+	_, d, err := codec.DecodeOne(value)
+	if err != nil || d.IsNull() {
+		return d, errors.Trace(err)
+	}
+	switch tp {
+	case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeNewDate, mysql.TypeTimestamp, mysql.TypeDuration,
+		mysql.TypeVarchar, mysql.TypeVarString, mysql.TypeString, mysql.TypeJSON:
+		return types.NewStringDatum(fmt.Sprintf("%s", d.GetValue())), nil
+	}
+	return d, nil
+}
+
+func boolDatum(b bool) types.Datum {
+	if b {
+		return types.NewIntDatum(1)
+	}
+	return types.NewIntDatum(0)
+}
+
+// eval evaluates expr by the three-valued logic of SQL, the boolean results are 1, 0 or NULL. Both sides of AND
+// and OR are evaluated, so all the expressions are checked when the row filter is created.
+func (f *rowFilter) eval(expr ast.ExprNode, column func(name string) (types.Datum, bool)) (types.Datum, error) {
+	switch e := expr.(type) {
+	case ast.ValueExpr:
+		return types.NewDatum(e.GetValue()), nil
+	case *ast.ColumnNameExpr:
+		d, ok := column(e.Name.Name.O)
+		if !ok {
+			return d, errors.Errorf("column %s doesn't exist", e.Name.Name.O)
+		}
+		return d, nil
+	case *ast.ParenthesesExpr:
+		return f.eval(e.Expr, column)
+	case *ast.UnaryOperationExpr:
+		v, err := f.eval(e.V, column)
+		if err != nil {
+			return v, errors.Trace(err)
+		}
+		if e.Op != opcode.Not && e.Op != opcode.Plus && e.Op != opcode.Minus {
+			return v, errors.Errorf("unsupported operator %s", e.Op)
+		}
+		if v.IsNull() {
+			return v, nil
+		}
+		switch e.Op {
+		case opcode.Not:
+			b, err := v.ToBool(f.sc)
+			return boolDatum(b == 0), errors.Trace(err)
+		case opcode.Plus:
+			return v, nil
+		default:
+			return negate(v)
+		}
+	case *ast.BinaryOperationExpr:
+		l, err := f.eval(e.L, column)
+		if err != nil {
+			return l, errors.Trace(err)
+		}
+		r, err := f.eval(e.R, column)
+		if err != nil {
+			return r, errors.Trace(err)
+		}
+		return f.binaryOp(e.Op, l, r)
+	case *ast.IsNullExpr:
+		v, err := f.eval(e.Expr, column)
+		return boolDatum(v.IsNull() != e.Not), errors.Trace(err)
+	case *ast.BetweenExpr:
+		v, err := f.eval(e.Expr, column)
+		if err != nil {
+			return v, errors.Trace(err)
+		}
+		left, err := f.eval(e.Left, column)
+		if err != nil {
+			return left, errors.Trace(err)
+		}
+		right, err := f.eval(e.Right, column)
+		if err != nil {
+			return right, errors.Trace(err)
+		}
+		ge, err := f.binaryOp(opcode.GE, v, left)
+		if err != nil {
+			return ge, errors.Trace(err)
+		}
+		le, err := f.binaryOp(opcode.LE, v, right)
+		if err != nil {
+			return le, errors.Trace(err)
+		}
+		res, err := f.binaryOp(opcode.LogicAnd, ge, le)
+		if err != nil || !e.Not || res.IsNull() {
+			return res, errors.Trace(err)
+		}
+		return boolDatum(res.GetInt64() == 0), nil
+	case *ast.PatternInExpr:
+		if e.Sel != nil {
+			return types.Datum{}, errors.New("unsupported subquery")
+		}
+		v, err := f.eval(e.Expr, column)
+		if err != nil {
+			return v, errors.Trace(err)
+		}
+		// NULL if it's not found and there's NULL in the list
+		res := boolDatum(false)
+		for _, item := range e.List {
+			d, err := f.eval(item, column)
+			if err != nil {
+				return d, errors.Trace(err)
+			}
+			eq, err := f.binaryOp(opcode.EQ, v, d)
+			if err != nil {
+				return eq, errors.Trace(err)
+			}
+			if eq.IsNull() {
+				res = types.Datum{}
+			} else if eq.GetInt64() == 1 {
+				res = eq
+				break
+			}
+		}
+		if !e.Not || res.IsNull() {
+			return res, nil
+		}
+		return boolDatum(res.GetInt64() == 0), nil
+	}
+	return types.Datum{}, errors.Errorf("unsupported expression %T", expr)
+}
+
+func (f *rowFilter) binaryOp(op opcode.Op, l types.Datum, r types.Datum) (types.Datum, error) {
+	switch op {
+	case opcode.LogicAnd, opcode.LogicOr:
+		lb, err := nullableBool(f.sc, l)
+		if err != nil {
+			return types.Datum{}, errors.Trace(err)
+		}
+		rb, err := nullableBool(f.sc, r)
+		if err != nil {
+			return types.Datum{}, errors.Trace(err)
+		}
+		// the result decided by one side regardless of the other being NULL
+		decisive := op == opcode.LogicOr
+		if (lb != nil && *lb == decisive) || (rb != nil && *rb == decisive) {
+			return boolDatum(decisive), nil
+		}
+		if lb == nil || rb == nil {
+			return types.Datum{}, nil
+		}
+		return boolDatum(!decisive), nil
+	case opcode.NullEQ:
+		if l.IsNull() || r.IsNull() {
+			return boolDatum(l.IsNull() && r.IsNull()), nil
+		}
+		op = opcode.EQ
+	}
+
+	if l.IsNull() || r.IsNull() {
+		switch op {
+		case opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE:
+			return types.Datum{}, nil
+		}
+	}
+	var cmp int
+	var err error
+	if !l.IsNull() && !r.IsNull() {
+		if cmp, err = l.CompareDatum(f.sc, &r); err != nil {
+			return types.Datum{}, errors.Trace(err)
+		}
+	}
+	switch op {
+	case opcode.EQ:
+		return boolDatum(cmp == 0), nil
+	case opcode.NE:
+		return boolDatum(cmp != 0), nil
+	case opcode.LT:
+		return boolDatum(cmp < 0), nil
+	case opcode.LE:
+		return boolDatum(cmp <= 0), nil
+	case opcode.GT:
+		return boolDatum(cmp > 0), nil
+	case opcode.GE:
+		return boolDatum(cmp >= 0), nil
+	}
+	return types.Datum{}, errors.Errorf("unsupported operator %s", op)
+}
+
+// nullableBool returns nil if d is NULL
+func nullableBool(sc *stmtctx.StatementContext, d types.Datum) (*bool, error) {
+	if d.IsNull() {
+		return nil, nil
+	}
+	i, err := d.ToBool(sc)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	b := i == 1
+	return &b, nil
+}
+
+// negate returns -d of the numeric literal
+func negate(d types.Datum) (types.Datum, error) {
+	switch d.Kind() {
+	case types.KindInt64:
+		return types.NewIntDatum(-d.GetInt64()), nil
+	case types.KindUint64:
+		return types.NewIntDatum(-int64(d.GetUint64())), nil
+	case types.KindFloat32, types.KindFloat64:
+		return types.NewFloat64Datum(-d.GetFloat64()), nil
+	case types.KindMysqlDecimal:
+		res := new(types.MyDecimal)
+		err := types.DecimalSub(new(types.MyDecimal), d.GetMysqlDecimal(), res)
+		return types.NewDecimalDatum(res), errors.Trace(err)
+	}
+	return d, errors.Errorf("can't negate %v", d.GetValue())
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"strings"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+type testRowFilterSuite struct{}
+
+var _ = check.Suite(&testRowFilterSuite{})
+
+func encodeDatum(c *check.C, v interface{}) []byte {
+	data, err := codec.EncodeValue(nil, nil, types.NewDatum(v))
+	c.Assert(err, check.IsNil)
+	return data
+}
+
+// orderEvent returns the event of a row of test.orders, changed is the new tenant_id of an update
+func orderEvent(c *check.C, tp pb.EventType, id int64, tenantID interface{}, changed interface{}) pb.Event {
+	cols := []*pb.Column{
+		{Name: "id", Tp: []byte{mysql.TypeLonglong}, Value: encodeDatum(c, id)},
+		{Name: "tenant_id", Tp: []byte{mysql.TypeLong}, Value: encodeDatum(c, tenantID)},
+		{Name: "note", Tp: []byte{mysql.TypeVarchar}, Value: encodeDatum(c, []byte("n"))},
+	}
+	if tp == pb.EventType_Update {
+		cols[0].ChangedValue = cols[0].Value
+		cols[1].ChangedValue = encodeDatum(c, changed)
+		cols[2].ChangedValue = cols[2].Value
+	}
+	schema, table := "test", "orders"
+	event := pb.Event{SchemaName: &schema, TableName: &table, Tp: tp}
+	for _, col := range cols {
+		data, err := col.Marshal()
+		c.Assert(err, check.IsNil)
+		event.Row = append(event.Row, data)
+	}
+	return event
+}
+
+func (s *testRowFilterSuite) TestNewRowFilter(c *check.C) {
+	f, err := newRowFilter(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(f, check.IsNil)
+
+	_, err = newRowFilter([]RowFilterConfig{{Schema: "test", Where: "id = 1"}})
+	c.Assert(err, check.ErrorMatches, "invalid row-filter of `test`.``.*")
+	_, err = newRowFilter([]RowFilterConfig{{Schema: "test", Table: "t", Where: "id = "}})
+	c.Assert(err, check.ErrorMatches, "invalid where of row-filter of `test`.`t`.*")
+	_, err = newRowFilter([]RowFilterConfig{{Schema: "test", Table: "t", Where: "name LIKE 'a%'"}})
+	c.Assert(err, check.ErrorMatches, ".*unsupported expression.*")
+	_, err = newRowFilter([]RowFilterConfig{{Schema: "test", Table: "t", Where: "id + 1 = 2"}})
+	c.Assert(err, check.ErrorMatches, ".*unsupported operator.*")
+	_, err = newRowFilter([]RowFilterConfig{{Schema: "test", Table: "t", Where: "id = 1"}, {Schema: "Test", Table: "T", Where: "id = 2"}})
+	c.Assert(err, check.ErrorMatches, "duplicate row-filter of `test`.`t`")
+}
+
+func (s *testRowFilterSuite) TestEval(c *check.C) {
+	row := map[string]types.Datum{
+		"id":        types.NewIntDatum(42),
+		"tenant_id": types.NewIntDatum(7),
+		"name":      types.NewStringDatum("alice"),
+		"deleted":   {},
+	}
+	cases := map[string]bool{
+		"tenant_id = 7":                              true,
+		"tenant_id <> 7":                             false,
+		"id BETWEEN 40 AND 50":                       true,
+		"id NOT BETWEEN 40 AND 50":                   false,
+		"id >= 43 OR name = 'alice'":                 true,
+		"tenant_id IN (1, 7) AND NOT (id < 0)":       true,
+		"tenant_id NOT IN (1, NULL)":                 false,
+		"deleted IS NULL AND name IS NOT NULL":       true,
+		"deleted = 1":                                false,
+		"deleted = 1 OR tenant_id = 7":               true,
+		"NOT (deleted = 1)":                          false,
+		"deleted <=> NULL":                           true,
+		"id > -1 AND id < 42.5":                      true,
+		"(tenant_id = 7 AND id = 1) OR name = 'bob'": false,
+		"TENANT_ID = 7":                              true,
+	}
+	for where, expected := range cases {
+		f, err := newRowFilter([]RowFilterConfig{{Schema: "test", Table: "t", Where: where}})
+		c.Assert(err, check.IsNil, check.Commentf("where: %s", where))
+		res, err := f.eval(f.wheres["`test`.`t`"], func(name string) (types.Datum, bool) {
+			d, ok := row[strings.ToLower(name)]
+			return d, ok
+		})
+		c.Assert(err, check.IsNil, check.Commentf("where: %s", where))
+		matched := !res.IsNull() && res.GetInt64() == 1
+		c.Assert(matched, check.Equals, expected, check.Commentf("where: %s", where))
+	}
+}
+
+func (s *testRowFilterSuite) TestFilter(c *check.C) {
+	f, err := newRowFilter([]RowFilterConfig{{Schema: "test", Table: "orders", Where: "tenant_id = 42"}})
+	c.Assert(err, check.IsNil)
+
+	other := orderEvent(c, pb.EventType_Insert, 1, int64(7), nil)
+	schema, table := "test", "users"
+	other.SchemaName, other.TableName = &schema, &table
+	binlog := &pb.Binlog{Tp: pb.BinlogType_DML, DmlData: &pb.DMLData{Events: []pb.Event{
+		orderEvent(c, pb.EventType_Insert, 1, int64(42), nil),
+		orderEvent(c, pb.EventType_Insert, 2, int64(7), nil),
+		orderEvent(c, pb.EventType_Delete, 3, nil, nil),
+		orderEvent(c, pb.EventType_Update, 4, int64(42), int64(42)),
+		orderEvent(c, pb.EventType_Update, 5, int64(7), int64(42)),
+		orderEvent(c, pb.EventType_Update, 6, int64(42), int64(7)),
+		orderEvent(c, pb.EventType_Update, 7, int64(7), int64(8)),
+		other,
+	}}}
+	ignore, err := f.filter(binlog)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+
+	events := binlog.DmlData.Events
+	c.Assert(events, check.HasLen, 5)
+	c.Assert(events[0], check.DeepEquals, orderEvent(c, pb.EventType_Insert, 1, int64(42), nil))
+	c.Assert(events[1], check.DeepEquals, orderEvent(c, pb.EventType_Update, 4, int64(42), int64(42)))
+	// moved into tenant 42, inserted
+	c.Assert(events[2], check.DeepEquals, orderEvent(c, pb.EventType_Insert, 5, int64(42), nil))
+	// moved out of tenant 42, deleted
+	c.Assert(events[3], check.DeepEquals, orderEvent(c, pb.EventType_Delete, 6, int64(42), nil))
+	c.Assert(events[4], check.DeepEquals, other)
+
+	binlog = &pb.Binlog{Tp: pb.BinlogType_DML, DmlData: &pb.DMLData{Events: []pb.Event{
+		orderEvent(c, pb.EventType_Insert, 2, int64(7), nil),
+	}}}
+	ignore, err = f.filter(binlog)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsTrue)
+
+	// the DDLs are restored as usual
+	ignore, err = f.filter(&pb.Binlog{Tp: pb.BinlogType_DDL, DdlQuery: []byte("create table test.orders(id int)")})
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+}
+
+func (s *testRowFilterSuite) TestUnknownColumn(c *check.C) {
+	f, err := newRowFilter([]RowFilterConfig{{Schema: "test", Table: "orders", Where: "tenant = 42"}})
+	c.Assert(err, check.IsNil)
+	binlog := &pb.Binlog{Tp: pb.BinlogType_DML, DmlData: &pb.DMLData{Events: []pb.Event{
+		orderEvent(c, pb.EventType_Insert, 1, int64(42), nil),
+	}}}
+	_, err = f.filter(binlog)
+	c.Assert(err, check.ErrorMatches, "filter the row of `test`.`orders`: column tenant doesn't exist")
+}
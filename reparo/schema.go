@@ -0,0 +1,277 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"go.uber.org/zap"
+)
+
+var systemSchemas = map[string]struct{}{
+	"information_schema": {},
+	"performance_schema": {},
+	"metrics_schema":     {},
+	"mysql":              {},
+}
+
+// schemaSnapshot holds the CREATE DATABASE and CREATE TABLE statements of the upstream at ts,
+// the statements are in the format of DDL binlog, i.e. "use <db>; create table ..." for tables.
+// All of them are created with IF NOT EXISTS, so the snapshot can be applied again, e.g. when the
+// restoring failed after applying a part of it is started again.
+type schemaSnapshot struct {
+	ts   int64
+	ddls []string
+}
+
+// exportSchemaSnapshot dumps the schema of the upstream TiDB at ts, the current schema is dumped if ts is 0.
+func exportSchemaSnapshot(db *sql.DB, ts int64, afilter *filter.Filter, logger *zap.Logger) (*schemaSnapshot, error) {
+	ctx := context.Background()
+	// tidb_snapshot is a session variable, so all the queries must be executed in the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer conn.Close()
+
+	if ts > 0 {
+		if _, err = conn.ExecContext(ctx, fmt.Sprintf("SET @@tidb_snapshot = '%d'", ts)); err != nil {
+			return nil, errors.Annotatef(err, "set tidb_snapshot to %d", ts)
+		}
+	}
+
+	schemas, err := queryStrings(ctx, conn, "SHOW DATABASES")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	p := parser.New()
+	snapshot := &schemaSnapshot{ts: ts}
+	for _, schema := range schemas {
+		if _, ok := systemSchemas[strings.ToLower(schema)]; ok {
+			continue
+		}
+
+		var createDB string
+		row := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE DATABASE %s", pkgsql.QuoteName(schema)))
+		if err = row.Scan(&schema, &createDB); err != nil {
+			return nil, errors.Annotatef(err, "show create database %s", schema)
+		}
+
+		tables, err := queryStrings(ctx, conn, fmt.Sprintf("SHOW FULL TABLES FROM %s WHERE Table_type = 'BASE TABLE'", pkgsql.QuoteName(schema)))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		var createTables []string
+		for _, table := range tables {
+			if afilter.SkipSchemaAndTable(schema, table) {
+				continue
+			}
+
+			var createTable string
+			row := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE %s", pkgsql.QuoteSchema(schema, table)))
+			if err = row.Scan(&table, &createTable); err != nil {
+				return nil, errors.Annotatef(err, "show create table %s.%s", schema, table)
+			}
+			if createTable, err = createIfNotExists(p, createTable); err != nil {
+				return nil, errors.Trace(err)
+			}
+			createTables = append(createTables, fmt.Sprintf("use %s; %s", pkgsql.QuoteName(schema), createTable))
+		}
+
+		if len(createTables) == 0 && afilter.SkipSchemaAndTable(schema, "") {
+			continue
+		}
+		if createDB, err = createIfNotExists(p, createDB); err != nil {
+			return nil, errors.Trace(err)
+		}
+		snapshot.ddls = append(snapshot.ddls, createDB)
+		snapshot.ddls = append(snapshot.ddls, createTables...)
+	}
+
+	logger.Info("export schema snapshot success", zap.Int64("ts", ts), zap.Int("statements", len(snapshot.ddls)))
+	return snapshot, nil
+}
+
+// queryStrings returns the first column of the rows, which must be a string.
+func queryStrings(ctx context.Context, conn *sql.Conn, query string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "query %s", query)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var res []string
+	dest := make([]interface{}, len(cols))
+	for i := range dest {
+		dest[i] = new(sql.RawBytes)
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		res = append(res, string(*dest[0].(*sql.RawBytes)))
+	}
+
+	return res, errors.Trace(rows.Err())
+}
+
+// createPrefix matches the beginning of CREATE DATABASE and CREATE TABLE statements without IF NOT EXISTS.
+var createPrefix = regexp.MustCompile(`(?i)^CREATE\s+(DATABASE|SCHEMA|TABLE)\s+`)
+
+// createIfNotExists rewrites the CREATE DATABASE or CREATE TABLE statement with IF NOT EXISTS.
+func createIfNotExists(p *parser.Parser, query string) (string, error) {
+	stmt, err := p.ParseOneStmt(query, "", "")
+	if err != nil {
+		return "", errors.Annotatef(err, "parse %s", query)
+	}
+	return restoreIfNotExists(stmt)
+}
+
+// restoreIfNotExists returns the text of the statement with IF NOT EXISTS, the text is kept as is
+// as long as possible, it's restored from the AST only if IF NOT EXISTS can't be inserted into it.
+func restoreIfNotExists(stmt ast.StmtNode) (string, error) {
+	switch v := stmt.(type) {
+	case *ast.CreateDatabaseStmt:
+		if v.IfNotExists {
+			return stmtText(v), nil
+		}
+		v.IfNotExists = true
+	case *ast.CreateTableStmt:
+		if v.IfNotExists {
+			return stmtText(v), nil
+		}
+		v.IfNotExists = true
+	default:
+		return "", errors.Errorf("unexpected statement %s in schema snapshot", stmt.Text())
+	}
+
+	text := stmtText(stmt)
+	if loc := createPrefix.FindStringIndex(text); loc != nil {
+		return text[:loc[1]] + "IF NOT EXISTS " + text[loc[1]:], nil
+	}
+
+	var b strings.Builder
+	if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &b)); err != nil {
+		return "", errors.Annotatef(err, "restore %s", stmt.Text())
+	}
+	return b.String(), nil
+}
+
+// save writes the snapshot as a sql file, so it can also be applied by mysql client.
+func (s *schemaSnapshot) save(path string) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "-- schema snapshot at ts %d\n", s.ts)
+	for _, ddl := range s.ddls {
+		buf.WriteString(ddl)
+		buf.WriteString(";\n")
+	}
+
+	return errors.Trace(ioutil.WriteFile(path, []byte(buf.String()), 0644))
+}
+
+// loadSchemaSnapshot reads the snapshot saved by schemaSnapshot.save.
+func loadSchemaSnapshot(path string) (*schemaSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	snapshot := new(schemaSnapshot)
+	reader := bufio.NewReader(f)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, errors.Annotatef(err, "read header of %s", path)
+	}
+	if _, err = fmt.Sscanf(header, "-- schema snapshot at ts %d", &snapshot.ts); err != nil {
+		return nil, errors.Annotatef(err, "invalid header of %s", path)
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	stmts, _, err := parser.New().Parse(string(data), "", "")
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse %s", path)
+	}
+
+	var schema string
+	for _, stmt := range stmts {
+		switch v := stmt.(type) {
+		case *ast.UseStmt:
+			schema = v.DBName
+		case *ast.CreateDatabaseStmt:
+			ddl, err := restoreIfNotExists(v)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			snapshot.ddls = append(snapshot.ddls, ddl)
+		case *ast.CreateTableStmt:
+			if len(schema) == 0 && len(v.Table.Schema.O) == 0 {
+				return nil, errors.Errorf("no database selected for %s", v.Text())
+			}
+			ddl, err := restoreIfNotExists(v)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if len(schema) > 0 {
+				ddl = fmt.Sprintf("use %s; %s", pkgsql.QuoteName(schema), ddl)
+			}
+			snapshot.ddls = append(snapshot.ddls, ddl)
+		default:
+			return nil, errors.Errorf("unexpected statement %s in schema snapshot", v.Text())
+		}
+	}
+
+	return snapshot, nil
+}
+
+func stmtText(stmt ast.StmtNode) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(stmt.Text()), ";"))
+}
+
+// binlogs converts the statements to DDL binlogs.
+func (s *schemaSnapshot) binlogs() []*pb.Binlog {
+	binlogs := make([]*pb.Binlog, 0, len(s.ddls))
+	for _, ddl := range s.ddls {
+		binlogs = append(binlogs, &pb.Binlog{
+			Tp:       pb.BinlogType_DDL,
+			CommitTs: s.ts,
+			DdlQuery: []byte(ddl),
+		})
+	}
+	return binlogs
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+type testSchemaSuite struct{}
+
+var _ = Suite(&testSchemaSuite{})
+
+func (s *testSchemaSuite) TestExportSchemaSnapshot(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	createTable := "CREATE TABLE `t1` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n)"
+	mock.ExpectExec(regexp.QuoteMeta("SET @@tidb_snapshot = '42'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SHOW DATABASES").WillReturnRows(sqlmock.NewRows([]string{"Database"}).
+		AddRow("INFORMATION_SCHEMA").AddRow("mysql").AddRow("test"))
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW CREATE DATABASE `test`")).WillReturnRows(
+		sqlmock.NewRows([]string{"Database", "Create Database"}).AddRow("test", "CREATE DATABASE `test`"))
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL TABLES FROM `test`")).WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_test", "Table_type"}).AddRow("t1", "BASE TABLE").AddRow("t2", "BASE TABLE"))
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW CREATE TABLE `test`.`t1`")).WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t1", createTable))
+
+	afilter := filter.NewFilter(nil, []filter.TableName{{Schema: "test", Table: "t2"}}, nil, nil)
+	snapshot, err := exportSchemaSnapshot(db, 42, afilter, log.L())
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(snapshot.ts, Equals, int64(42))
+	createTable = strings.Replace(createTable, "CREATE TABLE", "CREATE TABLE IF NOT EXISTS", 1)
+	c.Assert(snapshot.ddls, DeepEquals, []string{"CREATE DATABASE IF NOT EXISTS `test`", "use `test`; " + createTable})
+
+	binlogs := snapshot.binlogs()
+	c.Assert(binlogs, HasLen, 2)
+	c.Assert(binlogs[1].Tp, Equals, pb.BinlogType_DDL)
+	c.Assert(binlogs[1].CommitTs, Equals, int64(42))
+	c.Assert(string(binlogs[1].DdlQuery), Equals, "use `test`; "+createTable)
+}
+
+func (s *testSchemaSuite) TestSaveAndLoad(c *C) {
+	snapshot := &schemaSnapshot{
+		ts: 42,
+		ddls: []string{
+			"CREATE DATABASE IF NOT EXISTS `test` /*!40100 DEFAULT CHARACTER SET utf8mb4 */",
+			"use `test`; CREATE TABLE IF NOT EXISTS `t1` (\n  `id` int(11) NOT NULL\n)",
+			"use `test`; CREATE TABLE IF NOT EXISTS `t2` (\n  `name` varchar(10) DEFAULT ';'\n)",
+		},
+	}
+
+	file := path.Join(c.MkDir(), "schema.sql")
+	err := snapshot.save(file)
+	c.Assert(err, IsNil)
+
+	loaded, err := loadSchemaSnapshot(file)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, DeepEquals, snapshot)
+
+	_, err = loadSchemaSnapshot(path.Join(c.MkDir(), "not-exist.sql"))
+	c.Assert(err, NotNil)
+
+	// the schema file written by others is rewritten with IF NOT EXISTS
+	file = path.Join(c.MkDir(), "schema.sql")
+	err = ioutil.WriteFile(file, []byte("-- schema snapshot at ts 42\n"+
+		"create database test;\nuse test;\n/* t1 */ create table t1 (id int);\n"), 0644)
+	c.Assert(err, IsNil)
+	loaded, err = loadSchemaSnapshot(file)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.ddls, DeepEquals, []string{
+		"create database IF NOT EXISTS test",
+		"use `test`; CREATE TABLE IF NOT EXISTS `t1` (`id` INT)",
+	})
+}
+
+func (s *testSchemaSuite) TestApplyTwice(c *C) {
+	file := path.Join(c.MkDir(), "schema.sql")
+	err := ioutil.WriteFile(file, []byte("-- schema snapshot at ts 42\n"+
+		"CREATE DATABASE `test`;\nuse `test`;\nCREATE TABLE `t1` (`id` int);\nCREATE TABLE `t2` (`id` int);\n"), 0644)
+	c.Assert(err, IsNil)
+	snapshot, err := loadSchemaSnapshot(file)
+	c.Assert(err, IsNil)
+
+	// the restoring failed after creating t1 is started again
+	downstream := newMockDownstream()
+	for _, binlog := range snapshot.binlogs()[:2] {
+		c.Assert(downstream.exec(string(binlog.DdlQuery)), IsNil)
+	}
+	for _, binlog := range snapshot.binlogs() {
+		c.Assert(downstream.exec(string(binlog.DdlQuery)), IsNil)
+	}
+	for _, binlog := range snapshot.binlogs() {
+		c.Assert(downstream.exec(string(binlog.DdlQuery)), IsNil)
+	}
+	c.Assert(downstream.objects, DeepEquals, map[string]struct{}{"test": {}, "test.t1": {}, "test.t2": {}})
+
+	// the statements without IF NOT EXISTS fail
+	c.Assert(downstream.exec("CREATE DATABASE `test`"), ErrorMatches, "test exists")
+}
+
+// mockDownstream tracks the databases and tables created, it fails like TiDB
+// if a database or table is created again without IF NOT EXISTS.
+type mockDownstream struct {
+	objects map[string]struct{}
+	schema  string
+}
+
+func newMockDownstream() *mockDownstream {
+	return &mockDownstream{objects: make(map[string]struct{})}
+}
+
+func (d *mockDownstream) exec(query string) error {
+	stmts, _, err := parser.New().Parse(query, "", "")
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		var name string
+		var ifNotExists bool
+		switch v := stmt.(type) {
+		case *ast.UseStmt:
+			d.schema = v.DBName
+			continue
+		case *ast.CreateDatabaseStmt:
+			name, ifNotExists = v.Name, v.IfNotExists
+		case *ast.CreateTableStmt:
+			schema := v.Table.Schema.O
+			if len(schema) == 0 {
+				schema = d.schema
+			}
+			name, ifNotExists = schema+"."+v.Table.Name.O, v.IfNotExists
+		default:
+			return fmt.Errorf("unexpected statement %s", query)
+		}
+		if _, ok := d.objects[name]; ok && !ifNotExists {
+			return fmt.Errorf("%s exists", name)
+		}
+		d.objects[name] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"go.uber.org/zap"
+)
+
+// the stages of restoring, the failed stage and the stages after it are done again when continuing
+const (
+	// StageFullBackup restores the full backup, see Config.FullBackup
+	StageFullBackup = "full-backup"
+	// StageSchemaSnapshot creates the databases and tables, see Config.SourceDB
+	StageSchemaSnapshot = "schema-snapshot"
+	// StageReplay replays the binlogs
+	StageReplay = "replay"
+)
+
+// State is the state of restoring saved to Config.StateFile when reparo fails, the restoring is continued
+// from the binlog after the last one applied by Config.ContinueFrom.
+type State struct {
+	// the stage failed: full-backup, schema-snapshot or replay
+	Stage string `json:"stage"`
+	// the commit ts the binlogs are replayed from
+	StartTS int64 `json:"start-ts"`
+	// commit ts of the last binlog applied to downstream, the file of it and the offset after it in the file
+	AppliedTS     int64  `json:"applied-ts"`
+	AppliedFile   string `json:"applied-file,omitempty"`
+	AppliedOffset int64  `json:"applied-offset"`
+	// commit ts of the last binlog read from files, the file of it and the offset after it in the file
+	ReadTS     int64  `json:"read-ts"`
+	ReadFile   string `json:"read-file,omitempty"`
+	ReadOffset int64  `json:"read-offset"`
+	// the first binlog not applied, it's the one failed or in the same batch with it, nil if it's unknown
+	FailedEvent *FailedEvent `json:"failed-event,omitempty"`
+	Error       string       `json:"error"`
+	Time        time.Time    `json:"time"`
+}
+
+// FailedEvent is the binlog failed to restore.
+type FailedEvent struct {
+	CommitTS int64 `json:"commit-ts,omitempty"`
+	// the file of the binlog and the offset of it in the file
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+	// DDL or DML
+	Type   string   `json:"type,omitempty"`
+	DDL    string   `json:"ddl,omitempty"`
+	Tables []string `json:"tables,omitempty"`
+}
+
+// binlogPos is the position of a binlog synced but not applied yet
+type binlogPos struct {
+	binlog *pb.Binlog
+	file   string
+	// the offsets of the start and end of the binlog in the file
+	start int64
+	end   int64
+}
+
+func newFailedEvent(pos *binlogPos) *FailedEvent {
+	event := &FailedEvent{CommitTS: pos.binlog.CommitTs, File: pos.file, Offset: pos.start, Type: pos.binlog.Tp.String()}
+	if pos.binlog.Tp == pb.BinlogType_DDL {
+		event.DDL = string(pos.binlog.DdlQuery)
+		return event
+	}
+
+	seen := make(map[string]struct{})
+	for _, e := range pos.binlog.DmlData.GetEvents() {
+		table := e.GetSchemaName() + "." + e.GetTableName()
+		if _, ok := seen[table]; !ok {
+			seen[table] = struct{}{}
+			event.Tables = append(event.Tables, table)
+		}
+	}
+	return event
+}
+
+// State returns the state of restoring, err is the error failing it.
+func (r *Reparo) State(err error) *State {
+	r.posMu.Lock()
+	defer r.posMu.Unlock()
+
+	state := &State{
+		Stage:         r.stage,
+		StartTS:       r.cfg.StartTSO,
+		AppliedTS:     r.appliedPos.binlog.GetCommitTs(),
+		AppliedFile:   r.appliedPos.file,
+		AppliedOffset: r.appliedPos.end,
+		ReadTS:        r.readPos.binlog.GetCommitTs(),
+		ReadFile:      r.readPos.file,
+		ReadOffset:    r.readPos.end,
+		Time:          time.Now(),
+	}
+	if err != nil {
+		state.Error = err.Error()
+	}
+
+	switch {
+	case len(r.pending) > 0:
+		state.FailedEvent = newFailedEvent(r.pending[0])
+	case r.stage == StageReplay && len(r.readPos.file) > 0:
+		// failed to read the binlog after the last one read
+		state.FailedEvent = &FailedEvent{File: r.readPos.file, Offset: r.readPos.end}
+	}
+	return state
+}
+
+// SaveState saves the state of restoring to Config.StateFile, failure is the error failing it.
+func (r *Reparo) SaveState(failure error) error {
+	if len(r.cfg.StateFile) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.State(failure), "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// write a temporary file and rename it, so the state file is never partially written
+	tmp := r.cfg.StateFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	if err = os.Rename(tmp, r.cfg.StateFile); err != nil {
+		return errors.Trace(err)
+	}
+	r.logger.Info("state saved", zap.String("file", r.cfg.StateFile), zap.ByteString("state", data))
+	return nil
+}
+
+// loadState reads the state saved by SaveState.
+func loadState(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	state := new(State)
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, errors.Annotatef(err, "invalid state file %s", path)
+	}
+	return state, nil
+}
+
+// continueFrom adjusts the config to continue the restoring failed in state: the binlogs are replayed from the
+// one after the last applied, and the full backup and schema snapshot are skipped if they have been applied.
+func (c *Config) continueFrom(state *State) {
+	if state.Stage != StageReplay {
+		return
+	}
+
+	if c.FullBackup != nil {
+		// the full backup has been restored, but its checksums are still verified at last
+		c.restoredBackupDir = c.FullBackup.Dir
+	}
+	c.FullBackup = nil
+	c.SourceDB = nil
+	c.SchemaFile = ""
+	c.StartTSO = state.StartTS
+	if state.AppliedTS >= c.StartTSO {
+		c.StartTSO = state.AppliedTS + 1
+	}
+}
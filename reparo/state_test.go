@@ -0,0 +1,125 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+type testStateSuite struct{}
+
+var _ = check.Suite(&testStateSuite{})
+
+// appliedSyncer applies the binlogs until the commit ts reaches failTS, the ones after it are left pending
+type appliedSyncer struct {
+	failTS int64
+}
+
+func (s *appliedSyncer) Sync(binlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	if binlog.CommitTs < s.failTS {
+		cb(binlog)
+	}
+	return nil
+}
+
+func (s *appliedSyncer) Close() error {
+	return errors.New("duplicate entry")
+}
+
+func (s *testStateSuite) TestReaderPosition(c *check.C) {
+	dir := c.MkDir()
+	binlogs := writeBinlogsInDir(dir, c)
+	data, err := binlogs[0].Marshal()
+	c.Assert(err, check.IsNil)
+	length := int64(len(binlogfile.Encode(data)))
+
+	reader, err := newDirPbReader(dir, 0, 0)
+	c.Assert(err, check.IsNil)
+	defer reader.close()
+
+	// the first file has 1 binlog, the second has 2
+	expected := []binlogPos{
+		{file: path.Join(dir, binlogfile.BinlogName(0)), start: 0, end: length},
+		{file: path.Join(dir, binlogfile.BinlogName(1)), start: 0, end: length},
+		{file: path.Join(dir, binlogfile.BinlogName(1)), start: length, end: 2 * length},
+	}
+	for i, e := range expected {
+		binlog, err := reader.read()
+		c.Assert(err, check.IsNil)
+		pos := reader.position(binlog)
+		c.Assert(pos.binlog, check.DeepEquals, binlogs[i])
+		c.Assert(pos.file, check.Equals, e.file)
+		c.Assert(pos.start, check.Equals, e.start)
+		c.Assert(pos.end, check.Equals, e.end)
+	}
+}
+
+func (s *testStateSuite) TestSaveAndContinue(c *check.C) {
+	stateFile := path.Join(c.MkDir(), "state.json")
+	r := &Reparo{
+		cfg:    &Config{StartTSO: 10, StateFile: stateFile},
+		syncer: &appliedSyncer{failTS: 12},
+		logger: log.L(),
+		filter: filter.NewFilter(nil, nil, nil, nil),
+		stage:  StageReplay,
+	}
+	binlogs := []*pb.Binlog{
+		{CommitTs: 10, Tp: pb.BinlogType_DDL, DdlQuery: []byte("use test; create table t(id int)")},
+		{CommitTs: 11, Tp: pb.BinlogType_DML, DmlData: &pb.DMLData{Events: []pb.Event{{SchemaName: proto.String("test"), TableName: proto.String("t")}}}},
+		{CommitTs: 12, Tp: pb.BinlogType_DDL, DdlQuery: []byte("use test; drop table t")},
+		{CommitTs: 13, Tp: pb.BinlogType_DDL, DdlQuery: []byte("use test; create table t(id int)")},
+	}
+	for i, binlog := range binlogs {
+		pos := &binlogPos{binlog: binlog, file: "binlog-0000000000000000", start: int64(i * 10), end: int64(i*10 + 10)}
+		r.readPos = *pos
+		c.Assert(r.syncBinlog(context.Background(), pos), check.IsNil)
+	}
+
+	c.Assert(r.SaveState(r.syncer.Close()), check.IsNil)
+	state, err := loadState(stateFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(state.Stage, check.Equals, StageReplay)
+	c.Assert(state.StartTS, check.Equals, int64(10))
+	c.Assert(state.AppliedTS, check.Equals, int64(11))
+	c.Assert(state.AppliedOffset, check.Equals, int64(20))
+	c.Assert(state.ReadTS, check.Equals, int64(13))
+	c.Assert(state.Error, check.Equals, "duplicate entry")
+	c.Assert(state.FailedEvent, check.DeepEquals, &FailedEvent{
+		CommitTS: 12, File: "binlog-0000000000000000", Offset: 20, Type: "DDL", DDL: "use test; drop table t"})
+
+	cfg := &Config{StartTSO: 10, SchemaFile: "schema.sql", FullBackup: &FullBackupConfig{Dir: "dump"}}
+	cfg.continueFrom(state)
+	c.Assert(cfg.StartTSO, check.Equals, int64(12))
+	c.Assert(cfg.SchemaFile, check.Equals, "")
+	c.Assert(cfg.FullBackup, check.IsNil)
+	// the checksums of the restored full backup are still verified
+	c.Assert(cfg.backupMetadata(), check.Equals, filepath.Join("dump", backupMetadataFile))
+
+	// the failed full backup is restored again
+	state.Stage = StageFullBackup
+	cfg = &Config{FullBackup: &FullBackupConfig{}}
+	cfg.continueFrom(state)
+	c.Assert(cfg.FullBackup, check.NotNil)
+	c.Assert(cfg.StartTSO, check.Equals, int64(0))
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"path"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	tb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// SplitByNone writes all binlogs into the same directory, it can be used
+	// to compact many small binlog files into larger ones.
+	SplitByNone = ""
+	// SplitByDatabase writes binlogs of each database into a sub directory named by the database.
+	SplitByDatabase = "database"
+	// SplitByDay writes binlogs into a sub directory per day of commit time, like 20190101.
+	SplitByDay = "day"
+	// SplitByHour writes binlogs into a sub directory per hour of commit time, like 2019010112.
+	SplitByHour = "hour"
+)
+
+// FileConfig is the configuration of the file syncer.
+type FileConfig struct {
+	Dir         string `toml:"dir" json:"dir"`
+	SplitBy     string `toml:"split-by" json:"split-by"`
+	MaxFileSize int64  `toml:"max-file-size" json:"max-file-size"`
+}
+
+// Validate checks whether the configuration is valid.
+func (cfg *FileConfig) Validate() error {
+	if len(cfg.Dir) == 0 {
+		return errors.New("dir of dest-file is empty")
+	}
+
+	switch cfg.SplitBy {
+	case SplitByNone, SplitByDatabase, SplitByDay, SplitByHour:
+	default:
+		return errors.Errorf("split-by %s is not supported", cfg.SplitBy)
+	}
+
+	if cfg.MaxFileSize < 0 {
+		return errors.Errorf("invalid max-file-size %d", cfg.MaxFileSize)
+	}
+
+	return nil
+}
+
+// fileSyncer rewrites binlogs into binlog files that can be read by reparo again,
+// optionally split by database or by commit time.
+type fileSyncer struct {
+	cfg *FileConfig
+
+	// binloggers holds the opened binlogger of each sub directory
+	binloggers map[string]binlogfile.Binlogger
+}
+
+var _ Syncer = &fileSyncer{}
+
+func newFileSyncer(cfg *FileConfig) (*fileSyncer, error) {
+	if cfg == nil {
+		return nil, errors.New("dest-file config must not be empty")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if cfg.MaxFileSize == 0 {
+		cfg.MaxFileSize = binlogfile.SegmentSizeBytes
+	}
+
+	return &fileSyncer{
+		cfg:        cfg,
+		binloggers: make(map[string]binlogfile.Binlogger),
+	}, nil
+}
+
+func (f *fileSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	parts, err := f.split(pbBinlog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, part := range parts {
+		if err := f.write(part.subDir, part.binlog); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	cb(pbBinlog)
+
+	return nil
+}
+
+func (f *fileSyncer) Close() error {
+	var err error
+	for subDir, binlogger := range f.binloggers {
+		if closeErr := binlogger.Close(); closeErr != nil {
+			log.Error("close binlogger failed", zap.String("sub dir", subDir), zap.Error(closeErr))
+			err = closeErr
+		}
+	}
+	f.binloggers = make(map[string]binlogfile.Binlogger)
+
+	return errors.Trace(err)
+}
+
+type binlogPart struct {
+	subDir string
+	binlog *pb.Binlog
+}
+
+func (f *fileSyncer) split(binlog *pb.Binlog) ([]binlogPart, error) {
+	switch f.cfg.SplitBy {
+	case SplitByDatabase:
+		return splitByDatabase(binlog)
+	case SplitByDay:
+		return []binlogPart{{util.TSOToRoughTime(binlog.CommitTs).Format("20060102"), binlog}}, nil
+	case SplitByHour:
+		return []binlogPart{{util.TSOToRoughTime(binlog.CommitTs).Format("2006010215"), binlog}}, nil
+	default:
+		return []binlogPart{{"", binlog}}, nil
+	}
+}
+
+// splitByDatabase returns one binlog for each database touched by the binlog,
+// DML events of different databases are put into different binlogs with the same ts.
+func splitByDatabase(binlog *pb.Binlog) ([]binlogPart, error) {
+	switch binlog.Tp {
+	case pb.BinlogType_DDL:
+		schema, _, err := parserSchemaTableFromDDL(string(binlog.DdlQuery))
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse ddl %s failed", binlog.DdlQuery)
+		}
+		return []binlogPart{{schema, binlog}}, nil
+	case pb.BinlogType_DML:
+		var parts []binlogPart
+		partIdx := make(map[string]int)
+		for _, event := range binlog.GetDmlData().GetEvents() {
+			schema := event.GetSchemaName()
+			idx, ok := partIdx[schema]
+			if !ok {
+				idx = len(parts)
+				partIdx[schema] = idx
+				parts = append(parts, binlogPart{
+					subDir: schema,
+					binlog: &pb.Binlog{
+						Tp:       binlog.Tp,
+						CommitTs: binlog.CommitTs,
+						DmlData:  &pb.DMLData{},
+					},
+				})
+			}
+			dmlData := parts[idx].binlog.DmlData
+			dmlData.Events = append(dmlData.Events, event)
+		}
+		return parts, nil
+	default:
+		return nil, errors.Errorf("unknown type: %v", binlog.Tp)
+	}
+}
+
+func (f *fileSyncer) write(subDir string, binlog *pb.Binlog) error {
+	binlogger, ok := f.binloggers[subDir]
+	if !ok {
+		// binlogs are sorted by commit ts, so the directories of the previous
+		// time range will never be written again.
+		if f.cfg.SplitBy == SplitByDay || f.cfg.SplitBy == SplitByHour {
+			if err := f.Close(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		var err error
+		binlogger, err = binlogfile.OpenBinlogger(path.Join(f.cfg.Dir, subDir), f.cfg.MaxFileSize)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		f.binloggers[subDir] = binlogger
+	}
+
+	data, err := binlog.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err = binlogger.WriteTail(&tb.Entity{Payload: data})
+	return errors.Trace(err)
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+type testFileSuite struct{}
+
+var _ = check.Suite(&testFileSuite{})
+
+func (s *testFileSuite) TestValidate(c *check.C) {
+	cfg := &FileConfig{}
+	c.Assert(cfg.Validate(), check.NotNil)
+
+	cfg.Dir = c.MkDir()
+	c.Assert(cfg.Validate(), check.IsNil)
+
+	cfg.SplitBy = "table"
+	c.Assert(cfg.Validate(), check.NotNil)
+
+	cfg.SplitBy = SplitByHour
+	cfg.MaxFileSize = -1
+	c.Assert(cfg.Validate(), check.NotNil)
+}
+
+func (s *testFileSuite) TestSplitByDatabase(c *check.C) {
+	dir := c.MkDir()
+	syncer, err := newFileSyncer(&FileConfig{Dir: dir, SplitBy: SplitByDatabase})
+	c.Assert(err, check.IsNil)
+
+	syncTest(c, Syncer(syncer))
+
+	schema1, schema2 := "db1", "db2"
+	dmlBinlog := &pb.Binlog{
+		Tp:       pb.BinlogType_DML,
+		CommitTs: 10,
+		DmlData: &pb.DMLData{
+			Events: []pb.Event{
+				{Tp: pb.EventType_Insert, SchemaName: &schema1},
+				{Tp: pb.EventType_Insert, SchemaName: &schema2},
+				{Tp: pb.EventType_Delete, SchemaName: &schema1},
+			},
+		},
+	}
+	err = syncer.Sync(dmlBinlog, func(*pb.Binlog) {})
+	c.Assert(err, check.IsNil)
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+
+	binlogs := readBinlogsInDir(c, path.Join(dir, "test"))
+	c.Assert(binlogs, check.HasLen, 2)
+	c.Assert(binlogs[0].Tp, check.Equals, pb.BinlogType_DDL)
+	c.Assert(binlogs[1].DmlData.Events, check.HasLen, 3)
+
+	binlogs = readBinlogsInDir(c, path.Join(dir, schema1))
+	c.Assert(binlogs, check.HasLen, 1)
+	c.Assert(binlogs[0].CommitTs, check.Equals, int64(10))
+	c.Assert(binlogs[0].DmlData.Events, check.HasLen, 2)
+
+	binlogs = readBinlogsInDir(c, path.Join(dir, schema2))
+	c.Assert(binlogs, check.HasLen, 1)
+	c.Assert(binlogs[0].DmlData.Events, check.HasLen, 1)
+}
+
+func (s *testFileSuite) TestCompact(c *check.C) {
+	dir := c.MkDir()
+	syncer, err := newFileSyncer(&FileConfig{Dir: dir})
+	c.Assert(err, check.IsNil)
+
+	for i := 0; i < 10; i++ {
+		syncTest(c, Syncer(syncer))
+	}
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.HasLen, 1)
+	c.Assert(readBinlogsInDir(c, dir), check.HasLen, 20)
+}
+
+func readBinlogsInDir(c *check.C, dir string) []*pb.Binlog {
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, check.IsNil)
+
+	var binlogs []*pb.Binlog
+	for _, name := range names {
+		f, err := os.Open(path.Join(dir, name))
+		c.Assert(err, check.IsNil)
+
+		r := bufio.NewReader(f)
+		for {
+			payload, _, err := binlogfile.Decode(r)
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, check.IsNil)
+
+			binlog := new(pb.Binlog)
+			c.Assert(binlog.Unmarshal(payload), check.IsNil)
+			binlogs = append(binlogs, binlog)
+		}
+		f.Close()
+	}
+
+	return binlogs
+}
@@ -17,12 +17,18 @@ package syncer
 
 import (
 	"database/sql"
+	"net"
+	"strconv"
 	"sync"
 
 	"github.com/pingcap/errors"
-	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/encrypt"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/scrub"
+	"github.com/pingcap/tidb-binlog/pkg/secret"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"go.uber.org/zap"
 )
 
 // DBConfig is the DB configuration.
@@ -31,11 +37,82 @@ type DBConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
 	Port     int    `toml:"port" json:"port"`
+
+	// read the password from the environment variable, the file or the command instead of Password,
+	// it's read again when reconnecting, so the rotated password is picked up
+	PasswordFrom *secret.Source `toml:"password-from" json:"password-from"`
+
+	// the session time zone of downstream, the TIMESTAMP values are converted from BinlogTimeZone to it.
+	// The server default time zone is used and the values are kept as they are if it's empty.
+	TimeZone string `toml:"time-zone" json:"time-zone"`
+	// the time zone of the TIMESTAMP values in binlog files, i.e. the `time-zone` of drainer,
+	// empty means the local time zone.
+	BinlogTimeZone string `toml:"binlog-time-zone" json:"binlog-time-zone"`
+
+	// the columns encrypted or decrypted before written to downstream
+	Encryption *encrypt.Config `toml:"encryption" json:"encryption"`
+	// the columns anonymized before written to downstream, before they're encrypted
+	Scrub *scrub.Config `toml:"scrub" json:"scrub"`
+
+	// how the DMLs are applied, the same as the ones of drainer
+	loader.ApplyConfig
+
+	// the metrics of the loader, set by reparo
+	Metrics *loader.MetricsGroup `toml:"-" json:"-"`
+}
+
+// Validate checks whether the time zones and the password source are valid
+func (c *DBConfig) Validate() error {
+	if err := secret.CheckPassword(c.Password, c.PasswordFrom); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := util.ParseTimeZone(c.TimeZone); err != nil {
+		return errors.Annotate(err, "invalid time-zone")
+	}
+	if _, err := util.ParseTimeZone(c.BinlogTimeZone); err != nil {
+		return errors.Annotate(err, "invalid binlog-time-zone")
+	}
+	if c.Encryption != nil {
+		if err := c.Encryption.Validate(); err != nil {
+			return errors.Annotate(err, "invalid encryption")
+		}
+	}
+	if c.Scrub != nil {
+		if err := c.Scrub.Validate(); err != nil {
+			return errors.Annotate(err, "invalid scrub")
+		}
+	}
+	return errors.Trace(c.ApplyConfig.Validate())
+}
+
+// GetPassword returns the password, it's read from PasswordFrom if it's set.
+func (c *DBConfig) GetPassword() (string, error) {
+	return secret.Password(c.Password, c.PasswordFrom)
+}
+
+func (c *DBConfig) timestampConverter() (*timestampConverter, error) {
+	if len(c.TimeZone) == 0 {
+		return nil, nil
+	}
+
+	from, err := util.ParseTimeZone(c.BinlogTimeZone)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	to, err := util.ParseTimeZone(c.TimeZone)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &timestampConverter{from: from, to: to}, nil
 }
 
 type mysqlSyncer struct {
 	db *sql.DB
 
+	tsConverter *timestampConverter
+
+	logger *zap.Logger
+
 	loader loader.Loader
 
 	loaderQuit chan struct{}
@@ -47,25 +124,81 @@ var (
 )
 
 // should be only used for unit test to create mock db
-var createDB = loader.CreateDB
+var createDB = loader.CreateDBWithTimeZone
 
-func newMysqlSyncer(cfg *DBConfig, worker int, batchSize int, safemode bool) (*mysqlSyncer, error) {
-	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port)
+func newMysqlSyncer(cfg *DBConfig, worker int, batchSize int, safemode bool, logger *zap.Logger) (*mysqlSyncer, error) {
+	tsConverter, err := cfg.timestampConverter()
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	return newMysqlSyncerFromSQLDB(db, worker, batchSize, safemode)
+	var timeZone string
+	if tsConverter != nil {
+		if timeZone, err = util.SessionTimeZone(cfg.TimeZone); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var opts []loader.Option
+	if cfg.Scrub != nil {
+		scrubber, err := scrub.New(cfg.Scrub)
+		if err != nil {
+			return nil, errors.Annotate(err, "create scrub transform failed")
+		}
+		opts = append(opts, loader.Transforms(scrubber.Transform))
+	}
+	var transformer *encrypt.Transformer
+	if cfg.Encryption != nil {
+		transformer, err = encrypt.New(cfg.Encryption)
+		if err != nil {
+			return nil, errors.Annotate(err, "create encryption transform failed")
+		}
+		opts = append(opts, loader.Transforms(transformer.Transform))
+	}
+	opts = append(opts, cfg.ApplyConfig.Options()...)
+	if cfg.Metrics != nil {
+		opts = append(opts, loader.Metrics(cfg.Metrics))
+	}
+
+	password, err := cfg.GetPassword()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	db, err := createDB(cfg.User, password, cfg.Host, cfg.Port, nil, timeZone)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if transformer != nil {
+		if err = transformer.CheckColumns(db); err != nil {
+			db.Close()
+			return nil, errors.Annotate(err, "check the columns to encrypt failed")
+		}
+	}
+	opts = append(opts, loader.Reconnect(func(string) (*sql.DB, error) {
+		// read the password again, it may have been rotated
+		password, err := cfg.GetPassword()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return createDB(cfg.User, password, cfg.Host, cfg.Port, nil, timeZone)
+	}, net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))))
+
+	syncer, err := newMysqlSyncerFromSQLDB(db, worker, batchSize, safemode, logger, opts...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	syncer.tsConverter = tsConverter
+
+	return syncer, nil
 }
 
-func newMysqlSyncerFromSQLDB(db *sql.DB, worker int, batchSize int, safemode bool) (*mysqlSyncer, error) {
-	loader, err := loader.NewLoader(db, loader.WorkerCount(worker), loader.BatchSize(batchSize))
+func newMysqlSyncerFromSQLDB(db *sql.DB, worker int, batchSize int, safemode bool, logger *zap.Logger, opts ...loader.Option) (*mysqlSyncer, error) {
+	opts = append([]loader.Option{loader.WorkerCount(worker), loader.BatchSize(batchSize), loader.SafeMode(safemode), loader.Logger(logger)}, opts...)
+	loader, err := loader.NewLoader(db, opts...)
 	if err != nil {
 		return nil, errors.Annotate(err, "new loader failed")
 	}
-
-	loader.SetSafeMode(safemode)
-	syncer := &mysqlSyncer{db: db, loader: loader}
+	syncer := &mysqlSyncer{db: db, loader: loader, logger: logger}
 	syncer.runLoader()
 
 	return syncer, nil
@@ -77,12 +210,13 @@ type item struct {
 }
 
 func (m *mysqlSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
-	txn, err := pbBinlogToTxn(pbBinlog)
+	txn, err := pbBinlogToTxn(pbBinlog, m.tsConverter)
 	if err != nil {
 		return errors.Annotate(err, "pbBinlogToTxn failed")
 	}
 
 	item := &item{binlog: pbBinlog, cb: cb}
+	txn.CommitTS = pbBinlog.CommitTs
 	txn.Metadata = item
 
 	select {
@@ -111,7 +245,7 @@ func (m *mysqlSyncer) runLoader() {
 			item := txn.Metadata.(*item)
 			item.cb(item.binlog)
 		}
-		log.Info("Successes chan quit")
+		m.logger.Info("Successes chan quit")
 		wg.Done()
 	}()
 
@@ -6,6 +6,7 @@ import (
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/pingcap/check"
+	"github.com/pingcap/log"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 )
 
@@ -24,7 +25,7 @@ func (s *testMysqlSuite) testMysqlSyncer(c *check.C, safemode bool) {
 	)
 
 	oldCreateDB := createDB
-	createDB = func(string, string, string, int) (db *sql.DB, err error) {
+	createDB = func(string, string, string, int, *string, string) (db *sql.DB, err error) {
 		db, mock, err = sqlmock.New()
 		return
 	}
@@ -32,14 +33,14 @@ func (s *testMysqlSuite) testMysqlSyncer(c *check.C, safemode bool) {
 		createDB = oldCreateDB
 	}()
 
-	syncer, err := newMysqlSyncer(&DBConfig{}, 1, 20, safemode)
+	syncer, err := newMysqlSyncer(&DBConfig{}, 1, 20, safemode, log.L())
 	c.Assert(err, check.IsNil)
 
 	mock.ExpectBegin()
 	mock.ExpectExec("create database test").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit()
 
-	mock.ExpectQuery("SELECT column_name, extra FROM information_schema.columns").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", "").AddRow("b", "").AddRow("c", ""))
+	mock.ExpectQuery("SELECT column_name, extra, is_nullable, column_default FROM information_schema.columns").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra", "is_nullable", "column_default"}).AddRow("a", "", "YES", nil).AddRow("b", "", "YES", nil).AddRow("c", "", "YES", nil))
 
 	rows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"})
 	mock.ExpectQuery("SELECT non_unique, index_name, seq_in_index, column_name FROM information_schema.statistics").
@@ -14,80 +14,404 @@
 package syncer
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	"github.com/pingcap/tidb/util/codec"
 	"go.uber.org/zap"
 )
 
-type printSyncer struct{}
+const (
+	// PrintText prints the DDL queries and the decoded columns of the DML events.
+	PrintText = "text"
+	// PrintSQL prints the SQL statements replaying the binlogs with the arguments inlined, one transaction per binlog.
+	PrintSQL = "sql"
+)
+
+// PrintConfig is the configuration of the print syncer, a nil PrintConfig prints all the binlogs as text to stdout.
+type PrintConfig struct {
+	// Format can be PrintText or PrintSQL, the default is PrintText.
+	Format string `toml:"format" json:"format"`
+	// all the values are replaced by mask.Masked if Redact is true, e.g., to preview the statements in an audit
+	// without leaking the data, otherwise only the values configured by [mask] are masked.
+	Redact bool `toml:"redact" json:"redact"`
+
+	// only the tables matching Tables are printed, all the tables if it's empty. The binlogs are filtered by the
+	// replicate-* configurations of reparo before, these narrow the output further.
+	Tables []filter.TableName `toml:"table" json:"table"`
+	// only the binlogs committed in [StartTSO, StopTSO] are printed, 0 means unlimited.
+	StartTSO int64 `toml:"start-tso" json:"start-tso"`
+	StopTSO  int64 `toml:"stop-tso" json:"stop-tso"`
+
+	// the output is written to the files in Dir instead of stdout if it's set, the files are named
+	// print-000001.txt or print-000001.sql and so on.
+	Dir string `toml:"dir" json:"dir"`
+	// a new file is opened after the file has MaxLines lines, a binlog is never split into two files.
+	// 0 means all the output is written to one file.
+	MaxLines int `toml:"max-lines" json:"max-lines"`
+}
+
+// Validate checks whether the configuration is valid.
+func (cfg *PrintConfig) Validate() error {
+	switch cfg.Format {
+	case "", PrintText, PrintSQL:
+	default:
+		return errors.Errorf("format %s of dest-print is not supported, must be %s or %s", cfg.Format, PrintText, PrintSQL)
+	}
+
+	if cfg.StopTSO > 0 && cfg.StopTSO < cfg.StartTSO {
+		return errors.Errorf("stop-tso %d of dest-print is less than start-tso %d", cfg.StopTSO, cfg.StartTSO)
+	}
+
+	if cfg.MaxLines < 0 {
+		return errors.Errorf("invalid max-lines %d", cfg.MaxLines)
+	}
+	if cfg.MaxLines > 0 && len(cfg.Dir) == 0 {
+		return errors.New("max-lines of dest-print is set without dir")
+	}
+
+	return nil
+}
+
+type printSyncer struct {
+	cfg    *PrintConfig
+	filter *filter.Filter
+
+	// the file the output is written to, the output is written to stdout if it's nil
+	file     *os.File
+	buf      *bufio.Writer
+	fileSeq  int
+	numLines int
+}
 
 var _ Syncer = &printSyncer{}
 
-func newPrintSyncer() (*printSyncer, error) {
-	return &printSyncer{}, nil
+func newPrintSyncer(cfg *PrintConfig) (*printSyncer, error) {
+	if cfg == nil {
+		cfg = new(PrintConfig)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	p := &printSyncer{cfg: cfg}
+	if len(cfg.Tables) > 0 {
+		p.filter = filter.NewFilter(nil, nil, nil, cfg.Tables)
+	}
+	if len(cfg.Dir) > 0 {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, errors.Annotatef(err, "create dir %s of dest-print failed", cfg.Dir)
+		}
+	}
+	return p, nil
 }
 
 func (p *printSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
-	switch pbBinlog.Tp {
-	case pb.BinlogType_DDL:
-		printDDL(pbBinlog)
+	binlog, err := p.filterBinlog(pbBinlog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the binlogs filtered out are regarded as synced
+	if binlog == nil {
 		cb(pbBinlog)
+		return nil
+	}
+
+	if err := p.rotate(); err != nil {
+		return errors.Trace(err)
+	}
+
+	w := p.writer()
+	if p.cfg.Format == PrintSQL {
+		err = p.printSQL(w, binlog)
+	} else {
+		err = p.printText(w, binlog)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cb(pbBinlog)
+
+	return nil
+}
+
+func (p *printSyncer) Close() error {
+	return errors.Trace(p.closeFile())
+}
+
+// filterBinlog returns the binlog holding the events to print, or nil if nothing is printed
+func (p *printSyncer) filterBinlog(binlog *pb.Binlog) (*pb.Binlog, error) {
+	if binlog.CommitTs < p.cfg.StartTSO || (p.cfg.StopTSO > 0 && binlog.CommitTs > p.cfg.StopTSO) {
+		return nil, nil
+	}
+
+	switch binlog.Tp {
+	case pb.BinlogType_DDL:
+		if p.filter == nil {
+			return binlog, nil
+		}
+		schema, table, err := parserSchemaTableFromDDL(string(binlog.DdlQuery))
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse ddl %s failed", binlog.DdlQuery)
+		}
+		if p.filter.SkipSchemaAndTable(schema, table) {
+			return nil, nil
+		}
+		return binlog, nil
 	case pb.BinlogType_DML:
-		for _, event := range pbBinlog.GetDmlData().GetEvents() {
-			printEvent(&event)
+		if p.filter == nil {
+			return binlog, nil
 		}
-		cb(pbBinlog)
+		var events []pb.Event
+		for _, event := range binlog.GetDmlData().GetEvents() {
+			if !p.filter.SkipSchemaAndTable(event.GetSchemaName(), event.GetTableName()) {
+				events = append(events, event)
+			}
+		}
+		if len(events) == 0 {
+			return nil, nil
+		}
+		return &pb.Binlog{Tp: binlog.Tp, CommitTs: binlog.CommitTs, DmlData: &pb.DMLData{Events: events}}, nil
 	default:
-		return errors.Errorf("unknown type: %v", pbBinlog.Tp)
+		return nil, errors.Errorf("unknown type: %v", binlog.Tp)
+	}
+}
+
+// writer returns the writer of the current file, or stdout if the output isn't written to files
+func (p *printSyncer) writer() io.Writer {
+	if p.buf == nil {
+		return os.Stdout
+	}
+	return lineCounter{w: p.buf, lines: &p.numLines}
+}
+
+// rotate opens a new file if the current one is full
+func (p *printSyncer) rotate() error {
+	if len(p.cfg.Dir) == 0 {
+		return nil
+	}
+	if p.file != nil && (p.cfg.MaxLines == 0 || p.numLines < p.cfg.MaxLines) {
+		return nil
+	}
+	if err := p.closeFile(); err != nil {
+		return errors.Trace(err)
+	}
+
+	ext := "txt"
+	if p.cfg.Format == PrintSQL {
+		ext = "sql"
+	}
+	p.fileSeq++
+	path := filepath.Join(p.cfg.Dir, fmt.Sprintf("print-%06d.%s", p.fileSeq, ext))
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Annotatef(err, "create file %s failed", path)
+	}
+	log.Info("print binlogs to new file", zap.String("path", path))
+	p.file = file
+	p.buf = bufio.NewWriter(file)
+	p.numLines = 0
+	return nil
+}
+
+func (p *printSyncer) closeFile() error {
+	if p.file == nil {
+		return nil
+	}
+	err := p.buf.Flush()
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	p.file = nil
+	p.buf = nil
+	return errors.Annotate(err, "close file of dest-print failed")
+}
+
+// lineCounter counts the lines written to w
+type lineCounter struct {
+	w     io.Writer
+	lines *int
+}
 
+func (c lineCounter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	for _, b := range data[:n] {
+		if b == '\n' {
+			*c.lines++
+		}
 	}
+	return n, err
+}
 
+// value returns the value printed for the column
+func (p *printSyncer) value(schema, table, column string, value interface{}) interface{} {
+	if p.cfg.Redact && value != nil {
+		return mask.Masked
+	}
+	return mask.Value(schema, table, column, value)
+}
+
+func (p *printSyncer) printText(w io.Writer, binlog *pb.Binlog) error {
+	if binlog.Tp == pb.BinlogType_DDL {
+		printDDL(w, binlog)
+		return nil
+	}
+	for _, event := range binlog.GetDmlData().GetEvents() {
+		p.printEvent(w, &event)
+	}
 	return nil
 }
 
-func (p *printSyncer) Close() error {
+// printSQL prints the binlog as the SQL statements executed in one transaction, the statements are the ones
+// the loader executes for the table without unique keys, i.e., the rows are located by all their columns.
+func (p *printSyncer) printSQL(w io.Writer, binlog *pb.Binlog) error {
+	fmt.Fprintf(w, "-- commit ts: %d (%s)\n", binlog.CommitTs, util.TSOToRoughTime(binlog.CommitTs).Format("2006-01-02 15:04:05"))
+
+	txn, err := pbBinlogToTxn(binlog, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if txn.DDL != nil {
+		fmt.Fprintf(w, "USE %s;\n%s;\n", pkgsql.QuoteName(txn.DDL.Database), strings.TrimRight(strings.TrimSpace(txn.DDL.SQL), ";"))
+		return nil
+	}
+
+	events := binlog.GetDmlData().GetEvents()
+	fmt.Fprintln(w, "BEGIN;")
+	for i, dml := range txn.DMLs {
+		columns, err := eventColumns(&events[i])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dml.Values = p.values(dml.Database, dml.Table, dml.Values)
+		dml.OldValues = p.values(dml.Database, dml.Table, dml.OldValues)
+
+		stmts, err := loader.GenerateStatements(&loader.TableSchema{Columns: columns}, []*loader.DML{dml}, false, false, 1)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, txnStmts := range stmts {
+			for _, stmt := range txnStmts {
+				fmt.Fprintf(w, "%s;\n", inlineArgs(stmt.SQL, stmt.Args))
+			}
+		}
+	}
+	fmt.Fprintln(w, "COMMIT;")
 	return nil
 }
 
-func printEvent(event *pb.Event) {
-	printHeader(event)
+func (p *printSyncer) values(schema, table string, values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	printed := make(map[string]interface{}, len(values))
+	for column, value := range values {
+		printed[column] = p.value(schema, table, column, value)
+	}
+	return printed
+}
+
+// eventColumns returns the names of the columns of the event in order
+func eventColumns(event *pb.Event) ([]string, error) {
+	columns := make([]string, 0, len(event.Row))
+	for _, c := range event.Row {
+		col := &pb.Column{}
+		if err := col.Unmarshal(c); err != nil {
+			return nil, errors.Annotate(err, "unmarshal failed")
+		}
+		columns = append(columns, col.Name)
+	}
+	return columns, nil
+}
+
+// inlineArgs replaces the placeholders of the sql out of the quoted identifiers with the literals of args
+func inlineArgs(sql string, args []interface{}) string {
+	var b strings.Builder
+	quoted := false
+	for _, r := range sql {
+		switch {
+		case r == '`':
+			quoted = !quoted
+		case r == '?' && !quoted && len(args) > 0:
+			b.WriteString(sqlLiteral(args[0]))
+			args = args[1:]
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlLiteral returns the SQL literal of the value, the binary strings are printed in hex
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteString(v)
+	case []byte:
+		if utf8.Valid(v) {
+			return quoteString(string(v))
+		}
+		return fmt.Sprintf("x'%x'", v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	default:
+		return quoteString(fmt.Sprintf("%v", v))
+	}
+}
+
+func quoteString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
+
+func (p *printSyncer) printEvent(w io.Writer, event *pb.Event) {
+	printEventHeader(w, event)
 
 	switch event.GetTp() {
 	case pb.EventType_Insert:
-		err := printInsertOrDeleteEvent(event.Row)
+		err := p.printInsertOrDeleteEvent(w, event.GetSchemaName(), event.GetTableName(), event.Row)
 		if err != nil {
 			log.Error("print insert event failed", zap.Error(err))
 		}
 	case pb.EventType_Update:
-		err := printUpdateEvent(event.Row)
+		err := p.printUpdateEvent(w, event.GetSchemaName(), event.GetTableName(), event.Row)
 		if err != nil {
 			log.Error("print update event failed", zap.Error(err))
 		}
 	case pb.EventType_Delete:
-		err := printInsertOrDeleteEvent(event.Row)
+		err := p.printInsertOrDeleteEvent(w, event.GetSchemaName(), event.GetTableName(), event.Row)
 		if err != nil {
 			log.Error("print delete event failed", zap.Error(err))
 		}
 	}
 }
 
-func printHeader(event *pb.Event) {
-	printEventHeader(event)
-}
-
-func printDDL(binlog *pb.Binlog) {
-	fmt.Printf("DDL query: %s\n", binlog.DdlQuery)
+func printDDL(w io.Writer, binlog *pb.Binlog) {
+	fmt.Fprintf(w, "DDL query: %s\n", binlog.DdlQuery)
 }
 
-func printEventHeader(event *pb.Event) {
-	fmt.Printf("schema: %s; table: %s; type: %s\n", event.GetSchemaName(), event.GetTableName(), event.GetTp())
+func printEventHeader(w io.Writer, event *pb.Event) {
+	fmt.Fprintf(w, "schema: %s; table: %s; type: %s\n", event.GetSchemaName(), event.GetTableName(), event.GetTp())
 }
 
-func printUpdateEvent(row [][]byte) error {
+func (p *printSyncer) printUpdateEvent(w io.Writer, schema, table string, row [][]byte) error {
 	for _, c := range row {
 		col := &pb.Column{}
 		err := col.Unmarshal(c)
@@ -106,12 +430,14 @@ func printUpdateEvent(row [][]byte) error {
 		}
 
 		tp := col.Tp[0]
-		fmt.Printf("%s(%s): %s => %s\n", col.Name, col.MysqlType, formatValueToString(val, tp), formatValueToString(changedVal, tp))
+		fmt.Fprintf(w, "%s(%s): %v => %v\n", col.Name, col.MysqlType,
+			p.value(schema, table, col.Name, formatValueToString(val, tp)),
+			p.value(schema, table, col.Name, formatValueToString(changedVal, tp)))
 	}
 	return nil
 }
 
-func printInsertOrDeleteEvent(row [][]byte) error {
+func (p *printSyncer) printInsertOrDeleteEvent(w io.Writer, schema, table string, row [][]byte) error {
 	for _, c := range row {
 		col := &pb.Column{}
 		err := col.Unmarshal(c)
@@ -125,7 +451,7 @@ func printInsertOrDeleteEvent(row [][]byte) error {
 		}
 
 		tp := col.Tp[0]
-		fmt.Printf("%s(%s): %s\n", col.Name, col.MysqlType, formatValueToString(val, tp))
+		fmt.Fprintf(w, "%s(%s): %v\n", col.Name, col.MysqlType, p.value(schema, table, col.Name, formatValueToString(val, tp)))
 	}
 	return nil
 }
@@ -1,10 +1,17 @@
 package syncer
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 
 	capturer "github.com/kami-zh/go-capturer"
 	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 )
 
@@ -13,7 +20,7 @@ type testPrintSuite struct{}
 var _ = check.Suite(&testPrintSuite{})
 
 func (s *testPrintSuite) TestPrintSyncer(c *check.C) {
-	syncer, err := newPrintSyncer()
+	syncer, err := newPrintSyncer(nil)
 	c.Assert(err, check.IsNil)
 
 	out := capturer.CaptureStdout(func() {
@@ -35,6 +42,29 @@ func (s *testPrintSuite) TestPrintSyncer(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *testPrintSuite) TestPrintSyncerMasked(c *check.C) {
+	mask.SetGlobal(mask.New(&mask.Config{Rules: []mask.Rule{{Schema: "test", Table: "t1", Column: "b"}}}))
+	defer mask.SetGlobal(nil)
+
+	syncer, err := newPrintSyncer(nil)
+	c.Assert(err, check.IsNil)
+
+	out := capturer.CaptureStdout(func() {
+		syncTest(c, Syncer(syncer))
+	})
+
+	c.Assert(out, check.Equals,
+		"DDL query: create database test;\n"+
+			"schema: test; table: t1; type: Insert\n"+
+			"a(int): 1\n"+
+			"b(varchar): ******\n"+
+			"schema: test; table: t1; type: Delete\n"+
+			"a(int): 1\n"+
+			"b(varchar): ******\n"+
+			"schema: test; table: t1; type: Update\n"+
+			"c(varchar): test => abc\n")
+}
+
 func (s *testPrintSuite) TestPrintEventHeader(c *check.C) {
 	schema := "test"
 	table := "t1"
@@ -45,7 +75,7 @@ func (s *testPrintSuite) TestPrintEventHeader(c *check.C) {
 	}
 
 	out := capturer.CaptureStdout(func() {
-		printEventHeader(event)
+		printEventHeader(os.Stdout, event)
 	})
 	lines := strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 1)
@@ -59,7 +89,7 @@ func (s *testPrintSuite) TestPrintDDL(c *check.C) {
 	}
 
 	out := capturer.CaptureStdout(func() {
-		printDDL(ddlBinlog)
+		printDDL(os.Stdout, ddlBinlog)
 	})
 	lines := strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 1)
@@ -67,6 +97,8 @@ func (s *testPrintSuite) TestPrintDDL(c *check.C) {
 }
 
 func (s *testPrintSuite) TestPrintRow(c *check.C) {
+	p, err := newPrintSyncer(nil)
+	c.Assert(err, check.IsNil)
 	cols := generateColumns(c)
 
 	insertEvent := &pb.Event{
@@ -75,7 +107,7 @@ func (s *testPrintSuite) TestPrintRow(c *check.C) {
 	}
 
 	out := capturer.CaptureStdout(func() {
-		printEvent(insertEvent)
+		p.printEvent(os.Stdout, insertEvent)
 	})
 	lines := strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 3)
@@ -88,7 +120,7 @@ func (s *testPrintSuite) TestPrintRow(c *check.C) {
 		Row: [][]byte{cols[0], cols[1]},
 	}
 	out = capturer.CaptureStdout(func() {
-		printEvent(deleteEvent)
+		p.printEvent(os.Stdout, deleteEvent)
 	})
 	lines = strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 3)
@@ -101,10 +133,115 @@ func (s *testPrintSuite) TestPrintRow(c *check.C) {
 		Row: [][]byte{cols[2]},
 	}
 	out = capturer.CaptureStdout(func() {
-		printEvent(updateEvent)
+		p.printEvent(os.Stdout, updateEvent)
 	})
 	lines = strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 2)
 	c.Assert(lines[0], check.Equals, "schema: ; table: ; type: Update")
 	c.Assert(lines[1], check.Equals, "c(varchar): test => abc")
 }
+
+func (s *testPrintSuite) TestValidate(c *check.C) {
+	c.Assert((&PrintConfig{}).Validate(), check.IsNil)
+	c.Assert((&PrintConfig{Format: PrintSQL, Dir: "out", MaxLines: 10}).Validate(), check.IsNil)
+	c.Assert((&PrintConfig{Format: "json"}).Validate(), check.ErrorMatches, "format json of dest-print is not supported.*")
+	c.Assert((&PrintConfig{StartTSO: 10, StopTSO: 5}).Validate(), check.ErrorMatches, "stop-tso 5 of dest-print is less than.*")
+	c.Assert((&PrintConfig{Dir: "out", MaxLines: -1}).Validate(), check.ErrorMatches, "invalid max-lines -1")
+	c.Assert((&PrintConfig{MaxLines: 10}).Validate(), check.ErrorMatches, "max-lines of dest-print is set without dir")
+}
+
+func (s *testPrintSuite) TestPrintSQL(c *check.C) {
+	syncer, err := newPrintSyncer(&PrintConfig{Format: PrintSQL})
+	c.Assert(err, check.IsNil)
+
+	out := capturer.CaptureStdout(func() {
+		syncTest(c, Syncer(syncer))
+	})
+
+	header := fmt.Sprintf("-- commit ts: 0 (%s)\n", util.TSOToRoughTime(0).Format("2006-01-02 15:04:05"))
+	c.Assert(out, check.Equals,
+		header+
+			"USE `test`;\n"+
+			"create database test;\n"+
+			header+
+			"BEGIN;\n"+
+			"INSERT INTO `test`.`t1`(`a`,`b`) VALUES(1,'test');\n"+
+			"DELETE FROM `test`.`t1` WHERE `a` = 1 AND `b` = 'test' LIMIT 1;\n"+
+			"UPDATE `test`.`t1` SET `c` = 'abc' WHERE `c` = 'test' LIMIT 1;\n"+
+			"COMMIT;\n")
+}
+
+func (s *testPrintSuite) TestPrintRedacted(c *check.C) {
+	syncer, err := newPrintSyncer(&PrintConfig{Format: PrintSQL, Redact: true})
+	c.Assert(err, check.IsNil)
+
+	out := capturer.CaptureStdout(func() {
+		syncTest(c, Syncer(syncer))
+	})
+	c.Assert(out, check.Matches, "(?s).*INSERT INTO `test`.`t1`\\(`a`,`b`\\) VALUES\\('\\*{6}','\\*{6}'\\);.*")
+	c.Assert(strings.Contains(out, "'test'"), check.IsFalse)
+	c.Assert(strings.Contains(out, "'abc'"), check.IsFalse)
+}
+
+func (s *testPrintSuite) TestPrintFiltered(c *check.C) {
+	schema, t1, t2 := "test", "t1", "t2"
+	dmlBinlog := func(ts int64) *pb.Binlog {
+		return &pb.Binlog{
+			Tp:       pb.BinlogType_DML,
+			CommitTs: ts,
+			DmlData: &pb.DMLData{Events: []pb.Event{
+				{Tp: pb.EventType_Insert, SchemaName: &schema, TableName: &t1, Row: generateColumns(c)[:1]},
+				{Tp: pb.EventType_Insert, SchemaName: &schema, TableName: &t2, Row: generateColumns(c)[:1]},
+			}},
+		}
+	}
+
+	syncer, err := newPrintSyncer(&PrintConfig{
+		Tables:   []filter.TableName{{Schema: "test", Table: "~^t2$"}},
+		StartTSO: 10,
+		StopTSO:  20,
+	})
+	c.Assert(err, check.IsNil)
+
+	var synced []int64
+	out := capturer.CaptureStdout(func() {
+		for _, ts := range []int64{5, 10, 20, 25} {
+			err := syncer.Sync(dmlBinlog(ts), func(binlog *pb.Binlog) {
+				synced = append(synced, binlog.CommitTs)
+			})
+			c.Assert(err, check.IsNil)
+		}
+	})
+	// the binlogs filtered out are synced too
+	c.Assert(synced, check.DeepEquals, []int64{5, 10, 20, 25})
+	c.Assert(out, check.Equals, strings.Repeat("schema: test; table: t2; type: Insert\na(int): 1\n", 2))
+}
+
+func (s *testPrintSuite) TestPrintToFiles(c *check.C) {
+	dir := filepath.Join(c.MkDir(), "print")
+	syncer, err := newPrintSyncer(&PrintConfig{Format: PrintSQL, Dir: dir, MaxLines: 3})
+	c.Assert(err, check.IsNil)
+
+	syncTest(c, Syncer(syncer))
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// the binlog is never split into two files
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.DeepEquals, []string{filepath.Join(dir, "print-000001.sql"), filepath.Join(dir, "print-000002.sql")})
+
+	data, err := ioutil.ReadFile(files[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Count(string(data), "\n"), check.Equals, 3)
+	data, err = ioutil.ReadFile(files[1])
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Count(string(data), "\n"), check.Equals, 6)
+}
+
+func (s *testPrintSuite) TestInlineArgs(c *check.C) {
+	c.Assert(inlineArgs("UPDATE `t?` SET `a` = ?,`b` = ? WHERE `c` = ?", []interface{}{nil, "it's", []byte{0xff, 0x01}}),
+		check.Equals, "UPDATE `t?` SET `a` = NULL,`b` = 'it\\'s' WHERE `c` = x'ff01'")
+	c.Assert(sqlLiteral(1.5), check.Equals, "1.5")
+	c.Assert(sqlLiteral(uint64(7)), check.Equals, "7")
+	c.Assert(sqlLiteral(`a\b`), check.Equals, `'a\\b'`)
+}
@@ -0,0 +1,341 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pingcap/errors"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+const (
+	// StatsText writes the statistics as tables of text.
+	StatsText = "text"
+	// StatsJSON writes the statistics as a JSON document of StatsReport.
+	StatsJSON = "json"
+
+	defaultStatsTopN = 10
+	statsHourFormat  = "2006-01-02 15:00"
+)
+
+// StatsConfig is the configuration of the stats syncer, which aggregates the statistics of the binlogs
+// instead of applying them, e.g., to find out which upstream table makes the binlogs large.
+type StatsConfig struct {
+	// Format can be StatsText or StatsJSON, the default is StatsText.
+	Format string `toml:"format" json:"format"`
+	// the file the statistics are written to on close, empty means stdout.
+	Output string `toml:"output" json:"output"`
+	// the number of the largest txns reported, 10 if it's 0.
+	TopN int `toml:"top-n" json:"top-n"`
+}
+
+// Validate checks whether the configuration is valid.
+func (cfg *StatsConfig) Validate() error {
+	switch cfg.Format {
+	case "", StatsText, StatsJSON:
+	default:
+		return errors.Errorf("format %s of dest-stats is not supported, must be %s or %s", cfg.Format, StatsText, StatsJSON)
+	}
+
+	if cfg.TopN < 0 {
+		return errors.Errorf("invalid top-n %d", cfg.TopN)
+	}
+
+	return nil
+}
+
+// TableStats is the statistics of the binlogs of a table, the bytes are the sizes of the encoded events,
+// or the sizes of the binlogs for the DDLs.
+type TableStats struct {
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	Inserts int64  `json:"inserts"`
+	Updates int64  `json:"updates"`
+	Deletes int64  `json:"deletes"`
+	DDLs    int64  `json:"ddls"`
+	Txns    int64  `json:"txns"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Rows returns the number of the rows changed.
+func (s *TableStats) Rows() int64 {
+	return s.Inserts + s.Updates + s.Deletes
+}
+
+// HourStats is the statistics of the tables of the binlogs committed in an hour.
+type HourStats struct {
+	// the hour in local time, like "2019-01-01 15:00"
+	Hour   string        `json:"hour"`
+	Tables []*TableStats `json:"tables"`
+}
+
+// TxnStats is the statistics of a binlog.
+type TxnStats struct {
+	CommitTS int64    `json:"commit-ts"`
+	Rows     int64    `json:"rows"`
+	Bytes    int64    `json:"bytes"`
+	Tables   []string `json:"tables"`
+}
+
+// StatsReport is the statistics of all the binlogs synced.
+type StatsReport struct {
+	// the tables sorted by bytes in descending order, the busiest first
+	Tables []*TableStats `json:"tables"`
+	// the hours in order, the tables of each hour are sorted by bytes in descending order
+	Hours []*HourStats `json:"hours"`
+	// the largest txns sorted by bytes in descending order
+	LargestTxns []*TxnStats `json:"largest-txns"`
+}
+
+type tableKey struct {
+	schema string
+	table  string
+}
+
+// statsSyncer aggregates the statistics of the binlogs, which are written out on close
+type statsSyncer struct {
+	cfg *StatsConfig
+
+	tables map[tableKey]*TableStats
+	hours  map[string]map[tableKey]*TableStats
+	// at most cfg.TopN txns, not sorted
+	largest []*TxnStats
+}
+
+var _ Syncer = &statsSyncer{}
+
+func newStatsSyncer(cfg *StatsConfig) (*statsSyncer, error) {
+	if cfg == nil {
+		cfg = new(StatsConfig)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if cfg.TopN == 0 {
+		cfg.TopN = defaultStatsTopN
+	}
+
+	return &statsSyncer{
+		cfg:    cfg,
+		tables: make(map[tableKey]*TableStats),
+		hours:  make(map[string]map[tableKey]*TableStats),
+	}, nil
+}
+
+func (s *statsSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	hour := util.TSOToRoughTime(pbBinlog.CommitTs).Format(statsHourFormat)
+	txn := &TxnStats{CommitTS: pbBinlog.CommitTs}
+	// the tables of the txn, to count the txns of each table once
+	touched := make(map[tableKey]struct{})
+
+	switch pbBinlog.Tp {
+	case pb.BinlogType_DDL:
+		schema, table, err := parserSchemaTableFromDDL(string(pbBinlog.DdlQuery))
+		if err != nil {
+			return errors.Annotatef(err, "parse ddl %s failed", pbBinlog.DdlQuery)
+		}
+		key := tableKey{schema, table}
+		size := int64(pbBinlog.Size())
+		s.add(hour, key, func(stats *TableStats) {
+			stats.DDLs++
+			stats.Txns++
+			stats.Bytes += size
+		})
+		txn.Bytes = size
+		touched[key] = struct{}{}
+	case pb.BinlogType_DML:
+		for i := range pbBinlog.GetDmlData().GetEvents() {
+			event := &pbBinlog.DmlData.Events[i]
+			key := tableKey{event.GetSchemaName(), event.GetTableName()}
+			_, counted := touched[key]
+			size := int64(event.Size())
+			tp := event.GetTp()
+			s.add(hour, key, func(stats *TableStats) {
+				switch tp {
+				case pb.EventType_Insert:
+					stats.Inserts++
+				case pb.EventType_Update:
+					stats.Updates++
+				case pb.EventType_Delete:
+					stats.Deletes++
+				}
+				if !counted {
+					stats.Txns++
+				}
+				stats.Bytes += size
+			})
+			txn.Rows++
+			txn.Bytes += size
+			touched[key] = struct{}{}
+		}
+	default:
+		return errors.Errorf("unknown type: %v", pbBinlog.Tp)
+	}
+
+	for key := range touched {
+		txn.Tables = append(txn.Tables, quoteTable(key))
+	}
+	sort.Strings(txn.Tables)
+	s.addTxn(txn)
+
+	cb(pbBinlog)
+	return nil
+}
+
+// add updates the statistics of the table in total and in the hour
+func (s *statsSyncer) add(hour string, key tableKey, update func(stats *TableStats)) {
+	update(getTableStats(s.tables, key))
+
+	tables, ok := s.hours[hour]
+	if !ok {
+		tables = make(map[tableKey]*TableStats)
+		s.hours[hour] = tables
+	}
+	update(getTableStats(tables, key))
+}
+
+func getTableStats(tables map[tableKey]*TableStats, key tableKey) *TableStats {
+	stats, ok := tables[key]
+	if !ok {
+		stats = &TableStats{Schema: key.schema, Table: key.table}
+		tables[key] = stats
+	}
+	return stats
+}
+
+// addTxn keeps the txn if it's one of the largest ones
+func (s *statsSyncer) addTxn(txn *TxnStats) {
+	if len(s.largest) < s.cfg.TopN {
+		s.largest = append(s.largest, txn)
+		return
+	}
+	smallest := 0
+	for i, t := range s.largest {
+		if t.Bytes < s.largest[smallest].Bytes {
+			smallest = i
+		}
+	}
+	if txn.Bytes > s.largest[smallest].Bytes {
+		s.largest[smallest] = txn
+	}
+}
+
+// Report returns the statistics of the binlogs synced so far.
+func (s *statsSyncer) Report() *StatsReport {
+	report := &StatsReport{Tables: sortedTableStats(s.tables)}
+
+	hours := make([]string, 0, len(s.hours))
+	for hour := range s.hours {
+		hours = append(hours, hour)
+	}
+	sort.Strings(hours)
+	for _, hour := range hours {
+		report.Hours = append(report.Hours, &HourStats{Hour: hour, Tables: sortedTableStats(s.hours[hour])})
+	}
+
+	report.LargestTxns = append(report.LargestTxns, s.largest...)
+	sort.SliceStable(report.LargestTxns, func(i, j int) bool {
+		a, b := report.LargestTxns[i], report.LargestTxns[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.CommitTS < b.CommitTS
+	})
+	return report
+}
+
+func sortedTableStats(tables map[tableKey]*TableStats) []*TableStats {
+	sorted := make([]*TableStats, 0, len(tables))
+	for _, stats := range tables {
+		sorted = append(sorted, stats)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return quoteTable(tableKey{a.Schema, a.Table}) < quoteTable(tableKey{b.Schema, b.Table})
+	})
+	return sorted
+}
+
+func quoteTable(key tableKey) string {
+	if len(key.table) == 0 {
+		return pkgsql.QuoteName(key.schema)
+	}
+	return pkgsql.QuoteSchema(key.schema, key.table)
+}
+
+// Close writes the statistics to the output.
+func (s *statsSyncer) Close() error {
+	if len(s.cfg.Output) == 0 {
+		return errors.Trace(s.write(os.Stdout))
+	}
+
+	file, err := os.Create(s.cfg.Output)
+	if err != nil {
+		return errors.Annotatef(err, "create file %s failed", s.cfg.Output)
+	}
+	err = s.write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Annotatef(err, "write statistics to %s failed", s.cfg.Output)
+}
+
+func (s *statsSyncer) write(w io.Writer) error {
+	report := s.Report()
+	if s.cfg.Format == StatsJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Trace(enc.Encode(report))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "# tables by bytes")
+	fmt.Fprintln(tw, "TABLE\tROWS\tINSERTS\tUPDATES\tDELETES\tDDLS\tTXNS\tBYTES")
+	for _, stats := range report.Tables {
+		writeTableStats(tw, "", stats)
+	}
+
+	fmt.Fprintln(tw, "\n# tables by hour")
+	fmt.Fprintln(tw, "HOUR\tTABLE\tROWS\tINSERTS\tUPDATES\tDELETES\tDDLS\tTXNS\tBYTES")
+	for _, hour := range report.Hours {
+		for _, stats := range hour.Tables {
+			writeTableStats(tw, hour.Hour+"\t", stats)
+		}
+	}
+
+	fmt.Fprintf(tw, "\n# the %d largest txns\n", s.cfg.TopN)
+	fmt.Fprintln(tw, "COMMIT TS\tTIME\tROWS\tBYTES\tTABLES")
+	for _, txn := range report.LargestTxns {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%s\n", txn.CommitTS, util.TSOToRoughTime(txn.CommitTS).Format("2006-01-02 15:04:05"),
+			txn.Rows, txn.Bytes, strings.Join(txn.Tables, ","))
+	}
+	return errors.Trace(tw.Flush())
+}
+
+func writeTableStats(w io.Writer, prefix string, stats *TableStats) {
+	fmt.Fprintf(w, "%s%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", prefix, quoteTable(tableKey{stats.Schema, stats.Table}),
+		stats.Rows(), stats.Inserts, stats.Updates, stats.Deletes, stats.DDLs, stats.Txns, stats.Bytes)
+}
@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+type testStatsSuite struct{}
+
+var _ = check.Suite(&testStatsSuite{})
+
+func (s *testStatsSuite) TestStatsSyncer(c *check.C) {
+	dir, err := ioutil.TempDir("", "stats")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "stats.json")
+	syncer, err := newStatsSyncer(&StatsConfig{Format: StatsJSON, Output: output, TopN: 1})
+	c.Assert(err, check.IsNil)
+
+	syncTest(c, Syncer(syncer))
+
+	report := syncer.Report()
+	c.Assert(report.Tables, check.HasLen, 2)
+	t1 := report.Tables[0]
+	c.Assert(t1.Schema, check.Equals, "test")
+	c.Assert(t1.Table, check.Equals, "t1")
+	c.Assert(t1.Inserts, check.Equals, int64(1))
+	c.Assert(t1.Updates, check.Equals, int64(1))
+	c.Assert(t1.Deletes, check.Equals, int64(1))
+	c.Assert(t1.Rows(), check.Equals, int64(3))
+	c.Assert(t1.Txns, check.Equals, int64(1))
+	c.Assert(report.Tables[1].DDLs, check.Equals, int64(1))
+	c.Assert(report.Hours, check.HasLen, 1)
+	c.Assert(report.Hours[0].Tables, check.HasLen, 2)
+	c.Assert(report.LargestTxns, check.HasLen, 1)
+	c.Assert(report.LargestTxns[0].Rows, check.Equals, int64(3))
+	c.Assert(report.LargestTxns[0].Tables, check.DeepEquals, []string{"`test`.`t1`"})
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+
+	data, err := ioutil.ReadFile(output)
+	c.Assert(err, check.IsNil)
+	written := new(StatsReport)
+	err = json.Unmarshal(data, written)
+	c.Assert(err, check.IsNil)
+	c.Assert(written, check.DeepEquals, report)
+}
+
+func (s *testStatsSuite) TestLargestTxns(c *check.C) {
+	syncer, err := newStatsSyncer(&StatsConfig{TopN: 2})
+	c.Assert(err, check.IsNil)
+
+	for i, bytes := range []int64{10, 30, 20, 5} {
+		syncer.addTxn(&TxnStats{CommitTS: int64(i), Bytes: bytes})
+	}
+	report := syncer.Report()
+	c.Assert(report.LargestTxns, check.HasLen, 2)
+	c.Assert(report.LargestTxns[0].Bytes, check.Equals, int64(30))
+	c.Assert(report.LargestTxns[1].Bytes, check.Equals, int64(20))
+}
+
+func (s *testStatsSuite) TestInvalidConfig(c *check.C) {
+	_, err := newStatsSyncer(&StatsConfig{Format: "xml"})
+	c.Assert(err, check.ErrorMatches, ".*not supported.*")
+
+	_, err = newStatsSyncer(&StatsConfig{TopN: -1})
+	c.Assert(err, check.ErrorMatches, "invalid top-n.*")
+
+	syncer, err := newStatsSyncer(nil)
+	c.Assert(err, check.IsNil)
+	err = syncer.Sync(&pb.Binlog{Tp: pb.BinlogType(100)}, func(*pb.Binlog) {})
+	c.Assert(err, check.NotNil)
+}
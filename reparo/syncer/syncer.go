@@ -14,9 +14,9 @@
 package syncer
 
 import (
-	"fmt"
-
+	"github.com/pingcap/errors"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"go.uber.org/zap"
 )
 
 // Syncer is the interface for executing binlog event to the target.
@@ -29,14 +29,19 @@ type Syncer interface {
 }
 
 // New creates a new executor based on the name.
-func New(name string, cfg *DBConfig, worker int, batchSize int, safemode bool) (Syncer, error) {
+// logger is injected into the loader of mysql syncer.
+func New(name string, cfg *DBConfig, fileCfg *FileConfig, printCfg *PrintConfig, statsCfg *StatsConfig, worker int, batchSize int, safemode bool, logger *zap.Logger) (Syncer, error) {
 	switch name {
 	case "mysql":
-		return newMysqlSyncer(cfg, worker, batchSize, safemode)
+		return newMysqlSyncer(cfg, worker, batchSize, safemode, logger)
+	case "file":
+		return newFileSyncer(fileCfg)
 	case "print":
-		return newPrintSyncer()
+		return newPrintSyncer(printCfg)
+	case "stats":
+		return newStatsSyncer(statsCfg)
 	case "memory":
 		return newMemSyncer()
 	}
-	panic(fmt.Sprintf("unknown syncer %s", name))
+	return nil, errors.Errorf("unknown syncer %s", name)
 }
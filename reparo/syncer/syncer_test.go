@@ -4,6 +4,7 @@ import (
 	"reflect"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/log"
 )
 
 type testSyncerSuite struct{}
@@ -34,8 +35,11 @@ func (s *testSyncerSuite) TestNewSyncer(c *check.C) {
 	}
 
 	for _, testCase := range testCases {
-		syncer, err := New(testCase.typeStr, cfg, 16, 20, false)
+		syncer, err := New(testCase.typeStr, cfg, nil, nil, nil, 16, 20, false, log.L())
 		c.Assert(err, check.IsNil)
 		c.Assert(reflect.TypeOf(syncer), testCase.checker, testCase.tp)
 	}
+
+	_, err := New("unknown", cfg, nil, nil, nil, 16, 20, false, log.L())
+	c.Assert(err, check.ErrorMatches, "unknown syncer unknown")
 }
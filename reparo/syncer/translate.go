@@ -15,13 +15,18 @@ package syncer
 
 import (
 	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser"
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/mask"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
 	_ "github.com/pingcap/tidb/types/parser_driver" // for parser driver
 	"github.com/pingcap/tidb/util/codec"
 	"go.uber.org/zap"
@@ -36,7 +41,26 @@ func trimUse(sql string) string {
 	return sql
 }
 
-func pbBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
+// timestampConverter converts the TIMESTAMP values from the time zone of binlog files to the
+// session time zone of downstream, a nil converter keeps the values as they are.
+type timestampConverter struct {
+	from *time.Location
+	to   *time.Location
+}
+
+func (t *timestampConverter) convert(value types.Datum, tp byte) (types.Datum, error) {
+	if t == nil || tp != mysql.TypeTimestamp || value.IsNull() {
+		return value, nil
+	}
+
+	converted, err := util.ConvertTimestamp(value.GetString(), t.from, t.to)
+	if err != nil {
+		return value, errors.Trace(err)
+	}
+	return types.NewDatum(converted), nil
+}
+
+func pbBinlogToTxn(binlog *pb.Binlog, tsConverter *timestampConverter) (txn *loader.Txn, err error) {
 	txn = new(loader.Txn)
 	switch binlog.Tp {
 	case pb.BinlogType_DDL:
@@ -64,7 +88,7 @@ func pbBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
 			case pb.EventType_Insert:
 				dml.Tp = loader.InsertDMLType
 
-				cols, args, err := genColsAndArgs(event.Row)
+				cols, args, err := genColsAndArgs(dml.Database, dml.Table, event.Row, tsConverter)
 				if err != nil {
 					return nil, errors.Trace(err)
 				}
@@ -95,17 +119,23 @@ func pbBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
 					}
 
 					tp := col.Tp[0]
-					newDatum = formatValue(newDatum, tp)
+					newDatum, err = tsConverter.convert(formatValue(newDatum, tp), tp)
+					if err != nil {
+						return nil, errors.Annotatef(err, "column %s", col.Name)
+					}
 					newValue := newDatum.GetValue()
-					oldDatum = formatValue(oldDatum, tp)
+					oldDatum, err = tsConverter.convert(formatValue(oldDatum, tp), tp)
+					if err != nil {
+						return nil, errors.Annotatef(err, "column %s", col.Name)
+					}
 					oldValue := oldDatum.GetValue()
 
 					log.Debug("translate update event",
 						zap.String("col name", col.Name),
 						zap.String("col mysql type", col.MysqlType),
 						zap.Uint8("tp", tp),
-						zap.Reflect("old value", oldValue),
-						zap.Reflect("new value", newValue))
+						zap.Reflect("old value", mask.Value(dml.Database, dml.Table, col.Name, oldValue)),
+						zap.Reflect("new value", mask.Value(dml.Database, dml.Table, col.Name, newValue)))
 
 					dml.Values[col.Name] = newValue
 					dml.OldValues[col.Name] = oldValue
@@ -113,7 +143,7 @@ func pbBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
 			case pb.EventType_Delete:
 				dml.Tp = loader.DeleteDMLType
 
-				cols, args, err := genColsAndArgs(event.Row)
+				cols, args, err := genColsAndArgs(dml.Database, dml.Table, event.Row, tsConverter)
 				if err != nil {
 					return nil, errors.Trace(err)
 				}
@@ -133,7 +163,7 @@ func pbBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
 	return
 }
 
-func genColsAndArgs(row [][]byte) (cols []string, args []interface{}, err error) {
+func genColsAndArgs(schema, table string, row [][]byte, tsConverter *timestampConverter) (cols []string, args []interface{}, err error) {
 	cols = make([]string, 0, len(row))
 	args = make([]interface{}, 0, len(row))
 	for _, c := range row {
@@ -150,11 +180,14 @@ func genColsAndArgs(row [][]byte) (cols []string, args []interface{}, err error)
 		}
 
 		tp := col.Tp[0]
-		val = formatValue(val, tp)
+		val, err = tsConverter.convert(formatValue(val, tp), tp)
+		if err != nil {
+			return nil, nil, errors.Annotatef(err, "column %s", col.Name)
+		}
 		log.Debug("format value",
 			zap.String("col name", col.Name),
 			zap.String("mysql type", col.MysqlType),
-			zap.Reflect("value", val.GetValue()))
+			zap.Reflect("value", mask.Value(schema, table, col.Name, val.GetValue())))
 		args = append(args, val.GetValue())
 	}
 
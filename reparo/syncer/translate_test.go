@@ -15,6 +15,7 @@ package syncer
 
 import (
 	"testing"
+	"time"
 
 	"github.com/pingcap/check"
 	"github.com/pingcap/parser/mysql"
@@ -159,7 +160,7 @@ func (s *testTranslateSuite) TestPBBinlogToTxn(c *check.C) {
 	}
 
 	for binlog, txn := range tests {
-		getTxn, err := pbBinlogToTxn(binlog)
+		getTxn, err := pbBinlogToTxn(binlog, nil)
 		c.Assert(err, check.IsNil)
 		c.Assert(getTxn.DDL, check.DeepEquals, txn.DDL)
 		c.Assert(getTxn.DMLs, check.DeepEquals, txn.DMLs)
@@ -182,12 +183,50 @@ func (s *testTranslateSuite) TestTrimUse(c *check.C) {
 }
 
 func (s *testTranslateSuite) TestGenColsAndArgs(c *check.C) {
-	cols, args, err := genColsAndArgs(generateColumns(c))
+	cols, args, err := genColsAndArgs("test", "t", generateColumns(c), nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(cols, check.DeepEquals, []string{"a", "b", "c"})
 	c.Assert(args, check.DeepEquals, []interface{}{int64(1), "test", "test"})
 }
 
+func (s *testTranslateSuite) TestConvertTimestamp(c *check.C) {
+	col := &pb.Column{
+		Name:         "ts",
+		Tp:           []byte{mysql.TypeTimestamp},
+		MysqlType:    "timestamp",
+		Value:        encodeBytesValue([]byte("2019-05-01 08:00:00.123")),
+		ChangedValue: encodeBytesValue([]byte("2019-05-01 00:00:00")),
+	}
+	colBytes, err := col.Marshal()
+	c.Assert(err, check.IsNil)
+	row := append(generateColumns(c)[:1], colBytes)
+
+	tsConverter := &timestampConverter{from: time.FixedZone("+08:00", 8*3600), to: time.UTC}
+	cols, args, err := genColsAndArgs("test", "t", row, tsConverter)
+	c.Assert(err, check.IsNil)
+	c.Assert(cols, check.DeepEquals, []string{"a", "ts"})
+	c.Assert(args, check.DeepEquals, []interface{}{int64(1), "2019-05-01 00:00:00.123"})
+
+	// the values are kept as they are without converter
+	_, args, err = genColsAndArgs("test", "t", row, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(args, check.DeepEquals, []interface{}{int64(1), "2019-05-01 08:00:00.123"})
+
+	schema, table := "test", "t1"
+	txn, err := pbBinlogToTxn(&pb.Binlog{
+		Tp: pb.BinlogType_DML,
+		DmlData: &pb.DMLData{Events: []pb.Event{{
+			Tp:         pb.EventType_Update,
+			SchemaName: &schema,
+			TableName:  &table,
+			Row:        [][]byte{colBytes},
+		}}},
+	}, tsConverter)
+	c.Assert(err, check.IsNil)
+	c.Assert(txn.DMLs[0].OldValues["ts"], check.Equals, "2019-05-01 00:00:00.123")
+	c.Assert(txn.DMLs[0].Values["ts"], check.Equals, "2019-04-30 16:00:00")
+}
+
 // generateDMLEvents generates three DML Events for test.
 func generateDMLEvents(c *check.C) []pb.Event {
 	schema := "test"